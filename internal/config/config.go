@@ -1,18 +1,424 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
 type Config struct {
-	ServerPort     string
+	ServerPort string
+
+	// StorageBackend names the registered storage backend payloads are kept in
+	StorageBackend string
+	// LocalRoot is the directory the local storage backend keeps payloads under
+	LocalRoot string
+	// MemoryMaxBytes caps the memory storage backend, dropping the oldest payloads
+	// beyond it; 0 means no cap
+	MemoryMaxBytes int64
+	// S3 connection for the s3 storage backend. Without an access key, the AWS
+	// credential chain is used.
+	S3Endpoint        string
+	S3Region          string
+	S3Bucket          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3SessionToken    string
+	S3UseSSL          bool
+
 	MinioEndpoint  string
 	MinioAccessKey string
 	MinioSecretKey string
 	MinioBucket    string
 	MinioUseSSL    bool
+
+	// MinioStorageClass is sent with every upload when set
+	MinioStorageClass string
+
+	// MinioSSE requests server-side encryption of every upload: "SSE-S3", or "SSE-KMS"
+	// under MinioSSEKMSKeyID with the optional JSON encryption context MinioSSEKMSContext
+	MinioSSE           string
+	MinioSSEKMSKeyID   string
+	MinioSSEKMSContext string
+
+	// Multipart upload tuning; zero values keep the client defaults
+	MinioPartSize          int64
+	MinioUploadConcurrency int64
+	MinioDisableMultipart  bool
+
+	// MinioObjectLock creates the bucket with object locking, enabling legal holds and retention
+	MinioObjectLock bool
+	// MinioRetentionMode is GOVERNANCE or COMPLIANCE for retention set through the depot
+	MinioRetentionMode string
+
+	// Saves, reads and listings that fail with a network error, a 429 or 5xx status, or
+	// one of the S3 error codes MinioRetryCodes are attempted up to MinioRetryMaxAttempts
+	// times, backing off exponentially with jitter
+	MinioRetryMaxAttempts    int64
+	MinioRetryInitialBackoff time.Duration
+	MinioRetryMaxBackoff     time.Duration
+	MinioRetryCodes          []string
+
+	// Replica endpoints enable failover; MinioEndpoint stays the primary
+	MinioReplicaEndpoints    []string
+	MinioWritePolicy         string
+	MinioHealthCheckInterval time.Duration
+
+	// Quota-driven eviction; disabled when QuotaBytes is 0
+	QuotaBytes     int64
+	EvictionPolicy string
+	TagPriorities  map[string]int
+
+	// Cold-archive tiering; disabled when ArchiveAfterDays is 0
+	ArchiveAfterDays    int64
+	ArchiveBucket       string
+	ArchiveStorageClass string
+	ArchiveInterval     time.Duration
+
+	// CallbackSecret signs per-upload completion callbacks when set
+	CallbackSecret string
+	// CallbackAllowedHosts limits the hosts callbacks may reach; empty allows any public host
+	CallbackAllowedHosts []string
+	// CallbackAllowPrivate lets callbacks reach loopback, private and link-local addresses
+	CallbackAllowPrivate bool
+
+	// Retry policy for completion callbacks
+	CallbackMaxAttempts    int64
+	CallbackBackoff        string
+	CallbackInitialBackoff time.Duration
+	CallbackMaxBackoff     time.Duration
+	CallbackTimeout        time.Duration
+	CallbackConcurrency    int64
+
+	// DeliveryRetention bounds the outbound delivery log
+	DeliveryRetention int64
+
+	// Changes feed; persisted to ChangesFile when set
+	ChangesFile      string
+	ChangesRetention int64
+
+	// Limits for server-side JSON queries
+	QueryTimeout    time.Duration
+	QueryMaxResults int64
+
+	// Limits for uploads unpacked with X-Depot-Extract
+	ExtractMaxEntries int64
+	ExtractMaxBytes   int64
+
+	// DecompressMaxBytes bounds copies made for X-Depot-Decompress uploads
+	DecompressMaxBytes int64
+
+	// At-rest encryption; disabled when EncryptionKeys is empty
+	EncryptionKeys      string
+	EncryptionActiveKey string
+	// EncryptionRequired refuses to start without at-rest encryption configured
+	EncryptionRequired bool
+
+	// Envelope encryption through "kms" or "vault"; static keys above still decrypt older objects
+	EncryptionProvider string
+	KMSKeyID           string
+	KMSRegion          string
+	VaultAddress       string
+	VaultToken         string
+	VaultTransitMount  string
+	VaultTransitKey    string
+
+	// ForwardTargetsFile lists replay/forward targets as a JSON array
+	ForwardTargetsFile string
+	// RoutingRulesFile lists rules applied to every upload as a JSON array
+	RoutingRulesFile string
+	// RedactionRulesFile lists rules that remove personal data before storage
+	RedactionRulesFile string
+	// DetectSensitive lists the kinds of secrets and personal data to flag, or "all";
+	// flagged objects are sent to the DetectNotify forward targets
+	DetectSensitive []string
+	DetectNotify    []string
+
+	// ExecHook runs after every stored payload when set; runs are bounded by the
+	// timeout and concurrency, and retried up to ExecHookMaxAttempts times
+	ExecHook            string
+	ExecHookTimeout     time.Duration
+	ExecHookConcurrency int64
+	ExecHookMaxAttempts int64
+
+	// PolicyPath is a Rego policy file or directory that accepts or rejects uploads;
+	// empty disables admission policies
+	PolicyPath    string
+	PolicyTimeout time.Duration
+
+	// ScriptsDir holds Lua scripts run on every payload; empty disables scripting.
+	// Each call is limited to ScriptTimeout, and payloads above ScriptMaxBytes are
+	// passed without their data.
+	ScriptsDir         string
+	ScriptTimeout      time.Duration
+	ScriptMaxBytes     int64
+	ScriptPoolSize     int64
+	ScriptAllowedHosts []string
+
+	// Dedup stores identical payloads once, with references to a shared blob
+	Dedup bool
+
+	// Compression compresses stored payloads with "gzip" or "zstd"; empty disables it
+	Compression string
+	// CompressionMinSize is the smallest payload, in bytes, worth compressing
+	CompressionMinSize int64
+	// CompressionTypes lists the content types compressed; empty uses the defaults
+	CompressionTypes []string
+
+	// ChunkSize splits objects larger than this many bytes into part-objects; 0 disables chunking
+	ChunkSize int64
+
+	// Upload progress sessions are flagged stalled after UploadStallAfter without data,
+	// and kept for UploadProgressRetention once finished
+	UploadStallAfter        time.Duration
+	UploadProgressRetention time.Duration
+	// UploadSessionTimeout aborts resumable upload sessions idle for this long
+	UploadSessionTimeout time.Duration
+	// StoreStatusRetention keeps the storage state of finished uploads for /status
+	StoreStatusRetention time.Duration
+
+	// ListCacheTTL caches /list and per-request listings; 0 disables the cache
+	ListCacheTTL time.Duration
+	// ReadOnly starts the depot in maintenance mode, refusing new payloads with
+	// MaintenanceMessage until it is switched off through /admin/maintenance
+	ReadOnly           bool
+	MaintenanceMessage string
+
+	// LogFormat is "text" or "json"; lines below LogLevel are dropped
+	LogFormat string
+	LogLevel  string
+
+	// Tracing exports OpenTelemetry spans over OTLP/HTTP once the standard
+	// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set,
+	// sampling TraceSampleRatio of the traces that start at the depot
+	Tracing          bool
+	TraceSampleRatio float64
+
+	// ChaosMode injects the Chaos* storage faults; for test environments only
+	ChaosMode            bool
+	ChaosLatency         time.Duration
+	ChaosJitter          time.Duration
+	ChaosSaveFailureRate float64
+	ChaosReadFailureRate float64
+	ChaosOutageEvery     time.Duration
+	ChaosOutageFor       time.Duration
+	// ExportMaxRows and ExportMaxBytes cap the rows and payload bytes of one /export;
+	// 0 removes a cap
+	ExportMaxRows  int64
+	ExportMaxBytes int64
+	// GetMaxInlineBytes caps the base64 payload data in one /get JSON response; 0
+	// removes the cap
+	GetMaxInlineBytes int64
+	// MaxBodySize refuses /depot bodies larger than this many bytes; 0 accepts any size
+	MaxBodySize int64
+	// SyncStore makes /depot answer only once payloads are saved
+	SyncStore bool
+	// SaveWorkers save asynchronous uploads, which wait in a queue of SaveQueueSize;
+	// an upload finding it full waits up to SaveQueueWait, then gets 503. 0 workers
+	// saves each upload on its own goroutine
+	SaveWorkers   int64
+	SaveQueueSize int64
+	SaveQueueWait time.Duration
+	// WriteAheadDir keeps payloads storage fails to save on local disk, retried with
+	// backoff from WriteAheadInitialBackoff to WriteAheadMaxBackoff; empty disables it
+	WriteAheadDir            string
+	WriteAheadInitialBackoff time.Duration
+	WriteAheadMaxBackoff     time.Duration
+	// StreamThreshold streams /depot bodies of at least this many bytes into storage;
+	// 0 streams only bodies of unknown length
+	StreamThreshold int64
+	// KeepContentEncoding stores compressed /depot bodies as sent instead of decoding them
+	KeepContentEncoding bool
+	// ShutdownTimeout bounds how long a SIGTERM or SIGINT waits for requests and saves in flight
+	ShutdownTimeout time.Duration
+	// TLSCert and TLSKey serve HTTPS, with HTTP/2, instead of plain HTTP. TLSSelfSigned
+	// generates a certificate for TLSHosts at startup instead, for development.
+	TLSCert       string
+	TLSKey        string
+	TLSSelfSigned bool
+	TLSHosts      []string
+	// HTTP server timeouts, as http.Server applies them; 0 disables one
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// StorageTimeout bounds each request to MinIO; 0 disables it
+	StorageTimeout time.Duration
+
+	// MetadataStore is "memory", "sqlite" or "postgres"; SQLite keeps the index of a
+	// single depot across restarts, and Postgres shares it between replicas
+	MetadataStore string
+	PostgresURL   string
+	SQLitePath    string
+
+	// SelfTestTimeout bounds how long /admin/selftest waits for its probe to be stored
+	SelfTestTimeout time.Duration
+
+	// Load shedding; disabled when both ShedMaxInFlight and ShedTargetLatency are 0
+	ShedMaxInFlight   int64
+	ShedTargetLatency time.Duration
+	RoutePriorities   map[string]int
+
+	// CORS for browser clients; disabled when CORSOrigins is empty
+	CORSOrigins     []string
+	CORSMethods     []string
+	CORSHeaders     []string
+	CORSCredentials bool
+	CORSMaxAge      time.Duration
+
+	// Per-client rate limiting, in requests per second; disabled when RateLimit is 0
+	// and no client has a rate of its own
+	RateLimit        float64
+	RateLimitBurst   int64
+	RateLimitClients map[string]float64
+
+	// NamespaceHeader names the namespace a request is made on behalf of; empty
+	// disables usage accounting and bucket provisioning. UsageFile keeps the
+	// accounted usage across restarts, and BucketTemplateFile provisions a bucket for
+	// every new namespace.
+	NamespaceHeader    string
+	UsageFile          string
+	BucketTemplateFile string
+
+	// Bearer token authentication, enabled by an OIDC issuer or a JWKS URL, for
+	// tokens issued to OIDCAudience.
+	// AuthRouteScopes maps routes, or route prefixes ending in "/", to the scope
+	// they require.
+	OIDCIssuer       string
+	OIDCJWKSURL      string
+	OIDCAudience     string
+	AuthPublicRoutes []string
+	AuthRouteScopes  map[string]string
+
+	// The /admin/* routes need AdminKey in the X-Depot-Admin-Key header, or a bearer
+	// token with AdminScope; with neither they are refused to everyone
+	AdminKey   string
+	AdminScope string
+
+	// Tenants are resolved from an API key in TenantAPIKeys, mapping keys to
+	// tenants, or else from TenantHeader; either enables tenant scoping
+	TenantHeader  string
+	TenantAPIKeys map[string]string
+	// TenantBuckets maps tenants to a dedicated bucket their payloads are kept in
+	TenantBuckets map[string]string
+
+	// Middleware orders the handler middleware stages and Pipeline the payload
+	// processing stages; empty keeps the defaults and "none" disables them all
+	Middleware []string
+	Pipeline   []string
+
+	// StoredHeaders selects the request headers stored with every payload, by name or
+	// "X-*" prefix; empty keeps the defaults and "none" stores none
+	StoredHeaders []string
+
+	// Maintenance jobs run on cron schedules, keyed by job name
+	Jobs map[string]JobConfig
+	// RetentionMaxAge is how long the retention job keeps payloads
+	RetentionMaxAge time.Duration
+	// RetentionClasses keep payloads tagged with a class name for the class's age
+	RetentionClasses map[string]time.Duration
+	// RetentionLifecycle has the bucket's lifecycle rules expire payloads by age
+	RetentionLifecycle bool
+	// The backup job keeps BackupKeep index snapshots in BackupDir; 0 keeps them all
+	BackupDir  string
+	BackupKeep int64
+
+	// SFTPAddr serves the depot over SFTP; empty disables the SFTP frontend. Users log
+	// in with SFTPUsers passwords or SFTPAuthorizedKeys, and may upload and delete
+	// files only when SFTPWritable is set.
+	SFTPAddr           string
+	SFTPHostKey        string
+	SFTPUsers          map[string]string
+	SFTPAuthorizedKeys string
+	SFTPWritable       bool
+
+	// FTPAddr serves the depot over FTP; empty disables the FTP frontend. FTPS is
+	// offered when FTPTLSCert and FTPTLSKey are set, and required with FTPRequireTLS.
+	// FTPPublicHost and FTPPassivePorts ("30000-30009") describe the passive data
+	// connections for servers behind NAT.
+	FTPAddr         string
+	FTPUsers        map[string]string
+	FTPWritable     bool
+	FTPTLSCert      string
+	FTPTLSKey       string
+	FTPRequireTLS   bool
+	FTPPublicHost   string
+	FTPPassivePorts string
+
+	// WebDAVAddr serves the depot over WebDAV for mounting as a network drive; empty
+	// disables it. Clients authenticate with WebDAVUsers over HTTP basic auth.
+	WebDAVAddr     string
+	WebDAVUsers    map[string]string
+	WebDAVWritable bool
+
+	// DepotFSRefresh is how often the depotfs command rescans storage for new objects
+	// when the metadata index is not shared; zero keeps the index from mount time
+	DepotFSRefresh time.Duration
+
+	// WatchDir is a local directory whose files are ingested as payloads; empty disables
+	// the watch folder. Ingested files are moved to WatchArchiveDir, or deleted when it
+	// is empty.
+	WatchDir        string
+	WatchArchiveDir string
+	WatchInterval   time.Duration
+
+	// IngestBucket is another bucket whose new objects are imported as payloads; empty
+	// disables bucket ingestion. IngestMode is notify or poll, and IngestDelete removes
+	// imported objects from the bucket.
+	IngestBucket   string
+	IngestMode     string
+	IngestInterval time.Duration
+	IngestDelete   bool
+
+	// KafkaTopics are consumed and archived as payloads; empty disables the consumer.
+	// KafkaStartOffset is earliest or latest, for groups without committed offsets.
+	KafkaBrokers     []string
+	KafkaTopics      []string
+	KafkaGroup       string
+	KafkaStartOffset string
+	KafkaTLS         bool
+	KafkaUsername    string
+	KafkaPassword    string
+
+	// EventsPublisher publishes a payload.stored event for every stored object to
+	// "kafka" or "nats"; empty disables it. EventsTopic is the Kafka topic or NATS
+	// subject, and EventsFormat is "json" or "cloudevents".
+	EventsPublisher    string
+	EventsTopic        string
+	EventsFormat       string
+	EventsBuffer       int64
+	EventsKafkaBrokers []string
+	EventsNATSURL      string
+
+	// MQTTTopics are topic filters whose messages are stored as payloads; empty
+	// disables the subscriber. Brokers are URLs such as tcp://host:1883 or ssl://host:8883.
+	MQTTBrokers  []string
+	MQTTTopics   []string
+	MQTTQoS      int64
+	MQTTClientID string
+	MQTTUsername string
+	MQTTPassword string
+
+	// GitHubWebhookSecret enables /webhooks/github, verifying deliveries signed with it
+	GitHubWebhookSecret string
+
+	// StripeWebhookSecret enables /webhooks/stripe, verifying events signed with it
+	// whose timestamp is within StripeTolerance of now
+	StripeWebhookSecret string
+	StripeTolerance     time.Duration
+
+	// WebhookMaxBodySize refuses webhook bodies larger than this many bytes before
+	// their signature is checked; 0 accepts any size
+	WebhookMaxBodySize int64
+}
+
+// JobConfig schedules one maintenance job
+type JobConfig struct {
+	Schedule string
+	Enabled  bool
 }
 
 type ConfigManager struct {
@@ -44,14 +450,296 @@ func (cm *ConfigManager) GetConfig() *Config {
 	return cm.config
 }
 
+// Validate reports settings that name an unknown option
+func (c *Config) Validate() error {
+	switch c.EvictionPolicy {
+	case "fifo", "tag-priority":
+	default:
+		return fmt.Errorf("unknown DEPOT_EVICTION_POLICY %q; use fifo or tag-priority", c.EvictionPolicy)
+	}
+	// Without an audience, any token the issuer signed for another service would do
+	if (c.OIDCIssuer != "" || c.OIDCJWKSURL != "") && c.OIDCAudience == "" {
+		return fmt.Errorf("bearer token authentication needs DEPOT_OIDC_AUDIENCE")
+	}
+	return nil
+}
+
 func LoadConfig() *Config {
 	return &Config{
 		ServerPort:     GetEnv("SERVER_PORT", "3003"),
+		StorageBackend: GetEnv("STORAGE_BACKEND", "minio"),
+		LocalRoot:      GetEnv("DEPOT_LOCAL_ROOT", "depot-data"),
+		MemoryMaxBytes: GetEnvInt64("DEPOT_MEMORY_MAX_BYTES", 0),
+
+		S3Endpoint:        GetEnv("S3_ENDPOINT", "s3.amazonaws.com"),
+		S3Region:          GetEnv("S3_REGION", "us-east-1"),
+		S3Bucket:          GetEnv("S3_BUCKET", ""),
+		S3AccessKeyID:     GetEnv("S3_ACCESS_KEY_ID", ""),
+		S3SecretAccessKey: GetEnv("S3_SECRET_ACCESS_KEY", ""),
+		S3SessionToken:    GetEnv("S3_SESSION_TOKEN", ""),
+		S3UseSSL:          GetEnv("S3_USE_SSL", "true") == "true",
+
 		MinioEndpoint:  GetEnv("MINIO_ENDPOINT", "localhost:9000"),
 		MinioAccessKey: GetEnv("MINIO_ACCESS_KEY", "minioadmin"),
 		MinioSecretKey: GetEnv("MINIO_SECRET_KEY", "minioadmin"),
 		MinioBucket:    GetEnv("MINIO_BUCKET", "depot-payloads"),
 		MinioUseSSL:    GetEnv("MINIO_USE_SSL", "false") == "true",
+		QuotaBytes:     GetEnvInt64("DEPOT_QUOTA_BYTES", 0),
+		EvictionPolicy: GetEnv("DEPOT_EVICTION_POLICY", "fifo"),
+		TagPriorities:  GetEnvIntMap("DEPOT_TAG_PRIORITIES"),
+
+		MinioStorageClass: GetEnv("MINIO_STORAGE_CLASS", ""),
+
+		MinioSSE:           GetEnv("MINIO_SSE", ""),
+		MinioSSEKMSKeyID:   GetEnv("MINIO_SSE_KMS_KEY_ID", ""),
+		MinioSSEKMSContext: GetEnv("MINIO_SSE_KMS_CONTEXT", ""),
+
+		MinioPartSize:          GetEnvInt64("MINIO_PART_SIZE", 0),
+		MinioUploadConcurrency: GetEnvInt64("MINIO_UPLOAD_CONCURRENCY", 0),
+		MinioDisableMultipart:  GetEnv("MINIO_DISABLE_MULTIPART", "false") == "true",
+
+		MinioObjectLock:    GetEnv("MINIO_OBJECT_LOCK", "false") == "true",
+		MinioRetentionMode: GetEnv("MINIO_RETENTION_MODE", "GOVERNANCE"),
+
+		MinioRetryMaxAttempts:    GetEnvInt64("MINIO_RETRY_MAX_ATTEMPTS", 3),
+		MinioRetryInitialBackoff: GetEnvDuration("MINIO_RETRY_INITIAL_BACKOFF", 100*time.Millisecond),
+		MinioRetryMaxBackoff:     GetEnvDuration("MINIO_RETRY_MAX_BACKOFF", 2*time.Second),
+		MinioRetryCodes:          GetEnvList("MINIO_RETRY_CODES"),
+
+		MinioReplicaEndpoints:    GetEnvList("MINIO_REPLICA_ENDPOINTS"),
+		MinioWritePolicy:         GetEnv("MINIO_WRITE_POLICY", "primary"),
+		MinioHealthCheckInterval: GetEnvDuration("MINIO_HEALTH_CHECK_INTERVAL", 10*time.Second),
+
+		ArchiveAfterDays:    GetEnvInt64("DEPOT_ARCHIVE_AFTER_DAYS", 0),
+		ArchiveBucket:       GetEnv("DEPOT_ARCHIVE_BUCKET", "depot-archive"),
+		ArchiveStorageClass: GetEnv("DEPOT_ARCHIVE_STORAGE_CLASS", ""),
+		ArchiveInterval:     GetEnvDuration("DEPOT_ARCHIVE_INTERVAL", time.Hour),
+
+		CallbackSecret:       GetEnv("DEPOT_CALLBACK_SECRET", ""),
+		CallbackAllowedHosts: GetEnvList("DEPOT_CALLBACK_ALLOWED_HOSTS"),
+		CallbackAllowPrivate: GetEnv("DEPOT_CALLBACK_ALLOW_PRIVATE", "false") == "true",
+
+		CallbackMaxAttempts:    GetEnvInt64("DEPOT_CALLBACK_MAX_ATTEMPTS", 5),
+		CallbackBackoff:        GetEnv("DEPOT_CALLBACK_BACKOFF", "exponential"),
+		CallbackInitialBackoff: GetEnvDuration("DEPOT_CALLBACK_INITIAL_BACKOFF", time.Second),
+		CallbackMaxBackoff:     GetEnvDuration("DEPOT_CALLBACK_MAX_BACKOFF", 5*time.Minute),
+		CallbackTimeout:        GetEnvDuration("DEPOT_CALLBACK_TIMEOUT", 10*time.Second),
+		CallbackConcurrency:    GetEnvInt64("DEPOT_CALLBACK_CONCURRENCY", 0),
+
+		DeliveryRetention: GetEnvInt64("DEPOT_DELIVERY_RETENTION", 1000),
+
+		ChangesFile:      GetEnv("DEPOT_CHANGES_FILE", ""),
+		ChangesRetention: GetEnvInt64("DEPOT_CHANGES_RETENTION", 10000),
+
+		QueryTimeout:    GetEnvDuration("DEPOT_QUERY_TIMEOUT", 5*time.Second),
+		QueryMaxResults: GetEnvInt64("DEPOT_QUERY_MAX_RESULTS", 1000),
+
+		ExtractMaxEntries: GetEnvInt64("DEPOT_EXTRACT_MAX_ENTRIES", 1000),
+		ExtractMaxBytes:   GetEnvInt64("DEPOT_EXTRACT_MAX_BYTES", 100<<20),
+
+		DecompressMaxBytes: GetEnvInt64("DEPOT_DECOMPRESS_MAX_BYTES", 100<<20),
+
+		EncryptionKeys:      GetEnv("DEPOT_ENCRYPTION_KEYS", ""),
+		EncryptionActiveKey: GetEnv("DEPOT_ENCRYPTION_ACTIVE_KEY", ""),
+		EncryptionRequired:  GetEnv("DEPOT_ENCRYPTION_REQUIRED", "false") == "true",
+
+		EncryptionProvider: GetEnv("DEPOT_ENCRYPTION_PROVIDER", ""),
+		KMSKeyID:           GetEnv("DEPOT_KMS_KEY_ID", ""),
+		KMSRegion:          GetEnv("DEPOT_KMS_REGION", ""),
+		VaultAddress:       GetEnv("VAULT_ADDR", "http://127.0.0.1:8200"),
+		VaultToken:         GetEnv("VAULT_TOKEN", ""),
+		VaultTransitMount:  GetEnv("DEPOT_VAULT_TRANSIT_MOUNT", "transit"),
+		VaultTransitKey:    GetEnv("DEPOT_VAULT_TRANSIT_KEY", ""),
+
+		ForwardTargetsFile: GetEnv("DEPOT_FORWARD_TARGETS_FILE", ""),
+		RoutingRulesFile:   GetEnv("DEPOT_ROUTING_RULES_FILE", ""),
+		RedactionRulesFile: GetEnv("DEPOT_REDACTION_RULES_FILE", ""),
+		DetectSensitive:    GetEnvList("DEPOT_DETECT_SENSITIVE"),
+		DetectNotify:       GetEnvList("DEPOT_DETECT_NOTIFY"),
+
+		ExecHook:            GetEnv("DEPOT_EXEC_HOOK", ""),
+		ExecHookTimeout:     GetEnvDuration("DEPOT_EXEC_HOOK_TIMEOUT", 30*time.Second),
+		ExecHookConcurrency: GetEnvInt64("DEPOT_EXEC_HOOK_CONCURRENCY", 4),
+		ExecHookMaxAttempts: GetEnvInt64("DEPOT_EXEC_HOOK_MAX_ATTEMPTS", 1),
+
+		PolicyPath:    GetEnv("DEPOT_POLICY_PATH", ""),
+		PolicyTimeout: GetEnvDuration("DEPOT_POLICY_TIMEOUT", 100*time.Millisecond),
+
+		ScriptsDir:         GetEnv("DEPOT_SCRIPTS_DIR", ""),
+		ScriptTimeout:      GetEnvDuration("DEPOT_SCRIPT_TIMEOUT", 500*time.Millisecond),
+		ScriptMaxBytes:     GetEnvInt64("DEPOT_SCRIPT_MAX_BYTES", 1<<20),
+		ScriptPoolSize:     GetEnvInt64("DEPOT_SCRIPT_POOL_SIZE", 4),
+		ScriptAllowedHosts: GetEnvList("DEPOT_SCRIPT_ALLOWED_HOSTS"),
+
+		ChunkSize: GetEnvInt64("DEPOT_CHUNK_SIZE", 0),
+		Dedup:     GetEnv("DEPOT_DEDUP", "false") == "true",
+
+		Compression:        GetEnv("DEPOT_COMPRESSION", ""),
+		CompressionMinSize: GetEnvInt64("DEPOT_COMPRESSION_MIN_SIZE", 1024),
+		CompressionTypes:   GetEnvList("DEPOT_COMPRESSION_TYPES"),
+
+		UploadStallAfter:        GetEnvDuration("DEPOT_UPLOAD_STALL_AFTER", 30*time.Second),
+		UploadProgressRetention: GetEnvDuration("DEPOT_UPLOAD_PROGRESS_RETENTION", 10*time.Minute),
+		UploadSessionTimeout:    GetEnvDuration("DEPOT_UPLOAD_SESSION_TIMEOUT", time.Hour),
+		StoreStatusRetention:    GetEnvDuration("DEPOT_STORE_STATUS_RETENTION", time.Hour),
+
+		ListCacheTTL:      GetEnvDuration("DEPOT_LIST_CACHE_TTL", 5*time.Second),
+		GetMaxInlineBytes: GetEnvInt64("DEPOT_GET_MAX_INLINE_BYTES", 32<<20),
+		ExportMaxRows:     GetEnvInt64("DEPOT_EXPORT_MAX_ROWS", 100000),
+		ExportMaxBytes:    GetEnvInt64("DEPOT_EXPORT_MAX_BYTES", 256<<20),
+		MaxBodySize:       GetEnvInt64("DEPOT_MAX_BODY_SIZE", 0),
+		SyncStore:         GetEnv("DEPOT_SYNC_STORE", "false") == "true",
+		SaveWorkers:       GetEnvInt64("DEPOT_SAVE_WORKERS", 16),
+		SaveQueueSize:     GetEnvInt64("DEPOT_SAVE_QUEUE_SIZE", 1000),
+		SaveQueueWait:     GetEnvDuration("DEPOT_SAVE_QUEUE_WAIT", 2*time.Second),
+		StreamThreshold:   GetEnvInt64("DEPOT_STREAM_THRESHOLD", 8<<20),
+
+		WriteAheadDir:            GetEnv("DEPOT_WRITE_AHEAD_DIR", ""),
+		WriteAheadInitialBackoff: GetEnvDuration("DEPOT_WRITE_AHEAD_INITIAL_BACKOFF", time.Second),
+		WriteAheadMaxBackoff:     GetEnvDuration("DEPOT_WRITE_AHEAD_MAX_BACKOFF", 5*time.Minute),
+
+		KeepContentEncoding: GetEnv("DEPOT_KEEP_CONTENT_ENCODING", "false") == "true",
+		ShutdownTimeout:     GetEnvDuration("DEPOT_SHUTDOWN_TIMEOUT", 30*time.Second),
+		TLSCert:             GetEnv("DEPOT_TLS_CERT", ""),
+		TLSKey:              GetEnv("DEPOT_TLS_KEY", ""),
+		TLSSelfSigned:       GetEnv("DEPOT_TLS_SELF_SIGNED", "false") == "true",
+		TLSHosts:            GetEnvList("DEPOT_TLS_HOSTS"),
+		ReadHeaderTimeout:   GetEnvDuration("DEPOT_READ_HEADER_TIMEOUT", 10*time.Second),
+		ReadTimeout:         GetEnvDuration("DEPOT_READ_TIMEOUT", 0),
+		WriteTimeout:        GetEnvDuration("DEPOT_WRITE_TIMEOUT", 0),
+		IdleTimeout:         GetEnvDuration("DEPOT_IDLE_TIMEOUT", 2*time.Minute),
+		StorageTimeout:      GetEnvDuration("DEPOT_STORAGE_TIMEOUT", 30*time.Second),
+
+		ReadOnly:           GetEnv("DEPOT_READ_ONLY", "false") == "true",
+		MaintenanceMessage: GetEnv("DEPOT_MAINTENANCE_MESSAGE", ""),
+
+		LogFormat: GetEnv("DEPOT_LOG_FORMAT", "text"),
+		LogLevel:  GetEnv("DEPOT_LOG_LEVEL", "info"),
+
+		Tracing:          GetEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "") != "" || GetEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "") != "",
+		TraceSampleRatio: GetEnvFloat("DEPOT_TRACE_SAMPLE_RATIO", 1),
+
+		ChaosMode:            GetEnv("DEPOT_CHAOS_MODE", "false") == "true",
+		ChaosLatency:         GetEnvDuration("DEPOT_CHAOS_LATENCY", 0),
+		ChaosJitter:          GetEnvDuration("DEPOT_CHAOS_JITTER", 0),
+		ChaosSaveFailureRate: GetEnvFloat("DEPOT_CHAOS_SAVE_FAILURE_RATE", 0),
+		ChaosReadFailureRate: GetEnvFloat("DEPOT_CHAOS_READ_FAILURE_RATE", 0),
+		ChaosOutageEvery:     GetEnvDuration("DEPOT_CHAOS_OUTAGE_EVERY", 0),
+		ChaosOutageFor:       GetEnvDuration("DEPOT_CHAOS_OUTAGE_FOR", 0),
+
+		MetadataStore: GetEnv("DEPOT_METADATA_STORE", "memory"),
+		PostgresURL:   GetEnv("DEPOT_POSTGRES_URL", ""),
+		SQLitePath:    GetEnv("DEPOT_SQLITE_PATH", "depot.db"),
+
+		SelfTestTimeout: GetEnvDuration("DEPOT_SELFTEST_TIMEOUT", 10*time.Second),
+
+		ShedMaxInFlight:   GetEnvInt64("DEPOT_SHED_MAX_INFLIGHT", 0),
+		ShedTargetLatency: GetEnvDuration("DEPOT_SHED_TARGET_LATENCY", 0),
+		RoutePriorities:   GetEnvIntMap("DEPOT_ROUTE_PRIORITIES"),
+
+		CORSOrigins:     GetEnvList("DEPOT_CORS_ORIGINS"),
+		CORSMethods:     GetEnvList("DEPOT_CORS_METHODS"),
+		CORSHeaders:     GetEnvList("DEPOT_CORS_HEADERS"),
+		CORSCredentials: GetEnv("DEPOT_CORS_CREDENTIALS", "false") == "true",
+		CORSMaxAge:      GetEnvDuration("DEPOT_CORS_MAX_AGE", 10*time.Minute),
+
+		RateLimit:        GetEnvFloat("DEPOT_RATE_LIMIT", 0),
+		RateLimitBurst:   GetEnvInt64("DEPOT_RATE_LIMIT_BURST", 20),
+		RateLimitClients: GetEnvFloatMap("DEPOT_RATE_LIMIT_CLIENTS"),
+
+		NamespaceHeader:    GetEnv("DEPOT_NAMESPACE_HEADER", ""),
+		UsageFile:          GetEnv("DEPOT_USAGE_FILE", ""),
+		BucketTemplateFile: GetEnv("DEPOT_BUCKET_TEMPLATE_FILE", ""),
+
+		OIDCIssuer:       GetEnv("DEPOT_OIDC_ISSUER", ""),
+		OIDCJWKSURL:      GetEnv("DEPOT_OIDC_JWKS_URL", ""),
+		OIDCAudience:     GetEnv("DEPOT_OIDC_AUDIENCE", ""),
+		AuthPublicRoutes: GetEnvList("DEPOT_AUTH_PUBLIC_ROUTES"),
+		AuthRouteScopes:  GetEnvStringMap("DEPOT_AUTH_ROUTE_SCOPES"),
+
+		AdminKey:   GetEnv("DEPOT_ADMIN_KEY", ""),
+		AdminScope: GetEnv("DEPOT_ADMIN_SCOPE", "depot:admin"),
+
+		TenantHeader:  GetEnv("DEPOT_TENANT_HEADER", ""),
+		TenantAPIKeys: GetEnvCredentials("DEPOT_TENANT_API_KEYS"),
+		TenantBuckets: GetEnvStringMap("DEPOT_TENANT_BUCKETS"),
+
+		Middleware: GetEnvList("DEPOT_MIDDLEWARE"),
+		Pipeline:   GetEnvList("DEPOT_PIPELINE"),
+
+		StoredHeaders: GetEnvList("DEPOT_STORED_HEADERS"),
+
+		Jobs: map[string]JobConfig{
+			"retention": GetEnvJob("retention", "@hourly", false),
+			"gc":        GetEnvJob("gc", "0 3 * * *", false),
+			"scrub":     GetEnvJob("scrub", "0 4 * * 0", false),
+			"dedup":     GetEnvJob("dedup", "30 3 * * *", false),
+			"stats":     GetEnvJob("stats", "*/5 * * * *", true),
+			"backup":    GetEnvJob("backup", "0 2 * * *", false),
+			"usage":     GetEnvJob("usage", "*/5 * * * *", true),
+		},
+		RetentionMaxAge:    GetEnvDuration("DEPOT_RETENTION_MAX_AGE", 0),
+		RetentionClasses:   GetEnvDurationMap("DEPOT_RETENTION_CLASSES"),
+		RetentionLifecycle: GetEnv("DEPOT_RETENTION_LIFECYCLE", "false") == "true",
+		BackupDir:          GetEnv("DEPOT_BACKUP_DIR", "backups"),
+		BackupKeep:         GetEnvInt64("DEPOT_BACKUP_KEEP", 7),
+
+		SFTPAddr:           GetEnv("DEPOT_SFTP_ADDR", ""),
+		SFTPHostKey:        GetEnv("DEPOT_SFTP_HOST_KEY", ""),
+		SFTPUsers:          GetEnvCredentials("DEPOT_SFTP_USERS"),
+		SFTPAuthorizedKeys: GetEnv("DEPOT_SFTP_AUTHORIZED_KEYS", ""),
+		SFTPWritable:       GetEnv("DEPOT_SFTP_WRITABLE", "false") == "true",
+
+		FTPAddr:         GetEnv("DEPOT_FTP_ADDR", ""),
+		FTPUsers:        GetEnvCredentials("DEPOT_FTP_USERS"),
+		FTPWritable:     GetEnv("DEPOT_FTP_WRITABLE", "false") == "true",
+		FTPTLSCert:      GetEnv("DEPOT_FTP_TLS_CERT", ""),
+		FTPTLSKey:       GetEnv("DEPOT_FTP_TLS_KEY", ""),
+		FTPRequireTLS:   GetEnv("DEPOT_FTP_REQUIRE_TLS", "false") == "true",
+		FTPPublicHost:   GetEnv("DEPOT_FTP_PUBLIC_HOST", ""),
+		FTPPassivePorts: GetEnv("DEPOT_FTP_PASSIVE_PORTS", ""),
+
+		WebDAVAddr:     GetEnv("DEPOT_WEBDAV_ADDR", ""),
+		WebDAVUsers:    GetEnvCredentials("DEPOT_WEBDAV_USERS"),
+		WebDAVWritable: GetEnv("DEPOT_WEBDAV_WRITABLE", "false") == "true",
+
+		DepotFSRefresh: GetEnvDuration("DEPOT_DEPOTFS_REFRESH", time.Minute),
+
+		WatchDir:        GetEnv("DEPOT_WATCH_DIR", ""),
+		WatchArchiveDir: GetEnv("DEPOT_WATCH_ARCHIVE_DIR", ""),
+		WatchInterval:   GetEnvDuration("DEPOT_WATCH_INTERVAL", 5*time.Second),
+
+		IngestBucket:   GetEnv("DEPOT_INGEST_BUCKET", ""),
+		IngestMode:     GetEnv("DEPOT_INGEST_MODE", "notify"),
+		IngestInterval: GetEnvDuration("DEPOT_INGEST_INTERVAL", 30*time.Second),
+		IngestDelete:   GetEnv("DEPOT_INGEST_DELETE", "false") == "true",
+
+		KafkaBrokers:     GetEnvList("DEPOT_KAFKA_BROKERS"),
+		KafkaTopics:      GetEnvList("DEPOT_KAFKA_TOPICS"),
+		KafkaGroup:       GetEnv("DEPOT_KAFKA_GROUP", "simple-depot"),
+		KafkaStartOffset: GetEnv("DEPOT_KAFKA_START_OFFSET", "earliest"),
+		KafkaTLS:         GetEnv("DEPOT_KAFKA_TLS", "false") == "true",
+		KafkaUsername:    GetEnv("DEPOT_KAFKA_USERNAME", ""),
+		KafkaPassword:    GetEnv("DEPOT_KAFKA_PASSWORD", ""),
+
+		EventsPublisher:    GetEnv("DEPOT_EVENTS_PUBLISHER", ""),
+		EventsTopic:        GetEnv("DEPOT_EVENTS_TOPIC", "depot.payloads"),
+		EventsFormat:       GetEnv("DEPOT_EVENTS_FORMAT", "json"),
+		EventsBuffer:       GetEnvInt64("DEPOT_EVENTS_BUFFER", 1000),
+		EventsKafkaBrokers: GetEnvList("DEPOT_EVENTS_KAFKA_BROKERS"),
+		EventsNATSURL:      GetEnv("DEPOT_EVENTS_NATS_URL", "nats://localhost:4222"),
+
+		MQTTBrokers:  GetEnvList("DEPOT_MQTT_BROKERS"),
+		MQTTTopics:   GetEnvList("DEPOT_MQTT_TOPICS"),
+		MQTTQoS:      GetEnvInt64("DEPOT_MQTT_QOS", 1),
+		MQTTClientID: GetEnv("DEPOT_MQTT_CLIENT_ID", "simple-depot"),
+		MQTTUsername: GetEnv("DEPOT_MQTT_USERNAME", ""),
+		MQTTPassword: GetEnv("DEPOT_MQTT_PASSWORD", ""),
+
+		GitHubWebhookSecret: GetEnv("DEPOT_GITHUB_WEBHOOK_SECRET", ""),
+		StripeWebhookSecret: GetEnv("DEPOT_STRIPE_WEBHOOK_SECRET", ""),
+		StripeTolerance:     GetEnvDuration("DEPOT_STRIPE_TOLERANCE", 5*time.Minute),
+		WebhookMaxBodySize:  GetEnvInt64("DEPOT_WEBHOOK_MAX_BODY_SIZE", 25<<20),
 	}
 }
 
@@ -61,3 +749,135 @@ func GetEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// GetEnvInt64 reads an integer variable, falling back to the default when unset or invalid
+func GetEnvInt64(key string, defaultValue int64) int64 {
+	value, err := strconv.ParseInt(GetEnv(key, ""), 10, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// GetEnvFloat reads a decimal variable such as "0.25", falling back to the default when unset or invalid
+func GetEnvFloat(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(GetEnv(key, ""), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// GetEnvDuration reads a Go duration variable such as "30s", falling back to the default when unset or invalid
+func GetEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(GetEnv(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// GetEnvList reads a comma-separated variable, skipping empty entries
+func GetEnvList(key string) []string {
+	var result []string
+	for _, entry := range strings.Split(GetEnv(key, ""), ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// GetEnvIntMap reads a "key=int,key=int" variable, skipping malformed entries
+func GetEnvIntMap(key string) map[string]int {
+	result := make(map[string]int)
+	for _, entry := range strings.Split(GetEnv(key, ""), ",") {
+		name, raw, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		value, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			continue
+		}
+		result[strings.TrimSpace(name)] = value
+	}
+	return result
+}
+
+// GetEnvFloatMap reads a "key=decimal,key=decimal" variable, skipping malformed entries
+func GetEnvFloatMap(key string) map[string]float64 {
+	result := make(map[string]float64)
+	for name, raw := range GetEnvStringMap(key) {
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			continue
+		}
+		result[name] = value
+	}
+	return result
+}
+
+// GetEnvStringMap reads a "key=value,key=value" variable, skipping malformed entries
+func GetEnvStringMap(key string) map[string]string {
+	result := make(map[string]string)
+	for _, entry := range GetEnvList(key) {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			continue
+		}
+		result[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return result
+}
+
+// GetEnvDurationMap reads a "key=duration,key=duration" variable, where durations are
+// Go durations or whole days such as "7d", skipping malformed entries
+func GetEnvDurationMap(key string) map[string]time.Duration {
+	result := make(map[string]time.Duration)
+	for _, entry := range GetEnvList(key) {
+		name, raw, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+		raw = strings.TrimSpace(raw)
+		value, err := time.ParseDuration(raw)
+		if days, isDays := strings.CutSuffix(raw, "d"); isDays {
+			var n int64
+			n, err = strconv.ParseInt(days, 10, 64)
+			value = time.Duration(n) * 24 * time.Hour
+		}
+		if err != nil || value < 0 {
+			continue
+		}
+		result[strings.TrimSpace(name)] = value
+	}
+	return result
+}
+
+// GetEnvCredentials reads a "user:password,user:password" variable; passwords may
+// contain colons but not commas
+func GetEnvCredentials(key string) map[string]string {
+	result := make(map[string]string)
+	for _, entry := range GetEnvList(key) {
+		user, password, ok := strings.Cut(entry, ":")
+		if !ok || user == "" {
+			continue
+		}
+		result[user] = password
+	}
+	return result
+}
+
+// GetEnvJob reads a job's DEPOT_JOB_<NAME>_SCHEDULE and DEPOT_JOB_<NAME>_ENABLED variables
+func GetEnvJob(name, defaultSchedule string, defaultEnabled bool) JobConfig {
+	prefix := "DEPOT_JOB_" + strings.ToUpper(name) + "_"
+	enabled := defaultEnabled
+	if value, err := strconv.ParseBool(GetEnv(prefix+"ENABLED", "")); err == nil {
+		enabled = value
+	}
+	return JobConfig{
+		Schedule: GetEnv(prefix+"SCHEDULE", defaultSchedule),
+		Enabled:  enabled,
+	}
+}
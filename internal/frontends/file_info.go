@@ -0,0 +1,26 @@
+package frontends
+
+import (
+	"io/fs"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// fileInfo adapts a DepotFileInfo to os.FileInfo
+type fileInfo struct {
+	entry services.DepotFileInfo
+}
+
+func (i fileInfo) Name() string       { return i.entry.Name }
+func (i fileInfo) Size() int64        { return i.entry.Size }
+func (i fileInfo) ModTime() time.Time { return i.entry.ModTime }
+func (i fileInfo) IsDir() bool        { return i.entry.IsDir }
+func (i fileInfo) Sys() any           { return nil }
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.entry.IsDir {
+		return fs.ModeDir | 0o755
+	}
+	return 0o644
+}
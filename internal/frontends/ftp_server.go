@@ -0,0 +1,489 @@
+package frontends
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math/rand/v2"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// ftpDataTimeout bounds how long a passive data connection is awaited
+const ftpDataTimeout = 30 * time.Second
+
+// FTPServer exposes a DepotFS to FTP clients, with explicit FTPS (AUTH TLS) when a TLS
+// configuration is set. Only passive data connections are supported.
+type FTPServer struct {
+	fsys  *services.DepotFS
+	users map[string]string
+
+	tlsConfig  *tls.Config
+	requireTLS bool
+
+	publicHost string
+	minPort    int
+	maxPort    int
+
+	mu       sync.Mutex
+	listener net.Listener
+}
+
+// NewFTPServer creates an FTP server for fsys. users maps user names to passwords.
+func NewFTPServer(fsys *services.DepotFS, users map[string]string) *FTPServer {
+	return &FTPServer{fsys: fsys, users: users}
+}
+
+// SetTLS enables AUTH TLS with config. When require is set, users must upgrade the
+// control connection before logging in and protect their data connections.
+func (s *FTPServer) SetTLS(config *tls.Config, require bool) {
+	s.tlsConfig = config
+	s.requireTLS = require
+}
+
+// SetPassive sets the address advertised to clients in PASV replies, for servers
+// behind NAT, and the port range data connections listen on. An empty host advertises
+// the address the client connected to, and a zero range uses any free port.
+func (s *FTPServer) SetPassive(publicHost string, minPort, maxPort int) {
+	s.publicHost = publicHost
+	s.minPort = minPort
+	s.maxPort = maxPort
+}
+
+// ListenAndServe accepts FTP connections on addr until Close is called
+func (s *FTPServer) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts FTP connections on listener until Close is called
+func (s *FTPServer) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		session := &ftpSession{server: s, cwd: "/"}
+		session.setConn(conn)
+		go session.serve()
+	}
+}
+
+// Close stops accepting connections; sessions in progress run to completion
+func (s *FTPServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// listenPassive opens a data listener within the configured port range
+func (s *FTPServer) listenPassive(host string) (net.Listener, error) {
+	if s.minPort == 0 {
+		return net.Listen("tcp", net.JoinHostPort(host, "0"))
+	}
+	count := s.maxPort - s.minPort + 1
+	start := rand.IntN(count)
+	for i := range count {
+		port := s.minPort + (start+i)%count
+		listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err == nil {
+			return listener, nil
+		}
+	}
+	return nil, fmt.Errorf("no free passive port in %d-%d", s.minPort, s.maxPort)
+}
+
+// ftpSession is the state of one control connection
+type ftpSession struct {
+	server *FTPServer
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+
+	user        string
+	loggedIn    bool
+	secure      bool
+	protectData bool
+	cwd         string
+	passive     net.Listener
+}
+
+func (c *ftpSession) setConn(conn net.Conn) {
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+	c.writer = bufio.NewWriter(conn)
+}
+
+func (c *ftpSession) reply(code int, format string, args ...any) {
+	fmt.Fprintf(c.writer, "%d %s\r\n", code, fmt.Sprintf(format, args...))
+	c.writer.Flush()
+}
+
+func (c *ftpSession) serve() {
+	defer c.conn.Close()
+	defer c.closePassive()
+	c.reply(220, "simple-depot FTP ready")
+
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		command = strings.ToUpper(command)
+		if !c.loggedIn && !ftpPreLoginCommands[command] {
+			c.reply(530, "Please log in with USER and PASS")
+			continue
+		}
+		if command == "QUIT" {
+			c.reply(221, "Goodbye")
+			return
+		}
+		c.handle(command, arg)
+	}
+}
+
+// ftpPreLoginCommands may be sent before logging in
+var ftpPreLoginCommands = map[string]bool{
+	"USER": true, "PASS": true, "AUTH": true, "PBSZ": true, "PROT": true,
+	"FEAT": true, "SYST": true, "OPTS": true, "NOOP": true, "QUIT": true,
+}
+
+func (c *ftpSession) handle(command, arg string) {
+	switch command {
+	case "USER":
+		if c.server.requireTLS && !c.secure {
+			c.reply(530, "Use AUTH TLS before logging in")
+			return
+		}
+		c.user, c.loggedIn = arg, false
+		c.reply(331, "Password required for %s", arg)
+	case "PASS":
+		expected, ok := c.server.users[c.user]
+		if c.user == "" || !ok || subtle.ConstantTimeCompare([]byte(expected), []byte(arg)) != 1 {
+			log.Printf("FTP login for %q from %s failed", c.user, c.conn.RemoteAddr())
+			c.reply(530, "Login incorrect")
+			return
+		}
+		c.loggedIn = true
+		c.reply(230, "Logged in")
+	case "AUTH":
+		c.upgradeTLS(arg)
+	case "PBSZ":
+		c.reply(200, "PBSZ=0")
+	case "PROT":
+		switch strings.ToUpper(arg) {
+		case "P":
+			if !c.secure {
+				c.reply(503, "Use AUTH TLS first")
+				return
+			}
+			c.protectData = true
+		case "C":
+			if c.server.requireTLS {
+				c.reply(534, "Data connections must be protected")
+				return
+			}
+			c.protectData = false
+		default:
+			c.reply(504, "Unsupported protection level")
+			return
+		}
+		c.reply(200, "Protection level set")
+	case "FEAT":
+		features := []string{"UTF8", "PASV", "EPSV", "SIZE", "MDTM"}
+		if c.server.tlsConfig != nil {
+			features = append(features, "AUTH TLS", "PBSZ", "PROT")
+		}
+		fmt.Fprintf(c.writer, "211-Features:\r\n")
+		for _, feature := range features {
+			fmt.Fprintf(c.writer, " %s\r\n", feature)
+		}
+		c.reply(211, "End")
+	case "SYST":
+		c.reply(215, "UNIX Type: L8")
+	case "OPTS", "NOOP", "MODE", "STRU":
+		c.reply(200, "OK")
+	case "TYPE":
+		// Payloads are always sent as stored
+		c.reply(200, "Type set to %s", arg)
+	case "PWD", "XPWD":
+		c.reply(257, "%q is the current directory", c.cwd)
+	case "CWD", "CDUP":
+		if command == "CDUP" {
+			arg = ".."
+		}
+		dir := c.resolve(arg)
+		if info, err := c.server.fsys.Stat(dir); err != nil || !info.IsDir {
+			c.reply(550, "%s: no such directory", dir)
+			return
+		}
+		c.cwd = dir
+		c.reply(250, "Directory changed to %s", dir)
+	case "PASV", "EPSV":
+		c.openPassive(command)
+	case "PORT", "EPRT":
+		c.reply(502, "Active mode is not supported; use passive mode")
+	case "LIST", "NLST":
+		c.list(command, arg)
+	case "RETR":
+		c.retrieve(c.resolve(arg))
+	case "STOR":
+		c.store(c.resolve(arg))
+	case "DELE":
+		name := c.resolve(arg)
+		if err := c.server.fsys.Remove(name); err != nil {
+			c.reply(550, "%v", err)
+			return
+		}
+		log.Printf("FTP user %s removed %s", c.user, name)
+		c.reply(250, "Deleted %s", name)
+	case "MKD", "XMKD":
+		// Directories exist once a file is written in them
+		if !c.server.fsys.Writable() {
+			c.reply(550, "Read-only")
+			return
+		}
+		c.reply(257, "%q created", c.resolve(arg))
+	case "SIZE", "MDTM":
+		info, err := c.server.fsys.Stat(c.resolve(arg))
+		if err != nil || info.IsDir {
+			c.reply(550, "%s: no such file", c.resolve(arg))
+			return
+		}
+		if command == "SIZE" {
+			c.reply(213, "%d", info.Size)
+		} else {
+			c.reply(213, "%s", info.ModTime.UTC().Format("20060102150405"))
+		}
+	case "RMD", "XRMD", "RNFR", "RNTO", "APPE", "SITE":
+		c.reply(550, "Not permitted")
+	default:
+		c.reply(502, "%s not implemented", command)
+	}
+}
+
+// resolve makes arg an absolute depot path relative to the working directory
+func (c *ftpSession) resolve(arg string) string {
+	if !strings.HasPrefix(arg, "/") {
+		arg = path.Join(c.cwd, arg)
+	}
+	return path.Clean("/" + arg)
+}
+
+func (c *ftpSession) upgradeTLS(mechanism string) {
+	if c.server.tlsConfig == nil {
+		c.reply(502, "TLS is not configured")
+		return
+	}
+	if mechanism = strings.ToUpper(mechanism); mechanism != "TLS" && mechanism != "SSL" && mechanism != "TLS-C" {
+		c.reply(504, "Unsupported mechanism %s", mechanism)
+		return
+	}
+	if c.secure {
+		c.reply(503, "Already using TLS")
+		return
+	}
+	c.reply(234, "Proceed with TLS negotiation")
+	conn := tls.Server(c.conn, c.server.tlsConfig)
+	if err := conn.Handshake(); err != nil {
+		log.Printf("FTP TLS handshake with %s failed: %v", c.conn.RemoteAddr(), err)
+		c.conn.Close()
+		return
+	}
+	c.setConn(conn)
+	c.secure = true
+}
+
+func (c *ftpSession) closePassive() {
+	if c.passive != nil {
+		c.passive.Close()
+		c.passive = nil
+	}
+}
+
+func (c *ftpSession) openPassive(command string) {
+	c.closePassive()
+	localHost, _, _ := net.SplitHostPort(c.conn.LocalAddr().String())
+	listener, err := c.server.listenPassive(localHost)
+	if err != nil {
+		log.Printf("FTP passive listener failed: %v", err)
+		c.reply(425, "Cannot open data connection")
+		return
+	}
+	c.passive = listener
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	if command == "EPSV" {
+		c.reply(229, "Entering Extended Passive Mode (|||%d|)", port)
+		return
+	}
+	host := c.server.publicHost
+	if host == "" {
+		host = localHost
+	}
+	ip := net.ParseIP(host).To4()
+	if ip == nil {
+		c.closePassive()
+		c.reply(425, "PASV needs an IPv4 address; use EPSV")
+		return
+	}
+	c.reply(227, "Entering Passive Mode (%d,%d,%d,%d,%d,%d)", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xff)
+}
+
+// openData accepts the data connection for a transfer. Connections from another
+// address than the control connection's are refused.
+func (c *ftpSession) openData() (net.Conn, error) {
+	if c.passive == nil {
+		return nil, errors.New("use PASV or EPSV first")
+	}
+	if c.server.requireTLS && !c.protectData {
+		return nil, errors.New("data connections must be protected; use PROT P")
+	}
+	listener := c.passive
+	c.passive = nil
+	defer listener.Close()
+
+	if tcp, ok := listener.(*net.TCPListener); ok {
+		tcp.SetDeadline(time.Now().Add(ftpDataTimeout))
+	}
+	conn, err := listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	controlHost, _, _ := net.SplitHostPort(c.conn.RemoteAddr().String())
+	dataHost, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	if controlHost != dataHost {
+		conn.Close()
+		return nil, fmt.Errorf("data connection from %s does not match the client", dataHost)
+	}
+	if c.protectData {
+		return tls.Server(conn, c.server.tlsConfig), nil
+	}
+	return conn, nil
+}
+
+// transfer runs fn over a data connection, framing it with the 150 and 226 replies
+func (c *ftpSession) transfer(fn func(conn net.Conn) error) {
+	conn, err := c.openData()
+	if err != nil {
+		c.reply(425, "%v", err)
+		return
+	}
+	c.reply(150, "Opening data connection")
+	err = fn(conn)
+	if closeErr := conn.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		c.reply(550, "%v", err)
+		return
+	}
+	c.reply(226, "Transfer complete")
+}
+
+func (c *ftpSession) list(command, arg string) {
+	// Clients pass ls flags such as -la; they do not change the listing
+	var target string
+	for _, field := range strings.Fields(arg) {
+		if !strings.HasPrefix(field, "-") {
+			target = field
+		}
+	}
+	name := c.resolve(target)
+	info, err := c.server.fsys.Stat(name)
+	if err != nil {
+		c.reply(550, "%s: no such file or directory", name)
+		return
+	}
+	entries := []services.DepotFileInfo{info}
+	if info.IsDir {
+		if entries, err = c.server.fsys.ReadDir(name); err != nil {
+			c.reply(550, "%v", err)
+			return
+		}
+	}
+
+	c.transfer(func(conn net.Conn) error {
+		w := bufio.NewWriter(conn)
+		for _, entry := range entries {
+			if command == "NLST" {
+				fmt.Fprintf(w, "%s\r\n", entry.Name)
+			} else {
+				fmt.Fprintf(w, "%s\r\n", ftpListLine(entry))
+			}
+		}
+		return w.Flush()
+	})
+}
+
+// ftpListLine formats an entry like ls -l, which FTP clients parse
+func ftpListLine(entry services.DepotFileInfo) string {
+	mode := "-rw-r--r--"
+	if entry.IsDir {
+		mode = "drwxr-xr-x"
+	}
+	stamp := entry.ModTime.UTC().Format("Jan _2 15:04")
+	if time.Since(entry.ModTime) > 180*24*time.Hour {
+		stamp = entry.ModTime.UTC().Format("Jan _2  2006")
+	}
+	return fmt.Sprintf("%s 1 depot depot %12d %s %s", mode, entry.Size, stamp, entry.Name)
+}
+
+func (c *ftpSession) retrieve(name string) {
+	data, err := c.server.fsys.ReadFile(name)
+	if err != nil {
+		c.reply(550, "%v", err)
+		return
+	}
+	c.transfer(func(conn net.Conn) error {
+		_, err := conn.Write(data)
+		return err
+	})
+}
+
+func (c *ftpSession) store(name string) {
+	if err := c.server.fsys.CheckWrite(name); err != nil {
+		c.reply(550, "%v", err)
+		return
+	}
+	c.transfer(func(conn net.Conn) error {
+		data, err := io.ReadAll(conn)
+		if err != nil {
+			return err
+		}
+		if err := c.server.fsys.WriteFile(name, data); err != nil {
+			log.Printf("FTP upload of %s by %s failed: %v", name, c.user, err)
+			if errors.Is(err, fs.ErrPermission) {
+				return err
+			}
+			return errors.New("upload failed")
+		}
+		log.Printf("FTP user %s uploaded %s (%d bytes)", c.user, name, len(data))
+		return nil
+	})
+}
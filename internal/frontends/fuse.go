@@ -0,0 +1,156 @@
+//go:build linux || darwin
+
+package frontends
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"path"
+	"syscall"
+	"time"
+
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// fuseCacheTimeout is how long the kernel caches entries and attributes, so new
+// uploads show up shortly after they are indexed
+const fuseCacheTimeout = time.Second
+
+// FUSEMount is a DepotFS mounted read-only through FUSE
+type FUSEMount struct {
+	server *fuse.Server
+}
+
+// MountFUSE mounts fsys read-only at mountpoint. It needs FUSE (fusermount on Linux,
+// macFUSE on macOS), or root privileges to mount directly.
+func MountFUSE(fsys *services.DepotFS, mountpoint string) (*FUSEMount, error) {
+	timeout := fuseCacheTimeout
+	root := &fuseNode{fsys: fsys, path: "/"}
+	server, err := fusefs.Mount(mountpoint, root, &fusefs.Options{
+		EntryTimeout: &timeout,
+		AttrTimeout:  &timeout,
+		MountOptions: fuse.MountOptions{
+			FsName:      "simple-depot",
+			Name:        "depotfs",
+			Options:     []string{"ro"},
+			DirectMount: true,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &FUSEMount{server: server}, nil
+}
+
+// Wait blocks until the filesystem is unmounted
+func (m *FUSEMount) Wait() {
+	m.server.Wait()
+}
+
+// Unmount detaches the filesystem
+func (m *FUSEMount) Unmount() error {
+	return m.server.Unmount()
+}
+
+// fuseNode is a directory or file of the DepotFS
+type fuseNode struct {
+	fusefs.Inode
+	fsys *services.DepotFS
+	path string
+}
+
+var (
+	_ fusefs.NodeLookuper  = (*fuseNode)(nil)
+	_ fusefs.NodeReaddirer = (*fuseNode)(nil)
+	_ fusefs.NodeGetattrer = (*fuseNode)(nil)
+	_ fusefs.NodeOpener    = (*fuseNode)(nil)
+)
+
+// fuseErrno maps DepotFS errors to the errno a shell tool expects
+func fuseErrno(err error) syscall.Errno {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return syscall.ENOENT
+	case errors.Is(err, fs.ErrPermission):
+		return syscall.EACCES
+	case errors.Is(err, fs.ErrInvalid):
+		return syscall.EISDIR
+	}
+	log.Printf("depotfs: %v", err)
+	return syscall.EIO
+}
+
+func fuseMode(entry services.DepotFileInfo) uint32 {
+	if entry.IsDir {
+		return fuse.S_IFDIR | 0o555
+	}
+	return fuse.S_IFREG | 0o444
+}
+
+func fillAttr(entry services.DepotFileInfo, attr *fuse.Attr) {
+	attr.Mode = fuseMode(entry)
+	attr.Size = uint64(entry.Size)
+	attr.SetTimes(nil, &entry.ModTime, &entry.ModTime)
+}
+
+func (n *fuseNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fusefs.Inode, syscall.Errno) {
+	childPath := path.Join(n.path, name)
+	entry, err := n.fsys.Stat(childPath)
+	if err != nil {
+		return nil, fuseErrno(err)
+	}
+	fillAttr(entry, &out.Attr)
+	child := &fuseNode{fsys: n.fsys, path: childPath}
+	return n.NewInode(ctx, child, fusefs.StableAttr{Mode: fuseMode(entry) & syscall.S_IFMT}), 0
+}
+
+func (n *fuseNode) Readdir(ctx context.Context) (fusefs.DirStream, syscall.Errno) {
+	entries, err := n.fsys.ReadDir(n.path)
+	if err != nil {
+		return nil, fuseErrno(err)
+	}
+	dirEntries := make([]fuse.DirEntry, len(entries))
+	for i, entry := range entries {
+		dirEntries[i] = fuse.DirEntry{Name: entry.Name, Mode: fuseMode(entry)}
+	}
+	return fusefs.NewListDirStream(dirEntries), 0
+}
+
+func (n *fuseNode) Getattr(ctx context.Context, f fusefs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	entry, err := n.fsys.Stat(n.path)
+	if err != nil {
+		return fuseErrno(err)
+	}
+	fillAttr(entry, &out.Attr)
+	return 0
+}
+
+// Open reads the whole payload, which the kernel may then cache until it changes
+func (n *fuseNode) Open(ctx context.Context, flags uint32) (fusefs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR|syscall.O_TRUNC) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	data, err := n.fsys.ReadFile(n.path)
+	if err != nil {
+		return nil, 0, fuseErrno(err)
+	}
+	return fuseHandle(data), fuse.FOPEN_KEEP_CACHE, 0
+}
+
+// fuseHandle serves reads of an opened payload
+type fuseHandle []byte
+
+var _ fusefs.FileReader = fuseHandle(nil)
+
+func (h fuseHandle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	if off >= int64(len(h)) {
+		return fuse.ReadResultData(nil), 0
+	}
+	end := min(off+int64(len(dest)), int64(len(h)))
+	return fuse.ReadResultData(h[off:end]), 0
+}
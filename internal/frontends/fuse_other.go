@@ -0,0 +1,25 @@
+//go:build !linux && !darwin
+
+package frontends
+
+import (
+	"errors"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// FUSEMount is a DepotFS mounted read-only through FUSE
+type FUSEMount struct{}
+
+// MountFUSE is only available on Linux and macOS
+func MountFUSE(fsys *services.DepotFS, mountpoint string) (*FUSEMount, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// Wait blocks until the filesystem is unmounted
+func (m *FUSEMount) Wait() {}
+
+// Unmount detaches the filesystem
+func (m *FUSEMount) Unmount() error {
+	return errors.ErrUnsupported
+}
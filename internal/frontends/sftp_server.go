@@ -0,0 +1,318 @@
+// Package frontends serves the depot over protocols other than its HTTP API
+package frontends
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// SFTPServer exposes a DepotFS to SFTP clients. Users log in with a password or with
+// any key in the authorized keys; every user sees the same tree.
+type SFTPServer struct {
+	fsys   *services.DepotFS
+	config *ssh.ServerConfig
+
+	mu       sync.Mutex
+	listener net.Listener
+}
+
+// NewSFTPServer creates an SFTP server for fsys. users maps user names to passwords,
+// and authorizedKeys holds the public keys allowed to log in as any user.
+func NewSFTPServer(fsys *services.DepotFS, hostKey ssh.Signer, users map[string]string, authorizedKeys []ssh.PublicKey) *SFTPServer {
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			expected, ok := users[conn.User()]
+			if ok && subtle.ConstantTimeCompare([]byte(expected), password) == 1 {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("invalid password for %s", conn.User())
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			for _, authorized := range authorizedKeys {
+				if bytes.Equal(authorized.Marshal(), key.Marshal()) {
+					return nil, nil
+				}
+			}
+			return nil, fmt.Errorf("unknown public key for %s", conn.User())
+		},
+	}
+	config.AddHostKey(hostKey)
+	return &SFTPServer{fsys: fsys, config: config}
+}
+
+// ListenAndServe accepts SFTP connections on addr until Close is called
+func (s *SFTPServer) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts SFTP connections on listener until Close is called
+func (s *SFTPServer) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go s.handleConn(conn)
+	}
+}
+
+// Close stops accepting connections; sessions in progress run to completion
+func (s *SFTPServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *SFTPServer) handleConn(conn net.Conn) {
+	defer conn.Close()
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		log.Printf("SFTP handshake from %s failed: %v", conn.RemoteAddr(), err)
+		return
+	}
+	defer serverConn.Close()
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			log.Printf("SFTP session for %s failed: %v", serverConn.User(), err)
+			continue
+		}
+		go s.handleSession(serverConn.User(), channel, channelRequests)
+	}
+}
+
+// handleSession serves the sftp subsystem and refuses shells and commands
+func (s *SFTPServer) handleSession(user string, channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for request := range requests {
+		isSFTP := request.Type == "subsystem" && len(request.Payload) > 4 && string(request.Payload[4:]) == "sftp"
+		request.Reply(isSFTP, nil)
+		if !isSFTP {
+			continue
+		}
+
+		handler := &sftpHandler{fsys: s.fsys, user: user}
+		server := sftp.NewRequestServer(channel, sftp.Handlers{
+			FileGet:  handler,
+			FilePut:  handler,
+			FileCmd:  handler,
+			FileList: handler,
+		})
+		if err := server.Serve(); err != nil && !errors.Is(err, io.EOF) {
+			log.Printf("SFTP session for %s ended: %v", user, err)
+		}
+		server.Close()
+		return
+	}
+}
+
+// sftpHandler maps SFTP requests onto the DepotFS
+type sftpHandler struct {
+	fsys *services.DepotFS
+	user string
+}
+
+// sftpStatus maps DepotFS errors to SFTP status codes; pkg/sftp does not unwrap them
+func sftpStatus(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("%w: %v", sftp.ErrSSHFxNoSuchFile, err)
+	case errors.Is(err, fs.ErrPermission):
+		return fmt.Errorf("%w: %v", sftp.ErrSSHFxPermissionDenied, err)
+	}
+	return err
+}
+
+func (h *sftpHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	data, err := h.fsys.ReadFile(r.Filepath)
+	if err != nil {
+		return nil, sftpStatus(err)
+	}
+	return bytes.NewReader(data), nil
+}
+
+func (h *sftpHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	if err := h.fsys.CheckWrite(r.Filepath); err != nil {
+		return nil, sftpStatus(err)
+	}
+	return &sftpUpload{fsys: h.fsys, path: r.Filepath, user: h.user}, nil
+}
+
+func (h *sftpHandler) Filecmd(r *sftp.Request) error {
+	switch r.Method {
+	case "Setstat":
+		// Clients set times and modes after uploads; the depot keeps its own
+		return nil
+	case "Mkdir":
+		// Directories exist once a file is written in them
+		if !h.fsys.Writable() {
+			return sftp.ErrSSHFxPermissionDenied
+		}
+		return nil
+	case "Remove":
+		if err := h.fsys.Remove(r.Filepath); err != nil {
+			return sftpStatus(err)
+		}
+		log.Printf("SFTP user %s removed %s", h.user, r.Filepath)
+		return nil
+	case "Rename", "Rmdir", "Symlink", "Link":
+		return sftp.ErrSSHFxPermissionDenied
+	}
+	return sftp.ErrSSHFxOpUnsupported
+}
+
+func (h *sftpHandler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	switch r.Method {
+	case "List":
+		entries, err := h.fsys.ReadDir(r.Filepath)
+		if err != nil {
+			return nil, sftpStatus(err)
+		}
+		infos := make(sftpListing, len(entries))
+		for i, entry := range entries {
+			infos[i] = fileInfo{entry}
+		}
+		return infos, nil
+	case "Stat":
+		entry, err := h.fsys.Stat(r.Filepath)
+		if err != nil {
+			return nil, sftpStatus(err)
+		}
+		return sftpListing{fileInfo{entry}}, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+// sftpUpload buffers an uploaded file and stores it when the client closes it
+type sftpUpload struct {
+	fsys *services.DepotFS
+	path string
+	user string
+
+	mu   sync.Mutex
+	data []byte
+}
+
+func (u *sftpUpload) WriteAt(p []byte, offset int64) (int, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if end := offset + int64(len(p)); end > int64(len(u.data)) {
+		u.data = append(u.data, make([]byte, end-int64(len(u.data)))...)
+	}
+	copy(u.data[offset:], p)
+	return len(p), nil
+}
+
+func (u *sftpUpload) Close() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.fsys.WriteFile(u.path, u.data); err != nil {
+		log.Printf("SFTP upload of %s by %s failed: %v", u.path, u.user, err)
+		return sftpStatus(err)
+	}
+	log.Printf("SFTP user %s uploaded %s (%d bytes)", u.user, u.path, len(u.data))
+	return nil
+}
+
+type sftpListing []os.FileInfo
+
+func (l sftpListing) ListAt(dst []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(dst, l[offset:])
+	if offset+int64(n) == int64(len(l)) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// LoadHostKey reads a PEM-encoded SSH host key from path. When the file does not exist
+// an ed25519 key is generated and saved there, so clients see the same key after a
+// restart; with an empty path the generated key lasts until the process exits.
+func LoadHostKey(path string) (ssh.Signer, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			return ssh.ParsePrivateKey(data)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		block, err := ssh.MarshalPrivateKey(key, "simple-depot host key")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			return nil, fmt.Errorf("error saving host key: %v", err)
+		}
+	}
+	return signer, nil
+}
+
+// LoadAuthorizedKeys reads public keys in OpenSSH authorized_keys format
+func LoadAuthorizedKeys(path string) ([]ssh.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []ssh.PublicKey
+	for len(bytes.TrimSpace(data)) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %v", path, err)
+		}
+		keys = append(keys, key)
+		data = rest
+	}
+	return keys, nil
+}
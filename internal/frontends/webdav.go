@@ -0,0 +1,252 @@
+package frontends
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// webdavWriteMethods change the tree and are refused on a read-only depot
+var webdavWriteMethods = map[string]bool{
+	"PUT": true, "DELETE": true, "MKCOL": true, "COPY": true, "MOVE": true, "PROPPATCH": true,
+}
+
+// NewWebDAVHandler serves a DepotFS over WebDAV, so it can be mounted as a network
+// drive. Requests must carry HTTP basic credentials from users.
+func NewWebDAVHandler(fsys *services.DepotFS, users map[string]string) http.Handler {
+	dav := &webdav.Handler{
+		FileSystem: &webdavFS{fsys: fsys},
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				log.Printf("WebDAV %s %s failed: %v", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		expected, known := users[user]
+		if !ok || !known || subtle.ConstantTimeCompare([]byte(expected), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="simple-depot"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if webdavWriteMethods[r.Method] && !fsys.Writable() {
+			http.Error(w, "The depot is read-only", http.StatusForbidden)
+			return
+		}
+		dav.ServeHTTP(w, r)
+	})
+}
+
+// webdavFS adapts a DepotFS to webdav.FileSystem
+type webdavFS struct {
+	fsys *services.DepotFS
+}
+
+// webdavError returns DepotFS errors in the *fs.PathError form the webdav package
+// inspects with os.IsNotExist and os.IsPermission
+func webdavError(op, name string, err error) error {
+	for _, target := range []error{fs.ErrNotExist, fs.ErrPermission} {
+		if errors.Is(err, target) {
+			return &fs.PathError{Op: op, Path: name, Err: target}
+		}
+	}
+	return err
+}
+
+func (d *webdavFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	// Directories exist once a file is written in them
+	if !d.fsys.Writable() {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrPermission}
+	}
+	return nil
+}
+
+func (d *webdavFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) != 0 {
+		if err := d.fsys.CheckWrite(name); err != nil {
+			return nil, webdavError("open", name, err)
+		}
+		return &webdavUpload{fsys: d.fsys, name: name}, nil
+	}
+	info, err := d.fsys.Stat(name)
+	if err != nil {
+		return nil, webdavError("open", name, err)
+	}
+	return &webdavFile{fsys: d.fsys, path: name, info: info}, nil
+}
+
+func (d *webdavFS) RemoveAll(ctx context.Context, name string) error {
+	if err := d.fsys.Remove(name); err != nil {
+		return webdavError("remove", name, err)
+	}
+	log.Printf("WebDAV removed %s", name)
+	return nil
+}
+
+func (d *webdavFS) Rename(ctx context.Context, oldName, newName string) error {
+	return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrPermission}
+}
+
+func (d *webdavFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	info, err := d.fsys.Stat(name)
+	if err != nil {
+		return nil, webdavError("stat", name, err)
+	}
+	return webdavFileInfo{fileInfo{info}}, nil
+}
+
+// webdavFileInfo answers content types and ETags from the index, so listings do not
+// read every payload
+type webdavFileInfo struct {
+	fileInfo
+}
+
+func (i webdavFileInfo) ContentType(ctx context.Context) (string, error) {
+	if record := i.entry.Record; record != nil && record.ContentType != "" {
+		return record.ContentType, nil
+	}
+	if contentType := mime.TypeByExtension(path.Ext(i.entry.Name)); contentType != "" {
+		return contentType, nil
+	}
+	return "application/octet-stream", nil
+}
+
+func (i webdavFileInfo) ETag(ctx context.Context) (string, error) {
+	if record := i.entry.Record; record != nil && record.SHA256 != "" {
+		return fmt.Sprintf("%q", record.SHA256), nil
+	}
+	return "", webdav.ErrNotImplemented
+}
+
+// webdavFile is a directory or a stored payload opened for reading. A payload is
+// fetched from storage on its first read.
+type webdavFile struct {
+	fsys   *services.DepotFS
+	path   string
+	info   services.DepotFileInfo
+	reader *bytes.Reader
+	listed bool
+}
+
+func (f *webdavFile) load() error {
+	if f.reader != nil {
+		return nil
+	}
+	if f.info.IsDir {
+		return &fs.PathError{Op: "read", Path: f.path, Err: fs.ErrInvalid}
+	}
+	data, err := f.fsys.ReadFile(f.path)
+	if err != nil {
+		return webdavError("read", f.path, err)
+	}
+	f.reader = bytes.NewReader(data)
+	return nil
+}
+
+func (f *webdavFile) Read(p []byte) (int, error) {
+	if err := f.load(); err != nil {
+		return 0, err
+	}
+	return f.reader.Read(p)
+}
+
+func (f *webdavFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.load(); err != nil {
+		return 0, err
+	}
+	return f.reader.Seek(offset, whence)
+}
+
+func (f *webdavFile) Readdir(count int) ([]fs.FileInfo, error) {
+	if !f.info.IsDir {
+		return nil, &fs.PathError{Op: "readdir", Path: f.path, Err: fs.ErrInvalid}
+	}
+	if f.listed {
+		if count > 0 {
+			return nil, io.EOF
+		}
+		return nil, nil
+	}
+	f.listed = true
+	entries, err := f.fsys.ReadDir(f.path)
+	if err != nil {
+		return nil, webdavError("readdir", f.path, err)
+	}
+	infos := make([]fs.FileInfo, len(entries))
+	for i, entry := range entries {
+		infos[i] = webdavFileInfo{fileInfo{entry}}
+	}
+	return infos, nil
+}
+
+func (f *webdavFile) Stat() (fs.FileInfo, error) {
+	return webdavFileInfo{fileInfo{f.info}}, nil
+}
+
+func (f *webdavFile) Write(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.path, Err: fs.ErrPermission}
+}
+
+func (f *webdavFile) Close() error {
+	return nil
+}
+
+// webdavUpload buffers a PUT body and stores it when the handler closes the file
+type webdavUpload struct {
+	fsys *services.DepotFS
+	name string
+
+	mu   sync.Mutex
+	data bytes.Buffer
+}
+
+func (u *webdavUpload) Write(p []byte) (int, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.data.Write(p)
+}
+
+func (u *webdavUpload) Close() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.fsys.WriteFile(u.name, u.data.Bytes()); err != nil {
+		log.Printf("WebDAV upload of %s failed: %v", u.name, err)
+		return err
+	}
+	log.Printf("WebDAV uploaded %s (%d bytes)", u.name, u.data.Len())
+	return nil
+}
+
+func (u *webdavUpload) Stat() (fs.FileInfo, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return webdavFileInfo{fileInfo{services.DepotFileInfo{Name: path.Base(u.name), Size: int64(u.data.Len())}}}, nil
+}
+
+func (u *webdavUpload) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: u.name, Err: fs.ErrInvalid}
+}
+
+func (u *webdavUpload) Seek(offset int64, whence int) (int64, error) {
+	return 0, &fs.PathError{Op: "seek", Path: u.name, Err: fs.ErrInvalid}
+}
+
+func (u *webdavUpload) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: u.name, Err: fs.ErrInvalid}
+}
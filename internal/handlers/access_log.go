@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// AccessLog logs one line per request with its method, route, status and latency. It
+// gives each request a logger that later stages add to, such as the tenant stage, so
+// the request's own lines, those of its background saves and its access log line all
+// carry the same request_id and tenant.
+type AccessLog struct {
+	logger *slog.Logger
+}
+
+// NewAccessLog creates an access log writing to logger
+func NewAccessLog(logger *slog.Logger) *AccessLog {
+	return &AccessLog{logger: logger}
+}
+
+// Wrap logs the requests of route
+func (a *AccessLog) Wrap(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		attrs := []slog.Attr{slog.String("method", r.Method), slog.String("route", route)}
+		requestID := r.Header.Get("X-Depot-Request-Id")
+		if requestID == "" {
+			requestID = r.URL.Query().Get("request_id")
+		}
+		if requestID != "" {
+			attrs = append(attrs, slog.String("request_id", requestID))
+		}
+		ctx := services.ContextWithLogger(r.Context(), a.logger, attrs...)
+
+		recorder := &countingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		services.Logger(ctx).LogAttrs(ctx, level, "request",
+			slog.String("path", r.URL.Path),
+			slog.String("source_ip", sourceIP(r)),
+			slog.Int("status", recorder.status),
+			slog.Int64("bytes", recorder.n),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+		)
+	}
+}
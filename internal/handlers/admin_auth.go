@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+)
+
+// DefaultAdminKeyHeader carries the admin key of requests to the /admin/* routes
+const DefaultAdminKeyHeader = "X-Depot-Admin-Key"
+
+// DefaultAdminScope is the token scope that grants the /admin/* routes
+const DefaultAdminScope = "depot:admin"
+
+// AdminAuth restricts routes to admins: requests carrying the admin key, or a bearer
+// token with the admin scope. With neither configured, the routes are refused to
+// everyone, so an open depot cannot be reconfigured by its clients.
+type AdminAuth struct {
+	key   string
+	scope string
+}
+
+// NewAdminAuth creates the gate; an empty key or scope disables that way in
+func NewAdminAuth(key, scope string) *AdminAuth {
+	return &AdminAuth{key: key, scope: scope}
+}
+
+// Wrap returns next, refusing requests that are not an admin's with 403
+func (a *AdminAuth) Wrap(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.isAdmin(r) {
+			next(w, r)
+			return
+		}
+		message := "admin access requires the " + DefaultAdminKeyHeader + " header"
+		if a.scope != "" {
+			message += " or a bearer token with the " + a.scope + " scope"
+		}
+		if a.key == "" && a.scope == "" {
+			message = "admin routes are disabled; set DEPOT_ADMIN_KEY to enable them"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":   http.StatusText(http.StatusForbidden),
+			"message": message,
+		})
+	}
+}
+
+// isAdmin reports whether r carries the admin key or a token granted the admin scope
+func (a *AdminAuth) isAdmin(r *http.Request) bool {
+	if key := r.Header.Get(DefaultAdminKeyHeader); a.key != "" && key != "" {
+		return subtle.ConstantTimeCompare([]byte(key), []byte(a.key)) == 1
+	}
+	if claims, ok := TokenClaimsFromContext(r.Context()); ok && a.scope != "" {
+		return claims.HasScope(a.scope)
+	}
+	return false
+}
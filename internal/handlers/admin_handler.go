@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// AdminHandler serves operational endpoints under /admin
+type AdminHandler struct {
+	selfTest  services.SelfTestRunner
+	rebuilder services.MetadataRebuilder
+}
+
+// NewAdminHandler creates a new admin handler with dependencies
+func NewAdminHandler(selfTest services.SelfTestRunner, rebuilder services.MetadataRebuilder) *AdminHandler {
+	return &AdminHandler{
+		selfTest:  selfTest,
+		rebuilder: rebuilder,
+	}
+}
+
+// SelfTestHandler runs a probe through the payload pipeline and reports per-stage latency
+func (h *AdminHandler) SelfTestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	report := h.selfTest.Run()
+	status := http.StatusOK
+	if !report.OK {
+		log.Printf("Self-test failed: %+v", report.Stages)
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// ReindexHandler rebuilds the metadata index by scanning the storage backend
+func (h *AdminHandler) ReindexHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	result, err := h.rebuilder.Rebuild()
+	if err != nil {
+		log.Printf("Error rebuilding metadata index: %v", err)
+		http.Error(w, "Error rebuilding metadata index", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Rebuilt metadata index: %d scanned, %d indexed, %d removed, %d failed",
+		result.Scanned, result.Indexed, result.Removed, len(result.Failed))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// sourceIP is the address of the client connected to the depot
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// admissionInput describes an upload to an admission policy from its request line and headers
+func admissionInput(r *http.Request, filename, requestID string, tags []string) services.AdmissionInput {
+	headers := make(map[string]string, len(r.Header))
+	for name, values := range r.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ", ")
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	now := time.Now()
+	return services.AdmissionInput{
+		Route:       r.URL.Path,
+		Method:      r.Method,
+		SourceIP:    sourceIP(r),
+		ForwardedIP: parseTags(r.Header.Get("X-Forwarded-For")),
+		ContentType: r.Header.Get("Content-Type"),
+		Size:        r.ContentLength,
+		Filename:    filename,
+		RequestID:   requestID,
+		Tags:        tags,
+		Headers:     headers,
+		Time: services.AdmissionTime{
+			RFC3339: now.Format(time.RFC3339),
+			Unix:    now.Unix(),
+			Hour:    now.Hour(),
+			Minute:  now.Minute(),
+			Weekday: now.Weekday().String(),
+		},
+	}
+}
+
+// admit evaluates an upload against the policy before its body is read, answering 403
+// with the policy's reasons when it is rejected. A policy that cannot be evaluated
+// rejects the upload.
+func admit(w http.ResponseWriter, policy services.AdmissionPolicy, input services.AdmissionInput) bool {
+	if policy == nil {
+		return true
+	}
+	decision, err := policy.Evaluate(input)
+	if err != nil {
+		log.Printf("Error evaluating admission policy: %v", err)
+		http.Error(w, "Error evaluating admission policy", http.StatusInternalServerError)
+		return false
+	}
+	if !decision.Allowed {
+		log.Printf("Upload from %s to %s rejected by policy: %s", input.SourceIP, input.Route, strings.Join(decision.Reasons, "; "))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]any{
+			"error":   "rejected by admission policy",
+			"reasons": decision.Reasons,
+		})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// AppendHandler extends a stored payload with chunks shipped under one request ID
+type AppendHandler struct {
+	appender          services.PayloadAppender
+	filenameExtractor services.FilenameExtractor
+	policy            services.AdmissionPolicy
+}
+
+// NewAppendHandler creates a new append handler with dependencies
+func NewAppendHandler(appender services.PayloadAppender, filenameExtractor services.FilenameExtractor) *AppendHandler {
+	return &AppendHandler{
+		appender:          appender,
+		filenameExtractor: filenameExtractor,
+	}
+}
+
+// SetAdmissionPolicy has policy accept or reject every chunk before its body is read
+func (h *AppendHandler) SetAdmissionPolicy(policy services.AdmissionPolicy) {
+	h.policy = policy
+}
+
+// AppendHandler appends the request body to the object stored under the request ID,
+// creating it on the first chunk
+func (h *AppendHandler) AppendHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	requestID := r.Header.Get("X-Depot-Request-Id")
+	if requestID == "" {
+		requestID = r.URL.Query().Get("request_id")
+	}
+	if requestID == "" {
+		http.Error(w, "Missing request_id query parameter", http.StatusBadRequest)
+		return
+	}
+	requestID = tenantRequestID(r, requestID)
+
+	filename := h.filenameExtractor.Extract(r.Header.Get("Content-Disposition"))
+	opts := services.StoreOptions{Tags: parseTags(r.Header.Get("X-Depot-Tags"))}
+	if !admit(w, h.policy, admissionInput(r, filename, requestID, opts.Tags)) {
+		return
+	}
+
+	bodyBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("Error reading body: %v", err)
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := verifyBodyChecksum(r, bodyBytes); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	result, err := h.appender.AppendPayload(requestID, bodyBytes, contentType, filename, opts)
+	switch {
+	case errors.Is(err, services.ErrInvalidRequestID):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, services.ErrNotAppendable):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	case errors.Is(err, services.ErrReadOnly):
+		writeMaintenance(w, err.Error())
+		return
+	case err != nil:
+		log.Printf("Error appending to %s: %v", requestID, err)
+		http.Error(w, "Error appending payload", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
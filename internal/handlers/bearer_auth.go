@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// DefaultPublicRoutes are reachable without a token; webhooks carry their own signatures
+var DefaultPublicRoutes = []string{"/webhooks/github", "/webhooks/stripe"}
+
+type claimsContextKey struct{}
+
+// WithTokenClaims returns ctx carrying the claims of the request's bearer token
+func WithTokenClaims(ctx context.Context, claims *services.TokenClaims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// TokenClaimsFromContext returns the claims of the request's bearer token, if it had one
+func TokenClaimsFromContext(ctx context.Context) (*services.TokenClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*services.TokenClaims)
+	return claims, ok
+}
+
+// BearerAuth requires a valid bearer token on every route but the public ones, and
+// attaches its claims to the request context. Routes can require a scope; a route
+// ending in "/" covers every route below it.
+type BearerAuth struct {
+	verifier services.TokenVerifier
+	public   map[string]bool
+	scopes   map[string]string
+}
+
+// NewBearerAuth creates the middleware, leaving publicRoutes open
+func NewBearerAuth(verifier services.TokenVerifier, publicRoutes []string) *BearerAuth {
+	public := make(map[string]bool, len(publicRoutes))
+	for _, route := range publicRoutes {
+		public[route] = true
+	}
+	return &BearerAuth{
+		verifier: verifier,
+		public:   public,
+		scopes:   make(map[string]string),
+	}
+}
+
+// SetRouteScopes requires the scope mapped to each route
+func (a *BearerAuth) SetRouteScopes(scopes map[string]string) {
+	a.scopes = scopes
+}
+
+// requiredScope returns the scope of route, the longest matching prefix winning
+func (a *BearerAuth) requiredScope(route string) string {
+	if scope, ok := a.scopes[route]; ok {
+		return scope
+	}
+	var scope, match string
+	for prefix, s := range a.scopes {
+		if strings.HasSuffix(prefix, "/") && strings.HasPrefix(route, prefix) && len(prefix) > len(match) {
+			scope, match = s, prefix
+		}
+	}
+	return scope
+}
+
+// Wrap returns next, refusing requests without a valid token or the route's scope
+func (a *BearerAuth) Wrap(route string, next http.HandlerFunc) http.HandlerFunc {
+	if a.public[route] {
+		return next
+	}
+	scope := a.requiredScope(route)
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || strings.TrimSpace(token) == "" {
+			writeUnauthorized(w, http.StatusUnauthorized, "", "a bearer token is required")
+			return
+		}
+		claims, err := a.verifier.VerifyToken(strings.TrimSpace(token))
+		if err != nil {
+			if !errors.Is(err, services.ErrInvalidToken) {
+				log.Printf("Bearer token verification failed: %v", err)
+				http.Error(w, "Token verification unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			writeUnauthorized(w, http.StatusUnauthorized, "invalid_token", err.Error())
+			return
+		}
+		if scope != "" && !claims.HasScope(scope) {
+			writeUnauthorized(w, http.StatusForbidden, "insufficient_scope", fmt.Sprintf("the %s scope is required", scope))
+			return
+		}
+		next(w, r.WithContext(WithTokenClaims(r.Context(), claims)))
+	}
+}
+
+// writeUnauthorized answers a refused request with the RFC 6750 challenge
+func writeUnauthorized(w http.ResponseWriter, status int, code, description string) {
+	challenge := `Bearer realm="simple-depot"`
+	if code != "" {
+		challenge += fmt.Sprintf(`, error=%q, error_description=%q`, code, description)
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":   http.StatusText(status),
+		"message": description,
+	})
+}
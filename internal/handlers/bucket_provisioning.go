@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// BucketProvisioning makes sure the bucket of the namespace named in a header exists
+// before the request is handled
+type BucketProvisioning struct {
+	header      string
+	provisioner services.NamespaceProvisioner
+}
+
+// NewBucketProvisioning creates a middleware reading the namespace from header
+func NewBucketProvisioning(header string, provisioner services.NamespaceProvisioner) *BucketProvisioning {
+	if header == "" {
+		header = DefaultNamespaceHeader
+	}
+	return &BucketProvisioning{
+		header:      header,
+		provisioner: provisioner,
+	}
+}
+
+// Wrap returns next, answering 503 while a new namespace's bucket cannot be
+// provisioned
+func (p *BucketProvisioning) Wrap(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := p.provisioner.Provision(r.Header.Get(p.header)); err != nil {
+			log.Printf("Error provisioning namespace: %v", err)
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, "Error provisioning namespace", http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
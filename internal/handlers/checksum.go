@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Checksum fields a client can send, as a header up front or as a trailer after a streamed body
+const (
+	// depotChecksumField carries the body's SHA-256 as hex or base64
+	depotChecksumField = "X-Depot-Checksum-Sha256"
+	// amzChecksumField carries the body's SHA-256 as base64, as S3 clients send it
+	amzChecksumField = "X-Amz-Checksum-Sha256"
+)
+
+// errChecksumMismatch is returned when a body does not match the checksum its client declared
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// verifyBodyChecksum checks a fully read body against the SHA-256 the client declared in
+// a header or trailer. Trailers are only populated once the body has been read to EOF.
+// Requests without a checksum pass unverified.
+func verifyBodyChecksum(r *http.Request, body []byte) error {
+	actual := sha256.Sum256(body)
+	return verifyDigest(r, actual[:])
+}
+
+// verifyDigest checks a body's SHA-256 digest against the checksums its client declared
+func verifyDigest(r *http.Request, actual []byte) error {
+	for _, field := range []string{depotChecksumField, amzChecksumField} {
+		declared := r.Trailer.Get(field)
+		if declared == "" {
+			declared = r.Header.Get(field)
+		}
+		if declared == "" {
+			continue
+		}
+
+		expected, err := decodeChecksum(strings.TrimSpace(declared))
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", field, err)
+		}
+		if string(actual) != string(expected) {
+			return fmt.Errorf("%w: %s is %s, body is %s", errChecksumMismatch, field, declared, hex.EncodeToString(actual))
+		}
+	}
+	return nil
+}
+
+// checksumReader hashes a request body as it is streamed and fails the final read when
+// the body does not match its declared checksum, so storage aborts the upload. Any
+// error reading the body is kept in err.
+type checksumReader struct {
+	r    *http.Request
+	hash hash.Hash
+	err  error
+}
+
+func newChecksumReader(r *http.Request) *checksumReader {
+	return &checksumReader{r: r, hash: sha256.New()}
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Body.Read(p)
+	c.hash.Write(p[:n])
+	if err == io.EOF {
+		if verifyErr := verifyDigest(c.r, c.hash.Sum(nil)); verifyErr != nil {
+			err = verifyErr
+		}
+	}
+	if err != nil && err != io.EOF {
+		c.err = err
+	}
+	return n, err
+}
+
+// decodeChecksum accepts a SHA-256 digest as 64 hex characters or standard base64
+func decodeChecksum(value string) ([]byte, error) {
+	if len(value) == hex.EncodedLen(sha256.Size) {
+		return hex.DecodeString(value)
+	}
+	digest, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(digest) != sha256.Size {
+		return nil, fmt.Errorf("expected a %d-byte digest, got %d", sha256.Size, len(digest))
+	}
+	return digest, nil
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// supportedEncodings lists the content codings /depot decodes, for Accept-Encoding
+const supportedEncodings = "gzip, deflate, zstd"
+
+// errUnsupportedEncoding is returned for a body in a content coding /depot cannot decode
+var errUnsupportedEncoding = errors.New("unsupported Content-Encoding")
+
+// contentEncoding returns a request's content codings in the order they were applied,
+// without the identity coding
+func contentEncoding(r *http.Request) []string {
+	var codings []string
+	for _, coding := range strings.Split(r.Header.Get("Content-Encoding"), ",") {
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "" && coding != "identity" {
+			codings = append(codings, coding)
+		}
+	}
+	return codings
+}
+
+// decodeBody replaces a request's body with its decoded content, undoing its codings
+// last applied first. Decoded bodies have an unknown length.
+func decodeBody(r *http.Request, codings []string) error {
+	decoded := &decodedBody{ReadCloser: r.Body, closers: []io.Closer{r.Body}}
+	for i := len(codings) - 1; i >= 0; i-- {
+		reader, err := decoder(codings[i], decoded.ReadCloser)
+		if err != nil {
+			decoded.Close()
+			return err
+		}
+		decoded.ReadCloser = reader
+		decoded.closers = append(decoded.closers, reader)
+	}
+	r.Body = decoded
+	r.ContentLength = -1
+	return nil
+}
+
+// decoder wraps body in a reader decoding one content coding
+func decoder(coding string, body io.ReadCloser) (io.ReadCloser, error) {
+	switch coding {
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %v", err)
+		}
+		return reader, nil
+	case "deflate":
+		reader, err := zlib.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deflate body: %v", err)
+		}
+		return reader, nil
+	case "zstd":
+		reader, err := zstd.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid zstd body: %v", err)
+		}
+		return reader.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("%w: %s", errUnsupportedEncoding, coding)
+}
+
+// decodedBody reads the outermost decoder, and closes every decoder and the request
+// body they read
+type decodedBody struct {
+	io.ReadCloser
+	closers []io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	var err error
+	for i := len(b.closers) - 1; i >= 0; i-- {
+		err = errors.Join(err, b.closers[i].Close())
+	}
+	return err
+}
+
+// writeEncodingError answers a body that could not be decoded
+func writeEncodingError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errUnsupportedEncoding) {
+		w.Header().Set("Accept-Encoding", supportedEncodings)
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
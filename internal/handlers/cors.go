@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCORSMethods are the methods browsers may use when DEPOT_CORS_METHODS is unset
+var DefaultCORSMethods = []string{"GET", "HEAD", "POST", "PUT", "DELETE"}
+
+// DefaultCORSExposedHeaders are the response headers scripts may read
+var DefaultCORSExposedHeaders = []string{
+	"Content-Disposition",
+	"Location",
+	"Retry-After",
+	"X-Depot-Object-Count",
+	"X-Depot-Object-Name",
+	"X-Depot-Size",
+	"X-Depot-Export-Rows",
+	"X-Depot-Zip-Password",
+}
+
+// CORS lets browser scripts on allowed origins call the depot. It answers preflight
+// requests itself, before authentication, since browsers send them without
+// credentials.
+type CORS struct {
+	origins     []string
+	methods     string
+	headers     string
+	exposed     string
+	credentials bool
+	maxAge      string
+}
+
+// NewCORS allows the origins given, exactly, as "*" for any, or as patterns such as
+// "https://*.example.com". Empty methods use DefaultCORSMethods, and empty headers
+// allow whatever request headers a preflight asks for.
+func NewCORS(origins, methods, headers []string, credentials bool, maxAge time.Duration) *CORS {
+	if len(methods) == 0 {
+		methods = DefaultCORSMethods
+	}
+	return &CORS{
+		origins:     origins,
+		methods:     strings.Join(methods, ", "),
+		headers:     strings.Join(headers, ", "),
+		exposed:     strings.Join(DefaultCORSExposedHeaders, ", "),
+		credentials: credentials,
+		maxAge:      strconv.Itoa(int(maxAge.Seconds())),
+	}
+}
+
+// Wrap returns next with CORS headers added for allowed origins and preflight
+// requests answered
+func (c *CORS) Wrap(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next(w, r)
+			return
+		}
+		header := w.Header()
+		header.Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if !c.allowed(origin) {
+			if preflight {
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			next(w, r)
+			return
+		}
+
+		if c.anyOrigin() && !c.credentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.credentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			header.Set("Access-Control-Expose-Headers", c.exposed)
+			next(w, r)
+			return
+		}
+
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		header.Set("Access-Control-Allow-Methods", c.methods)
+		if c.headers != "" {
+			header.Set("Access-Control-Allow-Headers", c.headers)
+		} else if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			header.Set("Access-Control-Allow-Headers", requested)
+		}
+		header.Set("Access-Control-Max-Age", c.maxAge)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// allowed reports whether origin matches one of the allowed origins
+func (c *CORS) allowed(origin string) bool {
+	for _, allowed := range c.origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if strings.Contains(allowed, "*") {
+			if matched, _ := path.Match(strings.ToLower(allowed), strings.ToLower(origin)); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *CORS) anyOrigin() bool {
+	for _, allowed := range c.origins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// Limits for the deliveries listing
+const (
+	defaultDeliveriesLimit = 100
+	maxDeliveriesLimit     = 1000
+)
+
+// DeliveriesHandler exposes the outbound delivery log and re-drives failed deliveries
+type DeliveriesHandler struct {
+	deliveries services.DeliveryTracker
+}
+
+// NewDeliveriesHandler creates a new deliveries handler with dependencies
+func NewDeliveriesHandler(deliveries services.DeliveryTracker) *DeliveriesHandler {
+	return &DeliveriesHandler{
+		deliveries: deliveries,
+	}
+}
+
+// DeliveriesHandler lists outbound deliveries with their attempt history, newest first
+func (h *DeliveriesHandler) DeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	status := query.Get("status")
+	switch status {
+	case "", services.DeliveryPending, services.DeliveryDelivered, services.DeliveryFailed:
+	default:
+		http.Error(w, "Invalid status; use pending, delivered or failed", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultDeliveriesLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxDeliveriesLimit)
+	}
+
+	deliveries := h.tenantDeliveries(r, status, query.Get("kind"), limit)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"deliveries": deliveries,
+		"count":      len(deliveries),
+	})
+}
+
+// RedriveHandler retries one failed delivery (?id=) or every failed delivery (?all=true)
+func (h *DeliveriesHandler) RedriveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	tenant := TenantFromContext(r.Context())
+	if query.Get("all") == "true" {
+		queued := 0
+		if tenant == "" {
+			queued = h.deliveries.RedriveFailed()
+		} else {
+			for _, delivery := range h.tenantDeliveries(r, services.DeliveryFailed, "", 0) {
+				if h.deliveries.Redrive(delivery.ID) == nil {
+					queued++
+				}
+			}
+		}
+		writeRedriveResponse(w, queued)
+		return
+	}
+
+	id := query.Get("id")
+	if id == "" {
+		http.Error(w, "Missing id query parameter", http.StatusBadRequest)
+		return
+	}
+	// Other tenants' deliveries are not found
+	if tenant != "" && !slices.ContainsFunc(h.tenantDeliveries(r, "", "", 0), func(d services.Delivery) bool { return d.ID == id }) {
+		http.Error(w, services.ErrDeliveryNotFound.Error()+": "+id, http.StatusNotFound)
+		return
+	}
+	err := h.deliveries.Redrive(id)
+	if errors.Is(err, services.ErrDeliveryNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, services.ErrDeliveryNotFailed) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeRedriveResponse(w, 1)
+}
+
+// tenantDeliveries lists the deliveries of the request's tenant, or every delivery
+// without tenants
+func (h *DeliveriesHandler) tenantDeliveries(r *http.Request, status, kind string, limit int) []services.Delivery {
+	tenant := TenantFromContext(r.Context())
+	if tenant == "" {
+		return h.deliveries.List(status, kind, limit)
+	}
+	owned := []services.Delivery{}
+	for _, delivery := range h.deliveries.List(status, kind, 0) {
+		if limit > 0 && len(owned) == limit {
+			break
+		}
+		if services.TenantOwns(tenant, delivery.RequestID) {
+			owned = append(owned, delivery)
+		}
+	}
+	return owned
+}
+
+func writeRedriveResponse(w http.ResponseWriter, queued int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]any{
+		"queued": queued,
+	})
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// eventsKeepAlive is how often an idle event stream sends a comment, so proxies do
+// not close it
+const eventsKeepAlive = 15 * time.Second
+
+// EventsHandler streams a Server-Sent Event for every stored payload matching the
+// optional prefix, content_type and tag filters. Each event's ID is its changes feed
+// cursor: a client reconnecting with Last-Event-ID, as EventSource does, or with
+// since=<cursor>, first receives the events it missed. Streams end on shutdown.
+func (h *FeedHandler) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	filter, ok := parseTailFilter(r.URL.Query())
+	if !ok {
+		http.Error(w, "Invalid preview length or format", http.StatusBadRequest)
+		return
+	}
+	filter.prefix = tenantRequestID(r, filter.prefix)
+	since := int64(-1)
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("since")
+	}
+	if raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid since cursor", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+	if since > h.feed.Cursor() {
+		// The cursor is from before the feed was reset, by a restart; start over
+		since = 0
+	}
+
+	// The stream outlives any write timeout set for ordinary requests
+	controller := http.NewResponseController(w)
+	controller.SetWriteDeadline(time.Time{})
+
+	// Subscribe before replaying so nothing slips between the two
+	events, cancel := h.feed.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	last := since
+	send := func(event services.ChangeEvent) error {
+		if event.Cursor <= last {
+			return nil
+		}
+		last = event.Cursor
+		if !filter.matches(event) {
+			return nil
+		}
+		data, err := json.Marshal(h.buildTailMessage(event, filter))
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Cursor, event.Type, data); err != nil {
+			return err
+		}
+		return controller.Flush()
+	}
+
+	if since >= 0 {
+		for {
+			past, next, _ := h.feed.Since(last, maxChangesLimit)
+			for _, event := range past {
+				if err := send(event); err != nil {
+					return
+				}
+			}
+			if len(past) < maxChangesLimit {
+				break
+			}
+			last = next
+		}
+	}
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := send(event); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			if err := controller.Flush(); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-h.closing:
+			return
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// ExportHandler exports collections of JSON payloads as CSV or Parquet
+type ExportHandler struct {
+	exporter services.Exporter
+}
+
+// NewExportHandler creates a new export handler with dependencies
+func NewExportHandler(exporter services.Exporter) *ExportHandler {
+	return &ExportHandler{
+		exporter: exporter,
+	}
+}
+
+// ExportHandler flattens JSON payloads selected by prefix, tag and time range;
+// repeated field=<column>:<jq expr> parameters choose the output columns
+func (h *ExportHandler) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	req := services.ExportRequest{
+		Format: query.Get("format"),
+		Prefix: tenantRequestID(r, query.Get("prefix")),
+		Tag:    query.Get("tag"),
+	}
+	if req.Format == "" {
+		req.Format = services.ExportFormatCSV
+	}
+	if req.Format != services.ExportFormatCSV && req.Format != services.ExportFormatParquet {
+		http.Error(w, "Invalid format; use csv or parquet", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if req.After, err = parseTimeParam(query.Get("after")); err != nil {
+		http.Error(w, "Invalid after timestamp; use RFC3339", http.StatusBadRequest)
+		return
+	}
+	if req.Before, err = parseTimeParam(query.Get("before")); err != nil {
+		http.Error(w, "Invalid before timestamp; use RFC3339", http.StatusBadRequest)
+		return
+	}
+
+	for _, raw := range query["field"] {
+		column, expr, ok := strings.Cut(raw, ":")
+		if !ok || column == "" || expr == "" {
+			http.Error(w, "Invalid field mapping; use field=<column>:<expr>", http.StatusBadRequest)
+			return
+		}
+		req.Fields = append(req.Fields, services.ExportField{Column: column, Expr: expr})
+	}
+
+	var buf bytes.Buffer
+	rows, err := h.exporter.Export(&buf, req)
+	if errors.Is(err, services.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, services.ErrExportTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		log.Printf("Error exporting payloads: %v", err)
+		http.Error(w, "Error exporting payloads", http.StatusInternalServerError)
+		return
+	}
+
+	contentType := "text/csv"
+	if req.Format == services.ExportFormatParquet {
+		contentType = "application/vnd.apache.parquet"
+	}
+	filename := fmt.Sprintf("export_%s.%s", time.Now().UTC().Format("20060102T150405Z"), req.Format)
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+	w.Header().Set("X-Depot-Export-Rows", fmt.Sprint(rows))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// parseTimeParam parses an optional RFC3339 timestamp
+func parseTimeParam(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// Paging limits for the changes feed
+const (
+	defaultChangesLimit = 100
+	maxChangesLimit     = 1000
+)
+
+// Timeout bounds for long-poll waits
+const (
+	defaultWaitTimeout = 30 * time.Second
+	maxWaitTimeout     = 5 * time.Minute
+)
+
+// FeedHandler serves the feed of storage changes
+type FeedHandler struct {
+	feed              services.ChangeFeed
+	storage           services.StorageService
+	previewer         services.PayloadPreviewer
+	responseFormatter services.ResponseFormatter
+
+	// closing ends event streams on shutdown
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// NewFeedHandler creates a new feed handler with dependencies
+func NewFeedHandler(
+	feed services.ChangeFeed,
+	storage services.StorageService,
+	previewer services.PayloadPreviewer,
+	responseFormatter services.ResponseFormatter,
+) *FeedHandler {
+	return &FeedHandler{
+		feed:              feed,
+		storage:           storage,
+		previewer:         previewer,
+		responseFormatter: responseFormatter,
+		closing:           make(chan struct{}),
+	}
+}
+
+// CloseStreams ends the event streams and long polls open now and from now on, so
+// they do not hold up shutdown
+func (h *FeedHandler) CloseStreams() {
+	h.closeOnce.Do(func() { close(h.closing) })
+}
+
+// ChangesHandler returns stored/deleted events after the given cursor
+func (h *FeedHandler) ChangesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var since int64
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid since cursor", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+
+	limit := defaultChangesLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxChangesLimit)
+	}
+
+	events, next, truncated := h.feed.Since(since, limit)
+	// A tenant only sees changes to its own objects; the cursor still moves past the others
+	if tenant := TenantFromContext(r.Context()); tenant != "" {
+		owned := []services.ChangeEvent{}
+		for _, event := range events {
+			if services.TenantOwns(tenant, event.Object.ObjectName) {
+				owned = append(owned, event)
+			}
+		}
+		events = owned
+	}
+	response := h.responseFormatter.FormatChangesResponse(events, next, truncated)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// WaitHandler long-polls until a payload whose request ID or object name starts
+// with prefix is stored, or the timeout elapses; since=<cursor> also considers
+// events already recorded after that cursor
+func (h *FeedHandler) WaitHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	// A tenant only waits for its own payloads, which all start with its prefix
+	prefix := tenantRequestID(r, query.Get("prefix"))
+
+	timeout := defaultWaitTimeout
+	if raw := query.Get("timeout"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid timeout", http.StatusBadRequest)
+			return
+		}
+		timeout = min(parsed, maxWaitTimeout)
+	}
+
+	since := int64(-1)
+	if raw := query.Get("since"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid since cursor", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+
+	// Subscribe before replaying so nothing slips between the two
+	events, cancel := h.feed.Subscribe()
+	defer cancel()
+
+	if since >= 0 {
+		for {
+			past, next, _ := h.feed.Since(since, maxChangesLimit)
+			for _, event := range past {
+				if matchesWait(event, prefix) {
+					writeWaitResponse(w, &event, event.Cursor)
+					return
+				}
+			}
+			if len(past) < maxChangesLimit {
+				break
+			}
+			since = next
+		}
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if matchesWait(event, prefix) {
+				writeWaitResponse(w, &event, event.Cursor)
+				return
+			}
+		case <-timer.C:
+			writeWaitResponse(w, nil, h.feed.Cursor())
+			return
+		case <-h.closing:
+			// End the poll early on shutdown, as if it timed out, so clients poll again
+			writeWaitResponse(w, nil, h.feed.Cursor())
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func matchesWait(event services.ChangeEvent, prefix string) bool {
+	if event.Type != services.ChangeStored {
+		return false
+	}
+	return strings.HasPrefix(event.Object.RequestID, prefix) || strings.HasPrefix(event.Object.ObjectName, prefix)
+}
+
+func writeWaitResponse(w http.ResponseWriter, event *services.ChangeEvent, cursor int64) {
+	response := map[string]any{
+		"matched": event != nil,
+		"cursor":  cursor,
+	}
+	if event != nil {
+		response["event"] = event
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
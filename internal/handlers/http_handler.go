@@ -1,10 +1,18 @@
 package handlers
 
 import (
+	"context"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ahmad-alkadri/simple-depot/internal/services"
@@ -15,6 +23,13 @@ type HTTPHandler struct {
 	payloadService    services.PayloadService
 	responseFormatter services.ResponseFormatter
 	filenameExtractor services.FilenameExtractor
+	uploads           *services.UploadTracker
+	policy            services.AdmissionPolicy
+	maxInlineBytes    int64
+	syncStore         bool
+	streamThreshold   int64
+	maxBodySize       int64
+	keepEncoding      bool
 }
 
 // NewHTTPHandler creates a new HTTP handler with dependencies
@@ -30,19 +45,77 @@ func NewHTTPHandler(
 	}
 }
 
+// SetAdmissionPolicy has policy accept or reject every upload before its body is read
+func (h *HTTPHandler) SetAdmissionPolicy(policy services.AdmissionPolicy) {
+	h.policy = policy
+}
+
+// SetUploadTracker enables progress reporting for uploads sent under a client-chosen request ID
+func (h *HTTPHandler) SetUploadTracker(tracker *services.UploadTracker) {
+	h.uploads = tracker
+}
+
+// SetMaxInlineBytes caps the base64 payload data in one /get JSON response; further
+// payloads are left for the next page or the raw download
+func (h *HTTPHandler) SetMaxInlineBytes(maxInlineBytes int64) {
+	h.maxInlineBytes = maxInlineBytes
+}
+
+// SetSyncStore makes /depot wait for storage before answering, unless a request asks
+// otherwise with ?sync=false
+func (h *HTTPHandler) SetSyncStore(sync bool) {
+	h.syncStore = sync
+}
+
+// SetStreamThreshold streams bodies of at least threshold bytes into storage instead
+// of reading them into memory; bodies of unknown length are always streamed, and 0
+// streams only those
+func (h *HTTPHandler) SetStreamThreshold(threshold int64) {
+	h.streamThreshold = threshold
+}
+
+// SetMaxBodySize refuses /depot bodies larger than maxBodySize bytes with 413; 0
+// accepts any size
+func (h *HTTPHandler) SetMaxBodySize(maxBodySize int64) {
+	h.maxBodySize = maxBodySize
+}
+
+// SetKeepContentEncoding stores compressed /depot bodies as sent, recording their
+// Content-Encoding in the object metadata, instead of decoding them first
+func (h *HTTPHandler) SetKeepContentEncoding(keep bool) {
+	h.keepEncoding = keep
+}
+
 // DepotHandler handles depot endpoint requests
 func (h *HTTPHandler) DepotHandler(w http.ResponseWriter, r *http.Request) {
 	reqTime := time.Now().Format(time.RFC3339)
 
-	// Read full body
-	bodyBytes, err := io.ReadAll(r.Body)
-	if err != nil {
-		log.Printf("Error reading body: %v", err)
-		http.Error(w, "Error reading request body", http.StatusBadRequest)
-		return
-	}
 	defer r.Body.Close()
 
+	// Oversized bodies are refused up front when their length is declared, and cut
+	// off once the limit is read otherwise
+	if h.maxBodySize > 0 {
+		if r.ContentLength > h.maxBodySize {
+			writeTooLarge(w, h.maxBodySize)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, h.maxBodySize)
+	}
+
+	// Compressed bodies are decoded before processing, and the limit applies to the
+	// decoded bytes too. Uploads asking for a decompressed copy keep the gzip original.
+	codings := contentEncoding(r)
+	decode := len(codings) > 0 && !h.keepEncoding && r.Header.Get("X-Depot-Decompress") != "true"
+	if decode {
+		if err := decodeBody(r, codings); err != nil {
+			writeEncodingError(w, err)
+			return
+		}
+		if h.maxBodySize > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, h.maxBodySize)
+		}
+	}
+
 	contentType := r.Header.Get("Content-Type")
 	if contentType == "" {
 		contentType = "application/octet-stream"
@@ -50,44 +123,305 @@ func (h *HTTPHandler) DepotHandler(w http.ResponseWriter, r *http.Request) {
 
 	originalFilename := h.filenameExtractor.Extract(r.Header.Get("Content-Disposition"))
 
-	// Store the payload
-	requestID, err := h.payloadService.StorePayload(bodyBytes, contentType, originalFilename)
+	callbackURL := r.URL.Query().Get("callback")
+	if callbackURL == "" {
+		callbackURL = r.Header.Get("X-Depot-Callback")
+	}
+	if callbackURL != "" && !isValidCallbackURL(callbackURL) {
+		http.Error(w, "Invalid callback URL", http.StatusBadRequest)
+		return
+	}
+	if checker, ok := h.payloadService.(services.CallbackURLChecker); ok && callbackURL != "" {
+		if err := checker.CheckCallbackURL(callbackURL); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	opts := services.StoreOptions{
+		Tags:        parseTags(r.Header.Get("X-Depot-Tags")),
+		CallbackURL: callbackURL,
+		Extract:     r.Header.Get("X-Depot-Extract") == "true",
+
+		Decompress:      r.Header.Get("X-Depot-Decompress") == "true",
+		ContentEncoding: r.Header.Get("Content-Encoding"),
+
+		RequestID:   r.Header.Get("X-Depot-Request-Id"),
+		IfNoneMatch: strings.TrimSpace(r.Header.Get("If-None-Match")) == "*",
+
+		Source:   r.URL.Path,
+		Headers:  r.Header,
+		SourceIP: sourceIP(r),
+		Query:    r.URL.RawQuery,
+
+		Sync: h.syncStore,
+
+		Tenant:  TenantFromContext(r.Context()),
+		Context: r.Context(),
+	}
+	if decode {
+		opts.ContentEncoding = ""
+	} else if len(codings) > 0 && !opts.Decompress {
+		opts.Metadata = map[string]string{services.MetadataContentEncoding: strings.Join(codings, ", ")}
+	}
+	if opts.RequestID == "" {
+		opts.RequestID = r.URL.Query().Get("request_id")
+	}
+	if opts.RequestID != "" {
+		opts.RequestID = services.TenantRequestID(opts.Tenant, opts.RequestID)
+	}
+	switch r.URL.Query().Get("sync") {
+	case "":
+	case "true":
+		opts.Sync = true
+	case "false":
+		opts.Sync = false
+	default:
+		http.Error(w, "Invalid sync parameter; use true or false", http.StatusBadRequest)
+		return
+	}
+	if !admit(w, h.policy, admissionInput(r, originalFilename, opts.RequestID, opts.Tags)) {
+		return
+	}
+
+	// Uploads under a known request ID can be polled at /upload/<request_id>/progress
+	if h.uploads != nil && opts.RequestID != "" {
+		session := h.uploads.Begin(opts.RequestID, r.ContentLength)
+		r.Body = session.TrackBody(r.Body)
+		opts.Progress = session.Stored
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		w = recorder
+		defer func() { session.Finish(recorder.err()) }()
+	}
+
+	// Large uploads, and those of unknown length, go straight to storage when it can
+	// stream them
+	var result *services.StoreResult
+	var err error
+	payloadSize := 0
+	streamed := false
+	large := h.streamThreshold > 0 && r.ContentLength >= h.streamThreshold
+	if streamer, ok := h.payloadService.(services.PayloadStreamer); ok && (r.ContentLength < 0 || large) {
+		body := newChecksumReader(r)
+		result, err = streamer.StorePayloadStream(body, r.ContentLength, contentType, originalFilename, opts)
+		streamed = !errors.Is(err, services.ErrStreamUnsupported)
+		if tooLarge(body.err) || tooLarge(err) {
+			writeTooLarge(w, h.maxBodySize)
+			return
+		}
+		if body.err != nil {
+			services.Logger(r.Context()).Warn("streaming body failed", slog.Any("error", body.err))
+			http.Error(w, body.err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err == nil {
+			payloadSize = result.Objects[0].Size
+		}
+	}
+
+	if !streamed {
+		// Read full body
+		bodyBytes, readErr := io.ReadAll(r.Body)
+		if tooLarge(readErr) {
+			writeTooLarge(w, h.maxBodySize)
+			return
+		}
+		if readErr != nil {
+			services.Logger(r.Context()).Warn("reading body failed", slog.Any("error", readErr))
+			http.Error(w, "Error reading request body", http.StatusBadRequest)
+			return
+		}
+		if err := verifyBodyChecksum(r, bodyBytes); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		payloadSize = len(bodyBytes)
+
+		// Store the payload
+		result, err = h.payloadService.StorePayload(bodyBytes, contentType, originalFilename, opts)
+	}
 	if err != nil {
-		log.Printf("Error storing payload: %v", err)
-		http.Error(w, "Error storing payload", http.StatusInternalServerError)
+		writeStoreError(w, err)
 		return
 	}
 
 	// Prepare response
-	response := h.responseFormatter.FormatDepotResponse(requestID, len(bodyBytes), reqTime, originalFilename)
+	response := h.responseFormatter.FormatDepotResponse(result, payloadSize, reqTime, originalFilename)
 
 	// Log and respond
-	log.Printf("[%s] %s request, payload size: %d bytes, request_id: %s", reqTime, r.Method, len(bodyBytes), requestID)
+	services.LoggerWith(r.Context(), slog.String("request_id", result.RequestID)).Info("payload accepted",
+		slog.Int("size", payloadSize), slog.Bool("streamed", streamed))
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
 
+// writeStoreError answers an upload that could not be stored
+func writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, services.ErrArchiveTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	var exists *services.PayloadExistsError
+	if errors.As(err, &exists) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusPreconditionFailed)
+		json.NewEncoder(w).Encode(map[string]any{
+			"error":      err.Error(),
+			"request_id": exists.RequestID,
+			"objects":    exists.Objects,
+		})
+		return
+	}
+	if errors.Is(err, services.ErrPayloadDropped) {
+		writeDropped(w, err)
+		return
+	}
+	if errors.Is(err, services.ErrReadOnly) {
+		writeMaintenance(w, err.Error())
+		return
+	}
+	if errors.Is(err, services.ErrSaveQueueFull) {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, services.ErrPayloadRejected) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	var failed *services.StoreFailedError
+	if errors.As(err, &failed) {
+		writeStoreFailed(w, failed)
+		return
+	}
+	if errors.Is(err, services.ErrUnsafeArchive) || errors.Is(err, services.ErrInvalidArchive) || errors.Is(err, services.ErrInvalidRequestID) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Error storing payload: %v", err)
+	http.Error(w, "Error storing payload", http.StatusInternalServerError)
+}
+
+// DeleteHandler removes every payload of a given request_id
+func (h *HTTPHandler) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	deleter, ok := h.payloadService.(services.RequestDeleter)
+	if !ok {
+		http.Error(w, "Deletion is not supported", http.StatusNotImplemented)
+		return
+	}
+
+	requestID := r.URL.Query().Get("request_id")
+	if requestID == "" {
+		http.Error(w, "Missing request_id query parameter", http.StatusBadRequest)
+		return
+	}
+	requestID = tenantRequestID(r, requestID)
+
+	deleted, err := deleter.DeleteRequest(r.Context(), requestID)
+	switch {
+	case errors.Is(err, services.ErrInvalidRequestID):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, services.ErrLegalHold), errors.Is(err, services.ErrRetained):
+		// Objects that were removed before the refusal stay removed
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]any{
+			"request_id": requestID,
+			"deleted":    deleted,
+			"count":      len(deleted),
+			"error":      err.Error(),
+		})
+		return
+	case err != nil:
+		services.LoggerWith(r.Context(), slog.String("request_id", requestID)).Error("deleting payloads failed", slog.Any("error", err))
+		http.Error(w, "Error deleting payloads", http.StatusInternalServerError)
+		return
+	case len(deleted) == 0:
+		http.Error(w, "no payloads found for request_id", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"request_id": requestID,
+		"deleted":    deleted,
+		"count":      len(deleted),
+	})
+}
+
 // GetHandler retrieves the payload for a given request_id
 func (h *HTTPHandler) GetHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	if r.Method == http.MethodHead || r.URL.Query().Get("meta") == "true" {
+		h.statPayloads(w, r)
+		return
+	}
+
+	if objectName := r.URL.Query().Get("object"); objectName != "" {
+		h.getObject(w, tenantRequestID(r, objectName))
+		return
+	}
+
 	requestID := r.URL.Query().Get("request_id")
 	if requestID == "" {
-		http.Error(w, "Missing request_id query parameter", http.StatusBadRequest)
+		http.Error(w, "Missing request_id or object query parameter", http.StatusBadRequest)
 		return
 	}
+	requestID = tenantRequestID(r, requestID)
 
 	raw := r.URL.Query().Get("raw") == "true"
 
-	result, err := h.payloadService.RetrievePayloads(requestID, raw)
+	// A zip password, supplied or generated, encrypts the download
+	password := r.Header.Get("X-Depot-Zip-Password")
+	encrypt := password != "" || r.URL.Query().Get("encrypt") == "true"
+	if encrypt {
+		h.getEncryptedZip(w, r, requestID, password, raw)
+		return
+	}
+
+	// Raw downloads stream from storage when it can, instead of being read into memory
+	if streamer, ok := h.payloadService.(services.RawStreamer); ok && raw {
+		download, err := streamer.StreamRawPayloads(requestID)
+		if err == nil {
+			writeRawDownload(w, download)
+			return
+		}
+		if !errors.Is(err, services.ErrReadStreamUnsupported) {
+			writeGetError(w, requestID, err)
+			return
+		}
+	}
+
+	var result interface{}
+	var err error
+	if pager, ok := h.payloadService.(services.PayloadPageRetriever); ok && !raw {
+		page := services.PayloadPage{MaxInlineBytes: h.maxInlineBytes}
+		var valid bool
+		if page.Offset, valid = parseNonNegative(r.URL.Query().Get("offset"), 0); !valid {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		if page.Limit, valid = parseNonNegative(r.URL.Query().Get("limit"), 0); !valid {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		result, err = pager.RetrievePayloadPage(r.Context(), requestID, page)
+	} else {
+		result, err = h.retrievePayloads(r.Context(), requestID, raw)
+	}
 	if err != nil {
-		log.Printf("Error retrieving payloads: %v", err)
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeGetError(w, requestID, err)
 		return
 	}
 
@@ -116,22 +450,301 @@ func (h *HTTPHandler) GetHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(result)
 }
 
-// ListHandler provides an endpoint to list all stored payloads
+// retrievePayloads retrieves a request's payloads under ctx when the payload service
+// can bind retrievals to one
+func (h *HTTPHandler) retrievePayloads(ctx context.Context, requestID string, raw bool) (interface{}, error) {
+	if retriever, ok := h.payloadService.(services.ContextRetriever); ok {
+		return retriever.RetrievePayloadsContext(ctx, requestID, raw)
+	}
+	return h.payloadService.RetrievePayloads(requestID, raw)
+}
+
+// listAllPayloads lists every payload under ctx when the payload service can bind
+// listings to one
+func (h *HTTPHandler) listAllPayloads(ctx context.Context) ([]string, error) {
+	if retriever, ok := h.payloadService.(services.ContextRetriever); ok {
+		return retriever.ListAllPayloadsContext(ctx)
+	}
+	return h.payloadService.ListAllPayloads()
+}
+
+// getObject streams a single stored object with its content type
+func (h *HTTPHandler) getObject(w http.ResponseWriter, objectName string) {
+	downloader, ok := h.payloadService.(services.ObjectDownloader)
+	if !ok {
+		http.Error(w, "Object downloads are not supported", http.StatusNotImplemented)
+		return
+	}
+	download, err := downloader.DownloadObject(objectName)
+	if err != nil {
+		writeGetError(w, objectName, err)
+		return
+	}
+	writeRawDownload(w, download)
+}
+
+// statPayloads answers HEAD, or meta=true, with the headers of the download a GET
+// would return and no body: one object's type, size, checksum and filename, or the
+// count of a request's objects when they would be zipped
+func (h *HTTPHandler) statPayloads(w http.ResponseWriter, r *http.Request) {
+	statter, ok := h.payloadService.(services.PayloadStatReader)
+	if !ok {
+		http.Error(w, "Metadata queries are not supported", http.StatusNotImplemented)
+		return
+	}
+
+	var stats []services.ObjectStat
+	var target string
+	if objectName := r.URL.Query().Get("object"); objectName != "" {
+		target = tenantRequestID(r, objectName)
+		stat, err := statter.StatObject(target)
+		if err != nil {
+			writeGetError(w, target, err)
+			return
+		}
+		stats = []services.ObjectStat{*stat}
+	} else {
+		target = r.URL.Query().Get("request_id")
+		if target == "" {
+			http.Error(w, "Missing request_id or object query parameter", http.StatusBadRequest)
+			return
+		}
+		target = tenantRequestID(r, target)
+		var err error
+		if stats, err = statter.StatPayloads(target); err != nil {
+			writeGetError(w, target, err)
+			return
+		}
+	}
+
+	w.Header().Set("X-Depot-Object-Count", strconv.Itoa(len(stats)))
+	if len(stats) > 1 {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"payloads_"+target+".zip\"")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	stat := stats[0]
+	filename := stat.OriginalFilename
+	if filename == "" {
+		filename = stat.ObjectName
+	}
+	w.Header().Set("Content-Type", stat.ContentType)
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+	w.Header().Set("X-Depot-Object-Name", stat.ObjectName)
+	w.Header().Set("X-Depot-Size", strconv.FormatInt(stat.Size, 10))
+	if stat.SHA256 != "" {
+		w.Header().Set(depotChecksumField, stat.SHA256)
+	}
+	if !stat.LastModified.IsZero() {
+		w.Header().Set("Last-Modified", stat.LastModified.UTC().Format(http.TimeFormat))
+	}
+	// A GET with meta=true sends no body, so only HEAD can announce the body's length
+	if r.Method == http.MethodHead {
+		w.Header().Set("Content-Length", strconv.FormatInt(stat.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeGetError answers a failed retrieval
+func writeGetError(w http.ResponseWriter, requestID string, err error) {
+	if errors.Is(err, services.ErrRestoreInProgress) {
+		writeRestoring(w, requestID, err)
+		return
+	}
+	log.Printf("Error retrieving payloads: %v", err)
+	http.Error(w, err.Error(), http.StatusNotFound)
+}
+
+// writeRawDownload streams a raw download. Once the body has started, an error can
+// only be logged and the response cut short.
+func writeRawDownload(w http.ResponseWriter, download *services.RawDownload) {
+	w.Header().Set("Content-Type", download.ContentType)
+	if download.ContentEncoding != "" {
+		w.Header().Set("Content-Encoding", download.ContentEncoding)
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+download.Filename+"\"")
+	if download.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(download.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	if err := download.Write(w); err != nil {
+		log.Printf("Error streaming %s: %v", download.Filename, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// getEncryptedZip answers a raw download with all of a request's payloads in an AES
+// encrypted zip. A generated password is returned in the X-Depot-Zip-Password header.
+func (h *HTTPHandler) getEncryptedZip(w http.ResponseWriter, r *http.Request, requestID, password string, raw bool) {
+	retriever, ok := h.payloadService.(services.EncryptedZipRetriever)
+	if !ok {
+		http.Error(w, services.ErrZipEncryptionUnsupported.Error(), http.StatusNotImplemented)
+		return
+	}
+	if !raw {
+		http.Error(w, "Encrypted downloads require raw=true", http.StatusBadRequest)
+		return
+	}
+	generated := password == ""
+	if generated {
+		password = rand.Text()
+	}
+	if len(password) < services.MinZipPasswordLength {
+		http.Error(w, services.ErrZipPasswordTooShort.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := retriever.RetrieveEncryptedZip(r.Context(), requestID, password)
+	if errors.Is(err, services.ErrRestoreInProgress) {
+		writeRestoring(w, requestID, err)
+		return
+	}
+	if errors.Is(err, services.ErrZipEncryptionUnsupported) {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		log.Printf("Error retrieving encrypted payloads: %v", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", result["content_type"].(string))
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+result["filename"].(string)+"\"")
+	w.Header().Set("Cache-Control", "no-store")
+	if generated {
+		w.Header().Set("X-Depot-Zip-Password", password)
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(result["data"].([]byte))
+}
+
+// writeRestoring tells the client an archived request is being restored and to retry
+func writeRestoring(w http.ResponseWriter, requestID string, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", "30")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":     "restoring",
+		"request_id": requestID,
+		"message":    err.Error(),
+	})
+}
+
+// writeDropped accepts an upload a routing rule discarded, so its sender does not retry
+func writeDropped(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":  "dropped",
+		"message": err.Error(),
+	})
+}
+
+// tooLarge reports whether err comes from a body cut off at the size limit
+func tooLarge(err error) bool {
+	var maxBytes *http.MaxBytesError
+	return errors.As(err, &maxBytes)
+}
+
+// writeTooLarge refuses a body over the size limit
+func writeTooLarge(w http.ResponseWriter, limit int64) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":         fmt.Sprintf("request body exceeds the %d byte limit", limit),
+		"max_body_size": limit,
+	})
+}
+
+// writeStoreFailed reports a synchronous upload storage refused: 503 when no storage
+// endpoint is healthy, so clients retry, and 502 for other storage errors
+func writeStoreFailed(w http.ResponseWriter, failed *services.StoreFailedError) {
+	log.Printf("Error storing payload: %v", failed)
+	status := http.StatusBadGateway
+	if errors.Is(failed, services.ErrNoHealthyEndpoint) {
+		status = http.StatusServiceUnavailable
+		w.Header().Set("Retry-After", "5")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":      failed.Error(),
+		"request_id": failed.RequestID,
+		"failed":     failed.Failed,
+	})
+}
+
+// ListHandler provides an endpoint to list all stored payloads, or the tenant's own
 func (h *HTTPHandler) ListHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	objects, err := h.payloadService.ListAllPayloads()
+	query := r.URL.Query()
+	filter := services.ListFilter{
+		Prefix:      query.Get("prefix"),
+		ContentType: query.Get("content_type"),
+	}
+	var err error
+	if filter.After, err = parseTimeParam(query.Get("after")); err != nil {
+		http.Error(w, "Invalid after timestamp; use RFC3339", http.StatusBadRequest)
+		return
+	}
+	if filter.Before, err = parseTimeParam(query.Get("before")); err != nil {
+		http.Error(w, "Invalid before timestamp; use RFC3339", http.StatusBadRequest)
+		return
+	}
+	// A tenant only lists its own objects, which all start with its prefix
+	filter.Prefix = tenantRequestID(r, filter.Prefix)
+
+	var objects []services.ObjectInfo
+	if lister, ok := h.payloadService.(services.FilteredLister); ok {
+		objects, err = lister.ListPayloadsMatching(filter)
+	} else if filter != (services.ListFilter{}) {
+		http.Error(w, "Filtering the listing is not supported", http.StatusNotImplemented)
+		return
+	} else {
+		var names []string
+		names, err = h.listAllPayloads(r.Context())
+		for _, name := range services.TenantObjects(TenantFromContext(r.Context()), names) {
+			objects = append(objects, services.ObjectInfo{ObjectName: name})
+		}
+	}
 	if err != nil {
-		log.Printf("Error listing payloads: %v", err)
+		services.Logger(r.Context()).Error("listing payloads failed", slog.Any("error", err))
 		http.Error(w, "Error listing payloads", http.StatusInternalServerError)
 		return
 	}
+	if objects == nil {
+		objects = []services.ObjectInfo{}
+	}
 
 	response := h.responseFormatter.FormatListResponse(objects, len(objects))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// parseTags splits a comma-separated tag header into trimmed, non-empty tags
+func parseTags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// isValidCallbackURL accepts absolute http(s) URLs only
+func isValidCallbackURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// LegalHoldHandler places and releases legal holds on the objects of a request
+type LegalHoldHandler struct {
+	holds services.LegalHoldManager
+}
+
+// NewLegalHoldHandler creates a new legal hold handler; holds is nil when the
+// storage backend cannot hold objects
+func NewLegalHoldHandler(holds services.LegalHoldManager) *LegalHoldHandler {
+	return &LegalHoldHandler{
+		holds: holds,
+	}
+}
+
+// LegalHoldHandler serves /legal-hold?request_id=<id>: GET reports the holds, PUT
+// places them and DELETE releases them
+func (h *LegalHoldHandler) LegalHoldHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.holds == nil {
+		http.Error(w, "Legal holds require an object-locked bucket (MINIO_OBJECT_LOCK=true)", http.StatusNotImplemented)
+		return
+	}
+
+	requestID := r.URL.Query().Get("request_id")
+	if requestID == "" {
+		http.Error(w, "Missing request_id query parameter", http.StatusBadRequest)
+		return
+	}
+	requestID = tenantRequestID(r, requestID)
+
+	var objects []services.LegalHoldStatus
+	var err error
+	switch r.Method {
+	case http.MethodPut:
+		objects, err = h.holds.Place(requestID)
+	case http.MethodDelete:
+		objects, err = h.holds.Release(requestID)
+	default:
+		objects, err = h.holds.Status(requestID)
+	}
+	if err != nil {
+		log.Printf("Error updating legal hold of %s: %v", requestID, err)
+		http.Error(w, "Error updating legal hold", http.StatusInternalServerError)
+		return
+	}
+	if len(objects) == 0 {
+		http.Error(w, "no payloads found for request_id", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"request_id": requestID,
+		"objects":    objects,
+	})
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Route priorities used by the load shedder; higher values are shed later
+const (
+	// PriorityLow routes are shed first, once load reaches LowPriorityShedLoad
+	PriorityLow = 0
+	// PriorityNormal routes are shed once the depot is at capacity
+	PriorityNormal = 1
+	// PriorityCritical routes are never shed
+	PriorityCritical = 2
+)
+
+// Load levels at which each priority starts being rejected
+const (
+	LowPriorityShedLoad    = 0.75
+	NormalPriorityShedLoad = 1.0
+)
+
+// latencyHalfLife is how quickly the latency average fades when no requests complete
+const latencyHalfLife = time.Second
+
+// DefaultRoutePriorities sheds read-heavy listing routes before anything else and never sheds ingestion
+var DefaultRoutePriorities = map[string]int{
+	"/list":            PriorityLow,
+	"/find":            PriorityLow,
+	"/query":           PriorityLow,
+	"/export":          PriorityLow,
+	"/depot":           PriorityCritical,
+	"/append":          PriorityCritical,
+	"/webhooks/github": PriorityCritical,
+	"/webhooks/stripe": PriorityCritical,
+}
+
+// LoadShedder rejects lower-priority requests with 503 when the depot is overloaded.
+// Load is the larger of in-flight requests over maxInFlight and the recent average
+// latency over targetLatency.
+type LoadShedder struct {
+	maxInFlight   int64
+	targetLatency time.Duration
+	priorities    map[string]int
+
+	inFlight atomic.Int64
+	shed     atomic.Int64
+
+	mu      sync.Mutex
+	latency float64
+	updated time.Time
+}
+
+// NewLoadShedder creates a shedder; routes missing from priorities are PriorityNormal
+func NewLoadShedder(maxInFlight int, targetLatency time.Duration, priorities map[string]int) *LoadShedder {
+	return &LoadShedder{
+		maxInFlight:   int64(maxInFlight),
+		targetLatency: targetLatency,
+		priorities:    priorities,
+	}
+}
+
+// Wrap returns next guarded by the shedder under the priority configured for route
+func (s *LoadShedder) Wrap(route string, next http.HandlerFunc) http.HandlerFunc {
+	priority, ok := s.priorities[route]
+	if !ok {
+		priority = PriorityNormal
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.shouldShed(priority) {
+			s.shed.Add(1)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Service overloaded, retry later", http.StatusServiceUnavailable)
+			return
+		}
+
+		s.inFlight.Add(1)
+		start := time.Now()
+		defer func() {
+			s.inFlight.Add(-1)
+			s.observe(time.Since(start))
+		}()
+		next(w, r)
+	}
+}
+
+// Load returns the current load, where 1.0 means the depot is at capacity
+func (s *LoadShedder) Load() float64 {
+	load := 0.0
+	if s.maxInFlight > 0 {
+		load = float64(s.inFlight.Load()) / float64(s.maxInFlight)
+	}
+	if s.targetLatency > 0 {
+		load = math.Max(load, s.averageLatency()/float64(s.targetLatency))
+	}
+	return load
+}
+
+// Shed returns how many requests have been rejected
+func (s *LoadShedder) Shed() int64 {
+	return s.shed.Load()
+}
+
+func (s *LoadShedder) shouldShed(priority int) bool {
+	switch {
+	case priority >= PriorityCritical:
+		return false
+	case priority <= PriorityLow:
+		return s.Load() >= LowPriorityShedLoad
+	default:
+		return s.Load() >= NormalPriorityShedLoad
+	}
+}
+
+// observe folds a completed request's latency into the moving average
+func (s *LoadShedder) observe(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = 0.8*s.decayedLatency() + 0.2*float64(latency)
+	s.updated = time.Now()
+}
+
+func (s *LoadShedder) averageLatency() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.decayedLatency()
+}
+
+// decayedLatency fades the average while no requests complete, so shedding stops
+// once the backlog that caused it has drained; callers hold mu
+func (s *LoadShedder) decayedLatency() float64 {
+	if s.updated.IsZero() {
+		return 0
+	}
+	halves := float64(time.Since(s.updated)) / float64(latencyHalfLife)
+	return s.latency * math.Pow(0.5, halves)
+}
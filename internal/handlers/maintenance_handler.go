@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// MaintenanceRoute toggles maintenance mode; it stays writable while the depot is read-only
+const MaintenanceRoute = "/admin/maintenance"
+
+// maxMaintenanceMessage bounds the message accepted when maintenance mode is enabled
+const maxMaintenanceMessage = 1024
+
+// MaintenanceHandler switches the depot between normal and read-only maintenance mode,
+// and refuses writes while it is read-only
+type MaintenanceHandler struct {
+	mode services.MaintenanceSwitch
+}
+
+// NewMaintenanceHandler creates a new maintenance handler with dependencies
+func NewMaintenanceHandler(mode services.MaintenanceSwitch) *MaintenanceHandler {
+	return &MaintenanceHandler{
+		mode: mode,
+	}
+}
+
+// MaintenanceHandler serves /admin/maintenance: GET reports the mode, PUT makes the
+// depot read-only with the request body as the message shown to writers, and DELETE
+// accepts writes again
+func (h *MaintenanceHandler) MaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxMaintenanceMessage+1))
+		if err != nil || len(body) > maxMaintenanceMessage {
+			http.Error(w, "Invalid maintenance message", http.StatusBadRequest)
+			return
+		}
+		h.mode.Enable(strings.TrimSpace(string(body)))
+		log.Printf("Maintenance mode enabled: the depot is read-only")
+	case http.MethodDelete:
+		h.mode.Disable()
+		log.Printf("Maintenance mode disabled: the depot accepts writes again")
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.mode.Status())
+}
+
+// Wrap returns next, refusing every request but reads while the depot is read-only
+func (h *MaintenanceHandler) Wrap(route string, next http.HandlerFunc) http.HandlerFunc {
+	if route == MaintenanceRoute {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if status := h.mode.Status(); status.ReadOnly {
+				writeMaintenance(w, status.Message)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// writeMaintenance answers a write refused during maintenance
+func writeMaintenance(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", "60")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":  "maintenance",
+		"message": message,
+	})
+}
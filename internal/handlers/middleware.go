@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Middleware wraps the handler registered for route
+type Middleware func(route string, next http.HandlerFunc) http.HandlerFunc
+
+// Names of the middleware stages a chain can be ordered with
+const (
+	// MiddlewareLog logs every request with a logger its later lines share; see AccessLog
+	MiddlewareLog = "log"
+	// MiddlewareCORS answers browser preflights and allows cross-origin calls; see CORS
+	MiddlewareCORS = "cors"
+	// MiddlewareAuth requires a bearer token; see BearerAuth
+	MiddlewareAuth = "auth"
+	// MiddlewareTenant scopes requests to their tenant; see TenantScope
+	MiddlewareTenant = "tenant"
+	// MiddlewareRateLimit refuses clients over their request rate; see RateLimiter
+	MiddlewareRateLimit = "ratelimit"
+	// MiddlewareMaintenance refuses writes in read-only mode; see MaintenanceHandler
+	MiddlewareMaintenance = "maintenance"
+	// MiddlewareShed rejects lower-priority requests under overload; see LoadShedder
+	MiddlewareShed = "shed"
+	// MiddlewareUsage charges requests to their namespace; see UsageMeter
+	MiddlewareUsage = "usage"
+	// MiddlewareProvision provisions new namespaces' buckets; see BucketProvisioning
+	MiddlewareProvision = "provision"
+)
+
+// DefaultMiddleware is the stage order used unless the chain is reordered
+var DefaultMiddleware = []string{MiddlewareLog, MiddlewareCORS, MiddlewareAuth, MiddlewareTenant, MiddlewareRateLimit, MiddlewareMaintenance, MiddlewareShed, MiddlewareUsage, MiddlewareProvision}
+
+var knownMiddleware = map[string]bool{
+	MiddlewareLog:         true,
+	MiddlewareCORS:        true,
+	MiddlewareAuth:        true,
+	MiddlewareTenant:      true,
+	MiddlewareRateLimit:   true,
+	MiddlewareMaintenance: true,
+	MiddlewareShed:        true,
+	MiddlewareUsage:       true,
+	MiddlewareProvision:   true,
+}
+
+// MiddlewareChain wraps route handlers in an ordered list of named middleware, the
+// first name outermost. Stages are enabled by registering them; a stage in the order
+// that was never registered is skipped.
+type MiddlewareChain struct {
+	order      []string
+	middleware map[string]Middleware
+}
+
+// NewMiddlewareChain creates a chain with the default order and no stages registered
+func NewMiddlewareChain() *MiddlewareChain {
+	return &MiddlewareChain{
+		order:      DefaultMiddleware,
+		middleware: make(map[string]Middleware),
+	}
+}
+
+// SetOrder replaces the stage order; "none" on its own disables every stage
+func (c *MiddlewareChain) SetOrder(names []string) error {
+	if len(names) == 1 && names[0] == "none" {
+		c.order = []string{}
+		return nil
+	}
+	seen := make(map[string]bool, len(names))
+	order := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !knownMiddleware[name] {
+			return fmt.Errorf("unknown middleware %q", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("middleware %q is listed twice", name)
+		}
+		seen[name] = true
+		order = append(order, name)
+	}
+	c.order = order
+	return nil
+}
+
+// Register enables a stage; it runs at its position in the order
+func (c *MiddlewareChain) Register(name string, middleware Middleware) {
+	c.middleware[name] = middleware
+}
+
+// Active lists the registered stages that run, in order
+func (c *MiddlewareChain) Active() []string {
+	active := []string{}
+	for _, name := range c.order {
+		if c.middleware[name] != nil {
+			active = append(active, name)
+		}
+	}
+	return active
+}
+
+// Wrap returns handler wrapped in every active stage for route
+func (c *MiddlewareChain) Wrap(route string, handler http.HandlerFunc) http.HandlerFunc {
+	for i := len(c.order) - 1; i >= 0; i-- {
+		if middleware := c.middleware[c.order[i]]; middleware != nil {
+			handler = middleware(route, handler)
+		}
+	}
+	return handler
+}
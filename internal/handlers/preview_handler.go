@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// Length bounds for payload previews
+const (
+	defaultPreviewLength = 512
+	maxPreviewLength     = 64 * 1024
+)
+
+// Preview formats accepted by the preview endpoint
+const (
+	previewFormatAuto = "auto"
+	previewFormatText = "text"
+	previewFormatHex  = "hex"
+)
+
+// PreviewHandler serves truncated text and hexdump previews of stored objects
+type PreviewHandler struct {
+	storage   services.StorageService
+	previewer services.PayloadPreviewer
+}
+
+// NewPreviewHandler creates a new preview handler with dependencies
+func NewPreviewHandler(storage services.StorageService, previewer services.PayloadPreviewer) *PreviewHandler {
+	return &PreviewHandler{
+		storage:   storage,
+		previewer: previewer,
+	}
+}
+
+// PreviewHandler returns a text or hexdump preview of a single stored object
+func (h *PreviewHandler) PreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	objectName := query.Get("object")
+	if objectName == "" {
+		http.Error(w, "Missing object query parameter", http.StatusBadRequest)
+		return
+	}
+	objectName = tenantRequestID(r, objectName)
+
+	format := query.Get("format")
+	if format == "" {
+		format = previewFormatAuto
+	}
+	if format != previewFormatAuto && format != previewFormatText && format != previewFormatHex {
+		http.Error(w, "Invalid format; use auto, text or hex", http.StatusBadRequest)
+		return
+	}
+
+	offset, ok := parseNonNegative(query.Get("offset"), 0)
+	if !ok {
+		http.Error(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+	length, ok := parseNonNegative(query.Get("length"), defaultPreviewLength)
+	if !ok {
+		http.Error(w, "Invalid length", http.StatusBadRequest)
+		return
+	}
+	length = min(length, maxPreviewLength)
+
+	data, err := h.storage.GetPayload(objectName)
+	if err != nil {
+		log.Printf("Error loading %s for preview: %v", objectName, err)
+		http.Error(w, "Object not found", http.StatusNotFound)
+		return
+	}
+
+	if format == previewFormatAuto {
+		format = previewFormatText
+		if !utf8.Valid(data[:min(len(data), maxPreviewLength)]) {
+			format = previewFormatHex
+		}
+	}
+
+	response := map[string]any{
+		"object_name": objectName,
+		"format":      format,
+	}
+	if format == previewFormatHex {
+		response["preview"] = h.previewer.Hexdump(data, offset, length)
+	} else {
+		response["preview"] = h.previewer.Preview(data[min(offset, len(data)):], length)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseNonNegative parses an optional non-negative integer query value
+func parseNonNegative(raw string, defaultValue int) (int, bool) {
+	if raw == "" {
+		return defaultValue, true
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		return 0, false
+	}
+	return value, true
+}
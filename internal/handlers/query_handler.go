@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// QueryHandler evaluates expressions against stored JSON payloads server-side
+type QueryHandler struct {
+	storage   services.StorageService
+	evaluator services.JSONQueryEvaluator
+}
+
+// NewQueryHandler creates a new query handler with dependencies
+func NewQueryHandler(storage services.StorageService, evaluator services.JSONQueryEvaluator) *QueryHandler {
+	return &QueryHandler{
+		storage:   storage,
+		evaluator: evaluator,
+	}
+}
+
+// queryResult holds the values an expression produced for one object
+type queryResult struct {
+	ObjectName string `json:"object_name"`
+	Values     []any  `json:"values"`
+}
+
+// QueryHandler runs a jq expression against the JSON payloads of a request,
+// optionally narrowed to one object
+func (h *QueryHandler) QueryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	requestID := query.Get("request_id")
+	expr := query.Get("expr")
+	if requestID == "" || expr == "" {
+		http.Error(w, "Missing request_id or expr query parameter", http.StatusBadRequest)
+		return
+	}
+	// A tenant only queries its own payloads, whose names all start with its prefix
+	requestID = tenantRequestID(r, requestID)
+	objectName := query.Get("object")
+	if objectName != "" {
+		objectName = tenantRequestID(r, objectName)
+	}
+
+	objects, err := h.storage.ListPayloads()
+	if err != nil {
+		log.Printf("Error listing payloads: %v", err)
+		http.Error(w, "Error listing payloads", http.StatusInternalServerError)
+		return
+	}
+
+	results := []queryResult{}
+	for _, obj := range objects {
+		if !services.IsRequestObject(obj, requestID) || (objectName != "" && obj != objectName) {
+			continue
+		}
+		data, err := h.storage.GetPayload(obj)
+		if err != nil {
+			log.Printf("Error getting payload for %s: %v", obj, err)
+			continue
+		}
+		if !json.Valid(data) {
+			continue
+		}
+
+		values, err := h.evaluator.Evaluate(data, expr)
+		if errors.Is(err, services.ErrInvalidQuery) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		results = append(results, queryResult{ObjectName: obj, Values: values})
+	}
+
+	if len(results) == 0 {
+		http.Error(w, "no JSON payloads found for request_id", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"request_id": requestID,
+		"expr":       expr,
+		"results":    results,
+	})
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// QueueHandler reports the backlog of the write-ahead queue
+type QueueHandler struct {
+	queue *services.WriteAheadQueue
+}
+
+// NewQueueHandler creates a new write-ahead queue handler with dependencies
+func NewQueueHandler(queue *services.WriteAheadQueue) *QueueHandler {
+	return &QueueHandler{
+		queue: queue,
+	}
+}
+
+// StatusHandler serves GET /queue/status
+func (h *QueueHandler) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(h.queue.Status())
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rateLimitPruneInterval is how often buckets that have refilled or gone idle are forgotten
+const rateLimitPruneInterval = time.Minute
+
+// rateLimitIdleTimeout is how long a bucket is kept without requests, whatever its rate
+const rateLimitIdleTimeout = 10 * time.Minute
+
+// RateLimiter gives every client a token bucket and refuses its requests with 429
+// once the bucket is empty. A client is the tenant of its API key, else the subject of
+// its verified bearer token, else its IP address; headers nothing has verified are
+// never used, or clients could pick a fresh bucket for every request.
+type RateLimiter struct {
+	rate    float64
+	burst   float64
+	clients map[string]float64
+
+	limited atomic.Int64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	pruned  time.Time
+}
+
+// tokenBucket holds the requests a client may still make, refilled at its rate
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewRateLimiter creates a limiter allowing rate requests per second per client, in
+// bursts of up to burst. clients overrides the rate of single clients, keyed as
+// "tenant:acme", "sub:ci-bot" or "ip:10.0.0.5"; a rate of 0 leaves a client unlimited.
+func NewRateLimiter(rate float64, burst int, clients map[string]float64) *RateLimiter {
+	return &RateLimiter{
+		rate:    rate,
+		burst:   math.Max(float64(burst), 1),
+		clients: clients,
+		buckets: make(map[string]*tokenBucket),
+		pruned:  time.Now(),
+	}
+}
+
+// Wrap returns next limited per client
+func (l *RateLimiter) Wrap(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if wait, ok := l.allow(rateLimitClient(r)); !ok {
+			l.limited.Add(1)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Rate limit exceeded, retry later", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Limited returns how many requests have been refused
+func (l *RateLimiter) Limited() int64 {
+	return l.limited.Load()
+}
+
+// rateLimitClient names the client a request is counted against
+func rateLimitClient(r *http.Request) string {
+	if tenant := keyedTenant(r.Context()); tenant != "" {
+		return "tenant:" + tenant
+	}
+	if claims, ok := TokenClaimsFromContext(r.Context()); ok && claims.Subject != "" {
+		return "sub:" + claims.Subject
+	}
+	return "ip:" + sourceIP(r)
+}
+
+// allow takes a token from client's bucket, or returns how long until one is available
+func (l *RateLimiter) allow(client string) (time.Duration, bool) {
+	rate := l.rate
+	if override, ok := l.clients[client]; ok {
+		rate = override
+	}
+	if rate <= 0 {
+		return 0, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.prune(now)
+	bucket, ok := l.buckets[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[client] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*rate)
+	bucket.updated = now
+	if bucket.tokens < 1 {
+		return time.Duration((1 - bucket.tokens) / rate * float64(time.Second)), false
+	}
+	bucket.tokens--
+	return 0, true
+}
+
+// prune forgets the buckets of clients idle long enough to have refilled, or idle
+// for rateLimitIdleTimeout, so one-off clients do not pile up; callers hold mu
+func (l *RateLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < rateLimitPruneInterval {
+		return
+	}
+	l.pruned = now
+	for client, bucket := range l.buckets {
+		rate := l.rate
+		if override, ok := l.clients[client]; ok {
+			rate = override
+		}
+		idle := now.Sub(bucket.updated)
+		if rate <= 0 || idle >= rateLimitIdleTimeout || bucket.tokens+idle.Seconds()*rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
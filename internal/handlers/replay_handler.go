@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// ReplayHandler re-sends stored payloads to configured forward targets
+type ReplayHandler struct {
+	replayer services.PayloadReplayer
+}
+
+// NewReplayHandler creates a new replay handler with dependencies
+func NewReplayHandler(replayer services.PayloadReplayer) *ReplayHandler {
+	return &ReplayHandler{
+		replayer: replayer,
+	}
+}
+
+// ReplayHandler sends every object of a request to the named target and reports each delivery
+func (h *ReplayHandler) ReplayHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	requestID := r.URL.Query().Get("request_id")
+	target := r.URL.Query().Get("target")
+	if requestID == "" || target == "" {
+		http.Error(w, "Missing request_id or target query parameter", http.StatusBadRequest)
+		return
+	}
+
+	requestID = tenantRequestID(r, requestID)
+	results, err := h.replayer.Replay(requestID, target)
+	if errors.Is(err, services.ErrUnknownTarget) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error replaying %s to %s: %v", requestID, target, err)
+		http.Error(w, "Error replaying payloads", http.StatusInternalServerError)
+		return
+	}
+	if len(results) == 0 {
+		http.Error(w, "no payloads found for request_id", http.StatusNotFound)
+		return
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Status == services.DeliveryFailed {
+			failed++
+		}
+	}
+
+	status := http.StatusOK
+	if failed > 0 {
+		status = http.StatusBadGateway
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"request_id": requestID,
+		"target":     target,
+		"deliveries": results,
+		"failed":     failed,
+	})
+}
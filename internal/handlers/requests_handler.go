@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// Limits for the request log listing
+const (
+	defaultRequestsLimit = 100
+	maxRequestsLimit     = 1000
+)
+
+// RequestsHandler serves the request log: when, from where and with which headers
+// each upload arrived, and whether its objects reached storage
+type RequestsHandler struct {
+	requests services.RequestLog
+}
+
+// NewRequestsHandler creates a new request log handler with dependencies
+func NewRequestsHandler(requests services.RequestLog) *RequestsHandler {
+	return &RequestsHandler{
+		requests: requests,
+	}
+}
+
+// RequestsHandler serves GET /requests?request_id=<id> for one request, or
+// GET /requests?prefix=<prefix>&limit=<n> for the most recent requests, newest first
+func (h *RequestsHandler) RequestsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	if requestID := query.Get("request_id"); requestID != "" {
+		record, ok := h.requests.GetRequest(tenantRequestID(r, requestID))
+		if !ok {
+			http.Error(w, "unknown request_id", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(record)
+		return
+	}
+
+	limit := defaultRequestsLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxRequestsLimit)
+	}
+
+	requests := h.requests.ListRequests(tenantRequestID(r, query.Get("prefix")), limit)
+	if requests == nil {
+		requests = []services.RequestRecord{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"requests": requests,
+		"count":    len(requests),
+	})
+}
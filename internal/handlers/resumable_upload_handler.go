@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// Headers of the resumable upload protocol, named as in tus
+const (
+	uploadOffsetHeader = "Upload-Offset"
+	uploadLengthHeader = "Upload-Length"
+)
+
+// ResumableUploadHandler serves upload sessions that take a payload in sequential
+// chunks, so a client can resume a large upload after its connection drops
+type ResumableUploadHandler struct {
+	uploads           *services.ResumableUploads
+	filenameExtractor services.FilenameExtractor
+	responseFormatter services.ResponseFormatter
+	policy            services.AdmissionPolicy
+	maxBodySize       int64
+}
+
+// NewResumableUploadHandler creates a new resumable upload handler with dependencies
+func NewResumableUploadHandler(uploads *services.ResumableUploads, filenameExtractor services.FilenameExtractor, responseFormatter services.ResponseFormatter) *ResumableUploadHandler {
+	return &ResumableUploadHandler{
+		uploads:           uploads,
+		filenameExtractor: filenameExtractor,
+		responseFormatter: responseFormatter,
+	}
+}
+
+// SetAdmissionPolicy has policy accept or reject every session before it is created
+func (h *ResumableUploadHandler) SetAdmissionPolicy(policy services.AdmissionPolicy) {
+	h.policy = policy
+}
+
+// SetMaxBodySize bounds the whole payload of a session; 0 leaves it unbounded
+func (h *ResumableUploadHandler) SetMaxBodySize(limit int64) {
+	h.maxBodySize = limit
+}
+
+// CreateHandler serves POST /uploads, opening a session for one payload described
+// by the request's headers, as for /depot
+func (h *ResumableUploadHandler) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	length := int64(-1)
+	if declared := r.Header.Get(uploadLengthHeader); declared != "" {
+		var err error
+		if length, err = strconv.ParseInt(declared, 10, 64); err != nil || length < 0 {
+			http.Error(w, "Invalid "+uploadLengthHeader, http.StatusBadRequest)
+			return
+		}
+	}
+	if h.maxBodySize > 0 && length > h.maxBodySize {
+		writeTooLarge(w, h.maxBodySize)
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	filename := h.filenameExtractor.Extract(r.Header.Get("Content-Disposition"))
+	opts := services.StoreOptions{
+		Tags:      parseTags(r.Header.Get("X-Depot-Tags")),
+		RequestID: r.Header.Get("X-Depot-Request-Id"),
+		Source:    r.URL.Path,
+		Headers:   r.Header,
+		SourceIP:  sourceIP(r),
+		Query:     r.URL.RawQuery,
+		Tenant:    TenantFromContext(r.Context()),
+	}
+	if opts.RequestID == "" {
+		opts.RequestID = r.URL.Query().Get("request_id")
+	}
+	if opts.RequestID != "" {
+		opts.RequestID = services.TenantRequestID(opts.Tenant, opts.RequestID)
+	}
+	if !admit(w, h.policy, admissionInput(r, filename, opts.RequestID, opts.Tags)) {
+		return
+	}
+
+	upload, err := h.uploads.Create(contentType, filename, length, opts)
+	if err != nil {
+		log.Printf("Error creating upload session: %v", err)
+		http.Error(w, "Error creating upload session", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", "/uploads/"+upload.ID)
+	writeUpload(w, http.StatusCreated, upload)
+}
+
+// SessionHandler serves one session under /uploads/<id>: HEAD or GET for its offset,
+// PATCH or PUT to send the chunk at Upload-Offset, DELETE to abort it, and
+// POST /uploads/<id>/complete to store the payload
+func (h *ResumableUploadHandler) SessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, complete := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/uploads/"), "/complete")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	id = tenantRequestID(r, id)
+
+	switch {
+	case complete && r.Method == http.MethodPost:
+		h.complete(w, id)
+	case complete:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		upload, err := h.uploads.Get(id)
+		if err != nil {
+			writeUploadError(w, upload, err)
+			return
+		}
+		writeUpload(w, http.StatusOK, upload)
+	case r.Method == http.MethodPatch || r.Method == http.MethodPut:
+		h.write(w, r, id)
+	case r.Method == http.MethodDelete:
+		if err := h.uploads.Abort(id); err != nil {
+			writeUploadError(w, services.ResumableUpload{}, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// write appends the request body to a session at the offset the client declares
+func (h *ResumableUploadHandler) write(w http.ResponseWriter, r *http.Request, id string) {
+	defer r.Body.Close()
+	offset, err := strconv.ParseInt(r.Header.Get(uploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Missing or invalid "+uploadOffsetHeader, http.StatusBadRequest)
+		return
+	}
+	if h.maxBodySize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, max(h.maxBodySize-offset, 0))
+	}
+
+	upload, err := h.uploads.Write(id, offset, r.Body)
+	if tooLarge(err) {
+		h.uploads.Abort(id)
+		writeTooLarge(w, h.maxBodySize)
+		return
+	}
+	if err != nil {
+		writeUploadError(w, upload, err)
+		return
+	}
+	writeUpload(w, http.StatusOK, upload)
+}
+
+// complete stores a session's payload and answers as /depot does
+func (h *ResumableUploadHandler) complete(w http.ResponseWriter, id string) {
+	reqTime := time.Now().Format(time.RFC3339)
+	result, err := h.uploads.Complete(id)
+	if errors.Is(err, services.ErrUnknownUpload) || errors.Is(err, services.ErrUploadIncomplete) || errors.Is(err, services.ErrUploadBusy) {
+		writeUploadError(w, services.ResumableUpload{}, err)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	size := 0
+	filename := ""
+	for _, object := range result.Objects {
+		size += object.Size
+		filename = object.OriginalFilename
+	}
+	if len(result.Objects) != 1 {
+		filename = ""
+	}
+	log.Printf("[%s] Completed upload session %s, payload size: %d bytes, request_id: %s", reqTime, id, size, result.RequestID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.responseFormatter.FormatDepotResponse(result, size, reqTime, filename))
+}
+
+// writeUpload reports a session's state, with its offset also in Upload-Offset
+func writeUpload(w http.ResponseWriter, status int, upload services.ResumableUpload) {
+	w.Header().Set(uploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+	if upload.Length >= 0 {
+		w.Header().Set(uploadLengthHeader, strconv.FormatInt(upload.Length, 10))
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(upload)
+}
+
+// writeUploadError answers a failed session request. Errors the client can resume
+// from carry the session's offset.
+func writeUploadError(w http.ResponseWriter, upload services.ResumableUpload, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrUnknownUpload):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrOffsetMismatch), errors.Is(err, services.ErrUploadBusy), errors.Is(err, services.ErrUploadIncomplete):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrUploadTooLong):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrReadOnly):
+		writeMaintenance(w, err.Error())
+		return
+	case errors.Is(err, services.ErrInvalidRequestID):
+		status = http.StatusBadRequest
+	default:
+		log.Printf("Error receiving upload chunk for %s: %v", upload.ID, err)
+	}
+	if upload.ID != "" {
+		w.Header().Set(uploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+	}
+	http.Error(w, err.Error(), status)
+}
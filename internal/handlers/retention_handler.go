@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// RetentionHandler extends the retention of the objects of a request
+type RetentionHandler struct {
+	retention services.RetentionManager
+}
+
+// NewRetentionHandler creates a new retention handler; retention is nil when the
+// storage backend cannot retain objects
+func NewRetentionHandler(retention services.RetentionManager) *RetentionHandler {
+	return &RetentionHandler{
+		retention: retention,
+	}
+}
+
+// RetentionHandler serves /admin/retention?request_id=<id>: GET reports the retention,
+// POST extends it to ?until=<RFC3339> or by ?extend=<duration> from now
+func (h *RetentionHandler) RetentionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.retention == nil {
+		http.Error(w, "Retention requires an object-locked bucket (MINIO_OBJECT_LOCK=true)", http.StatusNotImplemented)
+		return
+	}
+
+	query := r.URL.Query()
+	requestID := query.Get("request_id")
+	if requestID == "" {
+		http.Error(w, "Missing request_id query parameter", http.StatusBadRequest)
+		return
+	}
+	requestID = tenantRequestID(r, requestID)
+
+	var objects []services.RetentionStatus
+	var err error
+	if r.Method == http.MethodGet {
+		objects, err = h.retention.Status(requestID)
+	} else {
+		until, parseErr := parseRetainUntil(query.Get("until"), query.Get("extend"))
+		if parseErr != nil {
+			http.Error(w, parseErr.Error(), http.StatusBadRequest)
+			return
+		}
+		objects, err = h.retention.Extend(requestID, until)
+	}
+	if errors.Is(err, services.ErrRetentionShortened) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]any{
+			"error":      err.Error(),
+			"request_id": requestID,
+			"objects":    objects,
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating retention of %s: %v", requestID, err)
+		http.Error(w, "Error updating retention", http.StatusInternalServerError)
+		return
+	}
+	if len(objects) == 0 {
+		http.Error(w, "no payloads found for request_id", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"request_id": requestID,
+		"objects":    objects,
+	})
+}
+
+// parseRetainUntil reads an absolute retention date or a duration from now; the
+// result must lie in the future
+func parseRetainUntil(until, extend string) (time.Time, error) {
+	var retainUntil time.Time
+	switch {
+	case until != "" && extend != "":
+		return time.Time{}, errors.New("use either until or extend, not both")
+	case until != "":
+		parsed, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return time.Time{}, errors.New("until must be an RFC 3339 timestamp")
+		}
+		retainUntil = parsed
+	case extend != "":
+		duration, err := time.ParseDuration(extend)
+		if err != nil || duration <= 0 {
+			return time.Time{}, errors.New("extend must be a positive duration such as 720h")
+		}
+		retainUntil = time.Now().Add(duration)
+	default:
+		return time.Time{}, errors.New("missing until or extend query parameter")
+	}
+	if !retainUntil.After(time.Now()) {
+		return time.Time{}, errors.New("retention must end in the future")
+	}
+	return retainUntil, nil
+}
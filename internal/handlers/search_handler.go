@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// SearchHandler handles lookups against the metadata index
+type SearchHandler struct {
+	index             services.MetadataIndex
+	responseFormatter services.ResponseFormatter
+}
+
+// NewSearchHandler creates a new search handler with dependencies
+func NewSearchHandler(index services.MetadataIndex, responseFormatter services.ResponseFormatter) *SearchHandler {
+	return &SearchHandler{
+		index:             index,
+		responseFormatter: responseFormatter,
+	}
+}
+
+// FindHandler returns the stored objects whose content matches a SHA-256 checksum
+func (h *SearchHandler) FindHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sum := strings.ToLower(r.URL.Query().Get("sha256"))
+	if sum == "" {
+		http.Error(w, "Missing sha256 query parameter", http.StatusBadRequest)
+		return
+	}
+	if decoded, err := hex.DecodeString(sum); err != nil || len(decoded) != 32 {
+		http.Error(w, "Invalid sha256 checksum", http.StatusBadRequest)
+		return
+	}
+
+	records := services.TenantRecords(TenantFromContext(r.Context()), h.index.FindBySHA256(sum))
+	response := h.responseFormatter.FormatFindResponse(sum, records)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// StatsHandler reports storage statistics and the state of maintenance jobs
+type StatsHandler struct {
+	stats     services.StatsProvider
+	jobs      services.JobStatusReporter
+	dropped   services.DropCounter
+	sensitive services.SensitiveStatsReporter
+	faults    services.FaultCounter
+}
+
+// NewStatsHandler creates a new stats handler with dependencies
+func NewStatsHandler(stats services.StatsProvider, jobs services.JobStatusReporter) *StatsHandler {
+	return &StatsHandler{
+		stats: stats,
+		jobs:  jobs,
+	}
+}
+
+// SetDropCounter adds the uploads routing rules dropped to the stats
+func (h *StatsHandler) SetDropCounter(dropped services.DropCounter) {
+	h.dropped = dropped
+}
+
+// SetSensitiveStats adds the payloads flagged as holding sensitive data to the stats
+func (h *StatsHandler) SetSensitiveStats(sensitive services.SensitiveStatsReporter) {
+	h.sensitive = sensitive
+}
+
+// SetFaultCounter adds the storage faults injected in chaos mode to the stats
+func (h *StatsHandler) SetFaultCounter(faults services.FaultCounter) {
+	h.faults = faults
+}
+
+// StatsHandler serves /stats with the latest storage rollup and every job's last run
+func (h *StatsHandler) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats := map[string]any{
+		"storage": h.stats.Latest(),
+		"jobs":    h.jobs.Status(),
+	}
+	if h.dropped != nil {
+		stats["dropped"] = h.dropped.Dropped()
+	}
+	if h.sensitive != nil {
+		stats["sensitive"] = h.sensitive.Stats()
+	}
+	if h.faults != nil {
+		stats["faults"] = h.faults.Faults()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
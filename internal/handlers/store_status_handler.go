@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// StoreStatusHandler reports whether the objects of an upload have reached storage
+type StoreStatusHandler struct {
+	statuses *services.StoreStatusTracker
+}
+
+// NewStoreStatusHandler creates a new storage status handler with dependencies
+func NewStoreStatusHandler(statuses *services.StoreStatusTracker) *StoreStatusHandler {
+	return &StoreStatusHandler{
+		statuses: statuses,
+	}
+}
+
+// StatusHandler serves GET /status?request_id=<id>
+func (h *StoreStatusHandler) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	requestID := r.URL.Query().Get("request_id")
+	if requestID == "" {
+		http.Error(w, "Missing request_id query parameter", http.StatusBadRequest)
+		return
+	}
+
+	status, ok := h.statuses.Status(tenantRequestID(r, requestID))
+	if !ok {
+		http.Error(w, "unknown request_id", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// maxTailPreview caps the preview length clients may request from live tails
+const maxTailPreview = 64 * 1024
+
+// defaultWatchPreview is the preview length /ws sends when the client names none
+const defaultWatchPreview = 1024
+
+// tailFilter selects which stored payloads a live tail client receives
+type tailFilter struct {
+	prefix        string
+	contentType   string
+	tag           string
+	preview       int
+	previewFormat string
+}
+
+// tailMessage is the JSON message pushed to live tail clients
+type tailMessage struct {
+	Type    string                   `json:"type"`
+	Cursor  int64                    `json:"cursor"`
+	Time    time.Time                `json:"time"`
+	Object  services.ObjectRecord    `json:"object"`
+	Preview *services.PayloadPreview `json:"preview,omitempty"`
+}
+
+// parseTailFilter reads prefix, content_type, tag, preview and preview_format query parameters
+func parseTailFilter(query url.Values) (tailFilter, bool) {
+	return parseTailFilterWithPreview(query, 0)
+}
+
+// parseTailFilterWithPreview is parseTailFilter previewing preview bytes unless the
+// query says otherwise
+func parseTailFilterWithPreview(query url.Values, preview int) (tailFilter, bool) {
+	filter := tailFilter{
+		prefix:        query.Get("prefix"),
+		contentType:   query.Get("content_type"),
+		tag:           query.Get("tag"),
+		preview:       preview,
+		previewFormat: query.Get("preview_format"),
+	}
+	if filter.previewFormat != "" && filter.previewFormat != previewFormatText && filter.previewFormat != previewFormatHex {
+		return filter, false
+	}
+	if raw := query.Get("preview"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			return filter, false
+		}
+		filter.preview = min(parsed, maxTailPreview)
+	}
+	return filter, true
+}
+
+func (f tailFilter) matches(event services.ChangeEvent) bool {
+	if event.Type != services.ChangeStored {
+		return false
+	}
+	object := event.Object
+	if f.prefix != "" && !strings.HasPrefix(object.RequestID, f.prefix) && !strings.HasPrefix(object.ObjectName, f.prefix) {
+		return false
+	}
+	if f.contentType != "" && !strings.HasPrefix(object.ContentType, f.contentType) {
+		return false
+	}
+	if f.tag != "" && !slices.Contains(object.Tags, f.tag) {
+		return false
+	}
+	return true
+}
+
+// buildTailMessage converts an event into a tail message, fetching a preview if requested
+func (h *FeedHandler) buildTailMessage(event services.ChangeEvent, filter tailFilter) tailMessage {
+	message := tailMessage{
+		Type:   event.Type,
+		Cursor: event.Cursor,
+		Time:   event.Time,
+		Object: event.Object,
+	}
+	if filter.preview > 0 {
+		data, err := h.storage.GetPayload(event.Object.ObjectName)
+		if err != nil {
+			log.Printf("Error loading preview for %s: %v", event.Object.ObjectName, err)
+			return message
+		}
+		preview := h.previewer.Preview(data, filter.preview)
+		if filter.previewFormat == previewFormatHex {
+			preview = services.PayloadPreview{
+				Size:      len(data),
+				Truncated: len(data) > filter.preview,
+				Hexdump:   h.previewer.Hexdump(data, 0, filter.preview).Text,
+			}
+		}
+		message.Preview = &preview
+	}
+	return message
+}
+
+// TailHandler streams a JSON message over WebSocket for every stored payload
+// matching the optional prefix, content_type and tag filters
+func (h *FeedHandler) TailHandler(w http.ResponseWriter, r *http.Request) {
+	h.serveTail(w, r, 0)
+}
+
+// WatchHandler is TailHandler previewing the first KiB of every payload by default,
+// so a browser or websocat can watch webhooks arrive, bodies included, without
+// further requests. preview=0 turns the preview off.
+func (h *FeedHandler) WatchHandler(w http.ResponseWriter, r *http.Request) {
+	h.serveTail(w, r, defaultWatchPreview)
+}
+
+// serveTail upgrades the request to a WebSocket streaming the filtered tail
+func (h *FeedHandler) serveTail(w http.ResponseWriter, r *http.Request, preview int) {
+	filter, ok := parseTailFilterWithPreview(r.URL.Query(), preview)
+	if !ok {
+		http.Error(w, "Invalid preview length or format", http.StatusBadRequest)
+		return
+	}
+	filter.prefix = tenantRequestID(r, filter.prefix)
+
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		h.streamTail(ws, filter)
+	}}
+	server.ServeHTTP(w, r)
+}
+
+func (h *FeedHandler) streamTail(ws *websocket.Conn, filter tailFilter) {
+	events, cancel := h.feed.Subscribe()
+	defer cancel()
+
+	// Clients only listen; any read error means the connection is gone
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, ws)
+		close(closed)
+	}()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if !filter.matches(event) {
+				continue
+			}
+			if err := websocket.JSON.Send(ws, h.buildTailMessage(event, filter)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// DefaultAPIKeyHeader carries the API key a request's tenant is looked up by
+const DefaultAPIKeyHeader = "X-Api-Key"
+
+type tenantContextKey struct{}
+
+// keyedTenantContextKey marks tenants resolved from a known API key, rather than
+// taken from the tenant header as sent
+type keyedTenantContextKey struct{}
+
+// WithTenant returns ctx carrying the tenant a request is made for
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant a request is made for, or "" without tenants
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenant
+}
+
+// keyedTenant returns the tenant a request's API key belongs to, or "" when the
+// tenant, if any, came from the unverified tenant header
+func keyedTenant(ctx context.Context) string {
+	tenant, _ := ctx.Value(keyedTenantContextKey{}).(string)
+	return tenant
+}
+
+// tenantRequestID scopes a client-given request ID to the request's tenant
+func tenantRequestID(r *http.Request, requestID string) string {
+	return services.TenantRequestID(TenantFromContext(r.Context()), requestID)
+}
+
+// TenantScope resolves the tenant of every request, from its API key or else from
+// a tenant header, and refuses requests without one. Exempt routes, such as signed
+// webhooks, pass without a tenant.
+type TenantScope struct {
+	header  string
+	apiKeys map[string]string
+	exempt  map[string]bool
+}
+
+// NewTenantScope creates the middleware; apiKeys maps each API key to its tenant,
+// and header may be empty to accept API keys only
+func NewTenantScope(header string, apiKeys map[string]string, exemptRoutes []string) *TenantScope {
+	exempt := make(map[string]bool, len(exemptRoutes))
+	for _, route := range exemptRoutes {
+		exempt[route] = true
+	}
+	return &TenantScope{
+		header:  header,
+		apiKeys: apiKeys,
+		exempt:  exempt,
+	}
+}
+
+// Wrap returns next with the request's tenant attached to its context
+func (s *TenantScope) Wrap(route string, next http.HandlerFunc) http.HandlerFunc {
+	if s.exempt[route] {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		var tenant string
+		ctx := r.Context()
+		if key := r.Header.Get(DefaultAPIKeyHeader); key != "" {
+			var ok bool
+			if tenant, ok = s.apiKeys[key]; !ok {
+				http.Error(w, "Unknown API key", http.StatusUnauthorized)
+				return
+			}
+			ctx = context.WithValue(ctx, keyedTenantContextKey{}, tenant)
+		} else if s.header != "" {
+			tenant = r.Header.Get(s.header)
+		}
+		if tenant == "" {
+			http.Error(w, "A tenant is required", http.StatusUnauthorized)
+			return
+		}
+		if !services.ValidTenant(tenant) {
+			http.Error(w, "Invalid tenant", http.StatusBadRequest)
+			return
+		}
+		services.AddLogAttrs(ctx, slog.String("tenant", tenant))
+		next(w, r.WithContext(WithTenant(ctx, tenant)))
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// UploadHandler reports the progress of running and recently finished uploads
+type UploadHandler struct {
+	uploads *services.UploadTracker
+}
+
+// NewUploadHandler creates a new upload progress handler with dependencies
+func NewUploadHandler(uploads *services.UploadTracker) *UploadHandler {
+	return &UploadHandler{
+		uploads: uploads,
+	}
+}
+
+// ProgressHandler serves GET /upload/<session>/progress
+func (h *UploadHandler) ProgressHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/upload/"), "/progress")
+	if !ok || session == "" || strings.Contains(session, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	progress, ok := h.uploads.Progress(tenantRequestID(r, session))
+	if !ok {
+		http.Error(w, "unknown upload session", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(progress)
+}
+
+// statusRecorder remembers the status a handler responded with
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// err describes an error response, or returns nil for a successful one
+func (s *statusRecorder) err() error {
+	if s.status < http.StatusBadRequest {
+		return nil
+	}
+	return errors.New(http.StatusText(s.status))
+}
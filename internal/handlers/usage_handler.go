@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// UsageHandler exports per-namespace usage for charging storage back to its users
+type UsageHandler struct {
+	usage services.UsageReporter
+}
+
+// NewUsageHandler creates a new usage handler with dependencies
+func NewUsageHandler(usage services.UsageReporter) *UsageHandler {
+	return &UsageHandler{
+		usage: usage,
+	}
+}
+
+// UsageHandler serves /usage?month=YYYY-MM&format=json|csv, defaulting to the current
+// month as JSON
+func (h *UsageHandler) UsageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.usage == nil {
+		http.Error(w, "Usage accounting requires DEPOT_NAMESPACE_HEADER", http.StatusNotImplemented)
+		return
+	}
+
+	query := r.URL.Query()
+	month := query.Get("month")
+	if month == "" {
+		month = time.Now().UTC().Format(services.UsageMonthFormat)
+	} else if _, err := time.Parse(services.UsageMonthFormat, month); err != nil {
+		http.Error(w, "Invalid month; use YYYY-MM", http.StatusBadRequest)
+		return
+	}
+	records := h.usage.Usage(month)
+
+	switch query.Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"month":      month,
+			"namespaces": records,
+		})
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"usage_"+month+".csv\"")
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"namespace", "month", "requests", "bytes_stored", "bytes_downloaded"})
+		for _, record := range records {
+			writer.Write([]string{
+				record.Namespace,
+				record.Month,
+				strconv.FormatInt(record.Requests, 10),
+				strconv.FormatInt(record.BytesStored, 10),
+				strconv.FormatInt(record.BytesDownloaded, 10),
+			})
+		}
+		writer.Flush()
+	default:
+		http.Error(w, "Invalid format; use json or csv", http.StatusBadRequest)
+	}
+}
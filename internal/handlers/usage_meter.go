@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// DefaultNamespaceHeader names the namespace a request is made on behalf of
+const DefaultNamespaceHeader = "X-Depot-Namespace"
+
+// UsageStoreRoutes are the routes whose request bodies count as bytes stored; every
+// other route's responses count as bytes downloaded
+var UsageStoreRoutes = map[string]bool{
+	"/depot":           true,
+	"/append":          true,
+	"/webhooks/github": true,
+	"/webhooks/stripe": true,
+}
+
+// UsageMeter charges every request to the namespace named in a header. Bytes are
+// only charged for successful requests.
+type UsageMeter struct {
+	header   string
+	recorder services.UsageRecorder
+}
+
+// NewUsageMeter creates a meter reading the namespace from header
+func NewUsageMeter(header string, recorder services.UsageRecorder) *UsageMeter {
+	if header == "" {
+		header = DefaultNamespaceHeader
+	}
+	return &UsageMeter{
+		header:   header,
+		recorder: recorder,
+	}
+}
+
+// Wrap returns next with its requests charged to their namespace
+func (m *UsageMeter) Wrap(route string, next http.HandlerFunc) http.HandlerFunc {
+	stores := UsageStoreRoutes[route]
+	return func(w http.ResponseWriter, r *http.Request) {
+		namespace := r.Header.Get(m.header)
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil {
+			r.Body = body
+		}
+		counted := &countingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next(counted, r)
+
+		var stored, downloaded int64
+		if counted.status < 300 {
+			if stores {
+				stored = body.n
+			} else {
+				downloaded = counted.n
+			}
+		}
+		m.recorder.RecordUsage(namespace, time.Now(), stored, downloaded)
+	}
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type countingResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	n           int64
+}
+
+func (c *countingResponseWriter) WriteHeader(status int) {
+	if !c.wroteHeader {
+		c.status = status
+		c.wroteHeader = true
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *countingResponseWriter) Write(p []byte) (int, error) {
+	c.wroteHeader = true
+	n, err := c.ResponseWriter.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (c *countingResponseWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// Metadata keys recording the GitHub delivery a payload came from
+const (
+	MetadataGitHubEvent      = "Github-Event"
+	MetadataGitHubDelivery   = "Github-Delivery"
+	MetadataGitHubRepository = "Github-Repository"
+	MetadataGitHubAction     = "Github-Action"
+)
+
+// Metadata keys recording the Stripe event a payload holds
+const (
+	MetadataStripeEventID   = "Stripe-Event-Id"
+	MetadataStripeEventType = "Stripe-Event-Type"
+	MetadataStripeLivemode  = "Stripe-Livemode"
+)
+
+// WebhookHandler receives webhooks from known providers, verifying their signatures
+// and recording provider fields as tags and object metadata
+type WebhookHandler struct {
+	payloadService    services.PayloadService
+	responseFormatter services.ResponseFormatter
+	policy            services.AdmissionPolicy
+	githubSecret      string
+	stripeSecret      string
+	stripeTolerance   time.Duration
+	maxBodySize       int64
+}
+
+// NewWebhookHandler creates a new webhook handler with dependencies
+func NewWebhookHandler(payloadService services.PayloadService, responseFormatter services.ResponseFormatter) *WebhookHandler {
+	return &WebhookHandler{
+		payloadService:    payloadService,
+		responseFormatter: responseFormatter,
+	}
+}
+
+// SetAdmissionPolicy has policy accept or reject every webhook before its body is read
+func (h *WebhookHandler) SetAdmissionPolicy(policy services.AdmissionPolicy) {
+	h.policy = policy
+}
+
+// SetGitHubSecret sets the secret GitHub webhooks are signed with
+func (h *WebhookHandler) SetGitHubSecret(secret string) {
+	h.githubSecret = secret
+}
+
+// SetStripeSecret sets the endpoint secret Stripe webhooks are signed with, and how
+// far their signature timestamp may be from now
+func (h *WebhookHandler) SetStripeSecret(secret string, tolerance time.Duration) {
+	h.stripeSecret = secret
+	h.stripeTolerance = tolerance
+}
+
+// SetMaxBodySize refuses webhook bodies larger than maxBodySize bytes with 413 before
+// their signature is checked; 0 accepts any size
+func (h *WebhookHandler) SetMaxBodySize(maxBodySize int64) {
+	h.maxBodySize = maxBodySize
+}
+
+// GitHubHandler stores a GitHub webhook delivery signed with X-Hub-Signature-256 under
+// github/<repo>/<event>/. The delivery ID becomes the request ID, so redeliveries
+// overwrite the first copy, and the payload is tagged github, github/<repo> and
+// github/<repo>/<event>.
+func (h *WebhookHandler) GitHubHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	event := r.Header.Get("X-GitHub-Event")
+	if event == "" {
+		http.Error(w, "Missing X-GitHub-Event header", http.StatusBadRequest)
+		return
+	}
+	delivery := r.Header.Get("X-GitHub-Delivery")
+	if !admit(w, h.policy, admissionInput(r, event+".json", delivery, []string{"github"})) {
+		return
+	}
+
+	body, ok := h.readBody(w, r)
+	if !ok {
+		return
+	}
+	if !validGitHubSignature(h.githubSecret, body, r.Header.Get("X-Hub-Signature-256")) {
+		services.Logger(r.Context()).Warn("GitHub webhook rejected: invalid signature", slog.String("delivery", delivery))
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	// Form-encoded deliveries carry the JSON payload in the payload field
+	payload := body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		form, err := url.ParseQuery(string(body))
+		if err != nil || form.Get("payload") == "" {
+			http.Error(w, "Missing payload form field", http.StatusBadRequest)
+			return
+		}
+		payload = []byte(form.Get("payload"))
+	}
+	var fields struct {
+		Action     string `json:"action"`
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	opts := services.StoreOptions{
+		RequestID:    delivery,
+		ObjectPrefix: "github/" + event + "/",
+		Tags:         []string{"github"},
+		Source:       r.URL.Path,
+		Headers:      r.Header,
+		SourceIP:     sourceIP(r),
+		Query:        r.URL.RawQuery,
+		Context:      r.Context(),
+		Metadata: map[string]string{
+			MetadataGitHubEvent:    event,
+			MetadataGitHubDelivery: delivery,
+		},
+	}
+	if repo := fields.Repository.FullName; repo != "" {
+		opts.ObjectPrefix = "github/" + repo + "/" + event + "/"
+		opts.Tags = append(opts.Tags, "github/"+repo, "github/"+repo+"/"+event)
+		opts.Metadata[MetadataGitHubRepository] = repo
+	}
+	if fields.Action != "" {
+		opts.Metadata[MetadataGitHubAction] = fields.Action
+	}
+	h.store(w, payload, event+".json", opts)
+}
+
+// StripeHandler stores a Stripe event whose Stripe-Signature is valid and recent. The
+// event ID becomes the request ID, and an event that was already stored is answered
+// as a duplicate without storing it again, so Stripe's retries are harmless.
+func (h *WebhookHandler) StripeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !admit(w, h.policy, admissionInput(r, "", "", []string{"stripe"})) {
+		return
+	}
+
+	body, ok := h.readBody(w, r)
+	if !ok {
+		return
+	}
+	if err := verifyStripeSignature(h.stripeSecret, body, r.Header.Get("Stripe-Signature"), h.stripeTolerance, time.Now()); err != nil {
+		services.Logger(r.Context()).Warn("Stripe webhook rejected", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var event struct {
+		ID       string `json:"id"`
+		Type     string `json:"type"`
+		Livemode bool   `json:"livemode"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil || event.ID == "" || event.Type == "" {
+		http.Error(w, "Invalid Stripe event", http.StatusBadRequest)
+		return
+	}
+
+	opts := services.StoreOptions{
+		// Event IDs look like evt_1NG8Du2eZvKYlo2C; request IDs cannot hold underscores
+		RequestID:   strings.ReplaceAll(event.ID, "_", "-"),
+		IfNoneMatch: true,
+		Tags:        []string{"stripe", "stripe/" + event.Type},
+		Source:      r.URL.Path,
+		Headers:     r.Header,
+		SourceIP:    sourceIP(r),
+		Query:       r.URL.RawQuery,
+		Context:     r.Context(),
+		Metadata: map[string]string{
+			MetadataStripeEventID:   event.ID,
+			MetadataStripeEventType: event.Type,
+			MetadataStripeLivemode:  strconv.FormatBool(event.Livemode),
+		},
+	}
+	h.store(w, body, event.Type+".json", opts)
+}
+
+// store saves a verified webhook payload and responds like /depot. Payloads stored
+// with IfNoneMatch whose request ID already exists are answered as duplicates.
+func (h *WebhookHandler) store(w http.ResponseWriter, payload []byte, filename string, opts services.StoreOptions) {
+	reqTime := time.Now().Format(time.RFC3339)
+	result, err := h.payloadService.StorePayload(payload, "application/json", filename, opts)
+	var exists *services.PayloadExistsError
+	if errors.As(err, &exists) {
+		services.LoggerWith(opts.Context, slog.String("request_id", exists.RequestID)).Info("webhook is a duplicate", slog.String("filename", filename))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"duplicate":  true,
+			"request_id": exists.RequestID,
+			"objects":    exists.Objects,
+		})
+		return
+	}
+	if errors.Is(err, services.ErrPayloadDropped) {
+		writeDropped(w, err)
+		return
+	}
+	if errors.Is(err, services.ErrReadOnly) {
+		writeMaintenance(w, err.Error())
+		return
+	}
+	if errors.Is(err, services.ErrInvalidRequestID) || errors.Is(err, services.ErrInvalidObjectPrefix) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, services.ErrPayloadRejected) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		services.Logger(opts.Context).Error("storing webhook failed", slog.Any("error", err))
+		http.Error(w, "Error storing payload", http.StatusInternalServerError)
+		return
+	}
+	services.LoggerWith(opts.Context, slog.String("request_id", result.RequestID)).Info("webhook stored", slog.String("filename", filename), slog.Int("size", len(payload)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.responseFormatter.FormatDepotResponse(result, len(payload), reqTime, filename))
+}
+
+// readBody reads a webhook body, refusing it with 413 once it passes the size limit
+func (h *WebhookHandler) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	defer r.Body.Close()
+	if h.maxBodySize > 0 {
+		if r.ContentLength > h.maxBodySize {
+			writeTooLarge(w, h.maxBodySize)
+			return nil, false
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, h.maxBodySize)
+	}
+	body, err := io.ReadAll(r.Body)
+	if tooLarge(err) {
+		writeTooLarge(w, h.maxBodySize)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
+
+// validGitHubSignature checks a "sha256=<hex>" HMAC of the body
+func validGitHubSignature(secret string, body []byte, signature string) bool {
+	sum, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	expected, err := hex.DecodeString(sum)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// verifyStripeSignature checks a "t=<unix>,v1=<hex>" header: one v1 signature must be
+// the HMAC of "<t>.<body>", and t must be within tolerance of now
+func verifyStripeSignature(secret string, body []byte, header string, tolerance time.Duration, now time.Time) error {
+	var timestamp string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			if signature, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, signature)
+			}
+		}
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return errors.New("malformed Stripe-Signature header")
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); tolerance > 0 && (age > tolerance || age < -tolerance) {
+		return errors.New("Stripe-Signature timestamp outside the tolerance window")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+	for _, signature := range signatures {
+		if hmac.Equal(signature, expected) {
+			return nil
+		}
+	}
+	return errors.New("no Stripe-Signature matches the endpoint secret")
+}
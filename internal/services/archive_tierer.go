@@ -0,0 +1,204 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StorageTierArchive marks records that live in the archive backend
+const StorageTierArchive = "archive"
+
+// ErrRestoreInProgress is returned when requested payloads are archived and being restored
+var ErrRestoreInProgress = errors.New("payload is archived; restore in progress")
+
+// ArchiveTierer moves aged payloads to a cheaper archive backend and restores them on demand
+type ArchiveTierer struct {
+	primary  StorageService
+	archive  StorageService
+	index    MetadataIndex
+	maxAge   time.Duration
+	interval time.Duration
+	guard    DeletionGuard
+	notifier TierNotifier
+
+	mu        sync.Mutex
+	restoring map[string]bool
+}
+
+// NewArchiveTierer creates a tierer that archives objects older than maxAge
+func NewArchiveTierer(primary, archive StorageService, index MetadataIndex, maxAge, interval time.Duration) *ArchiveTierer {
+	return &ArchiveTierer{
+		primary:   primary,
+		archive:   archive,
+		index:     index,
+		maxAge:    maxAge,
+		interval:  interval,
+		restoring: make(map[string]bool),
+	}
+}
+
+// SetDeletionGuard keeps objects the guard protects in the primary backend
+func (t *ArchiveTierer) SetDeletionGuard(guard DeletionGuard) {
+	t.guard = guard
+}
+
+// SetTierNotifier announces every move through the notifier, so the index, the change
+// journal and other observers follow objects between tiers; without one only the index
+// is updated
+func (t *ArchiveTierer) SetTierNotifier(notifier TierNotifier) {
+	t.notifier = notifier
+}
+
+// Start runs the tiering job periodically in the background
+func (t *ArchiveTierer) Start() {
+	go func() {
+		for {
+			if moved := t.TierOnce(); moved > 0 {
+				log.Printf("Archived %d object(s) older than %s", moved, t.maxAge)
+			}
+			time.Sleep(t.interval)
+		}
+	}()
+}
+
+// TierOnce moves every hot object older than the configured age to the archive backend
+func (t *ArchiveTierer) TierOnce() int {
+	cutoff := time.Now().Add(-t.maxAge)
+	moved := 0
+
+	for _, record := range t.index.List() {
+		// Restored objects age from their restore, or they would go straight back
+		storedAt := record.StoredAt
+		if record.RestoredAt != nil && record.RestoredAt.After(storedAt) {
+			storedAt = *record.RestoredAt
+		}
+		if record.StorageTier == StorageTierArchive || storedAt.After(cutoff) {
+			continue
+		}
+		if t.guard != nil {
+			if err := t.guard.CheckDelete(record.ObjectName); err != nil {
+				continue
+			}
+		}
+		if err := t.move(record, t.primary, t.archive); err != nil {
+			log.Printf("Error archiving %s: %v", record.ObjectName, err)
+			continue
+		}
+		record.StorageTier = StorageTierArchive
+		t.tiered(record)
+		moved++
+	}
+
+	return moved
+}
+
+// RestoreRequest starts restoring all archived objects of a request, returning how many were found
+func (t *ArchiveTierer) RestoreRequest(requestID string) (int, error) {
+	objects, err := t.archive.ListPayloads()
+	if err != nil {
+		return 0, fmt.Errorf("error listing archive: %v", err)
+	}
+
+	var matched []string
+	for _, obj := range objects {
+		if IsRequestObject(obj, requestID) {
+			matched = append(matched, obj)
+		}
+	}
+	if len(matched) == 0 {
+		return 0, nil
+	}
+
+	t.mu.Lock()
+	if t.restoring[requestID] {
+		t.mu.Unlock()
+		return len(matched), nil
+	}
+	t.restoring[requestID] = true
+	t.mu.Unlock()
+
+	go func() {
+		defer func() {
+			t.mu.Lock()
+			delete(t.restoring, requestID)
+			t.mu.Unlock()
+		}()
+
+		for _, obj := range matched {
+			record, ok := t.index.Get(obj)
+			if !ok {
+				record = ObjectRecord{RequestID: requestID, ObjectName: obj}
+			}
+			restoredAt := time.Now().UTC()
+			record.RestoredAt = &restoredAt
+			if err := t.move(record, t.archive, t.primary); err != nil {
+				log.Printf("Error restoring %s: %v", obj, err)
+				continue
+			}
+			if ok {
+				record.StorageTier = ""
+				t.tiered(record)
+			}
+			log.Printf("Restored %s from archive", obj)
+		}
+	}()
+
+	return len(matched), nil
+}
+
+// tiered announces a moved object, or updates the index when nothing announces moves
+func (t *ArchiveTierer) tiered(record ObjectRecord) {
+	if t.notifier != nil {
+		t.notifier.ObjectTiered(record)
+		return
+	}
+	t.index.PayloadStored(record)
+}
+
+// move copies an object between backends with all of its metadata and removes the
+// source copy
+func (t *ArchiveTierer) move(record ObjectRecord, from, to StorageService) error {
+	data, err := from.GetPayload(record.ObjectName)
+	if err != nil {
+		return err
+	}
+
+	contentType, metadata := record.ContentType, map[string]string{}
+	if reader, ok := from.(MetadataReader); ok {
+		stored, storedMetadata, err := reader.GetPayloadMetadata(record.ObjectName)
+		if err != nil && !errors.Is(err, ErrMetadataUnsupported) {
+			return err
+		}
+		if stored != "" {
+			contentType = stored
+		}
+		for key, value := range storedMetadata {
+			metadata[key] = value
+		}
+	}
+	// Fill in what the backend did not keep from the index record
+	if metadata[MetadataRequestID] == "" {
+		metadata[MetadataRequestID] = record.RequestID
+	}
+	if metadata[MetadataSHA256] == "" && record.SHA256 != "" {
+		metadata[MetadataSHA256] = record.SHA256
+	}
+	if metadata[MetadataTags] == "" && len(record.Tags) > 0 {
+		metadata[MetadataTags] = strings.Join(record.Tags, ",")
+	}
+	if metadata[MetadataExpiresAt] == "" && record.ExpiresAt != nil {
+		metadata[MetadataExpiresAt] = record.ExpiresAt.Format(time.RFC3339)
+	}
+	if record.RestoredAt != nil {
+		metadata[MetadataRestoredAt] = record.RestoredAt.Format(time.RFC3339)
+	}
+
+	if err := to.SavePayload(record.ObjectName, data, contentType, metadata); err != nil {
+		return err
+	}
+	return from.DeletePayload(record.ObjectName)
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bucket ingestion modes
+const (
+	IngestModeNotify = "notify"
+	IngestModePoll   = "poll"
+)
+
+// bucketUploadTimeout is how long an import may take to be saved before its source
+// object is imported again
+const bucketUploadTimeout = 10 * time.Minute
+
+// BucketIngester imports objects dropped directly into another bucket, so they go
+// through the payload pipeline and get indexed like any upload. Each object becomes
+// its own request, named after the last element of its key, with the key's prefixes
+// as tags. Objects are picked up from bucket notifications when the source supports
+// them, or by listing the bucket every interval.
+type BucketIngester struct {
+	source       StorageService
+	store        PayloadService
+	detector     ContentTypeDetector
+	mode         string
+	interval     time.Duration
+	deleteSource bool
+	saves        *saveWaiter
+
+	mu sync.Mutex
+	// known holds objects that were imported, are being imported, or were in the
+	// bucket before ingestion started
+	known map[string]bool
+}
+
+// NewBucketIngester creates an ingester that imports the objects of source through
+// store. mode is IngestModeNotify or IngestModePoll; notify falls back to polling
+// every interval when source cannot watch for new objects.
+func NewBucketIngester(source StorageService, store PayloadService, detector ContentTypeDetector, mode string, interval time.Duration) (*BucketIngester, error) {
+	if mode != IngestModeNotify && mode != IngestModePoll {
+		return nil, fmt.Errorf("unknown ingestion mode %q; use %s or %s", mode, IngestModeNotify, IngestModePoll)
+	}
+	return &BucketIngester{
+		source:   source,
+		store:    store,
+		detector: detector,
+		mode:     mode,
+		interval: interval,
+		saves:    newSaveWaiter(),
+		known:    make(map[string]bool),
+	}, nil
+}
+
+// SetDeleteSource deletes source objects once they are saved in the depot. Objects
+// already in the bucket are then imported too, instead of only new ones.
+func (b *BucketIngester) SetDeleteSource(deleteSource bool) {
+	b.deleteSource = deleteSource
+}
+
+// Start imports objects in the background. Without SetDeleteSource, the objects
+// already in the bucket are skipped.
+func (b *BucketIngester) Start() error {
+	if b.deleteSource {
+		b.PollOnce()
+	} else if err := b.baseline(); err != nil {
+		return err
+	}
+
+	watcher, ok := b.source.(ObjectWatcher)
+	if b.mode == IngestModeNotify && ok {
+		go b.watch(watcher)
+		return nil
+	}
+	if b.mode == IngestModeNotify {
+		log.Printf("Bucket ingestion: the source bucket has no notifications; polling every %s", b.interval)
+	}
+	go func() {
+		for {
+			time.Sleep(b.interval)
+			b.PollOnce()
+		}
+	}()
+	return nil
+}
+
+// baseline marks the objects currently in the bucket as known
+func (b *BucketIngester) baseline() error {
+	objects, err := b.source.ListPayloads()
+	if err != nil {
+		return fmt.Errorf("error listing source bucket: %v", err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, objectName := range objects {
+		b.known[objectName] = true
+	}
+	return nil
+}
+
+// watch imports objects as notifications arrive, reconnecting after failures
+func (b *BucketIngester) watch(watcher ObjectWatcher) {
+	for {
+		err := watcher.WatchCreated(context.Background(), func(objectName string) {
+			if err := b.Import(objectName); err != nil {
+				log.Printf("Bucket ingestion: error importing %s: %v", objectName, err)
+			}
+		})
+		log.Printf("Bucket ingestion: %v; reconnecting in %s", err, b.interval)
+		time.Sleep(b.interval)
+		// Catch up on objects created while disconnected
+		b.PollOnce()
+	}
+}
+
+// PollOnce imports every object not seen before. Failed imports are retried on the
+// next poll.
+func (b *BucketIngester) PollOnce() (imported, failed int) {
+	for _, objectName := range b.saves.expire(bucketUploadTimeout) {
+		log.Printf("Bucket ingestion: %s was not saved in time; it will be imported again", objectName)
+		b.forget(objectName)
+	}
+
+	objects, err := b.source.ListPayloads()
+	if err != nil {
+		log.Printf("Bucket ingestion: error listing source bucket: %v", err)
+		return 0, 0
+	}
+	for _, objectName := range objects {
+		err := b.Import(objectName)
+		switch {
+		case err == errAlreadyKnown:
+		case err != nil:
+			log.Printf("Bucket ingestion: error importing %s: %v", objectName, err)
+			failed++
+		default:
+			imported++
+		}
+	}
+	if imported > 0 || failed > 0 {
+		log.Printf("Bucket ingestion: imported %d object(s), %d failed", imported, failed)
+	}
+	return imported, failed
+}
+
+// errAlreadyKnown is returned by Import for objects that were already imported
+var errAlreadyKnown = fmt.Errorf("object was already imported")
+
+// Import stores one source object in the depot
+func (b *BucketIngester) Import(objectName string) error {
+	b.mu.Lock()
+	if b.known[objectName] {
+		b.mu.Unlock()
+		return errAlreadyKnown
+	}
+	b.known[objectName] = true
+	b.mu.Unlock()
+
+	if err := b.importObject(objectName); err != nil {
+		b.forget(objectName)
+		return err
+	}
+	return nil
+}
+
+// importObject reads a source object and stores it through the pipeline
+func (b *BucketIngester) importObject(objectName string) error {
+	data, err := b.source.GetPayload(objectName)
+	if err != nil {
+		return err
+	}
+	filename := path.Base(objectName)
+	contentType := b.detector.DetectFromFilename(filename)
+	if reader, ok := b.source.(MetadataReader); ok {
+		if stored, _, err := reader.GetPayloadMetadata(objectName); err == nil && stored != "" {
+			contentType = stored
+		}
+	}
+	var tags []string
+	if dir := path.Dir(objectName); dir != "." {
+		tags = strings.Split(dir, "/")
+	}
+
+	b.saves.begin()
+	defer b.saves.end()
+	result, err := b.store.StorePayload(data, contentType, filename, StoreOptions{Tags: tags, Source: "bucket"})
+	if errors.Is(err, ErrPayloadDropped) {
+		log.Printf("Bucket ingestion: %s was %v", objectName, err)
+		if b.deleteSource {
+			if err := b.source.DeletePayload(objectName); err != nil {
+				log.Printf("Bucket ingestion: error deleting dropped %s: %v", objectName, err)
+			}
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Bucket ingestion: importing %s as request %s", objectName, result.RequestID)
+	if b.deleteSource {
+		b.saves.wait(objectName, result, func(ObjectRecord) {
+			if err := b.source.DeletePayload(objectName); err != nil {
+				log.Printf("Bucket ingestion: error deleting imported %s: %v", objectName, err)
+				return
+			}
+			b.forget(objectName)
+		})
+	}
+	return nil
+}
+
+// forget lets an object be imported again
+func (b *BucketIngester) forget(objectName string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.known, objectName)
+}
+
+// PayloadStored deletes a source object once its import is saved
+func (b *BucketIngester) PayloadStored(record ObjectRecord) {
+	b.saves.PayloadStored(record)
+}
+
+// PayloadDeleted is a no-op; deletions in the depot do not affect the source bucket
+func (b *BucketIngester) PayloadDeleted(record ObjectRecord) {}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Encryption settings a bucket template can apply by default to new objects
+const (
+	BucketEncryptionSSES3  = "SSE-S3"
+	BucketEncryptionSSEKMS = "SSE-KMS"
+)
+
+// BucketTemplate describes the bucket provisioned for every namespace. Lifecycle
+// days of 0 leave that rule out.
+type BucketTemplate struct {
+	// BucketPrefix is prepended to the lowercased namespace to name its bucket
+	BucketPrefix string `json:"bucket_prefix"`
+	Versioning   bool   `json:"versioning"`
+	ObjectLock   bool   `json:"object_lock"`
+	// Encryption is SSE-S3, SSE-KMS with KMSKeyID, or empty for none
+	Encryption string `json:"encryption"`
+	KMSKeyID   string `json:"kms_key_id"`
+	// ExpireDays deletes objects this many days after they are written
+	ExpireDays int `json:"expire_days"`
+	// NoncurrentExpireDays deletes overwritten versions this many days after they
+	// stop being current; it needs versioning
+	NoncurrentExpireDays int `json:"noncurrent_expire_days"`
+	// AbortIncompleteUploadDays cleans up abandoned multipart uploads
+	AbortIncompleteUploadDays int `json:"abort_incomplete_upload_days"`
+}
+
+// LoadBucketTemplate reads and validates a bucket template from a JSON file
+func LoadBucketTemplate(path string) (BucketTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return BucketTemplate{}, err
+	}
+	var template BucketTemplate
+	if err := json.Unmarshal(data, &template); err != nil {
+		return BucketTemplate{}, fmt.Errorf("invalid bucket template: %v", err)
+	}
+	return template, template.Validate()
+}
+
+// Validate rejects templates MinIO would refuse or that contradict themselves
+func (t BucketTemplate) Validate() error {
+	switch t.Encryption {
+	case "", BucketEncryptionSSES3:
+		if t.KMSKeyID != "" {
+			return fmt.Errorf("bucket template sets kms_key_id without SSE-KMS encryption")
+		}
+	case BucketEncryptionSSEKMS:
+		if t.KMSKeyID == "" {
+			return fmt.Errorf("bucket template needs kms_key_id for SSE-KMS encryption")
+		}
+	default:
+		return fmt.Errorf("unknown bucket encryption %q; use %s or %s", t.Encryption, BucketEncryptionSSES3, BucketEncryptionSSEKMS)
+	}
+	if t.ExpireDays < 0 || t.NoncurrentExpireDays < 0 || t.AbortIncompleteUploadDays < 0 {
+		return fmt.Errorf("bucket template lifecycle days must not be negative")
+	}
+	if t.NoncurrentExpireDays > 0 && !t.Versioning && !t.ObjectLock {
+		return fmt.Errorf("bucket template noncurrent_expire_days needs versioning")
+	}
+	if t.BucketPrefix != strings.ToLower(t.BucketPrefix) || strings.ContainsAny(t.BucketPrefix, "_/") {
+		return fmt.Errorf("bucket template prefix %q must be lowercase, without '_' or '/'", t.BucketPrefix)
+	}
+	return nil
+}
+
+// BucketName returns the bucket a namespace is provisioned in
+func (t BucketTemplate) BucketName(namespace string) (string, error) {
+	name := t.BucketPrefix + strings.ToLower(namespace)
+	if len(name) < 3 || len(name) > 63 || strings.Contains(name, "..") ||
+		strings.HasPrefix(name, ".") || strings.HasPrefix(name, "-") ||
+		strings.HasSuffix(name, ".") || strings.HasSuffix(name, "-") {
+		return "", fmt.Errorf("namespace %q does not make a valid bucket name (%q)", namespace, name)
+	}
+	return name, nil
+}
+
+// BucketAdmin is implemented by storage services that can create and configure
+// buckets, such as MinIO
+type BucketAdmin interface {
+	// ProvisionBucket creates a bucket if it does not exist and applies the template's
+	// settings, reporting whether it was created
+	ProvisionBucket(bucket string, template BucketTemplate) (bool, error)
+}
+
+// NamespaceProvisioner makes sure a namespace's resources exist before it is used
+type NamespaceProvisioner interface {
+	Provision(namespace string) (string, error)
+}
+
+// BucketProvisioner provisions a bucket from a template the first time each
+// namespace is seen. The default namespace lives in the depot's own bucket and is
+// never provisioned.
+type BucketProvisioner struct {
+	admin    BucketAdmin
+	template BucketTemplate
+
+	mu          sync.Mutex
+	provisioned map[string]string
+}
+
+// NewBucketProvisioner creates a provisioner applying template through admin
+func NewBucketProvisioner(admin BucketAdmin, template BucketTemplate) *BucketProvisioner {
+	return &BucketProvisioner{
+		admin:       admin,
+		template:    template,
+		provisioned: make(map[string]string),
+	}
+}
+
+// Provision returns a namespace's bucket, creating and configuring it on first use.
+// A failed attempt is retried the next time the namespace is seen.
+func (p *BucketProvisioner) Provision(namespace string) (string, error) {
+	namespace = UsageNamespace(namespace)
+	if namespace == DefaultNamespace {
+		return "", nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if bucket, ok := p.provisioned[namespace]; ok {
+		return bucket, nil
+	}
+
+	bucket, err := p.template.BucketName(namespace)
+	if err != nil {
+		return "", err
+	}
+	created, err := p.admin.ProvisionBucket(bucket, p.template)
+	if err != nil {
+		return "", fmt.Errorf("error provisioning bucket %s for namespace %s: %v", bucket, namespace, err)
+	}
+	if created {
+		log.Printf("Provisioned bucket %s for namespace %s", bucket, namespace)
+	}
+	p.provisioned[namespace] = bucket
+	return bucket, nil
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrCallbackNotAllowed is returned for callback URLs the depot may not reach
+var ErrCallbackNotAllowed = errors.New("callback URL not allowed")
+
+// HTTPCallbackNotifier POSTs signed completion events with retries
+type HTTPCallbackNotifier struct {
+	client     *http.Client
+	secret     string
+	executor   *RetryExecutor
+	deliveries DeliveryTracker
+
+	allowedHosts []string
+	allowPrivate bool
+}
+
+// NewHTTPCallbackNotifier creates a notifier; events are signed when secret is non-empty.
+// Callbacks only reach public addresses until SetAllowPrivate is called.
+func NewHTTPCallbackNotifier(secret string, policy RetryPolicy, deliveries DeliveryTracker) *HTTPCallbackNotifier {
+	n := &HTTPCallbackNotifier{
+		secret:     secret,
+		executor:   NewRetryExecutor(policy),
+		deliveries: deliveries,
+	}
+	// The address is checked after resolution, so a public name cannot point a
+	// callback at an internal service
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: n.checkDial}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	n.client = &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return n.CheckCallbackURL(req.URL.String())
+		},
+	}
+	return n
+}
+
+// SetAllowedHosts limits callbacks to the given host names; any host may be called
+// when the list is empty
+func (n *HTTPCallbackNotifier) SetAllowedHosts(hosts []string) {
+	n.allowedHosts = hosts
+}
+
+// SetAllowPrivate lets callbacks reach loopback, private and link-local addresses
+func (n *HTTPCallbackNotifier) SetAllowPrivate(allow bool) {
+	n.allowPrivate = allow
+}
+
+// CheckCallbackURL reports whether a callback may be sent to the URL: it must be an
+// absolute http(s) URL on an allowed host, and not name a non-public address
+func (n *HTTPCallbackNotifier) CheckCallbackURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("%w: %s is not an absolute http(s) URL", ErrCallbackNotAllowed, raw)
+	}
+	host := strings.ToLower(u.Hostname())
+	if len(n.allowedHosts) > 0 && !slices.Contains(n.allowedHosts, host) {
+		return fmt.Errorf("%w: host %s is not in the allowed hosts", ErrCallbackNotAllowed, host)
+	}
+	if ip := net.ParseIP(host); ip != nil && !n.allowPrivate && !isPublicIP(ip) {
+		return fmt.Errorf("%w: %s is not a public address", ErrCallbackNotAllowed, host)
+	}
+	return nil
+}
+
+// checkDial refuses connections to non-public addresses once names are resolved
+func (n *HTTPCallbackNotifier) checkDial(network, address string, _ syscall.RawConn) error {
+	if n.allowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("%w: %s is not a public address", ErrCallbackNotAllowed, host)
+	}
+	return nil
+}
+
+// isPublicIP reports whether an address is routable on the internet, excluding
+// loopback, private, link-local (including cloud metadata), multicast and unspecified ones
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// Notify delivers the event in the background, retrying with exponential backoff
+func (n *HTTPCallbackNotifier) Notify(callbackURL string, event CompletionEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding callback for %s: %v", event.RequestID, err)
+		return
+	}
+
+	delivery := Delivery{Kind: DeliveryKindCallback, Target: callbackURL, RequestID: event.RequestID}
+	go func() {
+		err := n.deliveries.Run(delivery, n.executor, func(ctx context.Context) error {
+			return n.deliver(ctx, callbackURL, body)
+		})
+		if err != nil {
+			log.Printf("Callback for %s to %s failed after %d attempt(s): %v", event.RequestID, callbackURL, n.executor.Policy().MaxAttempts, err)
+			return
+		}
+		log.Printf("Delivered callback for %s to %s", event.RequestID, callbackURL)
+	}()
+}
+
+func (n *HTTPCallbackNotifier) deliver(ctx context.Context, callbackURL string, body []byte) error {
+	if err := n.CheckCallbackURL(callbackURL); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if n.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Depot-Timestamp", timestamp)
+		req.Header.Set("X-Depot-Signature", "sha256="+SignCallback(n.secret, timestamp, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SignCallback computes the hex HMAC-SHA256 of "timestamp.body" used in X-Depot-Signature
+func SignCallback(secret, timestamp string, body []byte) string {
+	signature, _ := SignRequest("sha256", secret, timestamp, body)
+	return signature
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ChangeJournal is an ordered, bounded log of storage changes, optionally persisted to a file
+type ChangeJournal struct {
+	mu         sync.Mutex
+	events     []ChangeEvent
+	lastCursor int64
+	retention  int
+
+	path        string
+	file        *os.File
+	fileEntries int
+
+	subscribers map[chan ChangeEvent]struct{}
+}
+
+// subscriberBuffer is how many events a slow subscriber may lag before events are dropped
+const subscriberBuffer = 64
+
+// NewChangeJournal creates a journal keeping the latest retention events; when path is
+// non-empty, events are appended to that file and reloaded on startup
+func NewChangeJournal(path string, retention int) (*ChangeJournal, error) {
+	if retention <= 0 {
+		retention = 10000
+	}
+	j := &ChangeJournal{
+		retention:   retention,
+		path:        path,
+		subscribers: make(map[chan ChangeEvent]struct{}),
+	}
+	if path == "" {
+		return j, nil
+	}
+
+	if err := j.load(); err != nil {
+		return nil, fmt.Errorf("failed to load change journal: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open change journal: %v", err)
+	}
+	j.file = file
+	return j, nil
+}
+
+// PayloadStored records a stored event
+func (j *ChangeJournal) PayloadStored(record ObjectRecord) {
+	j.record(ChangeStored, record)
+}
+
+// PayloadDeleted records a deleted event
+func (j *ChangeJournal) PayloadDeleted(record ObjectRecord) {
+	j.record(ChangeDeleted, record)
+}
+
+// PayloadTiered records an archived or restored event
+func (j *ChangeJournal) PayloadTiered(record ObjectRecord) {
+	if record.StorageTier == StorageTierArchive {
+		j.record(ChangeArchived, record)
+		return
+	}
+	j.record(ChangeRestored, record)
+}
+
+// Since returns up to limit events after cursor, the cursor to resume from, and whether
+// events between cursor and the oldest retained event were dropped
+func (j *ChangeJournal) Since(cursor int64, limit int) ([]ChangeEvent, int64, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	truncated := false
+	if cursor > j.lastCursor {
+		// The journal was reset since the consumer last polled
+		cursor, truncated = 0, true
+	}
+	if len(j.events) > 0 && cursor < j.events[0].Cursor-1 {
+		truncated = true
+	}
+
+	start := sort.Search(len(j.events), func(i int) bool {
+		return j.events[i].Cursor > cursor
+	})
+	end := len(j.events)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+
+	events := append([]ChangeEvent(nil), j.events[start:end]...)
+	next := cursor
+	if len(events) > 0 {
+		next = events[len(events)-1].Cursor
+	}
+	return events, next, truncated
+}
+
+// Cursor returns the cursor of the most recent event
+func (j *ChangeJournal) Cursor() int64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.lastCursor
+}
+
+// Subscribe returns a channel receiving every new event until cancel is called;
+// events are dropped for subscribers that fall too far behind
+func (j *ChangeJournal) Subscribe() (<-chan ChangeEvent, func()) {
+	ch := make(chan ChangeEvent, subscriberBuffer)
+
+	j.mu.Lock()
+	j.subscribers[ch] = struct{}{}
+	j.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			j.mu.Lock()
+			delete(j.subscribers, ch)
+			j.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+func (j *ChangeJournal) record(changeType string, record ObjectRecord) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.lastCursor++
+	event := ChangeEvent{
+		Cursor: j.lastCursor,
+		Type:   changeType,
+		Time:   time.Now().UTC(),
+		Object: record,
+	}
+	j.append(event)
+
+	for ch := range j.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+
+	if j.file == nil {
+		return
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding change event: %v", err)
+		return
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		log.Printf("Error writing change journal: %v", err)
+		return
+	}
+	j.fileEntries++
+	if j.fileEntries > 2*j.retention {
+		j.compact()
+	}
+}
+
+// append adds an event to memory, dropping the oldest beyond retention
+func (j *ChangeJournal) append(event ChangeEvent) {
+	j.events = append(j.events, event)
+	if len(j.events) > j.retention {
+		j.events = append([]ChangeEvent(nil), j.events[len(j.events)-j.retention:]...)
+	}
+}
+
+// load replays the journal file into memory
+func (j *ChangeJournal) load() error {
+	file, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event ChangeEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		j.append(event)
+		j.fileEntries++
+		if event.Cursor > j.lastCursor {
+			j.lastCursor = event.Cursor
+		}
+	}
+	return scanner.Err()
+}
+
+// compact rewrites the journal file with only the retained events
+func (j *ChangeJournal) compact() {
+	tmpPath := j.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		log.Printf("Error compacting change journal: %v", err)
+		return
+	}
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, event := range j.events {
+		encoder.Encode(event)
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		log.Printf("Error compacting change journal: %v", err)
+		return
+	}
+	tmp.Close()
+
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		log.Printf("Error compacting change journal: %v", err)
+		return
+	}
+
+	j.file.Close()
+	file, err := os.OpenFile(j.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Printf("Error reopening change journal: %v", err)
+		j.file = nil
+		return
+	}
+	j.file = file
+	j.fileEntries = len(j.events)
+}
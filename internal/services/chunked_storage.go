@@ -0,0 +1,270 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+)
+
+// MetadataChunkCount records how many part-objects a chunked object's manifest points at
+const MetadataChunkCount = "Chunk-Count"
+
+// chunkManifestMagic prefixes the manifest stored in place of a chunked object
+var chunkManifestMagic = []byte("DPC1")
+
+// chunkPartPattern matches the part-objects hidden behind a manifest
+var chunkPartPattern = regexp.MustCompile(`\.depot-chunk-\d{5}$`)
+
+// chunkManifest lists the parts a chunked object was split into, in order
+type chunkManifest struct {
+	Size   int      `json:"size"`
+	SHA256 string   `json:"sha256"`
+	Parts  []string `json:"parts"`
+}
+
+// ChunkedStorage wraps a storage service and splits objects larger than chunkSize
+// into part-objects. A small manifest is stored under the original name and the
+// parts are reassembled on read, so callers never see them.
+type ChunkedStorage struct {
+	inner     StorageService
+	chunkSize int
+}
+
+// NewChunkedStorage creates a storage wrapper that splits objects above chunkSize bytes
+func NewChunkedStorage(inner StorageService, chunkSize int) *ChunkedStorage {
+	return &ChunkedStorage{
+		inner:     inner,
+		chunkSize: chunkSize,
+	}
+}
+
+// SavePayload stores small objects as-is and large ones as parts plus a manifest.
+// The manifest is written last, so readers never see a partially written object.
+func (c *ChunkedStorage) SavePayload(objectName string, data []byte, contentType string, metadata map[string]string) error {
+	return c.SavePayloadContext(context.Background(), objectName, data, contentType, metadata)
+}
+
+// SavePayloadContext saves as SavePayload does, under ctx
+func (c *ChunkedStorage) SavePayloadContext(ctx context.Context, objectName string, data []byte, contentType string, metadata map[string]string) error {
+	previousParts := c.partCount(objectName)
+
+	if len(data) <= c.chunkSize {
+		if err := savePayload(ctx, c.inner, objectName, data, contentType, metadata); err != nil {
+			return err
+		}
+		c.removeParts(objectName, 0, previousParts)
+		return nil
+	}
+
+	sum := sha256.Sum256(data)
+	manifest := chunkManifest{Size: len(data), SHA256: hex.EncodeToString(sum[:])}
+	for offset := 0; offset < len(data); offset += c.chunkSize {
+		end := min(offset+c.chunkSize, len(data))
+		partName := chunkPartName(objectName, len(manifest.Parts))
+		if err := savePayload(ctx, c.inner, partName, data[offset:end], "application/octet-stream", nil); err != nil {
+			return fmt.Errorf("failed to store part %s: %w", partName, err)
+		}
+		manifest.Parts = append(manifest.Parts, partName)
+	}
+
+	encoded, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	withCount := make(map[string]string, len(metadata)+1)
+	for key, value := range metadata {
+		withCount[key] = value
+	}
+	withCount[MetadataChunkCount] = strconv.Itoa(len(manifest.Parts))
+	if err := savePayload(ctx, c.inner, objectName, append(append([]byte{}, chunkManifestMagic...), encoded...), contentType, withCount); err != nil {
+		return err
+	}
+	c.removeParts(objectName, len(manifest.Parts), previousParts)
+	return nil
+}
+
+// GetPayload returns an object, reassembling it from its parts when it was chunked
+func (c *ChunkedStorage) GetPayload(objectName string) ([]byte, error) {
+	return c.GetPayloadContext(context.Background(), objectName)
+}
+
+// GetPayloadContext reads as GetPayload does, under ctx
+func (c *ChunkedStorage) GetPayloadContext(ctx context.Context, objectName string) ([]byte, error) {
+	data, err := getPayload(ctx, c.inner, objectName)
+	if err != nil {
+		return nil, err
+	}
+	manifest, ok := parseChunkManifest(data)
+	if !ok {
+		return data, nil
+	}
+
+	assembled := make([]byte, 0, manifest.Size)
+	for _, partName := range manifest.Parts {
+		part, err := getPayload(ctx, c.inner, partName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read part %s: %w", partName, err)
+		}
+		assembled = append(assembled, part...)
+	}
+	sum := sha256.Sum256(assembled)
+	if len(assembled) != manifest.Size || hex.EncodeToString(sum[:]) != manifest.SHA256 {
+		return nil, fmt.Errorf("chunked object %s does not match its manifest", objectName)
+	}
+	return assembled, nil
+}
+
+// ListPayloads lists all payloads in the wrapped storage, without their part-objects
+func (c *ChunkedStorage) ListPayloads() ([]string, error) {
+	return c.ListPayloadsContext(context.Background())
+}
+
+// ListPayloadsContext lists as ListPayloads does, under ctx
+func (c *ChunkedStorage) ListPayloadsContext(ctx context.Context) ([]string, error) {
+	objects, err := listPayloads(ctx, c.inner)
+	if err != nil {
+		return nil, err
+	}
+	visible := make([]string, 0, len(objects))
+	for _, objectName := range objects {
+		if !chunkPartPattern.MatchString(objectName) {
+			visible = append(visible, objectName)
+		}
+	}
+	return visible, nil
+}
+
+// DeletePayload removes an object and, when it was chunked, its parts
+func (c *ChunkedStorage) DeletePayload(objectName string) error {
+	return c.DeletePayloadContext(context.Background(), objectName)
+}
+
+// DeletePayloadContext deletes as DeletePayload does, binding the object's delete to ctx
+func (c *ChunkedStorage) DeletePayloadContext(ctx context.Context, objectName string) error {
+	parts := c.partCount(objectName)
+	if err := deletePayload(ctx, c.inner, objectName); err != nil {
+		return err
+	}
+	c.removeParts(objectName, 0, parts)
+	return nil
+}
+
+// GetPayloadMetadata returns the wrapped object's content type and metadata, without the chunk count
+func (c *ChunkedStorage) GetPayloadMetadata(objectName string) (string, map[string]string, error) {
+	reader, ok := c.inner.(MetadataReader)
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrMetadataUnsupported, objectName)
+	}
+	contentType, metadata, err := reader.GetPayloadMetadata(objectName)
+	if err != nil {
+		return "", nil, err
+	}
+	return contentType, withoutMetadata(metadata, MetadataChunkCount), nil
+}
+
+// StatPayload describes an object through the wrapped storage, taking the size of a
+// chunked object from its manifest
+func (c *ChunkedStorage) StatPayload(objectName string) (*ObjectStat, error) {
+	statter, ok := c.inner.(PayloadStatter)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrStatUnsupported, objectName)
+	}
+	stat, err := statter.StatPayload(objectName)
+	if err != nil {
+		return nil, err
+	}
+	if count, _ := strconv.Atoi(stat.Metadata[MetadataChunkCount]); count > 0 {
+		data, err := c.inner.GetPayload(objectName)
+		if err != nil {
+			return nil, err
+		}
+		if manifest, ok := parseChunkManifest(data); ok {
+			stat.Size = int64(manifest.Size)
+		}
+	}
+	stat.Metadata = withoutMetadata(stat.Metadata, MetadataChunkCount)
+	return stat, nil
+}
+
+// ListPayloadInfo lists the wrapped storage without part-objects, giving a chunked
+// object the size of its parts together
+func (c *ChunkedStorage) ListPayloadInfo() ([]ObjectInfo, error) {
+	lister, ok := c.inner.(ObjectLister)
+	if !ok {
+		return nil, ErrListInfoUnsupported
+	}
+	infos, err := lister.ListPayloadInfo()
+	if err != nil {
+		return nil, err
+	}
+	partSizes := make(map[string]int64)
+	visible := make([]ObjectInfo, 0, len(infos))
+	for _, info := range infos {
+		if loc := chunkPartPattern.FindStringIndex(info.ObjectName); loc != nil {
+			partSizes[info.ObjectName[:loc[0]]] += info.Size
+			continue
+		}
+		visible = append(visible, info)
+	}
+	for i, info := range visible {
+		if size, ok := partSizes[info.ObjectName]; ok {
+			visible[i].Size = size
+		}
+	}
+	return visible, nil
+}
+
+// ComposePayload is unsupported: a server-side compose would bypass chunking, so
+// appends fall back to rewriting the object through SavePayload
+func (c *ChunkedStorage) ComposePayload(objectName string, data []byte, contentType string, metadata map[string]string) (int64, error) {
+	return 0, ErrComposeUnsupported
+}
+
+// partCount returns how many parts an existing object was split into, or 0
+func (c *ChunkedStorage) partCount(objectName string) int {
+	if reader, ok := c.inner.(MetadataReader); ok {
+		_, metadata, err := reader.GetPayloadMetadata(objectName)
+		if !errors.Is(err, ErrMetadataUnsupported) {
+			count, _ := strconv.Atoi(metadata[MetadataChunkCount])
+			return count
+		}
+	}
+	data, err := c.inner.GetPayload(objectName)
+	if err != nil {
+		return 0
+	}
+	manifest, _ := parseChunkManifest(data)
+	return len(manifest.Parts)
+}
+
+// removeParts deletes the parts numbered from..to-1 left over from an earlier version
+func (c *ChunkedStorage) removeParts(objectName string, from, to int) {
+	for i := from; i < to; i++ {
+		partName := chunkPartName(objectName, i)
+		if err := c.inner.DeletePayload(partName); err != nil {
+			log.Printf("Error removing stale part %s: %v", partName, err)
+		}
+	}
+}
+
+func chunkPartName(objectName string, index int) string {
+	return fmt.Sprintf("%s.depot-chunk-%05d", objectName, index)
+}
+
+func parseChunkManifest(data []byte) (chunkManifest, bool) {
+	var manifest chunkManifest
+	if !bytes.HasPrefix(data, chunkManifestMagic) {
+		return manifest, false
+	}
+	if err := json.Unmarshal(data[len(chunkManifestMagic):], &manifest); err != nil || len(manifest.Parts) == 0 {
+		return chunkManifest{}, false
+	}
+	return manifest, true
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression algorithms supported by CompressedStorage
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// MetadataUncompressedSize records the size of a payload before CompressedStorage
+// compressed it, so its size is known without reading it
+const MetadataUncompressedSize = "Uncompressed-Size"
+
+// Magic prefixes of the objects CompressedStorage compressed, one per algorithm
+var (
+	gzipObjectMagic = []byte("DPZG")
+	zstdObjectMagic = []byte("DPZS")
+)
+
+// DefaultCompressibleTypes are the content types compressed when no allowlist is set
+var DefaultCompressibleTypes = []string{
+	"text/*",
+	"application/json",
+	"application/*+json",
+	"application/x-ndjson",
+	"application/xml",
+	"application/*+xml",
+	"application/yaml",
+	"application/javascript",
+	"application/x-www-form-urlencoded",
+}
+
+// CompressedStorage wraps a storage service and compresses payloads before they are
+// written, decompressing them on read, so callers never see the compressed bytes.
+// Only payloads of at least minSize bytes with an allowed content type are
+// compressed, and only when that makes them smaller. Objects stored uncompressed,
+// including those written before compression was enabled, are read as they are.
+type CompressedStorage struct {
+	inner     StorageService
+	algorithm string
+	minSize   int
+	types     []string
+
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+// NewCompressedStorage creates a storage wrapper compressing payloads with algorithm,
+// "gzip" or "zstd". An empty types allowlist uses DefaultCompressibleTypes.
+func NewCompressedStorage(inner StorageService, algorithm string, minSize int, types []string) (*CompressedStorage, error) {
+	if algorithm != CompressionGzip && algorithm != CompressionZstd {
+		return nil, fmt.Errorf("unknown compression algorithm %q, expected gzip or zstd", algorithm)
+	}
+	if len(types) == 0 {
+		types = DefaultCompressibleTypes
+	}
+	// Both algorithms are always readable, so switching algorithm keeps older objects
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &CompressedStorage{
+		inner:     inner,
+		algorithm: algorithm,
+		minSize:   minSize,
+		types:     types,
+		encoder:   encoder,
+		decoder:   decoder,
+	}, nil
+}
+
+// SavePayload compresses a payload that qualifies and stores it
+func (c *CompressedStorage) SavePayload(objectName string, data []byte, contentType string, metadata map[string]string) error {
+	return c.SavePayloadContext(context.Background(), objectName, data, contentType, metadata)
+}
+
+// SavePayloadContext saves as SavePayload does, under ctx
+func (c *CompressedStorage) SavePayloadContext(ctx context.Context, objectName string, data []byte, contentType string, metadata map[string]string) error {
+	withSize := make(map[string]string, len(metadata)+1)
+	for key, value := range metadata {
+		withSize[key] = value
+	}
+	withSize[MetadataUncompressedSize] = strconv.Itoa(len(data))
+	metadata = withSize
+
+	if len(data) >= c.minSize && c.compressible(contentType) {
+		compressed, err := c.compress(data)
+		if err != nil {
+			return fmt.Errorf("failed to compress %s: %w", objectName, err)
+		}
+		if len(compressed) < len(data) {
+			data = compressed
+		}
+	}
+	return savePayload(ctx, c.inner, objectName, data, contentType, metadata)
+}
+
+// GetPayload returns an object, decompressing it when it was stored compressed
+func (c *CompressedStorage) GetPayload(objectName string) ([]byte, error) {
+	return c.GetPayloadContext(context.Background(), objectName)
+}
+
+// GetPayloadContext reads as GetPayload does, under ctx
+func (c *CompressedStorage) GetPayloadContext(ctx context.Context, objectName string) ([]byte, error) {
+	data, err := getPayload(ctx, c.inner, objectName)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := c.decompress(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s: %w", objectName, err)
+	}
+	return plain, nil
+}
+
+// ListPayloads lists all payloads in the wrapped storage
+func (c *CompressedStorage) ListPayloads() ([]string, error) {
+	return c.inner.ListPayloads()
+}
+
+// ListPayloadsContext lists the wrapped storage under ctx
+func (c *CompressedStorage) ListPayloadsContext(ctx context.Context) ([]string, error) {
+	return listPayloads(ctx, c.inner)
+}
+
+// ListRequestPayloads lists one request through the wrapped storage
+func (c *CompressedStorage) ListRequestPayloads(requestID string) ([]string, error) {
+	return listRequestObjects(c.inner, requestID)
+}
+
+// ListRequestPayloadsContext lists one request through the wrapped storage under ctx
+func (c *CompressedStorage) ListRequestPayloadsContext(ctx context.Context, requestID string) ([]string, error) {
+	return listRequestObjectsContext(ctx, c.inner, requestID)
+}
+
+// DeletePayload deletes an object from the wrapped storage
+func (c *CompressedStorage) DeletePayload(objectName string) error {
+	return c.inner.DeletePayload(objectName)
+}
+
+// DeletePayloadContext deletes an object from the wrapped storage under ctx
+func (c *CompressedStorage) DeletePayloadContext(ctx context.Context, objectName string) error {
+	return deletePayload(ctx, c.inner, objectName)
+}
+
+// GetPayloadMetadata returns the wrapped object's content type and metadata, without
+// the uncompressed size
+func (c *CompressedStorage) GetPayloadMetadata(objectName string) (string, map[string]string, error) {
+	reader, ok := c.inner.(MetadataReader)
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrMetadataUnsupported, objectName)
+	}
+	contentType, metadata, err := reader.GetPayloadMetadata(objectName)
+	if err != nil {
+		return "", nil, err
+	}
+	return contentType, withoutMetadata(metadata, MetadataUncompressedSize), nil
+}
+
+// StatPayload describes an object through the wrapped storage, with its uncompressed size
+func (c *CompressedStorage) StatPayload(objectName string) (*ObjectStat, error) {
+	statter, ok := c.inner.(PayloadStatter)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrStatUnsupported, objectName)
+	}
+	stat, err := statter.StatPayload(objectName)
+	if err != nil {
+		return nil, err
+	}
+	if stat.Size, err = c.uncompressedSize(objectName, stat.Metadata); err != nil {
+		return nil, err
+	}
+	stat.Metadata = withoutMetadata(stat.Metadata, MetadataUncompressedSize)
+	return stat, nil
+}
+
+// ListPayloadInfo lists the wrapped storage with the uncompressed size of each object
+func (c *CompressedStorage) ListPayloadInfo() ([]ObjectInfo, error) {
+	lister, ok := c.inner.(ObjectLister)
+	reader, readable := c.inner.(MetadataReader)
+	if !ok || !readable {
+		return nil, ErrListInfoUnsupported
+	}
+	infos, err := lister.ListPayloadInfo()
+	if err != nil {
+		return nil, err
+	}
+	for i := range infos {
+		_, metadata, err := reader.GetPayloadMetadata(infos[i].ObjectName)
+		if errors.Is(err, ErrMetadataUnsupported) {
+			return nil, ErrListInfoUnsupported
+		}
+		if err != nil {
+			return nil, err
+		}
+		if infos[i].Size, err = c.uncompressedSize(infos[i].ObjectName, metadata); err != nil {
+			return nil, err
+		}
+	}
+	return infos, nil
+}
+
+// uncompressedSize reads an object's size from its metadata, or reads the object when
+// it was stored before its size was recorded
+func (c *CompressedStorage) uncompressedSize(objectName string, metadata map[string]string) (int64, error) {
+	if size, err := strconv.ParseInt(metadata[MetadataUncompressedSize], 10, 64); err == nil {
+		return size, nil
+	}
+	data, err := c.GetPayload(objectName)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(data)), nil
+}
+
+// ComposePayload is unsupported: a server-side compose would append plain bytes to a
+// compressed object, so appends fall back to rewriting it through SavePayload
+func (c *CompressedStorage) ComposePayload(objectName string, data []byte, contentType string, metadata map[string]string) (int64, error) {
+	return 0, ErrComposeUnsupported
+}
+
+// compressible reports whether contentType is on the allowlist
+func (c *CompressedStorage) compressible(contentType string) bool {
+	contentType = strings.ToLower(mediaType(contentType))
+	for _, pattern := range c.types {
+		if matchPattern(strings.ToLower(pattern), contentType) {
+			return true
+		}
+	}
+	return false
+}
+
+// compress returns data compressed with the configured algorithm, behind its magic
+func (c *CompressedStorage) compress(data []byte) ([]byte, error) {
+	if c.algorithm == CompressionZstd {
+		return c.encoder.EncodeAll(data, append([]byte{}, zstdObjectMagic...)), nil
+	}
+	var buf bytes.Buffer
+	buf.Write(gzipObjectMagic)
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress returns the original bytes of a compressed object, and any other object as is
+func (c *CompressedStorage) decompress(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, zstdObjectMagic):
+		return c.decoder.DecodeAll(data[len(zstdObjectMagic):], nil)
+	case bytes.HasPrefix(data, gzipObjectMagic):
+		reader, err := gzip.NewReader(bytes.NewReader(data[len(gzipObjectMagic):]))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	}
+	return data, nil
+}
@@ -0,0 +1,356 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// MetadataDedupBlob names the blob a deduplicated object's reference points at
+const MetadataDedupBlob = "Dedup-Blob"
+
+// dedupReferenceMagic prefixes the reference stored in place of a deduplicated object
+var dedupReferenceMagic = []byte("DPR1")
+
+// dedupBlobPattern matches the content-addressed blobs hidden behind references
+var dedupBlobPattern = regexp.MustCompile(`(^|\.)depot-blob-[0-9a-f]{64}$`)
+
+// dedupReference points a deduplicated object at the blob holding its bytes
+type dedupReference struct {
+	Blob   string `json:"blob"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// DedupStorage wraps a storage service and stores identical payloads once. Each
+// distinct payload is kept in a blob named after its SHA-256, and every object holding
+// it is a small reference to the blob, resolved on read, so callers never see the
+// blobs. Blobs are scoped to the tenant prefix of their objects. Deleting an object
+// removes only its reference; CollectGarbage removes blobs no reference points at.
+type DedupStorage struct {
+	inner StorageService
+
+	// saving is held by every save, so CollectGarbage starts once those already
+	// running have written their references
+	saving sync.RWMutex
+	mu     sync.Mutex
+	// used records the blobs written or referenced while CollectGarbage runs, so a
+	// blob it found unreferenced is kept when an object has just been pointed at it
+	used map[string]bool
+}
+
+// NewDedupStorage creates a storage wrapper that stores identical payloads once
+func NewDedupStorage(inner StorageService) *DedupStorage {
+	return &DedupStorage{inner: inner}
+}
+
+// SavePayload stores the payload's bytes in its blob, unless the blob already holds
+// them, then a reference to it under objectName. The blob is written first, so a
+// reference never points at a missing blob.
+func (d *DedupStorage) SavePayload(objectName string, data []byte, contentType string, metadata map[string]string) error {
+	return d.SavePayloadContext(context.Background(), objectName, data, contentType, metadata)
+}
+
+// SavePayloadContext saves as SavePayload does, under ctx
+func (d *DedupStorage) SavePayloadContext(ctx context.Context, objectName string, data []byte, contentType string, metadata map[string]string) error {
+	d.saving.RLock()
+	defer d.saving.RUnlock()
+
+	sum := sha256.Sum256(data)
+	reference := dedupReference{
+		Blob:   dedupBlobName(objectName, hex.EncodeToString(sum[:])),
+		Size:   len(data),
+		SHA256: hex.EncodeToString(sum[:]),
+	}
+
+	d.markUsed(reference.Blob)
+	if !d.blobExists(reference.Blob) {
+		if err := savePayload(ctx, d.inner, reference.Blob, data, "application/octet-stream", nil); err != nil {
+			return fmt.Errorf("failed to store blob %s: %w", reference.Blob, err)
+		}
+	} else {
+		log.Printf("Stored %s as a reference to its identical blob %s", objectName, reference.Blob)
+	}
+
+	encoded, err := json.Marshal(reference)
+	if err != nil {
+		return err
+	}
+	withBlob := make(map[string]string, len(metadata)+1)
+	for key, value := range metadata {
+		withBlob[key] = value
+	}
+	withBlob[MetadataDedupBlob] = reference.Blob
+	return savePayload(ctx, d.inner, objectName, append(append([]byte{}, dedupReferenceMagic...), encoded...), contentType, withBlob)
+}
+
+// GetPayload returns an object, reading its bytes from the blob it references
+func (d *DedupStorage) GetPayload(objectName string) ([]byte, error) {
+	return d.GetPayloadContext(context.Background(), objectName)
+}
+
+// GetPayloadContext reads as GetPayload does, under ctx
+func (d *DedupStorage) GetPayloadContext(ctx context.Context, objectName string) ([]byte, error) {
+	data, err := getPayload(ctx, d.inner, objectName)
+	if err != nil {
+		return nil, err
+	}
+	reference, ok := parseDedupReference(data)
+	if !ok {
+		// Stored before deduplication was enabled
+		return data, nil
+	}
+
+	blob, err := getPayload(ctx, d.inner, reference.Blob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s of %s: %w", reference.Blob, objectName, err)
+	}
+	sum := sha256.Sum256(blob)
+	if len(blob) != reference.Size || hex.EncodeToString(sum[:]) != reference.SHA256 {
+		return nil, fmt.Errorf("blob %s does not match the reference of %s", reference.Blob, objectName)
+	}
+	return blob, nil
+}
+
+// ListPayloads lists all payloads in the wrapped storage, without their blobs
+func (d *DedupStorage) ListPayloads() ([]string, error) {
+	return d.ListPayloadsContext(context.Background())
+}
+
+// ListPayloadsContext lists as ListPayloads does, under ctx
+func (d *DedupStorage) ListPayloadsContext(ctx context.Context) ([]string, error) {
+	objects, err := listPayloads(ctx, d.inner)
+	if err != nil {
+		return nil, err
+	}
+	visible := make([]string, 0, len(objects))
+	for _, objectName := range objects {
+		if !dedupBlobPattern.MatchString(objectName) {
+			visible = append(visible, objectName)
+		}
+	}
+	return visible, nil
+}
+
+// ListRequestPayloads lists one request through the wrapped storage; blob names never
+// start with a request's prefix
+func (d *DedupStorage) ListRequestPayloads(requestID string) ([]string, error) {
+	return listRequestObjects(d.inner, requestID)
+}
+
+// ListRequestPayloadsContext lists one request through the wrapped storage under ctx
+func (d *DedupStorage) ListRequestPayloadsContext(ctx context.Context, requestID string) ([]string, error) {
+	return listRequestObjectsContext(ctx, d.inner, requestID)
+}
+
+// DeletePayload removes an object's reference; its blob stays until CollectGarbage
+// finds it unreferenced
+func (d *DedupStorage) DeletePayload(objectName string) error {
+	return d.inner.DeletePayload(objectName)
+}
+
+// DeletePayloadContext removes an object's reference under ctx
+func (d *DedupStorage) DeletePayloadContext(ctx context.Context, objectName string) error {
+	return deletePayload(ctx, d.inner, objectName)
+}
+
+// GetPayloadMetadata returns the wrapped object's content type and metadata, without the blob name
+func (d *DedupStorage) GetPayloadMetadata(objectName string) (string, map[string]string, error) {
+	reader, ok := d.inner.(MetadataReader)
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrMetadataUnsupported, objectName)
+	}
+	contentType, metadata, err := reader.GetPayloadMetadata(objectName)
+	if err != nil {
+		return "", nil, err
+	}
+	return contentType, withoutMetadata(metadata, MetadataDedupBlob), nil
+}
+
+// StatPayload describes an object through the wrapped storage, with the size of the
+// blob it references
+func (d *DedupStorage) StatPayload(objectName string) (*ObjectStat, error) {
+	statter, ok := d.inner.(PayloadStatter)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrStatUnsupported, objectName)
+	}
+	stat, err := statter.StatPayload(objectName)
+	if err != nil {
+		return nil, err
+	}
+	if blob := stat.Metadata[MetadataDedupBlob]; blob != "" {
+		blobStat, err := statter.StatPayload(blob)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat blob %s of %s: %w", blob, objectName, err)
+		}
+		stat.Size = blobStat.Size
+	}
+	stat.Metadata = withoutMetadata(stat.Metadata, MetadataDedupBlob)
+	return stat, nil
+}
+
+// ListPayloadInfo lists the wrapped storage without blobs, giving each object the size
+// of the blob it references
+func (d *DedupStorage) ListPayloadInfo() ([]ObjectInfo, error) {
+	lister, ok := d.inner.(ObjectLister)
+	reader, readable := d.inner.(MetadataReader)
+	if !ok || !readable {
+		return nil, ErrListInfoUnsupported
+	}
+	infos, err := lister.ListPayloadInfo()
+	if err != nil {
+		return nil, err
+	}
+	blobSizes := make(map[string]int64)
+	visible := make([]ObjectInfo, 0, len(infos))
+	for _, info := range infos {
+		if dedupBlobPattern.MatchString(info.ObjectName) {
+			blobSizes[info.ObjectName] = info.Size
+			continue
+		}
+		visible = append(visible, info)
+	}
+	for i, info := range visible {
+		_, metadata, err := reader.GetPayloadMetadata(info.ObjectName)
+		if errors.Is(err, ErrMetadataUnsupported) {
+			return nil, ErrListInfoUnsupported
+		}
+		if err != nil {
+			return nil, err
+		}
+		if size, ok := blobSizes[metadata[MetadataDedupBlob]]; ok {
+			visible[i].Size = size
+		}
+	}
+	return visible, nil
+}
+
+// ComposePayload is unsupported: a server-side compose would append to the reference,
+// so appends fall back to rewriting the object through SavePayload
+func (d *DedupStorage) ComposePayload(objectName string, data []byte, contentType string, metadata map[string]string) (int64, error) {
+	return 0, ErrComposeUnsupported
+}
+
+// CollectGarbage deletes the blobs no object references any more. It gives up
+// without deleting anything when an object's reference cannot be read.
+func (d *DedupStorage) CollectGarbage() (string, error) {
+	d.saving.Lock()
+	d.mu.Lock()
+	d.used = make(map[string]bool)
+	d.mu.Unlock()
+	d.saving.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.used = nil
+		d.mu.Unlock()
+	}()
+
+	objects, err := d.inner.ListPayloads()
+	if err != nil {
+		return "", fmt.Errorf("error listing objects: %v", err)
+	}
+	var blobs []string
+	referenced := make(map[string]bool)
+	for _, objectName := range objects {
+		if dedupBlobPattern.MatchString(objectName) {
+			blobs = append(blobs, objectName)
+			continue
+		}
+		blob, err := d.referencedBlob(objectName)
+		if err != nil {
+			return "", fmt.Errorf("error reading reference of %s: %v", objectName, err)
+		}
+		if blob != "" {
+			referenced[blob] = true
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	removed := 0
+	var failed []string
+	for _, blob := range blobs {
+		if referenced[blob] || d.used[blob] {
+			continue
+		}
+		if err := d.inner.DeletePayload(blob); err != nil {
+			log.Printf("Error removing unreferenced blob %s: %v", blob, err)
+			failed = append(failed, blob)
+			continue
+		}
+		removed++
+	}
+
+	summary := fmt.Sprintf("%d blob(s) referenced by %d object(s), %d unreferenced removed", len(referenced), len(objects)-len(blobs), removed)
+	if len(failed) > 0 {
+		return summary, fmt.Errorf("failed to remove blobs: %v", failed)
+	}
+	return summary, nil
+}
+
+// referencedBlob returns the blob an object references, or "" for an object stored
+// whole, from its metadata when storage exposes it
+func (d *DedupStorage) referencedBlob(objectName string) (string, error) {
+	if reader, ok := d.inner.(MetadataReader); ok {
+		_, metadata, err := reader.GetPayloadMetadata(objectName)
+		if !errors.Is(err, ErrMetadataUnsupported) {
+			return metadata[MetadataDedupBlob], err
+		}
+	}
+	data, err := d.inner.GetPayload(objectName)
+	if err != nil {
+		return "", err
+	}
+	reference, _ := parseDedupReference(data)
+	return reference.Blob, nil
+}
+
+// markUsed keeps a running garbage collection from removing blob
+func (d *DedupStorage) markUsed(blob string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.used != nil {
+		d.used[blob] = true
+	}
+}
+
+// blobExists reports whether a blob is already stored
+func (d *DedupStorage) blobExists(blob string) bool {
+	if reader, ok := d.inner.(MetadataReader); ok {
+		_, _, err := reader.GetPayloadMetadata(blob)
+		if !errors.Is(err, ErrMetadataUnsupported) {
+			return err == nil
+		}
+	}
+	_, err := d.inner.GetPayload(blob)
+	return err == nil
+}
+
+// dedupBlobName names the blob of a checksum, under the tenant prefix of objectName
+// when it has one, so tenants never share blobs
+func dedupBlobName(objectName, sum string) string {
+	prefix := ""
+	if tenant, _, ok := strings.Cut(objectName, TenantSeparator); ok && ValidTenant(tenant) {
+		prefix = tenant + TenantSeparator
+	}
+	return prefix + "depot-blob-" + sum
+}
+
+func parseDedupReference(data []byte) (dedupReference, bool) {
+	var reference dedupReference
+	if !bytes.HasPrefix(data, dedupReferenceMagic) {
+		return reference, false
+	}
+	if err := json.Unmarshal(data[len(dedupReferenceMagic):], &reference); err != nil || reference.Blob == "" {
+		return dedupReference{}, false
+	}
+	return reference, true
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Delivery kinds recorded in the delivery log
+const (
+	DeliveryKindCallback = "callback"
+	DeliveryKindForward  = "forward"
+	DeliveryKindReplay   = "replay"
+	DeliveryKindExecHook = "exec-hook"
+)
+
+// DeliveryPending marks a delivery that is still being attempted
+const DeliveryPending = "pending"
+
+// ErrDeliveryNotFound is returned when re-driving an unknown delivery
+var ErrDeliveryNotFound = errors.New("delivery not found")
+
+// ErrDeliveryNotFailed is returned when re-driving a delivery that has not failed
+var ErrDeliveryNotFailed = errors.New("only failed deliveries can be re-driven")
+
+// DeliveryAttempt is one try at sending a delivery
+type DeliveryAttempt struct {
+	Attempt int       `json:"attempt"`
+	Time    time.Time `json:"time"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Delivery is an outbound notification and its attempt history
+type Delivery struct {
+	ID         string            `json:"id"`
+	Kind       string            `json:"kind"`
+	Target     string            `json:"target"`
+	RequestID  string            `json:"request_id"`
+	ObjectName string            `json:"object_name,omitempty"`
+	Status     string            `json:"status"`
+	Attempts   []DeliveryAttempt `json:"attempts"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+// deliveryEntry keeps what is needed to re-drive a delivery alongside its record
+type deliveryEntry struct {
+	delivery Delivery
+	executor *RetryExecutor
+	attempt  func(ctx context.Context) error
+}
+
+// DeliveryLog runs outbound deliveries, records every attempt and keeps failed
+// deliveries available for re-drive. Only the most recent deliveries are retained.
+type DeliveryLog struct {
+	mu        sync.Mutex
+	entries   map[string]*deliveryEntry
+	order     []string
+	nextID    int64
+	retention int
+}
+
+// NewDeliveryLog creates a log retaining up to retention deliveries
+func NewDeliveryLog(retention int) *DeliveryLog {
+	return &DeliveryLog{
+		entries:   make(map[string]*deliveryEntry),
+		retention: retention,
+	}
+}
+
+// Run attempts a delivery under the executor's retry policy and records the outcome
+func (l *DeliveryLog) Run(delivery Delivery, executor *RetryExecutor, attempt func(ctx context.Context) error) error {
+	id := l.add(delivery, executor, attempt)
+	return l.run(id, executor, attempt, true)
+}
+
+// RunOnce makes a single recorded attempt, for synchronous deliveries such as replays
+func (l *DeliveryLog) RunOnce(delivery Delivery, executor *RetryExecutor, attempt func(ctx context.Context) error) error {
+	id := l.add(delivery, executor, attempt)
+	return l.run(id, executor, attempt, false)
+}
+
+// List returns deliveries, newest first, optionally filtered by status and kind
+func (l *DeliveryLog) List(status, kind string, limit int) []Delivery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	deliveries := []Delivery{}
+	for i := len(l.order) - 1; i >= 0 && (limit <= 0 || len(deliveries) < limit); i-- {
+		delivery := l.entries[l.order[i]].delivery
+		if (status == "" || delivery.Status == status) && (kind == "" || delivery.Kind == kind) {
+			delivery.Attempts = append([]DeliveryAttempt{}, delivery.Attempts...)
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries
+}
+
+// Redrive retries a failed delivery in the background under its original retry policy
+func (l *DeliveryLog) Redrive(id string) error {
+	l.mu.Lock()
+	entry, ok := l.entries[id]
+	if !ok {
+		l.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrDeliveryNotFound, id)
+	}
+	if entry.delivery.Status != DeliveryFailed {
+		l.mu.Unlock()
+		return fmt.Errorf("%w: %s is %s", ErrDeliveryNotFailed, id, entry.delivery.Status)
+	}
+	entry.delivery.Status = DeliveryPending
+	entry.delivery.UpdatedAt = time.Now().UTC()
+	l.mu.Unlock()
+
+	go l.run(id, entry.executor, entry.attempt, true)
+	return nil
+}
+
+// RedriveFailed re-drives every failed delivery and returns how many were queued
+func (l *DeliveryLog) RedriveFailed() int {
+	queued := 0
+	for _, delivery := range l.List(DeliveryFailed, "", 0) {
+		if l.Redrive(delivery.ID) == nil {
+			queued++
+		}
+	}
+	return queued
+}
+
+func (l *DeliveryLog) add(delivery Delivery, executor *RetryExecutor, attempt func(ctx context.Context) error) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.nextID++
+	delivery.ID = strconv.FormatInt(l.nextID, 10)
+	delivery.Status = DeliveryPending
+	delivery.Attempts = []DeliveryAttempt{}
+	delivery.CreatedAt = time.Now().UTC()
+	delivery.UpdatedAt = delivery.CreatedAt
+
+	l.entries[delivery.ID] = &deliveryEntry{delivery: delivery, executor: executor, attempt: attempt}
+	l.order = append(l.order, delivery.ID)
+	for l.retention > 0 && len(l.order) > l.retention {
+		delete(l.entries, l.order[0])
+		l.order = l.order[1:]
+	}
+	return delivery.ID
+}
+
+// run executes the attempts and records each one against the delivery
+func (l *DeliveryLog) run(id string, executor *RetryExecutor, attempt func(ctx context.Context) error, retry bool) error {
+	record := func(err error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		entry, ok := l.entries[id]
+		if !ok {
+			return
+		}
+		now := time.Now().UTC()
+		result := DeliveryAttempt{Attempt: len(entry.delivery.Attempts) + 1, Time: now}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		entry.delivery.Attempts = append(entry.delivery.Attempts, result)
+		entry.delivery.UpdatedAt = now
+	}
+	tracked := func(ctx context.Context) error {
+		err := attempt(ctx)
+		record(err)
+		return err
+	}
+
+	var err error
+	if retry {
+		err = executor.Do(tracked, nil)
+	} else {
+		err = executor.Attempt(tracked)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if entry, ok := l.entries[id]; ok {
+		entry.delivery.Status = DeliveryDelivered
+		if err != nil {
+			entry.delivery.Status = DeliveryFailed
+		}
+	}
+	return err
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// depotFSDateLayout names the top-level directories of a DepotFS
+const depotFSDateLayout = "2006-01-02"
+
+// DepotFileInfo describes one entry of a DepotFS
+type DepotFileInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	IsDir   bool
+	// Record is the stored object behind a file; nil for directories
+	Record *ObjectRecord
+}
+
+// DepotFS presents stored payloads as a virtual filesystem for file-based frontends
+// such as SFTP. Payloads are organized as /<YYYY-MM-DD>/<request_id>/<file>, dated
+// (in UTC) by when the request's first object was stored, or as /<request_id>/<file>
+// with SetFlat. A file is named after its object without the request ID prefix.
+// Archived objects are not listed.
+type DepotFS struct {
+	index   MetadataIndex
+	storage StorageService
+	writer  PayloadService
+	remover ObjectRemover
+	flat    bool
+}
+
+// NewDepotFS creates a read-only view of the payloads tracked by index
+func NewDepotFS(index MetadataIndex, storage StorageService) *DepotFS {
+	return &DepotFS{index: index, storage: storage}
+}
+
+// SetWriter makes the filesystem writable: files written under
+// /<YYYY-MM-DD>/<request_id>/ are stored as payloads of that request, and removed
+// files are deleted through remover when it is set
+func (f *DepotFS) SetWriter(writer PayloadService, remover ObjectRemover) {
+	f.writer = writer
+	f.remover = remover
+}
+
+// SetFlat lists request directories at the root instead of under date directories
+func (f *DepotFS) SetFlat(flat bool) {
+	f.flat = flat
+}
+
+// Writable reports whether files can be written
+func (f *DepotFS) Writable() bool {
+	return f.writer != nil
+}
+
+// requestTree groups the hot records by date directory and request ID. In the flat
+// layout every request is under the date "".
+func (f *DepotFS) requestTree() map[string]map[string][]ObjectRecord {
+	byRequest := make(map[string][]ObjectRecord)
+	for _, record := range f.index.List() {
+		if record.StorageTier == StorageTierArchive {
+			continue
+		}
+		byRequest[record.RequestID] = append(byRequest[record.RequestID], record)
+	}
+
+	tree := make(map[string]map[string][]ObjectRecord)
+	if f.flat {
+		tree[""] = make(map[string][]ObjectRecord)
+	}
+	for requestID, records := range byRequest {
+		first := records[0].StoredAt
+		for _, record := range records[1:] {
+			if record.StoredAt.Before(first) {
+				first = record.StoredAt
+			}
+		}
+		date := first.UTC().Format(depotFSDateLayout)
+		if f.flat {
+			date = ""
+		}
+		if tree[date] == nil {
+			tree[date] = make(map[string][]ObjectRecord)
+		}
+		tree[date][requestID] = records
+	}
+	return tree
+}
+
+// splitDepotPath cleans a slash-separated path into its components
+func splitDepotPath(name string) []string {
+	cleaned := strings.Trim(path.Clean("/"+name), "/")
+	if cleaned == "" {
+		return nil
+	}
+	return strings.Split(cleaned, "/")
+}
+
+// treePath splits name into its date, request and file components, inserting the
+// date "" in the flat layout
+func (f *DepotFS) treePath(name string) []string {
+	parts := splitDepotPath(name)
+	if f.flat {
+		return append([]string{""}, parts...)
+	}
+	return parts
+}
+
+// depotFileName names an object inside its request directory
+func depotFileName(record ObjectRecord) string {
+	return strings.TrimPrefix(objectBase(record.ObjectName), record.RequestID+"_")
+}
+
+// Stat describes the entry at name
+func (f *DepotFS) Stat(name string) (DepotFileInfo, error) {
+	parts := splitDepotPath(name)
+	if len(parts) == 0 {
+		return DepotFileInfo{Name: "/", IsDir: true}, nil
+	}
+	parent, err := f.ReadDir(path.Join(parts[:len(parts)-1]...))
+	if err != nil {
+		return DepotFileInfo{}, err
+	}
+	for _, entry := range parent {
+		if entry.Name == parts[len(parts)-1] {
+			return entry, nil
+		}
+	}
+	return DepotFileInfo{}, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+}
+
+// ReadDir lists the directory at name, sorted by name
+func (f *DepotFS) ReadDir(name string) ([]DepotFileInfo, error) {
+	parts := f.treePath(name)
+	if len(parts) > 2 {
+		return nil, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+	}
+	tree := f.requestTree()
+
+	var entries []DepotFileInfo
+	switch len(parts) {
+	case 0:
+		for date, requests := range tree {
+			entries = append(entries, DepotFileInfo{Name: date, IsDir: true, ModTime: latest(requests)})
+		}
+	case 1:
+		requests, ok := tree[parts[0]]
+		if !ok {
+			return nil, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+		}
+		for requestID, records := range requests {
+			entries = append(entries, DepotFileInfo{Name: requestID, IsDir: true, ModTime: latest(map[string][]ObjectRecord{requestID: records})})
+		}
+	case 2:
+		records, ok := tree[parts[0]][parts[1]]
+		if !ok {
+			return nil, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+		}
+		for _, record := range records {
+			entries = append(entries, DepotFileInfo{
+				Name:    depotFileName(record),
+				Size:    int64(record.Size),
+				ModTime: record.StoredAt,
+				Record:  &record,
+			})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+// latest returns when the newest of the records was stored
+func latest(requests map[string][]ObjectRecord) time.Time {
+	var newest time.Time
+	for _, records := range requests {
+		for _, record := range records {
+			if record.StoredAt.After(newest) {
+				newest = record.StoredAt
+			}
+		}
+	}
+	return newest
+}
+
+// ReadFile returns the contents of the file at name
+func (f *DepotFS) ReadFile(name string) ([]byte, error) {
+	info, err := f.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir {
+		return nil, fmt.Errorf("%s: %w: is a directory", name, fs.ErrInvalid)
+	}
+	return f.storage.GetPayload(info.Record.ObjectName)
+}
+
+// CheckWrite reports whether a file may be written at name, so frontends can refuse
+// an upload before receiving it
+func (f *DepotFS) CheckWrite(name string) error {
+	if f.writer == nil {
+		return fmt.Errorf("%s: %w: read-only", name, fs.ErrPermission)
+	}
+	parts := f.treePath(name)
+	if len(parts) != 3 {
+		return fmt.Errorf("%s: %w: files go in a request directory", name, fs.ErrPermission)
+	}
+	if _, err := time.Parse(depotFSDateLayout, parts[0]); err != nil && !f.flat {
+		return fmt.Errorf("%s: %w: %q is not a YYYY-MM-DD directory", name, fs.ErrPermission, parts[0])
+	}
+	return nil
+}
+
+// WriteFile stores data as a payload of the request whose directory contains name.
+// Only the file name and request ID are taken from the path; the payload is dated by
+// when it is stored.
+func (f *DepotFS) WriteFile(name string, data []byte) error {
+	if err := f.CheckWrite(name); err != nil {
+		return err
+	}
+	parts := f.treePath(name)
+	_, err := f.writer.StorePayload(data, "application/octet-stream", parts[2], StoreOptions{RequestID: parts[1], Source: "fs"})
+	return err
+}
+
+// Remove deletes the file at name
+func (f *DepotFS) Remove(name string) error {
+	if f.remover == nil {
+		return fmt.Errorf("%s: %w: read-only", name, fs.ErrPermission)
+	}
+	info, err := f.Stat(name)
+	if err != nil {
+		return err
+	}
+	if info.IsDir {
+		return fmt.Errorf("%s: %w: directories disappear with their last file", name, fs.ErrPermission)
+	}
+	return f.remover.RemoveObject(*info.Record)
+}
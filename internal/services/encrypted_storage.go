@@ -0,0 +1,434 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Object metadata written by EncryptedStorage
+const (
+	// MetadataEncryptionKeyID records which key encrypted (or wrapped the data key of) an object
+	MetadataEncryptionKeyID = "Encryption-Key-Id"
+	// MetadataWrappedKey holds the base64 wrapped data key of envelope-encrypted objects
+	MetadataWrappedKey = "Encryption-Wrapped-Key"
+)
+
+// gcmOverhead is the standard GCM nonce and tag every encrypted object carries
+const gcmOverhead = 12 + 16
+
+// encryptedMagic prefixes objects encrypted with a static keyring key, followed by
+// the key ID length, the key ID, the GCM nonce and the ciphertext
+var encryptedMagic = []byte("DPE1")
+
+// envelopeMagic prefixes envelope-encrypted objects, followed by the GCM nonce and
+// the ciphertext; the wrapped data key lives in the object metadata
+var envelopeMagic = []byte("DPE2")
+
+// ErrUnknownEncryptionKey is returned when an object was encrypted with a key missing from the keyring
+var ErrUnknownEncryptionKey = errors.New("unknown encryption key")
+
+// Keyring holds the active encryption key plus any retired keys still accepted for decryption
+type Keyring struct {
+	activeID string
+	keys     map[string][]byte
+}
+
+// NewKeyring creates a keyring of AES-256 keys; activeID selects the key used for new writes
+func NewKeyring(keys map[string][]byte, activeID string) (*Keyring, error) {
+	for id, key := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("invalid encryption key ID %q", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption key %s must be 32 bytes, got %d", id, len(key))
+		}
+	}
+	if _, ok := keys[activeID]; !ok {
+		return nil, fmt.Errorf("active encryption key %q is not in the keyring", activeID)
+	}
+	return &Keyring{activeID: activeID, keys: keys}, nil
+}
+
+// ParseEncryptionKeys parses "id:base64key,id:base64key" into a key map
+func ParseEncryptionKeys(spec string) (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("encryption key entry %q must be id:base64key", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s: %v", id, err)
+		}
+		keys[strings.TrimSpace(id)] = key
+	}
+	return keys, nil
+}
+
+// ActiveKeyID returns the ID of the key used for new writes
+func (k *Keyring) ActiveKeyID() string {
+	return k.activeID
+}
+
+// EncryptedStorage encrypts payloads with AES-256-GCM before handing them to the wrapped storage
+type EncryptedStorage struct {
+	inner   StorageService
+	keyring *Keyring
+	wrapper KeyWrapper
+}
+
+// NewEncryptedStorage wraps a storage service with at-rest encryption
+func NewEncryptedStorage(inner StorageService, keyring *Keyring) *EncryptedStorage {
+	return &EncryptedStorage{
+		inner:   inner,
+		keyring: keyring,
+	}
+}
+
+// NewEnvelopeStorage wraps a storage service with envelope encryption: each object gets
+// its own data key, wrapped by an external key manager. The optional keyring still
+// decrypts objects written under static keys.
+func NewEnvelopeStorage(inner StorageService, wrapper KeyWrapper, keyring *Keyring) *EncryptedStorage {
+	return &EncryptedStorage{
+		inner:   inner,
+		keyring: keyring,
+		wrapper: wrapper,
+	}
+}
+
+// ActiveKeyID returns the ID of the key protecting new writes
+func (e *EncryptedStorage) ActiveKeyID() string {
+	if e.wrapper != nil {
+		return e.wrapper.KeyID()
+	}
+	return e.keyring.activeID
+}
+
+// SavePayload encrypts data with the active key and records its ID in the object metadata
+func (e *EncryptedStorage) SavePayload(objectName string, data []byte, contentType string, metadata map[string]string) error {
+	return e.SavePayloadContext(context.Background(), objectName, data, contentType, metadata)
+}
+
+// SavePayloadContext saves as SavePayload does, under ctx
+func (e *EncryptedStorage) SavePayloadContext(ctx context.Context, objectName string, data []byte, contentType string, metadata map[string]string) error {
+	withKey := make(map[string]string, len(metadata)+2)
+	for key, value := range metadata {
+		withKey[key] = value
+	}
+	delete(withKey, MetadataWrappedKey)
+	withKey[MetadataEncryptionKeyID] = e.ActiveKeyID()
+
+	var sealed []byte
+	var err error
+	if e.wrapper != nil {
+		var wrapped []byte
+		sealed, wrapped, err = e.sealEnvelope(data)
+		withKey[MetadataWrappedKey] = base64.StdEncoding.EncodeToString(wrapped)
+	} else {
+		sealed, err = e.encrypt(data)
+	}
+	if err != nil {
+		return err
+	}
+	return savePayload(ctx, e.inner, objectName, sealed, contentType, withKey)
+}
+
+// GetPayload decrypts an object with whichever key wrote it; unencrypted objects are returned as-is
+func (e *EncryptedStorage) GetPayload(objectName string) ([]byte, error) {
+	return e.GetPayloadContext(context.Background(), objectName)
+}
+
+// GetPayloadContext reads as GetPayload does, under ctx
+func (e *EncryptedStorage) GetPayloadContext(ctx context.Context, objectName string) ([]byte, error) {
+	data, err := getPayload(ctx, e.inner, objectName)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := e.open(objectName, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt object %s: %w", objectName, err)
+	}
+	return plain, nil
+}
+
+// ListPayloads lists all payloads in the wrapped storage
+func (e *EncryptedStorage) ListPayloads() ([]string, error) {
+	return e.inner.ListPayloads()
+}
+
+// ListPayloadsContext lists the wrapped storage under ctx
+func (e *EncryptedStorage) ListPayloadsContext(ctx context.Context) ([]string, error) {
+	return listPayloads(ctx, e.inner)
+}
+
+// DeletePayload removes a payload from the wrapped storage
+func (e *EncryptedStorage) DeletePayload(objectName string) error {
+	return e.inner.DeletePayload(objectName)
+}
+
+// DeletePayloadContext removes a payload from the wrapped storage under ctx
+func (e *EncryptedStorage) DeletePayloadContext(ctx context.Context, objectName string) error {
+	return deletePayload(ctx, e.inner, objectName)
+}
+
+// GetPayloadMetadata returns the wrapped object's content type and metadata, without the encryption keys
+func (e *EncryptedStorage) GetPayloadMetadata(objectName string) (string, map[string]string, error) {
+	reader, ok := e.inner.(MetadataReader)
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrMetadataUnsupported, objectName)
+	}
+	contentType, metadata, err := reader.GetPayloadMetadata(objectName)
+	if err != nil {
+		return "", nil, err
+	}
+	return contentType, withoutMetadata(metadata, MetadataEncryptionKeyID, MetadataWrappedKey), nil
+}
+
+// StatPayload describes an object through the wrapped storage, with the size of its
+// plaintext and without the encryption keys
+func (e *EncryptedStorage) StatPayload(objectName string) (*ObjectStat, error) {
+	statter, ok := e.inner.(PayloadStatter)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrStatUnsupported, objectName)
+	}
+	stat, err := statter.StatPayload(objectName)
+	if err != nil {
+		return nil, err
+	}
+	stat.Size = plaintextSize(stat.Size, stat.Metadata)
+	stat.Metadata = withoutMetadata(stat.Metadata, MetadataEncryptionKeyID, MetadataWrappedKey)
+	return stat, nil
+}
+
+// ListPayloadInfo lists the wrapped storage with the size of each object's plaintext,
+// worked out from the key its metadata names
+func (e *EncryptedStorage) ListPayloadInfo() ([]ObjectInfo, error) {
+	lister, ok := e.inner.(ObjectLister)
+	reader, readable := e.inner.(MetadataReader)
+	if !ok || !readable {
+		return nil, ErrListInfoUnsupported
+	}
+	infos, err := lister.ListPayloadInfo()
+	if err != nil {
+		return nil, err
+	}
+	for i := range infos {
+		_, metadata, err := reader.GetPayloadMetadata(infos[i].ObjectName)
+		if errors.Is(err, ErrMetadataUnsupported) {
+			return nil, ErrListInfoUnsupported
+		}
+		if err != nil {
+			return nil, err
+		}
+		infos[i].Size = plaintextSize(infos[i].Size, metadata)
+	}
+	return infos, nil
+}
+
+// plaintextSize removes the encryption header and GCM tag from the stored size of an
+// object; objects without a key ID are stored unencrypted
+func plaintextSize(stored int64, metadata map[string]string) int64 {
+	keyID := metadata[MetadataEncryptionKeyID]
+	switch {
+	case metadata[MetadataWrappedKey] != "":
+		return stored - int64(len(envelopeMagic)+gcmOverhead)
+	case keyID != "":
+		return stored - int64(len(encryptedMagic)+1+len(keyID)+gcmOverhead)
+	}
+	return stored
+}
+
+// RotateKeys re-encrypts every object not written under the active key, including
+// unencrypted ones, and returns how many were rewritten
+func (e *EncryptedStorage) RotateKeys() (int, error) {
+	objects, err := e.inner.ListPayloads()
+	if err != nil {
+		return 0, err
+	}
+
+	rotated := 0
+	for _, objectName := range objects {
+		data, err := e.inner.GetPayload(objectName)
+		if err != nil {
+			return rotated, err
+		}
+		contentType, metadata := "", map[string]string{}
+		if reader, ok := e.inner.(MetadataReader); ok {
+			contentType, metadata, err = reader.GetPayloadMetadata(objectName)
+			if err != nil {
+				return rotated, err
+			}
+		}
+		if e.currentKeyID(data, metadata) == e.ActiveKeyID() {
+			continue
+		}
+
+		plain, err := e.openWith(data, metadata)
+		if err != nil {
+			return rotated, fmt.Errorf("failed to decrypt object %s: %w", objectName, err)
+		}
+		if err := e.SavePayload(objectName, plain, contentType, metadata); err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+	return rotated, nil
+}
+
+// currentKeyID returns the ID of the key protecting a stored object, or "" when unencrypted
+func (e *EncryptedStorage) currentKeyID(data []byte, metadata map[string]string) string {
+	if bytes.HasPrefix(data, envelopeMagic) {
+		return metadata[MetadataEncryptionKeyID]
+	}
+	keyID, _ := encryptionKeyID(data)
+	return keyID
+}
+
+// open decrypts a stored object, reading its metadata only when it is envelope-encrypted
+func (e *EncryptedStorage) open(objectName string, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, envelopeMagic) {
+		return e.decrypt(data)
+	}
+	reader, ok := e.inner.(MetadataReader)
+	if !ok {
+		return nil, errors.New("storage cannot read the wrapped data key")
+	}
+	_, metadata, err := reader.GetPayloadMetadata(objectName)
+	if err != nil {
+		return nil, err
+	}
+	return e.openWith(data, metadata)
+}
+
+// openWith decrypts a stored object given its metadata
+func (e *EncryptedStorage) openWith(data []byte, metadata map[string]string) ([]byte, error) {
+	if !bytes.HasPrefix(data, envelopeMagic) {
+		return e.decrypt(data)
+	}
+	if e.wrapper == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEncryptionKey, metadata[MetadataEncryptionKeyID])
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(metadata[MetadataWrappedKey])
+	if err != nil || len(wrapped) == 0 {
+		return nil, errors.New("missing or invalid wrapped data key")
+	}
+	dataKey, err := e.wrapper.UnwrapKey(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	headerLen := len(envelopeMagic) + gcm.NonceSize()
+	if len(data) < headerLen+gcm.Overhead() {
+		return nil, errors.New("encrypted object is truncated")
+	}
+	header := data[:headerLen]
+	return gcm.Open(nil, header[len(envelopeMagic):], data[headerLen:], header)
+}
+
+// sealEnvelope encrypts data under a fresh data key and returns the wrapped key
+func (e *EncryptedStorage) sealEnvelope(data []byte) ([]byte, []byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	wrapped, err := e.wrapper.WrapKey(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+
+	header := append(append([]byte{}, envelopeMagic...), nonce...)
+	sealed := make([]byte, len(header), len(header)+len(data)+gcm.Overhead())
+	copy(sealed, header)
+	return gcm.Seal(sealed, nonce, data, header), wrapped, nil
+}
+
+func (e *EncryptedStorage) encrypt(data []byte) ([]byte, error) {
+	gcm, err := newGCM(e.keyring.keys[e.keyring.activeID])
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	header := append([]byte{}, encryptedMagic...)
+	header = append(header, byte(len(e.keyring.activeID)))
+	header = append(header, e.keyring.activeID...)
+	header = append(header, nonce...)
+	// The header is authenticated so the key ID cannot be swapped
+	sealed := make([]byte, len(header), len(header)+len(data)+gcm.Overhead())
+	copy(sealed, header)
+	return gcm.Seal(sealed, nonce, data, header), nil
+}
+
+func (e *EncryptedStorage) decrypt(data []byte) ([]byte, error) {
+	keyID, ok := encryptionKeyID(data)
+	if !ok {
+		return data, nil
+	}
+	if e.keyring == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEncryptionKey, keyID)
+	}
+	key, ok := e.keyring.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEncryptionKey, keyID)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	headerLen := len(encryptedMagic) + 1 + len(keyID) + gcm.NonceSize()
+	if len(data) < headerLen+gcm.Overhead() {
+		return nil, errors.New("encrypted object is truncated")
+	}
+	header := data[:headerLen]
+	nonce := header[headerLen-gcm.NonceSize():]
+	return gcm.Open(nil, nonce, data[headerLen:], header)
+}
+
+// encryptionKeyID returns the key ID from an encrypted object's header
+func encryptionKeyID(data []byte) (string, bool) {
+	if !bytes.HasPrefix(data, encryptedMagic) || len(data) <= len(encryptedMagic) {
+		return "", false
+	}
+	idLen := int(data[len(encryptedMagic)])
+	start := len(encryptedMagic) + 1
+	if idLen == 0 || len(data) < start+idLen {
+		return "", false
+	}
+	return string(data[start : start+idLen]), true
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
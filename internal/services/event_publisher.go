@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventPayloadStored is the type of the event published for every stored object
+const EventPayloadStored = "payload.stored"
+
+// Event serializations
+const (
+	// EventFormatJSON publishes {"type", "time", "object"}, like the changes feed
+	EventFormatJSON = "json"
+	// EventFormatCloudEvents publishes CloudEvents 1.0 in structured JSON mode
+	EventFormatCloudEvents = "cloudevents"
+)
+
+// eventSource is the CloudEvents source of the depot's events
+const eventSource = "simple-depot"
+
+// eventRetryPolicy retries publishes the broker refuses
+var eventRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	Backoff:        BackoffExponential,
+	InitialBackoff: Duration(500 * time.Millisecond),
+	MaxBackoff:     Duration(5 * time.Second),
+	Timeout:        Duration(10 * time.Second),
+}
+
+// EventSink delivers serialized events to a message broker, keyed so that the events
+// of one request stay in order
+type EventSink interface {
+	Publish(ctx context.Context, key string, value []byte) error
+	Close() error
+}
+
+// PayloadEvent is the json serialization of an event
+type PayloadEvent struct {
+	Type   string       `json:"type"`
+	Time   time.Time    `json:"time"`
+	Object ObjectRecord `json:"object"`
+}
+
+// cloudEvent is the cloudevents serialization of an event
+type cloudEvent struct {
+	SpecVersion     string       `json:"specversion"`
+	ID              string       `json:"id"`
+	Source          string       `json:"source"`
+	Type            string       `json:"type"`
+	Time            time.Time    `json:"time"`
+	Subject         string       `json:"subject"`
+	DataContentType string       `json:"datacontenttype"`
+	Data            ObjectRecord `json:"data"`
+}
+
+// EventPublisher publishes a payload.stored event for every object the depot stores,
+// so stream consumers need not poll /list. Events are queued and published in the
+// background, so a slow broker never holds up saves; when the queue is full, events
+// are dropped and logged.
+type EventPublisher struct {
+	sink   EventSink
+	format string
+	policy RetryPolicy
+
+	// mu guards sends on events against Close closing it
+	mu      sync.RWMutex
+	closed  bool
+	events  chan ObjectRecord
+	done    chan struct{}
+	dropped atomic.Int64
+	failed  atomic.Int64
+}
+
+// NewEventPublisher creates a publisher serializing events as format, "json" or
+// "cloudevents", and queueing up to buffer of them
+func NewEventPublisher(sink EventSink, format string, buffer int) (*EventPublisher, error) {
+	if format != EventFormatJSON && format != EventFormatCloudEvents {
+		return nil, fmt.Errorf("unsupported event format %q; use json or cloudevents", format)
+	}
+	policy, err := eventRetryPolicy.WithDefaults()
+	if err != nil {
+		return nil, err
+	}
+	publisher := &EventPublisher{
+		sink:   sink,
+		format: format,
+		policy: policy,
+		events: make(chan ObjectRecord, max(buffer, 1)),
+		done:   make(chan struct{}),
+	}
+	go publisher.run()
+	return publisher, nil
+}
+
+// PayloadStored queues the object's event
+func (p *EventPublisher) PayloadStored(record ObjectRecord) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return
+	}
+	select {
+	case p.events <- record:
+	default:
+		dropped := p.dropped.Add(1)
+		log.Printf("Events: queue full, dropping the event of %s (%d dropped so far)", record.ObjectName, dropped)
+	}
+}
+
+// PayloadDeleted is a no-op; only stored payloads are published
+func (p *EventPublisher) PayloadDeleted(record ObjectRecord) {}
+
+// Dropped returns how many events were dropped because the queue was full
+func (p *EventPublisher) Dropped() int64 {
+	return p.dropped.Load()
+}
+
+// Failed returns how many events the broker refused on every attempt
+func (p *EventPublisher) Failed() int64 {
+	return p.failed.Load()
+}
+
+// Close publishes the events still queued, for shutdown, then closes the sink. It
+// gives up on them when ctx ends first. Events stored after Close are dropped.
+func (p *EventPublisher) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.events)
+	}
+	p.mu.Unlock()
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return p.sink.Close()
+}
+
+func (p *EventPublisher) run() {
+	defer close(p.done)
+	for record := range p.events {
+		value, err := p.serialize(record)
+		if err != nil {
+			log.Printf("Events: failed to serialize the event of %s: %v", record.ObjectName, err)
+			continue
+		}
+		if err := p.publish(record.RequestID, value); err != nil {
+			p.failed.Add(1)
+			log.Printf("Events: failed to publish the event of %s: %v", record.ObjectName, err)
+		}
+	}
+}
+
+// publish sends one event, retrying with backoff while the broker refuses it
+func (p *EventPublisher) publish(key string, value []byte) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(p.policy.Timeout))
+		err = p.sink.Publish(ctx, key, value)
+		cancel()
+		if err == nil || attempt >= p.policy.MaxAttempts {
+			return err
+		}
+		time.Sleep(p.policy.Delay(attempt))
+	}
+}
+
+// serialize encodes an object's event in the publisher's format
+func (p *EventPublisher) serialize(record ObjectRecord) ([]byte, error) {
+	now := time.Now().UTC()
+	if p.format == EventFormatJSON {
+		return json.Marshal(PayloadEvent{Type: EventPayloadStored, Time: now, Object: record})
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	return json.Marshal(cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              hex.EncodeToString(id),
+		Source:          eventSource,
+		Type:            EventPayloadStored,
+		Time:            now,
+		Subject:         record.ObjectName,
+		DataContentType: "application/json",
+		Data:            record,
+	})
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/config"
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+// NewEventSink connects to the broker events are published to: "kafka" or "nats"
+func NewEventSink(config *config.Config) (EventSink, error) {
+	switch config.EventsPublisher {
+	case "kafka":
+		return newKafkaEventSink(config)
+	case "nats":
+		return newNATSEventSink(config)
+	}
+	return nil, fmt.Errorf("unsupported event publisher %q; use kafka or nats", config.EventsPublisher)
+}
+
+// kafkaEventSink writes events to a Kafka topic, keyed by request ID so the events
+// of one request land on one partition
+type kafkaEventSink struct {
+	writer *kafka.Writer
+}
+
+// newKafkaEventSink writes to the event brokers, or else the consumer's brokers, with
+// the consumer's TLS and SASL settings
+func newKafkaEventSink(config *config.Config) (*kafkaEventSink, error) {
+	brokers := config.EventsKafkaBrokers
+	if len(brokers) == 0 {
+		brokers = config.KafkaBrokers
+	}
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("no Kafka brokers configured")
+	}
+	transport := &kafka.Transport{DialTimeout: 10 * time.Second}
+	if config.KafkaTLS {
+		transport.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if config.KafkaUsername != "" {
+		transport.SASL = plain.Mechanism{Username: config.KafkaUsername, Password: config.KafkaPassword}
+	}
+	return &kafkaEventSink{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        config.EventsTopic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: 10 * time.Millisecond,
+		Transport:    transport,
+	}}, nil
+}
+
+func (s *kafkaEventSink) Publish(ctx context.Context, key string, value []byte) error {
+	return s.writer.WriteMessages(ctx, kafka.Message{
+		Key:     []byte(key),
+		Value:   value,
+		Headers: []kafka.Header{{Key: "Content-Type", Value: []byte("application/json")}},
+	})
+}
+
+func (s *kafkaEventSink) Close() error {
+	return s.writer.Close()
+}
+
+// natsEventSink publishes events on a NATS subject
+type natsEventSink struct {
+	conn    *nats.Conn
+	subject string
+}
+
+// newNATSEventSink connects to the NATS server, reconnecting for as long as the depot runs
+func newNATSEventSink(config *config.Config) (*natsEventSink, error) {
+	conn, err := nats.Connect(config.EventsNATSURL, nats.Name("simple-depot"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %v", err)
+	}
+	return &natsEventSink{conn: conn, subject: config.EventsTopic}, nil
+}
+
+// Publish sends the event and waits for the server to acknowledge the connection's
+// traffic, so a lost connection is reported instead of buffered away. NATS has no
+// message keys; the request ID travels in the Depot-Request-Id header.
+func (s *natsEventSink) Publish(ctx context.Context, key string, value []byte) error {
+	message := nats.NewMsg(s.subject)
+	message.Header.Set("Depot-Request-Id", key)
+	message.Header.Set("Content-Type", "application/json")
+	message.Data = value
+	if err := s.conn.PublishMsg(message); err != nil {
+		return err
+	}
+	return s.conn.FlushWithContext(ctx)
+}
+
+func (s *natsEventSink) Close() error {
+	return s.conn.Drain()
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxHookOutput bounds how much of a failed hook's output is kept in its error
+const maxHookOutput = 512
+
+// ExecHook runs an external command after every payload is stored, so custom processing
+// can be wired in without changing the depot. The command gets the stored object's
+// details as DEPOT_* environment variables and its metadata record as JSON on stdin.
+// Runs are bounded by the policy's concurrency and timeout and recorded as deliveries.
+type ExecHook struct {
+	command    []string
+	bucket     string
+	executor   *RetryExecutor
+	deliveries DeliveryTracker
+}
+
+// NewExecHook creates a hook running command, a program and its arguments separated by
+// spaces; bucket is reported to the command in DEPOT_BUCKET and DEPOT_OBJECT_PATH
+func NewExecHook(command, bucket string, policy RetryPolicy, deliveries DeliveryTracker) (*ExecHook, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, errors.New("exec hook command is empty")
+	}
+	if _, err := exec.LookPath(fields[0]); err != nil {
+		return nil, fmt.Errorf("exec hook command: %v", err)
+	}
+	return &ExecHook{
+		command:    fields,
+		bucket:     bucket,
+		executor:   NewRetryExecutor(policy),
+		deliveries: deliveries,
+	}, nil
+}
+
+// PayloadStored runs the hook in the background; self-test probes are skipped
+func (h *ExecHook) PayloadStored(record ObjectRecord) {
+	if slices.Contains(record.Tags, SelfTestTag) {
+		return
+	}
+	delivery := Delivery{Kind: DeliveryKindExecHook, Target: h.command[0], RequestID: record.RequestID, ObjectName: record.ObjectName}
+	go func() {
+		err := h.deliveries.Run(delivery, h.executor, func(ctx context.Context) error {
+			return h.run(ctx, record)
+		})
+		if err != nil {
+			log.Printf("Exec hook for %s failed after %d attempt(s): %v", record.ObjectName, h.executor.Policy().MaxAttempts, err)
+		}
+	}()
+}
+
+// PayloadDeleted is a no-op; hooks only run for stored payloads
+func (h *ExecHook) PayloadDeleted(record ObjectRecord) {}
+
+func (h *ExecHook) run(ctx context.Context, record ObjectRecord) error {
+	input, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, h.command[0], h.command[1:]...)
+	cmd.Env = append(os.Environ(),
+		"DEPOT_REQUEST_ID="+record.RequestID,
+		"DEPOT_OBJECT_NAME="+record.ObjectName,
+		"DEPOT_OBJECT_PATH="+h.bucket+"/"+record.ObjectName,
+		"DEPOT_BUCKET="+h.bucket,
+		"DEPOT_ORIGINAL_FILENAME="+record.OriginalFilename,
+		"DEPOT_CONTENT_TYPE="+record.ContentType,
+		"DEPOT_SIZE="+strconv.Itoa(record.Size),
+		"DEPOT_SHA256="+record.SHA256,
+		"DEPOT_TAGS="+strings.Join(record.Tags, ","),
+		"DEPOT_STORED_AT="+record.StoredAt.Format(time.RFC3339Nano),
+	)
+	cmd.Stdin = bytes.NewReader(input)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// Do not wait for grandchildren holding the output open once the command is killed
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("timed out after %s", time.Duration(h.executor.Policy().Timeout))
+		}
+		out := strings.TrimSpace(output.String())
+		if len(out) > maxHookOutput {
+			out = "..." + out[len(out)-maxHookOutput:]
+		}
+		if out == "" {
+			return err
+		}
+		return fmt.Errorf("%v: %s", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Export formats supported by DefaultExporter
+const (
+	ExportFormatCSV     = "csv"
+	ExportFormatParquet = "parquet"
+)
+
+// Metadata columns prepended to every exported row
+const (
+	exportColumnRequestID  = "_request_id"
+	exportColumnObjectName = "_object_name"
+	exportColumnStoredAt   = "_stored_at"
+)
+
+// ErrExportTooLarge is wrapped by errors for exports selecting more rows or payload
+// bytes than the exporter allows
+var ErrExportTooLarge = errors.New("export too large")
+
+// ExportField maps an output column to a query expression evaluated per payload
+type ExportField struct {
+	Column string
+	Expr   string
+}
+
+// ExportRequest selects JSON payloads and describes how to flatten them
+type ExportRequest struct {
+	Format string
+	Prefix string
+	Tag    string
+	After  time.Time
+	Before time.Time
+	Fields []ExportField
+}
+
+// DefaultExporter flattens JSON payloads selected from the metadata index into tabular files
+type DefaultExporter struct {
+	index     MetadataIndex
+	storage   StorageService
+	evaluator JSONQueryEvaluator
+	maxRows   int
+	maxBytes  int64
+}
+
+// NewDefaultExporter creates a new exporter
+func NewDefaultExporter(index MetadataIndex, storage StorageService, evaluator JSONQueryEvaluator) *DefaultExporter {
+	return &DefaultExporter{
+		index:     index,
+		storage:   storage,
+		evaluator: evaluator,
+	}
+}
+
+// SetLimits caps an export at maxRows rows and maxBytes of payload data, as the
+// whole export is held in memory to find its columns; 0 removes a cap
+func (e *DefaultExporter) SetLimits(maxRows int, maxBytes int64) {
+	e.maxRows = maxRows
+	e.maxBytes = maxBytes
+}
+
+// Export writes the selected payloads to w in the requested format and returns the
+// row count. Selections over the exporter's limits fail with ErrExportTooLarge before
+// anything is written.
+func (e *DefaultExporter) Export(w io.Writer, req ExportRequest) (int, error) {
+	var columns []string
+	var rows []map[string]string
+	var loaded int64
+	seen := make(map[string]bool)
+
+	for _, record := range e.index.List() {
+		if !matchesExport(record, req) {
+			continue
+		}
+		if e.maxRows > 0 && len(rows) >= e.maxRows {
+			return 0, fmt.Errorf("%w: more than %d rows selected; narrow the selection", ErrExportTooLarge, e.maxRows)
+		}
+		if e.maxBytes > 0 && loaded+int64(record.Size) > e.maxBytes {
+			return 0, fmt.Errorf("%w: more than %d bytes of payloads selected; narrow the selection", ErrExportTooLarge, e.maxBytes)
+		}
+		data, err := e.storage.GetPayload(record.ObjectName)
+		if err != nil {
+			log.Printf("Error getting payload for %s: %v", record.ObjectName, err)
+			continue
+		}
+		loaded += int64(len(data))
+		if !json.Valid(data) {
+			continue
+		}
+
+		row, err := e.buildRow(data, req.Fields)
+		if err != nil {
+			return 0, err
+		}
+		row[exportColumnRequestID] = record.RequestID
+		row[exportColumnObjectName] = record.ObjectName
+		row[exportColumnStoredAt] = record.StoredAt.Format(time.RFC3339)
+		rows = append(rows, row)
+
+		if len(req.Fields) == 0 {
+			for column := range row {
+				if !seen[column] {
+					seen[column] = true
+					columns = append(columns, column)
+				}
+			}
+		}
+	}
+
+	if len(req.Fields) > 0 {
+		for _, field := range req.Fields {
+			columns = append(columns, field.Column)
+		}
+	} else {
+		columns = slices.DeleteFunc(columns, isExportMetadataColumn)
+		sort.Strings(columns)
+	}
+	columns = append([]string{exportColumnRequestID, exportColumnObjectName, exportColumnStoredAt}, columns...)
+
+	switch req.Format {
+	case ExportFormatParquet:
+		return len(rows), writeParquet(w, columns, rows)
+	default:
+		return len(rows), writeCSV(w, columns, rows)
+	}
+}
+
+// buildRow evaluates field mappings, or flattens the whole document when none are given
+func (e *DefaultExporter) buildRow(data []byte, fields []ExportField) (map[string]string, error) {
+	row := make(map[string]string)
+	if len(fields) == 0 {
+		var doc any
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		flattenJSON("", doc, row)
+		return row, nil
+	}
+
+	for _, field := range fields {
+		values, err := e.evaluator.Evaluate(data, field.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Column, err)
+		}
+		if len(values) > 0 && values[0] != nil {
+			row[field.Column] = exportValue(values[0])
+		}
+	}
+	return row, nil
+}
+
+func matchesExport(record ObjectRecord, req ExportRequest) bool {
+	if req.Prefix != "" && !strings.HasPrefix(record.RequestID, req.Prefix) && !strings.HasPrefix(record.ObjectName, req.Prefix) {
+		return false
+	}
+	if req.Tag != "" && !slices.Contains(record.Tags, req.Tag) {
+		return false
+	}
+	if !req.After.IsZero() && record.StoredAt.Before(req.After) {
+		return false
+	}
+	if !req.Before.IsZero() && !record.StoredAt.Before(req.Before) {
+		return false
+	}
+	return true
+}
+
+func isExportMetadataColumn(column string) bool {
+	return column == exportColumnRequestID || column == exportColumnObjectName || column == exportColumnStoredAt
+}
+
+// flattenJSON turns nested objects into dot-separated columns; arrays are kept as JSON
+func flattenJSON(prefix string, value any, row map[string]string) {
+	object, ok := value.(map[string]any)
+	if !ok {
+		if prefix == "" {
+			prefix = "value"
+		}
+		if value != nil {
+			row[prefix] = exportValue(value)
+		}
+		return
+	}
+	for key, child := range object {
+		column := key
+		if prefix != "" {
+			column = prefix + "." + key
+		}
+		flattenJSON(column, child, row)
+	}
+}
+
+// exportValue renders a JSON value as a cell; strings are unquoted, everything else is JSON
+func exportValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
+
+func writeCSV(w io.Writer, columns []string, rows []map[string]string) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(columns); err != nil {
+		return err
+	}
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, column := range columns {
+			record[i] = row[column]
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeParquet writes every column as an optional UTF-8 string
+func writeParquet(w io.Writer, columns []string, rows []map[string]string) error {
+	group := make(parquet.Group, len(columns))
+	for _, column := range columns {
+		group[column] = parquet.Optional(parquet.String())
+	}
+	schema := parquet.NewSchema("export", group)
+	fields := schema.Fields()
+
+	parquetRows := make([]parquet.Row, 0, len(rows))
+	for _, row := range rows {
+		values := make(parquet.Row, len(fields))
+		for i, field := range fields {
+			if cell, ok := row[field.Name()]; ok {
+				values[i] = parquet.ByteArrayValue([]byte(cell)).Level(0, 1, i)
+			} else {
+				values[i] = parquet.NullValue().Level(0, 0, i)
+			}
+		}
+		parquetRows = append(parquetRows, values)
+	}
+
+	writer := parquet.NewWriter(w, schema)
+	if _, err := writer.WriteRows(parquetRows); err != nil {
+		return err
+	}
+	return writer.Close()
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Write policies supported by FailoverStorage
+const (
+	// WritePolicyPrimary writes to the first healthy endpoint that accepts the object
+	WritePolicyPrimary = "primary"
+	// WritePolicyAll writes to every healthy endpoint and fails if any of them rejects it
+	WritePolicyAll = "all"
+	// WritePolicyQuorum writes to every healthy endpoint and needs a majority of all endpoints
+	WritePolicyQuorum = "quorum"
+)
+
+// ErrNoHealthyEndpoint is returned when every storage endpoint is down
+var ErrNoHealthyEndpoint = errors.New("no healthy storage endpoint")
+
+// HealthChecker is implemented by storage services that can probe their backend
+type HealthChecker interface {
+	CheckHealth() error
+}
+
+// StorageEndpoint is one named backend behind a FailoverStorage
+type StorageEndpoint struct {
+	Name    string
+	Storage StorageService
+}
+
+// EndpointHealth reports the last health check of an endpoint
+type EndpointHealth struct {
+	Name      string    `json:"name"`
+	Healthy   bool      `json:"healthy"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// FailoverStorage spreads storage operations over a primary endpoint and its replicas.
+// Reads go to the first healthy endpoint that has the object; writes and deletes follow
+// the configured write policy. Endpoints start healthy and are re-checked periodically.
+type FailoverStorage struct {
+	endpoints   []StorageEndpoint
+	writePolicy string
+	interval    time.Duration
+
+	mu     sync.RWMutex
+	health []EndpointHealth
+}
+
+// NewFailoverStorage creates a failover storage over endpoints, listed primary first
+func NewFailoverStorage(endpoints []StorageEndpoint, writePolicy string, interval time.Duration) (*FailoverStorage, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("at least one storage endpoint is required")
+	}
+	switch writePolicy {
+	case WritePolicyPrimary, WritePolicyAll, WritePolicyQuorum:
+	default:
+		return nil, fmt.Errorf("unsupported write policy %q", writePolicy)
+	}
+
+	health := make([]EndpointHealth, len(endpoints))
+	for i, endpoint := range endpoints {
+		health[i] = EndpointHealth{Name: endpoint.Name, Healthy: true}
+	}
+	return &FailoverStorage{
+		endpoints:   endpoints,
+		writePolicy: writePolicy,
+		interval:    interval,
+		health:      health,
+	}, nil
+}
+
+// Start runs the health checks periodically in the background
+func (f *FailoverStorage) Start() {
+	go func() {
+		for {
+			time.Sleep(f.interval)
+			f.CheckOnce()
+		}
+	}()
+}
+
+// CheckOnce probes every endpoint that implements HealthChecker and records the result
+func (f *FailoverStorage) CheckOnce() {
+	for i, endpoint := range f.endpoints {
+		checker, ok := endpoint.Storage.(HealthChecker)
+		if !ok {
+			continue
+		}
+		err := checker.CheckHealth()
+
+		f.mu.Lock()
+		wasHealthy := f.health[i].Healthy
+		f.health[i] = EndpointHealth{Name: endpoint.Name, Healthy: err == nil, CheckedAt: time.Now().UTC()}
+		if err != nil {
+			f.health[i].Error = err.Error()
+		}
+		f.mu.Unlock()
+
+		if wasHealthy && err != nil {
+			log.Printf("Storage endpoint %s is down: %v", endpoint.Name, err)
+		} else if !wasHealthy && err == nil {
+			log.Printf("Storage endpoint %s recovered", endpoint.Name)
+		}
+	}
+}
+
+// Status returns the last known health of every endpoint, primary first
+func (f *FailoverStorage) Status() []EndpointHealth {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return append([]EndpointHealth{}, f.health...)
+}
+
+// healthy returns the endpoints currently considered up, primary first
+func (f *FailoverStorage) healthy() []StorageEndpoint {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	var endpoints []StorageEndpoint
+	for i, endpoint := range f.endpoints {
+		if f.health[i].Healthy {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
+
+// readOrder lists healthy endpoints first, then the unhealthy ones as a last resort
+func (f *FailoverStorage) readOrder() []StorageEndpoint {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	var up, down []StorageEndpoint
+	for i, endpoint := range f.endpoints {
+		if f.health[i].Healthy {
+			up = append(up, endpoint)
+		} else {
+			down = append(down, endpoint)
+		}
+	}
+	return append(up, down...)
+}
+
+// SavePayload writes the object according to the write policy
+func (f *FailoverStorage) SavePayload(objectName string, data []byte, contentType string, metadata map[string]string) error {
+	return f.SavePayloadContext(context.Background(), objectName, data, contentType, metadata)
+}
+
+// SavePayloadContext saves as SavePayload does, under ctx
+func (f *FailoverStorage) SavePayloadContext(ctx context.Context, objectName string, data []byte, contentType string, metadata map[string]string) error {
+	return f.write(objectName, func(storage StorageService) error {
+		return savePayload(ctx, storage, objectName, data, contentType, metadata)
+	})
+}
+
+// DeletePayload removes the object according to the write policy
+func (f *FailoverStorage) DeletePayload(objectName string) error {
+	return f.write(objectName, func(storage StorageService) error {
+		return storage.DeletePayload(objectName)
+	})
+}
+
+// GetPayload reads the object from the first endpoint that returns it
+func (f *FailoverStorage) GetPayload(objectName string) ([]byte, error) {
+	var lastErr error
+	for _, endpoint := range f.readOrder() {
+		data, err := endpoint.Storage.GetPayload(objectName)
+		if err == nil {
+			return data, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// GetPayloadMetadata reads the object's metadata from the first endpoint that returns it
+func (f *FailoverStorage) GetPayloadMetadata(objectName string) (string, map[string]string, error) {
+	lastErr := fmt.Errorf("%w: %s", ErrMetadataUnsupported, objectName)
+	for _, endpoint := range f.readOrder() {
+		reader, ok := endpoint.Storage.(MetadataReader)
+		if !ok {
+			continue
+		}
+		contentType, metadata, err := reader.GetPayloadMetadata(objectName)
+		if err == nil {
+			return contentType, metadata, nil
+		}
+		lastErr = err
+	}
+	return "", nil, lastErr
+}
+
+// StatPayload describes the object from the first endpoint that returns it
+func (f *FailoverStorage) StatPayload(objectName string) (*ObjectStat, error) {
+	lastErr := fmt.Errorf("%w: %s", ErrStatUnsupported, objectName)
+	for _, endpoint := range f.readOrder() {
+		statter, ok := endpoint.Storage.(PayloadStatter)
+		if !ok {
+			continue
+		}
+		stat, err := statter.StatPayload(objectName)
+		if err == nil {
+			return stat, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// ListPayloads lists objects from the first endpoint that answers
+func (f *FailoverStorage) ListPayloads() ([]string, error) {
+	var lastErr error
+	for _, endpoint := range f.readOrder() {
+		objects, err := endpoint.Storage.ListPayloads()
+		if err == nil {
+			return objects, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// ListPayloadInfo lists objects with their details from the first endpoint that answers
+func (f *FailoverStorage) ListPayloadInfo() ([]ObjectInfo, error) {
+	lastErr := ErrListInfoUnsupported
+	for _, endpoint := range f.readOrder() {
+		lister, ok := endpoint.Storage.(ObjectLister)
+		if !ok {
+			continue
+		}
+		infos, err := lister.ListPayloadInfo()
+		if err == nil {
+			return infos, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// write applies op to the healthy endpoints and checks the result against the write policy
+func (f *FailoverStorage) write(objectName string, op func(storage StorageService) error) error {
+	endpoints := f.healthy()
+	if len(endpoints) == 0 {
+		return fmt.Errorf("%w for %s", ErrNoHealthyEndpoint, objectName)
+	}
+
+	if f.writePolicy == WritePolicyPrimary {
+		var lastErr error
+		for _, endpoint := range endpoints {
+			if lastErr = op(endpoint.Storage); lastErr == nil {
+				return nil
+			}
+			log.Printf("Write of %s to %s failed, trying next endpoint: %v", objectName, endpoint.Name, lastErr)
+		}
+		return lastErr
+	}
+
+	errs := make([]error, len(endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range endpoints {
+		wg.Add(1)
+		go func(i int, endpoint StorageEndpoint) {
+			defer wg.Done()
+			if err := op(endpoint.Storage); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", endpoint.Name, err)
+			}
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	var failures []error
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		} else {
+			failures = append(failures, err)
+		}
+	}
+
+	required := len(endpoints)
+	if f.writePolicy == WritePolicyQuorum {
+		required = len(f.endpoints)/2 + 1
+	}
+	if succeeded < required {
+		return fmt.Errorf("write of %s reached %d of %d required endpoint(s): %w", objectName, succeeded, required, errors.Join(failures...))
+	}
+	for _, err := range failures {
+		log.Printf("Write of %s failed on %v", objectName, err)
+	}
+	return nil
+}
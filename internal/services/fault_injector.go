@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// ErrInjectedFault is returned by storage operations the fault injector failed on
+// purpose
+var ErrInjectedFault = errors.New("injected storage fault")
+
+// FaultPlan describes the faults injected into storage. Rates are probabilities
+// between 0 and 1.
+type FaultPlan struct {
+	// Latency delays every operation, plus a random extra of up to Jitter
+	Latency time.Duration
+	Jitter  time.Duration
+	// SaveFailureRate fails writes, including streamed and composed ones
+	SaveFailureRate float64
+	// ReadFailureRate fails reads and listings
+	ReadFailureRate float64
+	// Every OutageEvery, storage is down for OutageFor; 0 disables outages
+	OutageEvery time.Duration
+	OutageFor   time.Duration
+}
+
+// Validate rejects plans with rates outside 0..1 or outages that never end
+func (p FaultPlan) Validate() error {
+	if p.Latency < 0 || p.Jitter < 0 {
+		return fmt.Errorf("fault latency must not be negative")
+	}
+	if p.SaveFailureRate < 0 || p.SaveFailureRate > 1 || p.ReadFailureRate < 0 || p.ReadFailureRate > 1 {
+		return fmt.Errorf("fault rates must be between 0 and 1")
+	}
+	if p.OutageEvery < 0 || p.OutageFor < 0 || (p.OutageFor > 0 && p.OutageFor >= p.OutageEvery) {
+		return fmt.Errorf("outages must be shorter than the interval they repeat on")
+	}
+	return nil
+}
+
+// FaultCounts reports the faults injected since startup
+type FaultCounts struct {
+	Delayed      int64 `json:"delayed"`
+	SaveFailures int64 `json:"save_failures"`
+	ReadFailures int64 `json:"read_failures"`
+	OutageErrors int64 `json:"outage_errors"`
+}
+
+// FaultCounter reports the faults injected into storage
+type FaultCounter interface {
+	Faults() FaultCounts
+}
+
+// FaultInjector wraps a storage service and injects latency, failures and outages,
+// so clients and the depot's own retries can be tested without breaking real storage.
+// It is meant for test environments only.
+type FaultInjector struct {
+	inner   StorageService
+	plan    FaultPlan
+	started time.Time
+
+	mu     sync.Mutex
+	counts FaultCounts
+}
+
+// NewFaultInjector wraps inner, with outages counted from now
+func NewFaultInjector(inner StorageService, plan FaultPlan) (*FaultInjector, error) {
+	if err := plan.Validate(); err != nil {
+		return nil, err
+	}
+	return &FaultInjector{
+		inner:   inner,
+		plan:    plan,
+		started: time.Now(),
+	}, nil
+}
+
+// Faults reports the faults injected so far
+func (f *FaultInjector) Faults() FaultCounts {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.counts
+}
+
+// inject delays an operation and decides whether it fails
+func (f *FaultInjector) inject(op, objectName string, failureRate float64, failures *int64) error {
+	delay := f.plan.Latency
+	if f.plan.Jitter > 0 {
+		delay += rand.N(f.plan.Jitter)
+	}
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if delay > 0 {
+		f.counts.Delayed++
+	}
+	if f.plan.OutageFor > 0 && time.Since(f.started)%f.plan.OutageEvery < f.plan.OutageFor {
+		f.counts.OutageErrors++
+		return fmt.Errorf("%w: storage outage during %s %s", ErrInjectedFault, op, objectName)
+	}
+	if failureRate > 0 && rand.Float64() < failureRate {
+		*failures++
+		return fmt.Errorf("%w: %s %s failed", ErrInjectedFault, op, objectName)
+	}
+	return nil
+}
+
+func (f *FaultInjector) injectSave(objectName string) error {
+	return f.inject("save", objectName, f.plan.SaveFailureRate, &f.counts.SaveFailures)
+}
+
+func (f *FaultInjector) injectRead(op, objectName string) error {
+	return f.inject(op, objectName, f.plan.ReadFailureRate, &f.counts.ReadFailures)
+}
+
+// SavePayload writes to the wrapped storage unless a fault is injected
+func (f *FaultInjector) SavePayload(objectName string, data []byte, contentType string, metadata map[string]string) error {
+	return f.SavePayloadContext(context.Background(), objectName, data, contentType, metadata)
+}
+
+// SavePayloadContext saves as SavePayload does, under ctx
+func (f *FaultInjector) SavePayloadContext(ctx context.Context, objectName string, data []byte, contentType string, metadata map[string]string) error {
+	if err := f.injectSave(objectName); err != nil {
+		return err
+	}
+	return savePayload(ctx, f.inner, objectName, data, contentType, metadata)
+}
+
+// GetPayload reads from the wrapped storage unless a fault is injected
+func (f *FaultInjector) GetPayload(objectName string) ([]byte, error) {
+	return f.GetPayloadContext(context.Background(), objectName)
+}
+
+// GetPayloadContext reads as GetPayload does, under ctx
+func (f *FaultInjector) GetPayloadContext(ctx context.Context, objectName string) ([]byte, error) {
+	if err := f.injectRead("read", objectName); err != nil {
+		return nil, err
+	}
+	return getPayload(ctx, f.inner, objectName)
+}
+
+// GetPayloadStream opens an object in the wrapped storage unless a fault is injected
+func (f *FaultInjector) GetPayloadStream(objectName string) (io.ReadCloser, int64, error) {
+	reader, ok := f.inner.(StreamReader)
+	if !ok {
+		return nil, 0, ErrReadStreamUnsupported
+	}
+	if err := f.injectRead("read", objectName); err != nil {
+		return nil, 0, err
+	}
+	return reader.GetPayloadStream(objectName)
+}
+
+// GetPayloadMetadata reads metadata from the wrapped storage, when it exposes any
+func (f *FaultInjector) GetPayloadMetadata(objectName string) (string, map[string]string, error) {
+	reader, ok := f.inner.(MetadataReader)
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrMetadataUnsupported, objectName)
+	}
+	if err := f.injectRead("read metadata of", objectName); err != nil {
+		return "", nil, err
+	}
+	return reader.GetPayloadMetadata(objectName)
+}
+
+// ListPayloads lists the wrapped storage unless a fault is injected
+func (f *FaultInjector) ListPayloads() ([]string, error) {
+	return f.ListPayloadsContext(context.Background())
+}
+
+// ListPayloadsContext lists as ListPayloads does, under ctx
+func (f *FaultInjector) ListPayloadsContext(ctx context.Context) ([]string, error) {
+	if err := f.injectRead("list", "bucket"); err != nil {
+		return nil, err
+	}
+	return listPayloads(ctx, f.inner)
+}
+
+// StatPayload describes an object through the wrapped storage unless a fault is injected
+func (f *FaultInjector) StatPayload(objectName string) (*ObjectStat, error) {
+	statter, ok := f.inner.(PayloadStatter)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrStatUnsupported, objectName)
+	}
+	if err := f.injectRead("stat", objectName); err != nil {
+		return nil, err
+	}
+	return statter.StatPayload(objectName)
+}
+
+// ListPayloadInfo lists the wrapped storage with object details unless a fault is injected
+func (f *FaultInjector) ListPayloadInfo() ([]ObjectInfo, error) {
+	lister, ok := f.inner.(ObjectLister)
+	if !ok {
+		return nil, ErrListInfoUnsupported
+	}
+	if err := f.injectRead("list", "bucket"); err != nil {
+		return nil, err
+	}
+	return lister.ListPayloadInfo()
+}
+
+// ListRequestPayloads lists one request through the wrapped storage
+func (f *FaultInjector) ListRequestPayloads(requestID string) ([]string, error) {
+	return f.ListRequestPayloadsContext(context.Background(), requestID)
+}
+
+// ListRequestPayloadsContext lists one request as ListRequestPayloads does, under ctx
+func (f *FaultInjector) ListRequestPayloadsContext(ctx context.Context, requestID string) ([]string, error) {
+	if err := f.injectRead("list", requestID); err != nil {
+		return nil, err
+	}
+	return listRequestObjectsContext(ctx, f.inner, requestID)
+}
+
+// ComposePayload appends server-side through the wrapped storage, when it supports it
+func (f *FaultInjector) ComposePayload(objectName string, data []byte, contentType string, metadata map[string]string) (int64, error) {
+	composer, ok := f.inner.(ObjectComposer)
+	if !ok {
+		return 0, ErrComposeUnsupported
+	}
+	if err := f.injectSave(objectName); err != nil {
+		return 0, err
+	}
+	return composer.ComposePayload(objectName, data, contentType, metadata)
+}
+
+// SavePayloadStream streams through the wrapped storage, when it supports it
+func (f *FaultInjector) SavePayloadStream(objectName string, body io.Reader, size int64, contentType string, metadata map[string]string, progress UploadProgressFunc) (int64, error) {
+	streamer, ok := f.inner.(StreamSaver)
+	if !ok {
+		return 0, ErrStreamUnsupported
+	}
+	if err := f.injectSave(objectName); err != nil {
+		return 0, err
+	}
+	return streamer.SavePayloadStream(objectName, body, size, contentType, metadata, progress)
+}
+
+// DeletePayload deletes from the wrapped storage unless a storage outage is injected;
+// deletes are not failed at random
+func (f *FaultInjector) DeletePayload(objectName string) error {
+	return f.DeletePayloadContext(context.Background(), objectName)
+}
+
+// DeletePayloadContext deletes as DeletePayload does, under ctx
+func (f *FaultInjector) DeletePayloadContext(ctx context.Context, objectName string) error {
+	if err := f.inject("delete", objectName, 0, nil); err != nil {
+		return err
+	}
+	return deletePayload(ctx, f.inner, objectName)
+}
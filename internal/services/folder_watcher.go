@@ -0,0 +1,219 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FolderWatcher ingests files dropped into a local directory. A file is uploaded once
+// its size and modification time are unchanged between two scans, so files still
+// being written are left alone. The subfolders a file sits in become its tags. The
+// watcher observes the store, and deletes the local copy, or moves it to an archive
+// directory, once all of its objects are saved.
+type FolderWatcher struct {
+	dir        string
+	store      PayloadService
+	detector   ContentTypeDetector
+	interval   time.Duration
+	archiveDir string
+
+	saves *saveWaiter
+
+	mu      sync.Mutex
+	pending map[string]fileState
+	// stored holds files that were saved but could not be cleaned up, so they are not
+	// uploaded again
+	stored map[string]fileState
+}
+
+// fileState is what a scan saw of a file
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// folderUploadTimeout is how many scan intervals an upload may take before the file
+// is uploaded again
+const folderUploadTimeout = 20
+
+// NewFolderWatcher creates a watcher that stores the files under dir through store,
+// scanning every interval
+func NewFolderWatcher(dir string, store PayloadService, detector ContentTypeDetector, interval time.Duration) *FolderWatcher {
+	return &FolderWatcher{
+		dir:      dir,
+		store:    store,
+		detector: detector,
+		interval: interval,
+		saves:    newSaveWaiter(),
+		pending:  make(map[string]fileState),
+		stored:   make(map[string]fileState),
+	}
+}
+
+// SetArchiveDir moves ingested files under dir, keeping their subfolders, instead of
+// deleting them
+func (w *FolderWatcher) SetArchiveDir(dir string) {
+	w.archiveDir = dir
+}
+
+// Start scans the directory periodically in the background
+func (w *FolderWatcher) Start() {
+	go func() {
+		for {
+			time.Sleep(w.interval)
+			if ingested, failed := w.ScanOnce(); ingested > 0 || failed > 0 {
+				log.Printf("Watch folder %s: ingested %d file(s), %d failed", w.dir, ingested, failed)
+			}
+		}
+	}()
+}
+
+// ScanOnce uploads every file that has settled since the previous scan. Failed files
+// stay in place and are retried on the next scan.
+func (w *FolderWatcher) ScanOnce() (ingested, failed int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, path := range w.saves.expire(folderUploadTimeout * w.interval) {
+		log.Printf("Watch folder: %s was not saved in time; it will be uploaded again", path)
+	}
+
+	seen := make(map[string]fileState)
+	err := filepath.WalkDir(w.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("Watch folder: error reading %s: %v", path, err)
+			return nil
+		}
+		if path == w.dir {
+			return nil
+		}
+		if w.ignored(path, entry) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		state := fileState{size: info.Size(), modTime: info.ModTime()}
+		if done, ok := w.stored[path]; ok && done == state {
+			w.cleanUp(path)
+			return nil
+		}
+		if w.saves.waiting(path) {
+			return nil
+		}
+		if previous, ok := w.pending[path]; !ok || previous != state {
+			seen[path] = state
+			return nil
+		}
+		if err := w.ingest(path, state); err != nil {
+			log.Printf("Watch folder: error ingesting %s: %v", path, err)
+			seen[path] = state
+			failed++
+			return nil
+		}
+		ingested++
+		return nil
+	})
+	if err != nil {
+		log.Printf("Watch folder: error scanning %s: %v", w.dir, err)
+	}
+	w.pending = seen
+	return ingested, failed
+}
+
+// ignored skips hidden entries, partial downloads and the archive directory
+func (w *FolderWatcher) ignored(path string, entry fs.DirEntry) bool {
+	name := entry.Name()
+	if strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") {
+		return true
+	}
+	if !entry.IsDir() {
+		ext := strings.ToLower(filepath.Ext(name))
+		return ext == ".tmp" || ext == ".part" || ext == ".partial"
+	}
+	return w.archiveDir != "" && filepath.Clean(path) == filepath.Clean(w.archiveDir)
+}
+
+// folderTags turns the subfolders between the watched directory and a file into tags
+func (w *FolderWatcher) folderTags(path string) []string {
+	rel, err := filepath.Rel(w.dir, filepath.Dir(path))
+	if err != nil || rel == "." {
+		return nil
+	}
+	return strings.Split(filepath.ToSlash(rel), "/")
+}
+
+func (w *FolderWatcher) ingest(path string, state fileState) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	filename := filepath.Base(path)
+	w.saves.begin()
+	defer w.saves.end()
+	result, err := w.store.StorePayload(data, w.detector.DetectFromFilename(filename), filename, StoreOptions{Tags: w.folderTags(path), Source: "watch"})
+	if errors.Is(err, ErrPayloadDropped) {
+		log.Printf("Watch folder: %s was %v", path, err)
+		w.stored[path] = state
+		w.cleanUp(path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Watch folder: uploading %s as request %s", path, result.RequestID)
+	w.saves.wait(path, result, func(ObjectRecord) {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		log.Printf("Watch folder: stored %s as request %s", path, result.RequestID)
+		w.stored[path] = state
+		w.cleanUp(path)
+	})
+	return nil
+}
+
+// PayloadStored cleans up a watched file once its last object is saved
+func (w *FolderWatcher) PayloadStored(record ObjectRecord) {
+	w.saves.PayloadStored(record)
+}
+
+// PayloadDeleted is a no-op; deletions do not affect the watched directory
+func (w *FolderWatcher) PayloadDeleted(record ObjectRecord) {}
+
+// cleanUp deletes or archives an ingested file, retrying on the next scan on failure
+func (w *FolderWatcher) cleanUp(path string) {
+	if err := w.removeOrArchive(path); err != nil {
+		log.Printf("Watch folder: error cleaning up %s: %v", path, err)
+		return
+	}
+	delete(w.stored, path)
+}
+
+func (w *FolderWatcher) removeOrArchive(path string) error {
+	if w.archiveDir == "" {
+		return os.Remove(path)
+	}
+	rel, err := filepath.Rel(w.dir, path)
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(w.archiveDir, rel)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("error archiving: %v", err)
+	}
+	return os.Rename(path, target)
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default signing settings for forward targets
+const (
+	DefaultSignatureHeader    = "X-Depot-Signature"
+	DefaultSignatureAlgorithm = "sha256"
+)
+
+// ErrUnknownTarget is returned when a replay names a target that is not configured
+var ErrUnknownTarget = errors.New("unknown forward target")
+
+// ForwardTarget is a receiver that stored payloads can be replayed or forwarded to
+type ForwardTarget struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Forward sends every newly stored payload to the target automatically
+	Forward bool `json:"forward"`
+	// Secret signs outgoing requests when set
+	Secret          string `json:"secret"`
+	SignatureHeader string `json:"signature_header"`
+	// Algorithm is the HMAC hash: sha1, sha256 or sha512
+	Algorithm string `json:"algorithm"`
+	// Retry overrides DefaultRetryPolicy for automatic forwarding
+	Retry RetryPolicy `json:"retry"`
+}
+
+// LoadForwardTargets reads targets from a JSON array file, filling in signing defaults
+func LoadForwardTargets(path string) ([]ForwardTarget, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var targets []ForwardTarget
+	if err := json.Unmarshal(data, &targets); err != nil {
+		return nil, fmt.Errorf("invalid forward targets file: %v", err)
+	}
+	for i := range targets {
+		if targets[i].Name == "" || targets[i].URL == "" {
+			return nil, fmt.Errorf("forward target %d needs a name and url", i)
+		}
+		if targets[i].SignatureHeader == "" {
+			targets[i].SignatureHeader = DefaultSignatureHeader
+		}
+		if targets[i].Algorithm == "" {
+			targets[i].Algorithm = DefaultSignatureAlgorithm
+		}
+		targets[i].Algorithm = strings.ToLower(targets[i].Algorithm)
+		if _, err := hmacHash(targets[i].Algorithm); err != nil {
+			return nil, fmt.Errorf("forward target %s: %v", targets[i].Name, err)
+		}
+		if targets[i].Retry, err = targets[i].Retry.WithDefaults(); err != nil {
+			return nil, fmt.Errorf("forward target %s: %v", targets[i].Name, err)
+		}
+	}
+	return targets, nil
+}
+
+// PayloadForwarder delivers stored payloads to configured targets, either on demand
+// (replay) or automatically as they are stored (forward)
+type PayloadForwarder struct {
+	client    *http.Client
+	storage   StorageService
+	index     MetadataIndex
+	targets   map[string]ForwardTarget
+	executors map[string]*RetryExecutor
+
+	deliveries DeliveryTracker
+}
+
+// NewPayloadForwarder creates a forwarder for the given targets; each target's
+// retry policy also bounds the timeout and concurrency of replays to it
+func NewPayloadForwarder(storage StorageService, index MetadataIndex, targets []ForwardTarget, deliveries DeliveryTracker) *PayloadForwarder {
+	byName := make(map[string]ForwardTarget, len(targets))
+	executors := make(map[string]*RetryExecutor, len(targets))
+	for _, target := range targets {
+		policy, err := target.Retry.WithDefaults()
+		if err != nil {
+			log.Printf("Forward target %s: %v; using the default retry policy", target.Name, err)
+			policy = DefaultRetryPolicy
+		}
+		target.Retry = policy
+		byName[target.Name] = target
+		executors[target.Name] = NewRetryExecutor(policy)
+	}
+	return &PayloadForwarder{
+		client:    &http.Client{},
+		storage:   storage,
+		index:     index,
+		targets:   byName,
+		executors: executors,
+
+		deliveries: deliveries,
+	}
+}
+
+// PayloadStored forwards a newly stored payload to every target with forwarding enabled;
+// self-test probes are never forwarded
+func (f *PayloadForwarder) PayloadStored(record ObjectRecord) {
+	if slices.Contains(record.Tags, SelfTestTag) {
+		return
+	}
+	for _, target := range f.targets {
+		if target.Forward {
+			go f.forward(target, record)
+		}
+	}
+}
+
+// PayloadDeleted is a no-op; deletions are not forwarded
+func (f *PayloadForwarder) PayloadDeleted(record ObjectRecord) {}
+
+// ForwardTo forwards a stored payload to one named target in the background, under
+// the target's retry policy, whether or not the target forwards automatically
+func (f *PayloadForwarder) ForwardTo(record ObjectRecord, targetName string) error {
+	target, ok := f.targets[targetName]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownTarget, targetName)
+	}
+	go f.forward(target, record)
+	return nil
+}
+
+// Replay sends every stored object of a request to the named target once and reports each outcome
+func (f *PayloadForwarder) Replay(requestID, targetName string) ([]DeliveryResult, error) {
+	target, ok := f.targets[targetName]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTarget, targetName)
+	}
+
+	objects, err := f.storage.ListPayloads()
+	if err != nil {
+		return nil, fmt.Errorf("error listing payloads: %v", err)
+	}
+
+	results := []DeliveryResult{}
+	for _, objectName := range objects {
+		if !IsRequestObject(objectName, requestID) {
+			continue
+		}
+		record, ok := f.index.Get(objectName)
+		if !ok {
+			record = ObjectRecord{RequestID: requestID, ObjectName: objectName, ContentType: "application/octet-stream"}
+		}
+		result := DeliveryResult{ObjectName: objectName, Status: DeliveryDelivered}
+		delivery := Delivery{Kind: DeliveryKindReplay, Target: targetName, RequestID: requestID, ObjectName: objectName}
+		err := f.deliveries.RunOnce(delivery, f.executors[targetName], func(ctx context.Context) error {
+			return f.deliver(ctx, target, record)
+		})
+		if err != nil {
+			result.Status = DeliveryFailed
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// forward delivers one object under the target's retry policy
+func (f *PayloadForwarder) forward(target ForwardTarget, record ObjectRecord) {
+	delivery := Delivery{Kind: DeliveryKindForward, Target: target.Name, RequestID: record.RequestID, ObjectName: record.ObjectName}
+	err := f.deliveries.Run(delivery, f.executors[target.Name], func(ctx context.Context) error {
+		return f.deliver(ctx, target, record)
+	})
+	if err != nil {
+		log.Printf("Forwarding %s to %s failed after %d attempt(s): %v", record.ObjectName, target.Name, target.Retry.MaxAttempts, err)
+		return
+	}
+	log.Printf("Forwarded %s to %s", record.ObjectName, target.Name)
+}
+
+// deliver POSTs the raw payload to the target, signed when the target has a secret
+func (f *PayloadForwarder) deliver(ctx context.Context, target ForwardTarget, record ObjectRecord) error {
+	body, err := f.storage.GetPayload(record.ObjectName)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", record.ContentType)
+	req.Header.Set("X-Depot-Request-Id", record.RequestID)
+	req.Header.Set("X-Depot-Object", record.ObjectName)
+
+	if target.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		signature, err := SignRequest(target.Algorithm, target.Secret, timestamp, body)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("X-Depot-Timestamp", timestamp)
+		req.Header.Set(target.SignatureHeader, target.Algorithm+"="+signature)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SignRequest computes the hex HMAC of "timestamp.body" with the given hash algorithm
+func SignRequest(algorithm, secret, timestamp string, body []byte) (string, error) {
+	newHash, err := hmacHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func hmacHash(algorithm string) (func() hash.Hash, error) {
+	switch algorithm {
+	case "sha1":
+		return sha1.New, nil
+	case "sha256":
+		return sha256.New, nil
+	case "sha512":
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("unsupported signature algorithm %q", algorithm)
+	}
+}
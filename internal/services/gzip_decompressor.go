@@ -0,0 +1,80 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// GzipDecompressor produces a decompressed copy of gzip-compressed uploads
+type GzipDecompressor struct {
+	contentTypeDetector ContentTypeDetector
+	maxBytes            int64
+}
+
+// NewGzipDecompressor creates a decompressor bounded by a maximum decompressed size
+func NewGzipDecompressor(detector ContentTypeDetector, maxBytes int64) *GzipDecompressor {
+	return &GzipDecompressor{
+		contentTypeDetector: detector,
+		maxBytes:            maxBytes,
+	}
+}
+
+// IsCompressed reports whether a payload is gzip, by extension, Content-Encoding or magic bytes
+func (d *GzipDecompressor) IsCompressed(payload ProcessedPayload, contentEncoding string) bool {
+	return strings.EqualFold(contentEncoding, "gzip") ||
+		strings.EqualFold(path.Ext(payload.ObjectName), ".gz") ||
+		bytes.HasPrefix(payload.Data, gzipMagic)
+}
+
+// Decompress returns the compressed original and its decompressed copy, each
+// recording the other's object name in its metadata
+func (d *GzipDecompressor) Decompress(payload ProcessedPayload) ([]ProcessedPayload, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(payload.Data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, d.maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if int64(len(data)) > d.maxBytes {
+		return nil, fmt.Errorf("%w: more than %d decompressed bytes", ErrArchiveTooLarge, d.maxBytes)
+	}
+
+	original := payload
+	original.ContentType = "application/gzip"
+	decompressed := ProcessedPayload{Data: data}
+	if strings.EqualFold(path.Ext(payload.ObjectName), ".gz") {
+		decompressed.ObjectName = payload.ObjectName[:len(payload.ObjectName)-3]
+		decompressed.Filename = payload.Filename
+		if strings.EqualFold(path.Ext(payload.Filename), ".gz") {
+			decompressed.Filename = payload.Filename[:len(payload.Filename)-3]
+		}
+	} else {
+		// The upload was only marked as gzip; the plain copy keeps the expected name
+		decompressed.ObjectName = payload.ObjectName
+		decompressed.Filename = payload.Filename
+		original.ObjectName = payload.ObjectName + ".gz"
+		if payload.Filename != "" {
+			original.Filename = payload.Filename + ".gz"
+		}
+	}
+
+	decompressed.ContentType = d.contentTypeDetector.DetectFromFilename(decompressed.ObjectName)
+	if decompressed.ContentType == "application/octet-stream" {
+		decompressed.ContentType = d.contentTypeDetector.DetectFromData(data)
+	}
+
+	original.Metadata = map[string]string{MetadataDecompressedObject: decompressed.ObjectName}
+	decompressed.Metadata = map[string]string{MetadataCompressedObject: original.ObjectName}
+	return []ProcessedPayload{original, decompressed}, nil
+}
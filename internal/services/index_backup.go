@@ -0,0 +1,83 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IndexBackup writes timestamped JSON snapshots of the metadata index to a directory,
+// so the index can be restored without rescanning a large bucket
+type IndexBackup struct {
+	index MetadataIndex
+	dir   string
+	keep  int
+}
+
+// NewIndexBackup creates a backup job that keeps the newest keep snapshots in dir;
+// keep <= 0 keeps them all
+func NewIndexBackup(index MetadataIndex, dir string, keep int) *IndexBackup {
+	return &IndexBackup{
+		index: index,
+		dir:   dir,
+		keep:  keep,
+	}
+}
+
+// Backup writes a snapshot and prunes the oldest ones beyond the configured count
+func (b *IndexBackup) Backup() (string, error) {
+	if err := os.MkdirAll(b.dir, 0o755); err != nil {
+		return "", fmt.Errorf("error creating backup directory: %v", err)
+	}
+
+	records := b.index.List()
+	data, err := json.Marshal(records)
+	if err != nil {
+		return "", fmt.Errorf("error encoding index: %v", err)
+	}
+	name := filepath.Join(b.dir, "index-"+time.Now().UTC().Format("20060102T150405.000Z")+".json")
+	// Write to a temporary file first so a crash never leaves a truncated snapshot
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return "", fmt.Errorf("error writing backup: %v", err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return "", fmt.Errorf("error writing backup: %v", err)
+	}
+
+	pruned, err := b.prune()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("wrote %d record(s) to %s, pruned %d old snapshot(s)", len(records), name, pruned), nil
+}
+
+func (b *IndexBackup) prune() (int, error) {
+	if b.keep <= 0 {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return 0, fmt.Errorf("error listing backups: %v", err)
+	}
+	var snapshots []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "index-") && strings.HasSuffix(entry.Name(), ".json") {
+			snapshots = append(snapshots, entry.Name())
+		}
+	}
+	// Timestamped names sort oldest first
+	sort.Strings(snapshots)
+	pruned := 0
+	for len(snapshots)-pruned > b.keep {
+		if err := os.Remove(filepath.Join(b.dir, snapshots[pruned])); err != nil {
+			return pruned, fmt.Errorf("error pruning backups: %v", err)
+		}
+		pruned++
+	}
+	return pruned, nil
+}
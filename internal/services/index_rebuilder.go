@@ -0,0 +1,140 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RebuildResult summarizes a metadata index rebuild
+type RebuildResult struct {
+	Scanned int      `json:"scanned"`
+	Indexed int      `json:"indexed"`
+	Removed int      `json:"removed"`
+	Failed  []string `json:"failed"`
+}
+
+// IndexRebuilder repopulates a metadata index by scanning the storage backend
+type IndexRebuilder struct {
+	storage StorageService
+	index   MetadataIndex
+}
+
+// NewIndexRebuilder creates a rebuilder that indexes every object in storage
+func NewIndexRebuilder(storage StorageService, index MetadataIndex) *IndexRebuilder {
+	return &IndexRebuilder{
+		storage: storage,
+		index:   index,
+	}
+}
+
+// Rebuild indexes every stored object from its name, size and stored metadata, and
+// drops hot records whose objects no longer exist. Objects that cannot be read are
+// reported in Failed and left as they were.
+func (r *IndexRebuilder) Rebuild() (RebuildResult, error) {
+	started := time.Now().UTC()
+	result := RebuildResult{Failed: []string{}}
+
+	objects, err := r.storage.ListPayloads()
+	if err != nil {
+		return result, fmt.Errorf("error listing payloads: %v", err)
+	}
+	result.Scanned = len(objects)
+
+	present := make(map[string]bool, len(objects))
+	for _, objectName := range objects {
+		present[objectName] = true
+		record, err := r.describe(objectName)
+		if err != nil {
+			log.Printf("Error reindexing %s: %v", objectName, err)
+			result.Failed = append(result.Failed, objectName)
+			continue
+		}
+		r.index.PayloadStored(record)
+		result.Indexed++
+	}
+
+	for _, record := range r.index.List() {
+		// Archived records live in another bucket, and newer ones were stored mid-scan
+		if present[record.ObjectName] || record.StorageTier == StorageTierArchive || record.StoredAt.After(started) {
+			continue
+		}
+		r.index.PayloadDeleted(record)
+		result.Removed++
+	}
+
+	return result, nil
+}
+
+// describe builds the index record for one stored object
+func (r *IndexRebuilder) describe(objectName string) (ObjectRecord, error) {
+	data, err := r.storage.GetPayload(objectName)
+	if err != nil {
+		return ObjectRecord{}, err
+	}
+
+	contentType, metadata := "", map[string]string{}
+	if reader, ok := r.storage.(MetadataReader); ok {
+		contentType, metadata, err = reader.GetPayloadMetadata(objectName)
+		if errors.Is(err, ErrMetadataUnsupported) {
+			contentType, metadata = "", map[string]string{}
+		} else if err != nil {
+			return ObjectRecord{}, err
+		}
+	}
+
+	record := ObjectRecord{
+		RequestID:        metadata[MetadataRequestID],
+		ObjectName:       objectName,
+		OriginalFilename: storedFilename(objectName, metadata),
+		ContentType:      contentType,
+		Size:             len(data),
+		SHA256:           metadata[MetadataSHA256],
+		StoredAt:         time.Now().UTC(),
+	}
+	if record.RequestID == "" {
+		record.RequestID = requestIDFromObjectName(objectName)
+	}
+	if record.ContentType == "" {
+		record.ContentType = determineContentType(objectName)
+	}
+	if record.SHA256 == "" {
+		sum := sha256.Sum256(data)
+		record.SHA256 = hex.EncodeToString(sum[:])
+	}
+	if tags := metadata[MetadataTags]; tags != "" {
+		record.Tags = strings.Split(tags, ",")
+	}
+	if at, err := time.Parse(time.RFC3339, metadata[MetadataExpiresAt]); err == nil {
+		record.ExpiresAt = &at
+	}
+	if at, err := time.Parse(time.RFC3339, metadata[MetadataRestoredAt]); err == nil {
+		record.RestoredAt = &at
+	}
+	if existing, ok := r.index.Get(objectName); ok {
+		record.StoredAt = existing.StoredAt
+	} else if at, ok := storedAtFromRequestID(record.RequestID); ok {
+		record.StoredAt = at
+	}
+	return record, nil
+}
+
+// requestIDFromObjectName recovers the request ID an object name starts with
+func requestIDFromObjectName(objectName string) string {
+	requestID, _ := splitObjectName(objectName)
+	return requestID
+}
+
+// storedAtFromRequestID reads the upload time encoded at the start of a request ID
+func storedAtFromRequestID(requestID string) (time.Time, bool) {
+	seconds, err := strconv.ParseInt(strings.SplitN(requestID, "_", 2)[0], 10, 64)
+	if err != nil || seconds <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0).UTC(), true
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/itchyny/gojq"
+)
+
+// ErrInvalidQuery is wrapped by errors caused by a malformed query expression
+var ErrInvalidQuery = errors.New("invalid query expression")
+
+// GojqQueryEvaluator evaluates jq expressions against JSON payloads
+type GojqQueryEvaluator struct {
+	timeout    time.Duration
+	maxResults int
+}
+
+// NewGojqQueryEvaluator creates an evaluator bounded by a timeout and result count
+func NewGojqQueryEvaluator(timeout time.Duration, maxResults int) *GojqQueryEvaluator {
+	return &GojqQueryEvaluator{
+		timeout:    timeout,
+		maxResults: maxResults,
+	}
+}
+
+// compile parses and compiles a jq expression
+func (e *GojqQueryEvaluator) compile(expr string) (*gojq.Code, error) {
+	query, err := gojq.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	return code, nil
+}
+
+// Evaluate runs a jq expression against JSON data and returns every emitted value
+func (e *GojqQueryEvaluator) Evaluate(data []byte, expr string) ([]any, error) {
+	code, err := e.compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	var input any
+	if err := json.Unmarshal(data, &input); err != nil {
+		return nil, fmt.Errorf("payload is not valid JSON: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	results := []any{}
+	iter := code.RunWithContext(ctx, input)
+	for {
+		value, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, isErr := value.(error); isErr {
+			var haltErr *gojq.HaltError
+			if errors.As(err, &haltErr) && haltErr.Value() == nil {
+				break
+			}
+			return nil, fmt.Errorf("query failed: %v", err)
+		}
+		if len(results) >= e.maxResults {
+			return nil, fmt.Errorf("query produced more than %d results", e.maxResults)
+		}
+		results = append(results, value)
+	}
+	return results, nil
+}
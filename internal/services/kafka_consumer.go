@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metadata keys recording where a consumed Kafka message came from
+const (
+	MetadataKafkaTopic     = "Kafka-Topic"
+	MetadataKafkaPartition = "Kafka-Partition"
+	MetadataKafkaOffset    = "Kafka-Offset"
+	MetadataKafkaKey       = "Kafka-Key"
+	// MetadataKafkaHeaderPrefix prefixes message headers saved as object metadata
+	MetadataKafkaHeaderPrefix = "Kafka-Header-"
+)
+
+// KafkaMessage is a record consumed from a Kafka topic
+type KafkaMessage struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+	Time      time.Time
+}
+
+// KafkaReader fetches messages for a consumer group and commits their offsets
+type KafkaReader interface {
+	FetchMessage(ctx context.Context) (KafkaMessage, error)
+	CommitMessage(ctx context.Context, message KafkaMessage) error
+	Close() error
+}
+
+// KafkaConsumer archives Kafka messages as payloads. Each message is stored as its
+// own request, tagged with its topic, with its headers saved as object metadata. The
+// request ID is derived from the topic, partition and offset, so a redelivered
+// message overwrites its earlier copy. Offsets are committed only once the payload is
+// saved, so messages are stored at least once.
+type KafkaConsumer struct {
+	reader   KafkaReader
+	store    PayloadService
+	detector ContentTypeDetector
+	saves    *saveWaiter
+}
+
+// NewKafkaConsumer creates a consumer that stores the messages of reader through store
+func NewKafkaConsumer(reader KafkaReader, store PayloadService, detector ContentTypeDetector) *KafkaConsumer {
+	return &KafkaConsumer{
+		reader:   reader,
+		store:    store,
+		detector: detector,
+		saves:    newSaveWaiter(),
+	}
+}
+
+// Run consumes messages until ctx is cancelled, then closes the reader
+func (c *KafkaConsumer) Run(ctx context.Context) error {
+	defer c.reader.Close()
+	for {
+		message, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("Kafka: error fetching message: %v", err)
+			if !sleepContext(ctx, streamRetryDelay) {
+				return ctx.Err()
+			}
+			continue
+		}
+		if err := c.consume(ctx, message); err != nil {
+			return err
+		}
+		// A failed commit is covered by the next one, as offsets are committed in order
+		if err := c.reader.CommitMessage(ctx, message); err != nil && ctx.Err() == nil {
+			log.Printf("Kafka: error committing %s: %v", KafkaRequestID(message), err)
+		}
+	}
+}
+
+// consume stores a message and waits for it to be saved, retrying failed saves.
+// Messages the pipeline rejects are logged and skipped.
+func (c *KafkaConsumer) consume(ctx context.Context, message KafkaMessage) error {
+	requestID := KafkaRequestID(message)
+	_, err := c.saves.storeAndWait(ctx, c.store, message.Value, c.contentType(message), "", StoreOptions{
+		RequestID: requestID,
+		Tags:      []string{message.Topic},
+		Source:    "kafka",
+		Metadata:  kafkaMetadata(message),
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		log.Printf("Kafka: skipping %s, which was rejected: %v", requestID, err)
+	}
+	return nil
+}
+
+// contentType uses the message's Content-Type header, or sniffs the value
+func (c *KafkaConsumer) contentType(message KafkaMessage) string {
+	for name, value := range message.Headers {
+		if strings.EqualFold(name, "Content-Type") && value != "" {
+			return value
+		}
+	}
+	return c.detector.DetectFromData(message.Value)
+}
+
+// PayloadStored lets the consumer commit a message once its payload is saved
+func (c *KafkaConsumer) PayloadStored(record ObjectRecord) {
+	c.saves.PayloadStored(record)
+}
+
+// PayloadDeleted is a no-op; deletions do not affect consumed offsets
+func (c *KafkaConsumer) PayloadDeleted(record ObjectRecord) {}
+
+// KafkaRequestID names the request a message is stored under, as
+// <topic>-<partition>-<offset> restricted to request ID characters
+func KafkaRequestID(message KafkaMessage) string {
+	topic := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '-'
+	}, message.Topic)
+	return fmt.Sprintf("%s-%d-%d", topic, message.Partition, message.Offset)
+}
+
+// kafkaMetadata maps a message's origin and headers to object metadata
+func kafkaMetadata(message KafkaMessage) map[string]string {
+	metadata := map[string]string{
+		MetadataKafkaTopic:     message.Topic,
+		MetadataKafkaPartition: strconv.Itoa(message.Partition),
+		MetadataKafkaOffset:    strconv.FormatInt(message.Offset, 10),
+	}
+	if len(message.Key) > 0 {
+		setMetadataValue(metadata, MetadataKafkaKey, string(message.Key))
+	}
+	for name, value := range message.Headers {
+		setMetadataValue(metadata, MetadataKafkaHeaderPrefix+metadataKeyName(name), value)
+	}
+	return metadata
+}
+
+// setMetadataValue stores values that are not printable ASCII base64-encoded, under
+// the key with a -Base64 suffix, as object metadata only carries plain text
+func setMetadataValue(metadata map[string]string, key, value string) {
+	for _, r := range value {
+		if r < ' ' || r > '~' {
+			metadata[key+"-Base64"] = base64.StdEncoding.EncodeToString([]byte(value))
+			return
+		}
+	}
+	metadata[key] = value
+}
+
+// metadataKeyName replaces characters that cannot appear in a metadata key
+func metadataKeyName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' {
+			return r
+		}
+		return '-'
+	}, name)
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/config"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+// kafkaGroupReader reads messages as a member of a Kafka consumer group
+type kafkaGroupReader struct {
+	reader *kafka.Reader
+}
+
+// NewKafkaReader joins the configured consumer group for the configured topics
+func NewKafkaReader(config *config.Config) (KafkaReader, error) {
+	if len(config.KafkaBrokers) == 0 {
+		return nil, fmt.Errorf("no Kafka brokers configured")
+	}
+	var startOffset int64
+	switch config.KafkaStartOffset {
+	case "earliest":
+		startOffset = kafka.FirstOffset
+	case "latest":
+		startOffset = kafka.LastOffset
+	default:
+		return nil, fmt.Errorf("unknown Kafka start offset %q; use earliest or latest", config.KafkaStartOffset)
+	}
+
+	dialer := &kafka.Dialer{Timeout: 10 * time.Second, DualStack: true}
+	if config.KafkaTLS {
+		dialer.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if config.KafkaUsername != "" {
+		dialer.SASLMechanism = plain.Mechanism{Username: config.KafkaUsername, Password: config.KafkaPassword}
+	}
+
+	return &kafkaGroupReader{reader: kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     config.KafkaBrokers,
+		GroupID:     config.KafkaGroup,
+		GroupTopics: config.KafkaTopics,
+		StartOffset: startOffset,
+		Dialer:      dialer,
+	})}, nil
+}
+
+func (r *kafkaGroupReader) FetchMessage(ctx context.Context) (KafkaMessage, error) {
+	message, err := r.reader.FetchMessage(ctx)
+	if err != nil {
+		return KafkaMessage{}, err
+	}
+	headers := make(map[string]string, len(message.Headers))
+	for _, header := range message.Headers {
+		headers[header.Key] = string(header.Value)
+	}
+	return KafkaMessage{
+		Topic:     message.Topic,
+		Partition: message.Partition,
+		Offset:    message.Offset,
+		Key:       message.Key,
+		Value:     message.Value,
+		Headers:   headers,
+		Time:      message.Time,
+	}, nil
+}
+
+func (r *kafkaGroupReader) CommitMessage(ctx context.Context, message KafkaMessage) error {
+	return r.reader.CommitMessages(ctx, kafka.Message{
+		Topic:     message.Topic,
+		Partition: message.Partition,
+		Offset:    message.Offset,
+	})
+}
+
+func (r *kafkaGroupReader) Close() error {
+	return r.reader.Close()
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+// KeyWrapper wraps and unwraps per-object data keys with an external key manager
+type KeyWrapper interface {
+	// KeyID identifies the wrapping key, prefixed with the provider name
+	KeyID() string
+	WrapKey(dataKey []byte) ([]byte, error)
+	UnwrapKey(wrapped []byte) ([]byte, error)
+}
+
+// AWSKMSWrapper wraps data keys with an AWS KMS key
+type AWSKMSWrapper struct {
+	client *kms.Client
+	keyID  string
+}
+
+// NewAWSKMSWrapper creates a KMS wrapper using the default AWS credential chain
+func NewAWSKMSWrapper(keyID, region string) (*AWSKMSWrapper, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %v", err)
+	}
+	return &AWSKMSWrapper{
+		client: kms.NewFromConfig(cfg),
+		keyID:  keyID,
+	}, nil
+}
+
+// KeyID returns the KMS key identifier
+func (w *AWSKMSWrapper) KeyID() string {
+	return "kms:" + w.keyID
+}
+
+// WrapKey encrypts a data key under the KMS key
+func (w *AWSKMSWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	out, err := w.client.Encrypt(ctx, &kms.EncryptInput{KeyId: &w.keyID, Plaintext: dataKey})
+	if err != nil {
+		return nil, fmt.Errorf("KMS encrypt failed: %v", err)
+	}
+	return out.CiphertextBlob, nil
+}
+
+// UnwrapKey decrypts a data key; KMS resolves the key from the ciphertext blob
+func (w *AWSKMSWrapper) UnwrapKey(wrapped []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	out, err := w.client.Decrypt(ctx, &kms.DecryptInput{KeyId: &w.keyID, CiphertextBlob: wrapped})
+	if err != nil {
+		return nil, fmt.Errorf("KMS decrypt failed: %v", err)
+	}
+	return out.Plaintext, nil
+}
+
+// VaultTransitWrapper wraps data keys with a HashiCorp Vault Transit key
+type VaultTransitWrapper struct {
+	client  *http.Client
+	address string
+	token   string
+	mount   string
+	key     string
+}
+
+// NewVaultTransitWrapper creates a wrapper for the named key of a Transit mount
+func NewVaultTransitWrapper(address, token, mount, key string) *VaultTransitWrapper {
+	return &VaultTransitWrapper{
+		client:  &http.Client{Timeout: 10 * time.Second},
+		address: strings.TrimSuffix(address, "/"),
+		token:   token,
+		mount:   strings.Trim(mount, "/"),
+		key:     key,
+	}
+}
+
+// KeyID returns the Transit mount and key name
+func (w *VaultTransitWrapper) KeyID() string {
+	return "vault:" + w.mount + "/" + w.key
+}
+
+// WrapKey encrypts a data key; the result is Vault's "vault:vN:..." ciphertext
+func (w *VaultTransitWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+	var resp struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	err := w.call("encrypt", map[string]string{"plaintext": base64.StdEncoding.EncodeToString(dataKey)}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(resp.Data.Ciphertext), nil
+}
+
+// UnwrapKey decrypts a data key previously wrapped by WrapKey
+func (w *VaultTransitWrapper) UnwrapKey(wrapped []byte) ([]byte, error) {
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err := w.call("decrypt", map[string]string{"ciphertext": string(wrapped)}, &resp); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+}
+
+// call posts to a Transit endpoint and decodes the response
+func (w *VaultTransitWrapper) call(operation string, body any, out any) error {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/v1/%s/%s/%s", w.address, w.mount, operation, w.key)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", w.token)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault transit %s failed: %v", operation, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault transit %s failed: status %d", operation, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
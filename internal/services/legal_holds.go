@@ -0,0 +1,85 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrLegalHold is returned when an object under legal hold would be removed
+var ErrLegalHold = errors.New("object is under legal hold")
+
+// LegalHoldStatus reports whether one object is under legal hold
+type LegalHoldStatus struct {
+	ObjectName string `json:"object_name"`
+	LegalHold  bool   `json:"legal_hold"`
+}
+
+// LegalHolds places and releases legal holds on every object of a request, and
+// vetoes the removal of held objects
+type LegalHolds struct {
+	storage StorageService
+	holder  LegalHolder
+}
+
+// NewLegalHolds creates a legal hold manager; storage lists a request's objects and
+// holder is the backend that records the holds
+func NewLegalHolds(storage StorageService, holder LegalHolder) *LegalHolds {
+	return &LegalHolds{
+		storage: storage,
+		holder:  holder,
+	}
+}
+
+// Place puts every object of a request under legal hold
+func (l *LegalHolds) Place(requestID string) ([]LegalHoldStatus, error) {
+	return l.set(requestID, true)
+}
+
+// Release lifts the legal hold from every object of a request
+func (l *LegalHolds) Release(requestID string) ([]LegalHoldStatus, error) {
+	return l.set(requestID, false)
+}
+
+// Status reports the legal hold of every object of a request
+func (l *LegalHolds) Status(requestID string) ([]LegalHoldStatus, error) {
+	objects, err := listRequestObjects(l.storage, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing payloads: %v", err)
+	}
+	statuses := make([]LegalHoldStatus, 0, len(objects))
+	for _, objectName := range objects {
+		held, err := l.holder.LegalHold(objectName)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, LegalHoldStatus{ObjectName: objectName, LegalHold: held})
+	}
+	return statuses, nil
+}
+
+// CheckDelete refuses to remove objects under legal hold
+func (l *LegalHolds) CheckDelete(objectName string) error {
+	held, err := l.holder.LegalHold(objectName)
+	if err != nil {
+		return fmt.Errorf("error checking legal hold of %s: %v", objectName, err)
+	}
+	if held {
+		return fmt.Errorf("%w: %s", ErrLegalHold, objectName)
+	}
+	return nil
+}
+
+func (l *LegalHolds) set(requestID string, enabled bool) ([]LegalHoldStatus, error) {
+	objects, err := listRequestObjects(l.storage, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing payloads: %v", err)
+	}
+	statuses := make([]LegalHoldStatus, 0, len(objects))
+	for _, objectName := range objects {
+		if err := l.holder.SetLegalHold(objectName, enabled); err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, LegalHoldStatus{ObjectName: objectName, LegalHold: enabled})
+	}
+	return statuses, nil
+}
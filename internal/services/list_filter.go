@@ -0,0 +1,148 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// ListFilter narrows a listing to objects whose name starts with Prefix, whose
+// content type matches ContentType, and that were last written at or after After
+// and before Before. Zero fields match every object.
+type ListFilter struct {
+	Prefix string
+	// ContentType is a media type such as "application/json", or "image/*" for
+	// every subtype; parameters are ignored
+	ContentType string
+	After       time.Time
+	Before      time.Time
+}
+
+// matchesContentType compares media types case-insensitively, ignoring parameters
+func (f ListFilter) matchesContentType(contentType string) bool {
+	if f.ContentType == "" {
+		return true
+	}
+	return matchPattern(strings.ToLower(mediaType(f.ContentType)), strings.ToLower(mediaType(contentType)))
+}
+
+// matchesTime reports whether a modification time falls in the filter's range; an
+// unknown time only matches without one
+func (f ListFilter) matchesTime(modified time.Time) bool {
+	if modified.IsZero() {
+		return f.After.IsZero() && f.Before.IsZero()
+	}
+	if !f.After.IsZero() && modified.Before(f.After) {
+		return false
+	}
+	return f.Before.IsZero() || modified.Before(f.Before)
+}
+
+// FilteredLister lists the stored objects that match a filter, with their details
+type FilteredLister interface {
+	ListPayloadsMatching(filter ListFilter) ([]ObjectInfo, error)
+}
+
+// ListPayloadInfo lists every stored object with its size, content type and the time
+// it was last written
+func (s *DefaultPayloadService) ListPayloadInfo() ([]ObjectInfo, error) {
+	return s.listPayloadInfo("")
+}
+
+// ListPayloadsMatching lists the stored objects that match filter, with their details
+func (s *DefaultPayloadService) ListPayloadsMatching(filter ListFilter) ([]ObjectInfo, error) {
+	infos, err := s.listPayloadInfo(filter.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	matched := []ObjectInfo{}
+	for _, info := range infos {
+		if filter.matchesContentType(info.ContentType) && filter.matchesTime(info.LastModified) {
+			matched = append(matched, info)
+		}
+	}
+	return matched, nil
+}
+
+// listPayloadInfo lists the objects whose name starts with prefix with their details.
+// Details storage does not list come from the metadata index, when one is set, and
+// otherwise from each object's stored metadata and generated request ID.
+func (s *DefaultPayloadService) listPayloadInfo(prefix string) ([]ObjectInfo, error) {
+	infos := []ObjectInfo{}
+	if lister, ok := s.storage.(ObjectLister); ok {
+		listed, err := lister.ListPayloadInfo()
+		if err != nil && !errors.Is(err, ErrListInfoUnsupported) {
+			return nil, err
+		}
+		if err == nil {
+			for _, info := range listed {
+				if !strings.HasPrefix(info.ObjectName, prefix) {
+					continue
+				}
+				if info.ContentType == "" {
+					info.ContentType = s.describeListed(info.ObjectName, false).ContentType
+				}
+				infos = append(infos, info)
+			}
+			return infos, nil
+		}
+	}
+
+	objects, err := s.storage.ListPayloads()
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objects {
+		if strings.HasPrefix(obj, prefix) {
+			infos = append(infos, s.describeListed(obj, true))
+		}
+	}
+	return infos, nil
+}
+
+// describeListed finds the details of a listed object in the metadata index, or else
+// from its stored content type, the time in its name and, with readSize, its payload
+func (s *DefaultPayloadService) describeListed(objectName string, readSize bool) ObjectInfo {
+	if s.index != nil {
+		if record, ok := s.index.Get(objectName); ok {
+			return ObjectInfo{
+				ObjectName:   objectName,
+				Size:         int64(record.Size),
+				ContentType:  record.ContentType,
+				LastModified: record.StoredAt,
+			}
+		}
+	}
+	info := ObjectInfo{
+		ObjectName:   objectName,
+		ContentType:  determineContentType(objectName),
+		LastModified: generatedAt(objectName),
+	}
+	if reader, ok := s.storage.(MetadataReader); ok {
+		if stored, _, err := reader.GetPayloadMetadata(objectName); err == nil && stored != "" {
+			info.ContentType = stored
+		}
+	}
+	if readSize {
+		if data, err := s.storage.GetPayload(objectName); err == nil {
+			info.Size = int64(len(data))
+		}
+	}
+	return info
+}
+
+// generatedAt reads the upload time from an object named after a generated request
+// ID, "<unix>_<random>_<name>", which may carry a tenant or route prefix. Objects
+// named after client-chosen IDs have no known time.
+func generatedAt(objectName string) time.Time {
+	parts := strings.SplitN(objectName, "_", 3)
+	if len(parts) < 3 {
+		return time.Time{}
+	}
+	seconds := parts[0][strings.LastIndexAny(parts[0], ".-")+1:]
+	storedAt, ok := storedAtFromRequestID(seconds)
+	if !ok || storedAt.Year() < 2000 {
+		return time.Time{}
+	}
+	return storedAt
+}
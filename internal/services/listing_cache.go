@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ListingCache wraps a storage service and caches object listings, and the objects
+// grouped under each request ID, for a short TTL. Writes and deletes through the cache,
+// and store/delete events it observes, invalidate it immediately; the TTL only bounds
+// staleness from writers that bypass this depot.
+type ListingCache struct {
+	inner StorageService
+	ttl   time.Duration
+
+	// fetchMu lets one caller walk the bucket while concurrent callers wait for its result
+	fetchMu sync.Mutex
+
+	mu sync.Mutex
+	// objects holds the listing, with sizes, content types and times when the wrapped
+	// storage lists them
+	objects    []ObjectInfo
+	byRequest  map[string][]string
+	expires    time.Time
+	generation uint64
+}
+
+// NewListingCache creates a listing cache in front of inner
+func NewListingCache(inner StorageService, ttl time.Duration) *ListingCache {
+	return &ListingCache{
+		inner:     inner,
+		ttl:       ttl,
+		byRequest: make(map[string][]string),
+	}
+}
+
+// SavePayload writes through to the wrapped storage and invalidates the cache
+func (c *ListingCache) SavePayload(objectName string, data []byte, contentType string, metadata map[string]string) error {
+	return c.SavePayloadContext(context.Background(), objectName, data, contentType, metadata)
+}
+
+// SavePayloadContext saves as SavePayload does, under ctx
+func (c *ListingCache) SavePayloadContext(ctx context.Context, objectName string, data []byte, contentType string, metadata map[string]string) error {
+	defer c.Invalidate()
+	return savePayload(ctx, c.inner, objectName, data, contentType, metadata)
+}
+
+// GetPayload reads from the wrapped storage
+func (c *ListingCache) GetPayload(objectName string) ([]byte, error) {
+	return c.inner.GetPayload(objectName)
+}
+
+// GetPayloadContext reads from the wrapped storage under ctx
+func (c *ListingCache) GetPayloadContext(ctx context.Context, objectName string) ([]byte, error) {
+	return getPayload(ctx, c.inner, objectName)
+}
+
+// GetPayloadStream opens an object in the wrapped storage, when it can stream reads
+func (c *ListingCache) GetPayloadStream(objectName string) (io.ReadCloser, int64, error) {
+	reader, ok := c.inner.(StreamReader)
+	if !ok {
+		return nil, 0, ErrReadStreamUnsupported
+	}
+	return reader.GetPayloadStream(objectName)
+}
+
+// GetPayloadMetadata reads metadata from the wrapped storage, when it exposes any
+func (c *ListingCache) GetPayloadMetadata(objectName string) (string, map[string]string, error) {
+	if reader, ok := c.inner.(MetadataReader); ok {
+		return reader.GetPayloadMetadata(objectName)
+	}
+	return "", nil, fmt.Errorf("%w: %s", ErrMetadataUnsupported, objectName)
+}
+
+// StatPayload describes an object through the wrapped storage, when it supports it
+func (c *ListingCache) StatPayload(objectName string) (*ObjectStat, error) {
+	if statter, ok := c.inner.(PayloadStatter); ok {
+		return statter.StatPayload(objectName)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrStatUnsupported, objectName)
+}
+
+// ComposePayload appends server-side through the wrapped storage, when it supports it
+func (c *ListingCache) ComposePayload(objectName string, data []byte, contentType string, metadata map[string]string) (int64, error) {
+	composer, ok := c.inner.(ObjectComposer)
+	if !ok {
+		return 0, ErrComposeUnsupported
+	}
+	defer c.Invalidate()
+	return composer.ComposePayload(objectName, data, contentType, metadata)
+}
+
+// SavePayloadStream streams through the wrapped storage, when it supports it
+func (c *ListingCache) SavePayloadStream(objectName string, body io.Reader, size int64, contentType string, metadata map[string]string, progress UploadProgressFunc) (int64, error) {
+	streamer, ok := c.inner.(StreamSaver)
+	if !ok {
+		return 0, ErrStreamUnsupported
+	}
+	defer c.Invalidate()
+	return streamer.SavePayloadStream(objectName, body, size, contentType, metadata, progress)
+}
+
+// DeletePayload deletes from the wrapped storage and invalidates the cache
+func (c *ListingCache) DeletePayload(objectName string) error {
+	return c.DeletePayloadContext(context.Background(), objectName)
+}
+
+// DeletePayloadContext deletes as DeletePayload does, under ctx
+func (c *ListingCache) DeletePayloadContext(ctx context.Context, objectName string) error {
+	defer c.Invalidate()
+	return deletePayload(ctx, c.inner, objectName)
+}
+
+// ListPayloads returns the cached listing, walking the bucket only once it has expired
+func (c *ListingCache) ListPayloads() ([]string, error) {
+	return c.ListPayloadsContext(context.Background())
+}
+
+// ListPayloadsContext lists as ListPayloads does; a walk of the bucket runs under ctx
+func (c *ListingCache) ListPayloadsContext(ctx context.Context) ([]string, error) {
+	infos, err := c.listing(ctx)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]string, len(infos))
+	for i, info := range infos {
+		objects[i] = info.ObjectName
+	}
+	return objects, nil
+}
+
+// ListPayloadInfo returns the cached listing with each object's size, content type
+// and modification time, when the wrapped storage lists them
+func (c *ListingCache) ListPayloadInfo() ([]ObjectInfo, error) {
+	if _, ok := c.inner.(ObjectLister); !ok {
+		return nil, ErrListInfoUnsupported
+	}
+	return c.listing(context.Background())
+}
+
+// listing returns the cached listing, walking the bucket only once it has expired. A
+// walk ended by ctx is not cached, and the next caller walks again.
+func (c *ListingCache) listing(ctx context.Context) ([]ObjectInfo, error) {
+	if objects, ok := c.cached(); ok {
+		return objects, nil
+	}
+
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+	if objects, ok := c.cached(); ok {
+		return objects, nil
+	}
+
+	c.mu.Lock()
+	generation := c.generation
+	c.mu.Unlock()
+
+	var objects []ObjectInfo
+	if lister, ok := c.inner.(ObjectLister); ok {
+		infos, err := lister.ListPayloadInfo()
+		if err != nil {
+			return nil, err
+		}
+		objects = infos
+	} else {
+		names, err := listPayloads(ctx, c.inner)
+		if err != nil {
+			return nil, err
+		}
+		objects = make([]ObjectInfo, len(names))
+		for i, name := range names {
+			objects[i] = ObjectInfo{ObjectName: name}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// A write that landed mid-walk may be missing from this listing, so keep it uncached
+	if c.generation == generation {
+		c.objects = objects
+		c.byRequest = make(map[string][]string)
+		c.expires = time.Now().Add(c.ttl)
+	}
+	return append([]ObjectInfo{}, objects...), nil
+}
+
+// ListRequestPayloads returns the objects stored under a request ID from the cached listing
+func (c *ListingCache) ListRequestPayloads(requestID string) ([]string, error) {
+	return c.ListRequestPayloadsContext(context.Background(), requestID)
+}
+
+// ListRequestPayloadsContext lists one request as ListRequestPayloads does, under ctx
+func (c *ListingCache) ListRequestPayloadsContext(ctx context.Context, requestID string) ([]string, error) {
+	c.mu.Lock()
+	if time.Now().Before(c.expires) {
+		if matched, ok := c.byRequest[requestID]; ok {
+			c.mu.Unlock()
+			return append([]string{}, matched...), nil
+		}
+	}
+	c.mu.Unlock()
+
+	objects, err := c.ListPayloadsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	matched := []string{}
+	for _, objectName := range objects {
+		if IsRequestObject(objectName, requestID) {
+			matched = append(matched, objectName)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Now().Before(c.expires) {
+		c.byRequest[requestID] = matched
+	}
+	return append([]string{}, matched...), nil
+}
+
+// Invalidate drops every cached listing
+func (c *ListingCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.objects = nil
+	c.byRequest = make(map[string][]string)
+	c.expires = time.Time{}
+}
+
+// PayloadStored invalidates the cache when an object is stored
+func (c *ListingCache) PayloadStored(record ObjectRecord) {
+	c.Invalidate()
+}
+
+// PayloadDeleted invalidates the cache when an object is removed
+func (c *ListingCache) PayloadDeleted(record ObjectRecord) {
+	c.Invalidate()
+}
+
+func (c *ListingCache) cached() ([]ObjectInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !time.Now().Before(c.expires) {
+		return nil, false
+	}
+	return append([]ObjectInfo{}, c.objects...), true
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// localMetaDir holds each object's content type and metadata, beside the payloads
+const localMetaDir = ".depot-meta"
+
+// localTempPrefix marks files still being written; they are never listed
+const localTempPrefix = ".depot-tmp-"
+
+// localObjectMeta is the sidecar stored for every object
+type localObjectMeta struct {
+	ContentType string            `json:"content_type"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// LocalStorageService keeps payloads as files under a root directory, so small
+// deployments can run without MinIO. Object names map to paths below the root;
+// names that would escape it are rejected. Every write goes to a temporary file
+// that is renamed into place, so readers never see a partial payload.
+type LocalStorageService struct {
+	root string
+}
+
+// NewLocalStorageService stores payloads under root, creating it if needed
+func NewLocalStorageService(root string) (*LocalStorageService, error) {
+	if root == "" {
+		return nil, fmt.Errorf("local storage needs a root directory")
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid local storage root: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, localMetaDir), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create local storage root %s: %v", root, err)
+	}
+	return &LocalStorageService{root: root}, nil
+}
+
+// objectPath maps an object name to its file, rejecting names that are absolute,
+// not clean, or would reach outside the root or into the sidecar directory
+func (l *LocalStorageService) objectPath(dir, objectName string) (string, error) {
+	if objectName == "" || strings.ContainsAny(objectName, "\\\x00") ||
+		path.IsAbs(objectName) || path.Clean(objectName) != objectName {
+		return "", fmt.Errorf("invalid object name %q", objectName)
+	}
+	for _, part := range strings.Split(objectName, "/") {
+		if part == ".." || part == localMetaDir || strings.HasPrefix(part, localTempPrefix) {
+			return "", fmt.Errorf("invalid object name %q", objectName)
+		}
+	}
+	return filepath.Join(l.root, dir, filepath.FromSlash(objectName)), nil
+}
+
+// writeAtomic copies body into a temporary file beside target and renames it into place
+func writeAtomic(target string, body io.Reader) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), localTempPrefix+"*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, body)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return 0, err
+	}
+	return n, os.Rename(tmp.Name(), target)
+}
+
+// save writes an object's metadata, then its data, so a listed object always has
+// metadata to read
+func (l *LocalStorageService) save(objectName string, body io.Reader, contentType string, metadata map[string]string) (int64, error) {
+	target, err := l.objectPath("", objectName)
+	if err != nil {
+		return 0, err
+	}
+	metaPath, _ := l.objectPath(localMetaDir, objectName)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	meta, err := json.Marshal(localObjectMeta{ContentType: contentType, Metadata: metadata})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := writeAtomic(metaPath+".json", bytes.NewReader(meta)); err != nil {
+		return 0, fmt.Errorf("failed to write metadata for %s: %v", objectName, err)
+	}
+	n, err := writeAtomic(target, body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to write object %s: %w", objectName, err)
+	}
+	return n, nil
+}
+
+// SavePayload writes a payload to disk
+func (l *LocalStorageService) SavePayload(objectName string, data []byte, contentType string, metadata map[string]string) error {
+	if _, err := l.save(objectName, bytes.NewReader(data), contentType, metadata); err != nil {
+		return err
+	}
+	log.Printf("Successfully saved payload to %s: %s (size: %d bytes)", l.root, objectName, len(data))
+	return nil
+}
+
+// SavePayloadStream copies a body to disk without buffering it
+func (l *LocalStorageService) SavePayloadStream(objectName string, body io.Reader, size int64, contentType string, metadata map[string]string, progress UploadProgressFunc) (int64, error) {
+	n, err := l.save(objectName, body, contentType, metadata)
+	if err != nil {
+		return 0, err
+	}
+	if progress != nil {
+		progress(n, 1)
+	}
+	return n, nil
+}
+
+// GetPayload reads a payload from disk
+func (l *LocalStorageService) GetPayload(objectName string) ([]byte, error) {
+	target, err := l.objectPath("", objectName)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %w", objectName, err)
+	}
+	return data, nil
+}
+
+// GetPayloadStream opens a payload file for reading
+func (l *LocalStorageService) GetPayloadStream(objectName string) (io.ReadCloser, int64, error) {
+	target, err := l.objectPath("", objectName)
+	if err != nil {
+		return nil, 0, err
+	}
+	file, err := os.Open(target)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read object %s: %w", objectName, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("failed to stat object %s: %w", objectName, err)
+	}
+	return file, info.Size(), nil
+}
+
+// GetPayloadMetadata reads a payload's content type and metadata from its sidecar
+func (l *LocalStorageService) GetPayloadMetadata(objectName string) (string, map[string]string, error) {
+	metaPath, err := l.objectPath(localMetaDir, objectName)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := os.ReadFile(metaPath + ".json")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to stat object %s: %w", objectName, err)
+	}
+	var meta localObjectMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return "", nil, fmt.Errorf("corrupt metadata for object %s: %v", objectName, err)
+	}
+	return meta.ContentType, meta.Metadata, nil
+}
+
+// StatPayload describes a payload from its file and its sidecar
+func (l *LocalStorageService) StatPayload(objectName string) (*ObjectStat, error) {
+	target, err := l.objectPath("", objectName)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat object %s: %w", objectName, err)
+	}
+	// A file placed under the root without the depot has no sidecar
+	contentType, metadata, err := l.GetPayloadMetadata(objectName)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return &ObjectStat{
+		ObjectInfo: ObjectInfo{
+			ObjectName:   objectName,
+			Size:         info.Size(),
+			ContentType:  contentType,
+			LastModified: info.ModTime().UTC(),
+		},
+		Metadata: metadata,
+	}, nil
+}
+
+// ListPayloadInfo lists every payload under the root, sorted by name, with its file
+// size and modification time, and the content type from its sidecar
+func (l *LocalStorageService) ListPayloadInfo() ([]ObjectInfo, error) {
+	objects, err := l.ListPayloads()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]ObjectInfo, 0, len(objects))
+	for _, objectName := range objects {
+		stat, err := os.Stat(filepath.Join(l.root, filepath.FromSlash(objectName)))
+		if err != nil {
+			// Deleted since it was listed
+			continue
+		}
+		contentType, _, _ := l.GetPayloadMetadata(objectName)
+		infos = append(infos, ObjectInfo{
+			ObjectName:   objectName,
+			Size:         stat.Size(),
+			ContentType:  contentType,
+			LastModified: stat.ModTime().UTC(),
+		})
+	}
+	return infos, nil
+}
+
+// ListPayloads lists every payload under the root, sorted by name
+func (l *LocalStorageService) ListPayloads() ([]string, error) {
+	var objects []string
+	err := filepath.WalkDir(l.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != l.root && d.Name() == localMetaDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), localTempPrefix) {
+			return nil
+		}
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing objects: %v", err)
+	}
+	sort.Strings(objects)
+	return objects, nil
+}
+
+// DeletePayload removes a payload and its metadata; missing payloads are not an error
+func (l *LocalStorageService) DeletePayload(objectName string) error {
+	target, err := l.objectPath("", objectName)
+	if err != nil {
+		return err
+	}
+	metaPath, _ := l.objectPath(localMetaDir, objectName)
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete object %s: %v", objectName, err)
+	}
+	if err := os.Remove(metaPath + ".json"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete metadata for %s: %v", objectName, err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// logContextKey keys the logger of a request in its context
+type logContextKey struct{}
+
+// requestLogger holds the attributes logged with every line of one request. Stages
+// that learn more about the request, such as its tenant or the request ID an upload
+// is stored under, add to it, so later lines, the access log line included, carry it.
+type requestLogger struct {
+	base *slog.Logger
+
+	mu     sync.Mutex
+	keys   []string
+	values map[string]slog.Attr
+	logger *slog.Logger
+}
+
+// ContextWithLogger returns a context whose lines are logged by logger, with attrs
+func ContextWithLogger(ctx context.Context, logger *slog.Logger, attrs ...slog.Attr) context.Context {
+	holder := &requestLogger{base: logger, values: make(map[string]slog.Attr), logger: logger}
+	holder.add(attrs)
+	return context.WithValue(ctx, logContextKey{}, holder)
+}
+
+// AddLogAttrs adds attributes to the lines a context logs from now on, replacing
+// those with the same key. It does nothing for a context without a logger.
+func AddLogAttrs(ctx context.Context, attrs ...slog.Attr) {
+	if ctx == nil {
+		return
+	}
+	if holder, ok := ctx.Value(logContextKey{}).(*requestLogger); ok {
+		holder.add(attrs)
+	}
+}
+
+// LoggerWith adds attributes to the lines a context logs, as AddLogAttrs does, and
+// returns its logger. A context without a logger gets the default logger with them.
+func LoggerWith(ctx context.Context, attrs ...slog.Attr) *slog.Logger {
+	if ctx != nil {
+		if holder, ok := ctx.Value(logContextKey{}).(*requestLogger); ok {
+			holder.add(attrs)
+			return Logger(ctx)
+		}
+	}
+	args := make([]any, len(attrs))
+	for i, attr := range attrs {
+		args[i] = attr
+	}
+	return slog.Default().With(args...)
+}
+
+// Logger returns the logger of a context, or the default logger
+func Logger(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if holder, ok := ctx.Value(logContextKey{}).(*requestLogger); ok {
+			holder.mu.Lock()
+			defer holder.mu.Unlock()
+			return holder.logger
+		}
+	}
+	return slog.Default()
+}
+
+func (h *requestLogger) add(attrs []slog.Attr) {
+	if len(attrs) == 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, attr := range attrs {
+		if _, ok := h.values[attr.Key]; !ok {
+			h.keys = append(h.keys, attr.Key)
+		}
+		h.values[attr.Key] = attr
+	}
+	args := make([]any, 0, len(h.keys))
+	for _, key := range h.keys {
+		args = append(args, h.values[key])
+	}
+	h.logger = h.base.With(args...)
+}
+
+// NewLogger creates a logger writing to stderr in format, "text" or "json", that drops
+// lines below level: "debug", "info", "warn" or "error"
+func NewLogger(format, level string) (*slog.Logger, error) {
+	var minLevel slog.Level
+	if err := minLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unsupported log level %q; use debug, info, warn or error", level)
+	}
+	options := &slog.HandlerOptions{Level: minLevel}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, options)), nil
+	}
+	return nil, fmt.Errorf("unsupported log format %q; use text or json", format)
+}
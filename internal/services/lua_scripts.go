@@ -0,0 +1,555 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// Hook points a script can implement by defining a global function of the same name
+const (
+	ScriptValidate  = "validate"
+	ScriptTransform = "transform"
+	ScriptRoute     = "route"
+	ScriptNotify    = "notify"
+)
+
+// ErrPayloadRejected is returned when a validate script refuses a payload
+var ErrPayloadRejected = errors.New("payload rejected")
+
+// LuaScripts runs deployment-specific Lua scripts at fixed points of a payload's life:
+// validate and transform before it is stored, route and notify after. Scripts run
+// sandboxed, with only the base, string, table and math libraries, a small depot.*
+// API and a time limit per call.
+type LuaScripts struct {
+	scripts      []luaScript
+	storage      StorageService
+	timeout      time.Duration
+	maxBytes     int64
+	allowedHosts []string
+	client       *http.Client
+	router       PayloadRouter
+
+	// runtimes pools sandboxes; a nil entry is rebuilt on use
+	runtimes chan *luaRuntime
+}
+
+type luaScript struct {
+	name  string
+	proto *lua.FunctionProto
+	hooks map[string]bool
+}
+
+// luaRuntime is one sandbox holding every script, each in its own global environment
+type luaRuntime struct {
+	state *lua.LState
+	envs  []*lua.LTable
+}
+
+// LoadLuaScripts compiles every *.lua file in dir, in name order. Payloads larger than
+// maxBytes are passed to scripts without their data, poolSize sandboxes run calls in
+// parallel, and depot.http_post may only reach allowedHosts.
+func LoadLuaScripts(dir string, storage StorageService, timeout time.Duration, maxBytes int64, poolSize int, allowedHosts []string) (*LuaScripts, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.lua"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no .lua scripts in %s", dir)
+	}
+	sort.Strings(paths)
+	if poolSize < 1 {
+		poolSize = 1
+	}
+
+	s := &LuaScripts{
+		storage:      storage,
+		timeout:      timeout,
+		maxBytes:     maxBytes,
+		allowedHosts: allowedHosts,
+		runtimes:     make(chan *luaRuntime, poolSize),
+	}
+	s.client = &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return s.checkHost(req.URL)
+		},
+	}
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Base(path)
+		chunk, err := parse.Parse(bytes.NewReader(source), name)
+		if err != nil {
+			return nil, fmt.Errorf("script %s: %v", name, err)
+		}
+		proto, err := lua.Compile(chunk, name)
+		if err != nil {
+			return nil, fmt.Errorf("script %s: %v", name, err)
+		}
+		s.scripts = append(s.scripts, luaScript{name: name, proto: proto})
+	}
+
+	// Build one sandbox up front so scripts that fail to load are caught at startup,
+	// and record which hooks each script defines
+	runtime, err := s.newRuntime()
+	if err != nil {
+		return nil, err
+	}
+	for i := range s.scripts {
+		s.scripts[i].hooks = make(map[string]bool)
+		for _, hook := range []string{ScriptValidate, ScriptTransform, ScriptRoute, ScriptNotify} {
+			if runtime.envs[i].RawGetString(hook).Type() == lua.LTFunction {
+				s.scripts[i].hooks[hook] = true
+			}
+		}
+	}
+	s.runtimes <- runtime
+	for i := 1; i < poolSize; i++ {
+		s.runtimes <- nil
+	}
+	return s, nil
+}
+
+// SetRouter lets route scripts forward stored payloads to named targets
+func (s *LuaScripts) SetRouter(router PayloadRouter) {
+	s.router = router
+}
+
+// Names returns the loaded scripts in the order they run
+func (s *LuaScripts) Names() []string {
+	names := make([]string, len(s.scripts))
+	for i, script := range s.scripts {
+		names[i] = script.name
+	}
+	return names
+}
+
+// Validate runs every validate hook on a payload; a hook rejects the payload by
+// returning false and an optional reason
+func (s *LuaScripts) Validate(requestID string, payload ProcessedPayload, tags []string) error {
+	_, err := s.runPayloadHook(ScriptValidate, requestID, payload, tags)
+	return err
+}
+
+// Transform runs every transform hook on a payload in script order; a hook may return a
+// table with new data and/or content_type
+func (s *LuaScripts) Transform(requestID string, payload ProcessedPayload, tags []string) (ProcessedPayload, error) {
+	return s.runPayloadHook(ScriptTransform, requestID, payload, tags)
+}
+
+func (s *LuaScripts) runPayloadHook(hook string, requestID string, payload ProcessedPayload, tags []string) (ProcessedPayload, error) {
+	if !s.defines(hook) {
+		return payload, nil
+	}
+	err := s.withRuntime(func(runtime *luaRuntime) error {
+		for i, script := range s.scripts {
+			if !script.hooks[hook] {
+				continue
+			}
+			results, err := runtime.call(s.timeout, i, hook, s.payloadTable(runtime.state, requestID, payload, len(payload.Data), tags))
+			if err != nil {
+				return fmt.Errorf("script %s: %s: %v", script.name, hook, err)
+			}
+			if hook == ScriptValidate {
+				if err := validateResult(script.name, results); err != nil {
+					return err
+				}
+				continue
+			}
+			payload = transformResult(payload, results)
+		}
+		return nil
+	})
+	return payload, err
+}
+
+// PayloadStored runs the route and notify hooks in the background; self-test probes are skipped
+func (s *LuaScripts) PayloadStored(record ObjectRecord) {
+	if slices.Contains(record.Tags, SelfTestTag) || (!s.defines(ScriptRoute) && !s.defines(ScriptNotify)) {
+		return
+	}
+	go s.afterStore(record)
+}
+
+// PayloadDeleted is a no-op; scripts only run for stored payloads
+func (s *LuaScripts) PayloadDeleted(record ObjectRecord) {}
+
+func (s *LuaScripts) afterStore(record ObjectRecord) {
+	payload := ProcessedPayload{
+		ObjectName:  record.ObjectName,
+		ContentType: record.ContentType,
+		Filename:    record.OriginalFilename,
+		SHA256:      record.SHA256,
+	}
+	if int64(record.Size) <= s.maxBytes {
+		data, err := s.storage.GetPayload(record.ObjectName)
+		if err != nil {
+			log.Printf("Error reading %s for scripts: %v", record.ObjectName, err)
+		}
+		payload.Data = data
+	}
+
+	// One failing script does not stop the others; the sandbox is still replaced afterwards
+	var targets []string
+	err := s.withRuntime(func(runtime *luaRuntime) error {
+		var failures []error
+		for _, hook := range []string{ScriptRoute, ScriptNotify} {
+			for i, script := range s.scripts {
+				if !script.hooks[hook] {
+					continue
+				}
+				results, err := runtime.call(s.timeout, i, hook, s.payloadTable(runtime.state, record.RequestID, payload, record.Size, record.Tags))
+				if err != nil {
+					failures = append(failures, fmt.Errorf("script %s: %s: %v", script.name, hook, err))
+					continue
+				}
+				if hook == ScriptRoute && len(results) > 0 {
+					targets = append(targets, luaStrings(results[0])...)
+				}
+			}
+		}
+		return errors.Join(failures...)
+	})
+	if err != nil {
+		log.Printf("Error running scripts for %s: %v", record.ObjectName, err)
+	}
+
+	for _, target := range targets {
+		if s.router == nil {
+			log.Printf("Script routed %s to %s, but forwarding is not configured", record.ObjectName, target)
+			break
+		}
+		if err := s.router.ForwardTo(record, target); err != nil {
+			log.Printf("Error routing %s: %v", record.ObjectName, err)
+		}
+	}
+}
+
+func (s *LuaScripts) defines(hook string) bool {
+	for _, script := range s.scripts {
+		if script.hooks[hook] {
+			return true
+		}
+	}
+	return false
+}
+
+// withRuntime runs fn in a pooled sandbox. A sandbox whose call failed is discarded,
+// since a timed-out script may have left it in any state.
+func (s *LuaScripts) withRuntime(fn func(runtime *luaRuntime) error) error {
+	runtime := <-s.runtimes
+	if runtime == nil {
+		var err error
+		if runtime, err = s.newRuntime(); err != nil {
+			s.runtimes <- nil
+			return err
+		}
+	}
+	err := fn(runtime)
+	if err != nil && !errors.Is(err, ErrPayloadRejected) {
+		runtime.state.Close()
+		runtime = nil
+	}
+	s.runtimes <- runtime
+	return err
+}
+
+// newRuntime creates a sandbox and runs every script's top level in it
+func (s *LuaScripts) newRuntime() (*luaRuntime, error) {
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:    true,
+		CallStackSize:   256,
+		RegistrySize:    1024,
+		RegistryMaxSize: 64 * 1024,
+	})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	// Nothing may load code or reach the filesystem
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "require", "module", "collectgarbage", "getfenv", "setfenv", "newproxy", "_printregs"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	L.SetGlobal("depot", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"log":         luaLog,
+		"sha256":      luaSHA256,
+		"json_encode": luaJSONEncode,
+		"json_decode": luaJSONDecode,
+		"http_post":   s.luaHTTPPost,
+	}))
+	L.SetGlobal("print", L.GetField(L.GetGlobal("depot"), "log"))
+
+	runtime := &luaRuntime{state: L}
+	for _, script := range s.scripts {
+		env := L.NewTable()
+		meta := L.NewTable()
+		L.SetField(meta, "__index", L.G.Global)
+		L.SetMetatable(env, meta)
+
+		fn := L.NewFunctionFromProto(script.proto)
+		fn.Env = env
+		if err := runtime.protectedCall(s.timeout, fn); err != nil {
+			L.Close()
+			return nil, fmt.Errorf("script %s: %v", script.name, err)
+		}
+		runtime.envs = append(runtime.envs, env)
+	}
+	return runtime, nil
+}
+
+// call runs one script's hook and returns its results
+func (r *luaRuntime) call(timeout time.Duration, script int, hook string, args ...lua.LValue) ([]lua.LValue, error) {
+	fn := r.envs[script].RawGetString(hook)
+	top := r.state.GetTop()
+	if err := r.protectedCall(timeout, fn, args...); err != nil {
+		return nil, err
+	}
+	results := make([]lua.LValue, 0, r.state.GetTop()-top)
+	for i := top + 1; i <= r.state.GetTop(); i++ {
+		results = append(results, r.state.Get(i))
+	}
+	r.state.SetTop(top)
+	return results, nil
+}
+
+func (r *luaRuntime) protectedCall(timeout time.Duration, fn lua.LValue, args ...lua.LValue) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	r.state.SetContext(ctx)
+	defer r.state.RemoveContext()
+
+	err := r.state.CallByParam(lua.P{Fn: fn, NRet: lua.MultRet, Protect: true}, args...)
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	return err
+}
+
+// payloadTable exposes a payload to scripts; data is left out above the size limit
+func (s *LuaScripts) payloadTable(L *lua.LState, requestID string, payload ProcessedPayload, size int, tags []string) *lua.LTable {
+	table := L.NewTable()
+	table.RawSetString("request_id", lua.LString(requestID))
+	table.RawSetString("object_name", lua.LString(payload.ObjectName))
+	table.RawSetString("filename", lua.LString(payload.Filename))
+	table.RawSetString("content_type", lua.LString(payload.ContentType))
+	table.RawSetString("size", lua.LNumber(size))
+	if payload.SHA256 != "" {
+		table.RawSetString("sha256", lua.LString(payload.SHA256))
+	}
+	if payload.Data != nil && int64(len(payload.Data)) <= s.maxBytes {
+		table.RawSetString("data", lua.LString(payload.Data))
+	}
+	tagList := L.NewTable()
+	for _, tag := range tags {
+		tagList.Append(lua.LString(tag))
+	}
+	table.RawSetString("tags", tagList)
+	return table
+}
+
+// validateResult turns a validate hook's results into a rejection, if it returned false
+func validateResult(script string, results []lua.LValue) error {
+	if len(results) == 0 || results[0] != lua.LFalse {
+		return nil
+	}
+	reason := "rejected by " + script
+	if len(results) > 1 && results[1].Type() == lua.LTString {
+		reason = results[1].String()
+	}
+	return fmt.Errorf("%w: %s", ErrPayloadRejected, reason)
+}
+
+// transformResult applies the data and content_type a transform hook returned
+func transformResult(payload ProcessedPayload, results []lua.LValue) ProcessedPayload {
+	if len(results) == 0 {
+		return payload
+	}
+	table, ok := results[0].(*lua.LTable)
+	if !ok {
+		return payload
+	}
+	if data, ok := table.RawGetString("data").(lua.LString); ok {
+		payload.Data = []byte(data)
+	}
+	if contentType, ok := table.RawGetString("content_type").(lua.LString); ok && contentType != "" {
+		payload.ContentType = string(contentType)
+	}
+	return payload
+}
+
+// luaStrings reads a string or a list of strings
+func luaStrings(value lua.LValue) []string {
+	switch v := value.(type) {
+	case lua.LString:
+		return []string{string(v)}
+	case *lua.LTable:
+		var values []string
+		v.ForEach(func(_, item lua.LValue) {
+			if s, ok := item.(lua.LString); ok {
+				values = append(values, string(s))
+			}
+		})
+		return values
+	}
+	return nil
+}
+
+func luaLog(L *lua.LState) int {
+	parts := make([]string, L.GetTop())
+	for i := range parts {
+		parts[i] = L.ToStringMeta(L.Get(i + 1)).String()
+	}
+	log.Printf("[script] %s", strings.Join(parts, " "))
+	return 0
+}
+
+func luaSHA256(L *lua.LState) int {
+	sum := sha256.Sum256([]byte(L.CheckString(1)))
+	L.Push(lua.LString(hex.EncodeToString(sum[:])))
+	return 1
+}
+
+func luaJSONEncode(L *lua.LState) int {
+	data, err := json.Marshal(luaToGo(L.CheckAny(1), 0))
+	if err != nil {
+		L.RaiseError("json_encode: %v", err)
+	}
+	L.Push(lua.LString(data))
+	return 1
+}
+
+func luaJSONDecode(L *lua.LState) int {
+	var value any
+	if err := json.Unmarshal([]byte(L.CheckString(1)), &value); err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(goToLua(L, value))
+	return 1
+}
+
+// luaHTTPPost implements depot.http_post(url, body, content_type), returning the status
+// code, or nil and an error message. Only allowed hosts can be reached.
+func (s *LuaScripts) luaHTTPPost(L *lua.LState) int {
+	target, err := url.Parse(L.CheckString(1))
+	if err == nil {
+		err = s.checkHost(target)
+	}
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	ctx := L.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.String(), strings.NewReader(L.OptString(2, "")))
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	req.Header.Set("Content-Type", L.OptString(3, "application/json"))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	resp.Body.Close()
+	L.Push(lua.LNumber(resp.StatusCode))
+	return 1
+}
+
+func (s *LuaScripts) checkHost(target *url.URL) error {
+	if (target.Scheme != "http" && target.Scheme != "https") || !slices.Contains(s.allowedHosts, target.Hostname()) {
+		return fmt.Errorf("host %q is not allowed", target.Host)
+	}
+	return nil
+}
+
+// maxLuaDepth bounds nested tables converted to JSON, so cyclic tables cannot recurse forever
+const maxLuaDepth = 32
+
+// luaToGo converts a Lua value for JSON encoding; tables with keys 1..n become arrays
+func luaToGo(value lua.LValue, depth int) any {
+	switch v := value.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		return float64(v)
+	case lua.LString:
+		return string(v)
+	case *lua.LTable:
+		if depth >= maxLuaDepth {
+			return nil
+		}
+		if n := v.Len(); n > 0 {
+			list := make([]any, 0, n)
+			for i := 1; i <= n; i++ {
+				list = append(list, luaToGo(v.RawGetInt(i), depth+1))
+			}
+			return list
+		}
+		object := make(map[string]any)
+		v.ForEach(func(key, item lua.LValue) {
+			object[key.String()] = luaToGo(item, depth+1)
+		})
+		return object
+	}
+	return nil
+}
+
+// goToLua converts a decoded JSON value to Lua
+func goToLua(L *lua.LState, value any) lua.LValue {
+	switch v := value.(type) {
+	case bool:
+		return lua.LBool(v)
+	case float64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case []any:
+		table := L.NewTable()
+		for _, item := range v {
+			table.Append(goToLua(L, item))
+		}
+		return table
+	case map[string]any:
+		table := L.NewTable()
+		for key, item := range v {
+			table.RawSetString(key, goToLua(L, item))
+		}
+		return table
+	}
+	return lua.LNil
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// memoryObject is one payload held in memory
+type memoryObject struct {
+	data        []byte
+	contentType string
+	metadata    map[string]string
+	modified    time.Time
+	seq         uint64
+}
+
+// memoryEntry records when a name was written, oldest first
+type memoryEntry struct {
+	name string
+	seq  uint64
+}
+
+// MemoryStorageService keeps payloads in memory only, for an ephemeral depot that
+// captures requests in CI without any disk or object store. Everything is lost on
+// restart. With a size cap, the oldest payloads are dropped to make room for new
+// ones.
+type MemoryStorageService struct {
+	maxBytes int64
+
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+	order   []memoryEntry
+	size    int64
+	seq     uint64
+}
+
+// NewMemoryStorageService creates an empty store holding at most maxBytes of
+// payloads; 0 means no cap
+func NewMemoryStorageService(maxBytes int64) (*MemoryStorageService, error) {
+	if maxBytes < 0 {
+		return nil, fmt.Errorf("memory storage cap must not be negative, got %d", maxBytes)
+	}
+	return &MemoryStorageService{
+		maxBytes: maxBytes,
+		objects:  make(map[string]memoryObject),
+	}, nil
+}
+
+// SavePayload stores a copy of data, evicting the oldest payloads if the cap is exceeded
+func (m *MemoryStorageService) SavePayload(objectName string, data []byte, contentType string, metadata map[string]string) error {
+	if m.maxBytes > 0 && int64(len(data)) > m.maxBytes {
+		return fmt.Errorf("payload %s of %d bytes exceeds the memory storage cap of %d bytes", objectName, len(data), m.maxBytes)
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.removeLocked(objectName)
+	m.seq++
+	m.objects[objectName] = memoryObject{
+		data:        slices.Clone(data),
+		contentType: contentType,
+		metadata:    maps.Clone(metadata),
+		modified:    time.Now().UTC(),
+		seq:         m.seq,
+	}
+	m.size += int64(len(data))
+	if m.maxBytes > 0 {
+		m.order = append(m.order, memoryEntry{name: objectName, seq: m.seq})
+		m.evictLocked()
+	}
+	return nil
+}
+
+// SavePayloadStream reads a body into memory; there is nothing to stream it to
+func (m *MemoryStorageService) SavePayloadStream(objectName string, body io.Reader, size int64, contentType string, metadata map[string]string, progress UploadProgressFunc) (int64, error) {
+	if m.maxBytes > 0 && size > m.maxBytes {
+		return 0, fmt.Errorf("payload %s of %d bytes exceeds the memory storage cap of %d bytes", objectName, size, m.maxBytes)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read body for %s: %w", objectName, err)
+	}
+	if err := m.SavePayload(objectName, data, contentType, metadata); err != nil {
+		return 0, err
+	}
+	if progress != nil {
+		progress(int64(len(data)), 1)
+	}
+	return int64(len(data)), nil
+}
+
+// evictLocked drops the oldest payloads until the store is within its cap
+func (m *MemoryStorageService) evictLocked() {
+	for m.maxBytes > 0 && m.size > m.maxBytes && len(m.order) > 0 {
+		oldest := m.order[0]
+		m.order = m.order[1:]
+		if object, ok := m.objects[oldest.name]; ok && object.seq == oldest.seq {
+			m.removeLocked(oldest.name)
+			log.Printf("Evicted %s from memory storage to stay within %d bytes", oldest.name, m.maxBytes)
+		}
+	}
+	m.compactLocked()
+}
+
+// compactLocked drops entries of rewritten and deleted payloads from order, so it does
+// not grow without bound when the same names are written over and over
+func (m *MemoryStorageService) compactLocked() {
+	if len(m.order) <= 2*len(m.objects)+64 {
+		return
+	}
+	m.order = slices.DeleteFunc(m.order, func(entry memoryEntry) bool {
+		object, ok := m.objects[entry.name]
+		return !ok || object.seq != entry.seq
+	})
+}
+
+// removeLocked forgets a payload; its entry in order is skipped when reached
+func (m *MemoryStorageService) removeLocked(objectName string) {
+	if object, ok := m.objects[objectName]; ok {
+		m.size -= int64(len(object.data))
+		delete(m.objects, objectName)
+	}
+}
+
+// GetPayload returns a copy of a payload
+func (m *MemoryStorageService) GetPayload(objectName string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	object, ok := m.objects[objectName]
+	if !ok {
+		return nil, fmt.Errorf("failed to read object %s: %w", objectName, fs.ErrNotExist)
+	}
+	return slices.Clone(object.data), nil
+}
+
+// GetPayloadStream reads a payload without copying it; stored data is never changed
+// in place, only replaced
+func (m *MemoryStorageService) GetPayloadStream(objectName string) (io.ReadCloser, int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	object, ok := m.objects[objectName]
+	if !ok {
+		return nil, 0, fmt.Errorf("failed to read object %s: %w", objectName, fs.ErrNotExist)
+	}
+	return io.NopCloser(bytes.NewReader(object.data)), int64(len(object.data)), nil
+}
+
+// GetPayloadMetadata returns a payload's content type and metadata
+func (m *MemoryStorageService) GetPayloadMetadata(objectName string) (string, map[string]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	object, ok := m.objects[objectName]
+	if !ok {
+		return "", nil, fmt.Errorf("failed to stat object %s: %w", objectName, fs.ErrNotExist)
+	}
+	return object.contentType, maps.Clone(object.metadata), nil
+}
+
+// StatPayload describes a payload without copying its data
+func (m *MemoryStorageService) StatPayload(objectName string) (*ObjectStat, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	object, ok := m.objects[objectName]
+	if !ok {
+		return nil, fmt.Errorf("failed to stat object %s: %w", objectName, fs.ErrNotExist)
+	}
+	return &ObjectStat{
+		ObjectInfo: ObjectInfo{
+			ObjectName:   objectName,
+			Size:         int64(len(object.data)),
+			ContentType:  object.contentType,
+			LastModified: object.modified,
+		},
+		Metadata: maps.Clone(object.metadata),
+	}, nil
+}
+
+// ListPayloads lists every payload held, sorted by name
+func (m *MemoryStorageService) ListPayloads() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Sorted(maps.Keys(m.objects)), nil
+}
+
+// ListPayloadInfo lists every payload held, sorted by name, with its size, content
+// type and the time it was written
+func (m *MemoryStorageService) ListPayloadInfo() ([]ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	infos := make([]ObjectInfo, 0, len(m.objects))
+	for _, name := range slices.Sorted(maps.Keys(m.objects)) {
+		object := m.objects[name]
+		infos = append(infos, ObjectInfo{
+			ObjectName:   name,
+			Size:         int64(len(object.data)),
+			ContentType:  object.contentType,
+			LastModified: object.modified,
+		})
+	}
+	return infos, nil
+}
+
+// DeletePayload forgets a payload; missing payloads are not an error
+func (m *MemoryStorageService) DeletePayload(objectName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.removeLocked(objectName)
+	return nil
+}
+
+// Size reports the bytes of payload held
+func (m *MemoryStorageService) Size() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.size
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"sort"
+	"sync"
+)
+
+// MemoryMetadataIndex is an embedded, in-process index of stored object metadata
+type MemoryMetadataIndex struct {
+	mu       sync.RWMutex
+	records  map[string]ObjectRecord
+	bySHA256 map[string]map[string]struct{}
+}
+
+// NewMemoryMetadataIndex creates a new empty metadata index
+func NewMemoryMetadataIndex() *MemoryMetadataIndex {
+	return &MemoryMetadataIndex{
+		records:  make(map[string]ObjectRecord),
+		bySHA256: make(map[string]map[string]struct{}),
+	}
+}
+
+// PayloadStored adds or replaces the record for a stored object
+func (i *MemoryMetadataIndex) PayloadStored(record ObjectRecord) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.removeLocked(record.ObjectName)
+	i.records[record.ObjectName] = record
+
+	if record.SHA256 == "" {
+		return
+	}
+	names, ok := i.bySHA256[record.SHA256]
+	if !ok {
+		names = make(map[string]struct{})
+		i.bySHA256[record.SHA256] = names
+	}
+	names[record.ObjectName] = struct{}{}
+}
+
+// PayloadDeleted drops the record for a removed object
+func (i *MemoryMetadataIndex) PayloadDeleted(record ObjectRecord) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.removeLocked(record.ObjectName)
+}
+
+// PayloadTiered updates the record of an object moved between storage tiers
+func (i *MemoryMetadataIndex) PayloadTiered(record ObjectRecord) {
+	i.PayloadStored(record)
+}
+
+// Get returns the record for a single object
+func (i *MemoryMetadataIndex) Get(objectName string) (ObjectRecord, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	record, ok := i.records[objectName]
+	return record, ok
+}
+
+// FindBySHA256 returns all objects whose content checksum matches, oldest first
+func (i *MemoryMetadataIndex) FindBySHA256(sha256 string) []ObjectRecord {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	var matches []ObjectRecord
+	for name := range i.bySHA256[sha256] {
+		matches = append(matches, i.records[name])
+	}
+	sortRecords(matches)
+	return matches
+}
+
+// List returns every indexed record, oldest first
+func (i *MemoryMetadataIndex) List() []ObjectRecord {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	records := make([]ObjectRecord, 0, len(i.records))
+	for _, record := range i.records {
+		records = append(records, record)
+	}
+	sortRecords(records)
+	return records
+}
+
+// TotalSize returns the combined size in bytes of all indexed objects
+func (i *MemoryMetadataIndex) TotalSize() int64 {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	var total int64
+	for _, record := range i.records {
+		total += int64(record.Size)
+	}
+	return total
+}
+
+func (i *MemoryMetadataIndex) removeLocked(objectName string) {
+	existing, ok := i.records[objectName]
+	if !ok {
+		return
+	}
+	delete(i.records, objectName)
+	if names, ok := i.bySHA256[existing.SHA256]; ok {
+		delete(names, objectName)
+		if len(names) == 0 {
+			delete(i.bySHA256, existing.SHA256)
+		}
+	}
+}
+
+// sortRecords orders records by storage time, then object name
+func sortRecords(records []ObjectRecord) {
+	sort.Slice(records, func(a, b int) bool {
+		if !records[a].StoredAt.Equal(records[b].StoredAt) {
+			return records[a].StoredAt.Before(records[b].StoredAt)
+		}
+		return records[a].ObjectName < records[b].ObjectName
+	})
+}
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS depot_objects (
+    object_name       TEXT PRIMARY KEY,
+    request_id        TEXT NOT NULL,
+    original_filename TEXT NOT NULL DEFAULT '',
+    content_type      TEXT NOT NULL DEFAULT '',
+    size              BIGINT NOT NULL DEFAULT 0,
+    sha256            TEXT NOT NULL DEFAULT '',
+    tags              TEXT NOT NULL DEFAULT '',
+    storage_tier      TEXT NOT NULL DEFAULT '',
+    stored_at         TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS depot_objects_sha256_idx ON depot_objects (sha256);
+CREATE INDEX IF NOT EXISTS depot_objects_request_id_idx ON depot_objects (request_id);
+CREATE INDEX IF NOT EXISTS depot_objects_stored_at_idx ON depot_objects (stored_at, object_name);
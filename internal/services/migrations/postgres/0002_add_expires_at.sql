@@ -0,0 +1,3 @@
+ALTER TABLE depot_objects ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS depot_objects_expires_at_idx ON depot_objects (expires_at) WHERE expires_at IS NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE depot_objects ADD COLUMN IF NOT EXISTS restored_at TIMESTAMPTZ;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS depot_requests (
+    request_id  TEXT PRIMARY KEY,
+    received_at TIMESTAMP NOT NULL,
+    source      TEXT NOT NULL DEFAULT '',
+    source_ip   TEXT NOT NULL DEFAULT '',
+    headers     TEXT NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS depot_requests_received_at_idx ON depot_requests (received_at, request_id);
+
+CREATE TABLE IF NOT EXISTS depot_request_objects (
+    request_id        TEXT NOT NULL,
+    object_name       TEXT NOT NULL,
+    original_filename TEXT NOT NULL DEFAULT '',
+    content_type      TEXT NOT NULL DEFAULT '',
+    size              INTEGER NOT NULL DEFAULT 0,
+    sha256            TEXT NOT NULL DEFAULT '',
+    state             TEXT NOT NULL,
+    error             TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (request_id, object_name)
+);
@@ -0,0 +1 @@
+ALTER TABLE depot_objects ADD COLUMN restored_at TIMESTAMP;
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/config"
+	"github.com/minio/minio-go/v7"
+)
+
+// DefaultMinioRetryCodes are the S3 error codes retried when MINIO_RETRY_CODES is unset
+var DefaultMinioRetryCodes = []string{
+	"InternalError",
+	"ServiceUnavailable",
+	"SlowDown",
+	"RequestTimeout",
+	"XMinioServerNotInitialized",
+	"XMinioReadQuorum",
+	"XMinioWriteQuorum",
+}
+
+// minioRetry retries MinIO operations that fail transiently, on top of the retries
+// minio-go makes for each HTTP request. Unlike those, it also covers a body that
+// breaks off while it is read.
+type minioRetry struct {
+	policy RetryPolicy
+	codes  []string
+}
+
+// newMinioRetry builds the retry policy of MinIO operations from the configuration;
+// fewer than 2 attempts disables retries
+func newMinioRetry(config *config.Config) (minioRetry, error) {
+	policy, err := RetryPolicy{
+		MaxAttempts:    max(int(config.MinioRetryMaxAttempts), 1),
+		Backoff:        BackoffExponential,
+		InitialBackoff: Duration(config.MinioRetryInitialBackoff),
+		MaxBackoff:     Duration(config.MinioRetryMaxBackoff),
+	}.WithDefaults()
+	if err != nil {
+		return minioRetry{}, err
+	}
+	codes := config.MinioRetryCodes
+	if len(codes) == 0 {
+		codes = DefaultMinioRetryCodes
+	}
+	return minioRetry{policy: policy, codes: codes}, nil
+}
+
+// retryable reports whether an operation failing with err may succeed if attempted again
+func (r minioRetry) retryable(err error) bool {
+	var response minio.ErrorResponse
+	if errors.As(err, &response) {
+		if slices.Contains(r.codes, response.Code) {
+			return true
+		}
+		switch response.StatusCode {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var opErr *net.OpError
+	var netErr net.Error
+	return errors.As(err, &opErr) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// do runs attempt until it succeeds, fails with an error that is not retryable, runs
+// out of attempts, or ctx ends. Each wait is drawn between half and all of the
+// policy's backoff, so clients that failed together do not retry together.
+func (r minioRetry) do(ctx context.Context, op string, attempt func() error) error {
+	var err error
+	for n := 1; ; n++ {
+		if err = attempt(); err == nil || n >= r.policy.MaxAttempts || ctx.Err() != nil || !r.retryable(err) {
+			return err
+		}
+		delay := r.policy.Delay(n)
+		delay = delay/2 + rand.N(delay/2+1)
+		log.Printf("MinIO %s failed (attempt %d/%d), retrying in %s: %v", op, n, r.policy.MaxAttempts, delay.Round(time.Millisecond), err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
@@ -3,47 +3,214 @@ package services
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ahmad-alkadri/simple-depot/internal/config"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/minio/minio-go/v7/pkg/sse"
+	"github.com/minio/minio-go/v7/pkg/tags"
 )
 
+// minPartSize is the smallest part S3 accepts in a multipart upload, other than the last
+const minPartSize = 5 << 20
+
+// defaultPartSize is the part size minio-go uses when none is configured
+const defaultPartSize = 16 << 20
+
 type MinioService struct {
-	client *minio.Client
-	bucket string
+	client       *minio.Client
+	bucket       string
+	region       string
+	storageClass string
+	// sse is the server-side encryption requested for every upload, or nil
+	sse encrypt.ServerSide
+
+	// Multipart upload tuning passed to every PutObject
+	partSize         uint64
+	numThreads       uint
+	disableMultipart bool
+
+	// objectLock creates the bucket with object locking, which legal holds and retention require
+	objectLock    bool
+	retentionMode minio.RetentionMode
+
+	// classify picks the retention class new objects are tagged with, for lifecycle expiry
+	classify func(tags []string) string
+
+	// retry re-attempts saves, reads and listings that fail transiently
+	retry minioRetry
+	// timeout bounds each request to MinIO, so a hung call cannot hold its caller
+	// forever; streamed reads and writes, which take as long as their body, are exempt
+	timeout time.Duration
 }
 
+// lifecycleClassTag is the object tag lifecycle expiry rules select objects by
+const lifecycleClassTag = "depot-retention-class"
+
+// lifecycleRulePrefix starts the IDs of the lifecycle rules the depot manages
+const lifecycleRulePrefix = "depot-retention-"
+
 // NewMinioService creates a new MinIO service
 func NewMinioService(config *config.Config) (*MinioService, error) {
-	// Initialize MinIO client
-	client, err := minio.New(config.MinioEndpoint, &minio.Options{
+	service, err := newMinioService(config, config.MinioEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create bucket if it doesn't exist
+	if err := service.ensureBucket(); err != nil {
+		return nil, fmt.Errorf("failed to ensure bucket exists: %v", err)
+	}
+
+	return service, nil
+}
+
+// NewMinioEndpoints creates one service per configured endpoint, primary first.
+// Endpoints that are unreachable at startup are kept for the health checker to
+// pick up later; an error is returned only when none of them can be reached.
+func NewMinioEndpoints(config *config.Config) ([]StorageEndpoint, error) {
+	var endpoints []StorageEndpoint
+	var lastErr error
+	reachable := 0
+
+	for _, address := range append([]string{config.MinioEndpoint}, config.MinioReplicaEndpoints...) {
+		service, err := newMinioService(config, address)
+		if err != nil {
+			return nil, err
+		}
+		if err := service.ensureBucket(); err != nil {
+			log.Printf("MinIO endpoint %s is unavailable at startup: %v", address, err)
+			lastErr = err
+		} else {
+			reachable++
+		}
+		endpoints = append(endpoints, StorageEndpoint{Name: address, Storage: service})
+	}
+
+	if reachable == 0 {
+		return nil, fmt.Errorf("no MinIO endpoint is reachable: %v", lastErr)
+	}
+	return endpoints, nil
+}
+
+// newMinioService initializes a client for one endpoint without touching the bucket
+func newMinioService(config *config.Config, endpoint string) (*MinioService, error) {
+	client, err := minio.New(endpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(config.MinioAccessKey, config.MinioSecretKey, ""),
 		Secure: config.MinioUseSSL,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize MinIO client: %v", err)
 	}
+	return newMinioServiceWithClient(config, client, config.MinioBucket, "")
+}
 
-	service := &MinioService{
-		client: client,
-		bucket: config.MinioBucket,
+// newMinioServiceWithClient applies the upload and object lock settings to a client
+// for bucket, which is created in region when it does not exist
+func newMinioServiceWithClient(config *config.Config, client *minio.Client, bucket, region string) (*MinioService, error) {
+	if config.MinioPartSize != 0 && config.MinioPartSize < minPartSize {
+		return nil, fmt.Errorf("MinIO part size must be at least %d bytes, got %d", minPartSize, config.MinioPartSize)
+	}
+	retentionMode := minio.RetentionMode(strings.ToUpper(config.MinioRetentionMode))
+	if retentionMode == "" {
+		retentionMode = minio.Governance
+	}
+	if !retentionMode.IsValid() {
+		return nil, fmt.Errorf("unsupported MinIO retention mode %q", config.MinioRetentionMode)
+	}
+	if config.MinioUploadConcurrency < 0 {
+		return nil, fmt.Errorf("MinIO upload concurrency must not be negative, got %d", config.MinioUploadConcurrency)
+	}
+	serverSide, err := serverSideEncryption(config)
+	if err != nil {
+		return nil, err
+	}
+	retry, err := newMinioRetry(config)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create bucket if it doesn't exist
-	if err := service.ensureBucket(); err != nil {
-		return nil, fmt.Errorf("failed to ensure bucket exists: %v", err)
+	return &MinioService{
+		client:           client,
+		bucket:           bucket,
+		region:           region,
+		storageClass:     config.MinioStorageClass,
+		sse:              serverSide,
+		partSize:         uint64(config.MinioPartSize),
+		numThreads:       uint(config.MinioUploadConcurrency),
+		disableMultipart: config.MinioDisableMultipart,
+		objectLock:       config.MinioObjectLock,
+		retentionMode:    retentionMode,
+		retry:            retry,
+		timeout:          config.StorageTimeout,
+	}, nil
+}
+
+// serverSideEncryption builds the SSE settings sent with every upload, or nil when
+// MINIO_SSE is unset
+func serverSideEncryption(config *config.Config) (encrypt.ServerSide, error) {
+	switch strings.ToUpper(config.MinioSSE) {
+	case "":
+		return nil, nil
+	case BucketEncryptionSSES3:
+		return encrypt.NewSSE(), nil
+	case BucketEncryptionSSEKMS:
+		if config.MinioSSEKMSKeyID == "" {
+			return nil, fmt.Errorf("MINIO_SSE_KMS_KEY_ID is required for SSE-KMS")
+		}
+		var encryptionContext any
+		if config.MinioSSEKMSContext != "" {
+			var fields map[string]string
+			if err := json.Unmarshal([]byte(config.MinioSSEKMSContext), &fields); err != nil {
+				return nil, fmt.Errorf("MINIO_SSE_KMS_CONTEXT must be a JSON object of strings: %v", err)
+			}
+			encryptionContext = fields
+		}
+		return encrypt.NewSSEKMS(config.MinioSSEKMSKeyID, encryptionContext)
 	}
+	return nil, fmt.Errorf("unsupported MINIO_SSE %q; use %s or %s", config.MinioSSE, BucketEncryptionSSES3, BucketEncryptionSSEKMS)
+}
 
-	return service, nil
+// CheckHealth probes the endpoint, recreating the bucket if the node came back empty
+func (m *MinioService) CheckHealth() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	exists, err := m.client.BucketExists(ctx, m.bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return m.ensureBucket()
+	}
+	return nil
+}
+
+// ForBucket returns a service for another bucket on the same endpoint, with the same
+// settings, creating the bucket if it doesn't exist
+func (m *MinioService) ForBucket(bucket string) (StorageService, error) {
+	scoped := *m
+	scoped.bucket = bucket
+	if err := scoped.ensureBucket(); err != nil {
+		return nil, err
+	}
+	return &scoped, nil
 }
 
 // ensureBucket creates the bucket if it doesn't exist
 func (m *MinioService) ensureBucket() error {
-	ctx := context.Background()
+	ctx, cancel := m.withTimeout(context.Background())
+	defer cancel()
 
 	exists, err := m.client.BucketExists(ctx, m.bucket)
 	if err != nil {
@@ -51,7 +218,7 @@ func (m *MinioService) ensureBucket() error {
 	}
 
 	if !exists {
-		err = m.client.MakeBucket(ctx, m.bucket, minio.MakeBucketOptions{})
+		err = m.client.MakeBucket(ctx, m.bucket, minio.MakeBucketOptions{Region: m.region, ObjectLocking: m.objectLock})
 		if err != nil {
 			return fmt.Errorf("error creating bucket: %v", err)
 		}
@@ -61,12 +228,13 @@ func (m *MinioService) ensureBucket() error {
 	return nil
 }
 
-// SavePayload saves a payload to MinIO with the appropriate content type
-func (m *MinioService) SavePayload(objectName string, data []byte, contentType string) error {
-	ctx := context.Background()
-
-	reader := bytes.NewReader(data)
+// SavePayload saves a payload to MinIO with the appropriate content type and user metadata
+func (m *MinioService) SavePayload(objectName string, data []byte, contentType string, metadata map[string]string) error {
+	return m.SavePayloadContext(context.Background(), objectName, data, contentType, metadata)
+}
 
+// SavePayloadContext saves as SavePayload does, giving up when ctx ends
+func (m *MinioService) SavePayloadContext(ctx context.Context, objectName string, data []byte, contentType string, metadata map[string]string) error {
 	// Set appropriate content type if not provided
 	if contentType == "" {
 		contentType = "application/octet-stream"
@@ -79,59 +247,487 @@ func (m *MinioService) SavePayload(objectName string, data []byte, contentType s
 		contentType = "application/octet-stream"
 	}
 
-	options := minio.PutObjectOptions{
-		ContentType: contentType,
+	options := m.putOptions(contentType, metadata)
+	err := m.retry.do(ctx, "save of "+objectName, func() error {
+		ctx, cancel := m.withTimeout(ctx)
+		defer cancel()
+		_, err := m.client.PutObject(ctx, m.bucket, objectName, bytes.NewReader(data), int64(len(data)), options)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload object %s: %w", objectName, err)
+	}
+
+	log.Printf("Successfully saved payload to MinIO: %s (size: %d bytes)", objectName, len(data))
+	return nil
+}
+
+// withTimeout bounds one request to MinIO by the storage timeout, if one is set
+func (m *MinioService) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if m.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, m.timeout)
+}
+
+// putOptions builds upload options with the configured storage class and multipart tuning
+func (m *MinioService) putOptions(contentType string, metadata map[string]string) minio.PutObjectOptions {
+	return minio.PutObjectOptions{
+		ContentType:          contentType,
+		UserMetadata:         metadata,
+		UserTags:             m.lifecycleTags(metadata),
+		StorageClass:         m.storageClass,
+		ServerSideEncryption: m.sse,
+		PartSize:             m.partSize,
+		NumThreads:           m.numThreads,
+		DisableMultipart:     m.disableMultipart,
+	}
+}
+
+// lifecycleTags tags an object with the retention class of its depot tags, once
+// expiry rules are set
+func (m *MinioService) lifecycleTags(metadata map[string]string) map[string]string {
+	if m.classify == nil {
+		return nil
+	}
+	var tags []string
+	if metadata[MetadataTags] != "" {
+		tags = strings.Split(metadata[MetadataTags], ",")
+	}
+	if class := m.classify(tags); class != "" {
+		return map[string]string{lifecycleClassTag: class}
+	}
+	return nil
+}
+
+// SetExpiryRules replaces the depot's lifecycle rules on the bucket with one
+// expiration rule per retention class, keeping rules set by anyone else, and tags
+// new objects with their class
+func (m *MinioService) SetExpiryRules(rules []ExpiryRule, classify func(tags []string) string) error {
+	ctx, cancel := m.withTimeout(context.Background())
+	defer cancel()
+
+	config, err := m.client.GetBucketLifecycle(ctx, m.bucket)
+	if minio.ToErrorResponse(err).Code == "NoSuchLifecycleConfiguration" {
+		config, err = lifecycle.NewConfiguration(), nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading lifecycle rules: %v", err)
+	}
+	kept := []lifecycle.Rule{}
+	for _, rule := range config.Rules {
+		if !strings.HasPrefix(rule.ID, lifecycleRulePrefix) {
+			kept = append(kept, rule)
+		}
+	}
+	for _, rule := range rules {
+		if _, err := tags.NewTags(map[string]string{lifecycleClassTag: rule.Class}, true); err != nil {
+			return fmt.Errorf("retention class %q cannot be an object tag: %v", rule.Class, err)
+		}
+		kept = append(kept, lifecycle.Rule{
+			ID:         lifecycleRulePrefix + rule.Class,
+			Status:     "Enabled",
+			RuleFilter: lifecycle.Filter{Tag: lifecycle.Tag{Key: lifecycleClassTag, Value: rule.Class}},
+			Expiration: lifecycle.Expiration{Days: lifecycle.ExpirationDays(rule.Days())},
+		})
+	}
+	config.Rules = kept
+	if err := m.client.SetBucketLifecycle(ctx, m.bucket, config); err != nil {
+		return fmt.Errorf("error setting lifecycle rules: %v", err)
+	}
+	m.classify = classify
+	log.Printf("Set %d lifecycle expiry rule(s) on bucket %s", len(rules), m.bucket)
+	return nil
+}
+
+// SetLegalHold places or releases the legal hold on an object; the bucket must have
+// been created with object locking
+func (m *MinioService) SetLegalHold(objectName string, enabled bool) error {
+	ctx, cancel := m.withTimeout(context.Background())
+	defer cancel()
+
+	status := minio.LegalHoldDisabled
+	if enabled {
+		status = minio.LegalHoldEnabled
+	}
+	err := m.client.PutObjectLegalHold(ctx, m.bucket, objectName, minio.PutObjectLegalHoldOptions{Status: &status})
+	if err != nil {
+		return fmt.Errorf("failed to set legal hold on %s: %v", objectName, err)
 	}
+	return nil
+}
+
+// LegalHold reports whether an object is under legal hold
+func (m *MinioService) LegalHold(objectName string) (bool, error) {
+	ctx, cancel := m.withTimeout(context.Background())
+	defer cancel()
 
-	_, err := m.client.PutObject(ctx, m.bucket, objectName, reader, int64(len(data)), options)
+	status, err := m.client.GetObjectLegalHold(ctx, m.bucket, objectName, minio.GetObjectLegalHoldOptions{})
+	if minio.ToErrorResponse(err).Code == "NoSuchObjectLockConfiguration" {
+		return false, nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to upload object %s: %v", objectName, err)
+		return false, fmt.Errorf("failed to get legal hold of %s: %v", objectName, err)
 	}
+	return *status == minio.LegalHoldEnabled, nil
+}
 
-	log.Printf("Successfully saved payload to MinIO: %s (size: %d bytes)", objectName, len(data))
+// SetRetention retains an object until the given date under the configured retention mode
+func (m *MinioService) SetRetention(objectName string, until time.Time) error {
+	ctx, cancel := m.withTimeout(context.Background())
+	defer cancel()
+
+	err := m.client.PutObjectRetention(ctx, m.bucket, objectName, minio.PutObjectRetentionOptions{
+		Mode:            &m.retentionMode,
+		RetainUntilDate: &until,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set retention on %s: %v", objectName, err)
+	}
 	return nil
 }
 
+// Retention returns the date an object is retained until, or the zero time
+func (m *MinioService) Retention(objectName string) (time.Time, error) {
+	ctx, cancel := m.withTimeout(context.Background())
+	defer cancel()
+
+	_, until, err := m.client.GetObjectRetention(ctx, m.bucket, objectName, "")
+	if minio.ToErrorResponse(err).Code == "NoSuchObjectLockConfiguration" {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get retention of %s: %v", objectName, err)
+	}
+	if until == nil {
+		return time.Time{}, nil
+	}
+	return *until, nil
+}
+
+// ProvisionBucket creates a bucket on this endpoint if it does not exist and applies
+// the template's versioning, encryption and lifecycle settings. Settings are applied
+// to existing buckets too, so changes to the template reach them.
+func (m *MinioService) ProvisionBucket(bucket string, template BucketTemplate) (bool, error) {
+	ctx, cancel := m.withTimeout(context.Background())
+	defer cancel()
+
+	exists, err := m.client.BucketExists(ctx, bucket)
+	if err != nil {
+		return false, fmt.Errorf("error checking if bucket exists: %v", err)
+	}
+	if !exists {
+		if err := m.client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: m.region, ObjectLocking: template.ObjectLock}); err != nil {
+			return false, fmt.Errorf("error creating bucket: %v", err)
+		}
+	}
+	// Object locking turns versioning on by itself, and it cannot be suspended
+	if template.Versioning && !template.ObjectLock {
+		if err := m.client.EnableVersioning(ctx, bucket); err != nil {
+			return !exists, fmt.Errorf("error enabling versioning: %v", err)
+		}
+	}
+
+	switch template.Encryption {
+	case BucketEncryptionSSES3:
+		err = m.client.SetBucketEncryption(ctx, bucket, sse.NewConfigurationSSES3())
+	case BucketEncryptionSSEKMS:
+		err = m.client.SetBucketEncryption(ctx, bucket, sse.NewConfigurationSSEKMS(template.KMSKeyID))
+	}
+	if err != nil {
+		return !exists, fmt.Errorf("error setting default encryption: %v", err)
+	}
+
+	if template.ExpireDays > 0 || template.NoncurrentExpireDays > 0 || template.AbortIncompleteUploadDays > 0 {
+		config := lifecycle.NewConfiguration()
+		config.Rules = append(config.Rules, lifecycle.Rule{
+			ID:         "depot-template",
+			Status:     "Enabled",
+			Expiration: lifecycle.Expiration{Days: lifecycle.ExpirationDays(template.ExpireDays)},
+			NoncurrentVersionExpiration: lifecycle.NoncurrentVersionExpiration{
+				NoncurrentDays: lifecycle.ExpirationDays(template.NoncurrentExpireDays),
+			},
+			AbortIncompleteMultipartUpload: lifecycle.AbortIncompleteMultipartUpload{
+				DaysAfterInitiation: lifecycle.ExpirationDays(template.AbortIncompleteUploadDays),
+			},
+		})
+		if err := m.client.SetBucketLifecycle(ctx, bucket, config); err != nil {
+			return !exists, fmt.Errorf("error setting lifecycle rules: %v", err)
+		}
+	}
+	return !exists, nil
+}
+
 // GetPayload retrieves a payload from MinIO
 func (m *MinioService) GetPayload(objectName string) ([]byte, error) {
+	return m.GetPayloadContext(context.Background(), objectName)
+}
+
+// GetPayloadContext reads as GetPayload does, giving up when ctx ends
+func (m *MinioService) GetPayloadContext(ctx context.Context, objectName string) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := m.retry.do(ctx, "read of "+objectName, func() error {
+		ctx, cancel := m.withTimeout(ctx)
+		defer cancel()
+		object, err := m.client.GetObject(ctx, m.bucket, objectName, minio.GetObjectOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get object %s: %w", objectName, err)
+		}
+		defer object.Close()
+
+		buffer.Reset()
+		if _, err := buffer.ReadFrom(object); err != nil {
+			return fmt.Errorf("failed to read object %s: %w", objectName, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// GetPayloadStream opens an object for reading, fetching it from MinIO as it is read
+func (m *MinioService) GetPayloadStream(objectName string) (io.ReadCloser, int64, error) {
 	ctx := context.Background()
 
 	object, err := m.client.GetObject(ctx, m.bucket, objectName, minio.GetObjectOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get object %s: %v", objectName, err)
+		return nil, 0, fmt.Errorf("failed to get object %s: %v", objectName, err)
+	}
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, 0, fmt.Errorf("failed to stat object %s: %v", objectName, err)
 	}
-	defer object.Close()
+	return object, info.Size, nil
+}
 
-	var buffer bytes.Buffer
-	_, err = buffer.ReadFrom(object)
+// GetPayloadMetadata returns an object's content type and user metadata
+func (m *MinioService) GetPayloadMetadata(objectName string) (string, map[string]string, error) {
+	ctx, cancel := m.withTimeout(context.Background())
+	defer cancel()
+
+	info, err := m.client.StatObject(ctx, m.bucket, objectName, minio.StatObjectOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to read object %s: %v", objectName, err)
+		return "", nil, fmt.Errorf("failed to stat object %s: %v", objectName, err)
 	}
 
-	return buffer.Bytes(), nil
+	return info.ContentType, info.UserMetadata, nil
+}
+
+// StatPayload describes an object from a single HEAD request
+func (m *MinioService) StatPayload(objectName string) (*ObjectStat, error) {
+	ctx, cancel := m.withTimeout(context.Background())
+	defer cancel()
+
+	info, err := m.client.StatObject(ctx, m.bucket, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat object %s: %v", objectName, err)
+	}
+
+	return &ObjectStat{
+		ObjectInfo: ObjectInfo{
+			ObjectName:   objectName,
+			Size:         info.Size,
+			ContentType:  info.ContentType,
+			LastModified: info.LastModified.UTC(),
+		},
+		Metadata: info.UserMetadata,
+	}, nil
+}
+
+// SavePayloadStream uploads a body without holding it in memory; minio-go buffers it
+// one part at a time and completes a multipart upload, aborting it if reading the
+// body fails. Bodies of known size below the part size go up in a single request.
+func (m *MinioService) SavePayloadStream(objectName string, body io.Reader, size int64, contentType string, metadata map[string]string, progress UploadProgressFunc) (int64, error) {
+	ctx := context.Background()
+
+	// Without multipart, the body must be buffered to learn its length
+	if m.disableMultipart && size < 0 {
+		return 0, ErrStreamUnsupported
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	options := m.putOptions(contentType, metadata)
+	// Fill several part buffers at once; this holds numThreads parts in memory
+	options.ConcurrentStreamParts = m.numThreads > 1
+
+	partSize := int64(m.partSize)
+	if partSize == 0 {
+		partSize = defaultPartSize
+	}
+	var hook *progressHook
+	if progress != nil {
+		hook = &progressHook{partSize: partSize, report: progress}
+		options.Progress = hook
+	}
+
+	info, err := m.client.PutObject(ctx, m.bucket, objectName, body, size, options)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stream object %s: %w", objectName, err)
+	}
+	if progress != nil {
+		// The last part is usually short of a full part size
+		progress(info.Size, int((info.Size+partSize-1)/partSize))
+	}
+	return info.Size, nil
+}
+
+// progressHook adapts minio-go's progress reader, which is handed every uploaded
+// chunk, into cumulative byte and whole-part counts
+type progressHook struct {
+	mu       sync.Mutex
+	stored   int64
+	partSize int64
+	report   UploadProgressFunc
+}
+
+func (h *progressHook) Read(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stored += int64(len(p))
+	h.report(h.stored, int(h.stored/h.partSize))
+	return len(p), nil
+}
+
+// ComposePayload appends data to an object server-side by uploading it as a temporary
+// part and composing the two. Missing objects are created; objects below the 5 MiB
+// compose minimum return ErrComposeUnsupported so the caller can rewrite them instead.
+func (m *MinioService) ComposePayload(objectName string, data []byte, contentType string, metadata map[string]string) (int64, error) {
+	ctx, cancel := m.withTimeout(context.Background())
+	defer cancel()
+
+	info, err := m.client.StatObject(ctx, m.bucket, objectName, minio.StatObjectOptions{})
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		if err := m.SavePayload(objectName, data, contentType, metadata); err != nil {
+			return 0, err
+		}
+		return int64(len(data)), nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat object %s: %v", objectName, err)
+	}
+	if info.Size < minPartSize {
+		return 0, ErrComposeUnsupported
+	}
+
+	partName := fmt.Sprintf("%s.append-%d", objectName, time.Now().UnixNano())
+	_, err = m.client.PutObject(ctx, m.bucket, partName, bytes.NewReader(data), int64(len(data)), m.putOptions("", nil))
+	if err != nil {
+		return 0, fmt.Errorf("failed to upload append part for %s: %v", objectName, err)
+	}
+	defer func() {
+		if err := m.client.RemoveObject(ctx, m.bucket, partName, minio.RemoveObjectOptions{}); err != nil {
+			log.Printf("Error removing append part %s: %v", partName, err)
+		}
+	}()
+
+	_, err = m.client.ComposeObject(ctx, minio.CopyDestOptions{
+		Bucket:          m.bucket,
+		Object:          objectName,
+		UserMetadata:    metadata,
+		ReplaceMetadata: true,
+		UserTags:        m.lifecycleTags(metadata),
+		ReplaceTags:     m.classify != nil,
+		ContentType:     contentType,
+		Encryption:      m.sse,
+	},
+		minio.CopySrcOptions{Bucket: m.bucket, Object: objectName, MatchETag: info.ETag},
+		minio.CopySrcOptions{Bucket: m.bucket, Object: partName},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to compose object %s: %v", objectName, err)
+	}
+
+	size := info.Size + int64(len(data))
+	log.Printf("Appended %d bytes to %s in MinIO (size: %d bytes)", len(data), objectName, size)
+	return size, nil
 }
 
 // ListPayloads lists all payloads in the bucket
 func (m *MinioService) ListPayloads() ([]string, error) {
-	ctx := context.Background()
+	return m.ListPayloadsContext(context.Background())
+}
 
+// ListPayloadsContext lists as ListPayloads does, giving up when ctx ends
+func (m *MinioService) ListPayloadsContext(ctx context.Context) ([]string, error) {
 	var objects []string
+	err := m.retry.do(ctx, "listing", func() error {
+		objects = nil
+		ctx, cancel := m.withTimeout(ctx)
+		defer cancel()
+
+		for object := range m.client.ListObjects(ctx, m.bucket, minio.ListObjectsOptions{Recursive: true}) {
+			if object.Err != nil {
+				return fmt.Errorf("error listing objects: %w", object.Err)
+			}
+			objects = append(objects, object.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
 
-	objectCh := m.client.ListObjects(ctx, m.bucket, minio.ListObjectsOptions{})
+// ListPayloadInfo lists all payloads in the bucket with their size and modification
+// time. MinIO also lists content types; other S3 services leave them empty.
+func (m *MinioService) ListPayloadInfo() ([]ObjectInfo, error) {
+	ctx, cancel := m.withTimeout(context.Background())
+	defer cancel()
 
-	for object := range objectCh {
+	var infos []ObjectInfo
+	for object := range m.client.ListObjects(ctx, m.bucket, minio.ListObjectsOptions{WithMetadata: true, Recursive: true}) {
 		if object.Err != nil {
 			return nil, fmt.Errorf("error listing objects: %v", object.Err)
 		}
-		objects = append(objects, object.Key)
+		contentType := object.ContentType
+		if contentType == "" {
+			contentType = object.UserMetadata["content-type"]
+		}
+		infos = append(infos, ObjectInfo{
+			ObjectName:   object.Key,
+			Size:         object.Size,
+			ContentType:  contentType,
+			LastModified: object.LastModified.UTC(),
+		})
 	}
+	return infos, nil
+}
 
-	return objects, nil
+// WatchCreated calls created for every object created in the bucket, using MinIO's
+// bucket notification API
+func (m *MinioService) WatchCreated(ctx context.Context, created func(objectName string)) error {
+	for info := range m.client.ListenBucketNotification(ctx, m.bucket, "", "", []string{"s3:ObjectCreated:*"}) {
+		if info.Err != nil {
+			return fmt.Errorf("bucket notifications failed: %v", info.Err)
+		}
+		for _, record := range info.Records {
+			// Keys arrive URL-encoded
+			key, err := url.QueryUnescape(record.S3.Object.Key)
+			if err != nil {
+				key = record.S3.Object.Key
+			}
+			created(key)
+		}
+	}
+	return ctx.Err()
 }
 
 // DeletePayload removes a payload from MinIO
 func (m *MinioService) DeletePayload(objectName string) error {
-	ctx := context.Background()
+	return m.DeletePayloadContext(context.Background(), objectName)
+}
+
+// DeletePayloadContext deletes as DeletePayload does, giving up when ctx ends
+func (m *MinioService) DeletePayloadContext(ctx context.Context, objectName string) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
 
 	err := m.client.RemoveObject(ctx, m.bucket, objectName, minio.RemoveObjectOptions{})
 	if err != nil {
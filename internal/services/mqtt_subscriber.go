@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/config"
+)
+
+// MQTTSubscriber stores every message received on the subscribed MQTT topics as a
+// payload tagged with its topic. Messages are acknowledged once their payload is
+// saved, and the broker session persists across reconnects, so QoS 1 and 2 messages
+// are stored at least once.
+type MQTTSubscriber struct {
+	store    PayloadService
+	detector ContentTypeDetector
+	saves    *saveWaiter
+	client   mqtt.Client
+}
+
+// NewMQTTSubscriber creates a subscriber that stores messages through store
+func NewMQTTSubscriber(store PayloadService, detector ContentTypeDetector) *MQTTSubscriber {
+	return &MQTTSubscriber{
+		store:    store,
+		detector: detector,
+		saves:    newSaveWaiter(),
+	}
+}
+
+// Start connects to the configured brokers in the background and subscribes to the
+// configured topics, resubscribing after every reconnect
+func (s *MQTTSubscriber) Start(config *config.Config) error {
+	if len(config.MQTTBrokers) == 0 {
+		return fmt.Errorf("no MQTT brokers configured")
+	}
+	if config.MQTTQoS < 0 || config.MQTTQoS > 2 {
+		return fmt.Errorf("MQTT QoS must be 0, 1 or 2, got %d", config.MQTTQoS)
+	}
+	filters := make(map[string]byte, len(config.MQTTTopics))
+	for _, topic := range config.MQTTTopics {
+		filters[topic] = byte(config.MQTTQoS)
+	}
+
+	opts := mqtt.NewClientOptions()
+	for _, broker := range config.MQTTBrokers {
+		opts.AddBroker(broker)
+	}
+	opts.SetClientID(config.MQTTClientID)
+	opts.SetUsername(config.MQTTUsername)
+	opts.SetPassword(config.MQTTPassword)
+	// The broker keeps unacknowledged messages for the client ID while disconnected
+	opts.SetCleanSession(false)
+	opts.SetConnectRetry(true)
+	opts.SetAutoReconnect(true)
+	// Messages are handled concurrently and acknowledged once saved
+	opts.SetOrderMatters(false)
+	opts.SetAutoAckDisabled(true)
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		token := client.SubscribeMultiple(filters, s.handle)
+		if token.Wait(); token.Error() != nil {
+			log.Printf("MQTT: error subscribing: %v", token.Error())
+			return
+		}
+		log.Printf("MQTT: subscribed to %d topic filter(s)", len(filters))
+	})
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		log.Printf("MQTT: connection lost: %v; reconnecting", err)
+	})
+
+	s.client = mqtt.NewClient(opts)
+	s.client.Connect()
+	return nil
+}
+
+// Close disconnects from the broker
+func (s *MQTTSubscriber) Close() {
+	if s.client != nil {
+		s.client.Disconnect(250)
+	}
+}
+
+func (s *MQTTSubscriber) handle(client mqtt.Client, message mqtt.Message) {
+	// Rejected messages are acknowledged too, as redelivering them would not help
+	s.Receive(message.Topic(), message.Payload())
+	message.Ack()
+}
+
+// Receive stores one message and waits for it to be saved, retrying slow saves.
+// Messages the pipeline rejects are logged and skipped.
+func (s *MQTTSubscriber) Receive(topic string, payload []byte) (*StoreResult, error) {
+	result, err := s.saves.storeAndWait(context.Background(), s.store, payload, s.detector.DetectFromData(payload), "", StoreOptions{
+		Tags:   []string{topic},
+		Source: "mqtt",
+	})
+	if err != nil {
+		log.Printf("MQTT: skipping message on %s, which was rejected: %v", topic, err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// PayloadStored lets the subscriber acknowledge a message once its payload is saved
+func (s *MQTTSubscriber) PayloadStored(record ObjectRecord) {
+	s.saves.PayloadStored(record)
+}
+
+// PayloadDeleted is a no-op; deletions do not affect subscriptions
+func (s *MQTTSubscriber) PayloadDeleted(record ObjectRecord) {}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrRetained is returned when an object still under retention would be removed
+var ErrRetained = errors.New("object is under retention")
+
+// ErrRetentionShortened is returned when a retention change would end before the current one
+var ErrRetentionShortened = errors.New("retention can only be extended")
+
+// RetentionStatus reports the date one object is retained until
+type RetentionStatus struct {
+	ObjectName string `json:"object_name"`
+	// RetainUntil is nil for objects without retention
+	RetainUntil *time.Time `json:"retain_until"`
+}
+
+// ObjectRetention extends the retention of every object of a request, and vetoes the
+// removal of retained objects
+type ObjectRetention struct {
+	storage StorageService
+	keeper  RetentionKeeper
+}
+
+// NewObjectRetention creates a retention manager; storage lists a request's objects and
+// keeper is the backend that enforces retention
+func NewObjectRetention(storage StorageService, keeper RetentionKeeper) *ObjectRetention {
+	return &ObjectRetention{
+		storage: storage,
+		keeper:  keeper,
+	}
+}
+
+// Extend retains every object of a request until the given date. Nothing is changed
+// when any object is already retained beyond it, so retention is never shortened.
+func (o *ObjectRetention) Extend(requestID string, until time.Time) ([]RetentionStatus, error) {
+	statuses, err := o.Status(requestID)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range statuses {
+		if status.RetainUntil != nil && status.RetainUntil.After(until) {
+			return statuses, fmt.Errorf("%w: %s is retained until %s", ErrRetentionShortened, status.ObjectName, status.RetainUntil.Format(time.RFC3339))
+		}
+	}
+
+	until = until.UTC()
+	for i := range statuses {
+		if err := o.keeper.SetRetention(statuses[i].ObjectName, until); err != nil {
+			return nil, err
+		}
+		statuses[i].RetainUntil = &until
+	}
+	return statuses, nil
+}
+
+// Status reports the retention of every object of a request
+func (o *ObjectRetention) Status(requestID string) ([]RetentionStatus, error) {
+	objects, err := listRequestObjects(o.storage, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing payloads: %v", err)
+	}
+	statuses := make([]RetentionStatus, 0, len(objects))
+	for _, objectName := range objects {
+		until, err := o.keeper.Retention(objectName)
+		if err != nil {
+			return nil, err
+		}
+		status := RetentionStatus{ObjectName: objectName}
+		if !until.IsZero() {
+			until = until.UTC()
+			status.RetainUntil = &until
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// CheckDelete refuses to remove objects retained past now
+func (o *ObjectRetention) CheckDelete(objectName string) error {
+	until, err := o.keeper.Retention(objectName)
+	if err != nil {
+		return fmt.Errorf("error checking retention of %s: %v", objectName, err)
+	}
+	if until.After(time.Now()) {
+		return fmt.Errorf("%w: %s until %s", ErrRetained, objectName, until.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotAppendable is returned for appends whose body does not map to a single object
+var ErrNotAppendable = errors.New("only single-object payloads can be appended to")
+
+// appendLockStripes bounds the locks that serialize appends to the same object
+const appendLockStripes = 64
+
+// AppendResult describes an object after a chunk was appended to it
+type AppendResult struct {
+	RequestID  string `json:"request_id"`
+	ObjectName string `json:"object_name"`
+	Appended   int    `json:"appended"`
+	Size       int64  `json:"size"`
+	// SHA256 is empty when the object was composed server-side and never read back
+	SHA256   string `json:"sha256,omitempty"`
+	Composed bool   `json:"composed"`
+}
+
+// appendLocks serializes appends to the same object across concurrent requests
+type appendLocks [appendLockStripes]sync.Mutex
+
+func (l *appendLocks) lock(objectName string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(objectName))
+	mu := &l[h.Sum32()%appendLockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// AppendPayload appends a chunk to the object a request's single payload maps to,
+// creating it on the first call. Storage that can compose objects server-side appends
+// without downloading; otherwise the object is read, extended and rewritten.
+func (s *DefaultPayloadService) AppendPayload(requestID string, data []byte, contentType string, filename string, opts StoreOptions) (*AppendResult, error) {
+	if !isAppendableRequestID(requestID) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRequestID, requestID)
+	}
+	if err := s.checkWrite(); err != nil {
+		return nil, err
+	}
+
+	payloads, err := s.processor.Process(requestID, data, contentType, filename)
+	if err != nil {
+		return nil, fmt.Errorf("error processing payload: %v", err)
+	}
+	if len(payloads) != 1 {
+		return nil, ErrNotAppendable
+	}
+	chunk := payloads[0]
+	var findings, redactions map[string]int
+	if s.detector != nil {
+		chunk, findings = s.detector.Detect(chunk)
+	}
+	if s.redactor != nil {
+		chunk, redactions = s.redactor.Redact(chunk)
+		data = chunk.Data
+	}
+
+	unlock := s.appendLocks.lock(chunk.ObjectName)
+	defer unlock()
+
+	existing, err := s.listRequestObjects(opts.Context, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing payloads: %v", err)
+	}
+	exists := slices.Contains(existing, chunk.ObjectName)
+
+	metadata := map[string]string{}
+	if reader, ok := s.storage.(MetadataReader); ok && exists {
+		if _, stored, err := reader.GetPayloadMetadata(chunk.ObjectName); err == nil {
+			for key, value := range stored {
+				metadata[key] = value
+			}
+		}
+	}
+	metadata[MetadataRequestID] = requestID
+	if chunk.Filename != "" {
+		metadata[MetadataFilename] = url.PathEscape(chunk.Filename)
+	}
+	if len(opts.Tags) > 0 {
+		metadata[MetadataTags] = strings.Join(opts.Tags, ",")
+	}
+	if len(findings) > 0 {
+		metadata[MetadataSensitiveData] = mergeCounts(metadata[MetadataSensitiveData], findings)
+		log.Printf("Flagged a chunk of %s as likely holding sensitive data (%s), reqID: %s", chunk.ObjectName, formatCounts(findings), requestID)
+	}
+	if len(redactions) > 0 {
+		metadata[MetadataRedactions] = mergeCounts(metadata[MetadataRedactions], redactions)
+		log.Printf("Redacted a chunk of %s (%s), reqID: %s", chunk.ObjectName, formatCounts(redactions), requestID)
+	}
+
+	result := &AppendResult{RequestID: requestID, ObjectName: chunk.ObjectName, Appended: len(data)}
+
+	composed := false
+	if composer, ok := s.storage.(ObjectComposer); ok {
+		withoutChecksum := make(map[string]string, len(metadata))
+		for key, value := range metadata {
+			if key != MetadataSHA256 {
+				withoutChecksum[key] = value
+			}
+		}
+		size, err := composer.ComposePayload(chunk.ObjectName, data, chunk.ContentType, withoutChecksum)
+		if err == nil {
+			composed = true
+			result.Size = size
+			result.Composed = exists
+			if !exists {
+				// A new object is just this chunk, so its checksum is known
+				sum := sha256.Sum256(data)
+				result.SHA256 = hex.EncodeToString(sum[:])
+			}
+		} else if !errors.Is(err, ErrComposeUnsupported) {
+			return nil, err
+		}
+	}
+
+	if !composed {
+		full := data
+		if exists {
+			current, err := s.storage.GetPayload(chunk.ObjectName)
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s: %v", chunk.ObjectName, err)
+			}
+			full = append(current, data...)
+		}
+		sum := sha256.Sum256(full)
+		result.SHA256 = hex.EncodeToString(sum[:])
+		result.Size = int64(len(full))
+		metadata[MetadataSHA256] = result.SHA256
+		if err := s.storage.SavePayload(chunk.ObjectName, full, chunk.ContentType, metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	var tags []string
+	if metadata[MetadataTags] != "" {
+		tags = strings.Split(metadata[MetadataTags], ",")
+	}
+	record := ObjectRecord{
+		RequestID:        requestID,
+		ObjectName:       chunk.ObjectName,
+		OriginalFilename: chunk.Filename,
+		ContentType:      chunk.ContentType,
+		Size:             int(result.Size),
+		SHA256:           result.SHA256,
+		Tags:             tags,
+		StoredAt:         time.Now().UTC(),
+	}
+	s.notifyStored(record)
+	if len(findings) > 0 {
+		s.notifyTargets(record, s.detectNotify)
+	}
+	return result, nil
+}
+
+// isAppendableRequestID accepts client-chosen IDs and generated "<unix>_<hex>" IDs,
+// with or without a tenant prefix
+func isAppendableRequestID(requestID string) bool {
+	if isValidRequestID(requestID) {
+		return requestID != "" && !isGeneratedIDStem(requestID)
+	}
+	timestamp, random, ok := strings.Cut(requestID, "_")
+	return ok && timestamp != "" && random != "" && isValidRequestID(timestamp) && isValidRequestID(random)
+}
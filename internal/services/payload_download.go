@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"slices"
+)
+
+// StreamRawPayloads prepares a raw download that streams a request's payloads from
+// storage as it is written: a single payload as is, several as a stored zip. Zip
+// entries need their CRC-32 in their headers, so each payload is read once to
+// checksum it before the archive is written; memory stays bounded either way.
+// Storage that cannot stream reads returns ErrReadStreamUnsupported, so the caller
+// can fall back to RetrievePayloads.
+func (s *DefaultPayloadService) StreamRawPayloads(requestID string) (*RawDownload, error) {
+	reader, ok := s.storage.(StreamReader)
+	if !ok {
+		return nil, ErrReadStreamUnsupported
+	}
+	zipper, ok := s.zipService.(StreamingZipService)
+	if !ok {
+		return nil, ErrReadStreamUnsupported
+	}
+	objects, err := s.listRequestObjects(context.Background(), requestID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing payloads: %v", err)
+	}
+	if len(objects) == 0 {
+		return nil, s.notFound(requestID)
+	}
+
+	if len(objects) == 1 {
+		objectName := objects[0]
+		body, size, err := reader.GetPayloadStream(objectName)
+		if err != nil {
+			return nil, err
+		}
+		filename := requestObjectFilename(objectName, requestID)
+		if reader, ok := s.storage.(MetadataReader); ok {
+			if _, metadata, err := reader.GetPayloadMetadata(objectName); err == nil {
+				filename = storedFilename(objectName, metadata)
+			}
+		}
+		if filename == "" {
+			filename = objectName
+		}
+		return &RawDownload{
+			Filename:    filename,
+			ContentType: determineContentType(objectName),
+			Size:        size,
+			Write: func(w io.Writer) error {
+				defer body.Close()
+				_, err := io.Copy(w, body)
+				return err
+			},
+		}, nil
+	}
+
+	entries := make([]ZipEntry, 0, len(objects))
+	bodies := make([]*lazyObjectReader, 0, len(objects))
+	for _, objectName := range objects {
+		size, crc, err := checksumObject(reader, objectName)
+		if err != nil {
+			return nil, err
+		}
+		name := requestObjectFilename(objectName, requestID)
+		if name == "" {
+			name = objectName
+		}
+		body := &lazyObjectReader{storage: reader, objectName: objectName}
+		bodies = append(bodies, body)
+		entries = append(entries, ZipEntry{Name: name, Size: uint64(size), CRC32: crc, Data: body})
+	}
+	return &RawDownload{
+		Filename:    fmt.Sprintf("payloads_%s.zip", requestID),
+		ContentType: "application/zip",
+		Size:        -1,
+		Write: func(w io.Writer) error {
+			defer func() {
+				for _, body := range bodies {
+					body.Close()
+				}
+			}()
+			return zipper.WriteZip(w, entries)
+		},
+	}, nil
+}
+
+// DownloadObject prepares a raw download of one stored object, with the content type
+// it was stored with. It is streamed from storage when storage can stream reads.
+func (s *DefaultPayloadService) DownloadObject(objectName string) (*RawDownload, error) {
+	contentType := determineContentType(objectName)
+	contentEncoding := ""
+	filename := extractOriginalFilename(objectName)
+	if reader, ok := s.storage.(MetadataReader); ok {
+		stored, metadata, err := reader.GetPayloadMetadata(objectName)
+		if err != nil {
+			return nil, s.objectNotFound(objectName, err)
+		}
+		if stored != "" {
+			contentType = stored
+		}
+		contentEncoding = metadata[MetadataContentEncoding]
+		filename = storedFilename(objectName, metadata)
+	}
+	if filename == "" {
+		filename = objectName
+	}
+	download := &RawDownload{Filename: filename, ContentType: contentType, ContentEncoding: contentEncoding}
+
+	if reader, ok := s.storage.(StreamReader); ok {
+		body, size, err := reader.GetPayloadStream(objectName)
+		if err == nil {
+			download.Size = size
+			download.Write = func(w io.Writer) error {
+				defer body.Close()
+				_, err := io.Copy(w, body)
+				return err
+			}
+			return download, nil
+		}
+		if !errors.Is(err, ErrReadStreamUnsupported) {
+			return nil, s.objectNotFound(objectName, err)
+		}
+	}
+	data, err := s.storage.GetPayload(objectName)
+	if err != nil {
+		return nil, s.objectNotFound(objectName, err)
+	}
+	download.Size = int64(len(data))
+	download.Write = func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}
+	return download, nil
+}
+
+// StatObject describes one stored object, with its original filename and checksum,
+// without reading its data when storage can stat it
+func (s *DefaultPayloadService) StatObject(objectName string) (*ObjectStat, error) {
+	stat, err := s.statObject(objectName)
+	if err != nil {
+		return nil, s.objectNotFound(objectName, err)
+	}
+	return stat, nil
+}
+
+// StatPayloads describes each of a request's objects, in object name order
+func (s *DefaultPayloadService) StatPayloads(requestID string) ([]ObjectStat, error) {
+	objects, err := s.listRequestObjects(context.Background(), requestID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing payloads: %v", err)
+	}
+	if len(objects) == 0 {
+		return nil, s.notFound(requestID)
+	}
+	slices.Sort(objects)
+	stats := make([]ObjectStat, 0, len(objects))
+	for _, objectName := range objects {
+		stat, err := s.statObject(objectName)
+		if err != nil {
+			return nil, s.objectNotFound(objectName, err)
+		}
+		stats = append(stats, *stat)
+	}
+	return stats, nil
+}
+
+// statObject asks storage to describe an object, or else reads it to learn its size
+func (s *DefaultPayloadService) statObject(objectName string) (*ObjectStat, error) {
+	var stat *ObjectStat
+	if statter, ok := s.storage.(PayloadStatter); ok {
+		var err error
+		stat, err = statter.StatPayload(objectName)
+		if err != nil && !errors.Is(err, ErrStatUnsupported) {
+			return nil, err
+		}
+	}
+	if stat == nil {
+		data, err := s.storage.GetPayload(objectName)
+		if err != nil {
+			return nil, err
+		}
+		stat = &ObjectStat{ObjectInfo: s.describeListed(objectName, false)}
+		stat.Size = int64(len(data))
+		if reader, ok := s.storage.(MetadataReader); ok {
+			_, stat.Metadata, _ = reader.GetPayloadMetadata(objectName)
+		}
+	}
+
+	if stat.ContentType == "" {
+		stat.ContentType = determineContentType(objectName)
+	}
+	stat.OriginalFilename = storedFilename(objectName, stat.Metadata)
+	stat.SHA256 = stat.Metadata[MetadataSHA256]
+	if s.index != nil {
+		if record, ok := s.index.Get(objectName); ok {
+			if stat.OriginalFilename == "" {
+				stat.OriginalFilename = record.OriginalFilename
+			}
+			if stat.SHA256 == "" {
+				stat.SHA256 = record.SHA256
+			}
+		}
+	}
+	return stat, nil
+}
+
+// objectNotFound explains a failed read of an object, starting its restore when its
+// request was archived
+func (s *DefaultPayloadService) objectNotFound(objectName string, err error) error {
+	log.Printf("Error reading object %s: %v", objectName, err)
+	if notFound := s.notFound(requestIDFromObjectName(objectName)); errors.Is(notFound, ErrRestoreInProgress) {
+		return notFound
+	}
+	return fmt.Errorf("object not found")
+}
+
+// checksumObject streams an object once to learn its size and CRC-32
+func checksumObject(reader StreamReader, objectName string) (int64, uint32, error) {
+	body, _, err := reader.GetPayloadStream(objectName)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer body.Close()
+	hash := crc32.NewIEEE()
+	size, err := io.Copy(hash, body)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read object %s: %v", objectName, err)
+	}
+	return size, hash.Sum32(), nil
+}
+
+// lazyObjectReader opens an object on its first read and closes it at its end, so a
+// zip of many payloads holds only one open at a time
+type lazyObjectReader struct {
+	storage    StreamReader
+	objectName string
+	body       io.ReadCloser
+	done       bool
+}
+
+func (l *lazyObjectReader) Read(p []byte) (int, error) {
+	if l.done {
+		return 0, io.EOF
+	}
+	if l.body == nil {
+		body, _, err := l.storage.GetPayloadStream(l.objectName)
+		if err != nil {
+			return 0, err
+		}
+		l.body = body
+	}
+	n, err := l.body.Read(p)
+	if err != nil {
+		l.Close()
+	}
+	return n, err
+}
+
+// Close closes the object if it is still open
+func (l *lazyObjectReader) Close() error {
+	l.done = true
+	if l.body == nil {
+		return nil
+	}
+	body := l.body
+	l.body = nil
+	return body.Close()
+}
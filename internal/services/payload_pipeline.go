@@ -0,0 +1,189 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Payload pipeline stages, run in the configured order between processing an upload
+// and storing it
+const (
+	// StageSniff replaces a generic content type with one detected from the data
+	StageSniff = "sniff"
+	// StageExtract unpacks archives for uploads that ask for it
+	StageExtract = "extract"
+	// StageDecompress stores decompressed copies of gzip uploads that ask for it
+	StageDecompress = "decompress"
+	// StageValidate runs the scripts' validate hooks
+	StageValidate = "validate"
+	// StageTransform runs the scripts' transform hooks
+	StageTransform = "transform"
+	// StageDetect flags payloads that likely hold secrets or personal data
+	StageDetect = "detect"
+	// StageRedact removes personal data with the redaction rules
+	StageRedact = "redact"
+)
+
+// ErrUnknownStage is returned when a pipeline names a stage that does not exist
+var ErrUnknownStage = errors.New("unknown pipeline stage")
+
+// DefaultPipeline is the stage order used unless SetPipeline changes it. Sniffing is
+// opt-in because it needs the whole body, which stops uploads from streaming.
+// Detection and redaction run last, so nothing a script adds escapes them, and
+// detection sees payloads before they are redacted.
+var DefaultPipeline = []string{StageExtract, StageDecompress, StageValidate, StageTransform, StageDetect, StageRedact}
+
+var pipelineStages = map[string]bool{
+	StageSniff:      true,
+	StageExtract:    true,
+	StageDecompress: true,
+	StageValidate:   true,
+	StageTransform:  true,
+	StageDetect:     true,
+	StageRedact:     true,
+}
+
+// ParsePipeline checks an ordered list of stage names; "none" on its own disables
+// every optional stage. Storing always runs last and is not listed.
+func ParsePipeline(stages []string) ([]string, error) {
+	if len(stages) == 1 && stages[0] == "none" {
+		return []string{}, nil
+	}
+	seen := make(map[string]bool, len(stages))
+	parsed := make([]string, 0, len(stages))
+	for _, stage := range stages {
+		stage = strings.ToLower(strings.TrimSpace(stage))
+		if !pipelineStages[stage] {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownStage, stage)
+		}
+		if seen[stage] {
+			return nil, fmt.Errorf("pipeline stage %q is listed twice", stage)
+		}
+		seen[stage] = true
+		parsed = append(parsed, stage)
+	}
+	return parsed, nil
+}
+
+// runStage applies one pipeline stage to the payloads of an upload
+func (s *DefaultPayloadService) runStage(stage string, requestID string, payloads []ProcessedPayload, opts StoreOptions) ([]ProcessedPayload, error) {
+	var err error
+	switch stage {
+	case StageSniff:
+		if s.sniffer != nil {
+			for i := range payloads {
+				payloads[i] = s.sniff(payloads[i])
+			}
+		}
+	case StageExtract:
+		if opts.Extract && s.extractor != nil {
+			return s.extractArchives(requestID, payloads)
+		}
+	case StageDecompress:
+		if opts.Decompress && s.decompress != nil && len(payloads) == 1 && s.decompress.IsCompressed(payloads[0], opts.ContentEncoding) {
+			return s.decompress.Decompress(payloads[0])
+		}
+	case StageValidate:
+		if s.scripts != nil {
+			for _, payload := range payloads {
+				if err = s.scripts.Validate(requestID, payload, opts.Tags); err != nil {
+					return nil, err
+				}
+			}
+		}
+	case StageTransform:
+		if s.scripts != nil {
+			for i := range payloads {
+				if payloads[i], err = s.scripts.Transform(requestID, payloads[i], opts.Tags); err != nil {
+					return nil, err
+				}
+			}
+		}
+	case StageDetect:
+		if s.detector != nil {
+			for i := range payloads {
+				payloads[i] = s.detect(LoggerWith(opts.Context, slog.String("request_id", requestID)), payloads[i])
+			}
+		}
+	case StageRedact:
+		if s.redactor != nil {
+			for i := range payloads {
+				payloads[i] = s.redact(LoggerWith(opts.Context, slog.String("request_id", requestID)), payloads[i])
+			}
+		}
+	}
+	return payloads, nil
+}
+
+// sniff detects the content type of a payload sent without a specific one, renaming an
+// unnamed payload to match
+func (s *DefaultPayloadService) sniff(payload ProcessedPayload) ProcessedPayload {
+	if payload.ContentType != "" && payload.ContentType != "application/octet-stream" {
+		return payload
+	}
+	detected := s.sniffer.DetectFromData(payload.Data)
+	if detected == "application/octet-stream" {
+		return payload
+	}
+	payload.ContentType = detected
+	if base, ok := strings.CutSuffix(payload.ObjectName, "_payload.bin"); ok && payload.Filename == "" {
+		payload.ObjectName = base + "_payload" + payloadExtension(detected)
+	}
+	return payload
+}
+
+// detect flags a payload holding sensitive data, logging what was found
+func (s *DefaultPayloadService) detect(logger *slog.Logger, payload ProcessedPayload) ProcessedPayload {
+	flagged, found := s.detector.Detect(payload)
+	if len(found) > 0 {
+		logger.Warn("payload likely holds sensitive data",
+			slog.String("object", payload.ObjectName), slog.String("findings", formatCounts(found)))
+	}
+	return flagged
+}
+
+// redact applies the redaction rules to a payload, logging the rules that fired
+func (s *DefaultPayloadService) redact(logger *slog.Logger, payload ProcessedPayload) ProcessedPayload {
+	redacted, fired := s.redactor.Redact(payload)
+	if len(fired) > 0 {
+		logger.Info("payload redacted",
+			slog.String("object", payload.ObjectName), slog.String("rules", formatCounts(fired)))
+	}
+	return redacted
+}
+
+// needsBody reports whether the configured pipeline has to see an upload's whole body
+// before it is stored
+func (s *DefaultPayloadService) needsBody(opts StoreOptions) bool {
+	for _, stage := range s.pipeline {
+		switch stage {
+		case StageSniff:
+			if s.sniffer != nil {
+				return true
+			}
+		case StageExtract:
+			if opts.Extract && s.extractor != nil {
+				return true
+			}
+		case StageDecompress:
+			if opts.Decompress && s.decompress != nil {
+				return true
+			}
+		case StageValidate, StageTransform:
+			if s.scripts != nil {
+				return true
+			}
+		case StageDetect:
+			if s.detector != nil {
+				return true
+			}
+		case StageRedact:
+			if s.redactor != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// hexdumpWidth is the number of bytes shown per hexdump row
+const hexdumpWidth = 16
+
+// DefaultPreviewer builds truncated previews of payload bodies
+type DefaultPreviewer struct{}
+
+// NewDefaultPreviewer creates a new payload previewer
+func NewDefaultPreviewer() *DefaultPreviewer {
+	return &DefaultPreviewer{}
+}
+
+// Preview returns up to limit bytes of data, as text when valid UTF-8 and base64 otherwise
+func (p *DefaultPreviewer) Preview(data []byte, limit int) PayloadPreview {
+	preview := PayloadPreview{Size: len(data)}
+
+	head := data
+	if limit >= 0 && len(head) > limit {
+		head = head[:limit]
+		preview.Truncated = true
+	}
+
+	if text, ok := validUTF8Prefix(head, preview.Truncated); ok {
+		preview.Text = string(text)
+	} else {
+		preview.Base64 = base64.StdEncoding.EncodeToString(head)
+	}
+	return preview
+}
+
+// validUTF8Prefix reports whether data is text; when cut is set, a multi-byte
+// rune split by truncation is dropped from the end
+func validUTF8Prefix(data []byte, cut bool) ([]byte, bool) {
+	maxTrim := 0
+	if cut {
+		maxTrim = utf8.UTFMax - 1
+	}
+	for trim := 0; trim <= maxTrim && trim <= len(data); trim++ {
+		if utf8.Valid(data[:len(data)-trim]) {
+			return data[:len(data)-trim], true
+		}
+	}
+	return nil, false
+}
+
+// Hexdump renders length bytes starting at offset in the style of `hexdump -C`
+func (p *DefaultPreviewer) Hexdump(data []byte, offset, length int) HexdumpPreview {
+	offset = max(0, min(offset, len(data)))
+	end := len(data)
+	if length >= 0 && offset+length < end {
+		end = offset + length
+	}
+
+	view := HexdumpPreview{
+		Size:      len(data),
+		Offset:    offset,
+		Length:    end - offset,
+		Truncated: offset > 0 || end < len(data),
+		Rows:      []HexdumpRow{},
+	}
+
+	var text strings.Builder
+	for start := offset; start < end; start += hexdumpWidth {
+		chunk := data[start:min(start+hexdumpWidth, end)]
+		row := HexdumpRow{
+			Offset: start,
+			Hex:    hexColumns(chunk),
+			ASCII:  asciiColumn(chunk),
+		}
+		view.Rows = append(view.Rows, row)
+		fmt.Fprintf(&text, "%08x  %-49s |%s|\n", row.Offset, row.Hex, row.ASCII)
+	}
+	fmt.Fprintf(&text, "%08x\n", end)
+	view.Text = text.String()
+
+	return view
+}
+
+// hexColumns formats bytes as hex pairs, with an extra gap after the eighth byte
+func hexColumns(chunk []byte) string {
+	var b strings.Builder
+	for i, c := range chunk {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		if i == hexdumpWidth/2 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%02x", c)
+	}
+	return b.String()
+}
+
+// asciiColumn shows printable ASCII bytes and replaces everything else with '.'
+func asciiColumn(chunk []byte) string {
+	out := make([]byte, len(chunk))
+	for i, c := range chunk {
+		if c >= 0x20 && c <= 0x7e {
+			out[i] = c
+		} else {
+			out[i] = '.'
+		}
+	}
+	return string(out)
+}
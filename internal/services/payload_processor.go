@@ -58,19 +58,22 @@ func (p *DefaultPayloadProcessor) generateObjectName(requestID, originalFilename
 	}
 
 	// Generate filename based on content type
-	var ext string
+	ext := payloadExtension(contentType)
+	return fmt.Sprintf("%s_payload%s", requestID, ext)
+}
+
+// payloadExtension picks the extension of an unnamed payload from its content type
+func payloadExtension(contentType string) string {
 	switch {
 	case strings.Contains(contentType, "json"):
-		ext = ".json"
+		return ".json"
 	case strings.Contains(contentType, "text"):
-		ext = ".txt"
+		return ".txt"
 	case strings.Contains(contentType, "image"):
-		ext = ".img"
+		return ".img"
 	case strings.Contains(contentType, "multipart"):
-		ext = ".multipart"
+		return ".multipart"
 	default:
-		ext = ".bin"
+		return ".bin"
 	}
-
-	return fmt.Sprintf("%s_payload%s", requestID, ext)
 }
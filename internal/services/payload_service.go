@@ -1,13 +1,89 @@
 package services
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"net/url"
+	"path"
+	"slices"
 	"strings"
+	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// Object metadata keys written alongside every stored payload
+const (
+	MetadataRequestID = "Request-Id"
+	MetadataSHA256    = "Sha256"
+	MetadataTags      = "Tags"
+	MetadataExpiresAt = "Expires-At"
+	// MetadataRestoredAt records when the archive tierer last restored an object
+	MetadataRestoredAt = "Restored-At"
+	// MetadataFilename records the filename a payload was uploaded with, path-escaped
+	// to stay within the ASCII object metadata allows
+	MetadataFilename = "Original-Filename"
+	// MetadataContentEncoding records the coding of a body stored compressed as sent
+	MetadataContentEncoding = "Content-Encoding"
+
+	MetadataCompressedObject   = "Compressed-Object"
+	MetadataDecompressedObject = "Decompressed-Object"
+)
+
+// ErrPayloadExists is returned for conditional uploads whose request ID is already taken
+var ErrPayloadExists = errors.New("payload already exists")
+
+// ErrInvalidRequestID is returned for client-chosen request IDs outside [A-Za-z0-9.-],
+// or shaped like the start of a generated one
+var ErrInvalidRequestID = errors.New("invalid request ID")
+
+// ErrInvalidObjectPrefix is returned for object prefixes whose segments are empty, "."
+// or "..", or hold characters outside [A-Za-z0-9._-]
+var ErrInvalidObjectPrefix = errors.New("invalid object prefix")
+
+// maxRequestIDLength bounds client-chosen request IDs
+const maxRequestIDLength = 128
+
+// PayloadExistsError carries the objects already stored under a conditional upload's request ID
+type PayloadExistsError struct {
+	RequestID string
+	Objects   []StoredObject
+}
+
+func (e *PayloadExistsError) Error() string {
+	return fmt.Sprintf("%v: request %s has %d object(s)", ErrPayloadExists, e.RequestID, len(e.Objects))
+}
+
+func (e *PayloadExistsError) Unwrap() error {
+	return ErrPayloadExists
+}
+
+// ErrStoreFailed is returned by synchronous uploads when objects could not be saved
+var ErrStoreFailed = errors.New("payload could not be saved")
+
+// StoreFailedError carries the objects of a synchronous upload storage refused, and
+// the first storage error. Objects that were saved are kept.
+type StoreFailedError struct {
+	RequestID string
+	Failed    []string
+	Err       error
+}
+
+func (e *StoreFailedError) Error() string {
+	return fmt.Sprintf("%v: %d object(s) of request %s: %v", ErrStoreFailed, len(e.Failed), e.RequestID, e.Err)
+}
+
+func (e *StoreFailedError) Unwrap() []error {
+	return []error{ErrStoreFailed, e.Err}
+}
+
 // DefaultPayloadService orchestrates payload operations
 type DefaultPayloadService struct {
 	storage           StorageService
@@ -15,6 +91,43 @@ type DefaultPayloadService struct {
 	idGenerator       IDGenerator
 	responseFormatter ResponseFormatter
 	zipService        ZipService
+
+	observersMu sync.RWMutex
+	observers   []StoreObserver
+	restorer    ArchiveRestorer
+	callbacks   CallbackNotifier
+	extractor   ArchiveExtractor
+	decompress  PayloadDecompressor
+	scripts     PayloadScripter
+	redactor    PayloadRedactor
+	detector    SensitiveDataDetector
+	// detectNotify lists forward targets told about objects flagged as sensitive
+	detectNotify []string
+	sniffer      ContentTypeDetector
+	guard        DeletionGuard
+	routes       *RoutingRules
+	router       PayloadRouter
+	maintenance  *MaintenanceMode
+	statuses     *StoreStatusTracker
+	requests     RequestLog
+	headers      *HeaderSelector
+	index        MetadataIndex
+
+	// pipeline lists the stages every upload goes through, in order, before it is stored
+	pipeline []string
+
+	// reservedMu guards request IDs held by conditional uploads until their objects are saved
+	reservedMu sync.Mutex
+	reserved   map[string]bool
+
+	appendLocks appendLocks
+
+	// savesMu guards draining; once Drain starts, no asynchronous save is added to saves
+	savesMu  sync.Mutex
+	saves    sync.WaitGroup
+	draining bool
+	// savePool bounds asynchronous saves; nil saves each on its own goroutine
+	savePool *savePool
 }
 
 // NewDefaultPayloadService creates a new payload service with all dependencies
@@ -31,64 +144,425 @@ func NewDefaultPayloadService(
 		idGenerator:       idGenerator,
 		responseFormatter: responseFormatter,
 		zipService:        zipService,
+		pipeline:          DefaultPipeline,
+		headers:           NewHeaderSelector(DefaultStoredHeaders),
+		reserved:          make(map[string]bool),
 	}
 }
 
 // StorePayload processes and stores payload data
-func (s *DefaultPayloadService) StorePayload(data []byte, contentType string, filename string) (string, error) {
-	requestID := s.idGenerator.Generate()
+func (s *DefaultPayloadService) StorePayload(data []byte, contentType string, filename string, opts StoreOptions) (*StoreResult, error) {
+	ctx, span := startSpan(opts.Context, "payload.store",
+		attribute.Int("depot.size", len(data)), attribute.String("depot.content_type", contentType))
+	opts.Context = ctx
+	result, err := s.storePayload(data, contentType, filename, opts)
+	if result != nil {
+		span.SetAttributes(attribute.String("depot.request_id", result.RequestID), attribute.Bool("depot.async", !opts.Sync && err == nil))
+	}
+	endSpan(span, err)
+	return result, err
+}
+
+func (s *DefaultPayloadService) storePayload(data []byte, contentType string, filename string, opts StoreOptions) (*StoreResult, error) {
+	if err := s.checkWrite(); err != nil {
+		return nil, err
+	}
+	opts, prefix, err := s.applyRoutes(opts, contentType, int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	requestID := opts.RequestID
+	if requestID == "" {
+		requestID = s.newRequestID(prefix)
+	} else if !isValidRequestID(requestID) || s.isGeneratedIDStem(requestID) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRequestID, requestID)
+	}
+	if opts.ObjectPrefix != "" && !isValidObjectPrefix(opts.ObjectPrefix) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidObjectPrefix, opts.ObjectPrefix)
+	}
+	requestID = TenantRequestID(opts.Tenant, requestID)
 	reqTime := time.Now().Format(time.RFC3339)
+	AddLogAttrs(opts.Context, slog.String("request_id", requestID))
 
-	// Process the payload
+	if opts.IfNoneMatch {
+		if err := s.reserve(opts.Context, requestID); err != nil {
+			return nil, err
+		}
+	}
+	release := func() {
+		if opts.IfNoneMatch {
+			s.releaseReservation(requestID)
+		}
+	}
+
+	payloads, err := s.preparePayloads(requestID, data, contentType, filename, opts)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	// Asynchronous saves take their place in the save queue before anything is recorded
+	async := false
+	if !opts.Sync {
+		if async, err = s.beginAsyncSave(); err != nil {
+			release()
+			return nil, err
+		}
+	}
+
+	result := &StoreResult{RequestID: requestID, Objects: []StoredObject{}}
+	for i := range payloads {
+		sum := sha256.Sum256(payloads[i].Data)
+		payloads[i].SHA256 = hex.EncodeToString(sum[:])
+		result.Objects = append(result.Objects, StoredObject{
+			ObjectName:       payloads[i].ObjectName,
+			OriginalFilename: payloads[i].Filename,
+			ContentType:      payloads[i].ContentType,
+			Size:             len(payloads[i].Data),
+			SHA256:           payloads[i].SHA256,
+		})
+	}
+
+	if s.statuses != nil {
+		s.statuses.Pending(result)
+	}
+	s.logRequest(result, opts)
+	if !async {
+		defer release()
+		if err := s.savePayloads(result, payloads, opts, reqTime); err != nil {
+			return result, err
+		}
+		return result, nil
+	}
+
+	// Store payloads asynchronously, past the end of the request they came in on
+	if opts.Context != nil {
+		opts.Context = context.WithoutCancel(opts.Context)
+	}
+	s.runAsyncSave(func() {
+		defer release()
+		s.savePayloads(result, payloads, opts, reqTime)
+	})
+
+	return result, nil
+}
+
+// Drain waits for the asynchronous saves in flight to finish, for shutdown. Uploads
+// accepted from then on are saved before they are answered. It returns the context's
+// error when the context ends first.
+func (s *DefaultPayloadService) Drain(ctx context.Context) error {
+	s.savesMu.Lock()
+	s.draining = true
+	s.savesMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.saves.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// preparePayloads processes an upload and runs it through the pipeline stages in order
+func (s *DefaultPayloadService) preparePayloads(requestID string, data []byte, contentType string, filename string, opts StoreOptions) ([]ProcessedPayload, error) {
+	_, span := startSpan(opts.Context, "payload.process")
 	payloads, err := s.processor.Process(requestID, data, contentType, filename)
 	if err != nil {
-		return "", fmt.Errorf("error processing payload: %v", err)
+		err = fmt.Errorf("error processing payload: %v", err)
+	}
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stage := range s.pipeline {
+		_, span := startSpan(opts.Context, "pipeline."+stage)
+		payloads, err = s.runStage(stage, requestID, payloads, opts)
+		endSpan(span, err)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := range payloads {
+		payloads[i].ObjectName = opts.ObjectPrefix + payloads[i].ObjectName
+	}
+	return payloads, nil
+}
+
+// reserve claims a request ID for a conditional upload, failing when it already has
+// stored objects or another conditional upload holds it. The claim is taken before
+// storage is asked, so storage is never waited on with the lock held.
+func (s *DefaultPayloadService) reserve(ctx context.Context, requestID string) error {
+	s.reservedMu.Lock()
+	if s.reserved[requestID] {
+		s.reservedMu.Unlock()
+		return &PayloadExistsError{RequestID: requestID, Objects: []StoredObject{}}
+	}
+	s.reserved[requestID] = true
+	s.reservedMu.Unlock()
+
+	existing, err := s.listRequestObjects(ctx, requestID)
+	if err != nil {
+		s.releaseReservation(requestID)
+		return fmt.Errorf("error listing payloads: %v", err)
+	}
+	if len(existing) > 0 {
+		s.releaseReservation(requestID)
+		return &PayloadExistsError{RequestID: requestID, Objects: s.describeObjects(existing)}
+	}
+	return nil
+}
+
+func (s *DefaultPayloadService) releaseReservation(requestID string) {
+	s.reservedMu.Lock()
+	defer s.reservedMu.Unlock()
+	delete(s.reserved, requestID)
+}
+
+// describeObjects reports the stored metadata of existing objects, statting them
+// instead of reading them when storage can
+func (s *DefaultPayloadService) describeObjects(objectNames []string) []StoredObject {
+	objects := make([]StoredObject, 0, len(objectNames))
+	for _, objectName := range objectNames {
+		object := StoredObject{
+			ObjectName:       objectName,
+			OriginalFilename: extractOriginalFilename(objectName),
+			ContentType:      determineContentType(objectName),
+		}
+		if stat, err := s.statObject(objectName); err == nil {
+			object.OriginalFilename = stat.OriginalFilename
+			object.ContentType = stat.ContentType
+			object.Size = int(stat.Size)
+			object.SHA256 = stat.SHA256
+		}
+		objects = append(objects, object)
+	}
+	return objects
+}
+
+// isValidRequestID accepts client-chosen IDs made of letters, digits, dots and dashes.
+// Underscores are excluded because they separate the request ID from the rest of an
+// object name.
+func isValidRequestID(requestID string) bool {
+	if len(requestID) > maxRequestIDLength {
+		return false
 	}
+	for _, r := range requestID {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-') {
+			return false
+		}
+	}
+	return requestID != "." && requestID != ".."
+}
 
-	// Store payloads asynchronously
-	go func(payloads []ProcessedPayload, reqTimeStamp, reqID string) {
-		for _, payload := range payloads {
-			err := s.storage.SavePayload(payload.ObjectName, payload.Data, payload.ContentType)
-			if err != nil {
-				log.Printf("Error saving payload to storage: %v", err)
-				continue
+// isValidObjectPrefix accepts slash-terminated paths of segments that are safe as
+// directory names
+func isValidObjectPrefix(prefix string) bool {
+	if len(prefix) > maxRequestIDLength*2 || !strings.HasSuffix(prefix, "/") {
+		return false
+	}
+	for _, segment := range strings.Split(strings.TrimSuffix(prefix, "/"), "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+		for _, r := range segment {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_') {
+				return false
 			}
-			log.Printf("Saved %s to storage, reqTime: %s, reqID: %s", payload.ObjectName, reqTimeStamp, reqID)
 		}
-		log.Printf("Saved %d file(s) to storage, reqTime: %s, reqID: %s", len(payloads), reqTimeStamp, reqID)
-	}(payloads, reqTime, requestID)
+	}
+	return true
+}
 
-	return requestID, nil
+// isGeneratedIDStem reports whether requestID, less any tenant prefix, is all digits.
+// Generated IDs are "<unix>_<hex>", so every upload generated in that second would
+// be listed as one of its objects; clients cannot choose such IDs, and they match
+// nothing.
+func isGeneratedIDStem(requestID string) bool {
+	if _, unscoped, ok := strings.Cut(requestID, TenantSeparator); ok {
+		requestID = unscoped
+	}
+	return isDigits(requestID)
 }
 
-// RetrievePayloads retrieves payloads for a given request ID
-func (s *DefaultPayloadService) RetrievePayloads(requestID string, raw bool) (interface{}, error) {
-	// List all objects and filter by request_id prefix
-	objects, err := s.storage.ListPayloads()
-	if err != nil {
-		return nil, fmt.Errorf("error listing payloads: %v", err)
+// isGeneratedIDStem also reserves "<prefix>-<digits>" for the prefixes of the routing
+// rules, which generated IDs of matching uploads start with
+func (s *DefaultPayloadService) isGeneratedIDStem(requestID string) bool {
+	if isGeneratedIDStem(requestID) {
+		return true
 	}
+	if s.routes == nil {
+		return false
+	}
+	if _, unscoped, ok := strings.Cut(requestID, TenantSeparator); ok {
+		requestID = unscoped
+	}
+	for _, prefix := range s.routes.Prefixes() {
+		if rest, ok := strings.CutPrefix(requestID, prefix+"-"); ok && isDigits(rest) {
+			return true
+		}
+	}
+	return false
+}
 
-	var matched []FileInfo
-	for _, obj := range objects {
-		if strings.HasPrefix(obj, requestID+"_") || strings.HasPrefix(obj, requestID+"_payload") {
-			payload, err := s.storage.GetPayload(obj)
-			if err != nil {
-				log.Printf("Error getting payload for %s: %v", obj, err)
-				continue
+// isDigits reports whether s is a non-empty run of ASCII digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// savePayloads writes processed payloads to storage, notifies observers and
+// reports the outcome to the upload's callback URL, if any. It returns a
+// StoreFailedError when any payload could not be saved.
+func (s *DefaultPayloadService) savePayloads(result *StoreResult, payloads []ProcessedPayload, opts StoreOptions, reqTime string) error {
+	reqID := result.RequestID
+	var failed []string
+	var firstErr error
+	ctx, span := startSpan(opts.Context, "payload.save", attribute.String("depot.request_id", reqID))
+	defer func() { endSpan(span, firstErr) }()
+	logger := LoggerWith(opts.Context, slog.String("request_id", reqID)).With(slog.String("received_at", reqTime))
+
+	for i, payload := range payloads {
+		metadata := make(map[string]string, len(opts.Metadata)+3)
+		for key, value := range opts.Metadata {
+			metadata[key] = value
+		}
+		metadata[MetadataRequestID] = reqID
+		metadata[MetadataSHA256] = payload.SHA256
+		if payload.Filename != "" {
+			metadata[MetadataFilename] = url.PathEscape(payload.Filename)
+		}
+		if len(opts.Tags) > 0 {
+			metadata[MetadataTags] = strings.Join(opts.Tags, ",")
+		}
+		if !opts.ExpiresAt.IsZero() {
+			metadata[MetadataExpiresAt] = opts.ExpiresAt.Format(time.RFC3339)
+		}
+		for key, value := range s.headers.Metadata(opts.Headers, opts.Query) {
+			metadata[key] = value
+		}
+		for key, value := range payload.Metadata {
+			metadata[key] = value
+		}
+		saveCtx, saveSpan := startSpan(ctx, "storage.save", attribute.String("depot.object", payload.ObjectName),
+			attribute.Int("depot.size", len(payload.Data)), attribute.String("depot.content_type", payload.ContentType))
+		err := savePayload(saveCtx, s.storage, payload.ObjectName, payload.Data, payload.ContentType, metadata)
+		endSpan(saveSpan, err)
+		if s.statuses != nil {
+			s.statuses.Saved(reqID, payload.ObjectName, err)
+		}
+		if s.requests != nil {
+			s.requests.ObjectSaved(reqID, result.Objects[i], err)
+		}
+		if err != nil {
+			logger.Error("saving payload failed", slog.String("object", payload.ObjectName), slog.Any("error", err))
+			failed = append(failed, payload.ObjectName)
+			if firstErr == nil {
+				firstErr = err
 			}
+			continue
+		}
+		logger.Info("payload saved", slog.String("object", payload.ObjectName), slog.Int("size", len(payload.Data)))
+		record := ObjectRecord{
+			RequestID:        reqID,
+			ObjectName:       payload.ObjectName,
+			OriginalFilename: payload.Filename,
+			ContentType:      payload.ContentType,
+			Size:             len(payload.Data),
+			SHA256:           payload.SHA256,
+			Tags:             opts.Tags,
+			StoredAt:         time.Now().UTC(),
+			ExpiresAt:        expiresAt(opts),
+		}
+		s.notifyStored(record)
+		s.notifyTargets(record, s.payloadTargets(payload, opts))
+	}
+	logger.Info("upload saved", slog.Int("saved", len(payloads)-len(failed)), slog.Int("failed", len(failed)))
 
-			// Determine content type and original filename
-			contentType := s.determineContentType(obj)
-			originalFilename := s.extractOriginalFilename(obj)
+	s.notifyCallback(result, failed, opts)
+	if len(failed) > 0 {
+		return &StoreFailedError{RequestID: reqID, Failed: failed, Err: firstErr}
+	}
+	return nil
+}
+
+// payloadTargets lists the forward targets told about a stored payload
+func (s *DefaultPayloadService) payloadTargets(payload ProcessedPayload, opts StoreOptions) []string {
+	if payload.Metadata[MetadataSensitiveData] == "" {
+		return opts.Notify
+	}
+	return appendMissing(slices.Clone(opts.Notify), s.detectNotify...)
+}
 
-			fileInfo := s.responseFormatter.FormatFileInfo(obj, originalFilename, payload, contentType)
-			matched = append(matched, fileInfo)
+// expiresAt is the expiry recorded for an upload's objects, if it has one
+func expiresAt(opts StoreOptions) *time.Time {
+	if opts.ExpiresAt.IsZero() {
+		return nil
+	}
+	at := opts.ExpiresAt
+	return &at
+}
+
+// notifyCallback reports the outcome of an upload to its callback URL, if any
+func (s *DefaultPayloadService) notifyCallback(result *StoreResult, failed []string, opts StoreOptions) {
+	if opts.CallbackURL == "" || s.callbacks == nil {
+		return
+	}
+	status := "stored"
+	if len(failed) == len(result.Objects) && len(result.Objects) > 0 {
+		status = "failed"
+	} else if len(failed) > 0 {
+		status = "partial"
+	}
+	s.callbacks.Notify(opts.CallbackURL, CompletionEvent{
+		Event:     "payload.stored",
+		RequestID: result.RequestID,
+		Status:    status,
+		Objects:   result.Objects,
+		Failed:    failed,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// extractArchives replaces every archive payload with its extracted entries
+func (s *DefaultPayloadService) extractArchives(requestID string, payloads []ProcessedPayload) ([]ProcessedPayload, error) {
+	var extracted []ProcessedPayload
+	for _, payload := range payloads {
+		if !s.extractor.IsArchive(payload) {
+			extracted = append(extracted, payload)
+			continue
 		}
+		entries, err := s.extractor.Extract(requestID, payload.Data)
+		if err != nil {
+			return nil, err
+		}
+		extracted = append(extracted, entries...)
 	}
+	return extracted, nil
+}
 
-	if len(matched) == 0 {
-		return nil, fmt.Errorf("no payloads found for request_id")
+// RetrievePayloads retrieves payloads for a given request ID
+func (s *DefaultPayloadService) RetrievePayloads(requestID string, raw bool) (interface{}, error) {
+	return s.RetrievePayloadsContext(context.Background(), requestID, raw)
+}
+
+// RetrievePayloadsContext retrieves payloads as RetrievePayloads does, reading them under ctx
+func (s *DefaultPayloadService) RetrievePayloadsContext(ctx context.Context, requestID string, raw bool) (interface{}, error) {
+	matched, err := s.collectFiles(ctx, requestID)
+	if err != nil {
+		return nil, err
 	}
 
 	if raw {
@@ -105,12 +579,423 @@ func (s *DefaultPayloadService) RetrievePayloads(requestID string, raw bool) (in
 	return s.responseFormatter.FormatGetResponse(requestID, matched, len(matched)), nil
 }
 
+// RetrieveEncryptedZip returns every payload of a request in a zip encrypted with password
+func (s *DefaultPayloadService) RetrieveEncryptedZip(ctx context.Context, requestID, password string) (map[string]interface{}, error) {
+	encrypter, ok := s.zipService.(EncryptedZipService)
+	if !ok {
+		return nil, ErrZipEncryptionUnsupported
+	}
+	matched, err := s.collectFiles(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	zipData, err := encrypter.CreateEncryptedZip(matched, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zip: %w", err)
+	}
+	return map[string]interface{}{
+		"filename":     fmt.Sprintf("payloads_%s.zip", requestID),
+		"content_type": "application/zip",
+		"data":         zipData,
+	}, nil
+}
+
+// collectFiles reads every payload stored under a request ID, starting a restore when
+// they have all been archived
+func (s *DefaultPayloadService) collectFiles(ctx context.Context, requestID string) ([]FileInfo, error) {
+	objects, err := s.listRequestObjects(ctx, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing payloads: %v", err)
+	}
+
+	var matched []FileInfo
+	for _, obj := range objects {
+		payload, err := getPayload(ctx, s.storage, obj)
+		if err != nil {
+			log.Printf("Error getting payload for %s: %v", obj, err)
+			continue
+		}
+		matched = append(matched, s.fileInfo(obj, payload))
+	}
+
+	if len(matched) == 0 {
+		return nil, s.notFound(requestID)
+	}
+	return matched, nil
+}
+
+// fileInfo describes a payload for a response
+func (s *DefaultPayloadService) fileInfo(objectName string, payload []byte) FileInfo {
+	filename := extractOriginalFilename(objectName)
+	var metadata map[string]string
+	if reader, ok := s.storage.(MetadataReader); ok {
+		if _, stored, err := reader.GetPayloadMetadata(objectName); err == nil {
+			metadata = stored
+			filename = storedFilename(objectName, metadata)
+		}
+	}
+	info := s.responseFormatter.FormatFileInfo(objectName, filename, payload, determineContentType(objectName))
+	if metadata != nil {
+		info.Headers, info.Query = StoredRequest(metadata)
+	}
+	return info
+}
+
+// notFound explains why a request has no payloads to return, starting a restore
+// when they have all been archived
+func (s *DefaultPayloadService) notFound(requestID string) error {
+	if s.restorer != nil {
+		archived, err := s.restorer.RestoreRequest(requestID)
+		if err != nil {
+			log.Printf("Error checking archive for %s: %v", requestID, err)
+		} else if archived > 0 {
+			return ErrRestoreInProgress
+		}
+	}
+	return fmt.Errorf("no payloads found for request_id")
+}
+
+// RetrievePayloadPage returns a page of a request's payloads, in object name order.
+// Payloads are inlined until the next would take the page past MaxInlineBytes; the
+// page then ends and next_offset points at that payload. A payload larger than
+// MaxInlineBytes on its own is never inlined, and is listed under omitted instead.
+// A response that leaves payloads out links to the raw download, which holds them all.
+func (s *DefaultPayloadService) RetrievePayloadPage(ctx context.Context, requestID string, page PayloadPage) (map[string]any, error) {
+	objects, err := s.listRequestObjects(ctx, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing payloads: %v", err)
+	}
+	if len(objects) == 0 {
+		return nil, s.notFound(requestID)
+	}
+	slices.Sort(objects)
+
+	files := []FileInfo{}
+	omitted := []StoredObject{}
+	var inlined int64
+	next := -1
+	for i := page.Offset; i < len(objects); i++ {
+		if page.Limit > 0 && len(files)+len(omitted) == page.Limit {
+			next = i
+			break
+		}
+		payload, err := getPayload(ctx, s.storage, objects[i])
+		if err != nil {
+			log.Printf("Error getting payload for %s: %v", objects[i], err)
+			continue
+		}
+		size := int64(base64.StdEncoding.EncodedLen(len(payload)))
+		if page.MaxInlineBytes > 0 && size > page.MaxInlineBytes {
+			sum := sha256.Sum256(payload)
+			omitted = append(omitted, StoredObject{
+				ObjectName:       objects[i],
+				OriginalFilename: requestObjectFilename(objects[i], requestID),
+				ContentType:      determineContentType(objects[i]),
+				Size:             len(payload),
+				SHA256:           hex.EncodeToString(sum[:]),
+			})
+			continue
+		}
+		if page.MaxInlineBytes > 0 && inlined+size > page.MaxInlineBytes {
+			next = i
+			break
+		}
+		inlined += size
+		files = append(files, s.fileInfo(objects[i], payload))
+	}
+
+	response := s.responseFormatter.FormatGetResponse(requestID, files, len(files))
+	response["total"] = len(objects)
+	response["offset"] = page.Offset
+	if next >= 0 {
+		response["next_offset"] = next
+	}
+	if len(omitted) > 0 {
+		response["omitted"] = omitted
+	}
+	if next >= 0 || len(omitted) > 0 {
+		response["download_url"] = "/get?request_id=" + url.QueryEscape(requestID) + "&raw=true"
+	}
+	return response, nil
+}
+
+// listRequestObjects returns the objects stored under a request ID, letting storage
+// group them itself when it can
+func (s *DefaultPayloadService) listRequestObjects(ctx context.Context, requestID string) ([]string, error) {
+	if s.isGeneratedIDStem(requestID) {
+		return nil, nil
+	}
+	return listRequestObjectsContext(ctx, s.storage, requestID)
+}
+
+// listRequestObjects returns the objects stored under a request ID in storage
+func listRequestObjects(storage StorageService, requestID string) ([]string, error) {
+	return listRequestObjectsContext(context.Background(), storage, requestID)
+}
+
+// listRequestObjectsContext lists the objects of a request as listRequestObjects
+// does, under ctx
+func listRequestObjectsContext(ctx context.Context, storage StorageService, requestID string) ([]string, error) {
+	if isGeneratedIDStem(requestID) {
+		return nil, nil
+	}
+	if lister, ok := storage.(ContextRequestLister); ok && ctx != nil {
+		return lister.ListRequestPayloadsContext(ctx, requestID)
+	}
+	if lister, ok := storage.(RequestLister); ok {
+		return lister.ListRequestPayloads(requestID)
+	}
+	objects, err := listPayloads(ctx, storage)
+	if err != nil {
+		return nil, err
+	}
+	var matched []string
+	for _, obj := range objects {
+		if IsRequestObject(obj, requestID) {
+			matched = append(matched, obj)
+		}
+	}
+	return matched, nil
+}
+
+// objectBase strips the object prefix, if any, from an object name, leaving the
+// request ID and filename
+func objectBase(objectName string) string {
+	return objectName[strings.LastIndex(objectName, "/")+1:]
+}
+
+// IsRequestObject reports whether objectName is an object of requestID, stored with
+// or without an object prefix
+func IsRequestObject(objectName, requestID string) bool {
+	return strings.HasPrefix(objectBase(objectName), requestID+"_")
+}
+
 // ListAllPayloads lists all stored payloads
 func (s *DefaultPayloadService) ListAllPayloads() ([]string, error) {
 	return s.storage.ListPayloads()
 }
 
-func (s *DefaultPayloadService) determineContentType(objectName string) string {
+// ListAllPayloadsContext lists all stored payloads under ctx
+func (s *DefaultPayloadService) ListAllPayloadsContext(ctx context.Context) ([]string, error) {
+	return listPayloads(ctx, s.storage)
+}
+
+// AddObserver registers an observer that is notified of storage changes
+func (s *DefaultPayloadService) AddObserver(observer StoreObserver) {
+	s.observersMu.Lock()
+	defer s.observersMu.Unlock()
+	s.observers = append(s.observers, observer)
+}
+
+// SetMetadataIndex lets listings filter on the content types and storage times the
+// index keeps, instead of reading them from storage
+func (s *DefaultPayloadService) SetMetadataIndex(index MetadataIndex) {
+	s.index = index
+}
+
+// SetArchiveRestorer enables transparent restore of archived payloads on retrieval
+func (s *DefaultPayloadService) SetArchiveRestorer(restorer ArchiveRestorer) {
+	s.restorer = restorer
+}
+
+// SetCallbackNotifier enables completion callbacks for uploads that request one
+func (s *DefaultPayloadService) SetCallbackNotifier(notifier CallbackNotifier) {
+	s.callbacks = notifier
+}
+
+// CheckCallbackURL reports whether the callback notifier may deliver to the URL
+func (s *DefaultPayloadService) CheckCallbackURL(raw string) error {
+	if checker, ok := s.callbacks.(CallbackURLChecker); ok {
+		return checker.CheckCallbackURL(raw)
+	}
+	return nil
+}
+
+// SetArchiveExtractor enables unpacking of uploaded archives for uploads that request it
+func (s *DefaultPayloadService) SetArchiveExtractor(extractor ArchiveExtractor) {
+	s.extractor = extractor
+}
+
+// SetDecompressor enables storing decompressed copies of gzip uploads that request it
+func (s *DefaultPayloadService) SetDecompressor(decompressor PayloadDecompressor) {
+	s.decompress = decompressor
+}
+
+// SetPayloadScripter runs scripts on every payload of an upload before it is stored;
+// uploads are then buffered rather than streamed
+func (s *DefaultPayloadService) SetPayloadScripter(scripts PayloadScripter) {
+	s.scripts = scripts
+}
+
+// SetRedactor has the redact stage remove personal data from every payload, appended
+// chunks included
+func (s *DefaultPayloadService) SetRedactor(redactor PayloadRedactor) {
+	s.redactor = redactor
+}
+
+// SetSensitiveDataDetector has the detect stage flag payloads holding secrets or
+// personal data, sending flagged objects to the notify forward targets once stored
+func (s *DefaultPayloadService) SetSensitiveDataDetector(detector SensitiveDataDetector, notify []string) {
+	s.detector = detector
+	s.detectNotify = notify
+}
+
+// SetContentSniffer lets the sniff stage detect the content type of uploads sent as
+// application/octet-stream
+func (s *DefaultPayloadService) SetContentSniffer(detector ContentTypeDetector) {
+	s.sniffer = detector
+}
+
+// SetPipeline replaces the ordered stages uploads go through before they are stored;
+// see ParsePipeline
+func (s *DefaultPayloadService) SetPipeline(stages []string) error {
+	pipeline, err := ParsePipeline(stages)
+	if err != nil {
+		return err
+	}
+	s.pipeline = pipeline
+	return nil
+}
+
+// Pipeline returns the configured stage order
+func (s *DefaultPayloadService) Pipeline() []string {
+	return slices.Clone(s.pipeline)
+}
+
+// SetMaintenanceMode refuses new payloads from every source while mode is read-only
+func (s *DefaultPayloadService) SetMaintenanceMode(mode *MaintenanceMode) {
+	s.maintenance = mode
+}
+
+// checkWrite returns ErrReadOnly while maintenance mode refuses writes
+func (s *DefaultPayloadService) checkWrite() error {
+	if s.maintenance == nil {
+		return nil
+	}
+	return s.maintenance.CheckWrite()
+}
+
+// SetStoreStatusTracker records the storage state of every object saved in the
+// background, for /status
+func (s *DefaultPayloadService) SetStoreStatusTracker(tracker *StoreStatusTracker) {
+	s.statuses = tracker
+}
+
+// SetStoredHeaders selects the request headers stored with every payload, by name or
+// by a prefix ending in "*"; "none" stores no headers nor query strings
+func (s *DefaultPayloadService) SetStoredHeaders(patterns []string) {
+	s.headers = NewHeaderSelector(patterns)
+}
+
+// SetRequestLog records every accepted upload and the storage state of its objects
+// in log
+func (s *DefaultPayloadService) SetRequestLog(log RequestLog) {
+	s.requests = log
+}
+
+// logRequest records an accepted upload, with its objects pending, in the request log
+func (s *DefaultPayloadService) logRequest(result *StoreResult, opts StoreOptions) {
+	if s.requests == nil {
+		return
+	}
+	record := RequestRecord{
+		RequestID:  result.RequestID,
+		ReceivedAt: time.Now().UTC(),
+		Source:     opts.Source,
+		SourceIP:   opts.SourceIP,
+		Headers:    loggedHeaders(opts.Headers),
+		State:      StoreStatePending,
+	}
+	for _, object := range result.Objects {
+		record.Objects = append(record.Objects, RequestObject{StoredObject: object, State: StoreStatePending})
+	}
+	s.requests.RequestAccepted(record)
+}
+
+// SetDeletionGuard lets guard veto every object removal
+func (s *DefaultPayloadService) SetDeletionGuard(guard DeletionGuard) {
+	s.guard = guard
+}
+
+// RemoveObject deletes a single stored object and notifies observers
+func (s *DefaultPayloadService) RemoveObject(record ObjectRecord) error {
+	return s.removeObject(context.Background(), record)
+}
+
+// removeObject deletes a single stored object as RemoveObject does, under ctx
+func (s *DefaultPayloadService) removeObject(ctx context.Context, record ObjectRecord) error {
+	if s.guard != nil {
+		if err := s.guard.CheckDelete(record.ObjectName); err != nil {
+			return err
+		}
+	}
+	if err := deletePayload(ctx, s.storage, record.ObjectName); err != nil {
+		return err
+	}
+	s.notifyDeleted(record)
+	return nil
+}
+
+// DeleteRequest removes every object of a request through RemoveObject, so legal
+// holds and retention still apply and observers forget the objects. Objects that
+// cannot be removed are kept; the ones removed are returned with the first error.
+// Storage gives up listing and deleting once ctx ends.
+func (s *DefaultPayloadService) DeleteRequest(ctx context.Context, requestID string) ([]string, error) {
+	if !isAppendableRequestID(requestID) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRequestID, requestID)
+	}
+	objects, err := s.listRequestObjects(ctx, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing payloads: %v", err)
+	}
+
+	var deleted []string
+	var firstErr error
+	for _, obj := range objects {
+		err := s.removeObject(ctx, ObjectRecord{RequestID: requestID, ObjectName: obj})
+		if err != nil {
+			log.Printf("Error deleting %s: %v", obj, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		deleted = append(deleted, obj)
+	}
+	return deleted, firstErr
+}
+
+func (s *DefaultPayloadService) notifyDeleted(record ObjectRecord) {
+	s.observersMu.RLock()
+	defer s.observersMu.RUnlock()
+	for _, observer := range s.observers {
+		observer.PayloadDeleted(record)
+	}
+}
+
+// ObjectTiered tells the observers that follow storage tiers that an object moved,
+// as the archive tierer does; the others are not told, as the object's content did
+// not change
+func (s *DefaultPayloadService) ObjectTiered(record ObjectRecord) {
+	s.observersMu.RLock()
+	defer s.observersMu.RUnlock()
+	for _, observer := range s.observers {
+		if tiered, ok := observer.(TierObserver); ok {
+			tiered.PayloadTiered(record)
+		}
+	}
+}
+
+func (s *DefaultPayloadService) notifyStored(record ObjectRecord) {
+	s.observersMu.RLock()
+	defer s.observersMu.RUnlock()
+	for _, observer := range s.observers {
+		observer.PayloadStored(record)
+	}
+}
+
+// determineContentType infers a content type from an object name's extension
+func determineContentType(objectName string) string {
 	switch {
 	case strings.HasSuffix(objectName, ".json"):
 		return "application/json"
@@ -125,16 +1010,67 @@ func (s *DefaultPayloadService) determineContentType(objectName string) string {
 	}
 }
 
-func (s *DefaultPayloadService) extractOriginalFilename(objectName string) string {
-	parts := strings.Split(objectName, "_")
-	if len(parts) > 2 {
-		filenameWithExt := strings.Join(parts[2:], "_")
-		if strings.HasPrefix(filenameWithExt, "payload") {
-			return ""
+// storedFilename is the filename an object was uploaded with, from its metadata, or
+// else recovered from its name
+func storedFilename(objectName string, metadata map[string]string) string {
+	if escaped, ok := metadata[MetadataFilename]; ok {
+		if filename, err := url.PathUnescape(escaped); err == nil {
+			return filename
+		}
+	}
+	return requestObjectFilename(objectName, metadata[MetadataRequestID])
+}
+
+// extractOriginalFilename recovers the uploaded filename from an object name, or "" for
+// unnamed payloads. Objects stored before their filename was recorded in metadata
+// only have this; storedFilename is preferred when metadata is at hand.
+func extractOriginalFilename(objectName string) string {
+	return requestObjectFilename(objectName, "")
+}
+
+// requestObjectFilename recovers the filename of an object of requestID by removing the
+// request ID from its name, or the one splitObjectName finds when it is not known
+func requestObjectFilename(objectName, requestID string) string {
+	objectName = objectBase(objectName)
+	rest, ok := "", false
+	if requestID != "" {
+		rest, ok = strings.CutPrefix(objectName, requestID+"_")
+	}
+	if !ok {
+		_, rest = splitObjectName(objectName)
+	}
+	if strings.TrimSuffix(rest, path.Ext(rest)) == "payload" {
+		return ""
+	}
+	return rest
+}
+
+// splitObjectName splits an object name, less its object prefix, into its request ID
+// and the rest. A generated "<unix>_<hex>" ID is recognized by its random part;
+// client-chosen IDs hold no underscore.
+func splitObjectName(objectName string) (requestID, rest string) {
+	id, rest, ok := strings.Cut(objectBase(objectName), "_")
+	if !ok {
+		return objectName, ""
+	}
+	if random, after, ok := strings.Cut(rest, "_"); ok && isGeneratedRandom(id, random) {
+		return id + "_" + random, after
+	}
+	return id, rest
+}
+
+// isGeneratedRandom reports whether random, following id, is the random part of a
+// generated request ID: 16 lowercase hex digits, or nanoseconds, after a timestamp
+func isGeneratedRandom(id, random string) bool {
+	if id == "" || id[len(id)-1] < '0' || id[len(id)-1] > '9' || len(random) < 16 {
+		return false
+	}
+	for _, r := range random {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
 		}
-		return filenameWithExt
 	}
-	return ""
+	return true
 }
 
 func (s *DefaultPayloadService) formatSingleFileResponse(file FileInfo) (map[string]interface{}, error) {
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// StorePayloadStream stores a single-object upload straight from its body, without
+// buffering it, so memory stays bounded whatever the payload size. size is the body's
+// length, or -1 when it is unknown. Unlike StorePayload it returns only once the
+// object is stored. Multipart uploads, uploads whose pipeline stages need the whole body up
+// front (sniffing, extraction, decompression, scripts) and storage that cannot stream
+// return ErrStreamUnsupported before the body is read, so the caller can buffer it
+// instead.
+func (s *DefaultPayloadService) StorePayloadStream(body io.Reader, size int64, contentType string, filename string, opts StoreOptions) (*StoreResult, error) {
+	ctx, span := startSpan(opts.Context, "payload.store_stream",
+		attribute.Int64("depot.size", size), attribute.String("depot.content_type", contentType))
+	opts.Context = ctx
+	result, err := s.storePayloadStream(body, size, contentType, filename, opts)
+	if result != nil {
+		span.SetAttributes(attribute.String("depot.request_id", result.RequestID))
+	}
+	if errors.Is(err, ErrStreamUnsupported) {
+		// Not a failure: the caller buffers the body and stores it instead
+		span.SetAttributes(attribute.Bool("depot.buffered", true))
+		span.End()
+		return result, err
+	}
+	endSpan(span, err)
+	return result, err
+}
+
+func (s *DefaultPayloadService) storePayloadStream(body io.Reader, size int64, contentType string, filename string, opts StoreOptions) (*StoreResult, error) {
+	if err := s.checkWrite(); err != nil {
+		return nil, err
+	}
+	streamer, ok := s.storage.(StreamSaver)
+	if !ok || s.needsBody(opts) || s.routesNeedBody(opts, contentType) || strings.HasPrefix(contentType, "multipart/") {
+		return nil, ErrStreamUnsupported
+	}
+
+	opts, prefix, err := s.applyRoutes(opts, contentType, size)
+	if err != nil {
+		return nil, err
+	}
+
+	requestID := opts.RequestID
+	if requestID == "" {
+		requestID = s.newRequestID(prefix)
+	} else if !isValidRequestID(requestID) || s.isGeneratedIDStem(requestID) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRequestID, requestID)
+	}
+	requestID = TenantRequestID(opts.Tenant, requestID)
+	AddLogAttrs(opts.Context, slog.String("request_id", requestID))
+	if opts.IfNoneMatch {
+		if err := s.reserve(opts.Context, requestID); err != nil {
+			return nil, err
+		}
+		defer s.releaseReservation(requestID)
+	}
+
+	// Naming and content type depend only on the headers, so no body is needed
+	payloads, err := s.processor.Process(requestID, nil, contentType, filename)
+	if err != nil {
+		return nil, fmt.Errorf("error processing payload: %v", err)
+	}
+	if len(payloads) != 1 {
+		return nil, ErrStreamUnsupported
+	}
+	payload := payloads[0]
+
+	// The checksum is only known once the body is stored, so it is indexed but not
+	// written to the object metadata
+	metadata := make(map[string]string, len(opts.Metadata)+3)
+	for key, value := range opts.Metadata {
+		metadata[key] = value
+	}
+	metadata[MetadataRequestID] = requestID
+	if payload.Filename != "" {
+		metadata[MetadataFilename] = url.PathEscape(payload.Filename)
+	}
+	if len(opts.Tags) > 0 {
+		metadata[MetadataTags] = strings.Join(opts.Tags, ",")
+	}
+	if !opts.ExpiresAt.IsZero() {
+		metadata[MetadataExpiresAt] = opts.ExpiresAt.Format(time.RFC3339)
+	}
+	for key, value := range s.headers.Metadata(opts.Headers, opts.Query) {
+		metadata[key] = value
+	}
+
+	s.logRequest(&StoreResult{RequestID: requestID, Objects: []StoredObject{{
+		ObjectName:       payload.ObjectName,
+		OriginalFilename: payload.Filename,
+		ContentType:      payload.ContentType,
+	}}}, opts)
+
+	hash := sha256.New()
+	if size >= 0 {
+		body = &sizedBody{r: body, remaining: size}
+	}
+	_, saveSpan := startSpan(opts.Context, "storage.save_stream", attribute.String("depot.object", payload.ObjectName))
+	size, err = streamer.SavePayloadStream(payload.ObjectName, io.TeeReader(body, hash), size, payload.ContentType, metadata, opts.Progress)
+	saveSpan.SetAttributes(attribute.Int64("depot.size", size))
+	endSpan(saveSpan, err)
+	object := StoredObject{
+		ObjectName:       payload.ObjectName,
+		OriginalFilename: payload.Filename,
+		ContentType:      payload.ContentType,
+		Size:             int(size),
+		SHA256:           hex.EncodeToString(hash.Sum(nil)),
+	}
+	if s.statuses != nil {
+		s.statuses.Saved(requestID, payload.ObjectName, err)
+	}
+	if s.requests != nil {
+		s.requests.ObjectSaved(requestID, object, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &StoreResult{RequestID: requestID, Objects: []StoredObject{object}}
+	LoggerWith(opts.Context, slog.String("request_id", requestID)).Info("payload streamed",
+		slog.String("object", payload.ObjectName), slog.Int64("size", size))
+
+	record := ObjectRecord{
+		RequestID:        requestID,
+		ObjectName:       object.ObjectName,
+		OriginalFilename: object.OriginalFilename,
+		ContentType:      object.ContentType,
+		Size:             object.Size,
+		SHA256:           object.SHA256,
+		Tags:             opts.Tags,
+		StoredAt:         time.Now().UTC(),
+		ExpiresAt:        expiresAt(opts),
+	}
+	s.notifyStored(record)
+	s.notifyTargets(record, opts.Notify)
+	s.notifyCallback(result, nil, opts)
+	return result, nil
+}
+
+// sizedBody reads a body of known size, and reads on to its end before delivering
+// the last bytes. Storage may stop reading after size bytes and ignore an error that
+// comes with them, so errors the body only reports at its end, such as a checksum
+// mismatch, are returned instead of the last bytes to fail the upload.
+type sizedBody struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (b *sizedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.EOF
+	}
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return 0, fmt.Errorf("body is longer than its declared size")
+	}
+	if err == nil && b.remaining == 0 {
+		rest, err := io.Copy(io.Discard, b.r)
+		if err != nil {
+			return 0, err
+		}
+		if rest > 0 {
+			return 0, fmt.Errorf("body is longer than its declared size")
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	// Registers the "pgx" database/sql driver
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// postgresMigrationLock serializes migrations across depot replicas starting together
+const postgresMigrationLock = 7_260_001
+
+// postgresQueryTimeout bounds every index query so a slow database cannot stall uploads
+const postgresQueryTimeout = 5 * time.Second
+
+const postgresObjectColumns = "request_id, object_name, original_filename, content_type, size, sha256, tags, storage_tier, stored_at, expires_at, restored_at"
+
+// PostgresMetadataIndex keeps object metadata in Postgres so several depot
+// replicas can share listing and search state. It also keeps the request log.
+type PostgresMetadataIndex struct {
+	sqlRequestLog
+	db *sql.DB
+}
+
+// NewPostgresMetadataIndex connects to Postgres and applies any pending migrations
+func NewPostgresMetadataIndex(dsn string) (*PostgresMetadataIndex, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Postgres connection: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), postgresQueryTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to Postgres: %v", err)
+	}
+
+	index := &PostgresMetadataIndex{sqlRequestLog: sqlRequestLog{db: db}, db: db}
+	if err := index.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate Postgres metadata schema: %v", err)
+	}
+	return index, nil
+}
+
+// migrate applies embedded migrations that have not run yet, in file name order
+func (i *PostgresMetadataIndex) migrate() error {
+	ctx := context.Background()
+	tx, err := i.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", postgresMigrationLock); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS depot_schema_migrations (
+		version    TEXT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return err
+	}
+
+	names, err := fs.Glob(postgresMigrations, "migrations/postgres/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version := strings.TrimSuffix(name[strings.LastIndex(name, "/")+1:], ".sql")
+		var applied bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM depot_schema_migrations WHERE version = $1)", version).Scan(&applied); err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+
+		script, err := postgresMigrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+			return fmt.Errorf("migration %s: %v", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO depot_schema_migrations (version) VALUES ($1)", version); err != nil {
+			return err
+		}
+		log.Printf("Applied Postgres migration %s", version)
+	}
+
+	return tx.Commit()
+}
+
+// Close releases the database connections
+func (i *PostgresMetadataIndex) Close() error {
+	return i.db.Close()
+}
+
+// PayloadStored adds or replaces the record for a stored object
+func (i *PostgresMetadataIndex) PayloadStored(record ObjectRecord) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresQueryTimeout)
+	defer cancel()
+
+	_, err := i.db.ExecContext(ctx, `INSERT INTO depot_objects (`+postgresObjectColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (object_name) DO UPDATE SET
+			request_id = EXCLUDED.request_id,
+			original_filename = EXCLUDED.original_filename,
+			content_type = EXCLUDED.content_type,
+			size = EXCLUDED.size,
+			sha256 = EXCLUDED.sha256,
+			tags = EXCLUDED.tags,
+			storage_tier = EXCLUDED.storage_tier,
+			stored_at = EXCLUDED.stored_at,
+			expires_at = EXCLUDED.expires_at,
+			restored_at = EXCLUDED.restored_at`,
+		record.RequestID, record.ObjectName, record.OriginalFilename, record.ContentType,
+		record.Size, record.SHA256, strings.Join(record.Tags, ","), record.StorageTier, record.StoredAt.UTC(), record.ExpiresAt, record.RestoredAt)
+	if err != nil {
+		log.Printf("Error indexing %s in Postgres: %v", record.ObjectName, err)
+	}
+}
+
+// PayloadDeleted drops the record for a removed object
+func (i *PostgresMetadataIndex) PayloadDeleted(record ObjectRecord) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresQueryTimeout)
+	defer cancel()
+
+	if _, err := i.db.ExecContext(ctx, "DELETE FROM depot_objects WHERE object_name = $1", record.ObjectName); err != nil {
+		log.Printf("Error removing %s from the Postgres index: %v", record.ObjectName, err)
+	}
+}
+
+// PayloadTiered updates the record of an object moved between storage tiers
+func (i *PostgresMetadataIndex) PayloadTiered(record ObjectRecord) {
+	i.PayloadStored(record)
+}
+
+// Get returns the record for a single object
+func (i *PostgresMetadataIndex) Get(objectName string) (ObjectRecord, bool) {
+	records := i.query("SELECT "+postgresObjectColumns+" FROM depot_objects WHERE object_name = $1", objectName)
+	if len(records) == 0 {
+		return ObjectRecord{}, false
+	}
+	return records[0], true
+}
+
+// FindBySHA256 returns all objects whose content checksum matches, oldest first
+func (i *PostgresMetadataIndex) FindBySHA256(sha256 string) []ObjectRecord {
+	return i.query("SELECT "+postgresObjectColumns+" FROM depot_objects WHERE sha256 = $1 ORDER BY stored_at, object_name", sha256)
+}
+
+// List returns every indexed record, oldest first
+func (i *PostgresMetadataIndex) List() []ObjectRecord {
+	return i.query("SELECT " + postgresObjectColumns + " FROM depot_objects ORDER BY stored_at, object_name")
+}
+
+// TotalSize returns the combined size in bytes of all indexed objects
+func (i *PostgresMetadataIndex) TotalSize() int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresQueryTimeout)
+	defer cancel()
+
+	var total int64
+	if err := i.db.QueryRowContext(ctx, "SELECT COALESCE(SUM(size), 0) FROM depot_objects").Scan(&total); err != nil {
+		log.Printf("Error summing object sizes in Postgres: %v", err)
+	}
+	return total
+}
+
+// query runs a record query, logging failures and returning whatever was read
+func (i *PostgresMetadataIndex) query(statement string, args ...any) []ObjectRecord {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresQueryTimeout)
+	defer cancel()
+
+	rows, err := i.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		log.Printf("Error querying the Postgres index: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var records []ObjectRecord
+	for rows.Next() {
+		var record ObjectRecord
+		var tags string
+		var expiresAt, restoredAt sql.NullTime
+		if err := rows.Scan(&record.RequestID, &record.ObjectName, &record.OriginalFilename, &record.ContentType,
+			&record.Size, &record.SHA256, &tags, &record.StorageTier, &record.StoredAt, &expiresAt, &restoredAt); err != nil {
+			log.Printf("Error reading the Postgres index: %v", err)
+			return records
+		}
+		if tags != "" {
+			record.Tags = strings.Split(tags, ",")
+		}
+		record.StoredAt = record.StoredAt.UTC()
+		if expiresAt.Valid {
+			at := expiresAt.Time.UTC()
+			record.ExpiresAt = &at
+		}
+		if restoredAt.Valid {
+			at := restoredAt.Time.UTC()
+			record.RestoredAt = &at
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error reading the Postgres index: %v", err)
+	}
+	return records
+}
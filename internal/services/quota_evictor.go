@@ -0,0 +1,111 @@
+package services
+
+import (
+	"log"
+	"sort"
+)
+
+// Eviction policies supported by QuotaEvictor
+const (
+	EvictionPolicyFIFO        = "fifo"
+	EvictionPolicyTagPriority = "tag-priority"
+)
+
+// QuotaEvictor removes old payloads once total usage exceeds a configured cap
+type QuotaEvictor struct {
+	index         MetadataIndex
+	remover       ObjectRemover
+	quotaBytes    int64
+	policy        string
+	tagPriorities map[string]int
+	trigger       chan struct{}
+}
+
+// NewQuotaEvictor creates an evictor and starts its background loop
+func NewQuotaEvictor(index MetadataIndex, remover ObjectRemover, quotaBytes int64, policy string, tagPriorities map[string]int) *QuotaEvictor {
+	if policy == "" {
+		policy = EvictionPolicyFIFO
+	}
+	e := &QuotaEvictor{
+		index:         index,
+		remover:       remover,
+		quotaBytes:    quotaBytes,
+		policy:        policy,
+		tagPriorities: tagPriorities,
+		trigger:       make(chan struct{}, 1),
+	}
+	go e.run()
+	return e
+}
+
+// PayloadStored schedules an eviction pass without blocking the caller
+func (e *QuotaEvictor) PayloadStored(record ObjectRecord) {
+	e.Schedule()
+}
+
+// Schedule runs an eviction pass in the background, unless one is already pending
+func (e *QuotaEvictor) Schedule() {
+	select {
+	case e.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// PayloadDeleted is a no-op; deletions only lower usage
+func (e *QuotaEvictor) PayloadDeleted(record ObjectRecord) {}
+
+func (e *QuotaEvictor) run() {
+	for range e.trigger {
+		e.Evict()
+	}
+}
+
+// Evict deletes payloads in policy order until usage is within quota;
+// archived objects do not count against the quota of the primary backend
+func (e *QuotaEvictor) Evict() int {
+	var usage int64
+	var candidates []ObjectRecord
+	for _, record := range e.index.List() {
+		if record.StorageTier == StorageTierArchive {
+			continue
+		}
+		usage += int64(record.Size)
+		candidates = append(candidates, record)
+	}
+	if usage <= e.quotaBytes {
+		return 0
+	}
+
+	if e.policy == EvictionPolicyTagPriority {
+		sort.SliceStable(candidates, func(a, b int) bool {
+			return e.priority(candidates[a]) < e.priority(candidates[b])
+		})
+	}
+
+	evicted := 0
+	for _, record := range candidates {
+		if usage <= e.quotaBytes {
+			break
+		}
+		if err := e.remover.RemoveObject(record); err != nil {
+			log.Printf("Error evicting %s: %v", record.ObjectName, err)
+			continue
+		}
+		usage -= int64(record.Size)
+		evicted++
+	}
+
+	log.Printf("Evicted %d object(s) to stay within quota of %d bytes (policy: %s)", evicted, e.quotaBytes, e.policy)
+	return evicted
+}
+
+// priority returns the highest configured priority among the record's tags, or 0
+func (e *QuotaEvictor) priority(record ObjectRecord) int {
+	priority, found := 0, false
+	for _, tag := range record.Tags {
+		if p, ok := e.tagPriorities[tag]; ok && (!found || p > priority) {
+			priority, found = p, true
+		}
+	}
+	return priority
+}
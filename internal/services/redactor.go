@@ -0,0 +1,319 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MetadataRedactions records which redaction rules fired on an object, and how often,
+// as "<rule>=<count>,..."
+const MetadataRedactions = "Redactions"
+
+// DefaultRedactionReplacement replaces redacted values unless a rule sets its own
+const DefaultRedactionReplacement = "[REDACTED]"
+
+// Built-in redaction patterns, usable as a rule's builtin
+const (
+	RedactEmail      = "email"
+	RedactCardNumber = "card_number"
+)
+
+var builtinRedactions = map[string]*regexp.Regexp{
+	RedactEmail:      regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+	RedactCardNumber: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+}
+
+// RedactionRule removes personal data from payloads before they are stored. Fields
+// redacts JSON values by dotted path, where "*" matches any key or array index, such
+// as "customer.email" or "cards.*.number". Pattern and Builtin redact every match of a
+// regular expression in text payloads and JSON strings.
+type RedactionRule struct {
+	Name        string   `json:"name"`
+	Fields      []string `json:"fields"`
+	Pattern     string   `json:"pattern"`
+	Builtin     string   `json:"builtin"`
+	Replacement string   `json:"replacement"`
+}
+
+// LoadRedactionRules reads redaction rules from a JSON array file
+func LoadRedactionRules(path string) ([]RedactionRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []RedactionRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid redaction rules file: %v", err)
+	}
+	return rules, nil
+}
+
+type compiledRedaction struct {
+	name        string
+	fields      [][]string
+	pattern     *regexp.Regexp
+	luhn        bool
+	replacement string
+}
+
+// Redactor applies redaction rules to JSON, newline-delimited JSON and text payloads.
+// Binary payloads, including compressed ones, are stored as they are.
+type Redactor struct {
+	rules []compiledRedaction
+}
+
+// NewRedactor compiles rules, failing on unnamed rules, unknown built-ins and invalid
+// patterns
+func NewRedactor(rules []RedactionRule) (*Redactor, error) {
+	redactor := &Redactor{}
+	names := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" || strings.ContainsAny(rule.Name, ",=") {
+			return nil, fmt.Errorf("redaction rule %d needs a name without ',' or '='", i)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate redaction rule %s", rule.Name)
+		}
+		names[rule.Name] = true
+
+		compiled := compiledRedaction{name: rule.Name, replacement: rule.Replacement}
+		if compiled.replacement == "" {
+			compiled.replacement = DefaultRedactionReplacement
+		}
+		for _, field := range rule.Fields {
+			compiled.fields = append(compiled.fields, strings.Split(field, "."))
+		}
+		switch {
+		case rule.Builtin != "" && rule.Pattern != "":
+			return nil, fmt.Errorf("redaction rule %s sets both builtin and pattern", rule.Name)
+		case rule.Builtin != "":
+			pattern, ok := builtinRedactions[rule.Builtin]
+			if !ok {
+				return nil, fmt.Errorf("redaction rule %s: unknown builtin %q", rule.Name, rule.Builtin)
+			}
+			compiled.pattern = pattern
+			compiled.luhn = rule.Builtin == RedactCardNumber
+		case rule.Pattern != "":
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("redaction rule %s: %v", rule.Name, err)
+			}
+			compiled.pattern = pattern
+		}
+		if compiled.pattern == nil && len(compiled.fields) == 0 {
+			return nil, fmt.Errorf("redaction rule %s needs fields, a pattern or a builtin", rule.Name)
+		}
+		redactor.rules = append(redactor.rules, compiled)
+	}
+	return redactor, nil
+}
+
+// Redact returns the payload with every rule applied, and how often each rule fired.
+// A payload no rule fired on is returned unchanged; otherwise its redactions are
+// recorded in its metadata.
+func (r *Redactor) Redact(payload ProcessedPayload) (ProcessedPayload, map[string]int) {
+	if !utf8.Valid(payload.Data) {
+		return payload, nil
+	}
+	fired := make(map[string]int)
+	var redacted []byte
+	if json.Valid(payload.Data) {
+		redacted = r.redactJSON(payload.Data, fired)
+	} else if lines, ok := splitJSONLines(payload.Data); ok {
+		for i, line := range lines {
+			if len(bytes.TrimSpace(line)) > 0 {
+				lines[i] = r.redactJSON(line, fired)
+			}
+		}
+		redacted = bytes.Join(lines, []byte("\n"))
+	} else {
+		redacted = []byte(r.redactText(string(payload.Data), fired))
+	}
+	if len(fired) == 0 {
+		return payload, nil
+	}
+
+	payload.Data = redacted
+	metadata := make(map[string]string, len(payload.Metadata)+1)
+	for key, value := range payload.Metadata {
+		metadata[key] = value
+	}
+	metadata[MetadataRedactions] = formatCounts(fired)
+	payload.Metadata = metadata
+	return payload, fired
+}
+
+// redactJSON applies field and pattern rules to one JSON document, re-encoding it
+// only when a rule fired
+func (r *Redactor) redactJSON(data []byte, fired map[string]int) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return data
+	}
+	before := countFired(fired)
+	for _, rule := range r.rules {
+		for _, field := range rule.fields {
+			document = redactField(document, field, rule, fired)
+		}
+	}
+	document = r.redactStrings(document, fired)
+	if countFired(fired) == before {
+		return data
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(document); err != nil {
+		return data
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n"))
+}
+
+// redactField replaces the values at a dotted path
+func redactField(value any, path []string, rule compiledRedaction, fired map[string]int) any {
+	if len(path) == 0 {
+		if value == nil {
+			return nil
+		}
+		fired[rule.name]++
+		return rule.replacement
+	}
+	switch node := value.(type) {
+	case map[string]any:
+		for key, child := range node {
+			if path[0] == "*" || path[0] == key {
+				node[key] = redactField(child, path[1:], rule, fired)
+			}
+		}
+	case []any:
+		for i, child := range node {
+			if path[0] == "*" || path[0] == strconv.Itoa(i) {
+				node[i] = redactField(child, path[1:], rule, fired)
+			}
+		}
+	}
+	return value
+}
+
+// redactStrings applies pattern rules to every string in a JSON document, keys
+// included
+func (r *Redactor) redactStrings(value any, fired map[string]int) any {
+	switch node := value.(type) {
+	case string:
+		return r.redactText(node, fired)
+	case map[string]any:
+		redacted := make(map[string]any, len(node))
+		for key, child := range node {
+			redacted[r.redactText(key, fired)] = r.redactStrings(child, fired)
+		}
+		return redacted
+	case []any:
+		for i, child := range node {
+			node[i] = r.redactStrings(child, fired)
+		}
+	}
+	return value
+}
+
+// redactText applies pattern rules to text
+func (r *Redactor) redactText(text string, fired map[string]int) string {
+	for _, rule := range r.rules {
+		if rule.pattern == nil {
+			continue
+		}
+		text = rule.pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if rule.luhn && !validLuhn(match) {
+				return match
+			}
+			fired[rule.name]++
+			return rule.replacement
+		})
+	}
+	return text
+}
+
+// splitJSONLines splits newline-delimited JSON, reporting false unless every
+// non-empty line is a JSON document
+func splitJSONLines(data []byte) ([][]byte, bool) {
+	lines := bytes.Split(data, []byte("\n"))
+	documents := 0
+	for _, line := range lines {
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) == 0 {
+			continue
+		}
+		if !json.Valid(trimmed) {
+			return nil, false
+		}
+		documents++
+	}
+	return lines, documents > 1
+}
+
+// validLuhn checks the Luhn checksum of a card number, ignoring separators
+func validLuhn(number string) bool {
+	sum, digits := 0, 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		digit := int(c - '0')
+		if digits%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		digits++
+	}
+	return digits >= 13 && sum%10 == 0
+}
+
+func countFired(fired map[string]int) int {
+	total := 0
+	for _, count := range fired {
+		total += count
+	}
+	return total
+}
+
+// mergeCounts adds counts to a recorded "<name>=<count>,..." metadata value
+func mergeCounts(recorded string, fired map[string]int) string {
+	merged := make(map[string]int, len(fired))
+	for _, part := range strings.Split(recorded, ",") {
+		name, count, _ := strings.Cut(part, "=")
+		if n, err := strconv.Atoi(count); err == nil && name != "" {
+			merged[name] = n
+		}
+	}
+	for name, count := range fired {
+		merged[name] += count
+	}
+	return formatCounts(merged)
+}
+
+// formatCounts renders counts as "<name>=<count>,..." sorted by name
+func formatCounts(fired map[string]int) string {
+	names := make([]string, 0, len(fired))
+	for name := range fired {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=%d", name, fired[name])
+	}
+	return strings.Join(parts, ",")
+}
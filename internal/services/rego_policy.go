@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/rego"
+)
+
+// RegoPolicyQuery is the document a policy defines; it must be in package depot
+const RegoPolicyQuery = "data.depot"
+
+// RegoPolicy evaluates uploads against Open Policy Agent policies embedded in the depot.
+// Policies live in package depot: an upload is accepted when the allow rule is true and
+// the optional deny set of reasons is empty. An undefined allow rejects the upload, so
+// deny-only policies declare "default allow := true".
+type RegoPolicy struct {
+	query   rego.PreparedEvalQuery
+	timeout time.Duration
+}
+
+// LoadRegoPolicy compiles the .rego policies, and loads the .json or .yaml data files,
+// found at path, which may be a file or a directory
+func LoadRegoPolicy(path string, timeout time.Duration) (*RegoPolicy, error) {
+	query, err := rego.New(
+		rego.Query(RegoPolicyQuery),
+		rego.Load([]string{path}, nil),
+	).PrepareForEval(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("error loading policy: %v", err)
+	}
+	results, err := query.Eval(context.Background(), rego.EvalInput(map[string]any{}))
+	if err != nil {
+		return nil, fmt.Errorf("error loading policy: %v", err)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no policy in package depot at %s", path)
+	}
+	return &RegoPolicy{
+		query:   query,
+		timeout: timeout,
+	}, nil
+}
+
+// Evaluate runs the policy on an upload; policy errors are returned so the caller can fail closed
+func (p *RegoPolicy) Evaluate(input AdmissionInput) (AdmissionDecision, error) {
+	// Round-trip through JSON so the policy sees the same field names as the docs
+	var document map[string]any
+	encoded, err := json.Marshal(input)
+	if err != nil {
+		return AdmissionDecision{}, err
+	}
+	if err := json.Unmarshal(encoded, &document); err != nil {
+		return AdmissionDecision{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	results, err := p.query.Eval(ctx, rego.EvalInput(document))
+	if err != nil {
+		return AdmissionDecision{}, fmt.Errorf("error evaluating policy: %v", err)
+	}
+	var rules map[string]any
+	if len(results) > 0 && len(results[0].Expressions) > 0 {
+		rules, _ = results[0].Expressions[0].Value.(map[string]any)
+	}
+
+	decision := AdmissionDecision{Allowed: rules["allow"] == true}
+	if reasons, ok := rules["deny"].([]any); ok {
+		for _, reason := range reasons {
+			decision.Reasons = append(decision.Reasons, fmt.Sprint(reason))
+		}
+	}
+	// deny is a set, so its order is not meaningful; sort it for stable responses
+	sort.Strings(decision.Reasons)
+	if len(decision.Reasons) > 0 {
+		decision.Allowed = false
+	}
+	if !decision.Allowed && len(decision.Reasons) == 0 {
+		decision.Reasons = []string{"not allowed by policy"}
+	}
+	return decision, nil
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"log"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Object metadata keys holding the request an HTTP upload was sent with. Both are
+// URL-encoded, which keeps them within the ASCII that object metadata allows.
+const (
+	MetadataRequestHeaders = "Request-Headers"
+	MetadataRequestQuery   = "Request-Query"
+)
+
+// DefaultStoredHeaders are kept with every payload unless configured otherwise: the
+// client's User-Agent and its custom X- headers
+var DefaultStoredHeaders = []string{"User-Agent", "X-*"}
+
+// maxStoredRequestSize bounds each of the stored headers and query string, keeping
+// them within the 2 KB S3 allows for all the metadata of an object
+const maxStoredRequestSize = 1024
+
+// HeaderSelector picks the request headers stored with a payload. Patterns name a
+// header, or end in "*" to match every header starting with the rest. Credentials
+// are never stored.
+type HeaderSelector struct {
+	names    map[string]bool
+	prefixes []string
+}
+
+// NewHeaderSelector selects headers by patterns, matched case-insensitively; "none"
+// selects nothing
+func NewHeaderSelector(patterns []string) *HeaderSelector {
+	selector := &HeaderSelector{names: make(map[string]bool)}
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		switch {
+		case pattern == "" || pattern == "none":
+		case strings.HasSuffix(pattern, "*"):
+			selector.prefixes = append(selector.prefixes, strings.TrimSuffix(pattern, "*"))
+		default:
+			selector.names[pattern] = true
+		}
+	}
+	return selector
+}
+
+// selects reports whether a header is stored
+func (s *HeaderSelector) selects(name string) bool {
+	name = strings.ToLower(name)
+	if unloggedHeaders[name] {
+		return false
+	}
+	if s.names[name] {
+		return true
+	}
+	for _, prefix := range s.prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Metadata encodes the selected headers and the query string of an upload as object
+// metadata. Headers are added in name order while they fit; a query string too long
+// to store is left out.
+func (s *HeaderSelector) Metadata(header http.Header, query string) map[string]string {
+	metadata := make(map[string]string, 2)
+
+	names := make([]string, 0, len(header))
+	for name := range header {
+		if s.selects(name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	stored := url.Values{}
+	for _, name := range names {
+		stored[textproto.CanonicalMIMEHeaderKey(name)] = header[name]
+		if len(stored.Encode()) > maxStoredRequestSize {
+			log.Printf("Request header %s is too large to store with the payload", name)
+			delete(stored, textproto.CanonicalMIMEHeaderKey(name))
+		}
+	}
+	if len(stored) > 0 {
+		metadata[MetadataRequestHeaders] = stored.Encode()
+	}
+
+	if query != "" && len(s.names)+len(s.prefixes) > 0 {
+		if len(query) > maxStoredRequestSize {
+			log.Printf("Query string of %d bytes is too large to store with the payload", len(query))
+		} else {
+			metadata[MetadataRequestQuery] = query
+		}
+	}
+	return metadata
+}
+
+// StoredRequest decodes the headers and query string an upload was sent with from
+// its object metadata
+func StoredRequest(metadata map[string]string) (http.Header, string) {
+	var header http.Header
+	if encoded := metadata[MetadataRequestHeaders]; encoded != "" {
+		if values, err := url.ParseQuery(encoded); err == nil {
+			header = http.Header(values)
+		}
+	}
+	return header, metadata[MetadataRequestQuery]
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// sqlQueryTimeout bounds every request log query so a slow database cannot stall uploads
+const sqlQueryTimeout = 5 * time.Second
+
+// unloggedHeaders carry credentials, and are left out of the request log
+var unloggedHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"x-api-key":           true,
+}
+
+// loggedHeaders flattens request headers for the request log, with lowercase names,
+// leaving out credentials
+func loggedHeaders(header http.Header) map[string]string {
+	if len(header) == 0 {
+		return nil
+	}
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		name = strings.ToLower(name)
+		if unloggedHeaders[name] {
+			continue
+		}
+		headers[name] = strings.Join(values, ", ")
+	}
+	return headers
+}
+
+// sqlRequestLog keeps the request log in the depot_requests and depot_request_objects
+// tables. Its statements are valid in both Postgres and SQLite.
+type sqlRequestLog struct {
+	db *sql.DB
+}
+
+// RequestAccepted records an upload and its pending objects
+func (l *sqlRequestLog) RequestAccepted(record RequestRecord) {
+	ctx, cancel := context.WithTimeout(context.Background(), sqlQueryTimeout)
+	defer cancel()
+
+	headers, err := json.Marshal(record.Headers)
+	if err != nil {
+		log.Printf("Error encoding headers of request %s: %v", record.RequestID, err)
+		return
+	}
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error logging request %s: %v", record.RequestID, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO depot_requests (request_id, received_at, source, source_ip, headers)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (request_id) DO NOTHING`,
+		record.RequestID, record.ReceivedAt.UTC(), record.Source, record.SourceIP, string(headers)); err != nil {
+		log.Printf("Error logging request %s: %v", record.RequestID, err)
+		return
+	}
+	for _, object := range record.Objects {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO depot_request_objects (request_id, object_name, original_filename, content_type, size, sha256, state, error)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, '')
+			ON CONFLICT (request_id, object_name) DO UPDATE SET
+				original_filename = EXCLUDED.original_filename,
+				content_type = EXCLUDED.content_type,
+				size = EXCLUDED.size,
+				sha256 = EXCLUDED.sha256,
+				state = EXCLUDED.state,
+				error = ''`,
+			record.RequestID, object.ObjectName, object.OriginalFilename, object.ContentType, object.Size, object.SHA256, object.State); err != nil {
+			log.Printf("Error logging request %s: %v", record.RequestID, err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error logging request %s: %v", record.RequestID, err)
+	}
+}
+
+// ObjectSaved records whether an object reached storage; a failed object keeps the
+// size and checksum it was accepted with
+func (l *sqlRequestLog) ObjectSaved(requestID string, object StoredObject, saveErr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sqlQueryTimeout)
+	defer cancel()
+
+	var err error
+	if saveErr == nil {
+		_, err = l.db.ExecContext(ctx, `INSERT INTO depot_request_objects (request_id, object_name, original_filename, content_type, size, sha256, state, error)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, '')
+			ON CONFLICT (request_id, object_name) DO UPDATE SET
+				size = EXCLUDED.size,
+				sha256 = EXCLUDED.sha256,
+				state = EXCLUDED.state,
+				error = ''`,
+			requestID, object.ObjectName, object.OriginalFilename, object.ContentType, object.Size, object.SHA256, StoreStateStored)
+	} else {
+		_, err = l.db.ExecContext(ctx, `INSERT INTO depot_request_objects (request_id, object_name, original_filename, content_type, size, sha256, state, error)
+			VALUES ($1, $2, $3, $4, 0, '', $5, $6)
+			ON CONFLICT (request_id, object_name) DO UPDATE SET
+				state = EXCLUDED.state,
+				error = EXCLUDED.error`,
+			requestID, object.ObjectName, object.OriginalFilename, object.ContentType, StoreStateFailed, saveErr.Error())
+	}
+	if err != nil {
+		log.Printf("Error logging the storage state of %s: %v", object.ObjectName, err)
+	}
+}
+
+// GetRequest returns a logged request with its objects, in name order
+func (l *sqlRequestLog) GetRequest(requestID string) (RequestRecord, bool) {
+	records := l.queryRequests("SELECT request_id, received_at, source, source_ip, headers FROM depot_requests WHERE request_id = $1", requestID)
+	if len(records) == 0 {
+		return RequestRecord{}, false
+	}
+	return records[0], true
+}
+
+// ListRequests returns the most recent requests whose ID starts with prefix, newest first
+func (l *sqlRequestLog) ListRequests(prefix string, limit int) []RequestRecord {
+	pattern := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix) + "%"
+	return l.queryRequests(`SELECT request_id, received_at, source, source_ip, headers FROM depot_requests
+		WHERE request_id LIKE $1 ESCAPE '\'
+		ORDER BY received_at DESC, request_id DESC
+		LIMIT $2`, pattern, limit)
+}
+
+// queryRequests runs a request query and loads the objects of every request read,
+// logging failures and returning whatever was read
+func (l *sqlRequestLog) queryRequests(statement string, args ...any) []RequestRecord {
+	ctx, cancel := context.WithTimeout(context.Background(), sqlQueryTimeout)
+	defer cancel()
+
+	rows, err := l.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		log.Printf("Error querying the request log: %v", err)
+		return nil
+	}
+	var records []RequestRecord
+	for rows.Next() {
+		var record RequestRecord
+		var headers string
+		if err := rows.Scan(&record.RequestID, &record.ReceivedAt, &record.Source, &record.SourceIP, &headers); err != nil {
+			log.Printf("Error reading the request log: %v", err)
+			break
+		}
+		record.ReceivedAt = record.ReceivedAt.UTC()
+		if err := json.Unmarshal([]byte(headers), &record.Headers); err != nil {
+			log.Printf("Error decoding headers of request %s: %v", record.RequestID, err)
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error reading the request log: %v", err)
+	}
+	rows.Close()
+
+	for i := range records {
+		records[i].Objects, records[i].State = l.requestObjects(ctx, records[i].RequestID)
+	}
+	return records
+}
+
+// requestObjects loads the objects of a request and sums up their storage state
+func (l *sqlRequestLog) requestObjects(ctx context.Context, requestID string) ([]RequestObject, string) {
+	objects := []RequestObject{}
+	rows, err := l.db.QueryContext(ctx, `SELECT object_name, original_filename, content_type, size, sha256, state, error
+		FROM depot_request_objects WHERE request_id = $1 ORDER BY object_name`, requestID)
+	if err != nil {
+		log.Printf("Error querying the request log: %v", err)
+		return objects, StoreStatePending
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var object RequestObject
+		if err := rows.Scan(&object.ObjectName, &object.OriginalFilename, &object.ContentType,
+			&object.Size, &object.SHA256, &object.State, &object.Error); err != nil {
+			log.Printf("Error reading the request log: %v", err)
+			break
+		}
+		objects = append(objects, object)
+		counts[object.State]++
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error reading the request log: %v", err)
+	}
+	return objects, storeState(counts)
+}
@@ -13,12 +13,13 @@ func NewDefaultResponseFormatter() *DefaultResponseFormatter {
 }
 
 // FormatDepotResponse formats the response for depot endpoint
-func (f *DefaultResponseFormatter) FormatDepotResponse(requestID string, size int, timestamp string, filename string) map[string]any {
+func (f *DefaultResponseFormatter) FormatDepotResponse(result *StoreResult, size int, timestamp string, filename string) map[string]any {
 	response := map[string]any{
 		"status":     "accepted",
-		"request_id": requestID,
+		"request_id": result.RequestID,
 		"size":       size,
 		"timestamp":  timestamp,
+		"objects":    result.Objects,
 	}
 
 	if filename != "" {
@@ -37,8 +38,9 @@ func (f *DefaultResponseFormatter) FormatGetResponse(requestID string, files []F
 	}
 }
 
-// FormatListResponse formats the response for list endpoint
-func (f *DefaultResponseFormatter) FormatListResponse(objects []string, count int) map[string]any {
+// FormatListResponse formats the response for list endpoint, one entry per object
+// with its name, size, content type and last modification time
+func (f *DefaultResponseFormatter) FormatListResponse(objects []ObjectInfo, count int) map[string]any {
 	return map[string]any{
 		"count":   count,
 		"objects": objects,
@@ -55,3 +57,40 @@ func (f *DefaultResponseFormatter) FormatFileInfo(objectName, originalFilename s
 		PayloadBase64:    base64.StdEncoding.EncodeToString(data),
 	}
 }
+
+// FormatFindResponse formats the response for find endpoint
+func (f *DefaultResponseFormatter) FormatFindResponse(sha256 string, records []ObjectRecord) map[string]any {
+	if records == nil {
+		records = []ObjectRecord{}
+	}
+
+	requestIDs := []string{}
+	seen := make(map[string]bool)
+	for _, record := range records {
+		if !seen[record.RequestID] {
+			seen[record.RequestID] = true
+			requestIDs = append(requestIDs, record.RequestID)
+		}
+	}
+
+	return map[string]any{
+		"sha256":      sha256,
+		"found":       len(records) > 0,
+		"count":       len(records),
+		"request_ids": requestIDs,
+		"objects":     records,
+	}
+}
+
+// FormatChangesResponse formats the response for changes endpoint
+func (f *DefaultResponseFormatter) FormatChangesResponse(events []ChangeEvent, nextCursor int64, truncated bool) map[string]any {
+	if events == nil {
+		events = []ChangeEvent{}
+	}
+	return map[string]any{
+		"events":    events,
+		"count":     len(events),
+		"cursor":    nextCursor,
+		"truncated": truncated,
+	}
+}
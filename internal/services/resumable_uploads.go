@@ -0,0 +1,271 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// Errors returned by ResumableUploads
+var (
+	ErrUnknownUpload    = errors.New("unknown upload session")
+	ErrOffsetMismatch   = errors.New("upload offset does not match")
+	ErrUploadBusy       = errors.New("upload session is receiving another chunk")
+	ErrUploadIncomplete = errors.New("upload is shorter than its declared length")
+	ErrUploadTooLong    = errors.New("chunk runs past the upload's declared length")
+	ErrUploadAborted    = errors.New("upload aborted")
+)
+
+// ResumableUpload describes an upload session: how many bytes it has received, so a
+// client whose connection dropped knows where to resume
+type ResumableUpload struct {
+	ID     string `json:"upload_id"`
+	Offset int64  `json:"offset"`
+	// Length is -1 when the client did not declare it
+	Length    int64     `json:"length"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// resumableUpload is a session whose chunks are piped, in order, into a single
+// streaming store
+type resumableUpload struct {
+	info ResumableUpload
+	// busy is held while a chunk is written, so chunks cannot interleave
+	busy   sync.Mutex
+	writer *io.PipeWriter
+	done   chan storeOutcome
+}
+
+// pipeWriter tells failures to hand a chunk to storage from failures to read it
+type pipeWriter struct {
+	w *io.PipeWriter
+}
+
+func (p pipeWriter) Write(data []byte) (int, error) {
+	n, err := p.w.Write(data)
+	if err != nil {
+		return n, &pipeWriteError{err: err}
+	}
+	return n, nil
+}
+
+// pipeWriteError is returned when storage gave up on a session's body
+type pipeWriteError struct {
+	err error
+}
+
+func (e *pipeWriteError) Error() string { return e.err.Error() }
+
+func (e *pipeWriteError) Unwrap() error { return e.err }
+
+// storeOutcome is the result of a session's store, once its body has ended
+type storeOutcome struct {
+	result *StoreResult
+	err    error
+}
+
+// ResumableUploads lets clients send a large payload in sequential chunks over many
+// requests, resuming from the received offset after a dropped connection. Each
+// session streams into storage as its chunks arrive: MinIO and S3 store it as one
+// multipart upload, completed when the session is. Storage that cannot stream has the
+// session buffered and stored on completion. Sessions live in memory, so they do not
+// survive a restart, and idle sessions are aborted after the timeout.
+type ResumableUploads struct {
+	payloads PayloadService
+	timeout  time.Duration
+
+	mu      sync.Mutex
+	uploads map[string]*resumableUpload
+}
+
+// NewResumableUploads creates upload sessions stored through payloads, aborting those
+// idle for timeout
+func NewResumableUploads(payloads PayloadService, timeout time.Duration) *ResumableUploads {
+	return &ResumableUploads{
+		payloads: payloads,
+		timeout:  timeout,
+		uploads:  make(map[string]*resumableUpload),
+	}
+}
+
+// Create opens a session for one payload. length is the payload's size, or -1 when
+// it is unknown. The session ID carries the upload's tenant prefix.
+func (u *ResumableUploads) Create(contentType, filename string, length int64, opts StoreOptions) (ResumableUpload, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return ResumableUpload{}, fmt.Errorf("error generating upload ID: %v", err)
+	}
+	if length < 0 {
+		length = -1
+	}
+	reader, writer := io.Pipe()
+	upload := &resumableUpload{
+		info: ResumableUpload{
+			ID:        TenantRequestID(opts.Tenant, hex.EncodeToString(id)),
+			Length:    length,
+			ExpiresAt: time.Now().Add(u.timeout).UTC(),
+		},
+		writer: writer,
+		done:   make(chan storeOutcome, 1),
+	}
+	opts.Sync = true
+	go u.store(upload, reader, contentType, filename, opts)
+
+	u.mu.Lock()
+	u.pruneLocked()
+	u.uploads[upload.info.ID] = upload
+	u.mu.Unlock()
+	return upload.info, nil
+}
+
+// store saves a session's body as it is piped in, streaming it when storage can and
+// buffering it otherwise
+func (u *ResumableUploads) store(upload *resumableUpload, body *io.PipeReader, contentType, filename string, opts StoreOptions) {
+	var result *StoreResult
+	err := ErrStreamUnsupported
+	if streamer, ok := u.payloads.(PayloadStreamer); ok {
+		result, err = streamer.StorePayloadStream(body, upload.info.Length, contentType, filename, opts)
+	}
+	if errors.Is(err, ErrStreamUnsupported) {
+		var data []byte
+		if data, err = io.ReadAll(body); err == nil {
+			result, err = u.payloads.StorePayload(data, contentType, filename, opts)
+		}
+	}
+	// Unblock a chunk still being written once the store has given up
+	if err != nil {
+		body.CloseWithError(err)
+	} else {
+		body.Close()
+	}
+	upload.done <- storeOutcome{result: result, err: err}
+}
+
+// Get returns a session's progress
+func (u *ResumableUploads) Get(id string) (ResumableUpload, error) {
+	upload, err := u.lookup(id)
+	if err != nil {
+		return ResumableUpload{}, err
+	}
+	upload.busy.Lock()
+	defer upload.busy.Unlock()
+	return upload.info, nil
+}
+
+// Write appends a chunk read from body at offset, which must be the session's
+// current offset. A chunk cut short still counts the bytes received, so the client
+// can resume after them. It returns the session's new state.
+func (u *ResumableUploads) Write(id string, offset int64, body io.Reader) (ResumableUpload, error) {
+	upload, err := u.lookup(id)
+	if err != nil {
+		return ResumableUpload{}, err
+	}
+	if !upload.busy.TryLock() {
+		return ResumableUpload{}, ErrUploadBusy
+	}
+	defer upload.busy.Unlock()
+	if offset != upload.info.Offset {
+		return upload.info, fmt.Errorf("%w: expected %d, got %d", ErrOffsetMismatch, upload.info.Offset, offset)
+	}
+
+	if upload.info.Length >= 0 {
+		body = io.LimitReader(body, upload.info.Length-upload.info.Offset+1)
+	}
+	n, err := io.Copy(pipeWriter{upload.writer}, body)
+	upload.info.Offset += n
+	upload.info.ExpiresAt = time.Now().Add(u.timeout).UTC()
+	if upload.info.Length >= 0 && upload.info.Offset > upload.info.Length {
+		u.abort(upload, ErrUploadTooLong)
+		return upload.info, ErrUploadTooLong
+	}
+	if err != nil {
+		var pipeErr *pipeWriteError
+		if errors.As(err, &pipeErr) {
+			// Storage failed, so the session cannot go on
+			u.remove(upload)
+			return upload.info, pipeErr.err
+		}
+		return upload.info, err
+	}
+	return upload.info, nil
+}
+
+// Complete ends a session's body and waits for its payload to be stored
+func (u *ResumableUploads) Complete(id string) (*StoreResult, error) {
+	upload, err := u.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	if !upload.busy.TryLock() {
+		return nil, ErrUploadBusy
+	}
+	defer upload.busy.Unlock()
+	if upload.info.Length >= 0 && upload.info.Offset != upload.info.Length {
+		return nil, fmt.Errorf("%w: received %d of %d bytes", ErrUploadIncomplete, upload.info.Offset, upload.info.Length)
+	}
+
+	u.remove(upload)
+	upload.writer.Close()
+	outcome := <-upload.done
+	return outcome.result, outcome.err
+}
+
+// Abort drops a session and whatever it has stored so far
+func (u *ResumableUploads) Abort(id string) error {
+	upload, err := u.lookup(id)
+	if err != nil {
+		return err
+	}
+	upload.busy.Lock()
+	defer upload.busy.Unlock()
+	u.abort(upload, ErrUploadAborted)
+	return nil
+}
+
+// abort fails a session's store, which discards its body; callers hold busy
+func (u *ResumableUploads) abort(upload *resumableUpload, reason error) {
+	u.remove(upload)
+	upload.writer.CloseWithError(reason)
+	<-upload.done
+}
+
+// lookup finds a live session
+func (u *ResumableUploads) lookup(id string) (*resumableUpload, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.pruneLocked()
+	upload, ok := u.uploads[id]
+	if !ok {
+		return nil, ErrUnknownUpload
+	}
+	return upload, nil
+}
+
+// remove forgets a session
+func (u *ResumableUploads) remove(upload *resumableUpload) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.uploads, upload.info.ID)
+}
+
+// pruneLocked aborts sessions idle past their expiry; callers hold mu. Sessions
+// receiving a chunk are left alone.
+func (u *ResumableUploads) pruneLocked() {
+	now := time.Now()
+	for id, upload := range u.uploads {
+		if !upload.busy.TryLock() {
+			continue
+		}
+		if now.After(upload.info.ExpiresAt) {
+			delete(u.uploads, id)
+			log.Printf("Aborting upload session %s, idle since %d bytes", id, upload.info.Offset)
+			upload.writer.CloseWithError(fmt.Errorf("%w: session expired", ErrUploadAborted))
+		}
+		upload.busy.Unlock()
+	}
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// DefaultRetentionClass is the retention class of payloads whose tags name no class
+const DefaultRetentionClass = "default"
+
+// maxAgeLifecycleClass tags payloads kept for the global maximum age in lifecycle rules
+const maxAgeLifecycleClass = "_max-age"
+
+// RetentionSweeper deletes payloads once they are older than their retention class
+// allows, or past the expiry their routing rule gave them. Objects protected by a
+// legal hold or retention are kept until they are released.
+type RetentionSweeper struct {
+	index   MetadataIndex
+	remover ObjectRemover
+	maxAge  time.Duration
+	classes map[string]time.Duration
+	// serverSide leaves age-based expiry to the storage's lifecycle rules
+	serverSide bool
+}
+
+// NewRetentionSweeper creates a sweeper that removes hot payloads older than maxAge,
+// or only expired ones when maxAge is zero
+func NewRetentionSweeper(index MetadataIndex, remover ObjectRemover, maxAge time.Duration) *RetentionSweeper {
+	return &RetentionSweeper{
+		index:   index,
+		remover: remover,
+		maxAge:  maxAge,
+	}
+}
+
+// SetClasses keeps payloads tagged with a class name for that class's age instead of
+// maxAge. The "default" class applies to payloads with no class tag. A payload
+// with several class tags is kept for the longest, and a zero age keeps it forever.
+func (r *RetentionSweeper) SetClasses(classes map[string]time.Duration) {
+	r.classes = classes
+}
+
+// Class names the retention class of a payload with the given tags, and how long the
+// class keeps it; an empty name means the global maximum age applies
+func (r *RetentionSweeper) Class(tags []string) (string, time.Duration) {
+	class, maxAge, found := "", r.maxAge, false
+	for _, tag := range tags {
+		age, ok := r.classes[tag]
+		if !ok || tag == DefaultRetentionClass {
+			continue
+		}
+		if !found || age == 0 || maxAge != 0 && age > maxAge {
+			class, maxAge = tag, age
+		}
+		found = true
+	}
+	if !found {
+		if age, ok := r.classes[DefaultRetentionClass]; ok {
+			return DefaultRetentionClass, age
+		}
+	}
+	return class, maxAge
+}
+
+// ExpiryRules lists the lifecycle rule of every retention class that does not keep
+// payloads forever, including the global maximum age
+func (r *RetentionSweeper) ExpiryRules() []ExpiryRule {
+	var rules []ExpiryRule
+	if r.maxAge > 0 {
+		rules = append(rules, ExpiryRule{Class: maxAgeLifecycleClass, Age: r.maxAge})
+	}
+	classes := make([]string, 0, len(r.classes))
+	for class := range r.classes {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		if age := r.classes[class]; age > 0 {
+			rules = append(rules, ExpiryRule{Class: class, Age: age})
+		}
+	}
+	return rules
+}
+
+// LifecycleClass names the lifecycle rule a payload with tags expires by, or "" when
+// it is kept forever
+func (r *RetentionSweeper) LifecycleClass(tags []string) string {
+	class, maxAge := r.Class(tags)
+	if maxAge == 0 {
+		return ""
+	}
+	if class == "" {
+		return maxAgeLifecycleClass
+	}
+	return class
+}
+
+// SetServerSideExpiry leaves age-based expiry to the storage's lifecycle rules. The
+// sweeper still removes payloads their routing rule expired, and forgets the rest a
+// day after their lifecycle rule should have removed them.
+func (r *RetentionSweeper) SetServerSideExpiry(enabled bool) {
+	r.serverSide = enabled
+}
+
+// Sweep removes every expired payload; archived payloads are left to the archive bucket
+func (r *RetentionSweeper) Sweep() (string, error) {
+	now := time.Now()
+	removed, protected, failed := 0, 0, 0
+	removedByClass := make(map[string]int)
+
+	for _, record := range r.index.List() {
+		class, maxAge := r.Class(record.Tags)
+		if r.serverSide && maxAge > 0 {
+			maxAge = time.Duration(ExpiryRule{Age: maxAge}.Days()+1) * 24 * time.Hour
+		}
+		expired := record.ExpiresAt != nil && !record.ExpiresAt.After(now)
+		tooOld := maxAge > 0 && !record.StoredAt.After(now.Add(-maxAge))
+		if record.StorageTier == StorageTierArchive || !expired && !tooOld {
+			continue
+		}
+		err := r.remover.RemoveObject(record)
+		switch {
+		case err == nil:
+			removed++
+			if class != "" && !expired {
+				removedByClass[class]++
+			}
+		case errors.Is(err, ErrLegalHold) || errors.Is(err, ErrRetained):
+			protected++
+		default:
+			log.Printf("Error removing expired %s: %v", record.ObjectName, err)
+			failed++
+		}
+	}
+
+	summary := fmt.Sprintf("removed %d expired payload(s), kept %d protected", removed, protected)
+	if r.maxAge > 0 {
+		summary = fmt.Sprintf("removed %d payload(s) expired or older than %s, kept %d protected", removed, r.maxAge, protected)
+	}
+	if len(removedByClass) > 0 {
+		summary += fmt.Sprintf(" (by class: %s)", formatCounts(removedByClass))
+	}
+	if failed > 0 {
+		return summary, fmt.Errorf("%d expired payload(s) could not be removed", failed)
+	}
+	return summary, nil
+}
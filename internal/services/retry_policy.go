@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Backoff curves supported by RetryPolicy
+const (
+	BackoffExponential = "exponential"
+	BackoffLinear      = "linear"
+	BackoffConstant    = "constant"
+)
+
+// Duration is a time.Duration that unmarshals from JSON strings such as "1.5s"
+type Duration time.Duration
+
+// UnmarshalJSON accepts a Go duration string or a number of seconds
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	case float64:
+		*d = Duration(v * float64(time.Second))
+	default:
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	return nil
+}
+
+// MarshalJSON renders the duration as a Go duration string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// RetryPolicy controls how an outbound delivery is attempted
+type RetryPolicy struct {
+	MaxAttempts    int      `json:"max_attempts"`
+	Backoff        string   `json:"backoff"`
+	InitialBackoff Duration `json:"initial_backoff"`
+	MaxBackoff     Duration `json:"max_backoff"`
+	// Timeout bounds each attempt
+	Timeout Duration `json:"timeout"`
+	// Concurrency caps in-flight attempts to the sink; 0 means unlimited
+	Concurrency int `json:"concurrency"`
+}
+
+// DefaultRetryPolicy is used for any field a sink leaves unset
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	Backoff:        BackoffExponential,
+	InitialBackoff: Duration(time.Second),
+	MaxBackoff:     Duration(5 * time.Minute),
+	Timeout:        Duration(10 * time.Second),
+}
+
+// WithDefaults fills unset fields from DefaultRetryPolicy and validates the backoff curve
+func (p RetryPolicy) WithDefaults() (RetryPolicy, error) {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.Backoff == "" {
+		p.Backoff = DefaultRetryPolicy.Backoff
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = DefaultRetryPolicy.Timeout
+	}
+	if p.Concurrency < 0 {
+		p.Concurrency = 0
+	}
+	switch p.Backoff {
+	case BackoffExponential, BackoffLinear, BackoffConstant:
+	default:
+		return p, fmt.Errorf("unsupported backoff %q", p.Backoff)
+	}
+	return p, nil
+}
+
+// Delay returns the wait before the attempt following the given (1-based) failed attempt
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	initial := time.Duration(p.InitialBackoff)
+	var delay time.Duration
+	switch p.Backoff {
+	case BackoffConstant:
+		delay = initial
+	case BackoffLinear:
+		delay = initial * time.Duration(attempt)
+	default:
+		delay = initial
+		for i := 1; i < attempt && delay < time.Duration(p.MaxBackoff); i++ {
+			delay *= 2
+		}
+	}
+	if delay > time.Duration(p.MaxBackoff) {
+		delay = time.Duration(p.MaxBackoff)
+	}
+	return delay
+}
+
+// RetryExecutor runs delivery attempts for one sink under its retry policy
+type RetryExecutor struct {
+	policy RetryPolicy
+	slots  chan struct{}
+}
+
+// NewRetryExecutor creates an executor; the policy should already have defaults applied
+func NewRetryExecutor(policy RetryPolicy) *RetryExecutor {
+	executor := &RetryExecutor{policy: policy}
+	if policy.Concurrency > 0 {
+		executor.slots = make(chan struct{}, policy.Concurrency)
+	}
+	return executor
+}
+
+// Policy returns the executor's retry policy
+func (e *RetryExecutor) Policy() RetryPolicy {
+	return e.policy
+}
+
+// Attempt runs one attempt within the concurrency limit and per-attempt timeout
+func (e *RetryExecutor) Attempt(attempt func(ctx context.Context) error) error {
+	if e.slots != nil {
+		e.slots <- struct{}{}
+		defer func() { <-e.slots }()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(e.policy.Timeout))
+	defer cancel()
+	return attempt(ctx)
+}
+
+// Do retries attempt until it succeeds or the policy is exhausted, calling onFailure
+// after each failed attempt, and returns the last error
+func (e *RetryExecutor) Do(attempt func(ctx context.Context) error, onFailure func(n int, err error)) error {
+	var err error
+	for n := 1; n <= e.policy.MaxAttempts; n++ {
+		if err = e.Attempt(attempt); err == nil {
+			return nil
+		}
+		if onFailure != nil {
+			onFailure(n, err)
+		}
+		if n < e.policy.MaxAttempts {
+			time.Sleep(e.policy.Delay(n))
+		}
+	}
+	return err
+}
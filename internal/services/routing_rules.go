@@ -0,0 +1,426 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrPayloadDropped is returned for uploads a routing rule drops or samples out
+var ErrPayloadDropped = errors.New("payload dropped")
+
+// RouteMatch lists the conditions of a routing rule; every condition that is set must
+// hold. Patterns use path.Match syntax, such as "image/*".
+type RouteMatch struct {
+	ContentType string `json:"content_type"`
+	// MinSize and MaxSize bound the upload size in bytes; zero leaves a side open.
+	// Streamed uploads have no known size and never match a size bound.
+	MinSize int64 `json:"min_size"`
+	MaxSize int64 `json:"max_size"`
+	// Tags must all be present on the upload
+	Tags []string `json:"tags"`
+	// Source is the route or ingester the upload came through, such as "/depot",
+	// "/webhooks/github", "watch" or "kafka"
+	Source string `json:"source"`
+	// Headers match request headers by name; uploads that did not arrive over HTTP
+	// have none
+	Headers map[string]string `json:"headers"`
+}
+
+// RoutingRule applies its actions to the uploads its conditions match
+type RoutingRule struct {
+	Name  string     `json:"name"`
+	Match RouteMatch `json:"match"`
+
+	// Tags are added to the upload's tags
+	Tags []string `json:"tags"`
+	// Prefix starts the generated request ID, so the objects share an object name
+	// prefix; uploads with a client-chosen request ID keep it
+	Prefix string `json:"prefix"`
+	// TTL expires the objects this long after they are stored
+	TTL Duration `json:"ttl"`
+	// Notify lists forward targets every stored object is sent to
+	Notify []string `json:"notify"`
+	// Extract and Decompress turn on the matching pipeline stages for the upload
+	Extract    bool `json:"extract"`
+	Decompress bool `json:"decompress"`
+	// Continue evaluates the following rules too, instead of stopping at this one
+	Continue bool `json:"continue"`
+
+	// Drop discards every matching upload, and Sample all but a share of them
+	Drop   bool          `json:"drop"`
+	Sample *SamplePolicy `json:"sample"`
+}
+
+// SamplePolicy keeps a share of the uploads a rule matches. With both a rate and an
+// interval set, an upload is kept only when it passes both.
+type SamplePolicy struct {
+	// Rate is the fraction of uploads kept, between 0 and 1
+	Rate float64 `json:"rate"`
+	// Interval keeps at most one upload per interval
+	Interval Duration `json:"interval"`
+	// Per samples each "source" or each set of "tags" separately; empty samples
+	// everything the rule matches together
+	Per string `json:"per"`
+}
+
+// RouteInput describes an upload to the routing rules
+type RouteInput struct {
+	ContentType string
+	// Size is -1 when the upload is streamed
+	Size    int64
+	Tags    []string
+	Source  string
+	Headers http.Header
+}
+
+// RouteDecision is the combined actions of the rules an upload matched
+type RouteDecision struct {
+	Rules      []string
+	Tags       []string
+	Prefix     string
+	TTL        time.Duration
+	Notify     []string
+	Extract    bool
+	Decompress bool
+	// Drop is set when the upload is discarded, by the last rule in Rules
+	Drop bool
+
+	// matched indexes the rules in Rules
+	matched []int
+}
+
+// LoadRoutingRules reads rules from a JSON array file
+func LoadRoutingRules(path string) ([]RoutingRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []RoutingRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid routing rules file: %v", err)
+	}
+	names := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("routing rule %d needs a name", i)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate routing rule %s", rule.Name)
+		}
+		names[rule.Name] = true
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("routing rule %s: %v", rule.Name, err)
+		}
+	}
+	return rules, nil
+}
+
+func (r RoutingRule) validate() error {
+	for _, pattern := range []string{r.Match.ContentType, r.Match.Source} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	for name, pattern := range r.Match.Headers {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q for header %s", pattern, name)
+		}
+	}
+	if r.Match.MaxSize > 0 && r.Match.MinSize > r.Match.MaxSize {
+		return fmt.Errorf("min_size is larger than max_size")
+	}
+	for _, tag := range r.Tags {
+		if tag == "" || strings.Contains(tag, ",") {
+			return fmt.Errorf("invalid tag %q", tag)
+		}
+	}
+	if r.Prefix != "" && !isValidRequestID(r.Prefix) {
+		return fmt.Errorf("prefix %q may only hold letters, digits, '.' and '-'", r.Prefix)
+	}
+	if r.TTL < 0 {
+		return fmt.Errorf("ttl must not be negative")
+	}
+	if sample := r.Sample; sample != nil {
+		if sample.Rate < 0 || sample.Rate > 1 {
+			return fmt.Errorf("sample rate must be between 0 and 1")
+		}
+		if sample.Rate == 0 && sample.Interval <= 0 {
+			return fmt.Errorf("sample needs a rate or an interval")
+		}
+		if sample.Per != "" && sample.Per != "source" && sample.Per != "tags" {
+			return fmt.Errorf("sample per must be source or tags, got %q", sample.Per)
+		}
+	}
+	return nil
+}
+
+// RoutingRules evaluates routing rules in order for every upload. Evaluation stops at
+// the first matching rule, unless that rule asks to continue.
+type RoutingRules struct {
+	rules []RoutingRule
+
+	mu sync.Mutex
+	// lastKept is when each sampling key last kept an upload
+	lastKept map[string]time.Time
+	dropped  map[string]int64
+}
+
+// NewRoutingRules creates an evaluator for rules
+func NewRoutingRules(rules []RoutingRule) *RoutingRules {
+	return &RoutingRules{
+		rules:    rules,
+		lastKept: make(map[string]time.Time),
+		dropped:  make(map[string]int64),
+	}
+}
+
+// Dropped counts the uploads each rule has dropped or sampled out
+func (r *RoutingRules) Dropped() map[string]int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	dropped := make(map[string]int64, len(r.dropped))
+	for name, count := range r.dropped {
+		dropped[name] = count
+	}
+	return dropped
+}
+
+// Targets lists the forward targets the rules notify
+func (r *RoutingRules) Targets() []string {
+	var targets []string
+	for _, rule := range r.rules {
+		for _, target := range rule.Notify {
+			if !slices.Contains(targets, target) {
+				targets = append(targets, target)
+			}
+		}
+	}
+	return targets
+}
+
+// Prefixes lists the prefixes the rules give generated request IDs
+func (r *RoutingRules) Prefixes() []string {
+	var prefixes []string
+	for _, rule := range r.rules {
+		if rule.Prefix != "" && !slices.Contains(prefixes, rule.Prefix) {
+			prefixes = append(prefixes, rule.Prefix)
+		}
+	}
+	return prefixes
+}
+
+// Route combines the actions of the rules input matches, and samples the upload under
+// their drop and sampling settings
+func (r *RoutingRules) Route(input RouteInput) RouteDecision {
+	decision := r.Match(input)
+	for i, index := range decision.matched {
+		if !r.keep(r.rules[index], input) {
+			decision.Rules = decision.Rules[:i+1]
+			decision.Drop = true
+			break
+		}
+	}
+	return decision
+}
+
+// Match combines the actions of the rules input matches, without sampling it. Later
+// rules override the prefix and TTL; tags and targets accumulate.
+func (r *RoutingRules) Match(input RouteInput) RouteDecision {
+	var decision RouteDecision
+	for index, rule := range r.rules {
+		if !rule.Match.matches(input) {
+			continue
+		}
+		decision.Rules = append(decision.Rules, rule.Name)
+		decision.matched = append(decision.matched, index)
+		if rule.Drop {
+			decision.Drop = true
+			break
+		}
+		decision.Tags = appendMissing(decision.Tags, rule.Tags...)
+		decision.Notify = appendMissing(decision.Notify, rule.Notify...)
+		if rule.Prefix != "" {
+			decision.Prefix = rule.Prefix
+		}
+		if rule.TTL > 0 {
+			decision.TTL = time.Duration(rule.TTL)
+		}
+		decision.Extract = decision.Extract || rule.Extract
+		decision.Decompress = decision.Decompress || rule.Decompress
+		if !rule.Continue {
+			break
+		}
+	}
+	return decision
+}
+
+// keep decides whether a matching upload survives the rule's drop and sampling
+// settings, counting the ones it discards
+func (r *RoutingRules) keep(rule RoutingRule, input RouteInput) bool {
+	if !rule.Drop && rule.Sample == nil {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := !rule.Drop
+	if sample := rule.Sample; kept && sample != nil {
+		if sample.Rate > 0 && rand.Float64() >= sample.Rate {
+			kept = false
+		}
+		if sample.Interval > 0 && kept {
+			key := rule.Name
+			switch sample.Per {
+			case "source":
+				key += "\x00" + input.Source
+			case "tags":
+				key += "\x00" + strings.Join(input.Tags, ",")
+			}
+			now := time.Now()
+			if last, ok := r.lastKept[key]; ok && now.Sub(last) < time.Duration(sample.Interval) {
+				kept = false
+			} else {
+				r.lastKept[key] = now
+			}
+		}
+	}
+	if !kept {
+		r.dropped[rule.Name]++
+	}
+	return kept
+}
+
+func (m RouteMatch) matches(input RouteInput) bool {
+	if m.ContentType != "" && !matchPattern(m.ContentType, mediaType(input.ContentType)) {
+		return false
+	}
+	if m.MinSize > 0 && (input.Size < 0 || input.Size < m.MinSize) {
+		return false
+	}
+	if m.MaxSize > 0 && (input.Size < 0 || input.Size > m.MaxSize) {
+		return false
+	}
+	for _, tag := range m.Tags {
+		if !slices.Contains(input.Tags, tag) {
+			return false
+		}
+	}
+	if m.Source != "" && !matchPattern(m.Source, input.Source) {
+		return false
+	}
+	for name, pattern := range m.Headers {
+		if !matchPattern(pattern, input.Headers.Get(name)) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchPattern(pattern, value string) bool {
+	matched, _ := path.Match(pattern, value)
+	return matched
+}
+
+// mediaType drops parameters such as "; charset=utf-8" from a content type
+func mediaType(contentType string) string {
+	for i, r := range contentType {
+		if r == ';' || r == ' ' {
+			return contentType[:i]
+		}
+	}
+	return contentType
+}
+
+// appendMissing appends the values not already in list
+func appendMissing(list []string, values ...string) []string {
+	for _, value := range values {
+		if !slices.Contains(list, value) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// SetRoutingRules has every upload evaluated against rules before it is processed
+func (s *DefaultPayloadService) SetRoutingRules(rules *RoutingRules) {
+	s.routes = rules
+}
+
+// SetRouter sends stored objects to the forward targets their upload lists in Notify
+func (s *DefaultPayloadService) SetRouter(router PayloadRouter) {
+	s.router = router
+}
+
+// applyRoutes merges the actions of the routing rules an upload matches into its
+// options, and returns the prefix for its generated request ID. Uploads a rule drops
+// return ErrPayloadDropped.
+func (s *DefaultPayloadService) applyRoutes(opts StoreOptions, contentType string, size int64) (StoreOptions, string, error) {
+	if s.routes == nil {
+		return opts, "", nil
+	}
+	decision := s.routes.Route(routeInput(opts, contentType, size))
+	if decision.Drop {
+		return opts, "", fmt.Errorf("%w by routing rule %s", ErrPayloadDropped, decision.Rules[len(decision.Rules)-1])
+	}
+	if len(decision.Rules) == 0 {
+		return opts, "", nil
+	}
+	opts.Tags = appendMissing(slices.Clone(opts.Tags), decision.Tags...)
+	opts.Notify = appendMissing(slices.Clone(opts.Notify), decision.Notify...)
+	opts.Extract = opts.Extract || decision.Extract
+	opts.Decompress = opts.Decompress || decision.Decompress
+	if decision.TTL > 0 && opts.ExpiresAt.IsZero() {
+		opts.ExpiresAt = time.Now().Add(decision.TTL).UTC().Truncate(time.Second)
+	}
+	return opts, decision.Prefix, nil
+}
+
+// routesNeedBody reports whether the routing rules turn on a stage that needs the
+// whole body of a streamed upload
+func (s *DefaultPayloadService) routesNeedBody(opts StoreOptions, contentType string) bool {
+	if s.routes == nil {
+		return false
+	}
+	decision := s.routes.Match(routeInput(opts, contentType, -1))
+	return !decision.Drop && s.needsBody(StoreOptions{Extract: decision.Extract, Decompress: decision.Decompress})
+}
+
+func routeInput(opts StoreOptions, contentType string, size int64) RouteInput {
+	return RouteInput{
+		ContentType: contentType,
+		Size:        size,
+		Tags:        opts.Tags,
+		Source:      opts.Source,
+		Headers:     opts.Headers,
+	}
+}
+
+// newRequestID generates a request ID, starting with prefix when one is given
+func (s *DefaultPayloadService) newRequestID(prefix string) string {
+	if prefix == "" {
+		return s.idGenerator.Generate()
+	}
+	return prefix + "-" + s.idGenerator.Generate()
+}
+
+// notifyTargets forwards a stored object to the targets its upload's rules listed
+func (s *DefaultPayloadService) notifyTargets(record ObjectRecord, targets []string) {
+	if s.router == nil {
+		return
+	}
+	for _, target := range targets {
+		if err := s.router.ForwardTo(record, target); err != nil {
+			log.Printf("Error notifying %s of %s: %v", target, record.ObjectName, err)
+		}
+	}
+}
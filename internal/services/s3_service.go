@@ -0,0 +1,54 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/config"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Service stores payloads in AWS S3. S3 speaks the same API as MinIO, so it shares
+// MinioService's client and every optional capability, including object lock and
+// bucket provisioning; only the connection settings differ.
+type S3Service struct {
+	*MinioService
+}
+
+// NewS3Service connects to S3 and creates the bucket in the configured region if it
+// does not exist. Without static keys, credentials come from the standard AWS
+// environment variables, the shared credentials file, or the instance's IAM role.
+func NewS3Service(cfg *config.Config) (*S3Service, error) {
+	if cfg.S3Bucket == "" {
+		return nil, fmt.Errorf("S3_BUCKET is required for the s3 storage backend")
+	}
+	client, err := minio.New(cfg.S3Endpoint, &minio.Options{
+		Creds:  s3Credentials(cfg),
+		Secure: cfg.S3UseSSL,
+		Region: cfg.S3Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize S3 client: %v", err)
+	}
+	service, err := newMinioServiceWithClient(cfg, client, cfg.S3Bucket, cfg.S3Region)
+	if err != nil {
+		return nil, err
+	}
+	if err := service.ensureBucket(); err != nil {
+		return nil, fmt.Errorf("failed to ensure S3 bucket exists: %v", err)
+	}
+	return &S3Service{MinioService: service}, nil
+}
+
+// s3Credentials uses the configured keys and session token, or else the AWS
+// credential chain
+func s3Credentials(cfg *config.Config) *credentials.Credentials {
+	if cfg.S3AccessKeyID != "" {
+		return credentials.NewStaticV4(cfg.S3AccessKeyID, cfg.S3SecretAccessKey, cfg.S3SessionToken)
+	}
+	return credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.FileAWSCredentials{},
+		&credentials.IAM{},
+	})
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrSaveQueueFull is returned when an asynchronous upload finds no room in the save queue
+var ErrSaveQueueFull = errors.New("save queue is full, retry later")
+
+// savePool runs asynchronous saves on a fixed number of workers. Every save holds a
+// slot from the moment it is accepted until it is saved, so slots bound both the
+// queue and the memory held by payloads waiting in it.
+type savePool struct {
+	slots chan struct{}
+	jobs  chan func()
+	wait  time.Duration
+}
+
+// newSavePool starts workers goroutines saving up to queueSize queued uploads
+func newSavePool(workers, queueSize int, wait time.Duration) *savePool {
+	p := &savePool{
+		slots: make(chan struct{}, workers+queueSize),
+		jobs:  make(chan func(), workers+queueSize),
+		wait:  wait,
+	}
+	for range workers {
+		go func() {
+			for job := range p.jobs {
+				job()
+				<-p.slots
+			}
+		}()
+	}
+	return p
+}
+
+// acquire takes a slot for a save, waiting up to the pool's wait for one to free up
+func (p *savePool) acquire() error {
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if p.wait <= 0 {
+		return ErrSaveQueueFull
+	}
+	timer := time.NewTimer(p.wait)
+	defer timer.Stop()
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrSaveQueueFull
+	}
+}
+
+// run queues a save that holds a slot; the queue has room for every slot, so it never blocks
+func (p *savePool) run(job func()) {
+	p.jobs <- job
+}
+
+// SetSaveWorkers saves asynchronous uploads on a pool of workers instead of a goroutine
+// each, queueing up to queueSize of them. An upload finding the queue full waits up
+// to wait for room, then fails with ErrSaveQueueFull. Call it before serving uploads.
+func (s *DefaultPayloadService) SetSaveWorkers(workers, queueSize int, wait time.Duration) {
+	if workers <= 0 {
+		s.savePool = nil
+		return
+	}
+	s.savePool = newSavePool(workers, max(queueSize, 0), wait)
+}
+
+// beginAsyncSave counts an asynchronous save in flight and takes its place in the
+// save queue. It returns false, for the upload to be saved synchronously, once
+// shutdown is draining saves.
+func (s *DefaultPayloadService) beginAsyncSave() (bool, error) {
+	s.savesMu.Lock()
+	if s.draining {
+		s.savesMu.Unlock()
+		return false, nil
+	}
+	s.saves.Add(1)
+	s.savesMu.Unlock()
+
+	if s.savePool != nil {
+		if err := s.savePool.acquire(); err != nil {
+			s.saves.Done()
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// runAsyncSave runs a save begun by beginAsyncSave on the pool, or on its own goroutine
+func (s *DefaultPayloadService) runAsyncSave(save func()) {
+	job := func() {
+		defer s.saves.Done()
+		save()
+	}
+	if s.savePool != nil {
+		s.savePool.run(job)
+		return
+	}
+	go job()
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Ingesters that block until a payload is saved store it again when saving takes
+// longer than streamSaveTimeout, after streamRetryDelay
+const (
+	streamSaveTimeout = time.Minute
+	streamRetryDelay  = 5 * time.Second
+)
+
+// saveWaiter runs a callback once every object of an upload has been saved.
+// StorePayload returns before objects reach storage, so ingesters that remove their
+// source copy register as a StoreObserver and wait for it.
+type saveWaiter struct {
+	mu       sync.Mutex
+	saves    map[string]*pendingSave
+	awaiting map[string]string
+	// early holds objects saved before wait was called for their upload, as the
+	// background save can finish before StorePayload returns. Saves are only
+	// remembered while one of the waiter's stores is in flight, and forgotten once
+	// none is, so other uploads do not accumulate here.
+	early   map[string]bool
+	storing int
+}
+
+// pendingSave is an upload with objects left to save
+type pendingSave struct {
+	remaining int
+	startedAt time.Time
+	onSaved   func(record ObjectRecord)
+}
+
+func newSaveWaiter() *saveWaiter {
+	return &saveWaiter{
+		saves:    make(map[string]*pendingSave),
+		awaiting: make(map[string]string),
+		early:    make(map[string]bool),
+	}
+}
+
+// wait waits for the objects of result under key. onSaved receives the record of
+// the last object saved, and runs at once when the upload produced no objects.
+func (w *saveWaiter) wait(key string, result *StoreResult, onSaved func(record ObjectRecord)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	upload := &pendingSave{startedAt: time.Now(), onSaved: onSaved}
+	for _, object := range result.Objects {
+		if w.early[object.ObjectName] {
+			delete(w.early, object.ObjectName)
+			continue
+		}
+		upload.remaining++
+		w.awaiting[object.ObjectName] = key
+	}
+	if upload.remaining == 0 {
+		go onSaved(ObjectRecord{RequestID: result.RequestID})
+		return
+	}
+	w.saves[key] = upload
+}
+
+// begin marks a StorePayload call in flight whose upload will be waited for; end
+// must follow once wait was called for it, or the call failed
+func (w *saveWaiter) begin() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.storing++
+}
+
+// end pairs begin; with no store left in flight, every remembered save belongs to
+// some other upload and is forgotten
+func (w *saveWaiter) end() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.storing--; w.storing == 0 {
+		clear(w.early)
+	}
+}
+
+// cancel stops waiting for the upload under key
+func (w *saveWaiter) cancel(key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.saves, key)
+	for objectName, awaited := range w.awaiting {
+		if awaited == key {
+			delete(w.awaiting, objectName)
+		}
+	}
+}
+
+// storeAndWait stores a payload and blocks until its objects are saved, storing it
+// again under the same request ID when saving is too slow. It returns StorePayload's
+// error when the pipeline rejects the payload, and ctx's error once ctx is done.
+func (w *saveWaiter) storeAndWait(ctx context.Context, store PayloadService, data []byte, contentType, filename string, opts StoreOptions) (*StoreResult, error) {
+	for {
+		w.begin()
+		result, err := store.StorePayload(data, contentType, filename, opts)
+		if err != nil {
+			w.end()
+		}
+		// Messages wait out maintenance rather than being skipped
+		if errors.Is(err, ErrReadOnly) {
+			if !sleepContext(ctx, streamRetryDelay) {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		saved := make(chan struct{})
+		w.wait(result.RequestID, result, func(ObjectRecord) { close(saved) })
+		w.end()
+		select {
+		case <-saved:
+			return result, nil
+		case <-ctx.Done():
+			w.cancel(result.RequestID)
+			return nil, ctx.Err()
+		case <-time.After(streamSaveTimeout):
+			w.cancel(result.RequestID)
+			log.Printf("Request %s was not saved in time; storing it again", result.RequestID)
+		}
+		opts.RequestID = result.RequestID
+		if !sleepContext(ctx, streamRetryDelay) {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// sleepContext waits for d, returning false when ctx is cancelled first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// waiting reports whether the upload under key is still being saved
+func (w *saveWaiter) waiting(key string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.saves[key]
+	return ok
+}
+
+// expire stops waiting for uploads older than maxAge and returns their keys
+func (w *saveWaiter) expire(maxAge time.Duration) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var expired []string
+	for key, upload := range w.saves {
+		if time.Since(upload.startedAt) > maxAge {
+			expired = append(expired, key)
+			delete(w.saves, key)
+		}
+	}
+	for objectName, key := range w.awaiting {
+		if _, ok := w.saves[key]; !ok {
+			delete(w.awaiting, objectName)
+		}
+	}
+	return expired
+}
+
+// PayloadStored counts down the upload the object belongs to
+func (w *saveWaiter) PayloadStored(record ObjectRecord) {
+	w.mu.Lock()
+	key, ok := w.awaiting[record.ObjectName]
+	if !ok {
+		if w.storing > 0 {
+			w.early[record.ObjectName] = true
+		}
+		w.mu.Unlock()
+		return
+	}
+	delete(w.awaiting, record.ObjectName)
+	upload := w.saves[key]
+	if upload.remaining--; upload.remaining > 0 {
+		w.mu.Unlock()
+		return
+	}
+	delete(w.saves, key)
+	w.mu.Unlock()
+	upload.onSaved(record)
+}
+
+// PayloadDeleted is a no-op
+func (w *saveWaiter) PayloadDeleted(record ObjectRecord) {}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrJobRunning is returned when a job is triggered while its previous run is still going
+	ErrJobRunning = errors.New("job is already running")
+	// ErrUnknownJob is returned when running a job that was never added
+	ErrUnknownJob = errors.New("unknown job")
+)
+
+// JobFunc runs one maintenance job and returns a one-line summary of what it did
+type JobFunc func() (string, error)
+
+// JobStatus reports a scheduled job's configuration and its last run
+type JobStatus struct {
+	Name         string     `json:"name"`
+	Schedule     string     `json:"schedule"`
+	Enabled      bool       `json:"enabled"`
+	Running      bool       `json:"running"`
+	NextRun      *time.Time `json:"next_run,omitempty"`
+	LastStarted  *time.Time `json:"last_started,omitempty"`
+	LastDuration string     `json:"last_duration,omitempty"`
+	LastResult   string     `json:"last_result,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	Runs         int        `json:"runs"`
+	Failures     int        `json:"failures"`
+	// Skipped counts runs that were due while the previous run was still going
+	Skipped int `json:"skipped"`
+}
+
+// Scheduler runs maintenance jobs on cron schedules. A job never overlaps itself:
+// a run that falls due while the previous one is still going is skipped.
+type Scheduler struct {
+	mu      sync.Mutex
+	jobs    map[string]*scheduledJob
+	started bool
+}
+
+type scheduledJob struct {
+	schedule *CronSchedule
+	run      JobFunc
+	status   JobStatus
+}
+
+// NewScheduler creates an empty scheduler
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		jobs: make(map[string]*scheduledJob),
+	}
+}
+
+// Add registers a job under a cron schedule. Disabled jobs are listed in Status but
+// never run on their schedule.
+func (s *Scheduler) Add(name, spec string, enabled bool, run JobFunc) error {
+	schedule, err := ParseCronSchedule(spec)
+	if err != nil {
+		return fmt.Errorf("job %s: %v", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.jobs[name]; exists {
+		return fmt.Errorf("job %s is already scheduled", name)
+	}
+	job := &scheduledJob{
+		schedule: schedule,
+		run:      run,
+		status:   JobStatus{Name: name, Schedule: schedule.String(), Enabled: enabled},
+	}
+	s.jobs[name] = job
+	if s.started && enabled {
+		go s.loop(job)
+	}
+	return nil
+}
+
+// Start runs every enabled job on its schedule in the background
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	for _, job := range s.jobs {
+		if job.status.Enabled {
+			go s.loop(job)
+		}
+	}
+}
+
+func (s *Scheduler) loop(job *scheduledJob) {
+	for {
+		next := job.schedule.Next(time.Now())
+		s.mu.Lock()
+		job.status.NextRun = &next
+		s.mu.Unlock()
+
+		time.Sleep(time.Until(next))
+		// Run in the background so a slow run cannot delay the schedule; the next
+		// tick then finds it running and is skipped
+		go func() {
+			if err := s.execute(job); errors.Is(err, ErrJobRunning) {
+				log.Printf("Skipping job %s: previous run still in progress", job.status.Name)
+			}
+		}()
+	}
+}
+
+// RunJob runs a job immediately, whether or not it is enabled, and waits for it to finish
+func (s *Scheduler) RunJob(name string) error {
+	s.mu.Lock()
+	job, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownJob, name)
+	}
+	return s.execute(job)
+}
+
+func (s *Scheduler) execute(job *scheduledJob) error {
+	s.mu.Lock()
+	if job.status.Running {
+		job.status.Skipped++
+		s.mu.Unlock()
+		return ErrJobRunning
+	}
+	started := time.Now().UTC()
+	job.status.Running = true
+	job.status.LastStarted = &started
+	s.mu.Unlock()
+
+	result, err := job.run()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.status.Running = false
+	job.status.Runs++
+	job.status.LastDuration = time.Since(started).Round(time.Millisecond).String()
+	job.status.LastResult = result
+	job.status.LastError = ""
+	if err != nil {
+		job.status.Failures++
+		job.status.LastError = err.Error()
+		log.Printf("Job %s failed: %v", job.status.Name, err)
+	} else if result != "" {
+		log.Printf("Job %s: %s", job.status.Name, result)
+	}
+	return err
+}
+
+// Status reports every job, sorted by name
+func (s *Scheduler) Status() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		statuses = append(statuses, job.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+)
+
+// Scrubber re-reads stored payloads and compares them with their indexed checksums,
+// catching objects that were corrupted or lost behind the depot's back
+type Scrubber struct {
+	storage StorageService
+	index   MetadataIndex
+}
+
+// NewScrubber creates a scrubber that verifies the hot objects of an index
+func NewScrubber(storage StorageService, index MetadataIndex) *Scrubber {
+	return &Scrubber{
+		storage: storage,
+		index:   index,
+	}
+}
+
+// Scrub verifies every hot object that has a checksum, failing when any is unreadable
+// or does not match
+func (s *Scrubber) Scrub() (string, error) {
+	checked := 0
+	var bad []string
+
+	for _, record := range s.index.List() {
+		if record.StorageTier == StorageTierArchive || record.SHA256 == "" {
+			continue
+		}
+		checked++
+		data, err := s.storage.GetPayload(record.ObjectName)
+		if err != nil {
+			log.Printf("Scrub could not read %s: %v", record.ObjectName, err)
+			bad = append(bad, record.ObjectName)
+			continue
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != record.SHA256 {
+			log.Printf("Scrub found a checksum mismatch in %s", record.ObjectName)
+			bad = append(bad, record.ObjectName)
+		}
+	}
+
+	summary := fmt.Sprintf("verified %d object(s), %d bad", checked, len(bad))
+	if len(bad) > 0 {
+		return summary, fmt.Errorf("unreadable or corrupt objects: %v", bad)
+	}
+	return summary, nil
+}
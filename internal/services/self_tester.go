@@ -0,0 +1,174 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SelfTestTag marks probe objects so observers such as the forwarder can skip them
+const SelfTestTag = "selftest"
+
+// Self-test stages, in the order they run
+const (
+	SelfTestStageStore   = "store"
+	SelfTestStagePersist = "persist"
+	SelfTestStageRead    = "read"
+	SelfTestStageVerify  = "verify"
+	SelfTestStageDelete  = "delete"
+)
+
+// SelfTestStage reports the outcome and latency of one self-test stage
+type SelfTestStage struct {
+	Name      string  `json:"name"`
+	OK        bool    `json:"ok"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// SelfTestReport is the result of a full self-test run
+type SelfTestReport struct {
+	OK         bool            `json:"ok"`
+	RequestID  string          `json:"request_id,omitempty"`
+	ObjectName string          `json:"object_name,omitempty"`
+	Stages     []SelfTestStage `json:"stages"`
+	TotalMS    float64         `json:"total_ms"`
+}
+
+// SelfTester writes, reads back, verifies and deletes a probe object through the
+// payload service. It must be registered as an observer to learn when the
+// asynchronous write has landed.
+type SelfTester struct {
+	payloads PayloadService
+	remover  ObjectRemover
+	timeout  time.Duration
+
+	mu      sync.Mutex
+	waiting map[string]chan ObjectRecord
+}
+
+// NewSelfTester creates a self-tester that waits up to timeout for the probe to be stored
+func NewSelfTester(payloads PayloadService, remover ObjectRemover, timeout time.Duration) *SelfTester {
+	return &SelfTester{
+		payloads: payloads,
+		remover:  remover,
+		timeout:  timeout,
+		waiting:  make(map[string]chan ObjectRecord),
+	}
+}
+
+// PayloadStored releases a run waiting for its probe object
+func (t *SelfTester) PayloadStored(record ObjectRecord) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ch, ok := t.waiting[record.ObjectName]; ok {
+		ch <- record
+		delete(t.waiting, record.ObjectName)
+	}
+}
+
+// PayloadDeleted is a no-op
+func (t *SelfTester) PayloadDeleted(record ObjectRecord) {}
+
+// Run performs one self-test, stopping at the first failed stage. The probe is
+// deleted whenever it was stored, even if a later stage failed.
+func (t *SelfTester) Run() (report SelfTestReport) {
+	start := time.Now()
+	report.Stages = []SelfTestStage{}
+	stage := func(name string, fn func() error) bool {
+		began := time.Now()
+		err := fn()
+		result := SelfTestStage{Name: name, OK: err == nil, LatencyMS: milliseconds(time.Since(began))}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		report.Stages = append(report.Stages, result)
+		return err == nil
+	}
+	defer func() {
+		report.TotalMS = milliseconds(time.Since(start))
+	}()
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	probe := []byte("simple-depot self-test " + hex.EncodeToString(nonce))
+
+	var stored chan ObjectRecord
+	var record ObjectRecord
+	ok := stage(SelfTestStageStore, func() error {
+		// Register before storing so the asynchronous write cannot be missed
+		stored = make(chan ObjectRecord, 1)
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		result, err := t.payloads.StorePayload(probe, "text/plain", "selftest.txt", StoreOptions{Tags: []string{SelfTestTag}})
+		if err != nil {
+			return err
+		}
+		if len(result.Objects) != 1 {
+			return fmt.Errorf("expected 1 probe object, got %d", len(result.Objects))
+		}
+		report.RequestID = result.RequestID
+		report.ObjectName = result.Objects[0].ObjectName
+		t.waiting[report.ObjectName] = stored
+		return nil
+	})
+	if !ok {
+		return report
+	}
+
+	ok = stage(SelfTestStagePersist, func() error {
+		select {
+		case record = <-stored:
+			return nil
+		case <-time.After(t.timeout):
+			t.mu.Lock()
+			delete(t.waiting, report.ObjectName)
+			t.mu.Unlock()
+			return fmt.Errorf("probe not stored within %s", t.timeout)
+		}
+	})
+	if !ok {
+		return report
+	}
+	defer func() {
+		deleted := stage(SelfTestStageDelete, func() error {
+			return t.remover.RemoveObject(record)
+		})
+		report.OK = report.OK && deleted
+	}()
+
+	var data []byte
+	ok = stage(SelfTestStageRead, func() error {
+		response, err := t.payloads.RetrievePayloads(report.RequestID, true)
+		if err != nil {
+			return err
+		}
+		file, isMap := response.(map[string]interface{})
+		if !isMap {
+			return errors.New("unexpected response for the probe request")
+		}
+		if data, isMap = file["data"].([]byte); !isMap {
+			return errors.New("probe response carries no data")
+		}
+		return nil
+	})
+	if !ok {
+		return report
+	}
+
+	report.OK = stage(SelfTestStageVerify, func() error {
+		if !bytes.Equal(data, probe) {
+			return fmt.Errorf("read back %d byte(s) that differ from the %d-byte probe", len(data), len(probe))
+		}
+		return nil
+	})
+	return report
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+// MetadataSensitiveData records what a payload likely contains that is secret or
+// personal, as "<kind>=<count>,..."
+const MetadataSensitiveData = "Sensitive-Data"
+
+// sensitivePatterns are the kinds of secrets and personal data the detector knows
+var sensitivePatterns = map[string]*regexp.Regexp{
+	"aws_access_key": regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	"github_token":   regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`),
+	"slack_token":    regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),
+	"stripe_key":     regexp.MustCompile(`\b[sr]k_live_[A-Za-z0-9]{16,}`),
+	"private_key":    regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )*PRIVATE KEY-----`),
+	"jwt":            regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{10,}`),
+	RedactEmail:      builtinRedactions[RedactEmail],
+	RedactCardNumber: builtinRedactions[RedactCardNumber],
+}
+
+// SensitiveDataKinds lists the kinds of data the detector can flag
+func SensitiveDataKinds() []string {
+	kinds := make([]string, 0, len(sensitivePatterns))
+	for kind := range sensitivePatterns {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// SensitiveStats counts the payloads flagged since startup and the findings per kind
+type SensitiveStats struct {
+	Flagged  int64            `json:"flagged"`
+	Findings map[string]int64 `json:"findings"`
+}
+
+// SensitiveDetector flags payloads that likely contain secrets or personal data. It
+// only reports what it finds; redaction is separate. Binary payloads are not scanned.
+type SensitiveDetector struct {
+	kinds []string
+
+	mu       sync.Mutex
+	flagged  int64
+	findings map[string]int64
+}
+
+// NewSensitiveDetector creates a detector for the given kinds, or every kind when
+// kinds is "all"
+func NewSensitiveDetector(kinds []string) (*SensitiveDetector, error) {
+	if len(kinds) == 1 && kinds[0] == "all" {
+		kinds = SensitiveDataKinds()
+	}
+	for _, kind := range kinds {
+		if sensitivePatterns[kind] == nil {
+			return nil, fmt.Errorf("unknown sensitive data kind %q; known kinds are %v", kind, SensitiveDataKinds())
+		}
+	}
+	return &SensitiveDetector{
+		kinds:    kinds,
+		findings: make(map[string]int64),
+	}, nil
+}
+
+// Detect scans a payload, recording what it found in the payload's metadata
+func (d *SensitiveDetector) Detect(payload ProcessedPayload) (ProcessedPayload, map[string]int) {
+	if !utf8.Valid(payload.Data) {
+		return payload, nil
+	}
+	found := make(map[string]int)
+	for _, kind := range d.kinds {
+		for _, match := range sensitivePatterns[kind].FindAll(payload.Data, -1) {
+			if kind == RedactCardNumber && !validLuhn(string(match)) {
+				continue
+			}
+			found[kind]++
+		}
+	}
+	if len(found) == 0 {
+		return payload, nil
+	}
+
+	d.mu.Lock()
+	d.flagged++
+	for kind, count := range found {
+		d.findings[kind] += int64(count)
+	}
+	d.mu.Unlock()
+
+	metadata := make(map[string]string, len(payload.Metadata)+1)
+	for key, value := range payload.Metadata {
+		metadata[key] = value
+	}
+	metadata[MetadataSensitiveData] = formatCounts(found)
+	payload.Metadata = metadata
+	return payload, found
+}
+
+// Stats reports the payloads flagged so far
+func (d *SensitiveDetector) Stats() SensitiveStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats := SensitiveStats{Flagged: d.flagged, Findings: make(map[string]int64, len(d.findings))}
+	for kind, count := range d.findings {
+		stats.Findings[kind] = count
+	}
+	return stats
+}
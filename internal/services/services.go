@@ -1,5 +1,12 @@
 package services
 
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
 // PayloadProcessor handles processing different types of payloads
 type PayloadProcessor interface {
 	Process(requestID string, data []byte, contentType string, filename string) ([]ProcessedPayload, error)
@@ -11,6 +18,9 @@ type ProcessedPayload struct {
 	Data        []byte
 	ContentType string
 	Filename    string
+	SHA256      string
+	// Metadata holds extra object metadata written alongside the payload
+	Metadata map[string]string
 }
 
 // IDGenerator generates unique identifiers
@@ -32,10 +42,12 @@ type FilenameExtractor interface {
 
 // ResponseFormatter formats HTTP responses
 type ResponseFormatter interface {
-	FormatDepotResponse(requestID string, size int, timestamp string, filename string) map[string]any
+	FormatDepotResponse(result *StoreResult, size int, timestamp string, filename string) map[string]any
 	FormatGetResponse(requestID string, files []FileInfo, count int) map[string]any
-	FormatListResponse(objects []string, count int) map[string]any
+	FormatListResponse(objects []ObjectInfo, count int) map[string]any
 	FormatFileInfo(objectName, originalFilename string, data []byte, contentType string) FileInfo
+	FormatFindResponse(sha256 string, records []ObjectRecord) map[string]any
+	FormatChangesResponse(events []ChangeEvent, nextCursor int64, truncated bool) map[string]any
 }
 
 // FileInfo represents file information for responses
@@ -45,6 +57,9 @@ type FileInfo struct {
 	Size             int    `json:"size"`
 	ContentType      string `json:"content_type"`
 	PayloadBase64    string `json:"payload_base64"`
+	// Headers and Query are the stored request headers and query string of the upload
+	Headers http.Header `json:"headers,omitempty"`
+	Query   string      `json:"query,omitempty"`
 }
 
 // ZipService handles creating zip archives
@@ -52,9 +67,481 @@ type ZipService interface {
 	CreateZip(files []FileInfo) ([]byte, error)
 }
 
+// StreamingZipService writes zip archives straight to a writer, entry by entry
+type StreamingZipService interface {
+	WriteZip(w io.Writer, entries []ZipEntry) error
+}
+
+// EncryptedZipService creates password-protected zip archives
+type EncryptedZipService interface {
+	CreateEncryptedZip(files []FileInfo, password string) ([]byte, error)
+}
+
+// EncryptedZipRetriever returns all payloads of a request as a password-protected zip
+type EncryptedZipRetriever interface {
+	RetrieveEncryptedZip(ctx context.Context, requestID, password string) (map[string]interface{}, error)
+}
+
+// PayloadPage selects part of a request's payloads for an inline JSON response.
+// Limit 0 returns every payload, and MaxInlineBytes 0 does not cap the response.
+type PayloadPage struct {
+	Offset         int
+	Limit          int
+	MaxInlineBytes int64
+}
+
+// PayloadPageRetriever returns a request's payloads a page at a time
+type PayloadPageRetriever interface {
+	RetrievePayloadPage(ctx context.Context, requestID string, page PayloadPage) (map[string]any, error)
+}
+
+// RawDownload is a raw download of a request's payloads, streamed from storage
+type RawDownload struct {
+	Filename    string
+	ContentType string
+	// Size is the length of a single-file download, or -1 for a zip
+	Size int64
+	// ContentEncoding is the coding of an object stored compressed as sent
+	ContentEncoding string
+	// Write streams the download to w
+	Write func(w io.Writer) error
+}
+
+// RawStreamer streams raw downloads without holding the payloads in memory
+type RawStreamer interface {
+	StreamRawPayloads(requestID string) (*RawDownload, error)
+}
+
+// ObjectDownloader downloads a single stored object by its name
+type ObjectDownloader interface {
+	DownloadObject(objectName string) (*RawDownload, error)
+}
+
+// PayloadStatReader describes stored objects without returning their data
+type PayloadStatReader interface {
+	StatObject(objectName string) (*ObjectStat, error)
+	StatPayloads(requestID string) ([]ObjectStat, error)
+}
+
+// RequestDeleter removes every payload of a request, returning the objects removed
+type RequestDeleter interface {
+	DeleteRequest(ctx context.Context, requestID string) ([]string, error)
+}
+
+// StoreOptions carries optional per-upload settings supplied by the client
+type StoreOptions struct {
+	Tags        []string
+	CallbackURL string
+	// Extract unpacks zip archives into one object per entry
+	Extract bool
+	// Decompress also stores a decompressed copy of gzip single-file uploads
+	Decompress      bool
+	ContentEncoding string
+	// RequestID is a client-chosen request ID; one is generated when empty
+	RequestID string
+	// ObjectPrefix is a slash-separated path, such as "github/owner/repo/push/", put
+	// in front of the name of every object of the upload
+	ObjectPrefix string
+	// IfNoneMatch refuses the upload when the request ID already has stored objects
+	IfNoneMatch bool
+	// Progress receives storage progress of streamed uploads
+	Progress UploadProgressFunc
+	// Metadata is extra object metadata saved with every object of the upload; it
+	// cannot override the depot's own keys
+	Metadata map[string]string
+	// Source is the route or ingester the upload came through, and Headers the request
+	// headers of HTTP uploads; routing rules match on both
+	Source  string
+	Headers http.Header
+	// SourceIP is the client address of HTTP uploads, kept in the request log
+	SourceIP string
+	// Query is the raw query string of HTTP uploads, stored with their payloads
+	Query string
+	// Notify lists forward targets every stored object of the upload is sent to
+	Notify []string
+	// ExpiresAt has the retention job remove the upload's objects once it has passed
+	ExpiresAt time.Time
+	// Sync waits for every object to be saved before StorePayload returns, so storage
+	// failures are reported to the caller instead of only being logged
+	Sync bool
+	// Tenant scopes the upload: its request ID, chosen or generated, starts with the
+	// tenant's prefix
+	Tenant string
+	// Context carries the trace of the request the upload came in on, so processing
+	// and storage are traced under it; nil starts a new trace. Synchronous saves end
+	// when it is cancelled; asynchronous ones outlive the request.
+	Context context.Context
+}
+
+// PayloadDecompressor expands compressed uploads into an original and a decompressed payload
+type PayloadDecompressor interface {
+	IsCompressed(payload ProcessedPayload, contentEncoding string) bool
+	Decompress(payload ProcessedPayload) ([]ProcessedPayload, error)
+}
+
+// PayloadRedactor removes personal data from a payload before it is stored, reporting
+// how often each of its rules fired
+type PayloadRedactor interface {
+	Redact(payload ProcessedPayload) (ProcessedPayload, map[string]int)
+}
+
+// SensitiveDataDetector flags payloads that likely hold secrets or personal data,
+// reporting how often it found each kind
+type SensitiveDataDetector interface {
+	Detect(payload ProcessedPayload) (ProcessedPayload, map[string]int)
+}
+
+// PayloadScripter runs deployment-specific scripts that validate and transform each
+// payload of an upload before it is stored
+type PayloadScripter interface {
+	Validate(requestID string, payload ProcessedPayload, tags []string) error
+	Transform(requestID string, payload ProcessedPayload, tags []string) (ProcessedPayload, error)
+}
+
+// AdmissionInput describes an upload to an admission policy before its body is read
+type AdmissionInput struct {
+	Route       string   `json:"route"`
+	Method      string   `json:"method"`
+	SourceIP    string   `json:"source_ip"`
+	ForwardedIP []string `json:"forwarded_for"`
+	ContentType string   `json:"content_type"`
+	// Size is the declared Content-Length, or -1 for a body of unknown length
+	Size      int64             `json:"size"`
+	Filename  string            `json:"filename"`
+	RequestID string            `json:"request_id"`
+	Tags      []string          `json:"tags"`
+	Headers   map[string]string `json:"headers"`
+	Time      AdmissionTime     `json:"time"`
+}
+
+// AdmissionTime is the upload's arrival time in the server's time zone
+type AdmissionTime struct {
+	RFC3339 string `json:"rfc3339"`
+	Unix    int64  `json:"unix"`
+	Hour    int    `json:"hour"`
+	Minute  int    `json:"minute"`
+	Weekday string `json:"weekday"`
+}
+
+// AdmissionDecision is a policy's verdict on an upload, with its reasons for a rejection
+type AdmissionDecision struct {
+	Allowed bool     `json:"allowed"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// AdmissionPolicy decides whether an upload is accepted
+type AdmissionPolicy interface {
+	Evaluate(input AdmissionInput) (AdmissionDecision, error)
+}
+
+// PayloadRouter forwards a stored payload to a named target
+type PayloadRouter interface {
+	ForwardTo(record ObjectRecord, targetName string) error
+}
+
+// ArchiveExtractor unpacks uploaded archives into individual payloads
+type ArchiveExtractor interface {
+	IsArchive(payload ProcessedPayload) bool
+	Extract(requestID string, data []byte) ([]ProcessedPayload, error)
+}
+
+// StoredObject describes one object created for an upload
+type StoredObject struct {
+	ObjectName       string `json:"object_name"`
+	OriginalFilename string `json:"original_filename,omitempty"`
+	ContentType      string `json:"content_type"`
+	Size             int    `json:"size"`
+	SHA256           string `json:"sha256"`
+}
+
+// StoreResult describes the objects created for an accepted upload
+type StoreResult struct {
+	RequestID string
+	Objects   []StoredObject
+}
+
 // PayloadService orchestrates payload operations
 type PayloadService interface {
-	StorePayload(data []byte, contentType string, filename string) (string, error)
+	StorePayload(data []byte, contentType string, filename string, opts StoreOptions) (*StoreResult, error)
 	RetrievePayloads(requestID string, raw bool) (interface{}, error)
 	ListAllPayloads() ([]string, error)
 }
+
+// ContextRetriever is implemented by payload services that can bind retrievals and
+// listings to a context, so storage gives up once the request they serve has ended
+type ContextRetriever interface {
+	RetrievePayloadsContext(ctx context.Context, requestID string, raw bool) (interface{}, error)
+	ListAllPayloadsContext(ctx context.Context) ([]string, error)
+}
+
+// ObjectRecord describes a stored object tracked by the metadata index
+type ObjectRecord struct {
+	RequestID        string    `json:"request_id"`
+	ObjectName       string    `json:"object_name"`
+	OriginalFilename string    `json:"original_filename,omitempty"`
+	ContentType      string    `json:"content_type"`
+	Size             int       `json:"size"`
+	SHA256           string    `json:"sha256"`
+	Tags             []string  `json:"tags,omitempty"`
+	StorageTier      string    `json:"storage_tier,omitempty"`
+	StoredAt         time.Time `json:"stored_at"`
+	// ExpiresAt is when the retention job removes the object, if it expires
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// RestoredAt is when the object was last brought back from the archive; it ages
+	// from then rather than from StoredAt
+	RestoredAt *time.Time `json:"restored_at,omitempty"`
+}
+
+// RequestObject is one object of a logged request and whether it reached storage
+type RequestObject struct {
+	StoredObject
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+// RequestRecord describes an accepted upload: when and where it came from, the
+// headers it was sent with, and the storage state of its objects
+type RequestRecord struct {
+	RequestID  string            `json:"request_id"`
+	ReceivedAt time.Time         `json:"received_at"`
+	Source     string            `json:"source,omitempty"`
+	SourceIP   string            `json:"source_ip,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	State      string            `json:"state"`
+	Objects    []RequestObject   `json:"objects"`
+}
+
+// RequestLog keeps a durable record of every accepted upload, so requests can be
+// looked up without decoding object names
+type RequestLog interface {
+	// RequestAccepted records an upload whose objects are about to be saved; later
+	// uploads under the same request ID add their objects to it
+	RequestAccepted(record RequestRecord)
+	// ObjectSaved records the outcome of saving one object; err is nil when it was stored
+	ObjectSaved(requestID string, object StoredObject, err error)
+	GetRequest(requestID string) (RequestRecord, bool)
+	// ListRequests returns the most recent requests whose ID starts with prefix,
+	// newest first
+	ListRequests(prefix string, limit int) []RequestRecord
+}
+
+// StoreObserver is notified when payloads are written to or removed from storage
+type StoreObserver interface {
+	PayloadStored(record ObjectRecord)
+	PayloadDeleted(record ObjectRecord)
+}
+
+// TierObserver is implemented by observers that follow objects between storage tiers;
+// the record carries the object's new StorageTier
+type TierObserver interface {
+	PayloadTiered(record ObjectRecord)
+}
+
+// TierNotifier announces objects moved between storage tiers to observers
+type TierNotifier interface {
+	ObjectTiered(record ObjectRecord)
+}
+
+// MetadataIndex keeps searchable metadata about stored objects
+type MetadataIndex interface {
+	StoreObserver
+	Get(objectName string) (ObjectRecord, bool)
+	FindBySHA256(sha256 string) []ObjectRecord
+	List() []ObjectRecord
+	TotalSize() int64
+}
+
+// Change event types recorded in the changes feed
+const (
+	ChangeStored  = "stored"
+	ChangeDeleted = "deleted"
+	// ChangeArchived and ChangeRestored record moves between storage tiers
+	ChangeArchived = "archived"
+	ChangeRestored = "restored"
+)
+
+// ChangeEvent is one ordered entry in the changes feed
+type ChangeEvent struct {
+	Cursor int64        `json:"cursor"`
+	Type   string       `json:"type"`
+	Time   time.Time    `json:"time"`
+	Object ObjectRecord `json:"object"`
+}
+
+// ChangeFeed records storage changes and serves them by cursor or live subscription
+type ChangeFeed interface {
+	StoreObserver
+	Since(cursor int64, limit int) (events []ChangeEvent, nextCursor int64, truncated bool)
+	Cursor() int64
+	Subscribe() (events <-chan ChangeEvent, cancel func())
+}
+
+// PayloadPreview is a truncated view of a payload body
+type PayloadPreview struct {
+	Size      int    `json:"size"`
+	Truncated bool   `json:"truncated"`
+	Text      string `json:"text,omitempty"`
+	Base64    string `json:"base64,omitempty"`
+	Hexdump   string `json:"hexdump,omitempty"`
+}
+
+// HexdumpRow is one 16-byte line of a hexdump
+type HexdumpRow struct {
+	Offset int    `json:"offset"`
+	Hex    string `json:"hex"`
+	ASCII  string `json:"ascii"`
+}
+
+// HexdumpPreview is an offset/hex/ASCII view of part of a payload
+type HexdumpPreview struct {
+	Size      int          `json:"size"`
+	Offset    int          `json:"offset"`
+	Length    int          `json:"length"`
+	Truncated bool         `json:"truncated"`
+	Rows      []HexdumpRow `json:"rows"`
+	Text      string       `json:"text"`
+}
+
+// PayloadPreviewer builds previews of payload bodies
+type PayloadPreviewer interface {
+	Preview(data []byte, limit int) PayloadPreview
+	Hexdump(data []byte, offset, length int) HexdumpPreview
+}
+
+// JSONQueryEvaluator evaluates query expressions against JSON payloads
+type JSONQueryEvaluator interface {
+	Evaluate(data []byte, expr string) ([]any, error)
+}
+
+// Exporter writes selected JSON payloads as a tabular file
+type Exporter interface {
+	Export(w io.Writer, req ExportRequest) (int, error)
+}
+
+// ArchiveRestorer brings archived payloads back into primary storage on demand
+type ArchiveRestorer interface {
+	RestoreRequest(requestID string) (int, error)
+}
+
+// CompletionEvent reports the outcome of storing an upload to its callback URL
+type CompletionEvent struct {
+	Event     string         `json:"event"`
+	RequestID string         `json:"request_id"`
+	Status    string         `json:"status"`
+	Objects   []StoredObject `json:"objects"`
+	Failed    []string       `json:"failed,omitempty"`
+	Timestamp string         `json:"timestamp"`
+}
+
+// CallbackNotifier delivers completion events to per-upload callback URLs
+type CallbackNotifier interface {
+	Notify(callbackURL string, event CompletionEvent)
+}
+
+// CallbackURLChecker is implemented by notifiers that restrict where callbacks may go
+type CallbackURLChecker interface {
+	CheckCallbackURL(raw string) error
+}
+
+// Delivery outcomes reported for outbound requests
+const (
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// DeliveryResult reports the outcome of sending one object to a target
+type DeliveryResult struct {
+	ObjectName string `json:"object_name"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+}
+
+// DeliveryTracker runs outbound deliveries, records their attempts and re-drives failures
+type DeliveryTracker interface {
+	Run(delivery Delivery, executor *RetryExecutor, attempt func(ctx context.Context) error) error
+	RunOnce(delivery Delivery, executor *RetryExecutor, attempt func(ctx context.Context) error) error
+	List(status, kind string, limit int) []Delivery
+	Redrive(id string) error
+	RedriveFailed() int
+}
+
+// PayloadReplayer sends the stored objects of a request to a named target
+type PayloadReplayer interface {
+	Replay(requestID, target string) ([]DeliveryResult, error)
+}
+
+// LegalHoldManager places, releases and reports legal holds on the objects of a request
+type LegalHoldManager interface {
+	Place(requestID string) ([]LegalHoldStatus, error)
+	Release(requestID string) ([]LegalHoldStatus, error)
+	Status(requestID string) ([]LegalHoldStatus, error)
+}
+
+// RetentionManager extends and reports the retention of the objects of a request
+type RetentionManager interface {
+	Extend(requestID string, until time.Time) ([]RetentionStatus, error)
+	Status(requestID string) ([]RetentionStatus, error)
+}
+
+// DeletionGuard vetoes the removal of objects that must be kept, such as those under legal hold
+type DeletionGuard interface {
+	CheckDelete(objectName string) error
+}
+
+// DeletionGuards vetoes a removal when any of its guards does
+type DeletionGuards []DeletionGuard
+
+// CheckDelete returns the first veto among the guards
+func (g DeletionGuards) CheckDelete(objectName string) error {
+	for _, guard := range g {
+		if err := guard.CheckDelete(objectName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JobStatusReporter reports the scheduled maintenance jobs and their last runs
+type JobStatusReporter interface {
+	Status() []JobStatus
+}
+
+// StatsProvider returns the latest storage statistics rollup
+type StatsProvider interface {
+	Latest() StorageStats
+}
+
+// SensitiveStatsReporter counts the payloads flagged as holding sensitive data
+type SensitiveStatsReporter interface {
+	Stats() SensitiveStats
+}
+
+// DropCounter counts the uploads each routing rule dropped or sampled out
+type DropCounter interface {
+	Dropped() map[string]int64
+}
+
+// ObjectRemover deletes individual stored objects and notifies observers
+type ObjectRemover interface {
+	RemoveObject(record ObjectRecord) error
+}
+
+// PayloadStreamer stores uploads without buffering them; size is -1 when unknown
+type PayloadStreamer interface {
+	StorePayloadStream(body io.Reader, size int64, contentType string, filename string, opts StoreOptions) (*StoreResult, error)
+}
+
+// PayloadAppender extends the single object stored under a request ID
+type PayloadAppender interface {
+	AppendPayload(requestID string, data []byte, contentType string, filename string, opts StoreOptions) (*AppendResult, error)
+}
+
+// SelfTestRunner exercises the full store/read/delete pipeline with a probe object
+type SelfTestRunner interface {
+	Run() SelfTestReport
+}
+
+// MetadataRebuilder repopulates the metadata index from the storage backend
+type MetadataRebuilder interface {
+	Rebuild() (RebuildResult, error)
+}
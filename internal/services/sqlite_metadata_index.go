@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strings"
+
+	// Registers the "sqlite3" database/sql driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrations embed.FS
+
+const sqliteObjectColumns = "request_id, object_name, original_filename, content_type, size, sha256, tags, storage_tier, stored_at, expires_at, restored_at"
+
+// SQLiteMetadataIndex keeps object metadata and the request log in a SQLite file, so
+// a single depot keeps them across restarts without a database server
+type SQLiteMetadataIndex struct {
+	sqlRequestLog
+	db *sql.DB
+}
+
+// NewSQLiteMetadataIndex opens the database file at path, creating it when it does
+// not exist, and applies any pending migrations
+func NewSQLiteMetadataIndex(path string) (*SQLiteMetadataIndex, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	// SQLite allows one writer at a time; a single connection queues writes instead
+	// of failing them as busy
+	db.SetMaxOpenConns(1)
+
+	index := &SQLiteMetadataIndex{sqlRequestLog: sqlRequestLog{db: db}, db: db}
+	if err := index.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate SQLite metadata schema: %v", err)
+	}
+	return index, nil
+}
+
+// migrate applies embedded migrations that have not run yet, in file name order
+func (i *SQLiteMetadataIndex) migrate() error {
+	ctx := context.Background()
+	tx, err := i.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS depot_schema_migrations (
+		version    TEXT PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return err
+	}
+
+	names, err := fs.Glob(sqliteMigrations, "migrations/sqlite/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version := strings.TrimSuffix(name[strings.LastIndex(name, "/")+1:], ".sql")
+		var applied bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM depot_schema_migrations WHERE version = ?)", version).Scan(&applied); err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+
+		script, err := sqliteMigrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+			return fmt.Errorf("migration %s: %v", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO depot_schema_migrations (version) VALUES (?)", version); err != nil {
+			return err
+		}
+		log.Printf("Applied SQLite migration %s", version)
+	}
+
+	return tx.Commit()
+}
+
+// Close releases the database file
+func (i *SQLiteMetadataIndex) Close() error {
+	return i.db.Close()
+}
+
+// PayloadStored adds or replaces the record for a stored object
+func (i *SQLiteMetadataIndex) PayloadStored(record ObjectRecord) {
+	ctx, cancel := context.WithTimeout(context.Background(), sqlQueryTimeout)
+	defer cancel()
+
+	_, err := i.db.ExecContext(ctx, `INSERT INTO depot_objects (`+sqliteObjectColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (object_name) DO UPDATE SET
+			request_id = excluded.request_id,
+			original_filename = excluded.original_filename,
+			content_type = excluded.content_type,
+			size = excluded.size,
+			sha256 = excluded.sha256,
+			tags = excluded.tags,
+			storage_tier = excluded.storage_tier,
+			stored_at = excluded.stored_at,
+			expires_at = excluded.expires_at,
+			restored_at = excluded.restored_at`,
+		record.RequestID, record.ObjectName, record.OriginalFilename, record.ContentType,
+		record.Size, record.SHA256, strings.Join(record.Tags, ","), record.StorageTier, record.StoredAt.UTC(), record.ExpiresAt, record.RestoredAt)
+	if err != nil {
+		log.Printf("Error indexing %s in SQLite: %v", record.ObjectName, err)
+	}
+}
+
+// PayloadDeleted drops the record for a removed object
+func (i *SQLiteMetadataIndex) PayloadDeleted(record ObjectRecord) {
+	ctx, cancel := context.WithTimeout(context.Background(), sqlQueryTimeout)
+	defer cancel()
+
+	if _, err := i.db.ExecContext(ctx, "DELETE FROM depot_objects WHERE object_name = ?", record.ObjectName); err != nil {
+		log.Printf("Error removing %s from the SQLite index: %v", record.ObjectName, err)
+	}
+}
+
+// PayloadTiered updates the record of an object moved between storage tiers
+func (i *SQLiteMetadataIndex) PayloadTiered(record ObjectRecord) {
+	i.PayloadStored(record)
+}
+
+// Get returns the record for a single object
+func (i *SQLiteMetadataIndex) Get(objectName string) (ObjectRecord, bool) {
+	records := i.query("SELECT "+sqliteObjectColumns+" FROM depot_objects WHERE object_name = ?", objectName)
+	if len(records) == 0 {
+		return ObjectRecord{}, false
+	}
+	return records[0], true
+}
+
+// FindBySHA256 returns all objects whose content checksum matches, oldest first
+func (i *SQLiteMetadataIndex) FindBySHA256(sha256 string) []ObjectRecord {
+	return i.query("SELECT "+sqliteObjectColumns+" FROM depot_objects WHERE sha256 = ? ORDER BY stored_at, object_name", sha256)
+}
+
+// List returns every indexed record, oldest first
+func (i *SQLiteMetadataIndex) List() []ObjectRecord {
+	return i.query("SELECT " + sqliteObjectColumns + " FROM depot_objects ORDER BY stored_at, object_name")
+}
+
+// TotalSize returns the combined size in bytes of all indexed objects
+func (i *SQLiteMetadataIndex) TotalSize() int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), sqlQueryTimeout)
+	defer cancel()
+
+	var total int64
+	if err := i.db.QueryRowContext(ctx, "SELECT COALESCE(SUM(size), 0) FROM depot_objects").Scan(&total); err != nil {
+		log.Printf("Error summing object sizes in SQLite: %v", err)
+	}
+	return total
+}
+
+// query runs a record query, logging failures and returning whatever was read
+func (i *SQLiteMetadataIndex) query(statement string, args ...any) []ObjectRecord {
+	ctx, cancel := context.WithTimeout(context.Background(), sqlQueryTimeout)
+	defer cancel()
+
+	rows, err := i.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		log.Printf("Error querying the SQLite index: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var records []ObjectRecord
+	for rows.Next() {
+		var record ObjectRecord
+		var tags string
+		var expiresAt, restoredAt sql.NullTime
+		if err := rows.Scan(&record.RequestID, &record.ObjectName, &record.OriginalFilename, &record.ContentType,
+			&record.Size, &record.SHA256, &tags, &record.StorageTier, &record.StoredAt, &expiresAt, &restoredAt); err != nil {
+			log.Printf("Error reading the SQLite index: %v", err)
+			return records
+		}
+		if tags != "" {
+			record.Tags = strings.Split(tags, ",")
+		}
+		record.StoredAt = record.StoredAt.UTC()
+		if expiresAt.Valid {
+			at := expiresAt.Time.UTC()
+			record.ExpiresAt = &at
+		}
+		if restoredAt.Valid {
+			at := restoredAt.Time.UTC()
+			record.RestoredAt = &at
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error reading the SQLite index: %v", err)
+	}
+	return records
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// StorageStats summarizes what the depot holds
+type StorageStats struct {
+	Objects       int            `json:"objects"`
+	Bytes         int64          `json:"bytes"`
+	Requests      int            `json:"requests"`
+	ArchivedBytes int64          `json:"archived_bytes"`
+	ByContentType map[string]int `json:"by_content_type"`
+	Oldest        *time.Time     `json:"oldest,omitempty"`
+	Newest        *time.Time     `json:"newest,omitempty"`
+	ComputedAt    time.Time      `json:"computed_at"`
+}
+
+// StatsRollup periodically aggregates the metadata index so /stats stays cheap on
+// large depots
+type StatsRollup struct {
+	index MetadataIndex
+
+	mu     sync.RWMutex
+	latest *StorageStats
+}
+
+// NewStatsRollup creates a rollup over an index
+func NewStatsRollup(index MetadataIndex) *StatsRollup {
+	return &StatsRollup{
+		index: index,
+	}
+}
+
+// Rollup recomputes the storage statistics and keeps them as the latest
+func (r *StatsRollup) Rollup() (string, error) {
+	stats := StorageStats{
+		ByContentType: make(map[string]int),
+		ComputedAt:    time.Now().UTC(),
+	}
+	requests := make(map[string]bool)
+	for _, record := range r.index.List() {
+		stats.Objects++
+		stats.Bytes += int64(record.Size)
+		if record.StorageTier == StorageTierArchive {
+			stats.ArchivedBytes += int64(record.Size)
+		}
+		stats.ByContentType[record.ContentType]++
+		requests[record.RequestID] = true
+
+		storedAt := record.StoredAt
+		if stats.Oldest == nil || storedAt.Before(*stats.Oldest) {
+			stats.Oldest = &storedAt
+		}
+		if stats.Newest == nil || storedAt.After(*stats.Newest) {
+			stats.Newest = &storedAt
+		}
+	}
+	stats.Requests = len(requests)
+
+	r.mu.Lock()
+	r.latest = &stats
+	r.mu.Unlock()
+	return fmt.Sprintf("%d object(s), %d bytes across %d request(s)", stats.Objects, stats.Bytes, stats.Requests), nil
+}
+
+// Latest returns the most recent rollup, computing one if none has run yet
+func (r *StatsRollup) Latest() StorageStats {
+	r.mu.RLock()
+	latest := r.latest
+	r.mu.RUnlock()
+	if latest == nil {
+		r.Rollup()
+		r.mu.RLock()
+		latest = r.latest
+		r.mu.RUnlock()
+	}
+	return *latest
+}
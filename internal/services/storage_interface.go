@@ -1,9 +1,218 @@
 package services
 
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"time"
+)
+
+// ErrMetadataUnsupported is returned by wrappers whose underlying storage cannot read object metadata
+var ErrMetadataUnsupported = errors.New("storage does not expose object metadata")
+
 // StorageService interface for storage operations
 type StorageService interface {
-	SavePayload(objectName string, data []byte, contentType string) error
+	SavePayload(objectName string, data []byte, contentType string, metadata map[string]string) error
 	GetPayload(objectName string) ([]byte, error)
 	ListPayloads() ([]string, error)
 	DeletePayload(objectName string) error
 }
+
+// ContextSaver is implemented by storage services that can bind a save to a context,
+// so the save ends when the request it belongs to is cancelled or runs out of time
+type ContextSaver interface {
+	SavePayloadContext(ctx context.Context, objectName string, data []byte, contentType string, metadata map[string]string) error
+}
+
+// savePayload saves to storage under ctx when storage can bind saves to one
+func savePayload(ctx context.Context, storage StorageService, objectName string, data []byte, contentType string, metadata map[string]string) error {
+	if saver, ok := storage.(ContextSaver); ok && ctx != nil {
+		return saver.SavePayloadContext(ctx, objectName, data, contentType, metadata)
+	}
+	return storage.SavePayload(objectName, data, contentType, metadata)
+}
+
+// ContextReader is implemented by storage services that can bind a read to a context
+type ContextReader interface {
+	GetPayloadContext(ctx context.Context, objectName string) ([]byte, error)
+}
+
+// ContextLister is implemented by storage services that can bind a listing to a context
+type ContextLister interface {
+	ListPayloadsContext(ctx context.Context) ([]string, error)
+}
+
+// ContextDeleter is implemented by storage services that can bind a delete to a context
+type ContextDeleter interface {
+	DeletePayloadContext(ctx context.Context, objectName string) error
+}
+
+// getPayload reads from storage under ctx when storage can bind reads to one
+func getPayload(ctx context.Context, storage StorageService, objectName string) ([]byte, error) {
+	if reader, ok := storage.(ContextReader); ok && ctx != nil {
+		return reader.GetPayloadContext(ctx, objectName)
+	}
+	return storage.GetPayload(objectName)
+}
+
+// listPayloads lists storage under ctx when storage can bind listings to one
+func listPayloads(ctx context.Context, storage StorageService) ([]string, error) {
+	if lister, ok := storage.(ContextLister); ok && ctx != nil {
+		return lister.ListPayloadsContext(ctx)
+	}
+	return storage.ListPayloads()
+}
+
+// deletePayload deletes from storage under ctx when storage can bind deletes to one
+func deletePayload(ctx context.Context, storage StorageService, objectName string) error {
+	if deleter, ok := storage.(ContextDeleter); ok && ctx != nil {
+		return deleter.DeletePayloadContext(ctx, objectName)
+	}
+	return storage.DeletePayload(objectName)
+}
+
+// ErrListInfoUnsupported is returned by wrappers whose underlying storage cannot list
+// object details
+var ErrListInfoUnsupported = errors.New("storage does not list object details")
+
+// ObjectInfo describes a stored object as storage lists it
+type ObjectInfo struct {
+	ObjectName   string    `json:"object_name"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// ObjectLister is implemented by storage services that list objects together with
+// their size, content type and modification time, so a listing needs no request per
+// object. ContentType is empty when storage does not list it.
+type ObjectLister interface {
+	ListPayloadInfo() ([]ObjectInfo, error)
+}
+
+// ErrStatUnsupported is returned by wrappers whose underlying storage cannot describe
+// an object without reading it
+var ErrStatUnsupported = errors.New("storage cannot stat objects")
+
+// ObjectStat describes one stored object without its data. Storage fills in its
+// details and user metadata; the payload service adds the original filename and
+// checksum.
+type ObjectStat struct {
+	ObjectInfo
+	OriginalFilename string
+	SHA256           string
+	Metadata         map[string]string
+}
+
+// PayloadStatter is implemented by storage services that can describe an object, with
+// its size, content type, modification time and user metadata, in one request
+// without downloading it
+type PayloadStatter interface {
+	StatPayload(objectName string) (*ObjectStat, error)
+}
+
+// MetadataReader is implemented by storage services that can return an object's
+// content type and user metadata without downloading it
+type MetadataReader interface {
+	GetPayloadMetadata(objectName string) (string, map[string]string, error)
+}
+
+// withoutMetadata returns a copy of metadata without keys, so storage wrappers can
+// hide the keys they keep for themselves
+func withoutMetadata(metadata map[string]string, keys ...string) map[string]string {
+	visible := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		if !slices.Contains(keys, key) {
+			visible[key] = value
+		}
+	}
+	return visible
+}
+
+// RequestLister is implemented by storage services that can list the objects of one
+// request without the caller walking the whole bucket
+type RequestLister interface {
+	ListRequestPayloads(requestID string) ([]string, error)
+}
+
+// ContextRequestLister is implemented by request listers that can bind the listing
+// to a context
+type ContextRequestLister interface {
+	ListRequestPayloadsContext(ctx context.Context, requestID string) ([]string, error)
+}
+
+// ErrComposeUnsupported is returned when storage cannot append to an object server-side
+var ErrComposeUnsupported = errors.New("storage cannot compose objects server-side")
+
+// ObjectComposer is implemented by storage services that can append data to an
+// existing object server-side, without downloading it. It returns the new size.
+type ObjectComposer interface {
+	ComposePayload(objectName string, data []byte, contentType string, metadata map[string]string) (int64, error)
+}
+
+// ErrStreamUnsupported is returned when an upload cannot be streamed into storage and must be buffered
+var ErrStreamUnsupported = errors.New("storage cannot stream this upload")
+
+// UploadProgressFunc receives the cumulative bytes and parts a streaming upload has stored
+type UploadProgressFunc func(storedBytes int64, completedParts int)
+
+// StreamSaver is implemented by storage services that can store a body without
+// holding it in memory. size is the body's length, or -1 when it is unknown. It
+// returns the number of bytes stored and reports progress to the optional progress
+// func as parts are uploaded.
+type StreamSaver interface {
+	SavePayloadStream(objectName string, body io.Reader, size int64, contentType string, metadata map[string]string, progress UploadProgressFunc) (int64, error)
+}
+
+// ErrReadStreamUnsupported is returned when storage cannot stream an object's data and
+// it must be read whole instead
+var ErrReadStreamUnsupported = errors.New("storage cannot stream object reads")
+
+// StreamReader is implemented by storage services that can read an object without
+// holding it in memory. It returns the object's data and size; the caller closes it.
+type StreamReader interface {
+	GetPayloadStream(objectName string) (io.ReadCloser, int64, error)
+}
+
+// LegalHolder is implemented by storage services that can place a legal hold on an
+// object, such as MinIO buckets created with object locking
+type LegalHolder interface {
+	SetLegalHold(objectName string, enabled bool) error
+	LegalHold(objectName string) (bool, error)
+}
+
+// RetentionKeeper is implemented by storage services that can retain an object until
+// a date, such as MinIO buckets created with object locking. Retention returns the
+// zero time for objects without retention.
+type RetentionKeeper interface {
+	SetRetention(objectName string, until time.Time) error
+	Retention(objectName string) (time.Time, error)
+}
+
+// ObjectWatcher is implemented by storage services that can report objects as they are
+// created, such as MinIO buckets through bucket notifications. WatchCreated blocks
+// until ctx is done or the notification stream fails.
+type ObjectWatcher interface {
+	WatchCreated(ctx context.Context, created func(objectName string)) error
+}
+
+// ExpiryRule expires the objects of a retention class once they are Age old
+type ExpiryRule struct {
+	Class string
+	Age   time.Duration
+}
+
+// Days rounds the rule's age up to the whole days lifecycle rules count in
+func (r ExpiryRule) Days() int {
+	days := int((r.Age + 24*time.Hour - 1) / (24 * time.Hour))
+	return max(days, 1)
+}
+
+// LifecycleExpirer is implemented by storage services that can expire objects
+// server-side, such as MinIO and S3 through bucket lifecycle rules. New objects are
+// tagged with the retention class classify picks from their depot tags, and left
+// untagged, so kept forever, when it returns "".
+type LifecycleExpirer interface {
+	SetExpiryRules(rules []ExpiryRule, classify func(tags []string) string) error
+}
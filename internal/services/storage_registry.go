@@ -0,0 +1,94 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/config"
+)
+
+// DefaultStorageBackend is used when STORAGE_BACKEND is unset
+const DefaultStorageBackend = "minio"
+
+// StorageFactory creates a storage backend from the configuration
+type StorageFactory func(cfg *config.Config) (StorageService, error)
+
+var (
+	storageBackendsMu sync.RWMutex
+	storageBackends   = map[string]StorageFactory{}
+)
+
+func init() {
+	RegisterStorageBackend("minio", newMinioBackend)
+	RegisterStorageBackend("local", func(cfg *config.Config) (StorageService, error) {
+		return NewLocalStorageService(cfg.LocalRoot)
+	})
+	RegisterStorageBackend("memory", func(cfg *config.Config) (StorageService, error) {
+		return NewMemoryStorageService(cfg.MemoryMaxBytes)
+	})
+	RegisterStorageBackend("s3", func(cfg *config.Config) (StorageService, error) {
+		return NewS3Service(cfg)
+	})
+}
+
+// RegisterStorageBackend makes a backend selectable by name through STORAGE_BACKEND.
+// It panics when a name is registered twice, as that is a programming error.
+func RegisterStorageBackend(name string, factory StorageFactory) {
+	storageBackendsMu.Lock()
+	defer storageBackendsMu.Unlock()
+	if factory == nil {
+		panic("storage backend " + name + " has no factory")
+	}
+	if _, exists := storageBackends[name]; exists {
+		panic("storage backend " + name + " is registered twice")
+	}
+	storageBackends[name] = factory
+}
+
+// StorageBackends lists the registered backend names, sorted
+func StorageBackends() []string {
+	storageBackendsMu.RLock()
+	defer storageBackendsMu.RUnlock()
+	names := make([]string, 0, len(storageBackends))
+	for name := range storageBackends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewStorageBackend creates the backend named by the configuration's StorageBackend
+func NewStorageBackend(cfg *config.Config) (StorageService, error) {
+	name := cfg.StorageBackend
+	if name == "" {
+		name = DefaultStorageBackend
+	}
+	storageBackendsMu.RLock()
+	factory, ok := storageBackends[name]
+	storageBackendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown storage backend %q; registered backends are %v", name, StorageBackends())
+	}
+	return factory(cfg)
+}
+
+// newMinioBackend connects to MinIO, failing over between replicas when configured
+func newMinioBackend(cfg *config.Config) (StorageService, error) {
+	if len(cfg.MinioReplicaEndpoints) == 0 {
+		return NewMinioService(cfg)
+	}
+	endpoints, err := NewMinioEndpoints(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize MinIO endpoints: %v", err)
+	}
+	failover, err := NewFailoverStorage(endpoints, cfg.MinioWritePolicy, cfg.MinioHealthCheckInterval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize MinIO failover: %v", err)
+	}
+	failover.CheckOnce()
+	failover.Start()
+	log.Printf("MinIO failover enabled across %d endpoint(s), write policy=%s", len(endpoints), cfg.MinioWritePolicy)
+	return failover, nil
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Storage states of the objects of an upload, as reported by StoreStatusTracker. An
+// upload whose objects ended in both states is partial.
+const (
+	StoreStatePending = "pending"
+	StoreStateStored  = "stored"
+	StoreStateFailed  = "failed"
+	StoreStatePartial = "partial"
+)
+
+// ObjectStoreStatus reports whether one object has reached storage
+type ObjectStoreStatus struct {
+	ObjectName string `json:"object_name"`
+	State      string `json:"state"`
+	Error      string `json:"error,omitempty"`
+}
+
+// StoreStatus reports whether the objects of a request have reached storage
+type StoreStatus struct {
+	RequestID string              `json:"request_id"`
+	State     string              `json:"state"`
+	Objects   []ObjectStoreStatus `json:"objects"`
+	UpdatedAt time.Time           `json:"updated_at"`
+}
+
+// trackedRequest holds the object states of one request
+type trackedRequest struct {
+	objects   map[string]ObjectStoreStatus
+	updatedAt time.Time
+}
+
+// StoreStatusTracker records which objects of each request are still being saved,
+// so clients of the asynchronous /depot can poll until their payload is durable.
+// Requests are forgotten once nothing changed for retention.
+type StoreStatusTracker struct {
+	mu        sync.Mutex
+	requests  map[string]*trackedRequest
+	retention time.Duration
+}
+
+// NewStoreStatusTracker creates a tracker keeping finished requests for retention
+func NewStoreStatusTracker(retention time.Duration) *StoreStatusTracker {
+	return &StoreStatusTracker{
+		requests:  make(map[string]*trackedRequest),
+		retention: retention,
+	}
+}
+
+// Pending records the objects of an upload as waiting for storage. Later uploads under
+// the same request ID add their objects to it.
+func (t *StoreStatusTracker) Pending(result *StoreResult) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune()
+
+	request, ok := t.requests[result.RequestID]
+	if !ok {
+		request = &trackedRequest{objects: make(map[string]ObjectStoreStatus)}
+		t.requests[result.RequestID] = request
+	}
+	for _, object := range result.Objects {
+		request.objects[object.ObjectName] = ObjectStoreStatus{ObjectName: object.ObjectName, State: StoreStatePending}
+	}
+	request.updatedAt = time.Now().UTC()
+}
+
+// Saved records the outcome of saving one object; err is nil when it was stored
+func (t *StoreStatusTracker) Saved(requestID, objectName string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	request, ok := t.requests[requestID]
+	if !ok {
+		request = &trackedRequest{objects: make(map[string]ObjectStoreStatus)}
+		t.requests[requestID] = request
+	}
+	status := ObjectStoreStatus{ObjectName: objectName, State: StoreStateStored}
+	if err != nil {
+		status.State = StoreStateFailed
+		status.Error = err.Error()
+	}
+	request.objects[objectName] = status
+	request.updatedAt = time.Now().UTC()
+}
+
+// Status reports a request's objects, in name order, and their overall state
+func (t *StoreStatusTracker) Status(requestID string) (StoreStatus, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune()
+
+	request, ok := t.requests[requestID]
+	if !ok {
+		return StoreStatus{}, false
+	}
+	status := StoreStatus{RequestID: requestID, UpdatedAt: request.updatedAt}
+	counts := make(map[string]int)
+	for _, object := range request.objects {
+		status.Objects = append(status.Objects, object)
+		counts[object.State]++
+	}
+	sort.Slice(status.Objects, func(i, j int) bool {
+		return status.Objects[i].ObjectName < status.Objects[j].ObjectName
+	})
+
+	status.State = storeState(counts)
+	return status, true
+}
+
+// storeState sums up the states of a request's objects, counted by state
+func storeState(counts map[string]int) string {
+	switch {
+	case counts[StoreStatePending] > 0:
+		return StoreStatePending
+	case counts[StoreStateFailed] == 0:
+		return StoreStateStored
+	case counts[StoreStateStored] == 0:
+		return StoreStateFailed
+	default:
+		return StoreStatePartial
+	}
+}
+
+// prune forgets requests with no pending objects that have not changed for retention
+func (t *StoreStatusTracker) prune() {
+	for requestID, request := range t.requests {
+		if time.Since(request.updatedAt) <= t.retention {
+			continue
+		}
+		pending := false
+		for _, object := range request.objects {
+			pending = pending || object.State == StoreStatePending
+		}
+		if !pending {
+			delete(t.requests, requestID)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+)
+
+// BucketScoper is implemented by storage services that can serve another bucket on
+// the same endpoint, such as MinIO and S3. ForBucket creates the bucket when it
+// does not exist.
+type BucketScoper interface {
+	ForBucket(bucket string) (StorageService, error)
+}
+
+// TenantBucketStorage keeps the payloads of mapped tenants in their own bucket,
+// and everyone else's in the shared one. A tenant's objects are recognised by the
+// tenant prefix of their names, and stored in its bucket without the prefix.
+// Each tenant bucket is created the first time it is used.
+type TenantBucketStorage struct {
+	shared  StorageService
+	scoper  BucketScoper
+	buckets map[string]string
+
+	mu     sync.Mutex
+	opened map[string]StorageService
+}
+
+// NewTenantBucketStorage routes the tenants in buckets, mapped to their bucket names,
+// away from shared, which must be able to serve other buckets
+func NewTenantBucketStorage(shared StorageService, buckets map[string]string) (*TenantBucketStorage, error) {
+	scoper, ok := shared.(BucketScoper)
+	if !ok {
+		return nil, fmt.Errorf("tenant buckets need a storage backend that can serve other buckets, such as minio or s3")
+	}
+	for tenant, bucket := range buckets {
+		if !ValidTenant(tenant) {
+			return nil, fmt.Errorf("invalid tenant %q; use lowercase letters, digits and dashes", tenant)
+		}
+		if err := s3utils.CheckValidBucketNameStrict(bucket); err != nil {
+			return nil, fmt.Errorf("invalid bucket %q for tenant %s: %v", bucket, tenant, err)
+		}
+	}
+	return &TenantBucketStorage{
+		shared:  shared,
+		scoper:  scoper,
+		buckets: buckets,
+		opened:  make(map[string]StorageService),
+	}, nil
+}
+
+// open returns a tenant's bucket, creating it on first use; a failed attempt is
+// retried on the next call
+func (t *TenantBucketStorage) open(tenant string) (StorageService, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if storage, ok := t.opened[tenant]; ok {
+		return storage, nil
+	}
+	storage, err := t.scoper.ForBucket(t.buckets[tenant])
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bucket %s of tenant %s: %w", t.buckets[tenant], tenant, err)
+	}
+	t.opened[tenant] = storage
+	return storage, nil
+}
+
+// route finds the storage an object lives in, and its name there
+func (t *TenantBucketStorage) route(objectName string) (StorageService, string, error) {
+	tenant, name, ok := strings.Cut(objectName, TenantSeparator)
+	if _, mapped := t.buckets[tenant]; !ok || !mapped || name == "" {
+		return t.shared, objectName, nil
+	}
+	storage, err := t.open(tenant)
+	return storage, name, err
+}
+
+// SavePayload writes to the object's bucket
+func (t *TenantBucketStorage) SavePayload(objectName string, data []byte, contentType string, metadata map[string]string) error {
+	return t.SavePayloadContext(context.Background(), objectName, data, contentType, metadata)
+}
+
+// SavePayloadContext saves as SavePayload does, under ctx
+func (t *TenantBucketStorage) SavePayloadContext(ctx context.Context, objectName string, data []byte, contentType string, metadata map[string]string) error {
+	storage, name, err := t.route(objectName)
+	if err != nil {
+		return err
+	}
+	return savePayload(ctx, storage, name, data, contentType, metadata)
+}
+
+// GetPayload reads from the object's bucket
+func (t *TenantBucketStorage) GetPayload(objectName string) ([]byte, error) {
+	storage, name, err := t.route(objectName)
+	if err != nil {
+		return nil, err
+	}
+	return storage.GetPayload(name)
+}
+
+// GetPayloadStream opens an object in its bucket
+func (t *TenantBucketStorage) GetPayloadStream(objectName string) (io.ReadCloser, int64, error) {
+	storage, name, err := t.route(objectName)
+	if err != nil {
+		return nil, 0, err
+	}
+	reader, ok := storage.(StreamReader)
+	if !ok {
+		return nil, 0, ErrReadStreamUnsupported
+	}
+	return reader.GetPayloadStream(name)
+}
+
+// GetPayloadMetadata reads metadata from the object's bucket
+func (t *TenantBucketStorage) GetPayloadMetadata(objectName string) (string, map[string]string, error) {
+	storage, name, err := t.route(objectName)
+	if err != nil {
+		return "", nil, err
+	}
+	reader, ok := storage.(MetadataReader)
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrMetadataUnsupported, objectName)
+	}
+	return reader.GetPayloadMetadata(name)
+}
+
+// StatPayload describes the object in the bucket it lives in, named as it was given
+func (t *TenantBucketStorage) StatPayload(objectName string) (*ObjectStat, error) {
+	storage, name, err := t.route(objectName)
+	if err != nil {
+		return nil, err
+	}
+	statter, ok := storage.(PayloadStatter)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrStatUnsupported, objectName)
+	}
+	stat, err := statter.StatPayload(name)
+	if err != nil {
+		return nil, err
+	}
+	stat.ObjectName = objectName
+	return stat, nil
+}
+
+// SavePayloadStream streams into the object's bucket
+func (t *TenantBucketStorage) SavePayloadStream(objectName string, body io.Reader, size int64, contentType string, metadata map[string]string, progress UploadProgressFunc) (int64, error) {
+	storage, name, err := t.route(objectName)
+	if err != nil {
+		return 0, err
+	}
+	streamer, ok := storage.(StreamSaver)
+	if !ok {
+		return 0, ErrStreamUnsupported
+	}
+	return streamer.SavePayloadStream(name, body, size, contentType, metadata, progress)
+}
+
+// ComposePayload appends server-side in the object's bucket
+func (t *TenantBucketStorage) ComposePayload(objectName string, data []byte, contentType string, metadata map[string]string) (int64, error) {
+	storage, name, err := t.route(objectName)
+	if err != nil {
+		return 0, err
+	}
+	composer, ok := storage.(ObjectComposer)
+	if !ok {
+		return 0, ErrComposeUnsupported
+	}
+	return composer.ComposePayload(name, data, contentType, metadata)
+}
+
+// SetLegalHold places or releases a legal hold in the object's bucket
+func (t *TenantBucketStorage) SetLegalHold(objectName string, enabled bool) error {
+	storage, name, err := t.route(objectName)
+	if err != nil {
+		return err
+	}
+	holder, ok := storage.(LegalHolder)
+	if !ok {
+		return errors.New("storage does not support legal holds")
+	}
+	return holder.SetLegalHold(name, enabled)
+}
+
+// LegalHold reports the legal hold of an object in its bucket
+func (t *TenantBucketStorage) LegalHold(objectName string) (bool, error) {
+	storage, name, err := t.route(objectName)
+	if err != nil {
+		return false, err
+	}
+	holder, ok := storage.(LegalHolder)
+	if !ok {
+		return false, errors.New("storage does not support legal holds")
+	}
+	return holder.LegalHold(name)
+}
+
+// SetRetention retains an object in its bucket until a date
+func (t *TenantBucketStorage) SetRetention(objectName string, until time.Time) error {
+	storage, name, err := t.route(objectName)
+	if err != nil {
+		return err
+	}
+	keeper, ok := storage.(RetentionKeeper)
+	if !ok {
+		return errors.New("storage does not support retention")
+	}
+	return keeper.SetRetention(name, until)
+}
+
+// Retention reports how long an object in its bucket is retained
+func (t *TenantBucketStorage) Retention(objectName string) (time.Time, error) {
+	storage, name, err := t.route(objectName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	keeper, ok := storage.(RetentionKeeper)
+	if !ok {
+		return time.Time{}, errors.New("storage does not support retention")
+	}
+	return keeper.Retention(name)
+}
+
+// ListPayloads lists the shared bucket and every tenant bucket, with tenant objects
+// named by their prefix again
+func (t *TenantBucketStorage) ListPayloads() ([]string, error) {
+	objects, err := t.shared.ListPayloads()
+	if err != nil {
+		return nil, err
+	}
+	for tenant := range t.buckets {
+		storage, err := t.open(tenant)
+		if err != nil {
+			return nil, err
+		}
+		owned, err := storage.ListPayloads()
+		if err != nil {
+			return nil, fmt.Errorf("error listing bucket of tenant %s: %v", tenant, err)
+		}
+		for _, obj := range owned {
+			objects = append(objects, tenant+TenantSeparator+obj)
+		}
+	}
+	sort.Strings(objects)
+	return objects, nil
+}
+
+// ListPayloadInfo lists the shared bucket and every tenant bucket with object details,
+// with tenant objects named by their prefix again
+func (t *TenantBucketStorage) ListPayloadInfo() ([]ObjectInfo, error) {
+	lister, ok := t.shared.(ObjectLister)
+	if !ok {
+		return nil, ErrListInfoUnsupported
+	}
+	infos, err := lister.ListPayloadInfo()
+	if err != nil {
+		return nil, err
+	}
+	for tenant := range t.buckets {
+		storage, err := t.open(tenant)
+		if err != nil {
+			return nil, err
+		}
+		lister, ok := storage.(ObjectLister)
+		if !ok {
+			return nil, ErrListInfoUnsupported
+		}
+		owned, err := lister.ListPayloadInfo()
+		if err != nil {
+			return nil, fmt.Errorf("error listing bucket of tenant %s: %v", tenant, err)
+		}
+		for _, info := range owned {
+			info.ObjectName = tenant + TenantSeparator + info.ObjectName
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ObjectName < infos[j].ObjectName })
+	return infos, nil
+}
+
+// ListRequestPayloads lists one request in the bucket it lives in
+func (t *TenantBucketStorage) ListRequestPayloads(requestID string) ([]string, error) {
+	storage, name, err := t.route(requestID)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := listRequestObjects(storage, name)
+	if err != nil || storage == t.shared {
+		return objects, err
+	}
+	tenant, _, _ := strings.Cut(requestID, TenantSeparator)
+	for i, obj := range objects {
+		objects[i] = tenant + TenantSeparator + obj
+	}
+	return objects, nil
+}
+
+// DeletePayload deletes from the object's bucket
+func (t *TenantBucketStorage) DeletePayload(objectName string) error {
+	storage, name, err := t.route(objectName)
+	if err != nil {
+		return err
+	}
+	return storage.DeletePayload(name)
+}
@@ -0,0 +1,69 @@
+package services
+
+import "strings"
+
+// TenantSeparator ends the tenant prefix of a tenant's request IDs; tenant names
+// cannot contain it, so the prefix is unambiguous
+const TenantSeparator = "."
+
+// maxTenantLength keeps tenant prefixes short enough for object names
+const maxTenantLength = 63
+
+// ValidTenant accepts tenant names made of lowercase letters, digits and dashes
+func ValidTenant(tenant string) bool {
+	if tenant == "" || len(tenant) > maxTenantLength {
+		return false
+	}
+	for _, r := range tenant {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// TenantRequestID scopes a request ID to tenant, prefixing it unless it already
+// carries the prefix; without a tenant the ID is returned unchanged. As object
+// names start with their request ID, every object of the tenant shares the prefix.
+func TenantRequestID(tenant, requestID string) string {
+	if tenant == "" || strings.HasPrefix(requestID, tenant+TenantSeparator) {
+		return requestID
+	}
+	return tenant + TenantSeparator + requestID
+}
+
+// TenantOwns reports whether an object name or request ID belongs to tenant;
+// without a tenant everything does
+func TenantOwns(tenant, name string) bool {
+	return tenant == "" || strings.HasPrefix(name, tenant+TenantSeparator)
+}
+
+// TenantObjects keeps the objects that belong to tenant; without a tenant every
+// object is kept
+func TenantObjects(tenant string, objects []string) []string {
+	if tenant == "" {
+		return objects
+	}
+	owned := []string{}
+	for _, obj := range objects {
+		if TenantOwns(tenant, obj) {
+			owned = append(owned, obj)
+		}
+	}
+	return owned
+}
+
+// TenantRecords keeps the index records of objects that belong to tenant; without a
+// tenant every record is kept
+func TenantRecords(tenant string, records []ObjectRecord) []ObjectRecord {
+	if tenant == "" {
+		return records
+	}
+	owned := []ObjectRecord{}
+	for _, record := range records {
+		if TenantOwns(tenant, record.ObjectName) {
+			owned = append(owned, record)
+		}
+	}
+	return owned
+}
@@ -0,0 +1,398 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidToken is returned for bearer tokens that are malformed, badly signed,
+// expired or meant for someone else
+var ErrInvalidToken = errors.New("invalid bearer token")
+
+// tokenLeeway absorbs clock skew between the depot and the token issuer
+const tokenLeeway = time.Minute
+
+// TokenClaims are the claims of a verified bearer token
+type TokenClaims struct {
+	Subject   string         `json:"sub"`
+	Issuer    string         `json:"iss"`
+	Scopes    []string       `json:"scopes"`
+	ExpiresAt time.Time      `json:"expires_at"`
+	Raw       map[string]any `json:"-"`
+}
+
+// HasScope reports whether the token was granted scope
+func (c *TokenClaims) HasScope(scope string) bool {
+	for _, granted := range c.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenVerifier checks bearer tokens and returns their claims
+type TokenVerifier interface {
+	VerifyToken(token string) (*TokenClaims, error)
+}
+
+// OIDCVerifier verifies JWTs signed by an OIDC issuer. Keys come from the issuer's
+// JWKS endpoint, found through its discovery document unless given, and are
+// fetched again when a token names a key not seen yet. RS256/384/512 and
+// ES256/384/512 signatures are accepted.
+type OIDCVerifier struct {
+	issuer   string
+	jwksURL  string
+	audience string
+	client   *http.Client
+	// minRefresh stops tokens with unknown key IDs from hammering the issuer
+	minRefresh time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	// refreshing is closed when the key set fetch in progress, if any, ends, and
+	// refreshErr is how the last fetch failed
+	refreshing chan struct{}
+	refreshErr error
+}
+
+// NewOIDCVerifier verifies tokens from issuer meant for audience. The audience is
+// required: without it, a token the issuer signed for any other service would be
+// accepted. jwksURL may be empty to discover it from the issuer.
+func NewOIDCVerifier(issuer, jwksURL, audience string) (*OIDCVerifier, error) {
+	if issuer == "" && jwksURL == "" {
+		return nil, fmt.Errorf("token verification needs an issuer or a JWKS URL")
+	}
+	if audience == "" {
+		return nil, fmt.Errorf("token verification needs an audience, so tokens issued for other services are refused")
+	}
+	return &OIDCVerifier{
+		issuer:     strings.TrimSuffix(issuer, "/"),
+		jwksURL:    jwksURL,
+		audience:   audience,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		minRefresh: 30 * time.Second,
+	}, nil
+}
+
+// VerifyToken checks a compact JWT's signature, issuer, audience and lifetime
+func (v *OIDCVerifier) VerifyToken(token string) (*TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: not a JWT", ErrInvalidToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeTokenPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	key, err := v.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyTokenSignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var raw map[string]any
+	if err := decodeTokenPart(parts[1], &raw); err != nil {
+		return nil, err
+	}
+	return v.checkClaims(raw)
+}
+
+// checkClaims validates the registered claims and collects the scopes
+func (v *OIDCVerifier) checkClaims(raw map[string]any) (*TokenClaims, error) {
+	claims := &TokenClaims{Raw: raw}
+	claims.Subject, _ = raw["sub"].(string)
+	claims.Issuer, _ = raw["iss"].(string)
+	if v.issuer != "" && strings.TrimSuffix(claims.Issuer, "/") != v.issuer {
+		return nil, fmt.Errorf("%w: issued by %q", ErrInvalidToken, claims.Issuer)
+	}
+	if !containsClaim(raw["aud"], v.audience) {
+		return nil, fmt.Errorf("%w: not meant for audience %q", ErrInvalidToken, v.audience)
+	}
+
+	now := time.Now()
+	exp, ok := raw["exp"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("%w: no expiry", ErrInvalidToken)
+	}
+	claims.ExpiresAt = time.Unix(int64(exp), 0)
+	if now.After(claims.ExpiresAt.Add(tokenLeeway)) {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+	if nbf, ok := raw["nbf"].(float64); ok && now.Add(tokenLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	}
+
+	// "scope" is a space-separated string; some issuers send "scp" as a list instead
+	if scope, ok := raw["scope"].(string); ok {
+		claims.Scopes = strings.Fields(scope)
+	}
+	switch scp := raw["scp"].(type) {
+	case string:
+		claims.Scopes = append(claims.Scopes, strings.Fields(scp)...)
+	case []any:
+		for _, s := range scp {
+			if s, ok := s.(string); ok {
+				claims.Scopes = append(claims.Scopes, s)
+			}
+		}
+	}
+	return claims, nil
+}
+
+// containsClaim reports whether a string-or-list claim holds want
+func containsClaim(claim any, want string) bool {
+	switch claim := claim.(type) {
+	case string:
+		return claim == want
+	case []any:
+		for _, value := range claim {
+			if value == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeTokenPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return fmt.Errorf("%w: malformed encoding", ErrInvalidToken)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: malformed JSON", ErrInvalidToken)
+	}
+	return nil
+}
+
+// verifyTokenSignature checks signed against signature with the algorithm the
+// token names, which must match the key's type
+func verifyTokenSignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg[min(len(alg), 2):] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, alg)
+	}
+	hasher := hash.New()
+	hasher.Write([]byte(signed))
+	digest := hasher.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			break
+		}
+		if rsa.VerifyPKCS1v15(key, hash, digest, signature) != nil {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			break
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: algorithm %q does not match the signing key", ErrInvalidToken, alg)
+}
+
+// key finds a signing key by ID, fetching the key set again when it is unknown. The
+// fetch runs without the lock, so tokens signed with known keys are not held up by a
+// slow issuer; tokens that need the new key set wait for the one fetch in progress.
+func (v *OIDCVerifier) key(kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	if key, ok := v.lookupLocked(kid); ok {
+		v.mu.Unlock()
+		return key, nil
+	}
+	done := v.refreshing
+	if done == nil {
+		if v.keys != nil && time.Since(v.fetchedAt) < v.minRefresh {
+			v.mu.Unlock()
+			return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+		}
+		done = make(chan struct{})
+		v.refreshing = done
+		v.fetchedAt = time.Now()
+		jwksURL := v.jwksURL
+		v.mu.Unlock()
+
+		keys, jwksURL, err := v.fetchKeys(jwksURL)
+		v.mu.Lock()
+		if err == nil {
+			v.keys = keys
+			v.jwksURL = jwksURL
+		}
+		v.refreshErr = err
+		v.refreshing = nil
+		close(done)
+		v.mu.Unlock()
+	} else {
+		v.mu.Unlock()
+		<-done
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if key, ok := v.lookupLocked(kid); ok {
+		return key, nil
+	}
+	if v.refreshErr != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %v", v.refreshErr)
+	}
+	return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+}
+
+// lookupLocked finds a key by ID; a token without one may use the only key there is
+func (v *OIDCVerifier) lookupLocked(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, ok
+}
+
+// fetchKeys fetches the key set from jwksURL, discovering it from the issuer when it
+// is empty, and returns the signing keys with the URL they came from
+func (v *OIDCVerifier) fetchKeys(jwksURL string) (map[string]crypto.PublicKey, string, error) {
+	if jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.getJSON(v.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+			return nil, "", err
+		}
+		if discovery.JWKSURI == "" {
+			return nil, "", fmt.Errorf("issuer %s publishes no jwks_uri", v.issuer)
+		}
+		jwksURL = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := v.getJSON(jwksURL, &set); err != nil {
+		return nil, "", err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, jwksURL, nil
+}
+
+func (v *OIDCVerifier) getJSON(url string, out any) error {
+	resp, err := v.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// jsonWebKey is one RSA or EC key of a JWKS
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("malformed key %s", k.Kid)
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("key %s is not on its curve", k.Kid)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
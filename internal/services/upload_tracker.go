@@ -0,0 +1,143 @@
+package services
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Upload session states reported by UploadTracker
+const (
+	UploadReceiving = "receiving"
+	UploadCompleted = "completed"
+	UploadFailed    = "failed"
+)
+
+// UploadProgress reports how far an in-flight or recently finished upload got
+type UploadProgress struct {
+	Session       string `json:"session"`
+	State         string `json:"state"`
+	BytesReceived int64  `json:"bytes_received"`
+	// BytesExpected is -1 when the client did not send a Content-Length
+	BytesExpected  int64     `json:"bytes_expected"`
+	BytesStored    int64     `json:"bytes_stored"`
+	PartsCompleted int       `json:"parts_completed"`
+	Stalled        bool      `json:"stalled"`
+	Error          string    `json:"error,omitempty"`
+	StartedAt      time.Time `json:"started_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// UploadTracker records the progress of uploads by session, so clients can poll it
+// while a large transfer is running. Finished sessions are kept for retention.
+type UploadTracker struct {
+	mu         sync.Mutex
+	sessions   map[string]*UploadProgress
+	stallAfter time.Duration
+	retention  time.Duration
+}
+
+// NewUploadTracker creates a tracker that flags uploads idle for stallAfter as stalled
+func NewUploadTracker(stallAfter, retention time.Duration) *UploadTracker {
+	return &UploadTracker{
+		sessions:   make(map[string]*UploadProgress),
+		stallAfter: stallAfter,
+		retention:  retention,
+	}
+}
+
+// Begin starts tracking an upload, replacing any earlier session with the same name
+func (t *UploadTracker) Begin(session string, expected int64) *UploadSession {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune()
+
+	if expected < 0 {
+		expected = -1
+	}
+	now := time.Now().UTC()
+	progress := &UploadProgress{
+		Session:       session,
+		State:         UploadReceiving,
+		BytesExpected: expected,
+		StartedAt:     now,
+		UpdatedAt:     now,
+	}
+	t.sessions[session] = progress
+	return &UploadSession{tracker: t, progress: progress}
+}
+
+// Progress returns a snapshot of a session's progress
+func (t *UploadTracker) Progress(session string) (UploadProgress, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	progress, ok := t.sessions[session]
+	if !ok {
+		return UploadProgress{}, false
+	}
+	snapshot := *progress
+	snapshot.Stalled = snapshot.State == UploadReceiving && t.stallAfter > 0 && time.Since(snapshot.UpdatedAt) > t.stallAfter
+	return snapshot, true
+}
+
+// prune drops finished sessions older than the retention; callers hold mu
+func (t *UploadTracker) prune() {
+	for session, progress := range t.sessions {
+		if progress.State != UploadReceiving && time.Since(progress.UpdatedAt) > t.retention {
+			delete(t.sessions, session)
+		}
+	}
+}
+
+// UploadSession updates the progress of one tracked upload
+type UploadSession struct {
+	tracker  *UploadTracker
+	progress *UploadProgress
+}
+
+// TrackBody counts the bytes read from an upload's body as received
+func (s *UploadSession) TrackBody(body io.ReadCloser) io.ReadCloser {
+	return &countingBody{ReadCloser: body, session: s}
+}
+
+// Stored records the cumulative bytes and parts a streaming upload has stored
+func (s *UploadSession) Stored(bytes int64, parts int) {
+	s.update(func(p *UploadProgress) {
+		p.BytesStored = bytes
+		p.PartsCompleted = parts
+	})
+}
+
+// Finish marks the upload completed, or failed with err
+func (s *UploadSession) Finish(err error) {
+	s.update(func(p *UploadProgress) {
+		p.State = UploadCompleted
+		if err != nil {
+			p.State = UploadFailed
+			p.Error = err.Error()
+		}
+	})
+}
+
+func (s *UploadSession) update(apply func(p *UploadProgress)) {
+	s.tracker.mu.Lock()
+	defer s.tracker.mu.Unlock()
+	apply(s.progress)
+	s.progress.UpdatedAt = time.Now().UTC()
+}
+
+// countingBody reports every read of an upload body to its session
+type countingBody struct {
+	io.ReadCloser
+	session *UploadSession
+}
+
+func (c *countingBody) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if n > 0 {
+		c.session.update(func(progress *UploadProgress) {
+			progress.BytesReceived += int64(n)
+		})
+	}
+	return n, err
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultNamespace is charged for requests that name no namespace, or an invalid one
+const DefaultNamespace = "default"
+
+// UsageMonthFormat is the layout of the months usage is accounted by
+const UsageMonthFormat = "2006-01"
+
+// UsageRecord is what one namespace used in one month
+type UsageRecord struct {
+	Namespace       string `json:"namespace"`
+	Month           string `json:"month"`
+	Requests        int64  `json:"requests"`
+	BytesStored     int64  `json:"bytes_stored"`
+	BytesDownloaded int64  `json:"bytes_downloaded"`
+}
+
+// UsageRecorder accounts the requests made on behalf of a namespace
+type UsageRecorder interface {
+	RecordUsage(namespace string, at time.Time, stored, downloaded int64)
+}
+
+// UsageReporter reports the usage of every namespace in a month
+type UsageReporter interface {
+	Usage(month string) []UsageRecord
+}
+
+type usageKey struct {
+	namespace string
+	month     string
+}
+
+// UsageLedger accounts requests, bytes stored and bytes downloaded per namespace and
+// month, so storage can be charged back to the teams using it. With a file, the
+// ledger is loaded at startup and saved by the usage job; without one it only covers
+// the months since startup.
+type UsageLedger struct {
+	path string
+
+	mu    sync.Mutex
+	usage map[usageKey]*UsageRecord
+}
+
+// NewUsageLedger creates a ledger, loading the usage saved to path if it exists
+func NewUsageLedger(path string) (*UsageLedger, error) {
+	ledger := &UsageLedger{
+		path:  path,
+		usage: make(map[usageKey]*UsageRecord),
+	}
+	if path == "" {
+		return ledger, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ledger, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []UsageRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("invalid usage file %s: %v", path, err)
+	}
+	for _, record := range records {
+		ledger.usage[usageKey{record.Namespace, record.Month}] = &record
+	}
+	return ledger, nil
+}
+
+// UsageNamespace returns the namespace a request is charged to; names follow the
+// rules of request IDs
+func UsageNamespace(name string) string {
+	if name == "" || !isValidRequestID(name) {
+		return DefaultNamespace
+	}
+	return name
+}
+
+// RecordUsage charges one request and its bytes to a namespace in the month of at
+func (l *UsageLedger) RecordUsage(namespace string, at time.Time, stored, downloaded int64) {
+	key := usageKey{UsageNamespace(namespace), at.UTC().Format(UsageMonthFormat)}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	record, ok := l.usage[key]
+	if !ok {
+		record = &UsageRecord{Namespace: key.namespace, Month: key.month}
+		l.usage[key] = record
+	}
+	record.Requests++
+	record.BytesStored += stored
+	record.BytesDownloaded += downloaded
+}
+
+// Usage returns every namespace's usage in a month, sorted by namespace
+func (l *UsageLedger) Usage(month string) []UsageRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	records := []UsageRecord{}
+	for key, record := range l.usage {
+		if key.month == month {
+			records = append(records, *record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Namespace < records[j].Namespace })
+	return records
+}
+
+// Save writes the ledger to its file
+func (l *UsageLedger) Save() (string, error) {
+	if l.path == "" {
+		return "no usage file configured", nil
+	}
+	l.mu.Lock()
+	records := make([]UsageRecord, 0, len(l.usage))
+	for _, record := range l.usage {
+		records = append(records, *record)
+	}
+	l.mu.Unlock()
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Month != records[j].Month {
+			return records[i].Month < records[j].Month
+		}
+		return records[i].Namespace < records[j].Namespace
+	})
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		return "", fmt.Errorf("error encoding usage: %v", err)
+	}
+	// Write to a temporary file first so a crash never leaves a truncated ledger
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return "", fmt.Errorf("error writing usage: %v", err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return "", fmt.Errorf("error writing usage: %v", err)
+	}
+	return fmt.Sprintf("saved %d namespace-month(s) to %s", len(records), l.path), nil
+}
@@ -0,0 +1,463 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// queuedPayload is a save waiting in the write-ahead queue. It is kept on disk as a
+// .json record next to a .data file holding the payload.
+type queuedPayload struct {
+	ObjectName  string            `json:"object_name"`
+	ContentType string            `json:"content_type"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Size        int64             `json:"size"`
+	QueuedAt    time.Time         `json:"queued_at"`
+
+	attempts    int
+	nextAttempt time.Time
+	lastError   string
+}
+
+// WriteAheadQueueStatus reports the backlog of a write-ahead queue
+type WriteAheadQueueStatus struct {
+	Depth       int        `json:"depth"`
+	Bytes       int64      `json:"bytes"`
+	Oldest      *time.Time `json:"oldest,omitempty"`
+	NextAttempt *time.Time `json:"next_attempt,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	Flushed     int64      `json:"flushed"`
+}
+
+// WriteAheadQueue wraps a storage service and keeps the payloads it fails to save in
+// a queue on local disk instead of failing the save. Queued payloads are retried in
+// the background with backoff until storage accepts them, and survive restarts.
+// Until then they are read, listed and deleted from the queue, so callers see them as
+// stored. A newer save of a queued object is queued behind it rather than racing its
+// retry. Streamed saves are not queued: their body is gone once storage fails.
+type WriteAheadQueue struct {
+	inner  StorageService
+	dir    string
+	policy RetryPolicy
+
+	mu      sync.Mutex
+	entries map[string]*queuedPayload
+	flushed int64
+}
+
+// NewWriteAheadQueue creates a write-ahead queue in dir over inner, loading the
+// payloads a previous run left queued. Only the policy's backoff fields are used;
+// queued payloads are retried until they are saved.
+func NewWriteAheadQueue(inner StorageService, dir string, policy RetryPolicy) (*WriteAheadQueue, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create write-ahead queue directory: %w", err)
+	}
+	q := &WriteAheadQueue{
+		inner:   inner,
+		dir:     dir,
+		policy:  policy,
+		entries: make(map[string]*queuedPayload),
+	}
+
+	records, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		raw, err := os.ReadFile(record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read queued payload %s: %w", record, err)
+		}
+		var entry queuedPayload
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return nil, fmt.Errorf("invalid queued payload %s: %w", record, err)
+		}
+		if _, err := os.Stat(q.dataPath(entry.ObjectName)); err != nil {
+			// The payload was never fully queued, so its save failed
+			os.Remove(record)
+			continue
+		}
+		q.entries[entry.ObjectName] = &entry
+	}
+	return q, nil
+}
+
+// Start retries queued payloads in the background, checking for due ones every interval
+func (q *WriteAheadQueue) Start(interval time.Duration) {
+	go func() {
+		for {
+			time.Sleep(interval)
+			q.FlushOnce()
+		}
+	}()
+}
+
+// FlushOnce retries every queued payload whose backoff has elapsed, returning how many
+// were saved
+func (q *WriteAheadQueue) FlushOnce() int {
+	now := time.Now()
+	q.mu.Lock()
+	var due []*queuedPayload
+	for _, entry := range q.entries {
+		if !entry.nextAttempt.After(now) {
+			due = append(due, entry)
+		}
+	}
+	q.mu.Unlock()
+	slices.SortFunc(due, func(a, b *queuedPayload) int { return a.QueuedAt.Compare(b.QueuedAt) })
+
+	saved := 0
+	for _, entry := range due {
+		data, err := os.ReadFile(q.dataPath(entry.ObjectName))
+		if err == nil {
+			err = q.inner.SavePayload(entry.ObjectName, data, entry.ContentType, entry.Metadata)
+		}
+
+		q.mu.Lock()
+		if q.entries[entry.ObjectName] != entry {
+			// Deleted or queued again while it was being retried
+			q.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			entry.attempts++
+			entry.nextAttempt = time.Now().Add(q.policy.Delay(entry.attempts))
+			entry.lastError = err.Error()
+			q.mu.Unlock()
+			continue
+		}
+		q.remove(entry.ObjectName)
+		q.flushed++
+		q.mu.Unlock()
+		saved++
+		log.Printf("Saved queued payload %s after %d retries", entry.ObjectName, entry.attempts+1)
+	}
+	return saved
+}
+
+// Status reports the queue's backlog
+func (q *WriteAheadQueue) Status() WriteAheadQueueStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	status := WriteAheadQueueStatus{Depth: len(q.entries), Flushed: q.flushed}
+	var oldest *queuedPayload
+	for _, entry := range q.entries {
+		status.Bytes += entry.Size
+		if oldest == nil || entry.QueuedAt.Before(oldest.QueuedAt) {
+			oldest = entry
+		}
+		if status.NextAttempt == nil || entry.nextAttempt.Before(*status.NextAttempt) {
+			next := entry.nextAttempt
+			status.NextAttempt = &next
+		}
+	}
+	if oldest != nil {
+		queuedAt := oldest.QueuedAt
+		status.Oldest = &queuedAt
+		status.LastError = oldest.lastError
+	}
+	return status
+}
+
+// basePath names an object's files in the queue directory after a hash of its name,
+// so any object name is a valid file name
+func (q *WriteAheadQueue) basePath(objectName string) string {
+	sum := sha256.Sum256([]byte(objectName))
+	return filepath.Join(q.dir, hex.EncodeToString(sum[:]))
+}
+
+func (q *WriteAheadQueue) dataPath(objectName string) string {
+	return q.basePath(objectName) + ".data"
+}
+
+func (q *WriteAheadQueue) recordPath(objectName string) string {
+	return q.basePath(objectName) + ".json"
+}
+
+// writeFile writes a file through a temporary file and a rename, so a crash never
+// leaves it half written
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".queue-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// enqueue writes a payload to disk, replacing any older queued save of the object.
+// The caller holds q.mu.
+func (q *WriteAheadQueue) enqueue(objectName string, data []byte, contentType string, metadata map[string]string, cause error) error {
+	entry := &queuedPayload{
+		ObjectName:  objectName,
+		ContentType: contentType,
+		Metadata:    metadata,
+		Size:        int64(len(data)),
+		QueuedAt:    time.Now().UTC(),
+		attempts:    1,
+		nextAttempt: time.Now().Add(q.policy.Delay(1)),
+	}
+	if cause != nil {
+		entry.lastError = cause.Error()
+	}
+	if previous, ok := q.entries[objectName]; ok {
+		// Keep the object's place in the queue and its backoff
+		entry.QueuedAt = previous.QueuedAt
+		entry.attempts = previous.attempts
+		entry.nextAttempt = previous.nextAttempt
+		entry.lastError = previous.lastError
+	}
+	record, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(q.dataPath(objectName), data); err != nil {
+		return err
+	}
+	if err := writeFile(q.recordPath(objectName), record); err != nil {
+		return err
+	}
+	q.entries[objectName] = entry
+	return nil
+}
+
+// remove drops an object from the queue. The caller holds q.mu.
+func (q *WriteAheadQueue) remove(objectName string) {
+	os.Remove(q.recordPath(objectName))
+	os.Remove(q.dataPath(objectName))
+	delete(q.entries, objectName)
+}
+
+// queued returns an object's queued save, if it has one
+func (q *WriteAheadQueue) queued(objectName string) (*queuedPayload, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	entry, ok := q.entries[objectName]
+	return entry, ok
+}
+
+// SavePayload saves to the wrapped storage, queueing the payload when it fails
+func (q *WriteAheadQueue) SavePayload(objectName string, data []byte, contentType string, metadata map[string]string) error {
+	return q.SavePayloadContext(context.Background(), objectName, data, contentType, metadata)
+}
+
+// SavePayloadContext saves as SavePayload does, under ctx
+func (q *WriteAheadQueue) SavePayloadContext(ctx context.Context, objectName string, data []byte, contentType string, metadata map[string]string) error {
+	q.mu.Lock()
+	if _, ok := q.entries[objectName]; ok {
+		defer q.mu.Unlock()
+		return q.enqueue(objectName, data, contentType, metadata, nil)
+	}
+	q.mu.Unlock()
+
+	err := savePayload(ctx, q.inner, objectName, data, contentType, metadata)
+	if err == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if queueErr := q.enqueue(objectName, data, contentType, metadata, err); queueErr != nil {
+		return fmt.Errorf("%w (and queueing it failed: %v)", err, queueErr)
+	}
+	log.Printf("Queued %s for retry after storage failed: %v", objectName, err)
+	return nil
+}
+
+// GetPayload reads a queued payload from the queue, and others from the wrapped storage
+func (q *WriteAheadQueue) GetPayload(objectName string) ([]byte, error) {
+	if _, ok := q.queued(objectName); ok {
+		data, err := os.ReadFile(q.dataPath(objectName))
+		if err == nil {
+			return data, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		// Saved or deleted since it was looked up
+	}
+	return q.inner.GetPayload(objectName)
+}
+
+// GetPayloadStream opens a queued payload in the queue, and others in the wrapped storage
+func (q *WriteAheadQueue) GetPayloadStream(objectName string) (io.ReadCloser, int64, error) {
+	if entry, ok := q.queued(objectName); ok {
+		file, err := os.Open(q.dataPath(objectName))
+		if err == nil {
+			return file, entry.Size, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, 0, err
+		}
+	}
+	reader, ok := q.inner.(StreamReader)
+	if !ok {
+		return nil, 0, ErrReadStreamUnsupported
+	}
+	return reader.GetPayloadStream(objectName)
+}
+
+// GetPayloadMetadata reads a queued payload's metadata from the queue, and others'
+// from the wrapped storage, when it exposes any
+func (q *WriteAheadQueue) GetPayloadMetadata(objectName string) (string, map[string]string, error) {
+	if entry, ok := q.queued(objectName); ok {
+		return entry.ContentType, entry.Metadata, nil
+	}
+	reader, ok := q.inner.(MetadataReader)
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrMetadataUnsupported, objectName)
+	}
+	return reader.GetPayloadMetadata(objectName)
+}
+
+// queuedNames lists the queued objects, in name order
+func (q *WriteAheadQueue) queuedNames() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.queuedNamesLocked()
+}
+
+// mergeNames adds the queued objects missing from a listing of the wrapped storage
+func mergeNames(objects, queued []string) []string {
+	for _, name := range queued {
+		if !slices.Contains(objects, name) {
+			objects = append(objects, name)
+		}
+	}
+	return objects
+}
+
+// ListPayloads lists the wrapped storage together with the queued objects
+func (q *WriteAheadQueue) ListPayloads() ([]string, error) {
+	objects, err := q.inner.ListPayloads()
+	if err != nil {
+		return nil, err
+	}
+	return mergeNames(objects, q.queuedNames()), nil
+}
+
+// ListRequestPayloads lists one request in the wrapped storage together with its queued objects
+func (q *WriteAheadQueue) ListRequestPayloads(requestID string) ([]string, error) {
+	objects, err := listRequestObjects(q.inner, requestID)
+	if err != nil {
+		return nil, err
+	}
+	var queued []string
+	for _, name := range q.queuedNames() {
+		if IsRequestObject(name, requestID) {
+			queued = append(queued, name)
+		}
+	}
+	return mergeNames(objects, queued), nil
+}
+
+// info describes a queued object as a listing would
+func (entry *queuedPayload) info() ObjectInfo {
+	return ObjectInfo{
+		ObjectName:   entry.ObjectName,
+		Size:         entry.Size,
+		ContentType:  entry.ContentType,
+		LastModified: entry.QueuedAt,
+	}
+}
+
+// StatPayload describes a queued object from the queue, and others through the wrapped storage
+func (q *WriteAheadQueue) StatPayload(objectName string) (*ObjectStat, error) {
+	if entry, ok := q.queued(objectName); ok {
+		return &ObjectStat{ObjectInfo: entry.info(), Metadata: entry.Metadata}, nil
+	}
+	statter, ok := q.inner.(PayloadStatter)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrStatUnsupported, objectName)
+	}
+	return statter.StatPayload(objectName)
+}
+
+// ListPayloadInfo lists the wrapped storage with object details, queued objects included
+func (q *WriteAheadQueue) ListPayloadInfo() ([]ObjectInfo, error) {
+	lister, ok := q.inner.(ObjectLister)
+	if !ok {
+		return nil, ErrListInfoUnsupported
+	}
+	infos, err := lister.ListPayloadInfo()
+	if err != nil {
+		return nil, err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, info := range infos {
+		if entry, ok := q.entries[info.ObjectName]; ok {
+			infos[i] = entry.info()
+		}
+	}
+	for _, name := range q.queuedNamesLocked() {
+		if !slices.ContainsFunc(infos, func(info ObjectInfo) bool { return info.ObjectName == name }) {
+			infos = append(infos, q.entries[name].info())
+		}
+	}
+	return infos, nil
+}
+
+// queuedNamesLocked lists the queued objects in name order. The caller holds q.mu.
+func (q *WriteAheadQueue) queuedNamesLocked() []string {
+	names := make([]string, 0, len(q.entries))
+	for name := range q.entries {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// ComposePayload appends server-side through the wrapped storage, when it supports it.
+// A queued object is not in storage yet, so the caller rewrites it instead.
+func (q *WriteAheadQueue) ComposePayload(objectName string, data []byte, contentType string, metadata map[string]string) (int64, error) {
+	composer, ok := q.inner.(ObjectComposer)
+	if !ok {
+		return 0, ErrComposeUnsupported
+	}
+	if _, queued := q.queued(objectName); queued {
+		return 0, ErrComposeUnsupported
+	}
+	return composer.ComposePayload(objectName, data, contentType, metadata)
+}
+
+// SavePayloadStream streams through the wrapped storage, when it supports it. A newer
+// save of a queued object is buffered instead, so it is queued behind the older one.
+func (q *WriteAheadQueue) SavePayloadStream(objectName string, body io.Reader, size int64, contentType string, metadata map[string]string, progress UploadProgressFunc) (int64, error) {
+	streamer, ok := q.inner.(StreamSaver)
+	if !ok {
+		return 0, ErrStreamUnsupported
+	}
+	if _, queued := q.queued(objectName); queued {
+		return 0, ErrStreamUnsupported
+	}
+	return streamer.SavePayloadStream(objectName, body, size, contentType, metadata, progress)
+}
+
+// DeletePayload drops an object from the queue and deletes it from the wrapped storage
+func (q *WriteAheadQueue) DeletePayload(objectName string) error {
+	q.mu.Lock()
+	q.remove(objectName)
+	q.mu.Unlock()
+	return q.inner.DeletePayload(objectName)
+}
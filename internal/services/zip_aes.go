@@ -0,0 +1,141 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrZipPasswordTooShort is returned when an encrypted zip is requested with a weak password
+	ErrZipPasswordTooShort = errors.New("zip password must be at least 8 characters")
+	// ErrZipEncryptionUnsupported is returned when the zip service cannot encrypt archives
+	ErrZipEncryptionUnsupported = errors.New("zip encryption is not supported")
+)
+
+// MinZipPasswordLength is the shortest password accepted for encrypted zips
+const MinZipPasswordLength = 8
+
+// WinZip AES (AE-2) constants; see https://www.winzip.com/en/support/aes-encryption/
+const (
+	zipMethodAES       = 99
+	zipAESExtraID      = 0x9901
+	zipAESVendorAE2    = 2
+	zipAESStrength256  = 3
+	zipAESKeyLength    = 32
+	zipAESSaltLength   = 16
+	zipAESVerifierLen  = 2
+	zipAESAuthCodeLen  = 10
+	zipAESKDFIteration = 1000
+)
+
+// CreateEncryptedZip creates a zip archive whose entries are encrypted with AES-256
+// under password, in the WinZip AE-2 format that 7-Zip, WinZip and libarchive read.
+// Entry names and sizes stay visible; only the contents are encrypted.
+func (z *DefaultZipService) CreateEncryptedZip(files []FileInfo, password string) ([]byte, error) {
+	if len(password) < MinZipPasswordLength {
+		return nil, ErrZipPasswordTooShort
+	}
+
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+	err := forEachZipEntry(files, func(header *zip.FileHeader, data []byte) error {
+		sealed, err := sealZipAES(data, password)
+		if err != nil {
+			return err
+		}
+		// AE-2 leaves the CRC out; the HMAC authenticates the contents instead
+		header.Extra = zipAESExtra(header.Method)
+		header.Method = zipMethodAES
+		header.Flags |= 0x1 // encrypted
+		header.CRC32 = 0
+		header.CompressedSize64 = uint64(len(sealed))
+		header.ReaderVersion = 51
+		return writeZipEntry(zipWriter, header, bytes.NewReader(sealed))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := zipWriter.Close(); err != nil {
+		return nil, fmt.Errorf("error finishing zip: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// zipAESExtra is the AES extra field recording the entry's real compression method
+func zipAESExtra(method uint16) []byte {
+	extra := make([]byte, 11)
+	binary.LittleEndian.PutUint16(extra[0:], zipAESExtraID)
+	binary.LittleEndian.PutUint16(extra[2:], 7)
+	binary.LittleEndian.PutUint16(extra[4:], zipAESVendorAE2)
+	copy(extra[6:], "AE")
+	extra[8] = zipAESStrength256
+	binary.LittleEndian.PutUint16(extra[9:], method)
+	return extra
+}
+
+// sealZipAES encrypts one entry's (compressed) data as salt, password verifier,
+// ciphertext and authentication code
+func sealZipAES(data []byte, password string) ([]byte, error) {
+	salt := make([]byte, zipAESSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("error generating zip salt: %v", err)
+	}
+	keys, err := pbkdf2.Key(sha1.New, password, salt, zipAESKDFIteration, 2*zipAESKeyLength+zipAESVerifierLen)
+	if err != nil {
+		return nil, fmt.Errorf("error deriving zip key: %v", err)
+	}
+	block, err := aes.NewCipher(keys[:zipAESKeyLength])
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := make([]byte, 0, len(salt)+zipAESVerifierLen+len(data)+zipAESAuthCodeLen)
+	sealed = append(sealed, salt...)
+	sealed = append(sealed, keys[2*zipAESKeyLength:]...)
+	ciphertext := make([]byte, len(data))
+	newZipAESCTR(block).XORKeyStream(ciphertext, data)
+	sealed = append(sealed, ciphertext...)
+
+	mac := hmac.New(sha1.New, keys[zipAESKeyLength:2*zipAESKeyLength])
+	mac.Write(ciphertext)
+	return append(sealed, mac.Sum(nil)[:zipAESAuthCodeLen]...), nil
+}
+
+// zipAESCTR is AES in counter mode as WinZip uses it: a little-endian counter that
+// starts at 1, where crypto/cipher's CTR increments big-endian
+type zipAESCTR struct {
+	block     cipher.Block
+	counter   [aes.BlockSize]byte
+	keystream [aes.BlockSize]byte
+	used      int
+}
+
+func newZipAESCTR(block cipher.Block) *zipAESCTR {
+	return &zipAESCTR{block: block, used: aes.BlockSize}
+}
+
+func (c *zipAESCTR) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if c.used == aes.BlockSize {
+			for j := range c.counter {
+				c.counter[j]++
+				if c.counter[j] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.keystream[:], c.counter[:])
+			c.used = 0
+		}
+		dst[i] = src[i] ^ c.keystream[c.used]
+		c.used++
+	}
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Errors returned when an uploaded archive cannot be extracted safely
+var (
+	ErrUnsafeArchive   = errors.New("unsafe archive entry")
+	ErrArchiveTooLarge = errors.New("archive exceeds extraction limits")
+	ErrInvalidArchive  = errors.New("invalid zip archive")
+)
+
+// zipLocalHeaderMagic starts every zip archive
+var zipLocalHeaderMagic = []byte("PK\x03\x04")
+
+// DefaultZipExtractor unpacks uploaded zip archives into individual payloads
+type DefaultZipExtractor struct {
+	contentTypeDetector ContentTypeDetector
+	maxEntries          int
+	maxBytes            int64
+}
+
+// NewDefaultZipExtractor creates an extractor bounded by an entry count and total uncompressed size
+func NewDefaultZipExtractor(detector ContentTypeDetector, maxEntries int, maxBytes int64) *DefaultZipExtractor {
+	return &DefaultZipExtractor{
+		contentTypeDetector: detector,
+		maxEntries:          maxEntries,
+		maxBytes:            maxBytes,
+	}
+}
+
+// IsArchive reports whether a payload is a zip archive
+func (e *DefaultZipExtractor) IsArchive(payload ProcessedPayload) bool {
+	return payload.ContentType == "application/zip" ||
+		strings.EqualFold(path.Ext(payload.Filename), ".zip") ||
+		bytes.HasPrefix(payload.Data, zipLocalHeaderMagic)
+}
+
+// Extract returns one payload per file entry, named under the request ID
+func (e *DefaultZipExtractor) Extract(requestID string, data []byte) ([]ProcessedPayload, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+
+	var payloads []ProcessedPayload
+	var total int64
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		entryName, err := sanitizeEntryName(file.Name)
+		if err != nil {
+			return nil, err
+		}
+		if len(payloads) >= e.maxEntries {
+			return nil, fmt.Errorf("%w: more than %d entries", ErrArchiveTooLarge, e.maxEntries)
+		}
+
+		entryData, err := e.readEntry(file, e.maxBytes-total)
+		if err != nil {
+			return nil, err
+		}
+		total += int64(len(entryData))
+
+		payloads = append(payloads, ProcessedPayload{
+			ObjectName:  fmt.Sprintf("%s_%s", requestID, strings.ReplaceAll(entryName, "/", "_")),
+			Data:        entryData,
+			ContentType: e.contentTypeDetector.DetectFromFilename(entryName),
+			Filename:    entryName,
+		})
+	}
+	return payloads, nil
+}
+
+// readEntry decompresses one entry, failing once more than remaining bytes are produced.
+// The declared size in the header is not trusted.
+func (e *DefaultZipExtractor) readEntry(file *zip.File, remaining int64) ([]byte, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidArchive, file.Name, err)
+	}
+	defer rc.Close()
+
+	entryData, err := io.ReadAll(io.LimitReader(rc, remaining+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidArchive, file.Name, err)
+	}
+	if int64(len(entryData)) > remaining {
+		return nil, fmt.Errorf("%w: more than %d uncompressed bytes", ErrArchiveTooLarge, e.maxBytes)
+	}
+	return entryData, nil
+}
+
+// sanitizeEntryName rejects entries that would escape the request (zip-slip)
+func sanitizeEntryName(name string) (string, error) {
+	normalized := strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(normalized, "/") || (len(normalized) > 1 && normalized[1] == ':') {
+		return "", fmt.Errorf("%w: %s", ErrUnsafeArchive, name)
+	}
+	cleaned := path.Clean(normalized)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("%w: %s", ErrUnsafeArchive, name)
+	}
+	return cleaned, nil
+}
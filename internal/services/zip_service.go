@@ -3,9 +3,30 @@ package services
 import (
 	"archive/zip"
 	"bytes"
+	"compress/flate"
 	"encoding/base64"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"unicode/utf8"
 )
 
+// zipVersion20 is the zip spec version written as creator and reader version;
+// archive/zip raises the reader version to 4.5 for entries that need Zip64
+const zipVersion20 = 20
+
+// ZipEntry is one file streamed into a zip archive. Its size and CRC-32 must be known
+// before the data is written so they can go in the local file header.
+type ZipEntry struct {
+	Name  string
+	Size  uint64
+	CRC32 uint32
+	Data  io.Reader
+}
+
 // DefaultZipService handles creating zip archives
 type DefaultZipService struct{}
 
@@ -14,36 +35,147 @@ func NewDefaultZipService() *DefaultZipService {
 	return &DefaultZipService{}
 }
 
-// CreateZip creates a zip archive from multiple files
+// CreateZip creates a zip archive from multiple files. Each file is compressed up front
+// so its sizes and CRC-32 are written in its local header, with Zip64 fields for files,
+// offsets or entry counts past the classic zip limits. Entry names never collide: a
+// name already in the archive is replaced by the file's object name, or numbered.
 func (z *DefaultZipService) CreateZip(files []FileInfo) ([]byte, error) {
 	var buf bytes.Buffer
 	zipWriter := zip.NewWriter(&buf)
-	defer zipWriter.Close()
+	err := forEachZipEntry(files, func(header *zip.FileHeader, data []byte) error {
+		return writeZipEntry(zipWriter, header, bytes.NewReader(data))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := zipWriter.Close(); err != nil {
+		return nil, fmt.Errorf("error finishing zip: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// forEachZipEntry decodes and compresses each file, passing fn its entry header and the
+// data to write: deflated when that is smaller, stored otherwise
+func forEachZipEntry(files []FileInfo, fn func(header *zip.FileHeader, data []byte) error) error {
+	var compressed bytes.Buffer
+	deflater, _ := flate.NewWriter(&compressed, flate.DefaultCompression)
+	names := make(zipNames)
 
 	for _, file := range files {
-		filename := file.OriginalFilename
-		if filename == "" {
-			filename = file.ObjectName
-		}
+		// Files sharing an original filename fall back to their unique object names
+		filename := names.unique(file.OriginalFilename, file.ObjectName)
 
 		// Decode base64 data
 		decoded, err := base64.StdEncoding.DecodeString(file.PayloadBase64)
 		if err != nil {
-			continue
+			return fmt.Errorf("error decoding %s: %v", file.ObjectName, err)
 		}
 
-		// Create file in zip
-		f, err := zipWriter.Create(filename)
-		if err != nil {
-			continue
+		compressed.Reset()
+		deflater.Reset(&compressed)
+		deflater.Write(decoded)
+		deflater.Close()
+
+		header := newZipHeader(filename, uint64(len(decoded)), crc32.ChecksumIEEE(decoded))
+		data := decoded
+		if compressed.Len() < len(decoded) {
+			header.Method = zip.Deflate
+			header.CompressedSize64 = uint64(compressed.Len())
+			data = compressed.Bytes()
+		}
+		if err := fn(header, data); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		_, err = f.Write(decoded)
-		if err != nil {
-			continue
+// WriteZip streams entries into a zip archive on w without buffering them. Entries are
+// stored uncompressed, with the same Zip64 handling and name de-duplication as CreateZip.
+func (z *DefaultZipService) WriteZip(w io.Writer, entries []ZipEntry) error {
+	zipWriter := zip.NewWriter(w)
+	names := make(zipNames)
+	for _, entry := range entries {
+		if err := writeZipEntry(zipWriter, newZipHeader(names.unique(entry.Name), entry.Size, entry.CRC32), entry.Data); err != nil {
+			return err
 		}
 	}
+	if err := zipWriter.Close(); err != nil {
+		return fmt.Errorf("error finishing zip: %v", err)
+	}
+	return nil
+}
 
-	zipWriter.Close()
-	return buf.Bytes(), nil
+// zipNames tracks the entry names used in an archive. Names are compared without case,
+// since extracting on Windows or macOS would otherwise overwrite one entry with another.
+type zipNames map[string]bool
+
+// unique returns the first unused name among the candidates, or the first candidate
+// numbered as "name (2).ext", "name (3).ext", ... when they are all taken
+func (n zipNames) unique(candidates ...string) string {
+	candidates = slices.DeleteFunc(candidates, func(name string) bool { return name == "" })
+	if len(candidates) == 0 {
+		candidates = []string{"unnamed"}
+	}
+	for _, name := range candidates {
+		if !n[strings.ToLower(name)] {
+			n[strings.ToLower(name)] = true
+			return name
+		}
+	}
+	ext := path.Ext(candidates[0])
+	base := strings.TrimSuffix(candidates[0], ext)
+	for i := 2; ; i++ {
+		name := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if !n[strings.ToLower(name)] {
+			n[strings.ToLower(name)] = true
+			return name
+		}
+	}
+}
+
+// newZipHeader describes a stored entry whose size and CRC-32 are known
+func newZipHeader(name string, size uint64, crc uint32) *zip.FileHeader {
+	header := &zip.FileHeader{
+		Name:               name,
+		Method:             zip.Store,
+		CreatorVersion:     zipVersion20,
+		ReaderVersion:      zipVersion20,
+		CRC32:              crc,
+		CompressedSize64:   size,
+		UncompressedSize64: size,
+	}
+	// CreateRaw leaves the UTF-8 flag to the caller
+	if !isASCII(name) && utf8.ValidString(name) {
+		header.Flags |= 0x800
+	}
+	return header
+}
+
+// writeZipEntry writes an entry with its sizes in the local header rather than in a
+// trailing data descriptor. Streaming readers cannot find the end of an entry past
+// 4 GiB from a descriptor, and archive/zip only writes the local Zip64 extra field
+// when the sizes are known up front.
+func writeZipEntry(zipWriter *zip.Writer, header *zip.FileHeader, data io.Reader) error {
+	entry, err := zipWriter.CreateRaw(header)
+	if err != nil {
+		return fmt.Errorf("error adding %s to zip: %v", header.Name, err)
+	}
+	written, err := io.Copy(entry, data)
+	if err != nil {
+		return fmt.Errorf("error writing %s to zip: %v", header.Name, err)
+	}
+	if uint64(written) != header.CompressedSize64 {
+		return fmt.Errorf("error writing %s to zip: wrote %d bytes, expected %d", header.Name, written, header.CompressedSize64)
+	}
+	return nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
 }
@@ -1,10 +1,25 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/crypto/ssh"
 
 	"github.com/ahmad-alkadri/simple-depot/internal/config"
+	"github.com/ahmad-alkadri/simple-depot/internal/frontends"
 	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
 	"github.com/ahmad-alkadri/simple-depot/internal/services"
 )
@@ -13,15 +28,144 @@ func main() {
 	// Create ConfigManager
 	configManager := config.NewConfigManager()
 	config := configManager.GetConfig()
-	log.Printf("Starting server with config: Endpoint=%s, Bucket=%s, UseSSL=%v",
-		config.MinioEndpoint, config.MinioBucket, config.MinioUseSSL)
+	if err := config.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Log structured lines; lines of the log package go through the same logger
+	logger, err := services.NewLogger(config.LogFormat, config.LogLevel)
+	if err != nil {
+		log.Fatalf("Invalid logging settings: %v", err)
+	}
+	slog.SetDefault(logger)
+	log.Printf("Starting server with config: Backend=%s, Endpoint=%s, Bucket=%s, UseSSL=%v",
+		config.StorageBackend, config.MinioEndpoint, config.MinioBucket, config.MinioUseSSL)
 
-	// Initialize storage service
-	storageService, err := services.NewMinioService(config)
+	// Initialize the storage backend chosen by STORAGE_BACKEND
+	backend, err := services.NewStorageBackend(config)
 	if err != nil {
-		log.Fatalf("Failed to initialize MinIO service: %v", err)
+		log.Fatalf("Failed to initialize %s storage: %v", config.StorageBackend, err)
+	}
+	log.Printf("%s storage initialized successfully", config.StorageBackend)
+
+	// Export traces of requests through processing and storage to an OTLP collector
+	shutdownTracing := func(context.Context) error { return nil }
+	if config.Tracing {
+		shutdownTracing, err = services.StartTracing("simple-depot", config.TraceSampleRatio)
+		if err != nil {
+			log.Fatalf("Failed to set up tracing: %v", err)
+		}
+		log.Printf("Tracing enabled, sampling %.0f%% of new traces", config.TraceSampleRatio*100)
+	}
+
+	// Keep mapped tenants' payloads in their own buckets
+	if len(config.TenantBuckets) > 0 {
+		if config.TenantHeader == "" && len(config.TenantAPIKeys) == 0 {
+			log.Fatal("DEPOT_TENANT_BUCKETS needs DEPOT_TENANT_API_KEYS or DEPOT_TENANT_HEADER")
+		}
+		backend, err = services.NewTenantBucketStorage(backend, config.TenantBuckets)
+		if err != nil {
+			log.Fatalf("Invalid DEPOT_TENANT_BUCKETS: %v", err)
+		}
+		log.Printf("Dedicated buckets for %d tenant(s)", len(config.TenantBuckets))
+	}
+
+	// Queue payloads storage fails to save on local disk and retry them, beneath
+	// encryption so queued payloads are encrypted too
+	storageBase := backend
+	var writeAheadQueue *services.WriteAheadQueue
+	if config.WriteAheadDir != "" {
+		writeAheadPolicy, err := services.RetryPolicy{
+			Backoff:        services.BackoffExponential,
+			InitialBackoff: services.Duration(config.WriteAheadInitialBackoff),
+			MaxBackoff:     services.Duration(config.WriteAheadMaxBackoff),
+		}.WithDefaults()
+		if err != nil {
+			log.Fatalf("Invalid write-ahead queue backoff: %v", err)
+		}
+		writeAheadQueue, err = services.NewWriteAheadQueue(backend, config.WriteAheadDir, writeAheadPolicy)
+		if err != nil {
+			log.Fatalf("Failed to open write-ahead queue: %v", err)
+		}
+		writeAheadQueue.Start(time.Second)
+		storageBase = writeAheadQueue
+		log.Printf("Write-ahead queue in %s holds %d payload(s)", config.WriteAheadDir, writeAheadQueue.Status().Depth)
+	}
+
+	// Encrypt payloads at rest when keys or a key manager are configured
+	encryptedStorage, err := newEncryptedStorage(config, storageBase)
+	if err != nil {
+		log.Fatalf("Failed to initialize encryption: %v", err)
+	}
+	if encryptedStorage == nil && config.EncryptionRequired {
+		log.Fatal("DEPOT_ENCRYPTION_REQUIRED is set, but neither DEPOT_ENCRYPTION_KEYS nor DEPOT_ENCRYPTION_PROVIDER is")
+	}
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		if encryptedStorage == nil {
+			log.Fatal("rotate-keys requires at-rest encryption to be configured")
+		}
+		rotated, err := encryptedStorage.RotateKeys()
+		if err != nil {
+			log.Fatalf("Key rotation failed after %d object(s): %v", rotated, err)
+		}
+		log.Printf("Re-encrypted %d object(s) under key %s", rotated, encryptedStorage.ActiveKeyID())
+		return
+	}
+	storageService := storageBase
+	if encryptedStorage != nil {
+		storageService = encryptedStorage
+		log.Printf("At-rest encryption enabled with key %s", encryptedStorage.ActiveKeyID())
+	}
+
+	// Inject storage faults to test clients and retries; never enabled by default
+	var faultInjector *services.FaultInjector
+	if config.ChaosMode {
+		faultInjector, err = services.NewFaultInjector(storageService, services.FaultPlan{
+			Latency:         config.ChaosLatency,
+			Jitter:          config.ChaosJitter,
+			SaveFailureRate: config.ChaosSaveFailureRate,
+			ReadFailureRate: config.ChaosReadFailureRate,
+			OutageEvery:     config.ChaosOutageEvery,
+			OutageFor:       config.ChaosOutageFor,
+		})
+		if err != nil {
+			log.Fatalf("Invalid chaos mode settings: %v", err)
+		}
+		storageService = faultInjector
+		log.Printf("WARNING: chaos mode is on; storage faults are injected (latency %s+%s, save failures %.0f%%, read failures %.0f%%, outage %s every %s)",
+			config.ChaosLatency, config.ChaosJitter, config.ChaosSaveFailureRate*100, config.ChaosReadFailureRate*100, config.ChaosOutageFor, config.ChaosOutageEvery)
+	}
+
+	// Split very large objects into parts for backends with per-object size limits
+	if config.ChunkSize > 0 {
+		storageService = services.NewChunkedStorage(storageService, int(config.ChunkSize))
+		log.Printf("Chunking objects larger than %d bytes", config.ChunkSize)
+	}
+
+	// Store identical payloads once, such as retried webhooks
+	var dedupStorage *services.DedupStorage
+	if config.Dedup {
+		dedupStorage = services.NewDedupStorage(storageService)
+		storageService = dedupStorage
+		log.Printf("Deduplicating identical payloads")
+	}
+
+	// Compress payloads at rest, above deduplication so identical payloads still share a blob
+	if config.Compression != "" {
+		compressedStorage, err := services.NewCompressedStorage(storageService, config.Compression, int(config.CompressionMinSize), config.CompressionTypes)
+		if err != nil {
+			log.Fatalf("Failed to set up compression: %v", err)
+		}
+		storageService = compressedStorage
+		log.Printf("Compressing payloads of %d bytes or more with %s", config.CompressionMinSize, config.Compression)
+	}
+
+	// Serve repeated listings from a short-lived cache invalidated on every write
+	var listingCache *services.ListingCache
+	if config.ListCacheTTL > 0 {
+		listingCache = services.NewListingCache(storageService, config.ListCacheTTL)
+		storageService = listingCache
 	}
-	log.Println("MinIO service initialized successfully")
 
 	// Create all service dependencies (following dependency injection)
 	idGenerator := services.NewDefaultIDGenerator()
@@ -29,6 +173,7 @@ func main() {
 	filenameExtractor := services.NewDefaultFilenameExtractor()
 	responseFormatter := services.NewDefaultResponseFormatter()
 	zipService := services.NewDefaultZipService()
+	previewer := services.NewDefaultPreviewer()
 	payloadProcessor := services.NewDefaultPayloadProcessor(contentTypeDetector)
 
 	// Create payload service with all dependencies
@@ -40,17 +185,928 @@ func main() {
 		zipService,
 	)
 
-	// Create HTTP handler with dependencies
+	payloadService.SetSaveWorkers(int(config.SaveWorkers), int(config.SaveQueueSize), config.SaveQueueWait)
+	if listingCache != nil {
+		payloadService.AddObserver(listingCache)
+	}
+
+	// Record every outbound delivery so failures can be inspected and re-driven
+	deliveryLog := services.NewDeliveryLog(int(config.DeliveryRetention))
+
+	// Deliver completion events to per-upload callback URLs
+	callbackPolicy, err := services.RetryPolicy{
+		MaxAttempts:    int(config.CallbackMaxAttempts),
+		Backoff:        config.CallbackBackoff,
+		InitialBackoff: services.Duration(config.CallbackInitialBackoff),
+		MaxBackoff:     services.Duration(config.CallbackMaxBackoff),
+		Timeout:        services.Duration(config.CallbackTimeout),
+		Concurrency:    int(config.CallbackConcurrency),
+	}.WithDefaults()
+	if err != nil {
+		log.Fatalf("Invalid callback retry policy: %v", err)
+	}
+	callbackNotifier := services.NewHTTPCallbackNotifier(config.CallbackSecret, callbackPolicy, deliveryLog)
+	callbackNotifier.SetAllowedHosts(config.CallbackAllowedHosts)
+	callbackNotifier.SetAllowPrivate(config.CallbackAllowPrivate)
+	payloadService.SetCallbackNotifier(callbackNotifier)
+
+	// Unpack zip uploads that set X-Depot-Extract
+	payloadService.SetArchiveExtractor(services.NewDefaultZipExtractor(contentTypeDetector, int(config.ExtractMaxEntries), config.ExtractMaxBytes))
+
+	// Keep a decompressed copy of gzip uploads that set X-Depot-Decompress
+	payloadService.SetDecompressor(services.NewGzipDecompressor(contentTypeDetector, config.DecompressMaxBytes))
+
+	// Detect the content type of application/octet-stream uploads when the pipeline sniffs
+	payloadService.SetContentSniffer(contentTypeDetector)
+	if len(config.Pipeline) > 0 {
+		if err := payloadService.SetPipeline(config.Pipeline); err != nil {
+			log.Fatalf("Invalid DEPOT_PIPELINE: %v", err)
+		}
+	}
+	log.Printf("Payload pipeline: %s", strings.Join(append(payloadService.Pipeline(), "store"), " -> "))
+	if len(config.StoredHeaders) > 0 {
+		payloadService.SetStoredHeaders(config.StoredHeaders)
+	}
+
+	// Legal holds and retention need an object-locked bucket; protected objects are
+	// never evicted or archived
+	var legalHolds *services.LegalHolds
+	var objectRetention *services.ObjectRetention
+	var deletionGuards services.DeletionGuards
+	if config.MinioObjectLock {
+		if holder, ok := backend.(services.LegalHolder); ok {
+			legalHolds = services.NewLegalHolds(storageService, holder)
+			deletionGuards = append(deletionGuards, legalHolds)
+		}
+		if keeper, ok := backend.(services.RetentionKeeper); ok {
+			objectRetention = services.NewObjectRetention(storageService, keeper)
+			deletionGuards = append(deletionGuards, objectRetention)
+		}
+		log.Println("Legal holds and retention enabled")
+	}
+	if len(deletionGuards) > 0 {
+		payloadService.SetDeletionGuard(deletionGuards)
+	}
+
+	// Refuse new payloads from every source while in read-only maintenance mode
+	maintenanceMode := services.NewMaintenanceMode(config.ReadOnly, config.MaintenanceMessage)
+	payloadService.SetMaintenanceMode(maintenanceMode)
+	if config.ReadOnly {
+		log.Println("Starting in read-only maintenance mode")
+	}
+
+	// Report whether background saves have reached storage at /status
+	storeStatuses := services.NewStoreStatusTracker(config.StoreStatusRetention)
+	payloadService.SetStoreStatusTracker(storeStatuses)
+
+	// Track stored object metadata for lookups
+	var metadataIndex services.MetadataIndex
+	switch config.MetadataStore {
+	case "postgres":
+		if config.PostgresURL == "" {
+			log.Fatal("DEPOT_POSTGRES_URL is required for the postgres metadata store")
+		}
+		postgresIndex, err := services.NewPostgresMetadataIndex(config.PostgresURL)
+		if err != nil {
+			log.Fatalf("Failed to initialize Postgres metadata store: %v", err)
+		}
+		defer postgresIndex.Close()
+		metadataIndex = postgresIndex
+		log.Println("Using Postgres metadata store")
+	case "sqlite":
+		sqliteIndex, err := services.NewSQLiteMetadataIndex(config.SQLitePath)
+		if err != nil {
+			log.Fatalf("Failed to initialize SQLite metadata store: %v", err)
+		}
+		defer sqliteIndex.Close()
+		metadataIndex = sqliteIndex
+		log.Printf("Using SQLite metadata store at %s", config.SQLitePath)
+	case "memory", "":
+		metadataIndex = services.NewMemoryMetadataIndex()
+	default:
+		log.Fatalf("Unknown metadata store %q; use memory, sqlite or postgres", config.MetadataStore)
+	}
+	payloadService.AddObserver(metadataIndex)
+	payloadService.SetMetadataIndex(metadataIndex)
+	// Database metadata stores also log every request, served at /requests
+	requestLog, _ := metadataIndex.(services.RequestLog)
+	if requestLog != nil {
+		payloadService.SetRequestLog(requestLog)
+	}
+	indexRebuilder := services.NewIndexRebuilder(storageService, metadataIndex)
+	if len(os.Args) > 1 && os.Args[1] == "rebuild-index" {
+		result, err := indexRebuilder.Rebuild()
+		if err != nil {
+			log.Fatalf("Index rebuild failed: %v", err)
+		}
+		log.Printf("Rebuilt metadata index: %d scanned, %d indexed, %d removed, %d failed",
+			result.Scanned, result.Indexed, result.Removed, len(result.Failed))
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "depotfs" {
+		if len(os.Args) < 3 {
+			log.Fatal("Usage: simple-depot depotfs <mountpoint>")
+		}
+		if err := runDepotFS(config, indexRebuilder, services.NewDepotFS(metadataIndex, storageService), os.Args[2]); err != nil {
+			log.Fatalf("depotfs failed: %v", err)
+		}
+		return
+	}
+
+	// Record an ordered feed of storage changes
+	changeJournal, err := services.NewChangeJournal(config.ChangesFile, int(config.ChangesRetention))
+	if err != nil {
+		log.Fatalf("Failed to initialize changes feed: %v", err)
+	}
+	payloadService.AddObserver(changeJournal)
+
+	// Evict the oldest payloads once the configured quota is exceeded
+	var evictor *services.QuotaEvictor
+	if config.QuotaBytes > 0 {
+		evictor = services.NewQuotaEvictor(metadataIndex, payloadService, config.QuotaBytes, config.EvictionPolicy, config.TagPriorities)
+		payloadService.AddObserver(evictor)
+		log.Printf("Quota eviction enabled: %d bytes, policy=%s", config.QuotaBytes, config.EvictionPolicy)
+	}
+
+	// An empty index, as the in-memory one is after every restart, is seeded from the
+	// bucket, so eviction and tiering count the payloads stored before the restart
+	if len(metadataIndex.List()) == 0 {
+		go func() {
+			result, err := indexRebuilder.Rebuild()
+			if err != nil {
+				log.Printf("Error seeding metadata index: %v", err)
+				return
+			}
+			log.Printf("Seeded metadata index with %d of %d stored object(s)", result.Indexed, result.Scanned)
+			if evictor != nil {
+				evictor.Schedule()
+			}
+		}()
+	}
+
+	// Move aged payloads to the archive bucket, restoring them on demand
+	if config.ArchiveAfterDays > 0 {
+		archiveConfig := *config
+		archiveConfig.MinioBucket = config.ArchiveBucket
+		archiveConfig.MinioStorageClass = config.ArchiveStorageClass
+		archiveConfig.MinioObjectLock = false
+		minioArchive, err := services.NewMinioService(&archiveConfig)
+		if err != nil {
+			log.Fatalf("Failed to initialize archive storage: %v", err)
+		}
+		var archiveService services.StorageService = minioArchive
+		if encryptedStorage != nil {
+			archiveService, err = newEncryptedStorage(config, minioArchive)
+			if err != nil {
+				log.Fatalf("Failed to initialize archive encryption: %v", err)
+			}
+		}
+		maxAge := time.Duration(config.ArchiveAfterDays) * 24 * time.Hour
+		tierer := services.NewArchiveTierer(storageService, archiveService, metadataIndex, maxAge, config.ArchiveInterval)
+		if len(deletionGuards) > 0 {
+			tierer.SetDeletionGuard(deletionGuards)
+		}
+		tierer.SetTierNotifier(payloadService)
+		payloadService.SetArchiveRestorer(tierer)
+		tierer.Start()
+		log.Printf("Archive tiering enabled: after %d day(s) to bucket %s", config.ArchiveAfterDays, config.ArchiveBucket)
+	}
+
+	// Replay or forward stored payloads to configured targets
+	var forwardTargets []services.ForwardTarget
+	if config.ForwardTargetsFile != "" {
+		forwardTargets, err = services.LoadForwardTargets(config.ForwardTargetsFile)
+		if err != nil {
+			log.Fatalf("Failed to load forward targets: %v", err)
+		}
+		log.Printf("Loaded %d forward target(s)", len(forwardTargets))
+	}
+	forwarder := services.NewPayloadForwarder(storageService, metadataIndex, forwardTargets, deliveryLog)
+	payloadService.AddObserver(forwarder)
+	knownTarget := func(name string) bool {
+		return slices.ContainsFunc(forwardTargets, func(t services.ForwardTarget) bool { return t.Name == name })
+	}
+
+	// Publish an event to Kafka or NATS for every stored payload
+	var eventPublisher *services.EventPublisher
+	if config.EventsPublisher != "" {
+		sink, err := services.NewEventSink(config)
+		if err != nil {
+			log.Fatalf("Failed to configure event publishing: %v", err)
+		}
+		eventPublisher, err = services.NewEventPublisher(sink, config.EventsFormat, int(config.EventsBuffer))
+		if err != nil {
+			log.Fatalf("Failed to configure event publishing: %v", err)
+		}
+		payloadService.AddObserver(eventPublisher)
+		log.Printf("Publishing %s events to %s %s as %s", services.EventPayloadStored, config.EventsPublisher, config.EventsTopic, config.EventsFormat)
+	}
+
+	// Remove personal data from payloads before they are stored
+	if config.RedactionRulesFile != "" {
+		rules, err := services.LoadRedactionRules(config.RedactionRulesFile)
+		if err != nil {
+			log.Fatalf("Failed to load redaction rules: %v", err)
+		}
+		redactor, err := services.NewRedactor(rules)
+		if err != nil {
+			log.Fatalf("Invalid redaction rules: %v", err)
+		}
+		if !slices.Contains(payloadService.Pipeline(), services.StageRedact) {
+			log.Fatal("DEPOT_PIPELINE must include the redact stage when DEPOT_REDACTION_RULES_FILE is set")
+		}
+		payloadService.SetRedactor(redactor)
+		log.Printf("Loaded %d redaction rule(s)", len(rules))
+	}
+
+	// Flag payloads that likely hold secrets or personal data
+	var sensitiveDetector *services.SensitiveDetector
+	if len(config.DetectSensitive) > 0 {
+		sensitiveDetector, err = services.NewSensitiveDetector(config.DetectSensitive)
+		if err != nil {
+			log.Fatalf("Invalid DEPOT_DETECT_SENSITIVE: %v", err)
+		}
+		if !slices.Contains(payloadService.Pipeline(), services.StageDetect) {
+			log.Fatal("DEPOT_PIPELINE must include the detect stage when DEPOT_DETECT_SENSITIVE is set")
+		}
+		for _, target := range config.DetectNotify {
+			if !knownTarget(target) {
+				log.Fatalf("DEPOT_DETECT_NOTIFY names unknown forward target %s", target)
+			}
+		}
+		payloadService.SetSensitiveDataDetector(sensitiveDetector, config.DetectNotify)
+		payloadService.SetRouter(forwarder)
+		log.Printf("Sensitive data detection enabled: %s", strings.Join(config.DetectSensitive, ", "))
+	}
+
+	// Tag, name, expire, forward and sample uploads by the rules they match
+	var routingRules *services.RoutingRules
+	if config.RoutingRulesFile != "" {
+		rules, err := services.LoadRoutingRules(config.RoutingRulesFile)
+		if err != nil {
+			log.Fatalf("Failed to load routing rules: %v", err)
+		}
+		routingRules = services.NewRoutingRules(rules)
+		for _, target := range routingRules.Targets() {
+			if !knownTarget(target) {
+				log.Fatalf("Routing rules notify unknown forward target %s", target)
+			}
+		}
+		payloadService.SetRoutingRules(routingRules)
+		payloadService.SetRouter(forwarder)
+		log.Printf("Loaded %d routing rule(s)", len(rules))
+	}
+
+	// Run deployment scripts that validate, transform, route and notify payloads
+	if config.ScriptsDir != "" {
+		scripts, err := services.LoadLuaScripts(config.ScriptsDir, storageService, config.ScriptTimeout, config.ScriptMaxBytes, int(config.ScriptPoolSize), config.ScriptAllowedHosts)
+		if err != nil {
+			log.Fatalf("Failed to load scripts: %v", err)
+		}
+		scripts.SetRouter(forwarder)
+		payloadService.SetPayloadScripter(scripts)
+		payloadService.AddObserver(scripts)
+		log.Printf("Loaded scripts: %s", strings.Join(scripts.Names(), ", "))
+	}
+
+	// Run an external command after every stored payload
+	if config.ExecHook != "" {
+		hookPolicy, err := services.RetryPolicy{
+			MaxAttempts: int(config.ExecHookMaxAttempts),
+			Timeout:     services.Duration(config.ExecHookTimeout),
+			Concurrency: int(config.ExecHookConcurrency),
+		}.WithDefaults()
+		if err != nil {
+			log.Fatalf("Invalid exec hook policy: %v", err)
+		}
+		execHook, err := services.NewExecHook(config.ExecHook, config.MinioBucket, hookPolicy, deliveryLog)
+		if err != nil {
+			log.Fatalf("Failed to initialize exec hook: %v", err)
+		}
+		payloadService.AddObserver(execHook)
+		log.Printf("Exec hook enabled: %s", config.ExecHook)
+	}
+
+	// Probe the full store/read/delete pipeline on demand
+	selfTester := services.NewSelfTester(payloadService, payloadService, config.SelfTestTimeout)
+	payloadService.AddObserver(selfTester)
+
+	// Run maintenance jobs on their cron schedules; a job never overlaps itself
+	// Without a maximum age the retention job only removes objects a routing rule
+	// expired or a retention class covers
+	if config.Jobs["retention"].Enabled && config.RetentionMaxAge <= 0 && config.RoutingRulesFile == "" && len(config.RetentionClasses) == 0 {
+		log.Fatal("DEPOT_RETENTION_MAX_AGE, DEPOT_RETENTION_CLASSES or DEPOT_ROUTING_RULES_FILE is required for the retention job")
+	}
+	retentionSweeper := services.NewRetentionSweeper(metadataIndex, payloadService, config.RetentionMaxAge)
+	retentionSweeper.SetClasses(config.RetentionClasses)
+	// Let the bucket's lifecycle rules expire payloads by age instead of the retention job
+	if config.RetentionLifecycle {
+		expirer, ok := backend.(services.LifecycleExpirer)
+		if !ok {
+			log.Fatal("DEPOT_RETENTION_LIFECYCLE needs the minio or s3 storage backend without MINIO_REPLICA_ENDPOINTS or DEPOT_TENANT_BUCKETS")
+		}
+		rules := retentionSweeper.ExpiryRules()
+		if err := expirer.SetExpiryRules(rules, retentionSweeper.LifecycleClass); err != nil {
+			log.Fatalf("Failed to set lifecycle expiry rules: %v", err)
+		}
+		retentionSweeper.SetServerSideExpiry(true)
+		log.Printf("Payloads expire server-side through %d lifecycle rule(s)", len(rules))
+	}
+	statsRollup := services.NewStatsRollup(metadataIndex)
+	jobs := map[string]services.JobFunc{
+		"retention": retentionSweeper.Sweep,
+		"gc": func() (string, error) {
+			result, err := indexRebuilder.Rebuild()
+			return fmt.Sprintf("%d scanned, %d stale record(s) removed, %d failed", result.Scanned, result.Removed, len(result.Failed)), err
+		},
+		"scrub":  services.NewScrubber(storageService, metadataIndex).Scrub,
+		"stats":  statsRollup.Rollup,
+		"backup": services.NewIndexBackup(metadataIndex, config.BackupDir, int(config.BackupKeep)).Backup,
+	}
+	if dedupStorage != nil {
+		jobs["dedup"] = dedupStorage.CollectGarbage
+	}
+	// Account requests per namespace for charging storage back to its users
+	var usageLedger *services.UsageLedger
+	if config.NamespaceHeader != "" {
+		var err error
+		if usageLedger, err = services.NewUsageLedger(config.UsageFile); err != nil {
+			log.Fatalf("Failed to load usage: %v", err)
+		}
+		if config.UsageFile != "" {
+			jobs["usage"] = usageLedger.Save
+		}
+	}
+	scheduler := services.NewScheduler()
+	for name, run := range jobs {
+		job := config.Jobs[name]
+		if err := scheduler.Add(name, job.Schedule, job.Enabled, run); err != nil {
+			log.Fatalf("Invalid maintenance job: %v", err)
+		}
+		if job.Enabled {
+			log.Printf("Scheduled job %s: %s", name, job.Schedule)
+		}
+	}
+	scheduler.Start()
+
+	// Create HTTP handlers with dependencies
 	httpHandler := handlers.NewHTTPHandler(payloadService, responseFormatter, filenameExtractor)
+	uploadTracker := services.NewUploadTracker(config.UploadStallAfter, config.UploadProgressRetention)
+	httpHandler.SetUploadTracker(uploadTracker)
+	httpHandler.SetMaxInlineBytes(config.GetMaxInlineBytes)
+	httpHandler.SetSyncStore(config.SyncStore)
+	httpHandler.SetStreamThreshold(config.StreamThreshold)
+	httpHandler.SetMaxBodySize(config.MaxBodySize)
+	httpHandler.SetKeepContentEncoding(config.KeepContentEncoding)
+	uploadHandler := handlers.NewUploadHandler(uploadTracker)
+	resumableUploadHandler := handlers.NewResumableUploadHandler(services.NewResumableUploads(payloadService, config.UploadSessionTimeout), filenameExtractor, responseFormatter)
+	resumableUploadHandler.SetMaxBodySize(config.MaxBodySize)
+	storeStatusHandler := handlers.NewStoreStatusHandler(storeStatuses)
+	searchHandler := handlers.NewSearchHandler(metadataIndex, responseFormatter)
+	feedHandler := handlers.NewFeedHandler(changeJournal, storageService, previewer, responseFormatter)
+	previewHandler := handlers.NewPreviewHandler(storageService, previewer)
+	queryEvaluator := services.NewGojqQueryEvaluator(config.QueryTimeout, int(config.QueryMaxResults))
+	queryHandler := handlers.NewQueryHandler(storageService, queryEvaluator)
+	exporter := services.NewDefaultExporter(metadataIndex, storageService, queryEvaluator)
+	exporter.SetLimits(int(config.ExportMaxRows), config.ExportMaxBytes)
+	exportHandler := handlers.NewExportHandler(exporter)
+	replayHandler := handlers.NewReplayHandler(forwarder)
+	deliveriesHandler := handlers.NewDeliveriesHandler(deliveryLog)
+	adminHandler := handlers.NewAdminHandler(selfTester, indexRebuilder)
+	statsHandler := handlers.NewStatsHandler(statsRollup, scheduler)
+	if routingRules != nil {
+		statsHandler.SetDropCounter(routingRules)
+	}
+	if sensitiveDetector != nil {
+		statsHandler.SetSensitiveStats(sensitiveDetector)
+	}
+	if faultInjector != nil {
+		statsHandler.SetFaultCounter(faultInjector)
+	}
+	appendHandler := handlers.NewAppendHandler(payloadService, filenameExtractor)
+	webhookHandler := handlers.NewWebhookHandler(payloadService, responseFormatter)
+	webhookHandler.SetGitHubSecret(config.GitHubWebhookSecret)
+	webhookHandler.SetStripeSecret(config.StripeWebhookSecret, config.StripeTolerance)
+	webhookHandler.SetMaxBodySize(config.WebhookMaxBodySize)
+	if config.PolicyPath != "" {
+		policy, err := services.LoadRegoPolicy(config.PolicyPath, config.PolicyTimeout)
+		if err != nil {
+			log.Fatalf("Failed to load admission policy: %v", err)
+		}
+		httpHandler.SetAdmissionPolicy(policy)
+		appendHandler.SetAdmissionPolicy(policy)
+		resumableUploadHandler.SetAdmissionPolicy(policy)
+		webhookHandler.SetAdmissionPolicy(policy)
+		log.Printf("Admission policy loaded from %s", config.PolicyPath)
+	}
+	var legalHoldManager services.LegalHoldManager
+	if legalHolds != nil {
+		legalHoldManager = legalHolds
+	}
+	legalHoldHandler := handlers.NewLegalHoldHandler(legalHoldManager)
+	var usageReporter services.UsageReporter
+	if usageLedger != nil {
+		usageReporter = usageLedger
+	}
+	usageHandler := handlers.NewUsageHandler(usageReporter)
+	var retentionManager services.RetentionManager
+	if objectRetention != nil {
+		retentionManager = objectRetention
+	}
+	retentionHandler := handlers.NewRetentionHandler(retentionManager)
+
+	middleware := handlers.NewMiddlewareChain()
+	middleware.Register(handlers.MiddlewareLog, handlers.NewAccessLog(logger).Wrap)
+	if len(config.Middleware) > 0 {
+		if err := middleware.SetOrder(config.Middleware); err != nil {
+			log.Fatalf("Invalid DEPOT_MIDDLEWARE: %v", err)
+		}
+	}
+	// Let browser scripts on the allowed origins call the depot
+	allowOrigins := func(path string, handler http.HandlerFunc) http.HandlerFunc { return handler }
+	if len(config.CORSOrigins) > 0 {
+		cors := handlers.NewCORS(config.CORSOrigins, config.CORSMethods, config.CORSHeaders, config.CORSCredentials, config.CORSMaxAge)
+		middleware.Register(handlers.MiddlewareCORS, cors.Wrap)
+		allowOrigins = cors.Wrap
+		log.Printf("CORS enabled for origins %v", config.CORSOrigins)
+	}
+	// Require a bearer token from the OIDC issuer on every route but the public ones
+	authenticate := func(path string, handler http.HandlerFunc) http.HandlerFunc { return handler }
+	if config.OIDCIssuer != "" || config.OIDCJWKSURL != "" {
+		verifier, err := services.NewOIDCVerifier(config.OIDCIssuer, config.OIDCJWKSURL, config.OIDCAudience)
+		if err != nil {
+			log.Fatalf("Failed to initialize token verification: %v", err)
+		}
+		publicRoutes := config.AuthPublicRoutes
+		if len(publicRoutes) == 0 {
+			publicRoutes = handlers.DefaultPublicRoutes
+		}
+		bearerAuth := handlers.NewBearerAuth(verifier, publicRoutes)
+		bearerAuth.SetRouteScopes(config.AuthRouteScopes)
+		middleware.Register(handlers.MiddlewareAuth, bearerAuth.Wrap)
+		authenticate = bearerAuth.Wrap
+		log.Printf("Bearer token authentication enabled: issuer=%s, public routes=%v", config.OIDCIssuer, publicRoutes)
+	}
+	// Scope every request to its tenant's objects
+	scopeTenant := func(path string, handler http.HandlerFunc) http.HandlerFunc { return handler }
+	if config.TenantHeader != "" || len(config.TenantAPIKeys) > 0 {
+		exempt := config.AuthPublicRoutes
+		if len(exempt) == 0 {
+			exempt = handlers.DefaultPublicRoutes
+		}
+		tenants := handlers.NewTenantScope(config.TenantHeader, config.TenantAPIKeys, exempt)
+		middleware.Register(handlers.MiddlewareTenant, tenants.Wrap)
+		scopeTenant = tenants.Wrap
+		log.Printf("Tenant scoping enabled: %d API key(s), tenant header=%q", len(config.TenantAPIKeys), config.TenantHeader)
+	}
+	// Limit each client's request rate, by tenant, token subject, API key or IP
+	if config.RateLimit > 0 || len(config.RateLimitClients) > 0 {
+		limiter := handlers.NewRateLimiter(config.RateLimit, int(config.RateLimitBurst), config.RateLimitClients)
+		middleware.Register(handlers.MiddlewareRateLimit, limiter.Wrap)
+		log.Printf("Rate limiting enabled: %g requests/s per client, burst %d, %d client override(s)", config.RateLimit, config.RateLimitBurst, len(config.RateLimitClients))
+	}
+	maintenanceHandler := handlers.NewMaintenanceHandler(maintenanceMode)
+	middleware.Register(handlers.MiddlewareMaintenance, maintenanceHandler.Wrap)
+
+	// Shed low-priority traffic under overload; long-polling routes are never shed
+	if config.ShedMaxInFlight > 0 || config.ShedTargetLatency > 0 {
+		priorities := make(map[string]int)
+		for path, priority := range handlers.DefaultRoutePriorities {
+			priorities[path] = priority
+		}
+		for path, priority := range config.RoutePriorities {
+			priorities[path] = priority
+		}
+		shedder := handlers.NewLoadShedder(int(config.ShedMaxInFlight), config.ShedTargetLatency, priorities)
+		middleware.Register(handlers.MiddlewareShed, shedder.Wrap)
+		log.Printf("Load shedding enabled: max in-flight=%d, target latency=%s", config.ShedMaxInFlight, config.ShedTargetLatency)
+	}
+	if usageLedger != nil {
+		middleware.Register(handlers.MiddlewareUsage, handlers.NewUsageMeter(config.NamespaceHeader, usageLedger).Wrap)
+		log.Printf("Usage accounting enabled: namespaces read from %s", config.NamespaceHeader)
+	}
+	// Provision a bucket from the template for every new namespace
+	if config.BucketTemplateFile != "" {
+		if config.NamespaceHeader == "" {
+			log.Fatal("DEPOT_BUCKET_TEMPLATE_FILE needs DEPOT_NAMESPACE_HEADER")
+		}
+		template, err := services.LoadBucketTemplate(config.BucketTemplateFile)
+		if err != nil {
+			log.Fatalf("Failed to load bucket template: %v", err)
+		}
+		admin, ok := backend.(services.BucketAdmin)
+		if !ok {
+			log.Fatal("Bucket provisioning needs the minio storage backend without MINIO_REPLICA_ENDPOINTS or DEPOT_TENANT_BUCKETS")
+		}
+		provisioner := services.NewBucketProvisioner(admin, template)
+		middleware.Register(handlers.MiddlewareProvision, handlers.NewBucketProvisioning(config.NamespaceHeader, provisioner).Wrap)
+		log.Printf("Provisioning buckets for new namespaces from %s", config.BucketTemplateFile)
+	}
+	if active := middleware.Active(); len(active) > 0 {
+		log.Printf("Middleware: %s", strings.Join(active, " -> "))
+	}
+	// Long-polling routes skip the chain, but not authentication or tenant scoping
+	// when they are active
+	if !slices.Contains(middleware.Active(), handlers.MiddlewareAuth) {
+		authenticate = func(path string, handler http.HandlerFunc) http.HandlerFunc { return handler }
+	}
+	if !slices.Contains(middleware.Active(), handlers.MiddlewareTenant) {
+		scopeTenant = func(path string, handler http.HandlerFunc) http.HandlerFunc { return handler }
+	}
+	stream := func(path string, handler http.HandlerFunc) http.HandlerFunc {
+		return authenticate(path, scopeTenant(path, handler))
+	}
+	// Admin routes need the admin key, or a token with the admin scope
+	adminScope := config.AdminScope
+	if !slices.Contains(middleware.Active(), handlers.MiddlewareAuth) {
+		adminScope = ""
+	}
+	adminAuth := handlers.NewAdminAuth(config.AdminKey, adminScope)
+	if config.AdminKey == "" && adminScope == "" {
+		log.Printf("Admin routes are disabled: set DEPOT_ADMIN_KEY or enable bearer authentication")
+	}
+	route := func(path string, handler func(http.ResponseWriter, *http.Request)) {
+		wrapped := http.Handler(middleware.Wrap(path, handler))
+		if config.Tracing {
+			// Spans are named after the route, and continue the caller's trace
+			wrapped = otelhttp.NewHandler(wrapped, path)
+		}
+		http.Handle(path, wrapped)
+	}
 
 	// Setup routes
-	http.HandleFunc("/depot", httpHandler.DepotHandler)
-	http.HandleFunc("/list", httpHandler.ListHandler)
-	http.HandleFunc("/get", httpHandler.GetHandler)
+	route("/depot", httpHandler.DepotHandler)
+	route("/append", appendHandler.AppendHandler)
+	route("/upload/", uploadHandler.ProgressHandler)
+	route("/uploads", resumableUploadHandler.CreateHandler)
+	route("/uploads/", resumableUploadHandler.SessionHandler)
+	route("/status", storeStatusHandler.StatusHandler)
+	if writeAheadQueue != nil {
+		route("/queue/status", handlers.NewQueueHandler(writeAheadQueue).StatusHandler)
+	}
+	if requestLog != nil {
+		route("/requests", handlers.NewRequestsHandler(requestLog).RequestsHandler)
+	}
+	route("/legal-hold", legalHoldHandler.LegalHoldHandler)
+	route("/list", httpHandler.ListHandler)
+	route("/stats", statsHandler.StatsHandler)
+	route("/usage", usageHandler.UsageHandler)
+	route("/get", httpHandler.GetHandler)
+	route("/delete", httpHandler.DeleteHandler)
+	route("/find", searchHandler.FindHandler)
+	route("/changes", feedHandler.ChangesHandler)
+	http.HandleFunc("/wait", stream("/wait", feedHandler.WaitHandler))
+	http.HandleFunc("/ws/tail", stream("/ws/tail", feedHandler.TailHandler))
+	http.HandleFunc("/ws", stream("/ws", feedHandler.WatchHandler))
+	http.HandleFunc("/events", allowOrigins("/events", stream("/events", feedHandler.EventsHandler)))
+	route("/preview", previewHandler.PreviewHandler)
+	route("/query", queryHandler.QueryHandler)
+	route("/export", exportHandler.ExportHandler)
+	route("/replay", replayHandler.ReplayHandler)
+	route("/deliveries", deliveriesHandler.DeliveriesHandler)
+	route("/deliveries/redrive", deliveriesHandler.RedriveHandler)
+	route("/admin/selftest", adminAuth.Wrap("/admin/selftest", adminHandler.SelfTestHandler))
+	route("/admin/reindex", adminAuth.Wrap("/admin/reindex", adminHandler.ReindexHandler))
+	route("/admin/retention", adminAuth.Wrap("/admin/retention", retentionHandler.RetentionHandler))
+	route(handlers.MaintenanceRoute, adminAuth.Wrap(handlers.MaintenanceRoute, maintenanceHandler.MaintenanceHandler))
+	if config.GitHubWebhookSecret != "" {
+		route("/webhooks/github", webhookHandler.GitHubHandler)
+	}
+	if config.StripeWebhookSecret != "" {
+		route("/webhooks/stripe", webhookHandler.StripeHandler)
+	}
+
+	// Ingest files dropped into a local directory, tagged by their subfolders
+	if config.WatchDir != "" {
+		if info, err := os.Stat(config.WatchDir); err != nil || !info.IsDir() {
+			log.Fatalf("DEPOT_WATCH_DIR %s is not a directory", config.WatchDir)
+		}
+		watcher := services.NewFolderWatcher(config.WatchDir, payloadService, contentTypeDetector, config.WatchInterval)
+		if config.WatchArchiveDir != "" {
+			watcher.SetArchiveDir(config.WatchArchiveDir)
+		}
+		payloadService.AddObserver(watcher)
+		watcher.Start()
+		log.Printf("Watching %s for new files every %s", config.WatchDir, config.WatchInterval)
+	}
+
+	// Import objects dropped directly into another bucket
+	if config.IngestBucket != "" {
+		if config.IngestBucket == config.MinioBucket {
+			log.Fatalf("DEPOT_INGEST_BUCKET must differ from MINIO_BUCKET")
+		}
+		sourceConfig := *config
+		sourceConfig.MinioBucket = config.IngestBucket
+		source, err := services.NewMinioService(&sourceConfig)
+		if err != nil {
+			log.Fatalf("Failed to connect to ingest bucket %s: %v", config.IngestBucket, err)
+		}
+		ingester, err := services.NewBucketIngester(source, payloadService, contentTypeDetector, config.IngestMode, config.IngestInterval)
+		if err != nil {
+			log.Fatalf("Invalid DEPOT_INGEST_MODE: %v", err)
+		}
+		ingester.SetDeleteSource(config.IngestDelete)
+		payloadService.AddObserver(ingester)
+		if err := ingester.Start(); err != nil {
+			log.Fatalf("Failed to start bucket ingestion: %v", err)
+		}
+		log.Printf("Importing new objects from bucket %s (%s mode)", config.IngestBucket, config.IngestMode)
+	}
+
+	// Archive messages from Kafka topics
+	if len(config.KafkaTopics) > 0 {
+		reader, err := services.NewKafkaReader(config)
+		if err != nil {
+			log.Fatalf("Failed to configure Kafka consumer: %v", err)
+		}
+		consumer := services.NewKafkaConsumer(reader, payloadService, contentTypeDetector)
+		payloadService.AddObserver(consumer)
+		go consumer.Run(context.Background())
+		log.Printf("Consuming Kafka topics %s as group %s", strings.Join(config.KafkaTopics, ", "), config.KafkaGroup)
+	}
+
+	// Store messages from MQTT topics, such as IoT telemetry
+	if len(config.MQTTTopics) > 0 {
+		subscriber := services.NewMQTTSubscriber(payloadService, contentTypeDetector)
+		payloadService.AddObserver(subscriber)
+		if err := subscriber.Start(config); err != nil {
+			log.Fatalf("Failed to start MQTT subscriber: %v", err)
+		}
+		log.Printf("Subscribing to MQTT topics %s", strings.Join(config.MQTTTopics, ", "))
+	}
+
+	// Serve stored payloads to SFTP clients as /<date>/<request_id>/<file>
+	if config.SFTPAddr != "" {
+		sftpServer, err := newSFTPServer(config, metadataIndex, storageService, payloadService)
+		if err != nil {
+			log.Fatalf("Failed to configure SFTP server: %v", err)
+		}
+		go func() {
+			if err := sftpServer.ListenAndServe(config.SFTPAddr); err != nil {
+				log.Fatalf("SFTP server failed: %v", err)
+			}
+		}()
+		log.Printf("SFTP server listening on %s (writable: %t)", config.SFTPAddr, config.SFTPWritable)
+	}
+
+	// Serve the same tree to partners that can only use FTP(S)
+	if config.FTPAddr != "" {
+		ftpServer, err := newFTPServer(config, metadataIndex, storageService, payloadService)
+		if err != nil {
+			log.Fatalf("Failed to configure FTP server: %v", err)
+		}
+		go func() {
+			if err := ftpServer.ListenAndServe(config.FTPAddr); err != nil {
+				log.Fatalf("FTP server failed: %v", err)
+			}
+		}()
+		log.Printf("FTP server listening on %s (writable: %t, TLS required: %t)", config.FTPAddr, config.FTPWritable, config.FTPRequireTLS)
+	}
+
+	// Let support engineers mount the depot as a network drive
+	if config.WebDAVAddr != "" {
+		if len(config.WebDAVUsers) == 0 {
+			log.Fatalf("Failed to configure WebDAV server: set DEPOT_WEBDAV_USERS")
+		}
+		fsys := services.NewDepotFS(metadataIndex, storageService)
+		if config.WebDAVWritable {
+			fsys.SetWriter(payloadService, payloadService)
+		}
+		webdavHandler := frontends.NewWebDAVHandler(fsys, config.WebDAVUsers)
+		go func() {
+			if err := http.ListenAndServe(config.WebDAVAddr, webdavHandler); err != nil {
+				log.Fatalf("WebDAV server failed: %v", err)
+			}
+		}()
+		log.Printf("WebDAV server listening on %s (writable: %t)", config.WebDAVAddr, config.WebDAVWritable)
+	}
 
 	serverAddr := ":" + config.ServerPort
-	log.Printf("Server listening on %s", serverAddr)
-	if err := http.ListenAndServe(serverAddr, nil); err != nil {
-		log.Fatal(err)
+	server := &http.Server{
+		Addr:              serverAddr,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+	server.TLSConfig, err = serverTLSConfig(config)
+	if err != nil {
+		log.Fatalf("Failed to set up HTTPS: %v", err)
+	}
+	server.RegisterOnShutdown(feedHandler.CloseStreams)
+	go func() {
+		var err error
+		if server.TLSConfig != nil {
+			// The certificate is in TLSConfig; net/http negotiates HTTP/2 over TLS
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	if server.TLSConfig != nil {
+		log.Printf("Server listening on %s (HTTPS, HTTP/2)", serverAddr)
+	} else {
+		log.Printf("Server listening on %s", serverAddr)
+	}
+
+	// On SIGTERM or SIGINT, stop accepting requests, then wait for those in flight and
+	// for accepted payloads still being saved, so a restart loses none of them
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	received := <-interrupts
+	log.Printf("Received %s, shutting down within %s", received, config.ShutdownTimeout)
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error waiting for requests in flight: %v", err)
+	}
+	// Saves get a deadline of their own, so slow requests cannot use up their time
+	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	if err := payloadService.Drain(ctx); err != nil {
+		log.Printf("Gave up waiting for payloads still being saved: %v", err)
+		return
+	}
+	log.Printf("All accepted payloads are saved")
+	if eventPublisher != nil {
+		if err := eventPublisher.Close(ctx); err != nil {
+			log.Printf("Gave up publishing queued events: %v", err)
+		}
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Error flushing traces: %v", err)
+	}
+}
+
+// runDepotFS mounts the depot read-only at mountpoint, one directory per request, until
+// it is unmounted or interrupted. Without a shared Postgres index, the index is built
+// from storage and refreshed every DepotFSRefresh.
+func runDepotFS(config *config.Config, rebuilder *services.IndexRebuilder, fsys *services.DepotFS, mountpoint string) error {
+	if config.MetadataStore != "postgres" {
+		result, err := rebuilder.Rebuild()
+		if err != nil {
+			return fmt.Errorf("error indexing storage: %v", err)
+		}
+		log.Printf("Indexed %d object(s)", result.Indexed)
+		if config.DepotFSRefresh > 0 {
+			go func() {
+				for range time.Tick(config.DepotFSRefresh) {
+					if _, err := rebuilder.Rebuild(); err != nil {
+						log.Printf("depotfs: refreshing index failed: %v", err)
+					}
+				}
+			}()
+		}
+	}
+
+	fsys.SetFlat(true)
+	mount, err := frontends.MountFUSE(fsys, mountpoint)
+	if err != nil {
+		return err
+	}
+	log.Printf("Mounted the depot read-only at %s; press Ctrl+C or run 'fusermount -u %s' to unmount", mountpoint, mountpoint)
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupts
+		if err := mount.Unmount(); err != nil {
+			log.Printf("Unmount failed: %v", err)
+		}
+	}()
+	mount.Wait()
+	return nil
+}
+
+// newSFTPServer builds the SFTP frontend over a view of the metadata index
+func newSFTPServer(config *config.Config, index services.MetadataIndex, storage services.StorageService, payloadService *services.DefaultPayloadService) (*frontends.SFTPServer, error) {
+	hostKey, err := frontends.LoadHostKey(config.SFTPHostKey)
+	if err != nil {
+		return nil, fmt.Errorf("error loading host key: %v", err)
+	}
+	if config.SFTPHostKey == "" {
+		log.Printf("DEPOT_SFTP_HOST_KEY is not set; the SFTP host key changes on every restart")
+	}
+	var authorizedKeys []ssh.PublicKey
+	if config.SFTPAuthorizedKeys != "" {
+		if authorizedKeys, err = frontends.LoadAuthorizedKeys(config.SFTPAuthorizedKeys); err != nil {
+			return nil, err
+		}
+	}
+	if len(config.SFTPUsers) == 0 && len(authorizedKeys) == 0 {
+		return nil, fmt.Errorf("set DEPOT_SFTP_USERS or DEPOT_SFTP_AUTHORIZED_KEYS")
+	}
+
+	fsys := services.NewDepotFS(index, storage)
+	if config.SFTPWritable {
+		fsys.SetWriter(payloadService, payloadService)
+	}
+	return frontends.NewSFTPServer(fsys, hostKey, config.SFTPUsers, authorizedKeys), nil
+}
+
+// serverTLSConfig loads the HTTPS certificate, or generates a self-signed one, and
+// returns nil when the depot serves plain HTTP
+func serverTLSConfig(config *config.Config) (*tls.Config, error) {
+	var cert tls.Certificate
+	switch {
+	case config.TLSCert != "" || config.TLSKey != "":
+		if config.TLSSelfSigned {
+			return nil, fmt.Errorf("set either DEPOT_TLS_CERT and DEPOT_TLS_KEY or DEPOT_TLS_SELF_SIGNED, not both")
+		}
+		var err error
+		if cert, err = tls.LoadX509KeyPair(config.TLSCert, config.TLSKey); err != nil {
+			return nil, fmt.Errorf("error loading TLS certificate: %v", err)
+		}
+	case config.TLSSelfSigned:
+		var err error
+		if cert, err = services.SelfSignedCertificate(config.TLSHosts, 365*24*time.Hour); err != nil {
+			return nil, err
+		}
+		log.Printf("Generated a self-signed certificate; clients will not trust it")
+	default:
+		return nil, nil
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// newFTPServer builds the FTP frontend over a view of the metadata index
+func newFTPServer(config *config.Config, index services.MetadataIndex, storage services.StorageService, payloadService *services.DefaultPayloadService) (*frontends.FTPServer, error) {
+	if len(config.FTPUsers) == 0 {
+		return nil, fmt.Errorf("set DEPOT_FTP_USERS")
+	}
+	fsys := services.NewDepotFS(index, storage)
+	if config.FTPWritable {
+		fsys.SetWriter(payloadService, payloadService)
+	}
+	server := frontends.NewFTPServer(fsys, config.FTPUsers)
+
+	if config.FTPTLSCert != "" || config.FTPTLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(config.FTPTLSCert, config.FTPTLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("error loading TLS certificate: %v", err)
+		}
+		server.SetTLS(&tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, config.FTPRequireTLS)
+	} else if config.FTPRequireTLS {
+		return nil, fmt.Errorf("DEPOT_FTP_REQUIRE_TLS needs DEPOT_FTP_TLS_CERT and DEPOT_FTP_TLS_KEY")
+	}
+
+	var minPort, maxPort int
+	if config.FTPPassivePorts != "" {
+		low, high, _ := strings.Cut(config.FTPPassivePorts, "-")
+		var errLow, errHigh error
+		minPort, errLow = strconv.Atoi(strings.TrimSpace(low))
+		maxPort, errHigh = strconv.Atoi(strings.TrimSpace(high))
+		if errLow != nil || errHigh != nil || minPort <= 0 || maxPort < minPort || maxPort > 65535 {
+			return nil, fmt.Errorf("invalid DEPOT_FTP_PASSIVE_PORTS %q, expected <min>-<max>", config.FTPPassivePorts)
+		}
+	}
+	server.SetPassive(config.FTPPublicHost, minPort, maxPort)
+	return server, nil
+}
+
+// newEncryptedStorage wraps storage with at-rest encryption, or returns nil when
+// neither static keys nor an external key manager are configured
+func newEncryptedStorage(config *config.Config, inner services.StorageService) (*services.EncryptedStorage, error) {
+	var keyring *services.Keyring
+	if config.EncryptionKeys != "" {
+		keys, err := services.ParseEncryptionKeys(config.EncryptionKeys)
+		if err != nil {
+			return nil, err
+		}
+		if keyring, err = services.NewKeyring(keys, config.EncryptionActiveKey); err != nil {
+			return nil, err
+		}
+	}
+
+	switch config.EncryptionProvider {
+	case "kms":
+		if config.KMSKeyID == "" {
+			return nil, fmt.Errorf("DEPOT_KMS_KEY_ID is required for the kms provider")
+		}
+		wrapper, err := services.NewAWSKMSWrapper(config.KMSKeyID, config.KMSRegion)
+		if err != nil {
+			return nil, err
+		}
+		return services.NewEnvelopeStorage(inner, wrapper, keyring), nil
+	case "vault":
+		if config.VaultTransitKey == "" {
+			return nil, fmt.Errorf("DEPOT_VAULT_TRANSIT_KEY is required for the vault provider")
+		}
+		wrapper := services.NewVaultTransitWrapper(config.VaultAddress, config.VaultToken, config.VaultTransitMount, config.VaultTransitKey)
+		return services.NewEnvelopeStorage(inner, wrapper, keyring), nil
+	case "":
+		if keyring == nil {
+			return nil, nil
+		}
+		return services.NewEncryptedStorage(inner, keyring), nil
+	default:
+		return nil, fmt.Errorf("unknown encryption provider %q", config.EncryptionProvider)
 	}
 }
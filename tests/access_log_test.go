@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+)
+
+func TestAccessLog_CorrelatesRequestLines(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&out, nil))
+	depot := newTestDepot(NewMockStorageService())
+	depot.httpHandler.SetSyncStore(true)
+
+	chain := handlers.NewMiddlewareChain()
+	chain.Register(handlers.MiddlewareLog, handlers.NewAccessLog(logger).Wrap)
+	chain.Register(handlers.MiddlewareTenant, handlers.NewTenantScope("X-Tenant", nil, nil).Wrap)
+	handler := chain.Wrap("/depot", depot.httpHandler.DepotHandler)
+
+	req := httptest.NewRequest("POST", "/depot", strings.NewReader(`{"a":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant", "acme")
+	req.Header.Set("X-Depot-Request-Id", "order-42")
+	handler(httptest.NewRecorder(), req)
+
+	lines := map[string]map[string]any{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var fields map[string]any
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			t.Fatalf("Expected JSON log lines, got %q", line)
+		}
+		if strings.Count(line, `"request_id"`) > 1 {
+			t.Errorf("Expected request_id logged once per line, got %s", line)
+		}
+		lines[fields["msg"].(string)] = fields
+	}
+	for _, msg := range []string{"payload saved", "payload accepted", "request"} {
+		fields, ok := lines[msg]
+		if !ok {
+			t.Errorf("Expected a %q line, got %s", msg, out.String())
+			continue
+		}
+		if fields["request_id"] != "acme.order-42" || fields["tenant"] != "acme" || fields["method"] != "POST" {
+			t.Errorf("Expected the %q line correlated with its request, got %v", msg, fields)
+		}
+	}
+	if access := lines["request"]; access != nil && (access["status"] != float64(200) || access["latency_ms"] == nil) {
+		t.Errorf("Expected the access line to carry status and latency, got %v", access)
+	}
+}
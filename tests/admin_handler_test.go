@@ -0,0 +1,179 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// runSelfTest calls POST /admin/selftest and decodes the report
+func runSelfTest(t *testing.T, depot *testDepot, timeout time.Duration) (int, services.SelfTestReport) {
+	t.Helper()
+	selfTester := services.NewSelfTester(depot.payloadService, depot.payloadService, timeout)
+	depot.payloadService.AddObserver(selfTester)
+	handler := handlers.NewAdminHandler(selfTester, nil)
+
+	w := httptest.NewRecorder()
+	handler.SelfTestHandler(w, httptest.NewRequest("POST", "/admin/selftest", nil))
+	var report services.SelfTestReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	return w.Code, report
+}
+
+func TestSelfTestHandler_RunsAllStages(t *testing.T) {
+	receiver, received := newReceiver(t, http.StatusOK)
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	depot.payloadService.AddObserver(services.NewPayloadForwarder(mockService, depot.metadataIndex, []services.ForwardTarget{
+		{Name: "live", URL: receiver.URL, Forward: true},
+	}, depot.deliveryLog))
+
+	code, report := runSelfTest(t, depot, time.Second)
+	if code != http.StatusOK || !report.OK {
+		t.Fatalf("Expected a passing self-test, got %d: %+v", code, report)
+	}
+
+	expected := []string{
+		services.SelfTestStageStore,
+		services.SelfTestStagePersist,
+		services.SelfTestStageRead,
+		services.SelfTestStageVerify,
+		services.SelfTestStageDelete,
+	}
+	if len(report.Stages) != len(expected) {
+		t.Fatalf("Expected %d stages, got %+v", len(expected), report.Stages)
+	}
+	for i, name := range expected {
+		if report.Stages[i].Name != name || !report.Stages[i].OK {
+			t.Errorf("Stage %d: expected a passing %s, got %+v", i, name, report.Stages[i])
+		}
+	}
+
+	if objects, _ := mockService.ListPayloads(); len(objects) != 0 {
+		t.Errorf("Expected the probe to be deleted, found %v", objects)
+	}
+	if _, ok := depot.metadataIndex.Get(report.ObjectName); ok {
+		t.Error("Expected the probe to be removed from the metadata index")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(received()) != 0 {
+		t.Error("Expected the probe not to be forwarded")
+	}
+}
+
+func TestSelfTestHandler_ReportsFailedStage(t *testing.T) {
+	mockService := NewMockStorageService()
+	mockService.SetSaveError(errors.New("bucket unavailable"))
+	depot := newTestDepot(mockService)
+
+	code, report := runSelfTest(t, depot, 50*time.Millisecond)
+	if code != http.StatusServiceUnavailable || report.OK {
+		t.Fatalf("Expected a failing self-test, got %d: %+v", code, report)
+	}
+	if len(report.Stages) != 2 || report.Stages[1].Name != services.SelfTestStagePersist || report.Stages[1].Error == "" {
+		t.Errorf("Expected the run to stop at the persist stage, got %+v", report.Stages)
+	}
+
+	w := httptest.NewRecorder()
+	handlers.NewAdminHandler(nil, nil).SelfTestHandler(w, httptest.NewRequest("GET", "/admin/selftest", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status MethodNotAllowed, got %d", w.Code)
+	}
+}
+
+func TestReindexHandler_RebuildsFromStorage(t *testing.T) {
+	mockService := NewMockStorageService()
+	index := services.NewMemoryMetadataIndex()
+
+	mockService.SavePayload("1700000000_0b7d3a654f2a9c1e_payload.json", []byte(`{"a":1}`), "application/json", map[string]string{
+		services.MetadataRequestID: "1700000000_0b7d3a654f2a9c1e",
+		services.MetadataSHA256:    "stored-checksum",
+		services.MetadataTags:      "audit,eu",
+	})
+	// Written before metadata was recorded
+	mockService.SavePayload("1700000100_4f2a9c1e0b7d3a65_report.txt", []byte("hello"), "", nil)
+
+	index.PayloadStored(services.ObjectRecord{ObjectName: "gone_payload.json", StoredAt: time.Unix(1, 0)})
+	index.PayloadStored(services.ObjectRecord{ObjectName: "cold_payload.json", StorageTier: services.StorageTierArchive})
+
+	handler := handlers.NewAdminHandler(nil, services.NewIndexRebuilder(mockService, index))
+	w := httptest.NewRecorder()
+	handler.ReindexHandler(w, httptest.NewRequest("POST", "/admin/reindex", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+	var result services.RebuildResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if result.Scanned != 2 || result.Indexed != 2 || result.Removed != 1 || len(result.Failed) != 0 {
+		t.Errorf("Unexpected rebuild result %+v", result)
+	}
+
+	tagged, ok := index.Get("1700000000_0b7d3a654f2a9c1e_payload.json")
+	if !ok || tagged.RequestID != "1700000000_0b7d3a654f2a9c1e" || tagged.SHA256 != "stored-checksum" || len(tagged.Tags) != 2 || tagged.Size != 7 {
+		t.Errorf("Expected the record to come from stored metadata, got %+v", tagged)
+	}
+
+	bare, ok := index.Get("1700000100_4f2a9c1e0b7d3a65_report.txt")
+	if !ok || bare.RequestID != "1700000100_4f2a9c1e0b7d3a65" || bare.OriginalFilename != "report.txt" || bare.ContentType != "text/plain" {
+		t.Errorf("Expected the record to be derived from the object name, got %+v", bare)
+	}
+	if !bare.StoredAt.Equal(time.Unix(1700000100, 0)) || bare.SHA256 == "" {
+		t.Errorf("Expected the upload time and checksum to be recovered, got %+v", bare)
+	}
+
+	if _, ok := index.Get("gone_payload.json"); ok {
+		t.Error("Expected the record of a missing object to be removed")
+	}
+	if _, ok := index.Get("cold_payload.json"); !ok {
+		t.Error("Expected archived records to be kept")
+	}
+}
+
+func TestAdminAuth_RequiresTheAdminKeyOrScope(t *testing.T) {
+	called := 0
+	next := func(w http.ResponseWriter, r *http.Request) { called++ }
+	request := func(gate *handlers.AdminAuth, key string, claims *services.TokenClaims) int {
+		req := httptest.NewRequest("PUT", handlers.MaintenanceRoute, nil)
+		if key != "" {
+			req.Header.Set(handlers.DefaultAdminKeyHeader, key)
+		}
+		if claims != nil {
+			req = req.WithContext(handlers.WithTokenClaims(req.Context(), claims))
+		}
+		w := httptest.NewRecorder()
+		gate.Wrap(handlers.MaintenanceRoute, next)(w, req)
+		return w.Code
+	}
+
+	open := handlers.NewAdminAuth("", "")
+	if code := request(open, "anything", &services.TokenClaims{Scopes: []string{handlers.DefaultAdminScope}}); code != http.StatusForbidden {
+		t.Errorf("Expected admin routes refused without an admin key or scope, got %d", code)
+	}
+
+	gate := handlers.NewAdminAuth("s3cret", handlers.DefaultAdminScope)
+	if code := request(gate, "", nil); code != http.StatusForbidden {
+		t.Errorf("Expected an anonymous request refused, got %d", code)
+	}
+	if code := request(gate, "wrong", &services.TokenClaims{Scopes: []string{handlers.DefaultAdminScope}}); code != http.StatusForbidden {
+		t.Errorf("Expected a wrong admin key refused, got %d", code)
+	}
+	if code := request(gate, "", &services.TokenClaims{Subject: "tenant-bot", Scopes: []string{"depot:write"}}); code != http.StatusForbidden {
+		t.Errorf("Expected a token without the admin scope refused, got %d", code)
+	}
+	if called != 0 {
+		t.Fatalf("Expected no refused request to reach the handler, got %d", called)
+	}
+	request(gate, "s3cret", nil)
+	request(gate, "", &services.TokenClaims{Subject: "ops", Scopes: []string{handlers.DefaultAdminScope}})
+	if called != 2 {
+		t.Errorf("Expected the admin key and the admin scope to be let through, got %d calls", called)
+	}
+}
@@ -0,0 +1,175 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+const testPolicy = `package depot
+
+default allow := false
+
+allow if {
+	net.cidr_contains(data.trusted_networks[_], input.source_ip)
+	count(deny) == 0
+}
+
+deny contains msg if {
+	not startswith(input.content_type, "application/json")
+	msg := sprintf("content type %s is not accepted", [input.content_type])
+}
+
+deny contains "body too large" if input.size > data.max_size
+
+deny contains "uploads of unknown length are not accepted" if input.size < 0
+
+deny contains "debug uploads are only accepted during office hours" if {
+	"debug" in input.tags
+	not office_hours
+}
+
+office_hours if {
+	input.time.hour >= 9
+	input.time.hour < 17
+}
+`
+
+// loadTestPolicy writes the test policy and its data file into a directory and loads it
+func loadTestPolicy(t *testing.T, policy string) (*services.RegoPolicy, error) {
+	t.Helper()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "depot.rego"), []byte(policy), 0o644)
+	os.WriteFile(filepath.Join(dir, "data.json"), []byte(`{"trusted_networks": ["192.0.2.0/24", "10.0.0.0/8"], "max_size": 64}`), 0o644)
+	return services.LoadRegoPolicy(dir, time.Second)
+}
+
+func TestAdmissionPolicy_DepotHandler(t *testing.T) {
+	policy, err := loadTestPolicy(t, testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	depot.httpHandler.SetAdmissionPolicy(policy)
+
+	tests := []struct {
+		name        string
+		remoteAddr  string
+		contentType string
+		body        string
+		status      int
+		reason      string
+	}{
+		{"trusted JSON upload", "192.0.2.10:4000", "application/json", `{"ok": true}`, http.StatusOK, ""},
+		{"untrusted network", "203.0.113.5:4000", "application/json", `{"ok": true}`, http.StatusForbidden, "not allowed by policy"},
+		{"wrong content type", "10.1.2.3:4000", "text/plain", "hello", http.StatusForbidden, "content type text/plain is not accepted"},
+		{"too large", "10.1.2.3:4000", "application/json", `{"data": "` + strings.Repeat("x", 100) + `"}`, http.StatusForbidden, "body too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/depot", strings.NewReader(tt.body))
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			depot.httpHandler.DepotHandler(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.reason != "" {
+				var response struct {
+					Reasons []string `json:"reasons"`
+				}
+				json.Unmarshal(w.Body.Bytes(), &response)
+				if len(response.Reasons) != 1 || response.Reasons[0] != tt.reason {
+					t.Errorf("Expected reason %q, got %v", tt.reason, response.Reasons)
+				}
+			}
+		})
+	}
+}
+
+func TestAdmissionPolicy_AppendHandlerChecksBeforeReading(t *testing.T) {
+	policy, err := loadTestPolicy(t, testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	handler := handlers.NewAppendHandler(depot.payloadService, services.NewDefaultFilenameExtractor())
+	handler.SetAdmissionPolicy(policy)
+
+	req := httptest.NewRequest("POST", "/append?request_id=log-1", strings.NewReader("line\n"))
+	req.RemoteAddr = "10.0.0.1:5000"
+	req.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+	handler.AppendHandler(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected the chunk to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(mockService.payloads) != 0 {
+		t.Errorf("Expected nothing to be stored, got %d object(s)", len(mockService.payloads))
+	}
+}
+
+func TestAdmissionPolicy_TagsAndTimeOfDay(t *testing.T) {
+	policy, err := loadTestPolicy(t, testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := services.AdmissionInput{
+		SourceIP:    "10.0.0.1",
+		ContentType: "application/json",
+		Size:        10,
+		Tags:        []string{"debug"},
+	}
+	for hour, allowed := range map[int]bool{8: false, 9: true, 16: true, 17: false, 23: false} {
+		input.Time.Hour = hour
+		decision, err := policy.Evaluate(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decision.Allowed != allowed {
+			t.Errorf("Hour %d: expected allowed=%v, got %+v", hour, allowed, decision)
+		}
+	}
+
+	input.Tags = nil
+	input.Size = -1
+	if decision, _ := policy.Evaluate(input); decision.Allowed || decision.Reasons[0] != "uploads of unknown length are not accepted" {
+		t.Errorf("Expected an upload of unknown length to be rejected, got %+v", decision)
+	}
+}
+
+func TestAdmissionPolicy_LoadErrors(t *testing.T) {
+	for name, policy := range map[string]string{
+		"syntax error":    "package depot\nallow if {",
+		"wrong package":   "package other\nallow := true",
+		"undefined input": "package depot\nallow if input.size < undefined_rule",
+	} {
+		if _, err := loadTestPolicy(t, policy); err == nil {
+			t.Errorf("%s: expected loading to fail", name)
+		}
+	}
+
+	// A deny-only policy declares a default allow
+	policy, err := loadTestPolicy(t, "package depot\ndefault allow := true\ndeny contains \"no csv\" if input.content_type == \"text/csv\"\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision, _ := policy.Evaluate(services.AdmissionInput{ContentType: "text/csv"}); decision.Allowed {
+		t.Error("Expected the deny rule to reject the upload")
+	}
+	if decision, _ := policy.Evaluate(services.AdmissionInput{ContentType: "application/json"}); !decision.Allowed {
+		t.Error("Expected the default allow to accept the upload")
+	}
+}
@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// appendChunk posts one chunk to /append under requestID
+func appendChunk(handler *handlers.AppendHandler, requestID, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/append?request_id="+requestID, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	handler.AppendHandler(w, req)
+	return w
+}
+
+func TestAppendHandler_ConcatenatesChunks(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	handler := handlers.NewAppendHandler(depot.payloadService, services.NewDefaultFilenameExtractor())
+
+	var result services.AppendResult
+	for _, chunk := range []string{"line 1\n", "line 2\n", "line 3\n"} {
+		w := appendChunk(handler, "app-logs", "text/plain", chunk)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to parse JSON response: %v", err)
+		}
+	}
+
+	want := "line 1\nline 2\nline 3\n"
+	data, err := mockService.GetPayload("app-logs_payload.txt")
+	if err != nil || string(data) != want {
+		t.Fatalf("Expected the chunks to be concatenated, got %q (%v)", data, err)
+	}
+	sum := sha256.Sum256([]byte(want))
+	if result.ObjectName != "app-logs_payload.txt" || result.Size != int64(len(want)) || result.Appended != 7 || result.Composed {
+		t.Errorf("Unexpected append result %+v", result)
+	}
+	if result.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected the checksum of the whole object, got %s", result.SHA256)
+	}
+	if record, ok := depot.metadataIndex.Get("app-logs_payload.txt"); !ok || record.Size != len(want) {
+		t.Errorf("Expected the index to track the grown object, got %+v", record)
+	}
+}
+
+func TestAppendHandler_RejectsInvalidRequests(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+	handler := handlers.NewAppendHandler(depot.payloadService, services.NewDefaultFilenameExtractor())
+
+	if w := appendChunk(handler, "", "text/plain", "x"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a missing request ID to be rejected, got %d", w.Code)
+	}
+	if w := appendChunk(handler, "../escape", "text/plain", "x"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid request ID to be rejected, got %d", w.Code)
+	}
+
+	multipart := "--b\r\nContent-Disposition: form-data; name=\"a\"; filename=\"a.txt\"\r\n\r\nA\r\n" +
+		"--b\r\nContent-Disposition: form-data; name=\"b\"; filename=\"b.txt\"\r\n\r\nB\r\n--b--\r\n"
+	if w := appendChunk(handler, "app-logs", "multipart/form-data; boundary=b", multipart); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected a multi-object body to be rejected, got %d", w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	handler.AppendHandler(w, httptest.NewRequest("GET", "/append?request_id=app-logs", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected GET to be rejected, got %d", w.Code)
+	}
+}
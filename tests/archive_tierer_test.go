@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// tierWatcher signals every object moved between storage tiers
+type tierWatcher chan services.ObjectRecord
+
+func (w tierWatcher) PayloadStored(services.ObjectRecord)  {}
+func (w tierWatcher) PayloadDeleted(services.ObjectRecord) {}
+func (w tierWatcher) PayloadTiered(record services.ObjectRecord) {
+	w <- record
+}
+
+func (w tierWatcher) next(t *testing.T) services.ObjectRecord {
+	t.Helper()
+	select {
+	case record := <-w:
+		return record
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for a tier move")
+	}
+	return services.ObjectRecord{}
+}
+
+func TestArchiveTierer_ArchivesAndRestoresOnGet(t *testing.T) {
+	primary := NewMockStorageService()
+	archive := NewMockStorageService()
+	depot := newTestDepot(primary)
+	moves := make(tierWatcher, 4)
+	depot.payloadService.AddObserver(moves)
+
+	seedIndexedObject(primary, depot.metadataIndex, "1754732400_4f2a9c1e_old.txt", 10, 48*time.Hour)
+	seedIndexedObject(primary, depot.metadataIndex, "fresh-1_fresh.txt", 10, time.Minute)
+
+	tierer := services.NewArchiveTierer(primary, archive, depot.metadataIndex, 24*time.Hour, time.Hour)
+	tierer.SetTierNotifier(depot.payloadService)
+	depot.payloadService.SetArchiveRestorer(tierer)
+
+	if moved := tierer.TierOnce(); moved != 1 {
+		t.Fatalf("Expected 1 archived object, got %d", moved)
+	}
+	moves.next(t)
+	if _, exists := archive.Payload("1754732400_4f2a9c1e_old.txt"); !exists {
+		t.Fatal("Expected old object in archive backend")
+	}
+	if _, exists := primary.Payload("1754732400_4f2a9c1e_old.txt"); exists {
+		t.Fatal("Expected old object removed from primary backend")
+	}
+	if record, _ := depot.metadataIndex.Get("1754732400_4f2a9c1e_old.txt"); record.StorageTier != services.StorageTierArchive {
+		t.Errorf("Expected index to mark object archived, got tier %q", record.StorageTier)
+	}
+
+	// First retrieval signals the restore
+	req := httptest.NewRequest("GET", "/get?request_id=1754732400_4f2a9c1e", nil)
+	w := httptest.NewRecorder()
+	depot.httpHandler.GetHandler(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status Accepted while restoring, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header while restoring")
+	}
+
+	if record := moves.next(t); record.StorageTier != "" || record.RestoredAt == nil {
+		t.Fatalf("Expected a restore back to the primary tier, got %+v", record)
+	}
+
+	w = httptest.NewRecorder()
+	depot.httpHandler.GetHandler(w, httptest.NewRequest("GET", "/get?request_id=1754732400_4f2a9c1e", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK after restore, got %d", w.Code)
+	}
+	if _, exists := archive.Payload("1754732400_4f2a9c1e_old.txt"); exists {
+		t.Error("Expected restored object removed from archive backend")
+	}
+
+	// The restored object ages from its restore, not from its upload
+	if moved := tierer.TierOnce(); moved != 0 {
+		t.Errorf("Expected the restored object to stay in the primary tier, archived %d", moved)
+	}
+
+	events, _, _ := depot.changeJournal.Since(0, 10)
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	if len(types) != 2 || types[0] != services.ChangeArchived || types[1] != services.ChangeRestored {
+		t.Errorf("Expected archived and restored changes, got %v", types)
+	}
+}
+
+func TestArchiveTierer_KeepsObjectMetadata(t *testing.T) {
+	primary := NewMockStorageService()
+	archive := NewMockStorageService()
+	depot := newTestDepot(primary)
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	_, err := depot.payloadService.StorePayload([]byte(`{"total":12}`), "application/json", "order.json", services.StoreOptions{
+		RequestID: "orders-7",
+		Tags:      []string{"billing"},
+		ExpiresAt: expiresAt,
+		Sync:      true,
+	})
+	if err != nil {
+		t.Fatalf("StorePayload failed: %v", err)
+	}
+	records := depot.metadataIndex.List()
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 indexed object, got %d", len(records))
+	}
+	name := records[0].ObjectName
+	before := primary.Metadata(name)
+
+	tierer := services.NewArchiveTierer(primary, archive, depot.metadataIndex, 0, time.Hour)
+	if moved := tierer.TierOnce(); moved != 1 {
+		t.Fatalf("Expected 1 archived object, got %d", moved)
+	}
+
+	after := archive.Metadata(name)
+	for key, value := range before {
+		if after[key] != value {
+			t.Errorf("Expected archived metadata %s=%q, got %q", key, value, after[key])
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package tests
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// testIssuer serves an OIDC discovery document and a JWKS with one RSA and one EC key
+type testIssuer struct {
+	server  *httptest.Server
+	rsaKey  *rsa.PrivateKey
+	ecKey   *ecdsa.PrivateKey
+	fetches int
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+	issuer := &testIssuer{rsaKey: rsaKey, ecKey: ecKey}
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": issuer.server.URL, "jwks_uri": issuer.server.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		issuer.fetches++
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		}})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+// sign issues a token signed with the key named by kid
+func (i *testIssuer) sign(t *testing.T, kid string, claims map[string]any) string {
+	t.Helper()
+	alg := "RS256"
+	if kid == "ec-1" {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	if alg == "RS256" {
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, i.rsaKey, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+	} else {
+		r, s, err := ecdsa.Sign(rand.Reader, i.ecKey, digest[:])
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (i *testIssuer) claims(extra map[string]any) map[string]any {
+	claims := map[string]any{
+		"iss": i.server.URL,
+		"sub": "svc-orders",
+		"aud": []string{"depot"},
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	return claims
+}
+
+func TestOIDCVerifier_ChecksSignatureAndClaims(t *testing.T) {
+	issuer := newTestIssuer(t)
+	verifier, err := services.NewOIDCVerifier(issuer.server.URL, "", "depot")
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+
+	claims, err := verifier.VerifyToken(issuer.sign(t, "rsa-1", issuer.claims(map[string]any{"scope": "depot:read depot:write"})))
+	if err != nil {
+		t.Fatalf("Expected a valid RS256 token, got %v", err)
+	}
+	if claims.Subject != "svc-orders" || !claims.HasScope("depot:write") || claims.HasScope("depot:admin") {
+		t.Errorf("Unexpected claims: %+v", claims)
+	}
+	claims, err = verifier.VerifyToken(issuer.sign(t, "ec-1", issuer.claims(map[string]any{"scp": []string{"depot:admin"}})))
+	if err != nil || !claims.HasScope("depot:admin") {
+		t.Fatalf("Expected a valid ES256 token with scp scopes, got %+v, %v", claims, err)
+	}
+
+	valid := issuer.sign(t, "rsa-1", issuer.claims(nil))
+	parts := strings.Split(valid, ".")
+	tampered, _ := json.Marshal(issuer.claims(map[string]any{"sub": "someone-else"}))
+	invalid := map[string]string{
+		"expired":        issuer.sign(t, "rsa-1", issuer.claims(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()})),
+		"not yet valid":  issuer.sign(t, "rsa-1", issuer.claims(map[string]any{"nbf": time.Now().Add(time.Hour).Unix()})),
+		"no expiry":      issuer.sign(t, "rsa-1", map[string]any{"iss": issuer.server.URL, "aud": "depot"}),
+		"wrong audience": issuer.sign(t, "rsa-1", issuer.claims(map[string]any{"aud": "billing"})),
+		"wrong issuer":   issuer.sign(t, "rsa-1", issuer.claims(map[string]any{"iss": "https://evil.example"})),
+		"unknown key":    strings.Replace(valid, parts[0], base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"rsa-2"}`)), 1),
+		"tampered":       parts[0] + "." + base64.RawURLEncoding.EncodeToString(tampered) + "." + parts[2],
+		"alg mismatch":   strings.Replace(valid, parts[0], base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","kid":"rsa-1"}`)), 1),
+		"none":           base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + ".",
+		"garbage":        "not-a-token",
+	}
+	for name, token := range invalid {
+		if _, err := verifier.VerifyToken(token); err == nil {
+			t.Errorf("Expected the %s token to be rejected", name)
+		}
+	}
+	if _, err := services.NewOIDCVerifier(issuer.server.URL, "", ""); err == nil {
+		t.Error("Expected a verifier without an audience to be refused")
+	}
+	if issuer.fetches != 1 {
+		t.Errorf("Expected unknown keys within the refresh interval to use the cached key set, got %d fetches", issuer.fetches)
+	}
+}
+
+func TestBearerAuth_AttachesClaimsAndEnforcesScopes(t *testing.T) {
+	issuer := newTestIssuer(t)
+	verifier, _ := services.NewOIDCVerifier(issuer.server.URL, "", "depot")
+	auth := handlers.NewBearerAuth(verifier, handlers.DefaultPublicRoutes)
+	auth.SetRouteScopes(map[string]string{"/depot": "depot:write", "/admin/": "depot:admin"})
+
+	var subject string
+	next := func(w http.ResponseWriter, r *http.Request) {
+		if claims, ok := handlers.TokenClaimsFromContext(r.Context()); ok {
+			subject = claims.Subject
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	call := func(route, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", route, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		auth.Wrap(route, next)(w, req)
+		return w
+	}
+
+	reader := issuer.sign(t, "rsa-1", issuer.claims(map[string]any{"scope": "depot:read"}))
+	if w := call("/list", reader); w.Code != http.StatusOK || subject != "svc-orders" {
+		t.Errorf("Expected the token's claims passed to the handler, got %d subject=%q", w.Code, subject)
+	}
+	w := call("/list", "")
+	if w.Code != http.StatusUnauthorized || !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Bearer") {
+		t.Errorf("Expected 401 with a Bearer challenge without a token, got %d %q", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+	if w := call("/list", "not-a-token"); w.Code != http.StatusUnauthorized || !strings.Contains(w.Header().Get("WWW-Authenticate"), "invalid_token") {
+		t.Errorf("Expected 401 invalid_token for a bad token, got %d", w.Code)
+	}
+	if w := call("/depot", reader); w.Code != http.StatusForbidden || !strings.Contains(w.Header().Get("WWW-Authenticate"), "insufficient_scope") {
+		t.Errorf("Expected 403 insufficient_scope without depot:write, got %d", w.Code)
+	}
+	if w := call("/admin/reindex", reader); w.Code != http.StatusForbidden {
+		t.Errorf("Expected the /admin/ prefix scope to cover /admin/reindex, got %d", w.Code)
+	}
+	admin := issuer.sign(t, "ec-1", issuer.claims(map[string]any{"scope": "depot:admin"}))
+	if w := call("/admin/reindex", admin); w.Code != http.StatusOK {
+		t.Errorf("Expected an admin token on /admin/reindex to pass, got %d", w.Code)
+	}
+	if w := call("/webhooks/github", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected webhooks to stay public, got %d", w.Code)
+	}
+
+	issuer.server.Close()
+	unreachable, _ := services.NewOIDCVerifier(issuer.server.URL, "", "depot")
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/list", nil)
+	req.Header.Set("Authorization", "Bearer "+reader)
+	handlers.NewBearerAuth(unreachable, nil).Wrap("/list", next)(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 while the issuer is unreachable, got %d", w.Code)
+	}
+}
@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// notifyingSource is a source bucket that reports created objects to its watcher
+type notifyingSource struct {
+	*MockStorageService
+	created chan string
+}
+
+func (s *notifyingSource) WatchCreated(ctx context.Context, created func(objectName string)) error {
+	for {
+		select {
+		case objectName := <-s.created:
+			created(objectName)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// waitForFilename waits for the index to hold a payload with the given filename
+func waitForFilename(t *testing.T, index *services.MemoryMetadataIndex, filename string) services.ObjectRecord {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, record := range index.List() {
+			if record.OriginalFilename == filename {
+				return record
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Expected %s to be imported", filename)
+	return services.ObjectRecord{}
+}
+
+func TestBucketIngester_PollImportsNewObjects(t *testing.T) {
+	source := NewMockStorageService()
+	source.SavePayload("existing.json", []byte(`{"old":true}`), "application/json", nil)
+	depot := newTestDepot(NewMockStorageService())
+
+	ingester, err := services.NewBucketIngester(source, depot.payloadService, services.NewDefaultContentTypeDetector(), services.IngestModePoll, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	depot.payloadService.AddObserver(ingester)
+	if err := ingester.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	source.SavePayload("acme/orders/batch", []byte("id\n1\n"), "text/csv", nil)
+	if imported, failed := ingester.PollOnce(); imported != 1 || failed != 0 {
+		t.Fatalf("Expected only the new object imported, got %d (%d failed)", imported, failed)
+	}
+	record := waitForFilename(t, depot.metadataIndex, "batch")
+	if !slices.Equal(record.Tags, []string{"acme", "orders"}) {
+		t.Errorf("Expected the key prefixes as tags, got %v", record.Tags)
+	}
+	if record.ContentType != "text/csv" {
+		t.Errorf("Expected the source content type, got %s", record.ContentType)
+	}
+	if imported, _ := ingester.PollOnce(); imported != 0 {
+		t.Errorf("Expected an imported object to be skipped, got %d imported", imported)
+	}
+	if _, err := source.GetPayload("acme/orders/batch"); err != nil {
+		t.Error("Expected the source object to be kept")
+	}
+}
+
+func TestBucketIngester_DeletesImportedObjects(t *testing.T) {
+	source := NewMockStorageService()
+	source.SavePayload("existing.txt", []byte("old"), "text/plain", nil)
+	depot := newTestDepot(NewMockStorageService())
+
+	ingester, _ := services.NewBucketIngester(source, depot.payloadService, services.NewDefaultContentTypeDetector(), services.IngestModePoll, time.Hour)
+	ingester.SetDeleteSource(true)
+	depot.payloadService.AddObserver(ingester)
+	if err := ingester.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForFilename(t, depot.metadataIndex, "existing.txt")
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if objects, _ := source.ListPayloads(); len(objects) == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("Expected the imported object to be deleted from the source")
+}
+
+func TestBucketIngester_Notifications(t *testing.T) {
+	source := &notifyingSource{MockStorageService: NewMockStorageService(), created: make(chan string)}
+	depot := newTestDepot(NewMockStorageService())
+
+	ingester, _ := services.NewBucketIngester(source, depot.payloadService, services.NewDefaultContentTypeDetector(), services.IngestModeNotify, time.Hour)
+	depot.payloadService.AddObserver(ingester)
+	if err := ingester.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	source.SavePayload("dropped.json", []byte(`{"a":1}`), "application/json", nil)
+	source.created <- "dropped.json"
+	if record := waitForFilename(t, depot.metadataIndex, "dropped.json"); len(record.Tags) != 0 {
+		t.Errorf("Expected an untagged payload, got %v", record.Tags)
+	}
+}
+
+func TestBucketIngester_RejectsUnknownMode(t *testing.T) {
+	if _, err := services.NewBucketIngester(NewMockStorageService(), nil, nil, "push", time.Minute); err == nil {
+		t.Error("Expected an unknown mode to be rejected")
+	}
+}
+
+// instantStore saves synchronously, notifying its observer before StorePayload returns
+type instantStore struct {
+	services.PayloadService
+	observer services.StoreObserver
+}
+
+func (s *instantStore) StorePayload(data []byte, contentType string, filename string, opts services.StoreOptions) (*services.StoreResult, error) {
+	objectName := "req-1_" + filename
+	s.observer.PayloadStored(services.ObjectRecord{RequestID: "req-1", ObjectName: objectName})
+	return &services.StoreResult{RequestID: "req-1", Objects: []services.StoredObject{{ObjectName: objectName}}}, nil
+}
+
+func TestBucketIngester_SavedBeforeStoreReturns(t *testing.T) {
+	source := NewMockStorageService()
+	source.SavePayload("fast.txt", []byte("fast"), "text/plain", nil)
+	store := &instantStore{}
+	ingester, _ := services.NewBucketIngester(source, store, services.NewDefaultContentTypeDetector(), services.IngestModePoll, time.Hour)
+	store.observer = ingester
+	ingester.SetDeleteSource(true)
+
+	if imported, _ := ingester.PollOnce(); imported != 1 {
+		t.Fatalf("Expected the object imported, got %d", imported)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if objects, _ := source.ListPayloads(); len(objects) == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("Expected an object saved before StorePayload returned to be deleted from the source")
+}
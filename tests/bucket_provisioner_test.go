@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// fakeBucketAdmin records the buckets it provisions, failing while fail is set
+type fakeBucketAdmin struct {
+	mu      sync.Mutex
+	buckets map[string]services.BucketTemplate
+	calls   int
+	fail    bool
+}
+
+func (f *fakeBucketAdmin) ProvisionBucket(bucket string, template services.BucketTemplate) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.fail {
+		return false, errors.New("minio unavailable")
+	}
+	if f.buckets == nil {
+		f.buckets = make(map[string]services.BucketTemplate)
+	}
+	_, exists := f.buckets[bucket]
+	f.buckets[bucket] = template
+	return !exists, nil
+}
+
+func TestBucketProvisioning_ProvisionsNewNamespacesOnce(t *testing.T) {
+	admin := &fakeBucketAdmin{fail: true}
+	template := services.BucketTemplate{BucketPrefix: "depot-", Versioning: true, Encryption: services.BucketEncryptionSSES3, ExpireDays: 30}
+	provisioning := handlers.NewBucketProvisioning("X-Team", services.NewBucketProvisioner(admin, template))
+	handler := provisioning.Wrap("/depot", okHandler)
+
+	send := func(team string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/depot", nil)
+		r.Header.Set("X-Team", team)
+		handler(w, r)
+		return w.Code
+	}
+	if code := send("Payments"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 while the bucket cannot be provisioned, got %d", code)
+	}
+	admin.fail = false
+	for i := 0; i < 3; i++ {
+		if code := send("Payments"); code != http.StatusOK {
+			t.Errorf("Expected the request handled once provisioned, got %d", code)
+		}
+	}
+	if code := send(""); code != http.StatusOK {
+		t.Errorf("Expected the default namespace to pass, got %d", code)
+	}
+	if code := send("team..a"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected a namespace without a valid bucket name refused, got %d", code)
+	}
+
+	if admin.calls != 2 {
+		t.Errorf("Expected one failed and one successful provisioning, got %d calls", admin.calls)
+	}
+	if got, ok := admin.buckets["depot-payments"]; !ok || !got.Versioning || got.ExpireDays != 30 {
+		t.Errorf("Expected depot-payments provisioned from the template, got %v", admin.buckets)
+	}
+}
+
+func TestLoadBucketTemplate_RejectsInvalidTemplates(t *testing.T) {
+	for name, body := range map[string]string{
+		"kms without key":        `{"encryption":"SSE-KMS"}`,
+		"unknown encryption":     `{"encryption":"AES"}`,
+		"noncurrent unversioned": `{"noncurrent_expire_days":7}`,
+		"uppercase prefix":       `{"bucket_prefix":"Depot-"}`,
+		"negative days":          `{"expire_days":-1}`,
+	} {
+		path := filepath.Join(t.TempDir(), "template.json")
+		os.WriteFile(path, []byte(body), 0o644)
+		if _, err := services.LoadBucketTemplate(path); err == nil {
+			t.Errorf("%s: expected the template to be rejected", name)
+		}
+	}
+}
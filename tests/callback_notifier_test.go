@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestDepotHandler_CallbackDelivered(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	callbackServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer callbackServer.Close()
+
+	depot := newTestDepot(NewMockStorageService())
+	notifier := services.NewHTTPCallbackNotifier("s3cret", services.DefaultRetryPolicy, depot.deliveryLog)
+	// The test server listens on loopback
+	notifier.SetAllowPrivate(true)
+	depot.payloadService.SetCallbackNotifier(notifier)
+
+	req := httptest.NewRequest("POST", "/depot?callback="+url.QueryEscape(callbackServer.URL), strings.NewReader(`{"a": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	depot.httpHandler.DepotHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d", w.Code)
+	}
+
+	select {
+	case callback := <-received:
+		body := <-bodies
+		timestamp := callback.Header.Get("X-Depot-Timestamp")
+		expected := "sha256=" + services.SignCallback("s3cret", timestamp, body)
+		if callback.Header.Get("X-Depot-Signature") != expected {
+			t.Errorf("Invalid callback signature %s", callback.Header.Get("X-Depot-Signature"))
+		}
+
+		var event services.CompletionEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Fatalf("Failed to parse callback body: %v", err)
+		}
+		if event.Status != "stored" || len(event.Objects) != 1 || event.Objects[0].SHA256 == "" {
+			t.Errorf("Unexpected completion event %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Callback was not delivered")
+	}
+}
+
+func TestDepotHandler_InvalidCallback(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+
+	req := httptest.NewRequest("POST", "/depot", strings.NewReader("data"))
+	req.Header.Set("X-Depot-Callback", "ftp://example.com/hook")
+	w := httptest.NewRecorder()
+	depot.httpHandler.DepotHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status BadRequest, got %d", w.Code)
+	}
+}
+
+func TestDepotHandler_RefusesCallbacksToInternalAddresses(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+	notifier := services.NewHTTPCallbackNotifier("", services.DefaultRetryPolicy, depot.deliveryLog)
+	notifier.SetAllowedHosts([]string{"hooks.example.com", "127.0.0.1"})
+	depot.payloadService.SetCallbackNotifier(notifier)
+
+	for _, callback := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://other.example.com/hook",
+	} {
+		req := httptest.NewRequest("POST", "/depot", strings.NewReader("data"))
+		req.Header.Set("X-Depot-Callback", callback)
+		w := httptest.NewRecorder()
+		depot.httpHandler.DepotHandler(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status BadRequest, got %d", callback, w.Code)
+		}
+	}
+	if err := notifier.CheckCallbackURL("https://hooks.example.com/done"); err != nil {
+		t.Errorf("Expected an allowed host to pass, got %v", err)
+	}
+}
+
+func TestHTTPCallbackNotifier_RefusesNamesResolvingToInternalAddresses(t *testing.T) {
+	var hits atomic.Int32
+	callbackServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer callbackServer.Close()
+
+	depot := newTestDepot(NewMockStorageService())
+	notifier := services.NewHTTPCallbackNotifier("", fastPolicy(1), depot.deliveryLog)
+	// A name passes the URL check, but resolves to loopback when dialed
+	target := strings.Replace(callbackServer.URL, "127.0.0.1", "localhost", 1)
+	if err := notifier.CheckCallbackURL(target); err != nil {
+		t.Fatalf("Expected the name to pass the URL check, got %v", err)
+	}
+	notifier.Notify(target, services.CompletionEvent{RequestID: "orders-1"})
+
+	failed := waitForDelivery(t, depot, services.DeliveryFailed)
+	if len(failed.Attempts) != 1 || !strings.Contains(failed.Attempts[0].Error, "not a public address") {
+		t.Errorf("Expected the dial to be refused, got %+v", failed.Attempts)
+	}
+	if hits.Load() != 0 {
+		t.Error("Expected the callback server not to be reached")
+	}
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// postStreamed sends body with chunked encoding and a checksum trailer
+func postStreamed(t *testing.T, url, field, checksum, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest("POST", url, io.NopCloser(strings.NewReader(body)))
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", "text/plain")
+	req.Trailer = http.Header{field: []string{checksum}}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestDepotHandler_VerifiesChecksumTrailer(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+	server := httptest.NewServer(http.HandlerFunc(depot.httpHandler.DepotHandler))
+	defer server.Close()
+
+	body := "streamed without a known digest"
+	sum := sha256.Sum256([]byte(body))
+
+	if resp := postStreamed(t, server.URL, "X-Depot-Checksum-Sha256", hex.EncodeToString(sum[:]), body); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a matching hex trailer to be accepted, got %d", resp.StatusCode)
+	}
+	if resp := postStreamed(t, server.URL, "X-Amz-Checksum-Sha256", base64.StdEncoding.EncodeToString(sum[:]), body); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a matching base64 trailer to be accepted, got %d", resp.StatusCode)
+	}
+
+	other := sha256.Sum256([]byte("something else"))
+	if resp := postStreamed(t, server.URL, "X-Amz-Checksum-Sha256", base64.StdEncoding.EncodeToString(other[:]), body); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected a mismatched trailer to be rejected, got %d", resp.StatusCode)
+	}
+	if resp := postStreamed(t, server.URL, "X-Depot-Checksum-Sha256", "not-a-digest", body); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected a malformed trailer to be rejected, got %d", resp.StatusCode)
+	}
+}
+
+func TestDepotHandler_VerifiesChecksumHeader(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+
+	req := httptest.NewRequest("POST", "/depot", strings.NewReader(`{"a": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Depot-Checksum-Sha256", strings.Repeat("0", 64))
+	w := httptest.NewRecorder()
+	depot.httpHandler.DepotHandler(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected a mismatched checksum header to be rejected, got %d", w.Code)
+	}
+	if objects, _ := mockService.ListPayloads(); len(objects) != 0 {
+		t.Errorf("Expected nothing to be stored after a checksum mismatch, got %v", objects)
+	}
+}
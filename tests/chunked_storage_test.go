@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestChunkedStorage_SplitsAndReassembles(t *testing.T) {
+	inner := NewMockStorageService()
+	chunked := services.NewChunkedStorage(inner, 10)
+
+	data := []byte(strings.Repeat("0123456789", 3) + "tail")
+	if err := chunked.SavePayload("001_payload.bin", data, "application/octet-stream", map[string]string{"Request-Id": "001"}); err != nil {
+		t.Fatalf("SavePayload failed: %v", err)
+	}
+
+	raw, _ := inner.ListPayloads()
+	if len(raw) != 5 {
+		t.Fatalf("Expected a manifest and 4 parts in the backend, got %v", raw)
+	}
+	for _, objectName := range raw {
+		if stored, _ := inner.GetPayload(objectName); len(stored) > 10 && objectName != "001_payload.bin" {
+			t.Errorf("Expected part %s to respect the chunk size, got %d bytes", objectName, len(stored))
+		}
+	}
+
+	objects, _ := chunked.ListPayloads()
+	if len(objects) != 1 || objects[0] != "001_payload.bin" {
+		t.Errorf("Expected parts to be hidden from listings, got %v", objects)
+	}
+	got, err := chunked.GetPayload("001_payload.bin")
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Expected the object to be reassembled, got %q (%v)", got, err)
+	}
+	contentType, metadata, _ := chunked.GetPayloadMetadata("001_payload.bin")
+	if contentType != "application/octet-stream" || metadata["Request-Id"] != "001" || metadata[services.MetadataChunkCount] != "" {
+		t.Errorf("Unexpected metadata %s %v", contentType, metadata)
+	}
+
+	// A smaller rewrite drops the parts of the earlier version
+	if err := chunked.SavePayload("001_payload.bin", []byte("small"), "text/plain", nil); err != nil {
+		t.Fatalf("SavePayload failed: %v", err)
+	}
+	if raw, _ := inner.ListPayloads(); len(raw) != 1 {
+		t.Errorf("Expected stale parts to be removed, got %v", raw)
+	}
+	if got, _ := chunked.GetPayload("001_payload.bin"); string(got) != "small" {
+		t.Errorf("Expected the rewritten object, got %q", got)
+	}
+
+	chunked.SavePayload("002_payload.bin", data, "application/octet-stream", nil)
+	if err := chunked.DeletePayload("002_payload.bin"); err != nil {
+		t.Fatalf("DeletePayload failed: %v", err)
+	}
+	if raw, _ := inner.ListPayloads(); len(raw) != 1 {
+		t.Errorf("Expected a delete to remove every part, got %v", raw)
+	}
+}
+
+func TestChunkedStorage_DetectsMissingParts(t *testing.T) {
+	inner := NewMockStorageService()
+	chunked := services.NewChunkedStorage(inner, 4)
+	chunked.SavePayload("001_payload.txt", []byte("abcdefghij"), "text/plain", nil)
+
+	inner.DeletePayload("001_payload.txt.depot-chunk-00001")
+	if _, err := chunked.GetPayload("001_payload.txt"); err == nil {
+		t.Error("Expected reading an object with a missing part to fail")
+	}
+}
+
+func TestChunkedStorage_ThroughDepot(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(services.NewChunkedStorage(mockService, 8))
+
+	body := `{"message": "a payload well above the chunk size"}`
+	w := postWithID(depot, "big-1", body, false)
+	if w.Code != 200 {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+	waitForObject(t, mockService, "big-1_payload.json")
+
+	result, err := depot.payloadService.RetrievePayloads("big-1", true)
+	if err != nil {
+		t.Fatalf("RetrievePayloads failed: %v", err)
+	}
+	single, ok := result.(map[string]interface{})
+	if data, _ := single["data"].([]byte); !ok || string(data) != body {
+		t.Errorf("Expected the reassembled payload, got %v", result)
+	}
+}
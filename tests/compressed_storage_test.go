@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestCompressedStorage_CompressesAllowedPayloads(t *testing.T) {
+	for _, algorithm := range []string{services.CompressionGzip, services.CompressionZstd} {
+		inner := NewMockStorageService()
+		compressed, err := services.NewCompressedStorage(inner, algorithm, 64, nil)
+		if err != nil {
+			t.Fatalf("NewCompressedStorage failed: %v", err)
+		}
+
+		data := []byte(strings.Repeat(`{"event":"order.created","status":"ok"},`, 100))
+		if err := compressed.SavePayload("001_events.json", data, "application/json; charset=utf-8", nil); err != nil {
+			t.Fatalf("SavePayload failed: %v", err)
+		}
+		if stored, _ := inner.GetPayload("001_events.json"); len(stored) >= len(data) {
+			t.Errorf("%s: expected the payload stored compressed, got %d of %d bytes", algorithm, len(stored), len(data))
+		}
+		if got, err := compressed.GetPayload("001_events.json"); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: expected the payload decompressed on read, got %d bytes (%v)", algorithm, len(got), err)
+		}
+
+		// Small payloads and types off the allowlist are stored as they are
+		compressed.SavePayload("002_small.json", []byte(`{"ok":true}`), "application/json", nil)
+		compressed.SavePayload("003_image.png", data, "image/png", nil)
+		for _, objectName := range []string{"002_small.json", "003_image.png"} {
+			stored, _ := inner.GetPayload(objectName)
+			if got, _ := compressed.GetPayload(objectName); !bytes.Equal(stored, got) {
+				t.Errorf("%s: expected %s stored uncompressed", algorithm, objectName)
+			}
+		}
+	}
+
+	// Objects compressed with the other algorithm stay readable
+	inner := NewMockStorageService()
+	gzipped, _ := services.NewCompressedStorage(inner, services.CompressionGzip, 0, []string{"text/*"})
+	gzipped.SavePayload("004_log.txt", []byte(strings.Repeat("line\n", 50)), "text/plain", nil)
+	zstd, _ := services.NewCompressedStorage(inner, services.CompressionZstd, 0, nil)
+	if got, _ := zstd.GetPayload("004_log.txt"); string(got) != strings.Repeat("line\n", 50) {
+		t.Errorf("Expected a gzip object readable after switching to zstd, got %q", got)
+	}
+
+	if _, err := services.NewCompressedStorage(inner, "brotli", 0, nil); err == nil {
+		t.Error("Expected an unknown algorithm refused")
+	}
+}
@@ -0,0 +1,179 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// postWithID uploads body under a client-chosen request ID
+func postWithID(depot *testDepot, requestID, body string, ifNoneMatch bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/depot", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Depot-Request-Id", requestID)
+	if ifNoneMatch {
+		req.Header.Set("If-None-Match", "*")
+	}
+	w := httptest.NewRecorder()
+	depot.httpHandler.DepotHandler(w, req)
+	return w
+}
+
+// waitForObject polls the mock until the object is saved
+func waitForObject(t *testing.T, mock *MockStorageService, objectName string) []byte {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if data, err := mock.GetPayload(objectName); err == nil {
+			return data
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %s", objectName)
+	return nil
+}
+
+func TestDepotHandler_IfNoneMatchRefusesExistingRequest(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+
+	w := postWithID(depot, "order-42", `{"v": 1}`, true)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+	waitForObject(t, mockService, "order-42_payload.json")
+
+	w = postWithID(depot, "order-42", `{"v": 2}`, true)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("Expected status PreconditionFailed, got %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		RequestID string                  `json:"request_id"`
+		Objects   []services.StoredObject `json:"objects"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	if response.RequestID != "order-42" || len(response.Objects) != 1 {
+		t.Fatalf("Expected the existing object in the response, got %+v", response)
+	}
+	existing := response.Objects[0]
+	if existing.ObjectName != "order-42_payload.json" || existing.Size != 8 || existing.SHA256 == "" || existing.ContentType != "application/json" {
+		t.Errorf("Unexpected existing object metadata %+v", existing)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if data, _ := mockService.GetPayload("order-42_payload.json"); string(data) != `{"v": 1}` {
+		t.Errorf("Expected the original object to be kept, got %s", data)
+	}
+
+	// Without the precondition, the client explicitly asks for an overwrite
+	if w := postWithID(depot, "order-42", `{"v": 3}`, false); w.Code != http.StatusOK {
+		t.Fatalf("Expected an unconditional upload to succeed, got %d", w.Code)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if data, _ := mockService.GetPayload("order-42_payload.json"); string(data) == `{"v": 3}` {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("Expected the unconditional upload to overwrite the object")
+}
+
+// readCountingStorage counts the objects read from storage that can stat them instead
+type readCountingStorage struct {
+	*services.MemoryStorageService
+	reads atomic.Int32
+}
+
+func (r *readCountingStorage) GetPayload(objectName string) ([]byte, error) {
+	r.reads.Add(1)
+	return r.MemoryStorageService.GetPayload(objectName)
+}
+
+func TestDepotHandler_IfNoneMatchStatsExistingObjects(t *testing.T) {
+	memory, err := services.NewMemoryStorageService(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := &readCountingStorage{MemoryStorageService: memory}
+	depot := newTestDepot(storage)
+	watcher := newStoreWatcher(depot.payloadService)
+	if w := postWithID(depot, "order-7", `{"v": 1}`, true); w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+	watcher.wait(t, 1)
+
+	w := postWithID(depot, "order-7", `{"v": 2}`, true)
+	if w.Code != http.StatusPreconditionFailed || !strings.Contains(w.Body.String(), `"size":8`) {
+		t.Fatalf("Expected the existing object described, got %d: %s", w.Code, w.Body.String())
+	}
+	if reads := storage.reads.Load(); reads != 0 {
+		t.Errorf("Expected the existing object statted instead of read, got %d reads", reads)
+	}
+	// The refused upload releases its claim, so once the request is gone it is free
+	if _, err := depot.payloadService.DeleteRequest(context.Background(), "order-7"); err != nil {
+		t.Fatal(err)
+	}
+	if w := postWithID(depot, "order-7", `{"v": 3}`, true); w.Code != http.StatusOK {
+		t.Errorf("Expected a conditional upload of a deleted request to succeed, got %d", w.Code)
+	}
+}
+
+func TestDepotHandler_IfNoneMatchReservesInFlightRequest(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+
+	// The second conditional upload may arrive before the first is written
+	first := postWithID(depot, "batch-1", `{}`, true)
+	second := postWithID(depot, "batch-1", `{}`, true)
+	if first.Code != http.StatusOK || second.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected exactly one conditional upload to win, got %d and %d", first.Code, second.Code)
+	}
+}
+
+func TestDepotHandler_RejectsInvalidRequestID(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+
+	for _, requestID := range []string{"has_underscore", "../escape", "a/b", "..", strings.Repeat("x", 200)} {
+		if w := postWithID(depot, requestID, `{}`, false); w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status BadRequest, got %d", requestID, w.Code)
+		}
+	}
+}
+
+func TestDepotHandler_ClientIDsCannotReachGeneratedUploads(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+
+	// A generated "<unix>_<hex>" upload shares its leading digits with an all-digit ID
+	result, err := depot.payloadService.StorePayload([]byte(`{}`), "application/json", "", services.StoreOptions{Sync: true})
+	if err != nil {
+		t.Fatalf("StorePayload failed: %v", err)
+	}
+	stem, _, _ := strings.Cut(result.RequestID, "_")
+
+	if w := postWithID(depot, stem, `{}`, true); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected the all-digit ID %s to be refused, got %d: %s", stem, w.Code, w.Body.String())
+	}
+	w := httptest.NewRecorder()
+	depot.httpHandler.GetHandler(w, httptest.NewRequest("GET", "/get?request_id="+stem, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected /get of %s to find nothing, got %d", stem, w.Code)
+	}
+	w = httptest.NewRecorder()
+	depot.httpHandler.DeleteHandler(w, httptest.NewRequest("DELETE", "/delete?request_id="+stem, nil))
+	if objects, _ := mockService.ListPayloads(); len(objects) != 1 {
+		t.Errorf("Expected /delete of %s to leave the generated upload, got status %d", stem, w.Code)
+	}
+	if w := postWithID(depot, "order-"+stem, `{}`, true); w.Code != http.StatusOK {
+		t.Errorf("Expected an ID that only ends in digits to be accepted, got %d", w.Code)
+	}
+}
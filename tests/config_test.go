@@ -2,7 +2,9 @@ package tests
 
 import (
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ahmad-alkadri/simple-depot/internal/config"
 )
@@ -207,3 +209,41 @@ func TestGetEnv(t *testing.T) {
 		})
 	}
 }
+
+func TestGetEnvDurationMap(t *testing.T) {
+	t.Setenv("TEST_RETENTION_CLASSES", "debug=7d, audit=8760h,broken=soon,negative=-1h,forever=0")
+	classes := config.GetEnvDurationMap("TEST_RETENTION_CLASSES")
+	expected := map[string]time.Duration{
+		"debug":   7 * 24 * time.Hour,
+		"audit":   8760 * time.Hour,
+		"forever": 0,
+	}
+	if len(classes) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, classes)
+	}
+	for name, age := range expected {
+		if got, ok := classes[name]; !ok || got != age {
+			t.Errorf("%s: expected %s, got %s", name, age, got)
+		}
+	}
+}
+
+func TestConfigValidate_RejectsUnknownEvictionPolicy(t *testing.T) {
+	for policy, valid := range map[string]bool{"fifo": true, "tag-priority": true, "lru": false, "": false} {
+		cfg := &config.Config{EvictionPolicy: policy}
+		if err := cfg.Validate(); (err == nil) != valid {
+			t.Errorf("Policy %q: expected valid=%t, got error %v", policy, valid, err)
+		}
+	}
+}
+
+func TestConfigValidate_RequiresAnAudienceForBearerTokens(t *testing.T) {
+	cfg := &config.Config{EvictionPolicy: "fifo", OIDCIssuer: "https://issuer.example"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "DEPOT_OIDC_AUDIENCE") {
+		t.Errorf("Expected an issuer without an audience to be refused, got %v", err)
+	}
+	cfg.OIDCAudience = "depot"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected an issuer with an audience to be accepted, got %v", err)
+	}
+}
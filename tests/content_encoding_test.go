@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+	"github.com/klauspost/compress/zstd"
+)
+
+func encodeBody(t *testing.T, coding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	switch coding {
+	case "gzip":
+		writer := gzip.NewWriter(&buf)
+		writer.Write(data)
+		writer.Close()
+	case "deflate":
+		writer := zlib.NewWriter(&buf)
+		writer.Write(data)
+		writer.Close()
+	case "zstd":
+		writer, _ := zstd.NewWriter(&buf)
+		writer.Write(data)
+		writer.Close()
+	}
+	return buf.Bytes()
+}
+
+func TestDepotHandler_DecodesCompressedBodies(t *testing.T) {
+	storage, _ := services.NewMemoryStorageService(0)
+	mock := NewMockStorageService()
+	// Memory storage streams the decoded body; the mock has it buffered
+	for _, backend := range []services.StorageService{storage, mock} {
+		depot := newTestDepot(backend)
+		depot.httpHandler.SetSyncStore(true)
+		depot.httpHandler.SetMaxBodySize(1024)
+
+		original := []byte(`{"event":"order.created","id":42}`)
+		for i, coding := range []string{"gzip", "deflate", "zstd", "gzip, zstd"} {
+			body := original
+			for _, applied := range strings.Split(coding, ", ") {
+				body = encodeBody(t, applied, body)
+			}
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/depot", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Content-Encoding", coding)
+			depot.httpHandler.DepotHandler(w, req)
+
+			var stored struct {
+				Objects []services.StoredObject `json:"objects"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &stored)
+			if w.Code != http.StatusOK || len(stored.Objects) != 1 {
+				t.Fatalf("%s (%d): expected the body stored, got %d: %s", coding, i, w.Code, w.Body.String())
+			}
+			if data, _ := backend.GetPayload(stored.Objects[0].ObjectName); !bytes.Equal(data, original) {
+				t.Errorf("%s: expected the decoded body stored, got %q", coding, data)
+			}
+		}
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/depot", strings.NewReader("not gzip"))
+		req.Header.Set("Content-Encoding", "gzip")
+		if depot.httpHandler.DepotHandler(w, req); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected a body that does not decode refused, got %d", w.Code)
+		}
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/depot", strings.NewReader("data"))
+		req.Header.Set("Content-Encoding", "br")
+		if depot.httpHandler.DepotHandler(w, req); w.Code != http.StatusUnsupportedMediaType || w.Header().Get("Accept-Encoding") == "" {
+			t.Errorf("Expected an unknown coding refused with the supported ones, got %d %v", w.Code, w.Header())
+		}
+
+		// The size limit applies to the decoded bytes
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/depot", bytes.NewReader(encodeBody(t, "gzip", make([]byte, 4096))))
+		req.Header.Set("Content-Encoding", "gzip")
+		if depot.httpHandler.DepotHandler(w, req); w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected a body decoding past the limit refused, got %d", w.Code)
+		}
+	}
+}
+
+func TestDepotHandler_KeepsContentEncoding(t *testing.T) {
+	storage, _ := services.NewMemoryStorageService(0)
+	depot := newTestDepot(storage)
+	depot.httpHandler.SetSyncStore(true)
+	depot.httpHandler.SetKeepContentEncoding(true)
+
+	body := encodeBody(t, "gzip", []byte("hello world"))
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/depot?request_id=hook-1", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Content-Encoding", "gzip")
+	depot.httpHandler.DepotHandler(w, req)
+	var stored struct {
+		Objects []services.StoredObject `json:"objects"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &stored)
+	if w.Code != http.StatusOK || len(stored.Objects) != 1 {
+		t.Fatalf("Expected the body stored, got %d: %s", w.Code, w.Body.String())
+	}
+	objectName := stored.Objects[0].ObjectName
+	if data, _ := storage.GetPayload(objectName); !bytes.Equal(data, body) {
+		t.Errorf("Expected the body stored as sent, got %q", data)
+	}
+	if _, metadata, _ := storage.GetPayloadMetadata(objectName); metadata[services.MetadataContentEncoding] != "gzip" {
+		t.Errorf("Expected the coding recorded in metadata, got %v", metadata)
+	}
+
+	w = httptest.NewRecorder()
+	depot.httpHandler.GetHandler(w, httptest.NewRequest("GET", "/get?object="+objectName, nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" || !bytes.Equal(w.Body.Bytes(), body) {
+		t.Errorf("Expected the object served with its coding, got %d %v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+)
+
+// corsRequest sends a POST to /depot from origin, or its preflight when preflight is set
+func corsRequest(handler http.HandlerFunc, origin string, preflight bool) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/depot", nil)
+	if preflight {
+		r.Method = http.MethodOptions
+		r.Header.Set("Access-Control-Request-Method", "POST")
+		r.Header.Set("Access-Control-Request-Headers", "content-type, x-depot-tags")
+	}
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestCORS_AnswersPreflightsBeforeAuthentication(t *testing.T) {
+	chain := handlers.NewMiddlewareChain()
+	chain.Register(handlers.MiddlewareCORS, handlers.NewCORS([]string{"https://dash.example.com", "https://*.tools.example.com"}, nil, nil, false, 5*time.Minute).Wrap)
+	chain.Register(handlers.MiddlewareAuth, func(route string, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		}
+	})
+	depot := chain.Wrap("/depot", okHandler)
+
+	w := corsRequest(depot, "https://dash.example.com", true)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected the preflight to be answered with 204, got %d", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://dash.example.com" {
+		t.Errorf("Expected the origin to be allowed, got %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "GET, HEAD, POST, PUT, DELETE" {
+		t.Errorf("Expected the default methods, got %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); got != "content-type, x-depot-tags" {
+		t.Errorf("Expected the requested headers to be allowed, got %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Max-Age"); got != "300" {
+		t.Errorf("Expected a max age of 300, got %q", got)
+	}
+
+	if w := corsRequest(depot, "https://ci.tools.example.com", true); w.Code != http.StatusNoContent {
+		t.Errorf("Expected a pattern origin to be allowed, got %d", w.Code)
+	}
+	if w := corsRequest(depot, "https://evil.example.org", true); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a preflight from another origin to be refused, got %d", w.Code)
+	}
+}
+
+func TestCORS_AddsHeadersToAllowedOrigins(t *testing.T) {
+	cors := handlers.NewCORS([]string{"https://dash.example.com"}, []string{"GET", "POST"}, []string{"Content-Type"}, true, time.Minute)
+	depot := cors.Wrap("/depot", okHandler)
+
+	w := corsRequest(depot, "https://dash.example.com", false)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the request to reach the handler, got %d", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://dash.example.com" {
+		t.Errorf("Expected the origin to be allowed, got %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("Expected credentials to be allowed, got %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Expose-Headers"); got == "" {
+		t.Error("Expected the depot's response headers to be exposed")
+	}
+
+	w = corsRequest(depot, "https://evil.example.org", false)
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected another origin to get no CORS headers, got %d %q", w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if w := corsRequest(depot, "", false); w.Header().Get("Vary") != "" {
+		t.Errorf("Expected requests without an origin to pass untouched, got Vary %q", w.Header().Get("Vary"))
+	}
+
+	wildcard := handlers.NewCORS([]string{"*"}, nil, nil, false, time.Minute).Wrap("/get", okHandler)
+	if got := corsRequest(wildcard, "https://anywhere.example", false).Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Expected any origin to be allowed with *, got %q", got)
+	}
+}
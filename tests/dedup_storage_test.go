@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestDedupStorage_StoresIdenticalPayloadsOnce(t *testing.T) {
+	inner := NewMockStorageService()
+	dedup := services.NewDedupStorage(inner)
+
+	data := []byte(`{"event":"order.created","id":42}`)
+	for _, objectName := range []string{"001_webhook.json", "002_webhook.json"} {
+		if err := dedup.SavePayload(objectName, data, "application/json", map[string]string{"Request-Id": objectName[:3]}); err != nil {
+			t.Fatalf("SavePayload failed: %v", err)
+		}
+	}
+	dedup.SavePayload("003_other.json", []byte(`{"id":43}`), "application/json", nil)
+
+	raw, _ := inner.ListPayloads()
+	if len(raw) != 5 {
+		t.Fatalf("Expected 3 references and 2 blobs in the backend, got %v", raw)
+	}
+	objects, _ := dedup.ListPayloads()
+	if len(objects) != 3 {
+		t.Errorf("Expected blobs to be hidden from listings, got %v", objects)
+	}
+	for _, objectName := range []string{"001_webhook.json", "002_webhook.json"} {
+		if got, err := dedup.GetPayload(objectName); err != nil || string(got) != string(data) {
+			t.Errorf("Expected %s to resolve to its payload, got %q (%v)", objectName, got, err)
+		}
+	}
+	contentType, metadata, _ := dedup.GetPayloadMetadata("002_webhook.json")
+	if contentType != "application/json" || metadata["Request-Id"] != "002" || metadata[services.MetadataDedupBlob] != "" {
+		t.Errorf("Unexpected metadata %s %v", contentType, metadata)
+	}
+
+	// Objects stored before deduplication are read as they are
+	inner.SavePayload("000_legacy.txt", []byte("legacy"), "text/plain", nil)
+	if got, _ := dedup.GetPayload("000_legacy.txt"); string(got) != "legacy" {
+		t.Errorf("Expected an object stored whole to be returned as is, got %q", got)
+	}
+
+	// A blob outlives the first of its references
+	dedup.DeletePayload("001_webhook.json")
+	if _, err := dedup.CollectGarbage(); err != nil {
+		t.Fatalf("CollectGarbage failed: %v", err)
+	}
+	if got, err := dedup.GetPayload("002_webhook.json"); err != nil || string(got) != string(data) {
+		t.Errorf("Expected a referenced blob to be kept, got %q (%v)", got, err)
+	}
+
+	dedup.DeletePayload("002_webhook.json")
+	summary, err := dedup.CollectGarbage()
+	if err != nil || !strings.Contains(summary, "1 unreferenced removed") {
+		t.Errorf("Expected the unreferenced blob removed, got %q (%v)", summary, err)
+	}
+	if raw, _ := inner.ListPayloads(); len(raw) != 3 {
+		t.Errorf("Expected the other reference, its blob and the legacy object left, got %v", raw)
+	}
+}
+
+func TestDedupStorage_KeepsTenantsApart(t *testing.T) {
+	inner := NewMockStorageService()
+	dedup := services.NewDedupStorage(inner)
+
+	data := []byte("same bytes")
+	dedup.SavePayload("acme.a1_a.txt", data, "text/plain", nil)
+	dedup.SavePayload("globex.a1_a.txt", data, "text/plain", nil)
+
+	raw, _ := inner.ListPayloads()
+	blobs := 0
+	for _, objectName := range raw {
+		if strings.Contains(objectName, "depot-blob-") {
+			blobs++
+			if !strings.HasPrefix(objectName, "acme.") && !strings.HasPrefix(objectName, "globex.") {
+				t.Errorf("Expected blob %s under its tenant's prefix", objectName)
+			}
+		}
+	}
+	if blobs != 2 {
+		t.Errorf("Expected a blob per tenant, got %v", raw)
+	}
+	if objects, _ := dedup.ListRequestPayloads("acme.a1"); len(objects) != 1 {
+		t.Errorf("Expected only the tenant's reference listed for its request, got %v", objects)
+	}
+}
+
+func TestDedupStorage_ServesDuplicateDepots(t *testing.T) {
+	storage, _ := services.NewMemoryStorageService(0)
+	dedup := services.NewDedupStorage(storage)
+	depot := newTestDepot(dedup)
+
+	body := []byte("retried webhook body")
+	first, err := depot.payloadService.StorePayload(body, "text/plain", "", services.StoreOptions{Sync: true})
+	if err != nil {
+		t.Fatalf("StorePayload failed: %v", err)
+	}
+	second, _ := depot.payloadService.StorePayload(body, "text/plain", "", services.StoreOptions{Sync: true})
+
+	for _, result := range []*services.StoreResult{first, second} {
+		download, err := depot.payloadService.DownloadObject(result.Objects[0].ObjectName)
+		if err != nil {
+			t.Fatalf("DownloadObject failed: %v", err)
+		}
+		var data bytes.Buffer
+		if err := download.Write(&data); err != nil || data.String() != string(body) {
+			t.Errorf("Expected request %s to return its payload, got %q (%v)", result.RequestID, data.String(), err)
+		}
+	}
+	if raw, _ := storage.ListPayloads(); len(raw) != 3 {
+		t.Errorf("Expected two references and one blob stored, got %v", raw)
+	}
+}
@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// listDeliveries calls GET /deliveries and decodes the result
+func listDeliveries(t *testing.T, depot *testDepot, query string) []services.Delivery {
+	t.Helper()
+	w := httptest.NewRecorder()
+	depot.deliveriesHandler.DeliveriesHandler(w, httptest.NewRequest("GET", "/deliveries"+query, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Deliveries []services.Delivery `json:"deliveries"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	return response.Deliveries
+}
+
+// waitForDelivery polls until the only delivery reaches the given status
+func waitForDelivery(t *testing.T, depot *testDepot, status string) services.Delivery {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if deliveries := depot.deliveryLog.List(status, "", 0); len(deliveries) == 1 {
+			return deliveries[0]
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for a %s delivery", status)
+	return services.Delivery{}
+}
+
+func TestDeliveriesHandler_FailedDeliveryAndRedrive(t *testing.T) {
+	var healthy atomic.Bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	seedJSONPayload(mockService, depot.metadataIndex, "001_payload.json", `{}`)
+	record, _ := depot.metadataIndex.Get("001_payload.json")
+
+	forwarder := services.NewPayloadForwarder(mockService, depot.metadataIndex, []services.ForwardTarget{
+		{Name: "sink", URL: receiver.URL, Forward: true, Retry: fastPolicy(2)},
+	}, depot.deliveryLog)
+	forwarder.PayloadStored(record)
+
+	failed := waitForDelivery(t, depot, services.DeliveryFailed)
+	deliveries := listDeliveries(t, depot, "?status=failed")
+	if len(deliveries) != 1 {
+		t.Fatalf("Expected 1 failed delivery, got %d", len(deliveries))
+	}
+	got := deliveries[0]
+	if got.Kind != services.DeliveryKindForward || got.Target != "sink" || got.ObjectName != "001_payload.json" {
+		t.Errorf("Unexpected delivery %+v", got)
+	}
+	if len(got.Attempts) != 2 || got.Attempts[0].Error == "" {
+		t.Errorf("Expected 2 failed attempts in the history, got %+v", got.Attempts)
+	}
+
+	healthy.Store(true)
+	w := httptest.NewRecorder()
+	depot.deliveriesHandler.RedriveHandler(w, httptest.NewRequest("POST", "/deliveries/redrive?id="+failed.ID, nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status Accepted, got %d: %s", w.Code, w.Body.String())
+	}
+
+	delivered := waitForDelivery(t, depot, services.DeliveryDelivered)
+	if delivered.ID != failed.ID || len(delivered.Attempts) != 3 || delivered.Attempts[2].Error != "" {
+		t.Errorf("Expected the re-drive to append a successful attempt, got %+v", delivered)
+	}
+
+	w = httptest.NewRecorder()
+	depot.deliveriesHandler.RedriveHandler(w, httptest.NewRequest("POST", "/deliveries/redrive?id="+failed.ID, nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status Conflict for a delivered re-drive, got %d", w.Code)
+	}
+}
+
+func TestDeliveriesHandler_RecordsCallbacks(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+
+	policy := fastPolicy(1)
+	notifier := services.NewHTTPCallbackNotifier("", policy, depot.deliveryLog)
+	notifier.Notify("http://127.0.0.1:1/unreachable", services.CompletionEvent{RequestID: "42"})
+
+	failed := waitForDelivery(t, depot, services.DeliveryFailed)
+	if failed.Kind != services.DeliveryKindCallback || failed.RequestID != "42" || len(failed.Attempts) != 1 {
+		t.Errorf("Unexpected callback delivery %+v", failed)
+	}
+
+	if deliveries := listDeliveries(t, depot, "?kind=forward"); len(deliveries) != 0 {
+		t.Errorf("Expected no forward deliveries, got %d", len(deliveries))
+	}
+
+	w := httptest.NewRecorder()
+	depot.deliveriesHandler.RedriveHandler(w, httptest.NewRequest("POST", "/deliveries/redrive?all=true", nil))
+	var response struct {
+		Queued int `json:"queued"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if w.Code != http.StatusAccepted || response.Queued != 1 {
+		t.Errorf("Expected 1 queued re-drive, got %d (%d)", response.Queued, w.Code)
+	}
+}
+
+func TestDeliveriesHandler_InvalidRequests(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+
+	w := httptest.NewRecorder()
+	depot.deliveriesHandler.DeliveriesHandler(w, httptest.NewRequest("GET", "/deliveries?status=lost", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status BadRequest for an unknown status, got %d", w.Code)
+	}
+
+	cases := map[string]int{
+		"/deliveries/redrive":        http.StatusBadRequest,
+		"/deliveries/redrive?id=404": http.StatusNotFound,
+	}
+	for target, status := range cases {
+		w := httptest.NewRecorder()
+		depot.deliveriesHandler.RedriveHandler(w, httptest.NewRequest("POST", target, nil))
+		if w.Code != status {
+			t.Errorf("%s: expected status %d, got %d", target, status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/frontends"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestDepotFS_FlatLayout(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	seedRequestObject(mockService, depot.metadataIndex, "req-a", "payload.json", `{"a":1}`, time.Now())
+	seedRequestObject(mockService, depot.metadataIndex, "req-b", "notes.txt", "notes", time.Now().Add(-48*time.Hour))
+
+	fsys := services.NewDepotFS(depot.metadataIndex, mockService)
+	fsys.SetFlat(true)
+	entries, err := fsys.ReadDir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	if !slices.Equal(names, []string{"req-a", "req-b"}) {
+		t.Errorf("Expected request directories at the root, got %v", names)
+	}
+	if data, err := fsys.ReadFile("/req-b/notes.txt"); err != nil || string(data) != "notes" {
+		t.Errorf("Expected the payload, got %q (%v)", data, err)
+	}
+	if err := fsys.CheckWrite("/req-a/new.txt"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("Expected a read-only filesystem, got %v", err)
+	}
+}
+
+func TestMountFUSE_ReadOnly(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	seedRequestObject(mockService, depot.metadataIndex, "req-a", "payload.json", `{"a":1}`, time.Now())
+
+	fsys := services.NewDepotFS(depot.metadataIndex, mockService)
+	fsys.SetFlat(true)
+	mountpoint := t.TempDir()
+	mount, err := frontends.MountFUSE(fsys, mountpoint)
+	if err != nil {
+		t.Skipf("Cannot mount FUSE here: %v", err)
+	}
+	defer mount.Unmount()
+
+	data, err := os.ReadFile(filepath.Join(mountpoint, "req-a", "payload.json"))
+	if err != nil || string(data) != `{"a":1}` {
+		t.Errorf("Expected the payload through the mount, got %q (%v)", data, err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(mountpoint, "*", "*.json"))
+	if len(matches) != 1 {
+		t.Errorf("Expected to glob the payload, got %v", matches)
+	}
+	if err := os.WriteFile(filepath.Join(mountpoint, "req-a", "new.txt"), []byte("x"), 0o644); err == nil {
+		t.Error("Expected writes to fail on a read-only mount")
+	}
+	if _, err := os.Stat(filepath.Join(mountpoint, "missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected a missing request to not exist, got %v", err)
+	}
+}
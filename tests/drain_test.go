@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// gatedStorage holds every save until its gate is opened
+type gatedStorage struct {
+	*MockStorageService
+	gate chan struct{}
+}
+
+func (g *gatedStorage) SavePayload(objectName string, data []byte, contentType string, metadata map[string]string) error {
+	<-g.gate
+	return g.MockStorageService.SavePayload(objectName, data, contentType, metadata)
+}
+
+func TestPayloadService_DrainWaitsForAsyncSaves(t *testing.T) {
+	storage := &gatedStorage{MockStorageService: NewMockStorageService(), gate: make(chan struct{})}
+	depot := newTestDepot(storage)
+
+	if _, err := depot.payloadService.StorePayload([]byte("accepted"), "text/plain", "", services.StoreOptions{}); err != nil {
+		t.Fatalf("StorePayload failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := depot.payloadService.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Drain to wait for the pending save, got %v", err)
+	}
+
+	close(storage.gate)
+	if err := depot.payloadService.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain failed: %v", err)
+	}
+	if objects, _ := storage.ListPayloads(); len(objects) != 1 {
+		t.Errorf("Expected the accepted payload saved once drained, got %v", objects)
+	}
+
+	// Uploads accepted while draining are saved before they are answered
+	depot.payloadService.StorePayload([]byte("late"), "text/plain", "", services.StoreOptions{})
+	if objects, _ := storage.ListPayloads(); len(objects) != 2 {
+		t.Errorf("Expected an upload during the drain saved synchronously, got %v", objects)
+	}
+}
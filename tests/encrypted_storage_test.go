@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// testKey returns a deterministic 32-byte key
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func newTestKeyring(t *testing.T, activeID string, ids ...string) *services.Keyring {
+	t.Helper()
+	keys := make(map[string][]byte)
+	for i, id := range ids {
+		keys[id] = testKey(byte(i + 1))
+	}
+	keyring, err := services.NewKeyring(keys, activeID)
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %v", err)
+	}
+	return keyring
+}
+
+func TestEncryptedStorage_RoundTrip(t *testing.T) {
+	mockService := NewMockStorageService()
+	storage := services.NewEncryptedStorage(mockService, newTestKeyring(t, "k1", "k1"))
+
+	plain := []byte(`{"secret": true}`)
+	if err := storage.SavePayload("1_payload.json", plain, "application/json", map[string]string{services.MetadataRequestID: "1"}); err != nil {
+		t.Fatalf("SavePayload failed: %v", err)
+	}
+
+	if bytes.Contains(mockService.payloads["1_payload.json"], []byte("secret")) {
+		t.Error("Expected stored payload to be encrypted")
+	}
+	if mockService.metadata["1_payload.json"][services.MetadataEncryptionKeyID] != "k1" {
+		t.Errorf("Expected key ID k1 in metadata, got %v", mockService.metadata["1_payload.json"])
+	}
+
+	data, err := storage.GetPayload("1_payload.json")
+	if err != nil {
+		t.Fatalf("GetPayload failed: %v", err)
+	}
+	if !bytes.Equal(data, plain) {
+		t.Errorf("Expected %q, got %q", plain, data)
+	}
+}
+
+func TestEncryptedStorage_DecryptsWithRetiredKeys(t *testing.T) {
+	mockService := NewMockStorageService()
+	old := services.NewEncryptedStorage(mockService, newTestKeyring(t, "k1", "k1", "k2"))
+	old.SavePayload("1_payload.txt", []byte("old data"), "text/plain", nil)
+
+	// During a rotation window both keys decrypt, but only k2 encrypts
+	current := services.NewEncryptedStorage(mockService, newTestKeyring(t, "k2", "k1", "k2"))
+	data, err := current.GetPayload("1_payload.txt")
+	if err != nil || string(data) != "old data" {
+		t.Fatalf("Expected retired key to decrypt, got %q, %v", data, err)
+	}
+
+	// Once k1 is removed entirely, its objects are unreadable
+	withoutOld := services.NewEncryptedStorage(mockService, newTestKeyring(t, "k2", "k2"))
+	if _, err := withoutOld.GetPayload("1_payload.txt"); !errors.Is(err, services.ErrUnknownEncryptionKey) {
+		t.Errorf("Expected ErrUnknownEncryptionKey, got %v", err)
+	}
+}
+
+func TestEncryptedStorage_RotateKeys(t *testing.T) {
+	mockService := NewMockStorageService()
+	old := services.NewEncryptedStorage(mockService, newTestKeyring(t, "k1", "k1", "k2"))
+	old.SavePayload("1_a.txt", []byte("a"), "text/plain", map[string]string{services.MetadataRequestID: "1"})
+	mockService.payloads["2_legacy.txt"] = []byte("plaintext")
+
+	current := services.NewEncryptedStorage(mockService, newTestKeyring(t, "k2", "k1", "k2"))
+	current.SavePayload("3_b.txt", []byte("b"), "text/plain", nil)
+
+	rotated, err := current.RotateKeys()
+	if err != nil {
+		t.Fatalf("RotateKeys failed: %v", err)
+	}
+	if rotated != 2 {
+		t.Errorf("Expected 2 rotated objects, got %d", rotated)
+	}
+
+	for name, content := range map[string]string{"1_a.txt": "a", "2_legacy.txt": "plaintext", "3_b.txt": "b"} {
+		if mockService.metadata[name][services.MetadataEncryptionKeyID] != "k2" {
+			t.Errorf("Expected %s under key k2, got %v", name, mockService.metadata[name])
+		}
+		data, err := current.GetPayload(name)
+		if err != nil || string(data) != content {
+			t.Errorf("Expected %s to decrypt to %q, got %q, %v", name, content, data, err)
+		}
+	}
+	if mockService.metadata["1_a.txt"][services.MetadataRequestID] != "1" {
+		t.Error("Expected rotation to preserve existing object metadata")
+	}
+	if mockService.contentTypes["1_a.txt"] != "text/plain" {
+		t.Errorf("Expected rotation to preserve content type, got %s", mockService.contentTypes["1_a.txt"])
+	}
+}
+
+func TestEncryptedStorage_RejectsTampering(t *testing.T) {
+	mockService := NewMockStorageService()
+	storage := services.NewEncryptedStorage(mockService, newTestKeyring(t, "k1", "k1"))
+	storage.SavePayload("1_payload.bin", []byte("data"), "", nil)
+
+	stored := mockService.payloads["1_payload.bin"]
+	stored[len(stored)-1] ^= 0xff
+
+	if _, err := storage.GetPayload("1_payload.bin"); err == nil {
+		t.Error("Expected tampered ciphertext to fail decryption")
+	}
+}
+
+func TestParseEncryptionKeys(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(testKey(7))
+	keys, err := services.ParseEncryptionKeys("2024:" + encoded + ", 2025:" + encoded)
+	if err != nil {
+		t.Fatalf("ParseEncryptionKeys failed: %v", err)
+	}
+	if len(keys) != 2 || !bytes.Equal(keys["2025"], testKey(7)) {
+		t.Errorf("Unexpected keys %v", keys)
+	}
+
+	if _, err := services.NewKeyring(keys, "missing"); err == nil {
+		t.Error("Expected an error for an active key missing from the keyring")
+	}
+	if _, err := services.NewKeyring(map[string][]byte{"short": []byte("x")}, "short"); err == nil {
+		t.Error("Expected an error for a key that is not 32 bytes")
+	}
+}
@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// newFakeTransit serves the Vault Transit encrypt/decrypt API, "wrapping" keys by
+// base64-encoding them behind a vault:v1: prefix
+func newFakeTransit(t *testing.T, token string) (*httptest.Server, *int) {
+	t.Helper()
+	var mu sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		if r.Header.Get("X-Vault-Token") != token {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/depot":
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"ciphertext": "vault:v1:" + body["plaintext"]}})
+		case "/v1/transit/decrypt/depot":
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"plaintext": strings.TrimPrefix(body["ciphertext"], "vault:v1:")}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestEnvelopeStorage_VaultTransitRoundTrip(t *testing.T) {
+	vault, calls := newFakeTransit(t, "s.token")
+	mockService := NewMockStorageService()
+	wrapper := services.NewVaultTransitWrapper(vault.URL, "s.token", "transit", "depot")
+	storage := services.NewEnvelopeStorage(mockService, wrapper, nil)
+
+	if err := storage.SavePayload("1_payload.txt", []byte("top secret"), "text/plain", nil); err != nil {
+		t.Fatalf("SavePayload failed: %v", err)
+	}
+
+	metadata := mockService.metadata["1_payload.txt"]
+	if metadata[services.MetadataEncryptionKeyID] != "vault:transit/depot" {
+		t.Errorf("Unexpected key ID %q", metadata[services.MetadataEncryptionKeyID])
+	}
+	wrapped, _ := base64.StdEncoding.DecodeString(metadata[services.MetadataWrappedKey])
+	if !strings.HasPrefix(string(wrapped), "vault:v1:") {
+		t.Errorf("Expected a Vault-wrapped data key in metadata, got %q", wrapped)
+	}
+	if bytes.Contains(mockService.payloads["1_payload.txt"], []byte("top secret")) {
+		t.Error("Expected stored payload to be encrypted")
+	}
+
+	data, err := storage.GetPayload("1_payload.txt")
+	if err != nil || string(data) != "top secret" {
+		t.Fatalf("Expected decrypted payload, got %q, %v", data, err)
+	}
+	if *calls != 2 {
+		t.Errorf("Expected one wrap and one unwrap call, got %d", *calls)
+	}
+}
+
+func TestEnvelopeStorage_UsesDistinctDataKeys(t *testing.T) {
+	vault, _ := newFakeTransit(t, "s.token")
+	mockService := NewMockStorageService()
+	storage := services.NewEnvelopeStorage(mockService, services.NewVaultTransitWrapper(vault.URL, "s.token", "transit", "depot"), nil)
+
+	storage.SavePayload("1_a.txt", []byte("same"), "text/plain", nil)
+	storage.SavePayload("2_b.txt", []byte("same"), "text/plain", nil)
+
+	if mockService.metadata["1_a.txt"][services.MetadataWrappedKey] == mockService.metadata["2_b.txt"][services.MetadataWrappedKey] {
+		t.Error("Expected each object to get its own data key")
+	}
+}
+
+func TestEnvelopeStorage_WrapFailureFailsSave(t *testing.T) {
+	vault, _ := newFakeTransit(t, "s.token")
+	mockService := NewMockStorageService()
+	storage := services.NewEnvelopeStorage(mockService, services.NewVaultTransitWrapper(vault.URL, "wrong", "transit", "depot"), nil)
+
+	if err := storage.SavePayload("1_a.txt", []byte("data"), "text/plain", nil); err == nil {
+		t.Error("Expected SavePayload to fail when the key manager rejects the request")
+	}
+	if len(mockService.payloads) != 0 {
+		t.Error("Expected nothing to be stored")
+	}
+}
+
+func TestEnvelopeStorage_RotatesStaticKeyObjects(t *testing.T) {
+	vault, _ := newFakeTransit(t, "s.token")
+	mockService := NewMockStorageService()
+	keyring := newTestKeyring(t, "k1", "k1")
+	services.NewEncryptedStorage(mockService, keyring).SavePayload("1_old.txt", []byte("old"), "text/plain", nil)
+
+	storage := services.NewEnvelopeStorage(mockService, services.NewVaultTransitWrapper(vault.URL, "s.token", "transit", "depot"), keyring)
+
+	// Static-key objects stay readable while envelope encryption is active
+	if data, err := storage.GetPayload("1_old.txt"); err != nil || string(data) != "old" {
+		t.Fatalf("Expected static-key object to decrypt, got %q, %v", data, err)
+	}
+
+	rotated, err := storage.RotateKeys()
+	if err != nil || rotated != 1 {
+		t.Fatalf("Expected 1 rotated object, got %d, %v", rotated, err)
+	}
+	if mockService.metadata["1_old.txt"][services.MetadataWrappedKey] == "" {
+		t.Error("Expected rotated object to carry a wrapped data key")
+	}
+	if rotated, _ := storage.RotateKeys(); rotated != 0 {
+		t.Errorf("Expected a second rotation to be a no-op, got %d", rotated)
+	}
+}
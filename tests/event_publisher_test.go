@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// recordingSink keeps the events published to it, refusing the first failures of them
+type recordingSink struct {
+	mu       sync.Mutex
+	keys     []string
+	values   [][]byte
+	failures int
+	block    chan struct{}
+	closed   bool
+}
+
+func (s *recordingSink) Publish(ctx context.Context, key string, value []byte) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("broker unavailable")
+	}
+	s.keys = append(s.keys, key)
+	s.values = append(s.values, value)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func TestEventPublisher_PublishesStoredPayloads(t *testing.T) {
+	sink := &recordingSink{}
+	publisher, err := services.NewEventPublisher(sink, services.EventFormatJSON, 10)
+	if err != nil {
+		t.Fatalf("NewEventPublisher failed: %v", err)
+	}
+	depot := newTestDepot(NewMockStorageService())
+	depot.payloadService.AddObserver(publisher)
+
+	result, err := depot.payloadService.StorePayload([]byte(`{"order":42}`), "application/json", "order.json", services.StoreOptions{Sync: true})
+	if err != nil {
+		t.Fatalf("StorePayload failed: %v", err)
+	}
+	if err := publisher.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if len(sink.values) != 1 || !sink.closed {
+		t.Fatalf("Expected 1 event and a closed sink, got %d events, closed %t", len(sink.values), sink.closed)
+	}
+	if sink.keys[0] != result.RequestID {
+		t.Errorf("Expected events keyed by request ID %s, got %s", result.RequestID, sink.keys[0])
+	}
+	var event services.PayloadEvent
+	if err := json.Unmarshal(sink.values[0], &event); err != nil {
+		t.Fatalf("Invalid event: %v", err)
+	}
+	if event.Type != services.EventPayloadStored || event.Object.ObjectName != result.Objects[0].ObjectName ||
+		event.Object.OriginalFilename != "order.json" || event.Object.SHA256 != result.Objects[0].SHA256 {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+}
+
+func TestEventPublisher_CloudEventsAndRetries(t *testing.T) {
+	sink := &recordingSink{failures: 1}
+	publisher, err := services.NewEventPublisher(sink, services.EventFormatCloudEvents, 10)
+	if err != nil {
+		t.Fatalf("NewEventPublisher failed: %v", err)
+	}
+	publisher.PayloadStored(services.ObjectRecord{RequestID: "req-1", ObjectName: "req-1_payload.json", Size: 2})
+	if err := publisher.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if len(sink.values) != 1 || publisher.Failed() != 0 {
+		t.Fatalf("Expected the event to be published on its second attempt, got %d events, %d failed", len(sink.values), publisher.Failed())
+	}
+	var event map[string]any
+	if err := json.Unmarshal(sink.values[0], &event); err != nil {
+		t.Fatalf("Invalid event: %v", err)
+	}
+	if event["specversion"] != "1.0" || event["type"] != "payload.stored" || event["subject"] != "req-1_payload.json" || event["id"] == "" {
+		t.Errorf("Unexpected CloudEvent: %v", event)
+	}
+	if data, _ := event["data"].(map[string]any); data["request_id"] != "req-1" {
+		t.Errorf("Expected the object in the CloudEvent's data, got %v", event["data"])
+	}
+
+	if _, err := services.NewEventPublisher(sink, "avro", 10); err == nil {
+		t.Error("Expected an unsupported format to be refused")
+	}
+}
+
+func TestEventPublisher_DropsEventsWhenTheQueueIsFull(t *testing.T) {
+	sink := &recordingSink{block: make(chan struct{})}
+	publisher, err := services.NewEventPublisher(sink, services.EventFormatJSON, 2)
+	if err != nil {
+		t.Fatalf("NewEventPublisher failed: %v", err)
+	}
+
+	// One event is held by the blocked broker, two wait in the queue
+	for i := 0; i < 5; i++ {
+		publisher.PayloadStored(services.ObjectRecord{RequestID: "req-1", ObjectName: "req-1_payload.json"})
+		time.Sleep(5 * time.Millisecond)
+	}
+	if publisher.Dropped() != 2 {
+		t.Errorf("Expected 2 dropped events, got %d", publisher.Dropped())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := publisher.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Close to give up while the broker is stuck, got %v", err)
+	}
+	close(sink.block)
+	if err := publisher.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if len(sink.values) != 3 {
+		t.Errorf("Expected the 3 queued events to be published, got %d", len(sink.values))
+	}
+
+	publisher.PayloadStored(services.ObjectRecord{RequestID: "req-2", ObjectName: "req-2_payload.json"})
+	if len(sink.values) != 3 {
+		t.Errorf("Expected events stored after Close to be dropped, got %d", len(sink.values))
+	}
+}
@@ -0,0 +1,169 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// sseEvent is one event read from a Server-Sent Events stream
+type sseEvent struct {
+	id, name, data string
+}
+
+// readSSE reads events from a stream onto a channel until it ends
+func readSSE(response *http.Response) <-chan sseEvent {
+	events := make(chan sseEvent)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(response.Body)
+		var event sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if event.data != "" {
+					events <- event
+				}
+				event = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				event.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				event.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				event.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return events
+}
+
+func nextSSE(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("Stream ended")
+		}
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for an event")
+	}
+	return sseEvent{}
+}
+
+func TestEventsHandler_StreamsStoredPayloads(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+	server := httptest.NewServer(http.HandlerFunc(depot.feedHandler.EventsHandler))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/events?prefix=orders-")
+	if err != nil {
+		t.Fatalf("GET /events failed: %v", err)
+	}
+	defer response.Body.Close()
+	if got := response.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %q", got)
+	}
+	events := readSSE(response)
+
+	store := func(requestID, filename string) {
+		t.Helper()
+		_, err := depot.payloadService.StorePayload([]byte(`{"total":12}`), "application/json", filename, services.StoreOptions{RequestID: requestID, Sync: true})
+		if err != nil {
+			t.Fatalf("StorePayload failed: %v", err)
+		}
+	}
+	store("other-1", "skip.json")
+	store("orders-1", "order.json")
+
+	event := nextSSE(t, events)
+	if event.name != "stored" || event.id != "2" {
+		t.Errorf("Expected the stored event with ID 2, got %q %q", event.name, event.id)
+	}
+	var message struct {
+		Object services.ObjectRecord `json:"object"`
+	}
+	if err := json.Unmarshal([]byte(event.data), &message); err != nil {
+		t.Fatalf("Invalid event data %q: %v", event.data, err)
+	}
+	if message.Object.RequestID != "orders-1" || message.Object.OriginalFilename != "order.json" || message.Object.Size != 12 {
+		t.Errorf("Unexpected object: %+v", message.Object)
+	}
+
+	depot.feedHandler.CloseStreams()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("Expected no further events")
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Expected the stream to end on shutdown")
+	}
+}
+
+func TestEventsHandler_ResumesFromLastEventID(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+	for _, requestID := range []string{"orders-1", "orders-2", "orders-3"} {
+		if _, err := depot.payloadService.StorePayload([]byte(`{}`), "application/json", "", services.StoreOptions{RequestID: requestID, Sync: true}); err != nil {
+			t.Fatalf("StorePayload failed: %v", err)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(depot.feedHandler.EventsHandler))
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL+"/events", nil)
+	request.Header.Set("Last-Event-ID", "1")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("GET /events failed: %v", err)
+	}
+	defer response.Body.Close()
+	events := readSSE(response)
+
+	for _, want := range []string{"2", "3"} {
+		if event := nextSSE(t, events); event.id != want {
+			t.Errorf("Expected missed event %s, got %s", want, event.id)
+		}
+	}
+	if _, err := depot.payloadService.StorePayload([]byte(`{}`), "application/json", "", services.StoreOptions{RequestID: "orders-4", Sync: true}); err != nil {
+		t.Fatalf("StorePayload failed: %v", err)
+	}
+	if event := nextSSE(t, events); event.id != "4" {
+		t.Errorf("Expected the live event 4 after the missed ones, got %s", event.id)
+	}
+	depot.feedHandler.CloseStreams()
+}
+
+func TestEventsHandler_StreamsOnlyTheTenantsPayloads(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+	scope := handlers.NewTenantScope("", map[string]string{"globex-key": "globex"}, handlers.DefaultPublicRoutes)
+	server := httptest.NewServer(scope.Wrap("/events", depot.feedHandler.EventsHandler))
+	defer server.Close()
+	defer depot.feedHandler.CloseStreams()
+
+	request, _ := http.NewRequest("GET", server.URL+"/events", nil)
+	request.Header.Set("X-Api-Key", "globex-key")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("GET /events failed: %v", err)
+	}
+	defer response.Body.Close()
+	events := readSSE(response)
+
+	for _, tenant := range []string{"acme", "globex"} {
+		if _, err := depot.payloadService.StorePayload([]byte(`{}`), "application/json", "", services.StoreOptions{RequestID: "order-42", Tenant: tenant, Sync: true}); err != nil {
+			t.Fatalf("StorePayload failed: %v", err)
+		}
+	}
+	if event := nextSSE(t, events); event.id != "2" || !strings.Contains(event.data, `"globex.order-42"`) {
+		t.Errorf("Expected globex's event only, got %s %s", event.id, event.data)
+	}
+}
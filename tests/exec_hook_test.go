@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// writeHookScript writes an executable shell script for an exec hook to run
+func writeHookScript(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hook.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExecHook_RunsCommandWithObjectDetails(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	script := writeHookScript(t, `echo "$DEPOT_OBJECT_PATH|$DEPOT_REQUEST_ID|$DEPOT_SIZE|$DEPOT_TAGS|$1" > `+out+`.env
+cat > `+out+`.json
+`)
+
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	policy, _ := services.RetryPolicy{MaxAttempts: 1, Timeout: services.Duration(5 * time.Second), Concurrency: 1}.WithDefaults()
+	hook, err := services.NewExecHook(script+" --scan", "depot-payloads", policy, depot.deliveryLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	depot.payloadService.AddObserver(hook)
+
+	result, err := depot.payloadService.StorePayload([]byte(`{"a":1}`), "application/json", "", services.StoreOptions{Tags: []string{"audit"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delivery := waitForDelivery(t, depot, services.DeliveryDelivered)
+	if delivery.Kind != services.DeliveryKindExecHook {
+		t.Errorf("Expected an exec-hook delivery, got %s", delivery.Kind)
+	}
+
+	objectName := result.Objects[0].ObjectName
+	env, _ := os.ReadFile(out + ".env")
+	expected := "depot-payloads/" + objectName + "|" + result.RequestID + "|7|audit|--scan"
+	if strings.TrimSpace(string(env)) != expected {
+		t.Errorf("Expected environment %q, got %q", expected, env)
+	}
+	var record services.ObjectRecord
+	data, _ := os.ReadFile(out + ".json")
+	if err := json.Unmarshal(data, &record); err != nil || record.ObjectName != objectName {
+		t.Errorf("Expected the record on stdin, got %s (%v)", data, err)
+	}
+}
+
+func TestExecHook_RecordsFailuresAndTimeouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		timeout time.Duration
+		errText string
+	}{
+		{"failing command", "echo 'scanner unavailable' >&2\nexit 3\n", 5 * time.Second, "scanner unavailable"},
+		{"slow command", "sleep 5\n", 100 * time.Millisecond, "timed out"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := NewMockStorageService()
+			depot := newTestDepot(mockService)
+			policy, _ := services.RetryPolicy{MaxAttempts: 1, Timeout: services.Duration(tt.timeout)}.WithDefaults()
+			hook, err := services.NewExecHook(writeHookScript(t, tt.script), "depot-payloads", policy, depot.deliveryLog)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hook.PayloadStored(services.ObjectRecord{RequestID: "r1", ObjectName: "r1_payload.json"})
+
+			delivery := waitForDelivery(t, depot, services.DeliveryFailed)
+			if len(delivery.Attempts) != 1 || !strings.Contains(delivery.Attempts[0].Error, tt.errText) {
+				t.Errorf("Expected a failed attempt mentioning %q, got %+v", tt.errText, delivery.Attempts)
+			}
+		})
+	}
+}
+
+func TestExecHook_SkipsSelfTestProbesAndRejectsMissingCommands(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	policy, _ := services.RetryPolicy{}.WithDefaults()
+	hook, err := services.NewExecHook(writeHookScript(t, "exit 0\n"), "depot-payloads", policy, depot.deliveryLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook.PayloadStored(services.ObjectRecord{ObjectName: "probe", Tags: []string{services.SelfTestTag}})
+	time.Sleep(50 * time.Millisecond)
+	if deliveries := depot.deliveryLog.List("", "", 0); len(deliveries) != 0 {
+		t.Errorf("Expected self-test probes to be skipped, got %+v", deliveries)
+	}
+
+	for _, command := range []string{"", "   ", "/nonexistent/depot-hook"} {
+		if _, err := services.NewExecHook(command, "depot-payloads", policy, depot.deliveryLog); err == nil {
+			t.Errorf("Expected %q to be rejected", command)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// seedJSONPayload stores a JSON document and records it in the index
+func seedJSONPayload(mock *MockStorageService, index services.MetadataIndex, name, body string, tags ...string) {
+	mock.payloads[name] = []byte(body)
+	index.PayloadStored(services.ObjectRecord{
+		RequestID:   name[:3],
+		ObjectName:  name,
+		ContentType: "application/json",
+		Size:        len(body),
+		Tags:        tags,
+		StoredAt:    time.Now(),
+	})
+}
+
+func TestExportHandler_CSVWithFieldMapping(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	seedJSONPayload(mockService, depot.metadataIndex, "001_payload.json", `{"user": {"id": 7, "name": "Ada"}, "ok": true}`, "billing")
+	seedJSONPayload(mockService, depot.metadataIndex, "002_payload.json", `{"user": {"id": 8, "name": "Bob"}}`, "debug")
+
+	target := "/export?tag=billing&field=" + url.QueryEscape("id:.user.id") + "&field=" + url.QueryEscape("name:.user.name")
+	w := httptest.NewRecorder()
+	depot.exportHandler.ExportHandler(w, httptest.NewRequest("GET", target, nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected header and 1 row, got %d records", len(records))
+	}
+	if records[0][3] != "id" || records[0][4] != "name" {
+		t.Errorf("Unexpected header %v", records[0])
+	}
+	if records[1][1] != "001_payload.json" || records[1][3] != "7" || records[1][4] != "Ada" {
+		t.Errorf("Unexpected row %v", records[1])
+	}
+}
+
+func TestExportHandler_CSVFlattensByDefault(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	seedJSONPayload(mockService, depot.metadataIndex, "001_payload.json", `{"user": {"id": 7}, "items": [1, 2]}`)
+
+	w := httptest.NewRecorder()
+	depot.exportHandler.ExportHandler(w, httptest.NewRequest("GET", "/export", nil))
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	header := records[0][3:]
+	if len(header) != 2 || header[0] != "items" || header[1] != "user.id" {
+		t.Errorf("Unexpected flattened header %v", header)
+	}
+	if records[1][3] != "[1,2]" || records[1][4] != "7" {
+		t.Errorf("Unexpected flattened row %v", records[1])
+	}
+}
+
+func TestExportHandler_Parquet(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	seedJSONPayload(mockService, depot.metadataIndex, "001_payload.json", `{"name": "Ada"}`)
+	seedJSONPayload(mockService, depot.metadataIndex, "002_payload.json", `{"other": 1}`)
+
+	w := httptest.NewRecorder()
+	depot.exportHandler.ExportHandler(w, httptest.NewRequest("GET", "/export?format=parquet", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+
+	file, err := parquet.OpenFile(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("Failed to open parquet output: %v", err)
+	}
+	if file.NumRows() != 2 {
+		t.Errorf("Expected 2 rows, got %d", file.NumRows())
+	}
+	if _, ok := file.Schema().Lookup("name"); !ok {
+		t.Error("Expected a name column in the parquet schema")
+	}
+}
+
+func TestExportHandler_InvalidParameters(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+
+	for _, target := range []string{"/export?format=xml", "/export?after=yesterday", "/export?field=nocolon"} {
+		w := httptest.NewRecorder()
+		depot.exportHandler.ExportHandler(w, httptest.NewRequest("GET", target, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status BadRequest, got %d", target, w.Code)
+		}
+	}
+}
+
+func TestExportHandler_RefusesExportsOverTheLimits(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	seedJSONPayload(mockService, depot.metadataIndex, "001_payload.json", `{"n": 1}`)
+	seedJSONPayload(mockService, depot.metadataIndex, "002_payload.json", `{"n": 2}`)
+
+	for _, limits := range []struct {
+		rows  int
+		bytes int64
+	}{{rows: 1}, {bytes: 10}} {
+		exporter := services.NewDefaultExporter(depot.metadataIndex, mockService, services.NewGojqQueryEvaluator(time.Second, 100))
+		exporter.SetLimits(limits.rows, limits.bytes)
+		w := httptest.NewRecorder()
+		handlers.NewExportHandler(exporter).ExportHandler(w, httptest.NewRequest("GET", "/export", nil))
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected status 413 with limits %+v, got %d", limits, w.Code)
+		}
+	}
+}
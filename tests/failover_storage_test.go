@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// flakyNode is a mock storage endpoint that can be taken down
+type flakyNode struct {
+	*MockStorageService
+	down atomic.Bool
+}
+
+var errNodeDown = errors.New("connection refused")
+
+func newFlakyNode() *flakyNode {
+	return &flakyNode{MockStorageService: NewMockStorageService()}
+}
+
+func (n *flakyNode) CheckHealth() error {
+	if n.down.Load() {
+		return errNodeDown
+	}
+	return nil
+}
+
+func (n *flakyNode) SavePayload(objectName string, data []byte, contentType string, metadata map[string]string) error {
+	if n.down.Load() {
+		return errNodeDown
+	}
+	return n.MockStorageService.SavePayload(objectName, data, contentType, metadata)
+}
+
+func (n *flakyNode) GetPayload(objectName string) ([]byte, error) {
+	if n.down.Load() {
+		return nil, errNodeDown
+	}
+	return n.MockStorageService.GetPayload(objectName)
+}
+
+// newFailover builds a failover storage over n nodes with the given write policy
+func newFailover(t *testing.T, policy string, n int) (*services.FailoverStorage, []*flakyNode) {
+	t.Helper()
+	var nodes []*flakyNode
+	var endpoints []services.StorageEndpoint
+	for i := 0; i < n; i++ {
+		node := newFlakyNode()
+		nodes = append(nodes, node)
+		endpoints = append(endpoints, services.StorageEndpoint{Name: string(rune('a' + i)), Storage: node})
+	}
+	failover, err := services.NewFailoverStorage(endpoints, policy, time.Hour)
+	if err != nil {
+		t.Fatalf("NewFailoverStorage failed: %v", err)
+	}
+	return failover, nodes
+}
+
+func TestFailoverStorage_ReadsFailOverToReplica(t *testing.T) {
+	failover, nodes := newFailover(t, services.WritePolicyAll, 2)
+	if err := failover.SavePayload("001_payload.txt", []byte("hello"), "text/plain", nil); err != nil {
+		t.Fatalf("SavePayload failed: %v", err)
+	}
+	for i, node := range nodes {
+		if _, err := node.MockStorageService.GetPayload("001_payload.txt"); err != nil {
+			t.Errorf("Expected node %d to hold the object under the all policy", i)
+		}
+	}
+
+	nodes[0].down.Store(true)
+	data, err := failover.GetPayload("001_payload.txt")
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("Expected the read to fail over to the replica, got %q (%v)", data, err)
+	}
+
+	failover.CheckOnce()
+	status := failover.Status()
+	if status[0].Healthy || status[0].Error == "" || !status[1].Healthy {
+		t.Errorf("Unexpected health after the primary went down: %+v", status)
+	}
+	if err := failover.SavePayload("002_payload.txt", []byte("x"), "text/plain", nil); err != nil {
+		t.Errorf("Expected writes to skip the unhealthy primary, got %v", err)
+	}
+
+	nodes[0].down.Store(false)
+	failover.CheckOnce()
+	if !failover.Status()[0].Healthy {
+		t.Error("Expected the primary to recover")
+	}
+}
+
+func TestFailoverStorage_PrimaryPolicyFallsBack(t *testing.T) {
+	failover, nodes := newFailover(t, services.WritePolicyPrimary, 2)
+	failover.SavePayload("001_payload.txt", []byte("one"), "text/plain", nil)
+	if _, err := nodes[1].MockStorageService.GetPayload("001_payload.txt"); err == nil {
+		t.Error("Expected the primary policy to write only to the primary")
+	}
+
+	// The primary fails before the health checker notices
+	nodes[0].down.Store(true)
+	if err := failover.SavePayload("002_payload.txt", []byte("two"), "text/plain", nil); err != nil {
+		t.Fatalf("Expected the write to fall back to the replica, got %v", err)
+	}
+	if _, err := nodes[1].MockStorageService.GetPayload("002_payload.txt"); err != nil {
+		t.Error("Expected the replica to hold the fallback write")
+	}
+
+	nodes[1].down.Store(true)
+	failover.CheckOnce()
+	if err := failover.SavePayload("003_payload.txt", nil, "", nil); !errors.Is(err, services.ErrNoHealthyEndpoint) {
+		t.Errorf("Expected ErrNoHealthyEndpoint, got %v", err)
+	}
+}
+
+func TestFailoverStorage_QuorumPolicy(t *testing.T) {
+	failover, nodes := newFailover(t, services.WritePolicyQuorum, 3)
+
+	nodes[2].down.Store(true)
+	if err := failover.SavePayload("001_payload.txt", []byte("x"), "text/plain", nil); err != nil {
+		t.Errorf("Expected 2 of 3 endpoints to reach quorum, got %v", err)
+	}
+
+	nodes[1].down.Store(true)
+	if err := failover.SavePayload("002_payload.txt", []byte("x"), "text/plain", nil); err == nil {
+		t.Error("Expected 1 of 3 endpoints to miss quorum")
+	}
+
+	if _, err := services.NewFailoverStorage([]services.StorageEndpoint{{Name: "a", Storage: nodes[0]}}, "some", time.Hour); err == nil {
+		t.Error("Expected an error for an unsupported write policy")
+	}
+}
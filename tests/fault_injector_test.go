@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestFaultInjector_FailsAndDelaysStorage(t *testing.T) {
+	mock := NewMockStorageService()
+	mock.payloads["kept_a.txt"] = []byte("a")
+	injector, err := services.NewFaultInjector(mock, services.FaultPlan{
+		Latency:         5 * time.Millisecond,
+		SaveFailureRate: 1,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	start := time.Now()
+	if err := injector.SavePayload("new_b.txt", []byte("b"), "text/plain", nil); !errors.Is(err, services.ErrInjectedFault) {
+		t.Errorf("Expected an injected save failure, got %v", err)
+	}
+	if time.Since(start) < 5*time.Millisecond {
+		t.Error("Expected the save to be delayed")
+	}
+	if _, exists := mock.payloads["new_b.txt"]; exists {
+		t.Error("Expected a failed save to leave storage untouched")
+	}
+	if data, err := injector.GetPayload("kept_a.txt"); err != nil || string(data) != "a" {
+		t.Errorf("Expected reads to pass without a read failure rate, got %q %v", data, err)
+	}
+
+	faults := injector.Faults()
+	if faults.SaveFailures != 1 || faults.ReadFailures != 0 || faults.Delayed != 2 {
+		t.Errorf("Expected one save failure and two delays, got %+v", faults)
+	}
+}
+
+func TestFaultInjector_SimulatesOutages(t *testing.T) {
+	mock := NewMockStorageService()
+	injector, _ := services.NewFaultInjector(mock, services.FaultPlan{
+		OutageEvery: 200 * time.Millisecond,
+		OutageFor:   100 * time.Millisecond,
+	})
+
+	if _, err := injector.ListPayloads(); !errors.Is(err, services.ErrInjectedFault) {
+		t.Errorf("Expected storage down at the start of the cycle, got %v", err)
+	}
+	time.Sleep(120 * time.Millisecond)
+	if err := injector.SavePayload("up_a.txt", []byte("a"), "text/plain", nil); err != nil {
+		t.Errorf("Expected storage back after the outage, got %v", err)
+	}
+	if injector.Faults().OutageErrors != 1 {
+		t.Errorf("Expected one outage error, got %+v", injector.Faults())
+	}
+
+	for name, plan := range map[string]services.FaultPlan{
+		"rate above one":      {SaveFailureRate: 1.5},
+		"outage never ending": {OutageEvery: time.Second, OutageFor: time.Second},
+		"negative latency":    {Latency: -time.Second},
+	} {
+		if _, err := services.NewFaultInjector(mock, plan); err == nil {
+			t.Errorf("%s: expected the plan to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+type changesResponse struct {
+	Events    []services.ChangeEvent `json:"events"`
+	Cursor    int64                  `json:"cursor"`
+	Truncated bool                   `json:"truncated"`
+}
+
+func getChanges(t *testing.T, handler http.HandlerFunc, query string) changesResponse {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/changes"+query, nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d", w.Code)
+	}
+	var response changesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	return response
+}
+
+func TestChangesHandler_StoredAndDeletedInOrder(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+
+	req := httptest.NewRequest("POST", "/depot", strings.NewReader("hello"))
+	w := httptest.NewRecorder()
+	depot.httpHandler.DepotHandler(w, req)
+
+	// Wait for async storage
+	time.Sleep(100 * time.Millisecond)
+
+	first := getChanges(t, depot.feedHandler.ChangesHandler, "")
+	if len(first.Events) != 1 || first.Events[0].Type != services.ChangeStored {
+		t.Fatalf("Expected one stored event, got %+v", first.Events)
+	}
+
+	if err := depot.payloadService.RemoveObject(first.Events[0].Object); err != nil {
+		t.Fatalf("Failed to remove object: %v", err)
+	}
+
+	second := getChanges(t, depot.feedHandler.ChangesHandler, "?since="+strconv.FormatInt(first.Cursor, 10))
+	if len(second.Events) != 1 || second.Events[0].Type != services.ChangeDeleted {
+		t.Fatalf("Expected one deleted event, got %+v", second.Events)
+	}
+	if second.Cursor <= first.Cursor {
+		t.Errorf("Expected cursor to advance past %d, got %d", first.Cursor, second.Cursor)
+	}
+
+	caughtUp := getChanges(t, depot.feedHandler.ChangesHandler, "?since="+strconv.FormatInt(second.Cursor, 10))
+	if len(caughtUp.Events) != 0 || caughtUp.Cursor != second.Cursor {
+		t.Errorf("Expected no new events at cursor %d, got %+v", second.Cursor, caughtUp)
+	}
+}
+
+func TestChangesHandler_InvalidCursor(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+
+	req := httptest.NewRequest("GET", "/changes?since=abc", nil)
+	w := httptest.NewRecorder()
+	depot.feedHandler.ChangesHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status BadRequest, got %d", w.Code)
+	}
+}
+
+func TestChangeJournal_PersistsAndTruncates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "changes.jsonl")
+
+	journal, err := services.NewChangeJournal(path, 2)
+	if err != nil {
+		t.Fatalf("Failed to create journal: %v", err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		journal.PayloadStored(services.ObjectRecord{ObjectName: name})
+	}
+
+	reopened, err := services.NewChangeJournal(path, 2)
+	if err != nil {
+		t.Fatalf("Failed to reopen journal: %v", err)
+	}
+	events, next, truncated := reopened.Since(0, 10)
+	if len(events) != 2 || events[0].Object.ObjectName != "b" || next != 3 {
+		t.Fatalf("Expected retained events b and c up to cursor 3, got %+v (next %d)", events, next)
+	}
+	if !truncated {
+		t.Error("Expected truncated flag when the oldest events were dropped")
+	}
+
+	reopened.PayloadStored(services.ObjectRecord{ObjectName: "d"})
+	events, next, _ = reopened.Since(3, 10)
+	if len(events) != 1 || events[0].Cursor != 4 || next != 4 {
+		t.Errorf("Expected cursor to continue at 4 after reopening, got %+v", events)
+	}
+}
+
+func TestWaitHandler_ReturnsWhenPayloadArrives(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		req := httptest.NewRequest("GET", "/wait?timeout=2s", nil)
+		w := httptest.NewRecorder()
+		depot.feedHandler.WaitHandler(w, req)
+		done <- w
+	}()
+
+	// Give the waiter time to subscribe before uploading
+	time.Sleep(50 * time.Millisecond)
+	req := httptest.NewRequest("POST", "/depot", strings.NewReader("hello"))
+	depot.httpHandler.DepotHandler(httptest.NewRecorder(), req)
+
+	select {
+	case w := <-done:
+		var response struct {
+			Matched bool                 `json:"matched"`
+			Event   services.ChangeEvent `json:"event"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse JSON response: %v", err)
+		}
+		if !response.Matched || response.Event.Object.ObjectName == "" {
+			t.Errorf("Expected matched event, got %+v", response)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Wait did not return after payload arrived")
+	}
+}
+
+func TestWaitHandler_TimesOut(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+
+	req := httptest.NewRequest("GET", "/wait?prefix=nothing&timeout=50ms", nil)
+	w := httptest.NewRecorder()
+	depot.feedHandler.WaitHandler(w, req)
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	if response["matched"] != false {
+		t.Errorf("Expected matched=false on timeout, got %v", response)
+	}
+}
+
+func TestWaitHandler_EndsOnShutdown(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		depot.feedHandler.WaitHandler(w, httptest.NewRequest("GET", "/wait?prefix=nothing&timeout=5m", nil))
+		done <- w
+	}()
+	depot.feedHandler.CloseStreams()
+
+	select {
+	case w := <-done:
+		if !strings.Contains(w.Body.String(), `"matched":false`) {
+			t.Errorf("Expected an unmatched answer on shutdown, got %s", w.Body.String())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the poll to end on shutdown")
+	}
+}
+
+func TestWaitHandler_ReplaysSinceCursor(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+	cursor := depot.changeJournal.Cursor()
+
+	req := httptest.NewRequest("POST", "/depot", strings.NewReader("early"))
+	w := httptest.NewRecorder()
+	depot.httpHandler.DepotHandler(w, req)
+
+	var stored map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &stored)
+	requestID := stored["request_id"].(string)
+
+	// Wait for async storage
+	time.Sleep(100 * time.Millisecond)
+
+	req = httptest.NewRequest("GET", "/wait?timeout=50ms&prefix="+requestID+"&since="+strconv.FormatInt(cursor, 10), nil)
+	w = httptest.NewRecorder()
+	depot.feedHandler.WaitHandler(w, req)
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	if response["matched"] != true {
+		t.Errorf("Expected payload stored after cursor to match, got %v", response)
+	}
+}
@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func writeWatchedFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitForRemoval waits for the watcher to clean up a file once its objects are saved
+func waitForRemoval(t *testing.T, path string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Expected %s to be cleaned up", path)
+}
+
+func newTestWatcher(depot *testDepot, dir string) *services.FolderWatcher {
+	watcher := services.NewFolderWatcher(dir, depot.payloadService, services.NewDefaultContentTypeDetector(), time.Minute)
+	depot.payloadService.AddObserver(watcher)
+	return watcher
+}
+
+func TestFolderWatcher_IngestsSettledFiles(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	dir := t.TempDir()
+	watcher := newTestWatcher(depot, dir)
+
+	writeWatchedFile(t, filepath.Join(dir, "acme", "orders", "batch.csv"), "id\n1\n")
+	writeWatchedFile(t, filepath.Join(dir, "loose.json"), `{"a":1}`)
+	writeWatchedFile(t, filepath.Join(dir, "upload.part"), "partial")
+	writeWatchedFile(t, filepath.Join(dir, ".hidden", "skip.txt"), "hidden")
+
+	// Files are only uploaded once a second scan sees them unchanged
+	if ingested, _ := watcher.ScanOnce(); ingested != 0 {
+		t.Fatalf("Expected nothing on the first scan, got %d", ingested)
+	}
+	if ingested, failed := watcher.ScanOnce(); ingested != 2 || failed != 0 {
+		t.Fatalf("Expected 2 files ingested, got %d (%d failed)", ingested, failed)
+	}
+	waitForRemoval(t, filepath.Join(dir, "acme", "orders", "batch.csv"))
+	waitForRemoval(t, filepath.Join(dir, "loose.json"))
+
+	records := make(map[string]services.ObjectRecord)
+	for _, record := range depot.metadataIndex.List() {
+		records[record.OriginalFilename] = record
+	}
+	if batch := records["batch.csv"]; !slices.Equal(batch.Tags, []string{"acme", "orders"}) {
+		t.Errorf("Expected the subfolders as tags, got %v", batch.Tags)
+	}
+	if loose := records["loose.json"]; len(loose.Tags) != 0 || loose.ContentType != "application/json" {
+		t.Errorf("Expected an untagged JSON payload, got %v %s", loose.Tags, loose.ContentType)
+	}
+	for _, name := range []string{"upload.part", ".hidden/skip.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %s to be left alone, got %v", name, err)
+		}
+	}
+}
+
+func TestFolderWatcher_WaitsForWritesToFinish(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	dir := t.TempDir()
+	watcher := newTestWatcher(depot, dir)
+
+	path := filepath.Join(dir, "growing.log")
+	writeWatchedFile(t, path, "line 1\n")
+	watcher.ScanOnce()
+	writeWatchedFile(t, path, "line 1\nline 2\n")
+	if ingested, _ := watcher.ScanOnce(); ingested != 0 {
+		t.Fatal("Expected a file that changed between scans to wait")
+	}
+	if ingested, _ := watcher.ScanOnce(); ingested != 1 {
+		t.Fatal("Expected the settled file to be ingested")
+	}
+	waitForRemoval(t, path)
+}
+
+func TestFolderWatcher_ArchivesIngestedFiles(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "done")
+	watcher := newTestWatcher(depot, dir)
+	watcher.SetArchiveDir(archive)
+
+	writeWatchedFile(t, filepath.Join(dir, "acme", "report.txt"), "report")
+	watcher.ScanOnce()
+	watcher.ScanOnce()
+	waitForRemoval(t, filepath.Join(dir, "acme", "report.txt"))
+
+	if data, err := os.ReadFile(filepath.Join(archive, "acme", "report.txt")); err != nil || string(data) != "report" {
+		t.Fatalf("Expected the file in the archive, got %q (%v)", data, err)
+	}
+	// The archive inside the watched directory is not ingested again
+	watcher.ScanOnce()
+	if ingested, _ := watcher.ScanOnce(); ingested != 0 {
+		t.Errorf("Expected the archive to be skipped, got %d ingested", ingested)
+	}
+}
@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// receivedRequest captures what a forward target saw
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// newReceiver starts a target server that records requests and answers with status
+func newReceiver(t *testing.T, status int) (*httptest.Server, func() []receivedRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var received []receivedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, receivedRequest{header: r.Header.Clone(), body: body})
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []receivedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]receivedRequest{}, received...)
+	}
+}
+
+func TestReplayHandler_SignsWithTargetSettings(t *testing.T) {
+	receiver, received := newReceiver(t, http.StatusOK)
+	mockService := NewMockStorageService()
+	index := services.NewMemoryMetadataIndex()
+	seedJSONPayload(mockService, index, "001_payload.json", `{"a": 1}`)
+
+	forwarder := services.NewPayloadForwarder(mockService, index, []services.ForwardTarget{{
+		Name:            "audit",
+		URL:             receiver.URL,
+		Secret:          "s3cret",
+		SignatureHeader: "X-Audit-Signature",
+		Algorithm:       "sha512",
+	}}, services.NewDeliveryLog(10))
+	handler := handlers.NewReplayHandler(forwarder)
+
+	w := httptest.NewRecorder()
+	handler.ReplayHandler(w, httptest.NewRequest("POST", "/replay?request_id=001&target=audit", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+
+	requests := received()
+	if len(requests) != 1 {
+		t.Fatalf("Expected 1 delivery, got %d", len(requests))
+	}
+	got := requests[0]
+	if string(got.body) != `{"a": 1}` || got.header.Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected delivery %q (%s)", got.body, got.header.Get("Content-Type"))
+	}
+	if got.header.Get("X-Depot-Object") != "001_payload.json" {
+		t.Errorf("Unexpected X-Depot-Object %q", got.header.Get("X-Depot-Object"))
+	}
+
+	expected, _ := services.SignRequest("sha512", "s3cret", got.header.Get("X-Depot-Timestamp"), got.body)
+	if got.header.Get("X-Audit-Signature") != "sha512="+expected {
+		t.Errorf("Signature mismatch: got %q", got.header.Get("X-Audit-Signature"))
+	}
+}
+
+func TestReplayHandler_ReportsFailures(t *testing.T) {
+	receiver, _ := newReceiver(t, http.StatusInternalServerError)
+	mockService := NewMockStorageService()
+	index := services.NewMemoryMetadataIndex()
+	seedJSONPayload(mockService, index, "001_payload.json", `{}`)
+
+	handler := handlers.NewReplayHandler(services.NewPayloadForwarder(mockService, index, []services.ForwardTarget{{Name: "flaky", URL: receiver.URL}}, services.NewDeliveryLog(10)))
+
+	w := httptest.NewRecorder()
+	handler.ReplayHandler(w, httptest.NewRequest("POST", "/replay?request_id=001&target=flaky", nil))
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("Expected status BadGateway, got %d", w.Code)
+	}
+	var response struct {
+		Deliveries []services.DeliveryResult `json:"deliveries"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if len(response.Deliveries) != 1 || response.Deliveries[0].Status != services.DeliveryFailed {
+		t.Errorf("Expected a failed delivery, got %+v", response.Deliveries)
+	}
+
+	cases := map[string]int{
+		"/replay?request_id=001&target=missing": http.StatusNotFound,
+		"/replay?request_id=999&target=flaky":   http.StatusNotFound,
+		"/replay?request_id=001":                http.StatusBadRequest,
+	}
+	for target, status := range cases {
+		w := httptest.NewRecorder()
+		handler.ReplayHandler(w, httptest.NewRequest("POST", target, nil))
+		if w.Code != status {
+			t.Errorf("%s: expected status %d, got %d", target, status, w.Code)
+		}
+	}
+}
+
+func TestPayloadForwarder_ForwardsNewUploads(t *testing.T) {
+	receiver, received := newReceiver(t, http.StatusOK)
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	forwarder := services.NewPayloadForwarder(mockService, depot.metadataIndex, []services.ForwardTarget{
+		{Name: "live", URL: receiver.URL, Forward: true},
+		{Name: "manual", URL: receiver.URL},
+	}, depot.deliveryLog)
+	depot.payloadService.AddObserver(forwarder)
+
+	req := httptest.NewRequest("POST", "/depot", strings.NewReader("hello"))
+	req.Header.Set("Content-Type", "text/plain")
+	depot.httpHandler.DepotHandler(httptest.NewRecorder(), req)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(received()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	requests := received()
+	if len(requests) != 1 || string(requests[0].body) != "hello" {
+		t.Fatalf("Expected exactly one forwarded upload, got %d", len(requests))
+	}
+	if requests[0].header.Get("X-Depot-Signature") != "" {
+		t.Error("Expected unsigned delivery for a target without a secret")
+	}
+}
+
+func TestLoadForwardTargets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.json")
+	os.WriteFile(path, []byte(`[{"name": "a", "url": "http://example.com", "algorithm": "SHA1"}]`), 0o644)
+
+	targets, err := services.LoadForwardTargets(path)
+	if err != nil {
+		t.Fatalf("LoadForwardTargets failed: %v", err)
+	}
+	if targets[0].SignatureHeader != services.DefaultSignatureHeader || targets[0].Algorithm != "sha1" {
+		t.Errorf("Unexpected defaults %+v", targets[0])
+	}
+
+	os.WriteFile(path, []byte(`[{"name": "a", "url": "http://example.com", "algorithm": "md5"}]`), 0o644)
+	if _, err := services.LoadForwardTargets(path); err == nil {
+		t.Error("Expected an error for an unsupported algorithm")
+	}
+}
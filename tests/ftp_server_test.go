@@ -0,0 +1,286 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/frontends"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// ftpClient speaks just enough FTP to drive the server in tests
+type ftpClient struct {
+	t       *testing.T
+	addr    string
+	conn    net.Conn
+	text    *textproto.Conn
+	tlsConf *tls.Config
+	private bool
+}
+
+func dialFTP(t *testing.T, addr string) *ftpClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &ftpClient{t: t, addr: addr, conn: conn, text: textproto.NewConn(conn)}
+	t.Cleanup(func() { c.text.Close() })
+	c.expect(220)
+	return c
+}
+
+// cmd sends a command and returns the reply code and message
+func (c *ftpClient) cmd(format string, args ...any) (int, string) {
+	c.t.Helper()
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		c.t.Fatal(err)
+	}
+	code, message, err := c.text.ReadResponse(0)
+	if err != nil && code == 0 {
+		c.t.Fatal(err)
+	}
+	return code, message
+}
+
+func (c *ftpClient) expect(code int) string {
+	c.t.Helper()
+	got, message, err := c.text.ReadResponse(code)
+	if err != nil {
+		c.t.Fatalf("Expected %d, got %d %s", code, got, message)
+	}
+	return message
+}
+
+func (c *ftpClient) mustCmd(code int, format string, args ...any) string {
+	c.t.Helper()
+	got, message := c.cmd(format, args...)
+	if got != code {
+		c.t.Fatalf("Expected %d for %q, got %d %s", code, format, got, message)
+	}
+	return message
+}
+
+func (c *ftpClient) login(user, password string) {
+	c.t.Helper()
+	c.mustCmd(331, "USER %s", user)
+	c.mustCmd(230, "PASS %s", password)
+}
+
+func (c *ftpClient) startTLS(config *tls.Config) {
+	c.t.Helper()
+	c.mustCmd(234, "AUTH TLS")
+	conn := tls.Client(c.conn, config)
+	if err := conn.Handshake(); err != nil {
+		c.t.Fatal(err)
+	}
+	c.conn, c.text, c.tlsConf = conn, textproto.NewConn(conn), config
+}
+
+// data opens a passive data connection and sends command over the control connection
+func (c *ftpClient) data(format string, args ...any) (net.Conn, int, string) {
+	c.t.Helper()
+	message := c.mustCmd(229, "EPSV")
+	port := message[strings.Index(message, "|||")+3 : strings.LastIndex(message, "|")]
+	host, _, _ := net.SplitHostPort(c.addr)
+	conn, err := net.Dial("tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if c.private {
+		conn = tls.Client(conn, c.tlsConf)
+	}
+	code, message := c.cmd(format, args...)
+	return conn, code, message
+}
+
+func (c *ftpClient) read(format string, args ...any) string {
+	c.t.Helper()
+	conn, code, message := c.data(format, args...)
+	if code != 150 {
+		c.t.Fatalf("Expected 150 for %q, got %d %s", format, code, message)
+	}
+	data, _ := io.ReadAll(conn)
+	conn.Close()
+	c.expect(226)
+	return string(data)
+}
+
+func (c *ftpClient) write(data string, format string, args ...any) (int, string) {
+	c.t.Helper()
+	conn, code, message := c.data(format, args...)
+	if code != 150 {
+		conn.Close()
+		return code, message
+	}
+	io.WriteString(conn, data)
+	conn.Close()
+	code, message, _ = c.text.ReadResponse(0)
+	return code, message
+}
+
+func startFTP(t *testing.T, server *frontends.FTPServer) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return listener.Addr().String()
+}
+
+func TestFTPServer_Browsing(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	seedRequestObject(mockService, depot.metadataIndex, "req-a", "payload.json", `{"a":1}`, day)
+	seedRequestObject(mockService, depot.metadataIndex, "req-a", "report.csv", "x,y", day)
+
+	server := frontends.NewFTPServer(services.NewDepotFS(depot.metadataIndex, mockService), map[string]string{"partner": "s3cret"})
+	client := dialFTP(t, startFTP(t, server))
+
+	if code, _ := client.cmd("LIST"); code != 530 {
+		t.Errorf("Expected commands before login to be refused, got %d", code)
+	}
+	client.mustCmd(331, "USER partner")
+	client.mustCmd(530, "PASS wrong")
+	client.login("partner", "s3cret")
+
+	if listing := client.read("NLST /"); listing != "2026-03-01\r\n" {
+		t.Errorf("Expected the date directory, got %q", listing)
+	}
+	client.mustCmd(250, "CWD /2026-03-01/req-a")
+	if pwd := client.mustCmd(257, "PWD"); !strings.Contains(pwd, `"/2026-03-01/req-a"`) {
+		t.Errorf("Expected the working directory, got %q", pwd)
+	}
+	listing := client.read("LIST -la")
+	if !strings.Contains(listing, "payload.json") || !strings.HasPrefix(listing, "-rw-r--r--") {
+		t.Errorf("Expected an ls-style listing, got %q", listing)
+	}
+	if size := client.mustCmd(213, "SIZE report.csv"); size != "3" {
+		t.Errorf("Expected the file size, got %q", size)
+	}
+	if data := client.read("RETR payload.json"); data != `{"a":1}` {
+		t.Errorf("Expected the payload, got %q", data)
+	}
+	client.mustCmd(250, "CDUP")
+	client.mustCmd(550, "CWD missing")
+	client.mustCmd(550, "DELE /2026-03-01/req-a/payload.json")
+	if code, _ := client.write("data", "STOR /2026-03-01/req-a/new.txt"); code != 550 {
+		t.Errorf("Expected uploads to be refused, got %d", code)
+	}
+	client.mustCmd(502, "PORT 127,0,0,1,4,1")
+	client.mustCmd(221, "QUIT")
+}
+
+func TestFTPServer_Writable(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	seedRequestObject(mockService, depot.metadataIndex, "req-old", "old.txt", "old", time.Now())
+
+	fsys := services.NewDepotFS(depot.metadataIndex, mockService)
+	fsys.SetWriter(depot.payloadService, depot.payloadService)
+	client := dialFTP(t, startFTP(t, frontends.NewFTPServer(fsys, map[string]string{"partner": "s3cret"})))
+	client.login("partner", "s3cret")
+
+	today := time.Now().UTC().Format("2006-01-02")
+	client.mustCmd(257, "MKD /%s/batch-9", today)
+	if code, message := client.write("id\n1\n", "STOR /%s/batch-9/orders.csv", today); code != 226 {
+		t.Fatalf("Expected the upload to be stored, got %d %s", code, message)
+	}
+	if data := waitForObject(t, mockService, "batch-9_orders.csv"); string(data) != "id\n1\n" {
+		t.Errorf("Expected the uploaded payload, got %q", data)
+	}
+	client.mustCmd(250, "DELE /%s/req-old/old.txt", today)
+	if _, exists := mockService.payloads["req-old_old.txt"]; exists {
+		t.Error("Expected the object to be deleted")
+	}
+}
+
+func selfSignedTLS(t *testing.T) (*tls.Config, *tls.Config) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "depot"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	server := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	client := &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"}
+	return server, client
+}
+
+func TestFTPServer_RequiredTLS(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	seedRequestObject(mockService, depot.metadataIndex, "req-a", "payload.json", "secret", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+
+	serverTLS, clientTLS := selfSignedTLS(t)
+	server := frontends.NewFTPServer(services.NewDepotFS(depot.metadataIndex, mockService), map[string]string{"partner": "s3cret"})
+	server.SetTLS(serverTLS, true)
+	addr := startFTP(t, server)
+
+	plain := dialFTP(t, addr)
+	plain.mustCmd(530, "USER partner")
+
+	client := dialFTP(t, addr)
+	client.startTLS(clientTLS)
+	client.login("partner", "s3cret")
+	client.mustCmd(200, "PBSZ 0")
+	if conn, code, _ := client.data("RETR /2026-03-01/req-a/payload.json"); code != 425 {
+		t.Errorf("Expected unprotected data connections to be refused, got %d", code)
+	} else {
+		conn.Close()
+	}
+	client.mustCmd(200, "PROT P")
+	client.private = true
+	if data := client.read("RETR /2026-03-01/req-a/payload.json"); data != "secret" {
+		t.Errorf("Expected the payload over TLS, got %q", data)
+	}
+}
+
+// Passive replies advertise the public host and stay within the port range
+func TestFTPServer_PassiveRange(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	server := frontends.NewFTPServer(services.NewDepotFS(depot.metadataIndex, mockService), map[string]string{"partner": "s3cret"})
+	server.SetPassive("203.0.113.7", 40110, 40119)
+	client := dialFTP(t, startFTP(t, server))
+	client.login("partner", "s3cret")
+
+	message := client.mustCmd(227, "PASV")
+	fields := strings.Split(message[strings.Index(message, "(")+1:strings.Index(message, ")")], ",")
+	if strings.Join(fields[:4], ".") != "203.0.113.7" {
+		t.Errorf("Expected the public host, got %s", message)
+	}
+	high, _ := strconv.Atoi(fields[4])
+	low, _ := strconv.Atoi(fields[5])
+	if port := high<<8 | low; port < 40110 || port > 40119 {
+		t.Errorf("Expected a port in range, got %d", port)
+	}
+}
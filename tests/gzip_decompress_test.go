@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// gzipBytes compresses data with gzip
+func gzipBytes(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	writer.Write([]byte(data))
+	writer.Close()
+	return buf.Bytes()
+}
+
+// depotObjects posts an upload and returns the object names from the response
+func depotObjects(t *testing.T, depot *testDepot, req *http.Request) (string, []string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	depot.httpHandler.DepotHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		RequestID string `json:"request_id"`
+		Objects   []struct {
+			ObjectName string `json:"object_name"`
+		} `json:"objects"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	var names []string
+	for _, object := range response.Objects {
+		names = append(names, object.ObjectName)
+	}
+	return response.RequestID, names
+}
+
+func TestDepotHandler_DecompressGzipFile(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	stored := newStoreWatcher(depot.payloadService)
+
+	req := httptest.NewRequest("POST", "/depot", bytes.NewReader(gzipBytes(t, `{"a": 1}`)))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Disposition", `attachment; filename="events.json.gz"`)
+	req.Header.Set("X-Depot-Decompress", "true")
+	requestID, names := depotObjects(t, depot, req)
+
+	compressed := requestID + "_events.json.gz"
+	plain := requestID + "_events.json"
+	if len(names) != 2 || names[0] != compressed || names[1] != plain {
+		t.Fatalf("Expected objects %s and %s, got %v", compressed, plain, names)
+	}
+
+	stored.wait(t, 2)
+
+	if data, _ := mockService.Payload(plain); string(data) != `{"a": 1}` {
+		t.Errorf("Unexpected decompressed content %q", data)
+	}
+	if metadata := mockService.Metadata(compressed); metadata[services.MetadataDecompressedObject] != plain {
+		t.Errorf("Expected %s to reference %s, got %v", compressed, plain, metadata)
+	}
+	if metadata := mockService.Metadata(plain); metadata[services.MetadataCompressedObject] != compressed {
+		t.Errorf("Expected %s to reference %s, got %v", plain, compressed, metadata)
+	}
+}
+
+func TestDepotHandler_DecompressContentEncoding(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+
+	req := httptest.NewRequest("POST", "/depot", bytes.NewReader(gzipBytes(t, "plain text")))
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("X-Depot-Decompress", "true")
+	requestID, names := depotObjects(t, depot, req)
+
+	plain := requestID + "_payload.txt"
+	if len(names) != 2 || names[0] != plain+".gz" || names[1] != plain {
+		t.Fatalf("Unexpected objects %v", names)
+	}
+}
+
+func TestDepotHandler_DecompressNotRequested(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+
+	req := httptest.NewRequest("POST", "/depot", bytes.NewReader(gzipBytes(t, "plain text")))
+	req.Header.Set("Content-Disposition", `attachment; filename="notes.txt.gz"`)
+	_, names := depotObjects(t, depot, req)
+
+	if len(names) != 1 {
+		t.Errorf("Expected a single stored object, got %v", names)
+	}
+}
+
+func TestDepotHandler_DecompressRejectsCorruptGzip(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+
+	req := httptest.NewRequest("POST", "/depot", bytes.NewReader([]byte("not gzip")))
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("X-Depot-Decompress", "true")
+	w := httptest.NewRecorder()
+	depot.httpHandler.DepotHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status BadRequest, got %d", w.Code)
+	}
+}
@@ -1,14 +1,19 @@
 package tests
 
 import (
+	"archive/zip"
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
 )
 
 func TestDepotHandler_JSONPayload(t *testing.T) {
@@ -150,6 +155,97 @@ func TestDepotHandler_MultipartFormData(t *testing.T) {
 	}
 }
 
+func TestDepotHandler_ReturnsObjectNames(t *testing.T) {
+	mockService := NewMockStorageService()
+	handler := createTestHandler(mockService)
+	// Answer once the objects are saved, so they can be checked right away
+	handler.SetSyncStore(true)
+
+	var b bytes.Buffer
+	writer := multipart.NewWriter(&b)
+	for _, name := range []string{"first.txt", "second.json"} {
+		part, err := writer.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatalf("Failed to create form file: %v", err)
+		}
+		part.Write([]byte("content of " + name))
+	}
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/depot", &b)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+
+	handler.DepotHandler(w, req)
+
+	var response struct {
+		RequestID string `json:"request_id"`
+		Objects   []struct {
+			ObjectName       string `json:"object_name"`
+			OriginalFilename string `json:"original_filename"`
+			Size             int    `json:"size"`
+			SHA256           string `json:"sha256"`
+		} `json:"objects"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+
+	if len(response.Objects) != 2 {
+		t.Fatalf("Expected 2 objects, got %d", len(response.Objects))
+	}
+	if response.Objects[0].ObjectName != response.RequestID+"_first.txt" {
+		t.Errorf("Unexpected object name %s", response.Objects[0].ObjectName)
+	}
+	if response.Objects[1].OriginalFilename != "second.json" {
+		t.Errorf("Unexpected original filename %s", response.Objects[1].OriginalFilename)
+	}
+
+	for _, object := range response.Objects {
+		if _, exists := mockService.Payload(object.ObjectName); !exists {
+			t.Errorf("Expected object %s to be stored", object.ObjectName)
+		}
+	}
+}
+
+func TestGetHandler_KeepsOriginalFilenames(t *testing.T) {
+	storage, _ := services.NewMemoryStorageService(0)
+	depot := newTestDepot(storage)
+
+	var b bytes.Buffer
+	writer := multipart.NewWriter(&b)
+	part, _ := writer.CreateFormFile("file", "my_notes.txt")
+	part.Write([]byte("notes"))
+	writer.Close()
+	req := httptest.NewRequest("POST", "/depot?sync=true", &b)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("X-Depot-Request-Id", "myid")
+	depot.httpHandler.DepotHandler(httptest.NewRecorder(), req)
+
+	// Objects stored before filenames were kept in metadata fall back to their names
+	storage.SavePayload("1754732400_4f2a9c1e0b7d3a65_pull_request.json", []byte("{}"), "application/json", nil)
+	storage.SavePayload("order-7_daily_report.csv", []byte("a"), "text/csv", nil)
+
+	for requestID, want := range map[string]string{
+		"myid":                        "my_notes.txt",
+		"1754732400_4f2a9c1e0b7d3a65": "pull_request.json",
+		"order-7":                     "daily_report.csv",
+	} {
+		w := httptest.NewRecorder()
+		depot.httpHandler.GetHandler(w, httptest.NewRequest("GET", "/get?raw=true&request_id="+requestID, nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Disposition"), `"`+want+`"`) {
+			t.Errorf("%s: expected %s as the filename, got %d %v", requestID, want, w.Code, w.Header().Get("Content-Disposition"))
+		}
+	}
+
+	// A single object is named from its metadata, as its request ID is not given
+	w := httptest.NewRecorder()
+	depot.httpHandler.GetHandler(w, httptest.NewRequest("GET", "/get?object=myid_my_notes.txt", nil))
+	if !strings.Contains(w.Header().Get("Content-Disposition"), `"my_notes.txt"`) {
+		t.Errorf("Expected my_notes.txt as the object's filename, got %v", w.Header().Get("Content-Disposition"))
+	}
+}
+
 func TestListHandler_Success(t *testing.T) {
 	mockService := NewMockStorageService()
 	mockService.payloads["test1"] = []byte("data1")
@@ -195,11 +291,11 @@ func TestGetHandler_Success(t *testing.T) {
 	mockService := NewMockStorageService()
 	// Add test data with proper naming pattern
 	testData := []byte("test data")
-	mockService.payloads["12345_test.txt"] = testData
+	mockService.payloads["1754732400_4f2a9c1e_test.txt"] = testData
 
 	handler := createTestHandler(mockService)
 
-	req := httptest.NewRequest("GET", "/get?request_id=12345", nil)
+	req := httptest.NewRequest("GET", "/get?request_id=1754732400_4f2a9c1e", nil)
 	w := httptest.NewRecorder()
 
 	handler.GetHandler(w, req)
@@ -237,6 +333,54 @@ func TestGetHandler_NotFound(t *testing.T) {
 	}
 }
 
+func TestGetHandler_PagesManyFiles(t *testing.T) {
+	mockService := NewMockStorageService()
+	for i := 0; i < 5; i++ {
+		mockService.payloads[fmt.Sprintf("batch_file%d.txt", i)] = []byte(strings.Repeat("a", 30))
+	}
+	mockService.payloads["batch_huge.bin"] = []byte(strings.Repeat("b", 300))
+	handler := createTestHandler(mockService)
+	// Each small file takes 40 bytes as base64
+	handler.SetMaxInlineBytes(100)
+
+	get := func(target string) map[string]any {
+		w := httptest.NewRecorder()
+		handler.GetHandler(w, httptest.NewRequest("GET", target, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+		}
+		var response map[string]any
+		json.NewDecoder(w.Body).Decode(&response)
+		return response
+	}
+
+	first := get("/get?request_id=batch")
+	if first["count"] != 2.0 || first["total"] != 6.0 || first["next_offset"] != 2.0 {
+		t.Errorf("Expected the first page capped at two files, got %v", first)
+	}
+	if first["download_url"] != "/get?request_id=batch&raw=true" {
+		t.Errorf("Expected the raw download offered, got %v", first["download_url"])
+	}
+
+	// The oversized file is listed, not inlined
+	last := get("/get?request_id=batch&offset=4&limit=5")
+	omitted, _ := last["omitted"].([]any)
+	if last["count"] != 1.0 || len(omitted) != 1 || last["next_offset"] != nil {
+		t.Errorf("Expected the last file and the omitted one, got %v", last)
+	}
+
+	limited := get("/get?request_id=batch&offset=1&limit=1")
+	if limited["count"] != 1.0 || limited["next_offset"] != 2.0 {
+		t.Errorf("Expected one file per page, got %v", limited)
+	}
+
+	w := httptest.NewRecorder()
+	handler.GetHandler(w, httptest.NewRequest("GET", "/get?request_id=batch&limit=-1", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid limit rejected, got %d", w.Code)
+	}
+}
+
 // Benchmarks
 func BenchmarkDepotHandler_JSONPayload(b *testing.B) {
 	mockService := NewMockStorageService()
@@ -269,3 +413,248 @@ func BenchmarkDepotHandler_BinaryPayload(b *testing.B) {
 		handler.DepotHandler(w, req)
 	}
 }
+
+func TestDeleteHandler_RemovesEveryObjectOfRequest(t *testing.T) {
+	storage := newHoldingStorage()
+	depot := newTestDepot(storage.MockStorageService)
+	seedIndexedObject(storage.MockStorageService, depot.metadataIndex, "req-1_a.txt", 10, time.Hour)
+	seedIndexedObject(storage.MockStorageService, depot.metadataIndex, "req-1_b.txt", 10, time.Hour)
+	seedIndexedObject(storage.MockStorageService, depot.metadataIndex, "req-10_c.txt", 10, time.Hour)
+
+	del := func(requestID string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		depot.httpHandler.DeleteHandler(w, httptest.NewRequest("DELETE", "/delete?request_id="+requestID, nil))
+		var response map[string]any
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	code, response := del("req-1")
+	if code != http.StatusOK || response["count"] != 2.0 {
+		t.Fatalf("Expected both objects deleted, got %d %v", code, response)
+	}
+	if _, ok := storage.payloads["req-10_c.txt"]; !ok {
+		t.Error("Expected another request sharing the prefix to be kept")
+	}
+	if _, ok := depot.metadataIndex.Get("req-1_a.txt"); ok {
+		t.Error("Expected deleted objects to leave the index")
+	}
+
+	if code, _ := del("req-1"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 once the request is gone, got %d", code)
+	}
+	if code, _ := del("../etc"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid request ID, got %d", code)
+	}
+
+	holds := services.NewLegalHolds(storage, storage)
+	depot.payloadService.SetDeletionGuard(holds)
+	if _, err := holds.Place("req-10"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if code, response := del("req-10"); code != http.StatusConflict || response["count"] != 0.0 {
+		t.Errorf("Expected a held object to be kept with 409, got %d %v", code, response)
+	}
+}
+
+func TestDepotHandler_SyncReportsStorageErrors(t *testing.T) {
+	mockService := NewMockStorageService()
+	handler := createTestHandler(mockService)
+
+	post := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", target, strings.NewReader(`{"a":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		handler.DepotHandler(w, req)
+		return w
+	}
+
+	w := post("/depot?sync=true")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(mockService.payloads) != 1 {
+		t.Errorf("Expected the payload saved before the response, got %d", len(mockService.payloads))
+	}
+
+	mockService.saveError = fmt.Errorf("bucket unreachable")
+	w = post("/depot?sync=true")
+	var response map[string]any
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if w.Code != http.StatusBadGateway || len(response["failed"].([]any)) != 1 {
+		t.Errorf("Expected 502 listing the failed object, got %d %v", w.Code, response)
+	}
+
+	mockService.saveError = fmt.Errorf("%w: all down", services.ErrNoHealthyEndpoint)
+	if w = post("/depot?sync=true"); w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 503 with Retry-After, got %d", w.Code)
+	}
+
+	// The default stays asynchronous
+	if w = post("/depot"); w.Code != http.StatusOK {
+		t.Errorf("Expected an asynchronous upload to be accepted, got %d", w.Code)
+	}
+	handler.SetSyncStore(true)
+	if w = post("/depot"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected DEPOT_SYNC_STORE to make uploads synchronous, got %d", w.Code)
+	}
+	if w = post("/depot?sync=maybe"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid sync value, got %d", w.Code)
+	}
+}
+
+func TestGetHandler_StreamsRawDownloads(t *testing.T) {
+	storage, _ := services.NewMemoryStorageService(0)
+	depot := newTestDepot(storage)
+	storage.SavePayload("one_report.txt", []byte("single file"), "text/plain", nil)
+	storage.SavePayload("many_a.txt", []byte("first"), "text/plain", nil)
+	storage.SavePayload("many_b.txt", []byte(strings.Repeat("second", 100)), "text/plain", nil)
+
+	w := httptest.NewRecorder()
+	depot.httpHandler.GetHandler(w, httptest.NewRequest("GET", "/get?request_id=one&raw=true", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "single file" {
+		t.Fatalf("Expected the single file streamed, got %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Length") != "11" || !strings.Contains(w.Header().Get("Content-Disposition"), "report.txt") {
+		t.Errorf("Expected the file's length and name in the headers, got %v", w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	depot.httpHandler.GetHandler(w, httptest.NewRequest("GET", "/get?request_id=many&raw=true", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("Expected a zip, got %d %v", w.Code, w.Header())
+	}
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("Expected a valid zip: %v", err)
+	}
+	if len(archive.File) != 2 || archive.File[0].Name != "a.txt" {
+		t.Fatalf("Expected both files in the zip, got %d entries", len(archive.File))
+	}
+	entry, _ := archive.File[1].Open()
+	data, err := io.ReadAll(entry)
+	if err != nil || string(data) != strings.Repeat("second", 100) {
+		t.Errorf("Expected the second file intact, got %d bytes, %v", len(data), err)
+	}
+
+	w = httptest.NewRecorder()
+	depot.httpHandler.GetHandler(w, httptest.NewRequest("GET", "/get?request_id=none&raw=true", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown request, got %d", w.Code)
+	}
+}
+
+func TestGetHandler_DownloadsSingleObject(t *testing.T) {
+	storage, _ := services.NewMemoryStorageService(0)
+	mock := NewMockStorageService()
+	// Memory storage streams reads; the mock does not
+	for _, backend := range []services.StorageService{storage, mock} {
+		depot := newTestDepot(backend)
+		backend.SavePayload("order-1_1_report.csv", []byte("a,b\n1,2\n"), "text/csv", nil)
+		backend.SavePayload("order-1_2_chart", []byte{0x89, 'P', 'N', 'G'}, "image/png", nil)
+
+		w := httptest.NewRecorder()
+		depot.httpHandler.GetHandler(w, httptest.NewRequest("GET", "/get?object=order-1_2_chart", nil))
+		if w.Code != http.StatusOK || w.Body.String() != "\x89PNG" {
+			t.Fatalf("Expected only the chart downloaded, got %d %q", w.Code, w.Body.String())
+		}
+		if w.Header().Get("Content-Type") != "image/png" || w.Header().Get("Content-Length") != "4" {
+			t.Errorf("Expected the stored content type and length, got %v", w.Header())
+		}
+
+		w = httptest.NewRecorder()
+		depot.httpHandler.GetHandler(w, httptest.NewRequest("GET", "/get?object=order-1_3_missing.txt", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for an unknown object, got %d", w.Code)
+		}
+	}
+}
+
+func TestGetHandler_AnswersMetadataQueries(t *testing.T) {
+	storage, _ := services.NewMemoryStorageService(0)
+	mock := NewMockStorageService()
+	// Memory storage stats objects; the mock must be read
+	for _, backend := range []services.StorageService{storage, mock} {
+		depot := newTestDepot(backend)
+		depot.httpHandler.SetSyncStore(true)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/depot?request_id=report-1", strings.NewReader("a,b\n1,2\n"))
+		req.Header.Set("Content-Type", "text/csv")
+		req.Header.Set("Content-Disposition", `attachment; filename="report.csv"`)
+		depot.httpHandler.DepotHandler(w, req)
+		var stored struct {
+			Objects []services.StoredObject `json:"objects"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &stored)
+		if len(stored.Objects) != 1 {
+			t.Fatalf("Expected one stored object, got %s", w.Body.String())
+		}
+		object := stored.Objects[0]
+
+		for _, target := range []string{"HEAD /get?request_id=report-1", "HEAD /get?object=" + object.ObjectName, "GET /get?request_id=report-1&meta=true"} {
+			method, url, _ := strings.Cut(target, " ")
+			w = httptest.NewRecorder()
+			depot.httpHandler.GetHandler(w, httptest.NewRequest(method, url, nil))
+			if w.Code != http.StatusOK || w.Body.Len() != 0 {
+				t.Fatalf("%s: expected headers only, got %d %q", target, w.Code, w.Body.String())
+			}
+			headers := w.Header()
+			if headers.Get("Content-Type") != "text/csv" || headers.Get("X-Depot-Size") != "8" || headers.Get("X-Depot-Checksum-Sha256") != object.SHA256 {
+				t.Errorf("%s: expected the type, size and checksum, got %v", target, headers)
+			}
+			if !strings.Contains(headers.Get("Content-Disposition"), `filename="report.csv"`) || headers.Get("Last-Modified") == "" {
+				t.Errorf("%s: expected the original filename and modification time, got %v", target, headers)
+			}
+			if wantLength := map[string]string{"HEAD": "8", "GET": ""}[method]; headers.Get("Content-Length") != wantLength {
+				t.Errorf("%s: expected Content-Length %q, got %q", target, wantLength, headers.Get("Content-Length"))
+			}
+		}
+
+		backend.SavePayload("report-1_2_notes.txt", []byte("second"), "text/plain", nil)
+		w = httptest.NewRecorder()
+		depot.httpHandler.GetHandler(w, httptest.NewRequest("HEAD", "/get?request_id=report-1", nil))
+		if w.Header().Get("Content-Type") != "application/zip" || w.Header().Get("X-Depot-Object-Count") != "2" {
+			t.Errorf("Expected a request of several objects described as a zip, got %v", w.Header())
+		}
+
+		w = httptest.NewRecorder()
+		depot.httpHandler.GetHandler(w, httptest.NewRequest("HEAD", "/get?request_id=missing", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for an unknown request, got %d", w.Code)
+		}
+	}
+}
+
+func TestDepotHandler_RejectsBodiesOverMaxSize(t *testing.T) {
+	mockService := NewMockStorageService()
+	handler := createTestHandler(mockService)
+	handler.SetMaxBodySize(16)
+	handler.SetSyncStore(true)
+
+	post := func(body string, chunked bool) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/depot", strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/plain")
+		if chunked {
+			req.ContentLength = -1
+		}
+		handler.DepotHandler(w, req)
+		return w
+	}
+
+	if w := post("small", false); w.Code != http.StatusOK {
+		t.Fatalf("Expected a body under the limit to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, chunked := range []bool{false, true} {
+		w := post(strings.Repeat("x", 64), chunked)
+		var response map[string]any
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if w.Code != http.StatusRequestEntityTooLarge || response["max_body_size"] != float64(16) {
+			t.Errorf("Expected 413 with the limit for chunked=%v, got %d %v", chunked, w.Code, response)
+		}
+	}
+	if len(mockService.payloads) != 1 {
+		t.Errorf("Expected only the small body stored, got %d payloads", len(mockService.payloads))
+	}
+}
@@ -5,6 +5,7 @@ package tests
 
 import (
 	"bytes"
+	"errors"
 	"os"
 	"testing"
 	"time"
@@ -50,7 +51,7 @@ func TestMinioService_Integration(t *testing.T) {
 		testData := []byte(`{"test": "integration", "timestamp": "` + time.Now().Format(time.RFC3339) + `"}`)
 
 		// Save payload
-		err := service.SavePayload(objectName, testData, "application/json")
+		err := service.SavePayload(objectName, testData, "application/json", nil)
 		if err != nil {
 			t.Fatalf("Failed to save payload: %v", err)
 		}
@@ -73,7 +74,7 @@ func TestMinioService_Integration(t *testing.T) {
 		testData := []byte{0x00, 0x01, 0x02, 0x03, 0xFF, 0xAA, 0xBB}
 
 		// Save payload
-		err := service.SavePayload(objectName, testData, "application/octet-stream")
+		err := service.SavePayload(objectName, testData, "application/octet-stream", nil)
 		if err != nil {
 			t.Fatalf("Failed to save payload: %v", err)
 		}
@@ -103,7 +104,7 @@ func TestMinioService_Integration(t *testing.T) {
 		// Save test objects
 		for _, objName := range testObjects {
 			testData := []byte("test data for " + objName)
-			err := service.SavePayload(objName, testData, "text/plain")
+			err := service.SavePayload(objName, testData, "text/plain", nil)
 			if err != nil {
 				t.Fatalf("Failed to save test object %s: %v", objName, err)
 			}
@@ -141,7 +142,7 @@ func TestMinioService_Integration(t *testing.T) {
 		}
 
 		// Save payload
-		err := service.SavePayload(objectName, testData, "application/octet-stream")
+		err := service.SavePayload(objectName, testData, "application/octet-stream", nil)
 		if err != nil {
 			t.Fatalf("Failed to save large payload: %v", err)
 		}
@@ -188,6 +189,14 @@ func TestMinioService_Integration_ErrorCases(t *testing.T) {
 		}
 	})
 
+	t.Run("PartSizeBelowMinimum", func(t *testing.T) {
+		config := config.LoadConfig()
+		config.MinioPartSize = 1 << 20
+		if _, err := services.NewMinioService(config); err == nil {
+			t.Error("Expected a part size below 5 MiB to be rejected")
+		}
+	})
+
 	t.Run("InvalidCredentials", func(t *testing.T) {
 		config := config.LoadConfig()
 		config.MinioAccessKey = "invalid_key"
@@ -197,10 +206,145 @@ func TestMinioService_Integration_ErrorCases(t *testing.T) {
 		service, err := services.NewMinioService(config)
 		if err == nil {
 			// Try to save something, which should fail
-			err = service.SavePayload("test.txt", []byte("test"), "text/plain")
+			err = service.SavePayload("test.txt", []byte("test"), "text/plain", nil)
 			if err == nil {
 				t.Error("Expected error with invalid credentials, but operation succeeded")
 			}
 		}
 	})
 }
+
+func TestMinioService_Integration_MultipartTuning(t *testing.T) {
+	if os.Getenv("MINIO_ENDPOINT") == "" {
+		t.Skip("Skipping integration test: MINIO_ENDPOINT not set")
+	}
+
+	config := config.LoadConfig()
+	config.MinioPartSize = 5 << 20
+	config.MinioUploadConcurrency = 2
+	service, err := services.NewMinioService(config)
+	if err != nil {
+		t.Fatalf("Failed to create MinIO service: %v", err)
+	}
+
+	objectName := "multipart_tuning_" + time.Now().Format("20060102_150405") + ".bin"
+	data := bytes.Repeat([]byte("0123456789abcdef"), (11<<20)/16)
+	size, err := service.SavePayloadStream(objectName, bytes.NewReader(data), -1, "application/octet-stream", nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to stream payload: %v", err)
+	}
+	defer service.DeletePayload(objectName)
+	if size != int64(len(data)) {
+		t.Errorf("Expected %d bytes streamed, got %d", len(data), size)
+	}
+	retrieved, err := service.GetPayload(objectName)
+	if err != nil || !bytes.Equal(retrieved, data) {
+		t.Errorf("Expected the streamed object to round-trip, got %d bytes (%v)", len(retrieved), err)
+	}
+
+	config.MinioDisableMultipart = true
+	single, err := services.NewMinioService(config)
+	if err != nil {
+		t.Fatalf("Failed to create MinIO service: %v", err)
+	}
+	if _, err := single.SavePayloadStream(objectName, bytes.NewReader(data), -1, "", nil, nil); !errors.Is(err, services.ErrStreamUnsupported) {
+		t.Errorf("Expected streaming of unknown length to be unsupported without multipart, got %v", err)
+	}
+}
+
+func TestS3Service_Integration(t *testing.T) {
+	if os.Getenv("MINIO_ENDPOINT") == "" {
+		t.Skip("Skipping integration test: MINIO_ENDPOINT not set")
+	}
+
+	// MinIO speaks the S3 API, so it stands in for AWS here
+	cfg := config.LoadConfig()
+	cfg.S3Endpoint = cfg.MinioEndpoint
+	cfg.S3Bucket = "depot-s3-test"
+	cfg.S3AccessKeyID = cfg.MinioAccessKey
+	cfg.S3SecretAccessKey = cfg.MinioSecretKey
+	cfg.S3UseSSL = cfg.MinioUseSSL
+
+	service, err := services.NewS3Service(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create S3 service: %v", err)
+	}
+
+	objectName := "s3_test_" + time.Now().Format("20060102_150405") + ".txt"
+	if err := service.SavePayload(objectName, []byte("hello s3"), "text/plain", nil); err != nil {
+		t.Fatalf("Failed to save payload: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := service.DeletePayload(objectName); err != nil {
+			t.Logf("Warning: Failed to cleanup object %s: %v", objectName, err)
+		}
+	})
+
+	data, err := service.GetPayload(objectName)
+	if err != nil || string(data) != "hello s3" {
+		t.Errorf("Expected the payload back, got %q, %v", data, err)
+	}
+}
+
+func TestTenantBucketStorage_Integration(t *testing.T) {
+	if os.Getenv("MINIO_ENDPOINT") == "" {
+		t.Skip("Skipping integration test: MINIO_ENDPOINT not set")
+	}
+
+	shared, err := services.NewMinioService(config.LoadConfig())
+	if err != nil {
+		t.Fatalf("Failed to create MinIO service: %v", err)
+	}
+	storage, err := services.NewTenantBucketStorage(shared, map[string]string{"acme": "depot-tenant-acme"})
+	if err != nil {
+		t.Fatalf("Failed to create tenant bucket storage: %v", err)
+	}
+
+	objectName := "acme.tenant-" + time.Now().Format("20060102150405") + "_payload.txt"
+	if err := storage.SavePayload(objectName, []byte("hello acme"), "text/plain", nil); err != nil {
+		t.Fatalf("Expected the tenant bucket created on first write, got %v", err)
+	}
+	t.Cleanup(func() {
+		if err := storage.DeletePayload(objectName); err != nil {
+			t.Logf("Warning: Failed to cleanup object %s: %v", objectName, err)
+		}
+	})
+
+	if data, err := storage.GetPayload(objectName); err != nil || string(data) != "hello acme" {
+		t.Errorf("Expected the payload back, got %q, %v", data, err)
+	}
+	if _, err := shared.GetPayload(objectName); err == nil {
+		t.Error("Expected the tenant's payload kept out of the shared bucket")
+	}
+}
+
+func TestMinioService_Integration_LifecycleExpiry(t *testing.T) {
+	if os.Getenv("MINIO_ENDPOINT") == "" {
+		t.Skip("Skipping integration test: MINIO_ENDPOINT not set")
+	}
+
+	service, err := services.NewMinioService(config.LoadConfig())
+	if err != nil {
+		t.Fatalf("Failed to create MinIO service: %v", err)
+	}
+	classify := func(tags []string) string { return "debug" }
+	if err := service.SetExpiryRules([]services.ExpiryRule{{Class: "debug", Age: 36 * time.Hour}}, classify); err != nil {
+		t.Fatalf("Failed to set lifecycle rules: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := service.SetExpiryRules(nil, nil); err != nil {
+			t.Logf("Warning: Failed to remove lifecycle rules: %v", err)
+		}
+	})
+	if err := service.SetExpiryRules([]services.ExpiryRule{{Class: "not#valid", Age: time.Hour}}, classify); err == nil {
+		t.Error("Expected a class that cannot be an object tag to be rejected")
+	}
+
+	objectName := "lifecycle_test_" + time.Now().Format("20060102_150405") + ".txt"
+	if err := service.SavePayload(objectName, []byte("tagged"), "text/plain", map[string]string{services.MetadataTags: "debug"}); err != nil {
+		t.Fatalf("Failed to save a tagged payload: %v", err)
+	}
+	if err := service.DeletePayload(objectName); err != nil {
+		t.Logf("Warning: Failed to cleanup object %s: %v", objectName, err)
+	}
+}
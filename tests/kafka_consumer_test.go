@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// fakeKafkaReader hands out queued messages and records committed offsets
+type fakeKafkaReader struct {
+	messages chan services.KafkaMessage
+
+	mu        sync.Mutex
+	committed []int64
+	closed    bool
+}
+
+func (r *fakeKafkaReader) FetchMessage(ctx context.Context) (services.KafkaMessage, error) {
+	select {
+	case message := <-r.messages:
+		return message, nil
+	case <-ctx.Done():
+		return services.KafkaMessage{}, ctx.Err()
+	}
+}
+
+func (r *fakeKafkaReader) CommitMessage(ctx context.Context, message services.KafkaMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.committed = append(r.committed, message.Offset)
+	return nil
+}
+
+func (r *fakeKafkaReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+func (r *fakeKafkaReader) waitForCommits(t *testing.T, count int) []int64 {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		committed := slices.Clone(r.committed)
+		r.mu.Unlock()
+		if len(committed) >= count {
+			return committed
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Expected %d committed offsets", count)
+	return nil
+}
+
+func TestKafkaConsumer_ArchivesMessages(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	reader := &fakeKafkaReader{messages: make(chan services.KafkaMessage, 2)}
+	consumer := services.NewKafkaConsumer(reader, depot.payloadService, services.NewDefaultContentTypeDetector())
+	depot.payloadService.AddObserver(consumer)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- consumer.Run(ctx) }()
+
+	reader.messages <- services.KafkaMessage{
+		Topic: "orders_v2", Partition: 3, Offset: 41,
+		Key:     []byte("customer-7"),
+		Value:   []byte(`{"order":1}`),
+		Headers: map[string]string{"trace id": "abc", "Content-Type": "application/json", "raw": "\x00\x01"},
+	}
+	reader.messages <- services.KafkaMessage{Topic: "orders_v2", Partition: 3, Offset: 42, Value: []byte("plain text")}
+	if committed := reader.waitForCommits(t, 2); !slices.Equal(committed, []int64{41, 42}) {
+		t.Fatalf("Expected offsets committed in order, got %v", committed)
+	}
+
+	// Offsets are only committed once the payload is saved
+	data, err := mockService.GetPayload("orders-v2-3-41_payload.json")
+	if err != nil || string(data) != `{"order":1}` {
+		t.Fatalf("Expected the message stored under its offset, got %q (%v)", data, err)
+	}
+	metadata := mockService.metadata["orders-v2-3-41_payload.json"]
+	expected := map[string]string{
+		services.MetadataKafkaTopic:     "orders_v2",
+		services.MetadataKafkaPartition: "3",
+		services.MetadataKafkaOffset:    "41",
+		services.MetadataKafkaKey:       "customer-7",
+		"Kafka-Header-trace-id":         "abc",
+		"Kafka-Header-raw-Base64":       "AAE=",
+	}
+	for key, value := range expected {
+		if metadata[key] != value {
+			t.Errorf("Expected metadata %s=%q, got %q", key, value, metadata[key])
+		}
+	}
+	record, ok := depot.metadataIndex.Get("orders-v2-3-42_payload.bin")
+	if !ok || !slices.Equal(record.Tags, []string{"orders_v2"}) {
+		t.Errorf("Expected the message tagged with its topic, got %v", record.Tags)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Run to stop on cancel, got %v", err)
+	}
+	if !reader.closed {
+		t.Error("Expected the reader to be closed")
+	}
+}
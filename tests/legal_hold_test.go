@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// holdingStorage records legal holds the way an object-locked bucket would
+type holdingStorage struct {
+	*MockStorageService
+	holdsMu sync.Mutex
+	holds   map[string]bool
+}
+
+func newHoldingStorage() *holdingStorage {
+	return &holdingStorage{MockStorageService: NewMockStorageService(), holds: make(map[string]bool)}
+}
+
+func (h *holdingStorage) SetLegalHold(objectName string, enabled bool) error {
+	h.holdsMu.Lock()
+	defer h.holdsMu.Unlock()
+	h.holds[objectName] = enabled
+	return nil
+}
+
+func (h *holdingStorage) LegalHold(objectName string) (bool, error) {
+	h.holdsMu.Lock()
+	defer h.holdsMu.Unlock()
+	return h.holds[objectName], nil
+}
+
+// legalHold calls /legal-hold with the given method
+func legalHold(handler *handlers.LegalHoldHandler, method, requestID string) (int, []services.LegalHoldStatus) {
+	w := httptest.NewRecorder()
+	handler.LegalHoldHandler(w, httptest.NewRequest(method, "/legal-hold?request_id="+requestID, nil))
+	var response struct {
+		Objects []services.LegalHoldStatus `json:"objects"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response.Objects
+}
+
+func TestLegalHold_BlocksRemovalUntilReleased(t *testing.T) {
+	storage := newHoldingStorage()
+	depot := newTestDepot(storage)
+	holds := services.NewLegalHolds(storage, storage)
+	depot.payloadService.SetDeletionGuard(holds)
+	handler := handlers.NewLegalHoldHandler(holds)
+
+	seedIndexedObject(storage.MockStorageService, depot.metadataIndex, "case-7_evidence.txt", 10, time.Hour)
+	record, _ := depot.metadataIndex.Get("case-7_evidence.txt")
+
+	code, objects := legalHold(handler, "PUT", "case-7")
+	if code != http.StatusOK || len(objects) != 1 || !objects[0].LegalHold {
+		t.Fatalf("Expected the hold to be placed, got %d %+v", code, objects)
+	}
+	if _, objects := legalHold(handler, "GET", "case-7"); len(objects) != 1 || !objects[0].LegalHold {
+		t.Errorf("Expected the hold to be reported, got %+v", objects)
+	}
+
+	if err := depot.payloadService.RemoveObject(record); !errors.Is(err, services.ErrLegalHold) {
+		t.Fatalf("Expected removal of a held object to fail, got %v", err)
+	}
+	evictor := services.NewQuotaEvictor(depot.metadataIndex, depot.payloadService, 1, services.EvictionPolicyFIFO, nil)
+	if evicted := evictor.Evict(); evicted != 0 {
+		t.Errorf("Expected quota eviction to skip a held object, evicted %d", evicted)
+	}
+	if _, err := storage.GetPayload(record.ObjectName); err != nil {
+		t.Fatalf("Expected the held object to survive, got %v", err)
+	}
+
+	if code, objects := legalHold(handler, "DELETE", "case-7"); code != http.StatusOK || objects[0].LegalHold {
+		t.Fatalf("Expected the hold to be released, got %d %+v", code, objects)
+	}
+	if err := depot.payloadService.RemoveObject(record); err != nil {
+		t.Errorf("Expected removal to succeed after release, got %v", err)
+	}
+}
+
+func TestLegalHold_KeepsHeldObjectsOutOfArchive(t *testing.T) {
+	primary := newHoldingStorage()
+	archive := NewMockStorageService()
+	depot := newTestDepot(primary)
+	holds := services.NewLegalHolds(primary, primary)
+
+	seedIndexedObject(primary.MockStorageService, depot.metadataIndex, "1754732400_4f2a9c1e_old.txt", 10, 48*time.Hour)
+	holds.Place("1754732400_4f2a9c1e")
+
+	tierer := services.NewArchiveTierer(primary, archive, depot.metadataIndex, 24*time.Hour, time.Hour)
+	tierer.SetDeletionGuard(holds)
+	if moved := tierer.TierOnce(); moved != 0 {
+		t.Errorf("Expected a held object to stay in the primary backend, moved %d", moved)
+	}
+}
+
+func TestLegalHold_RejectsInvalidRequests(t *testing.T) {
+	storage := newHoldingStorage()
+	handler := handlers.NewLegalHoldHandler(services.NewLegalHolds(storage, storage))
+
+	if code, _ := legalHold(handler, "PUT", "missing"); code != http.StatusNotFound {
+		t.Errorf("Expected an unknown request to return NotFound, got %d", code)
+	}
+	if code, _ := legalHold(handler, "PUT", ""); code != http.StatusBadRequest {
+		t.Errorf("Expected a missing request_id to return BadRequest, got %d", code)
+	}
+	if code, _ := legalHold(handler, "POST", "x"); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected POST to be rejected, got %d", code)
+	}
+	if code, _ := legalHold(handlers.NewLegalHoldHandler(nil), "GET", "x"); code != http.StatusNotImplemented {
+		t.Errorf("Expected NotImplemented without an object-locked bucket, got %d", code)
+	}
+}
@@ -0,0 +1,206 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestListHandler_FiltersByPrefixContentTypeAndTime(t *testing.T) {
+	storage, _ := services.NewMemoryStorageService(0)
+	depot := newTestDepot(storage)
+	depot.httpHandler.SetSyncStore(true)
+
+	upload := func(requestID, contentType, body string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/depot?request_id="+requestID, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		depot.httpHandler.DepotHandler(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected upload to succeed, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	list := func(query string) (int, []services.ObjectInfo) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		depot.httpHandler.ListHandler(w, httptest.NewRequest("GET", "/list?"+query, nil))
+		var response struct {
+			Objects []services.ObjectInfo `json:"objects"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Objects
+	}
+
+	upload("invoice-1", "application/json", `{"total":1}`)
+	upload("invoice-2", "text/plain; charset=utf-8", "total 2")
+	upload("receipt-1", "application/json", `{"total":3}`)
+
+	// An object written past the depot, and so missing from the index
+	storage.SavePayload("1700000000_4f2a9c1e0b7d3a65_scan.png", []byte{0x89, 'P', 'N', 'G'}, "image/png", nil)
+
+	if _, objects := list("prefix=invoice-"); len(objects) != 2 {
+		t.Errorf("Expected 2 invoices, got %v", objects)
+	}
+	if _, objects := list("content_type=application/json"); len(objects) != 2 {
+		t.Errorf("Expected 2 JSON payloads, got %v", objects)
+	}
+	if _, objects := list("prefix=invoice-&content_type=TEXT/PLAIN"); len(objects) != 1 || !strings.HasPrefix(objects[0].ObjectName, "invoice-2_") {
+		t.Errorf("Expected the text invoice, matched ignoring case and parameters, got %v", objects)
+	}
+	if _, objects := list("content_type=image/*"); len(objects) != 1 || objects[0].ObjectName != "1700000000_4f2a9c1e0b7d3a65_scan.png" {
+		t.Errorf("Expected the unindexed image matched from its stored content type, got %v", objects)
+	}
+
+	hourAgo := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	if _, objects := list("after=" + hourAgo); len(objects) != 4 {
+		t.Errorf("Expected every object written in the last hour, got %v", objects)
+	}
+	if _, objects := list("before=" + hourAgo); len(objects) != 0 {
+		t.Errorf("Expected nothing written before an hour ago, got %v", objects)
+	}
+	if _, objects := list("prefix=nothing"); objects == nil || len(objects) != 0 {
+		t.Errorf("Expected an empty listing, got %v", objects)
+	}
+	if code, _ := list("after=yesterday"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid timestamp, got %d", code)
+	}
+	if _, objects := list(""); len(objects) != 4 {
+		t.Errorf("Expected the unfiltered listing unchanged, got %v", objects)
+	}
+}
+
+func TestListHandler_ListsObjectDetails(t *testing.T) {
+	storage, _ := services.NewMemoryStorageService(0)
+	depot := newTestDepot(storage)
+	depot.httpHandler.SetSyncStore(true)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/depot?request_id=invoice-1", strings.NewReader(`{"total":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	depot.httpHandler.DepotHandler(w, req)
+
+	w = httptest.NewRecorder()
+	depot.httpHandler.ListHandler(w, httptest.NewRequest("GET", "/list", nil))
+	var listing struct {
+		Objects []map[string]any `json:"objects"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &listing)
+	if len(listing.Objects) != 1 {
+		t.Fatalf("Expected one listed object, got %s", w.Body.String())
+	}
+	entry := listing.Objects[0]
+	if entry["size"] != float64(11) || entry["content_type"] != "application/json" {
+		t.Errorf("Expected the size and content type listed, got %v", entry)
+	}
+	if modified, err := time.Parse(time.RFC3339, entry["last_modified"].(string)); err != nil || time.Since(modified) > time.Minute {
+		t.Errorf("Expected the time the object was written, got %v", entry["last_modified"])
+	}
+
+	// Storage that only lists names: details come from the index, else the object
+	mock := NewMockStorageService()
+	depot = newTestDepot(mock)
+	depot.httpHandler.SetSyncStore(true)
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/depot?request_id=receipt-1", strings.NewReader("paid"))
+	req.Header.Set("Content-Type", "text/plain")
+	depot.httpHandler.DepotHandler(w, req)
+	mock.SavePayload("1700000000_4f2a9c1e0b7d3a65_scan.png", []byte{0x89, 'P', 'N', 'G', '\r', '\n'}, "image/png", nil)
+
+	list := func(query string) []services.ObjectInfo {
+		w := httptest.NewRecorder()
+		depot.httpHandler.ListHandler(w, httptest.NewRequest("GET", "/list?"+query, nil))
+		var response struct {
+			Objects []services.ObjectInfo `json:"objects"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response.Objects
+	}
+	objects := list("prefix=receipt-")
+	if len(objects) != 1 || objects[0].Size != 4 || objects[0].ContentType != "text/plain" || objects[0].LastModified.IsZero() {
+		t.Errorf("Expected the indexed details listed, got %+v", objects)
+	}
+	objects = list("prefix=1700000000_")
+	if len(objects) != 1 || objects[0].Size != 6 || objects[0].ContentType != "image/png" || !objects[0].LastModified.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Expected the details read from the unindexed object, got %+v", objects)
+	}
+	if objects := list("after=2023-11-14T00:00:00Z&before=2023-11-15T00:00:00Z"); len(objects) != 1 {
+		t.Errorf("Expected the scan in its day's range, got %v", objects)
+	}
+}
+
+// readCountingMemory counts the objects read from memory storage
+type readCountingMemory struct {
+	*services.MemoryStorageService
+	reads atomic.Int32
+}
+
+func (r *readCountingMemory) GetPayload(objectName string) ([]byte, error) {
+	r.reads.Add(1)
+	return r.MemoryStorageService.GetPayload(objectName)
+}
+
+func TestStorageWrappers_ListAndStatLogicalSizes(t *testing.T) {
+	memory, _ := services.NewMemoryStorageService(0)
+	base := &readCountingMemory{MemoryStorageService: memory}
+	// Stacked as main stacks them: encryption, chunking, deduplication, compression
+	var storage services.StorageService = services.NewEncryptedStorage(base, newTestKeyring(t, "k1", "k1"))
+	storage = services.NewChunkedStorage(storage, 256)
+	storage = services.NewDedupStorage(storage)
+	storage, err := services.NewCompressedStorage(storage, services.CompressionGzip, 64, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payloads := map[string][]byte{
+		"001_small.json": []byte(`{"ok":true}`),
+		"002_text.json":  []byte(strings.Repeat(`{"event":"order.created"},`, 40)),
+		"003_copy.json":  []byte(strings.Repeat(`{"event":"order.created"},`, 40)),
+		"004_scan.png":   []byte(strings.Repeat("\x89PNG", 200)),
+	}
+	for objectName, data := range payloads {
+		contentType := "application/json"
+		if strings.HasSuffix(objectName, ".png") {
+			contentType = "image/png"
+		}
+		if err := storage.SavePayload(objectName, data, contentType, nil); err != nil {
+			t.Fatalf("SavePayload %s failed: %v", objectName, err)
+		}
+	}
+
+	base.reads.Store(0)
+	infos, err := storage.(services.ObjectLister).ListPayloadInfo()
+	if err != nil {
+		t.Fatalf("ListPayloadInfo failed: %v", err)
+	}
+	if len(infos) != len(payloads) {
+		t.Fatalf("Expected only the stored objects listed, got %+v", infos)
+	}
+	for _, info := range infos {
+		if want := len(payloads[info.ObjectName]); info.Size != int64(want) {
+			t.Errorf("Expected %s listed with its %d bytes, got %d", info.ObjectName, want, info.Size)
+		}
+	}
+	if reads := base.reads.Load(); reads != 0 {
+		t.Errorf("Expected a listing without reading objects, got %d reads", reads)
+	}
+
+	for objectName, data := range payloads {
+		stat, err := storage.(services.PayloadStatter).StatPayload(objectName)
+		if err != nil || stat.Size != int64(len(data)) {
+			t.Errorf("Expected %s statted with its %d bytes, got %+v (%v)", objectName, len(data), stat, err)
+			continue
+		}
+		for _, key := range []string{services.MetadataUncompressedSize, services.MetadataDedupBlob, services.MetadataChunkCount, services.MetadataEncryptionKeyID} {
+			if _, ok := stat.Metadata[key]; ok {
+				t.Errorf("Expected the wrappers' %s metadata hidden from the stat of %s", key, objectName)
+			}
+		}
+	}
+}
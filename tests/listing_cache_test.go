@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// countingStorage counts how often the bucket is walked
+type countingStorage struct {
+	*MockStorageService
+	lists atomic.Int32
+}
+
+func (c *countingStorage) ListPayloads() ([]string, error) {
+	c.lists.Add(1)
+	return c.MockStorageService.ListPayloads()
+}
+
+func TestListingCache_ServesRepeatedListings(t *testing.T) {
+	inner := &countingStorage{MockStorageService: NewMockStorageService()}
+	inner.MockStorageService.SavePayload("001_payload.json", []byte("{}"), "application/json", nil)
+	cache := services.NewListingCache(inner, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache.ListPayloads()
+		}()
+	}
+	wg.Wait()
+	if objects, _ := cache.ListPayloads(); len(objects) != 1 {
+		t.Fatalf("Expected 1 cached object, got %v", objects)
+	}
+	if got := inner.lists.Load(); got != 1 {
+		t.Errorf("Expected concurrent listings to walk the bucket once, got %d", got)
+	}
+
+	matched, _ := cache.ListRequestPayloads("001")
+	cache.ListRequestPayloads("001")
+	if len(matched) != 1 || inner.lists.Load() != 1 {
+		t.Errorf("Expected per-request listings to come from the cache, got %v after %d walks", matched, inner.lists.Load())
+	}
+
+	cache.SavePayload("002_payload.json", []byte("{}"), "application/json", nil)
+	if objects, _ := cache.ListPayloads(); len(objects) != 2 {
+		t.Errorf("Expected a write through the cache to invalidate it, got %v", objects)
+	}
+
+	// Writes that bypass the cache are picked up from store events
+	inner.MockStorageService.SavePayload("003_payload.json", []byte("{}"), "application/json", nil)
+	cache.PayloadStored(services.ObjectRecord{ObjectName: "003_payload.json"})
+	if matched, _ := cache.ListRequestPayloads("003"); len(matched) != 1 {
+		t.Errorf("Expected a store event to invalidate the cache, got %v", matched)
+	}
+
+	cache.DeletePayload("001_payload.json")
+	if matched, _ := cache.ListRequestPayloads("001"); len(matched) != 0 {
+		t.Errorf("Expected a delete to invalidate the cache, got %v", matched)
+	}
+}
+
+func TestListingCache_ExpiresAfterTTL(t *testing.T) {
+	inner := &countingStorage{MockStorageService: NewMockStorageService()}
+	cache := services.NewListingCache(inner, 20*time.Millisecond)
+
+	cache.ListPayloads()
+	cache.ListPayloads()
+	time.Sleep(30 * time.Millisecond)
+	cache.ListPayloads()
+	if got := inner.lists.Load(); got != 2 {
+		t.Errorf("Expected an empty listing to be cached until the TTL expires, got %d walks", got)
+	}
+}
+
+func TestListingCache_GetUsesCachedGrouping(t *testing.T) {
+	inner := &countingStorage{MockStorageService: NewMockStorageService()}
+	cache := services.NewListingCache(inner, time.Minute)
+	depot := newTestDepot(cache)
+	depot.payloadService.AddObserver(cache)
+	inner.MockStorageService.SavePayload("order-1_payload.txt", []byte("hi"), "text/plain", nil)
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		depot.httpHandler.GetHandler(w, httptest.NewRequest("GET", "/get?request_id=order-1", nil))
+		if w.Code != 200 {
+			t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	if got := inner.lists.Load(); got != 1 {
+		t.Errorf("Expected repeated /get calls to walk the bucket once, got %d", got)
+	}
+}
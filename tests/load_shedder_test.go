@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+)
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// serve calls handler and returns the response status
+func serve(handler http.HandlerFunc, target string) int {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", target, nil))
+	return w.Code
+}
+
+func TestLoadShedder_ShedsByPriorityUnderInFlightLoad(t *testing.T) {
+	shedder := handlers.NewLoadShedder(4, 0, map[string]int{
+		"/list":  handlers.PriorityLow,
+		"/depot": handlers.PriorityCritical,
+	})
+
+	release := make(chan struct{})
+	var started, done sync.WaitGroup
+	blocking := shedder.Wrap("/depot", func(w http.ResponseWriter, r *http.Request) {
+		started.Done()
+		<-release
+	})
+	hold := func(n int) {
+		for i := 0; i < n; i++ {
+			started.Add(1)
+			done.Add(1)
+			go func() {
+				defer done.Done()
+				serve(blocking, "/depot")
+			}()
+		}
+		started.Wait()
+	}
+
+	list := shedder.Wrap("/list", okHandler)
+	get := shedder.Wrap("/get", okHandler)
+	depot := shedder.Wrap("/depot", okHandler)
+
+	hold(3)
+	if code := serve(list, "/list"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /list to be shed at 75%% load, got %d", code)
+	}
+	if code := serve(get, "/get"); code != http.StatusOK {
+		t.Errorf("Expected a normal-priority route to pass at 75%% load, got %d", code)
+	}
+
+	hold(1)
+	if code := serve(get, "/get"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected a normal-priority route to be shed at capacity, got %d", code)
+	}
+	if code := serve(depot, "/depot"); code != http.StatusOK {
+		t.Errorf("Expected a critical route never to be shed, got %d", code)
+	}
+	if shedder.Shed() != 2 {
+		t.Errorf("Expected 2 shed requests, got %d", shedder.Shed())
+	}
+
+	close(release)
+	done.Wait()
+	if code := serve(list, "/list"); code != http.StatusOK {
+		t.Errorf("Expected /list to recover once load drops, got %d", code)
+	}
+}
+
+func TestLoadShedder_ShedsOnLatencyAndRecovers(t *testing.T) {
+	shedder := handlers.NewLoadShedder(0, 5*time.Millisecond, handlers.DefaultRoutePriorities)
+
+	slow := shedder.Wrap("/get", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+	})
+	for i := 0; i < 3; i++ {
+		serve(slow, "/get")
+	}
+
+	list := shedder.Wrap("/list", okHandler)
+	w := httptest.NewRecorder()
+	list(w, httptest.NewRequest("GET", "/list", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected /list to be shed with Retry-After under high latency, got %d", w.Code)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for shedder.Load() >= handlers.LowPriorityShedLoad && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if code := serve(list, "/list"); code != http.StatusOK {
+		t.Errorf("Expected /list to be admitted once latency decays, got %d", code)
+	}
+}
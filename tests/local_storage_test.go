@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/config"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestLocalStorageService_StoresUnderRoot(t *testing.T) {
+	root := t.TempDir()
+	storage, err := services.NewStorageBackend(&config.Config{StorageBackend: "local", LocalRoot: root})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := storage.SavePayload("req1_a.json", []byte(`{"a":1}`), "application/json", map[string]string{"tags": "x"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := storage.(services.StreamSaver).SavePayloadStream("req1/b.txt", strings.NewReader("streamed"), -1, "", nil, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "req1", "b.txt")); err != nil {
+		t.Errorf("Expected the payload on disk: %v", err)
+	}
+
+	objects, err := storage.ListPayloads()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(objects, []string{"req1/b.txt", "req1_a.json"}) {
+		t.Errorf("Expected both payloads listed without sidecars, got %v", objects)
+	}
+
+	data, err := storage.GetPayload("req1/b.txt")
+	if err != nil || string(data) != "streamed" {
+		t.Errorf("Expected the streamed payload back, got %q, %v", data, err)
+	}
+	contentType, metadata, err := storage.(services.MetadataReader).GetPayloadMetadata("req1_a.json")
+	if err != nil || contentType != "application/json" || metadata["tags"] != "x" {
+		t.Errorf("Expected metadata back, got %q %v %v", contentType, metadata, err)
+	}
+
+	if err := storage.DeletePayload("req1_a.json"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := storage.GetPayload("req1_a.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected a deleted payload to be gone, got %v", err)
+	}
+	if err := storage.DeletePayload("req1_a.json"); err != nil {
+		t.Errorf("Expected deleting a missing payload to succeed, got %v", err)
+	}
+}
+
+func TestLocalStorageService_RejectsEscapingNames(t *testing.T) {
+	storage, err := services.NewLocalStorageService(t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, name := range []string{"../escape.txt", "/etc/passwd", "a/../../b", "a//b", ".depot-meta/x", ""} {
+		if err := storage.SavePayload(name, []byte("x"), "", nil); err == nil {
+			t.Errorf("Expected %q to be rejected", name)
+		}
+	}
+}
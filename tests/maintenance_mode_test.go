@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestMaintenanceMode_RefusesWritesButServesReads(t *testing.T) {
+	mockService := NewMockStorageService()
+	mockService.payloads["kept_a.txt"] = []byte("a")
+	depot := newTestDepot(mockService)
+	mode := services.NewMaintenanceMode(false, "")
+	depot.payloadService.SetMaintenanceMode(mode)
+	maintenance := handlers.NewMaintenanceHandler(mode)
+	admin := maintenance.Wrap(handlers.MaintenanceRoute, maintenance.MaintenanceHandler)
+	post := maintenance.Wrap("/depot", depot.httpHandler.DepotHandler)
+	list := maintenance.Wrap("/list", depot.httpHandler.ListHandler)
+
+	w := httptest.NewRecorder()
+	admin(w, httptest.NewRequest("PUT", handlers.MaintenanceRoute, strings.NewReader("Moving buckets")))
+	var status services.MaintenanceStatus
+	json.NewDecoder(w.Body).Decode(&status)
+	if !status.ReadOnly || status.Message != "Moving buckets" || status.Since == nil {
+		t.Fatalf("Expected read-only mode with its message, got %+v", status)
+	}
+
+	w = httptest.NewRecorder()
+	post(w, httptest.NewRequest("POST", "/depot", strings.NewReader(`{"a":1}`)))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "Moving buckets") {
+		t.Errorf("Expected uploads refused with the message, got %d %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	list(w, httptest.NewRequest("GET", "/list", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected listings served, got %d", w.Code)
+	}
+
+	// Without the middleware, the payload service itself refuses new payloads
+	w = httptest.NewRecorder()
+	depot.httpHandler.DepotHandler(w, httptest.NewRequest("POST", "/depot", strings.NewReader(`{"a":1}`)))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the service to refuse the upload, got %d", w.Code)
+	}
+	if _, err := depot.payloadService.StorePayload([]byte("x"), "text/plain", "x.txt", services.StoreOptions{}); !errors.Is(err, services.ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	admin(w, httptest.NewRequest("DELETE", handlers.MaintenanceRoute, nil))
+	w = httptest.NewRecorder()
+	post(w, httptest.NewRequest("POST", "/depot", strings.NewReader(`{"a":1}`)))
+	if w.Code != http.StatusAccepted && w.Code != http.StatusOK {
+		t.Errorf("Expected uploads accepted after maintenance, got %d", w.Code)
+	}
+}
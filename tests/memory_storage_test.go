@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/config"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestMemoryStorageService_EvictsOldestBeyondCap(t *testing.T) {
+	storage, err := services.NewMemoryStorageService(10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := storage.SavePayload(name, []byte("1234"), "text/plain", map[string]string{"name": name}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	objects, _ := storage.ListPayloads()
+	if !reflect.DeepEqual(objects, []string{"b", "c"}) {
+		t.Errorf("Expected the oldest payload evicted, got %v", objects)
+	}
+	if storage.Size() != 8 {
+		t.Errorf("Expected 8 bytes held, got %d", storage.Size())
+	}
+
+	// Rewriting b makes c the oldest
+	if err := storage.SavePayload("b", []byte("12"), "", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := storage.SavePayload("d", []byte("12345"), "", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	objects, _ = storage.ListPayloads()
+	if !reflect.DeepEqual(objects, []string{"b", "d"}) {
+		t.Errorf("Expected c evicted before the rewritten b, got %v", objects)
+	}
+
+	if err := storage.SavePayload("huge", make([]byte, 11), "", nil); err == nil {
+		t.Error("Expected a payload over the cap to be refused")
+	}
+	contentType, _, err := storage.GetPayloadMetadata("b")
+	if err != nil || contentType != "application/octet-stream" {
+		t.Errorf("Expected the default content type, got %q, %v", contentType, err)
+	}
+}
+
+func TestMemoryStorageService_SelectedByRegistry(t *testing.T) {
+	storage, err := services.NewStorageBackend(&config.Config{StorageBackend: "memory"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := storage.(*services.MemoryStorageService); !ok {
+		t.Errorf("Expected a memory backend, got %T", storage)
+	}
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/config"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+	"github.com/minio/minio-go/v7"
+)
+
+// flakyS3 answers the first failures object requests with 503 SlowDown, then
+// succeeds; objects it was never sent are missing
+func flakyS3(failures int64) (*httptest.Server, *atomic.Int64) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("location") {
+			fmt.Fprint(w, `<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`)
+			return
+		}
+		if strings.Count(strings.Trim(r.URL.Path, "/"), "/") == 0 && r.Method == http.MethodHead {
+			return // the bucket exists
+		}
+		if requests.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `<Error><Code>SlowDown</Code><Message>Please reduce your request rate.</Message></Error>`)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+		}
+	}))
+	return server, &requests
+}
+
+func TestMinioService_RetriesTransientFailures(t *testing.T) {
+	// Leave the retrying to the depot's policy rather than minio-go's own
+	defer func(retries int) { minio.MaxRetry = retries }(minio.MaxRetry)
+	minio.MaxRetry = 1
+
+	server, requests := flakyS3(2)
+	defer server.Close()
+	cfg := &config.Config{
+		MinioEndpoint:            strings.TrimPrefix(server.URL, "http://"),
+		MinioBucket:              "depot-payloads",
+		MinioRetryMaxAttempts:    3,
+		MinioRetryInitialBackoff: time.Millisecond,
+		MinioRetryMaxBackoff:     time.Millisecond,
+	}
+	storage, err := services.NewMinioService(cfg)
+	if err != nil {
+		t.Fatalf("NewMinioService failed: %v", err)
+	}
+
+	if err := storage.SavePayload("req-1_payload.json", []byte("{}"), "application/json", nil); err != nil {
+		t.Fatalf("Expected the save to succeed on its third attempt, got %v", err)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("Expected 3 attempts, got %d", got)
+	}
+
+	// A missing object is not retried
+	if _, err := storage.GetPayload("missing.json"); err == nil {
+		t.Fatal("Expected reading a missing object to fail")
+	}
+	if got := requests.Load(); got != 4 {
+		t.Errorf("Expected a missing object read once, got %d", got-3)
+	}
+
+	// Failures outlasting the attempts are reported
+	requests.Store(-10)
+	if err := storage.SavePayload("req-2_payload.json", []byte("{}"), "application/json", nil); err == nil {
+		t.Error("Expected the save to fail once its attempts ran out")
+	}
+}
@@ -0,0 +1,40 @@
+package tests
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/config"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestMQTTSubscriber_StoresTaggedMessages(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	subscriber := services.NewMQTTSubscriber(depot.payloadService, services.NewDefaultContentTypeDetector())
+	depot.payloadService.AddObserver(subscriber)
+
+	result, err := subscriber.Receive("sensors/room-1/temperature", []byte(`{"celsius":21.5}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Receive returns once the message is saved, so it can be acknowledged
+	objectName := result.Objects[0].ObjectName
+	if data, err := mockService.GetPayload(objectName); err != nil || string(data) != `{"celsius":21.5}` {
+		t.Fatalf("Expected the message saved, got %q (%v)", data, err)
+	}
+	record, _ := depot.metadataIndex.Get(objectName)
+	if !slices.Equal(record.Tags, []string{"sensors/room-1/temperature"}) || record.ContentType != "application/json" {
+		t.Errorf("Expected a JSON payload tagged with the topic, got %v %s", record.Tags, record.ContentType)
+	}
+}
+
+func TestMQTTSubscriber_RejectsInvalidConfig(t *testing.T) {
+	subscriber := services.NewMQTTSubscriber(nil, nil)
+	if err := subscriber.Start(&config.Config{MQTTTopics: []string{"sensors/#"}}); err == nil {
+		t.Error("Expected an error without brokers")
+	}
+	if err := subscriber.Start(&config.Config{MQTTBrokers: []string{"tcp://localhost:1883"}, MQTTTopics: []string{"sensors/#"}, MQTTQoS: 3}); err == nil {
+		t.Error("Expected an error for QoS 3")
+	}
+}
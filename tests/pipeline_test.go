@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestParsePipeline(t *testing.T) {
+	stages, err := services.ParsePipeline([]string{"Sniff", " validate "})
+	if err != nil || !slices.Equal(stages, []string{services.StageSniff, services.StageValidate}) {
+		t.Errorf("Expected sniff,validate, got %v (%v)", stages, err)
+	}
+	if stages, err := services.ParsePipeline([]string{"none"}); err != nil || len(stages) != 0 {
+		t.Errorf("Expected none to disable every stage, got %v (%v)", stages, err)
+	}
+	if _, err := services.ParsePipeline([]string{"extract", "compress"}); !errors.Is(err, services.ErrUnknownStage) {
+		t.Errorf("Expected ErrUnknownStage, got %v", err)
+	}
+	if _, err := services.ParsePipeline([]string{"validate", "validate"}); err == nil {
+		t.Error("Expected a repeated stage to be rejected")
+	}
+}
+
+func TestPipeline_SniffStage(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	depot.payloadService.SetContentSniffer(services.NewDefaultContentTypeDetector())
+
+	// Sniffing is off by default
+	if _, err := depot.payloadService.StorePayload([]byte(`{"a": 1}`), "application/octet-stream", "", services.StoreOptions{RequestID: "plain"}); err != nil {
+		t.Fatal(err)
+	}
+	waitForObject(t, mockService, "plain_payload.bin")
+
+	if err := depot.payloadService.SetPipeline([]string{"sniff"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := depot.payloadService.StorePayload([]byte(`{"a": 1}`), "application/octet-stream", "", services.StoreOptions{RequestID: "sniffed"}); err != nil {
+		t.Fatal(err)
+	}
+	waitForObject(t, mockService, "sniffed_payload.json")
+	if contentType := mockService.contentTypes["sniffed_payload.json"]; contentType != "application/json" {
+		t.Errorf("Expected the sniffed content type, got %s", contentType)
+	}
+
+	// A specific content type is never overridden
+	if _, err := depot.payloadService.StorePayload([]byte(`{"a": 1}`), "text/plain", "", services.StoreOptions{RequestID: "declared"}); err != nil {
+		t.Fatal(err)
+	}
+	waitForObject(t, mockService, "declared_payload.txt")
+}
+
+func TestPipeline_StageOrder(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	scripts, err := loadScripts(t, mockService, map[string]string{
+		"order.lua": `
+function validate(p)
+  if p.data ~= "TRANSFORMED" then return false, "saw " .. p.data end
+end
+function transform(p)
+  return { data = "TRANSFORMED" }
+end`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	depot.payloadService.SetPayloadScripter(scripts)
+
+	// By default validate sees the payload before it is transformed
+	if w := postWithID(depot, "default-order", "raw", false); w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "saw raw") {
+		t.Fatalf("Expected validate to run first, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if err := depot.payloadService.SetPipeline([]string{"transform", "validate"}); err != nil {
+		t.Fatal(err)
+	}
+	if w := postWithID(depot, "reordered", "raw", false); w.Code != http.StatusOK {
+		t.Fatalf("Expected validate to see the transformed payload, got %d: %s", w.Code, w.Body.String())
+	}
+	if data := waitForObject(t, mockService, "reordered_payload.json"); string(data) != "TRANSFORMED" {
+		t.Errorf("Expected the transformed payload, got %s", data)
+	}
+
+	// Without script stages the scripts are not run at all
+	if err := depot.payloadService.SetPipeline([]string{"none"}); err != nil {
+		t.Fatal(err)
+	}
+	if w := postWithID(depot, "unscripted", "raw", false); w.Code != http.StatusOK {
+		t.Fatalf("Expected the upload to bypass the scripts, got %d: %s", w.Code, w.Body.String())
+	}
+	if data := waitForObject(t, mockService, "unscripted_payload.json"); string(data) != "raw" {
+		t.Errorf("Expected the payload as uploaded, got %s", data)
+	}
+}
+
+func TestMiddlewareChain(t *testing.T) {
+	chain := handlers.NewMiddlewareChain()
+	if err := chain.SetOrder([]string{"shed", "bogus"}); err == nil {
+		t.Error("Expected an unknown middleware to be rejected")
+	}
+	if err := chain.SetOrder([]string{"shed", "shed"}); err == nil {
+		t.Error("Expected a repeated middleware to be rejected")
+	}
+
+	var calls []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+	}
+
+	// A stage in the order that was never registered is skipped
+	if active := chain.Active(); len(active) != 0 {
+		t.Errorf("Expected no active middleware, got %v", active)
+	}
+	chain.Wrap("/list", handler)(httptest.NewRecorder(), httptest.NewRequest("GET", "/list", nil))
+	if !slices.Equal(calls, []string{"handler"}) {
+		t.Errorf("Expected only the handler to run, got %v", calls)
+	}
+
+	calls = nil
+	chain.Register(handlers.MiddlewareShed, func(route string, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, "shed "+route)
+			next(w, r)
+		}
+	})
+	chain.Wrap("/list", handler)(httptest.NewRecorder(), httptest.NewRequest("GET", "/list", nil))
+	if !slices.Equal(calls, []string{"shed /list", "handler"}) {
+		t.Errorf("Expected the shed stage to wrap the handler, got %v", calls)
+	}
+
+	calls = nil
+	if err := chain.SetOrder([]string{"none"}); err != nil {
+		t.Fatal(err)
+	}
+	chain.Wrap("/list", handler)(httptest.NewRecorder(), httptest.NewRequest("GET", "/list", nil))
+	if !slices.Equal(calls, []string{"handler"}) {
+		t.Errorf("Expected none to disable the chain, got %v", calls)
+	}
+}
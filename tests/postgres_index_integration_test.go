@@ -0,0 +1,86 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// Integration tests that require a real Postgres instance
+// Run with: DEPOT_POSTGRES_URL=postgres://... go test -tags=integration ./...
+
+func TestPostgresMetadataIndex_Integration(t *testing.T) {
+	dsn := os.Getenv("DEPOT_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("Skipping integration test: DEPOT_POSTGRES_URL not set")
+	}
+
+	index, err := services.NewPostgresMetadataIndex(dsn)
+	if err != nil {
+		t.Fatalf("Failed to create Postgres index: %v", err)
+	}
+	defer index.Close()
+
+	// A second replica connecting to the same database must not re-apply migrations
+	replica, err := services.NewPostgresMetadataIndex(dsn)
+	if err != nil {
+		t.Fatalf("Failed to connect a second replica: %v", err)
+	}
+	defer replica.Close()
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	records := []services.ObjectRecord{
+		{RequestID: "it1", ObjectName: "it1_payload.json", ContentType: "application/json", Size: 10, SHA256: "aa", Tags: []string{"x", "y"}, StoredAt: now},
+		{RequestID: "it2", ObjectName: "it2_payload.json", ContentType: "application/json", Size: 5, SHA256: "aa", StoredAt: now.Add(time.Second)},
+	}
+	for _, record := range records {
+		index.PayloadStored(record)
+		defer index.PayloadDeleted(record)
+	}
+
+	got, ok := replica.Get("it1_payload.json")
+	if !ok || got.Size != 10 || len(got.Tags) != 2 || !got.StoredAt.Equal(now) {
+		t.Errorf("Expected the replica to see the first record, got %+v (%v)", got, ok)
+	}
+	if matches := replica.FindBySHA256("aa"); len(matches) != 2 || matches[0].ObjectName != "it1_payload.json" {
+		t.Errorf("Expected 2 checksum matches, oldest first, got %+v", matches)
+	}
+
+	records[0].StorageTier = services.StorageTierArchive
+	index.PayloadStored(records[0])
+	if got, _ := replica.Get("it1_payload.json"); got.StorageTier != services.StorageTierArchive {
+		t.Errorf("Expected the upsert to update the storage tier, got %+v", got)
+	}
+
+	index.PayloadDeleted(records[1])
+	if _, ok := replica.Get("it2_payload.json"); ok {
+		t.Error("Expected the deleted record to be gone")
+	}
+
+	requestID := "it-log-" + now.Format("150405.000")
+	index.RequestAccepted(services.RequestRecord{
+		RequestID:  requestID,
+		ReceivedAt: now,
+		Source:     "/depot",
+		SourceIP:   "192.0.2.1",
+		Headers:    map[string]string{"content-type": "text/csv"},
+		Objects: []services.RequestObject{{
+			StoredObject: services.StoredObject{ObjectName: requestID + "_report.csv", OriginalFilename: "report.csv", ContentType: "text/csv"},
+			State:        services.StoreStatePending,
+		}},
+	})
+	index.ObjectSaved(requestID, services.StoredObject{ObjectName: requestID + "_report.csv", Size: 8, SHA256: "bb"}, nil)
+	logged, ok := replica.GetRequest(requestID)
+	if !ok || logged.State != services.StoreStateStored || logged.SourceIP != "192.0.2.1" || len(logged.Objects) != 1 ||
+		logged.Objects[0].OriginalFilename != "report.csv" || logged.Objects[0].Size != 8 || !logged.ReceivedAt.Equal(now) {
+		t.Errorf("Expected the replica to see the logged request, got %+v (%v)", logged, ok)
+	}
+	if listed := replica.ListRequests("it-log-", 1); len(listed) != 1 {
+		t.Errorf("Expected the logged request listed by prefix, got %+v", listed)
+	}
+}
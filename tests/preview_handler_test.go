@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type previewResponse struct {
+	Format  string `json:"format"`
+	Preview struct {
+		Size      int    `json:"size"`
+		Offset    int    `json:"offset"`
+		Truncated bool   `json:"truncated"`
+		Text      string `json:"text"`
+		Rows      []struct {
+			Offset int    `json:"offset"`
+			Hex    string `json:"hex"`
+			ASCII  string `json:"ascii"`
+		} `json:"rows"`
+	} `json:"preview"`
+}
+
+func getPreview(t *testing.T, depot *testDepot, query string) previewResponse {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/preview"+query, nil)
+	w := httptest.NewRecorder()
+	depot.previewHandler.PreviewHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d", w.Code)
+	}
+	var response previewResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	return response
+}
+
+func TestPreviewHandler_HexdumpForBinary(t *testing.T) {
+	mockService := NewMockStorageService()
+	mockService.payloads["1_frame.bin"] = append([]byte("HDR:"), 0x00, 0x01, 0xfe, 0xff, 'o', 'k', 0x0a, 'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H', 'I')
+	depot := newTestDepot(mockService)
+
+	response := getPreview(t, depot, "?object=1_frame.bin")
+	if response.Format != "hex" {
+		t.Fatalf("Expected auto format to choose hex for binary, got %s", response.Format)
+	}
+	if len(response.Preview.Rows) != 2 {
+		t.Fatalf("Expected 2 hexdump rows, got %d", len(response.Preview.Rows))
+	}
+	first := response.Preview.Rows[0]
+	if first.Hex != "48 44 52 3a 00 01 fe ff  6f 6b 0a 41 42 43 44 45" || first.ASCII != "HDR:....ok.ABCDE" {
+		t.Errorf("Unexpected first row %+v", first)
+	}
+	if response.Preview.Rows[1].Offset != 16 {
+		t.Errorf("Expected second row at offset 16, got %d", response.Preview.Rows[1].Offset)
+	}
+	if !strings.HasPrefix(response.Preview.Text, "00000000  48 44 52 3a") {
+		t.Errorf("Unexpected hexdump text %q", response.Preview.Text)
+	}
+}
+
+func TestPreviewHandler_HexdumpWindow(t *testing.T) {
+	mockService := NewMockStorageService()
+	mockService.payloads["1_data.txt"] = []byte("0123456789abcdefghij")
+	depot := newTestDepot(mockService)
+
+	response := getPreview(t, depot, "?object=1_data.txt&format=hex&offset=10&length=4")
+	if response.Preview.Offset != 10 || !response.Preview.Truncated {
+		t.Errorf("Unexpected window %+v", response.Preview)
+	}
+	if len(response.Preview.Rows) != 1 || response.Preview.Rows[0].ASCII != "abcd" {
+		t.Errorf("Unexpected rows %+v", response.Preview.Rows)
+	}
+}
+
+func TestPreviewHandler_TextAndErrors(t *testing.T) {
+	mockService := NewMockStorageService()
+	mockService.payloads["1_note.txt"] = []byte("plain text body")
+	depot := newTestDepot(mockService)
+
+	response := getPreview(t, depot, "?object=1_note.txt&length=5")
+	if response.Format != "text" || response.Preview.Text != "plain" || !response.Preview.Truncated {
+		t.Errorf("Unexpected text preview %+v", response)
+	}
+
+	for query, status := range map[string]int{
+		"":                             http.StatusBadRequest,
+		"?object=1_note.txt&format=xx": http.StatusBadRequest,
+		"?object=missing":              http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		depot.previewHandler.PreviewHandler(w, httptest.NewRequest("GET", "/preview"+query, nil))
+		if w.Code != status {
+			t.Errorf("Query %q: expected status %d, got %d", query, status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestQueryHandler_ExtractsField(t *testing.T) {
+	mockService := NewMockStorageService()
+	mockService.payloads["42_payload.json"] = []byte(`{"items": [{"id": "first"}, {"id": "second"}]}`)
+	mockService.payloads["42_notes.txt"] = []byte("not json")
+	mockService.payloads["43_payload.json"] = []byte(`{"items": [{"id": "other"}]}`)
+	depot := newTestDepot(mockService)
+
+	req := httptest.NewRequest("GET", "/query?request_id=42&expr="+url.QueryEscape(".items[0].id"), nil)
+	w := httptest.NewRecorder()
+	depot.queryHandler.QueryHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Results []struct {
+			ObjectName string `json:"object_name"`
+			Values     []any  `json:"values"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+
+	if len(response.Results) != 1 || response.Results[0].ObjectName != "42_payload.json" {
+		t.Fatalf("Expected a single JSON object result, got %+v", response.Results)
+	}
+	if len(response.Results[0].Values) != 1 || response.Results[0].Values[0] != "first" {
+		t.Errorf("Expected value \"first\", got %v", response.Results[0].Values)
+	}
+}
+
+func TestQueryHandler_Errors(t *testing.T) {
+	mockService := NewMockStorageService()
+	mockService.payloads["42_payload.json"] = []byte(`{"a": 1}`)
+	depot := newTestDepot(mockService)
+
+	cases := map[string]int{
+		"/query?request_id=42":                                    http.StatusBadRequest,
+		"/query?request_id=42&expr=" + url.QueryEscape(".a[["):    http.StatusBadRequest,
+		"/query?request_id=42&expr=" + url.QueryEscape(".a | .b"): http.StatusUnprocessableEntity,
+		"/query?request_id=99&expr=.":                             http.StatusNotFound,
+	}
+	for target, status := range cases {
+		w := httptest.NewRecorder()
+		depot.queryHandler.QueryHandler(w, httptest.NewRequest("GET", target, nil))
+		if w.Code != status {
+			t.Errorf("%s: expected status %d, got %d", target, status, w.Code)
+		}
+	}
+}
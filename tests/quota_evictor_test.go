@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// seedIndexedObject stores an object in the mock and records it in the index
+func seedIndexedObject(mock *MockStorageService, index services.MetadataIndex, name string, size int, age time.Duration, tags ...string) {
+	mock.payloads[name] = make([]byte, size)
+	index.PayloadStored(services.ObjectRecord{
+		RequestID:  name,
+		ObjectName: name,
+		Size:       size,
+		Tags:       tags,
+		StoredAt:   time.Now().Add(-age),
+	})
+}
+
+func TestQuotaEvictor_FIFO(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+
+	seedIndexedObject(mockService, depot.metadataIndex, "oldest", 40, 3*time.Hour)
+	seedIndexedObject(mockService, depot.metadataIndex, "middle", 40, 2*time.Hour)
+	seedIndexedObject(mockService, depot.metadataIndex, "newest", 40, time.Hour)
+
+	evictor := services.NewQuotaEvictor(depot.metadataIndex, depot.payloadService, 100, services.EvictionPolicyFIFO, nil)
+	if evicted := evictor.Evict(); evicted != 1 {
+		t.Fatalf("Expected 1 eviction, got %d", evicted)
+	}
+
+	if _, exists := mockService.payloads["oldest"]; exists {
+		t.Error("Expected oldest payload to be evicted")
+	}
+	if _, ok := depot.metadataIndex.Get("oldest"); ok {
+		t.Error("Expected oldest payload to be removed from the index")
+	}
+	if depot.metadataIndex.TotalSize() != 80 {
+		t.Errorf("Expected usage of 80 bytes, got %d", depot.metadataIndex.TotalSize())
+	}
+}
+
+func TestQuotaEvictor_TagPriority(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+
+	seedIndexedObject(mockService, depot.metadataIndex, "audit", 40, 3*time.Hour, "audit")
+	seedIndexedObject(mockService, depot.metadataIndex, "debug-old", 40, 2*time.Hour, "debug")
+	seedIndexedObject(mockService, depot.metadataIndex, "debug-new", 40, time.Hour, "debug")
+
+	priorities := map[string]int{"debug": 0, "audit": 10}
+	evictor := services.NewQuotaEvictor(depot.metadataIndex, depot.payloadService, 50, services.EvictionPolicyTagPriority, priorities)
+	if evicted := evictor.Evict(); evicted != 2 {
+		t.Fatalf("Expected 2 evictions, got %d", evicted)
+	}
+
+	if _, exists := mockService.payloads["audit"]; !exists {
+		t.Error("Expected high-priority audit payload to be kept")
+	}
+	if len(mockService.payloads) != 1 {
+		t.Errorf("Expected 1 remaining payload, got %d", len(mockService.payloads))
+	}
+}
+
+func TestQuotaEvictor_WithinQuota(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+
+	seedIndexedObject(mockService, depot.metadataIndex, "small", 10, time.Hour)
+
+	evictor := services.NewQuotaEvictor(depot.metadataIndex, depot.payloadService, 100, services.EvictionPolicyFIFO, nil)
+	if evicted := evictor.Evict(); evicted != 0 {
+		t.Errorf("Expected no evictions, got %d", evicted)
+	}
+}
+
+func TestQuotaEvictor_CountsObjectsSeededFromStorage(t *testing.T) {
+	mockService := NewMockStorageService()
+	// Payloads stored before a restart, with an empty in-memory index
+	for _, requestID := range []string{"1754732400_4f2a9c1e00000000", "1754736000_4f2a9c1e00000000"} {
+		mockService.SavePayload(requestID+"_payload.json", make([]byte, 60), "application/json", map[string]string{services.MetadataRequestID: requestID})
+	}
+	depot := newTestDepot(mockService)
+	evictor := services.NewQuotaEvictor(depot.metadataIndex, depot.payloadService, 100, services.EvictionPolicyFIFO, nil)
+	if evicted := evictor.Evict(); evicted != 0 {
+		t.Fatalf("Expected nothing to evict before seeding, got %d", evicted)
+	}
+
+	if _, err := services.NewIndexRebuilder(mockService, depot.metadataIndex).Rebuild(); err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+	if evicted := evictor.Evict(); evicted != 1 {
+		t.Fatalf("Expected 1 eviction after seeding, got %d", evicted)
+	}
+	if _, exists := mockService.Payload("1754732400_4f2a9c1e00000000_payload.json"); exists {
+		t.Error("Expected the oldest seeded payload to be evicted")
+	}
+}
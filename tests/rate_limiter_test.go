@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+)
+
+// limitedRequest sends a request from ip, with an API key if one is given
+func limitedRequest(handler http.HandlerFunc, ip, apiKey string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/depot", nil)
+	r.RemoteAddr = ip + ":40000"
+	if apiKey != "" {
+		r.Header.Set(handlers.DefaultAPIKeyHeader, apiKey)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestRateLimiter_RefusesClientsOverTheirBurst(t *testing.T) {
+	limiter := handlers.NewRateLimiter(0.5, 2, nil)
+	depot := limiter.Wrap("/depot", okHandler)
+
+	for i := 0; i < 2; i++ {
+		if w := limitedRequest(depot, "10.0.0.1", ""); w.Code != http.StatusOK {
+			t.Fatalf("Expected request %d within the burst to pass, got %d", i+1, w.Code)
+		}
+	}
+	w := limitedRequest(depot, "10.0.0.1", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 once the burst is spent, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Expected Retry-After: 2 at half a request per second, got %q", got)
+	}
+
+	// Other clients have buckets of their own
+	if w := limitedRequest(depot, "10.0.0.2", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected another IP to pass, got %d", w.Code)
+	}
+	// Unverified API keys cannot buy a fresh bucket
+	for _, key := range []string{"key-a", "key-b"} {
+		if w := limitedRequest(depot, "10.0.0.1", key); w.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected unverified key %s to share its IP's limit, got %d", key, w.Code)
+		}
+	}
+	if limiter.Limited() != 3 {
+		t.Errorf("Expected 3 limited requests, got %d", limiter.Limited())
+	}
+}
+
+func TestRateLimiter_ClientOverrides(t *testing.T) {
+	limiter := handlers.NewRateLimiter(0, 1, map[string]float64{
+		"ip:10.0.0.5": 0.1,
+		"ip:10.0.0.9": 0,
+	})
+	depot := limiter.Wrap("/depot", okHandler)
+
+	if w := limitedRequest(depot, "10.0.0.5", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected the first request to pass, got %d", w.Code)
+	}
+	if w := limitedRequest(depot, "10.0.0.5", ""); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the overridden client to be limited, got %d", w.Code)
+	}
+	for i := 0; i < 5; i++ {
+		if w := limitedRequest(depot, "10.0.0.9", ""); w.Code != http.StatusOK {
+			t.Fatalf("Expected a client without a rate to be unlimited, got %d", w.Code)
+		}
+		if w := limitedRequest(depot, "10.0.0.1", ""); w.Code != http.StatusOK {
+			t.Fatalf("Expected clients to be unlimited without a default rate, got %d", w.Code)
+		}
+	}
+}
+
+func TestRateLimiter_LimitsTenantsAcrossTheirKeys(t *testing.T) {
+	chain := handlers.NewMiddlewareChain()
+	chain.Register(handlers.MiddlewareTenant, handlers.NewTenantScope("", map[string]string{"key-1": "acme", "key-2": "acme"}, nil).Wrap)
+	chain.Register(handlers.MiddlewareRateLimit, handlers.NewRateLimiter(0.1, 1, nil).Wrap)
+	depot := chain.Wrap("/depot", okHandler)
+
+	if w := limitedRequest(depot, "10.0.0.1", "key-1"); w.Code != http.StatusOK {
+		t.Fatalf("Expected the tenant's first request to pass, got %d", w.Code)
+	}
+	if w := limitedRequest(depot, "10.0.0.2", "key-2"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the tenant's second key to share its limit, got %d", w.Code)
+	}
+}
+
+func TestRateLimiter_IgnoresTenantHeaders(t *testing.T) {
+	chain := handlers.NewMiddlewareChain()
+	chain.Register(handlers.MiddlewareTenant, handlers.NewTenantScope("X-Depot-Tenant", nil, nil).Wrap)
+	chain.Register(handlers.MiddlewareRateLimit, handlers.NewRateLimiter(0.1, 1, nil).Wrap)
+	depot := chain.Wrap("/depot", okHandler)
+
+	for i, tenant := range []string{"team-a", "team-b"} {
+		r := httptest.NewRequest("POST", "/depot", nil)
+		r.RemoteAddr = "10.0.0.1:40000"
+		r.Header.Set("X-Depot-Tenant", tenant)
+		w := httptest.NewRecorder()
+		depot(w, r)
+		if want := []int{http.StatusOK, http.StatusTooManyRequests}[i]; w.Code != want {
+			t.Errorf("Expected %d for tenant header %s, got %d", want, tenant, w.Code)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func newTestRedactor(t *testing.T) *services.Redactor {
+	t.Helper()
+	redactor, err := services.NewRedactor([]services.RedactionRule{
+		{Name: "customer", Fields: []string{"customer.phone", "cards.*.number"}},
+		{Name: "emails", Builtin: services.RedactEmail},
+		{Name: "cards", Builtin: services.RedactCardNumber, Replacement: "[CARD]"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return redactor
+}
+
+func TestRedactor_RedactsJSONFieldsAndPatterns(t *testing.T) {
+	redactor := newTestRedactor(t)
+	payload, fired := redactor.Redact(services.ProcessedPayload{Data: []byte(
+		`{"customer":{"phone":"+33 6 12 34 56 78","note":"mail ana@example.com"},"cards":[{"number":4242424242424242}],"amount":12.50,"order":"1234567890123"}`,
+	)})
+
+	redacted := string(payload.Data)
+	for _, leaked := range []string{"+33", "ana@example.com", "4242424242424242"} {
+		if strings.Contains(redacted, leaked) {
+			t.Errorf("Expected %s to be redacted, got %s", leaked, redacted)
+		}
+	}
+	// Numbers keep their precision, and digit runs failing the Luhn check are kept
+	if !strings.Contains(redacted, `"amount":12.50`) || !strings.Contains(redacted, "1234567890123") {
+		t.Errorf("Expected other values untouched, got %s", redacted)
+	}
+	if fired["customer"] != 2 || fired["emails"] != 1 || fired["cards"] != 0 {
+		t.Errorf("Expected the field rule twice and the email rule once, got %v", fired)
+	}
+	if payload.Metadata[services.MetadataRedactions] != "customer=2,emails=1" {
+		t.Errorf("Expected the fired rules recorded, got %q", payload.Metadata[services.MetadataRedactions])
+	}
+}
+
+func TestRedactor_LeavesCleanAndBinaryPayloadsAlone(t *testing.T) {
+	redactor := newTestRedactor(t)
+	clean := []byte(`{ "status": "ok" }`)
+	if payload, fired := redactor.Redact(services.ProcessedPayload{Data: clean}); string(payload.Data) != string(clean) || len(fired) != 0 {
+		t.Errorf("Expected a clean payload to keep its bytes, got %s", payload.Data)
+	}
+	binary := []byte{0x1f, 0x8b, 0xff, 'a', '@', 'b', '.', 'c', 'o'}
+	if payload, _ := redactor.Redact(services.ProcessedPayload{Data: binary}); string(payload.Data) != string(binary) {
+		t.Error("Expected a binary payload to be stored as it is")
+	}
+
+	text, fired := redactor.Redact(services.ProcessedPayload{Data: []byte("card 4111 1111 1111 1111, reply to ops@example.org")})
+	if string(text.Data) != "card [CARD], reply to [REDACTED]" || fired["cards"] != 1 {
+		t.Errorf("Expected text patterns redacted, got %q (%v)", text.Data, fired)
+	}
+}
+
+func TestDepot_RedactsBeforeStorage(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	depot.payloadService.SetRedactor(newTestRedactor(t))
+
+	result, err := depot.payloadService.StorePayload([]byte("{\"email\":\"a@b.io\"}\n{\"email\":\"c@d.io\"}\n"), "application/x-ndjson", "events.ndjson", services.StoreOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	objectName := result.Objects[0].ObjectName
+	stored := string(waitForObject(t, mockService, objectName))
+	if stored != "{\"email\":\"[REDACTED]\"}\n{\"email\":\"[REDACTED]\"}\n" {
+		t.Errorf("Expected every line redacted, got %q", stored)
+	}
+	if got := mockService.metadata[objectName][services.MetadataRedactions]; got != "emails=2" {
+		t.Errorf("Expected Redactions metadata, got %q", got)
+	}
+
+	// Appended chunks are redacted too, and their counts added up
+	if _, err := depot.payloadService.AppendPayload("log-1", []byte("from x@y.io\n"), "text/plain", "log.txt", services.StoreOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := depot.payloadService.AppendPayload("log-1", []byte("from z@y.io\n"), "text/plain", "log.txt", services.StoreOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if data, _ := mockService.GetPayload("log-1_log.txt"); string(data) != "from [REDACTED]\nfrom [REDACTED]\n" {
+		t.Errorf("Expected appended chunks redacted, got %q", data)
+	}
+	if got := mockService.metadata["log-1_log.txt"][services.MetadataRedactions]; got != "emails=2" {
+		t.Errorf("Expected appended redactions counted, got %q", got)
+	}
+}
+
+func TestNewRedactor_RejectsInvalidRules(t *testing.T) {
+	for name, rule := range map[string]services.RedactionRule{
+		"unnamed":         {Builtin: services.RedactEmail},
+		"nothing to do":   {Name: "empty"},
+		"unknown builtin": {Name: "x", Builtin: "passport"},
+		"bad pattern":     {Name: "x", Pattern: "("},
+	} {
+		if _, err := services.NewRedactor([]services.RedactionRule{rule}); err == nil {
+			t.Errorf("%s: expected the rule to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestDepotHandler_StoresRequestHeadersWithPayload(t *testing.T) {
+	storage, _ := services.NewMemoryStorageService(0)
+	depot := newTestDepot(storage)
+	depot.httpHandler.SetSyncStore(true)
+
+	upload := func(requestID string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/depot?request_id="+requestID+"&source=ci%2Fnightly", strings.NewReader(`{"a":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "GitHub-Hookshot/abc123")
+		req.Header.Set("X-GitHub-Event", "push")
+		req.Header.Add("X-Trace", "one")
+		req.Header.Add("X-Trace", "two")
+		req.Header.Set("X-Api-Key", "secret-key")
+		req.Header.Set("Authorization", "Bearer secret-token")
+		req.Header.Set("Accept", "*/*")
+		depot.httpHandler.DepotHandler(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected upload to succeed, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	get := func(requestID string) services.FileInfo {
+		t.Helper()
+		w := httptest.NewRecorder()
+		depot.httpHandler.GetHandler(w, httptest.NewRequest("GET", "/get?request_id="+requestID, nil))
+		var response struct {
+			Files []services.FileInfo `json:"files"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || len(response.Files) != 1 {
+			t.Fatalf("Expected one file from /get, got %d: %s", w.Code, w.Body.String())
+		}
+		return response.Files[0]
+	}
+
+	upload("hook-1")
+	file := get("hook-1")
+	if file.Headers.Get("User-Agent") != "GitHub-Hookshot/abc123" || file.Headers.Get("X-Github-Event") != "push" {
+		t.Errorf("Expected the User-Agent and X- headers returned, got %v", file.Headers)
+	}
+	if trace := file.Headers.Values("X-Trace"); len(trace) != 2 || trace[1] != "two" {
+		t.Errorf("Expected repeated headers kept in order, got %v", trace)
+	}
+	for _, name := range []string{"X-Api-Key", "Authorization", "Accept"} {
+		if file.Headers.Get(name) != "" {
+			t.Errorf("Expected %s not to be stored", name)
+		}
+	}
+	if file.Query != "request_id=hook-1&source=ci%2Fnightly" {
+		t.Errorf("Expected the query string returned, got %q", file.Query)
+	}
+
+	depot.payloadService.SetStoredHeaders([]string{"none"})
+	upload("hook-2")
+	if file := get("hook-2"); file.Headers != nil || file.Query != "" {
+		t.Errorf("Expected nothing stored with none, got %v %q", file.Headers, file.Query)
+	}
+
+	depot.payloadService.SetStoredHeaders([]string{"Accept", "X-Trace"})
+	upload("hook-3")
+	if file := get("hook-3"); len(file.Headers) != 2 || file.Headers.Get("Accept") != "*/*" {
+		t.Errorf("Expected only the configured headers stored, got %v", file.Headers)
+	}
+}
@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestSQLiteMetadataIndex_LogsRequests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "depot.db")
+	index, err := services.NewSQLiteMetadataIndex(path)
+	if err != nil {
+		t.Fatalf("Failed to open SQLite index: %v", err)
+	}
+	mock := NewMockStorageService()
+	depot := newTestDepot(mock)
+	depot.payloadService.AddObserver(index)
+	depot.payloadService.SetRequestLog(index)
+	depot.httpHandler.SetSyncStore(true)
+	requests := handlers.NewRequestsHandler(index)
+
+	upload := func(requestID string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/depot?request_id="+requestID, strings.NewReader("a,b\n1,2\n"))
+		req.Header.Set("Content-Type", "text/csv")
+		req.Header.Set("Content-Disposition", `attachment; filename="report.csv"`)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("X-Depot-Tags", "finance")
+		depot.httpHandler.DepotHandler(w, req)
+		return w.Code
+	}
+	lookup := func(target string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		requests.RequestsHandler(w, httptest.NewRequest("GET", target, nil))
+		var response map[string]any
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	if code := upload("report-1"); code != http.StatusOK {
+		t.Fatalf("Expected upload to succeed, got %d", code)
+	}
+	code, record := lookup("/requests?request_id=report-1")
+	if code != http.StatusOK {
+		t.Fatalf("Expected the request to be logged, got %d", code)
+	}
+	if record["state"] != services.StoreStateStored || record["source"] != "/depot" || record["source_ip"] != "192.0.2.1" || record["received_at"] == nil {
+		t.Errorf("Unexpected request record: %v", record)
+	}
+	headers := record["headers"].(map[string]any)
+	if headers["content-type"] != "text/csv" || headers["x-depot-tags"] != "finance" {
+		t.Errorf("Expected the request headers logged, got %v", headers)
+	}
+	if _, ok := headers["authorization"]; ok {
+		t.Error("Expected credentials left out of the logged headers")
+	}
+	objects := record["objects"].([]any)
+	if len(objects) != 1 {
+		t.Fatalf("Expected one logged object, got %v", objects)
+	}
+	object := objects[0].(map[string]any)
+	if object["original_filename"] != "report.csv" || object["content_type"] != "text/csv" || object["size"] != float64(8) || object["sha256"] == "" {
+		t.Errorf("Unexpected logged object: %v", object)
+	}
+
+	mock.SetSaveError(errors.New("bucket unavailable"))
+	upload("report-2")
+	if _, record := lookup("/requests?request_id=report-2"); record["state"] != services.StoreStateFailed ||
+		record["objects"].([]any)[0].(map[string]any)["error"] != "bucket unavailable" {
+		t.Errorf("Expected the failed save logged, got %v", record)
+	}
+	if code, _ := lookup("/requests?request_id=unknown"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unlogged request, got %d", code)
+	}
+
+	_, listing := lookup("/requests?prefix=report-&limit=1")
+	if listing["count"] != float64(1) || listing["requests"].([]any)[0].(map[string]any)["request_id"] != "report-2" {
+		t.Errorf("Expected the newest request listed first, got %v", listing)
+	}
+	if code, _ := lookup("/requests?limit=none"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid limit, got %d", code)
+	}
+
+	// Both the log and the object index survive a restart
+	index.Close()
+	reopened, err := services.NewSQLiteMetadataIndex(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen SQLite index: %v", err)
+	}
+	defer reopened.Close()
+	if logged := reopened.ListRequests("", 10); len(logged) != 2 {
+		t.Errorf("Expected 2 logged requests after reopening, got %d", len(logged))
+	}
+	records := reopened.List()
+	if len(records) != 1 || records[0].RequestID != "report-1" || records[0].OriginalFilename != "report.csv" || len(records[0].Tags) != 1 {
+		t.Fatalf("Expected the stored object indexed after reopening, got %+v", records)
+	}
+	if matches := reopened.FindBySHA256(records[0].SHA256); len(matches) != 1 || reopened.TotalSize() != 8 {
+		t.Errorf("Expected the object found by checksum and counted, got %v, %d", matches, reopened.TotalSize())
+	}
+	reopened.PayloadDeleted(records[0])
+	if _, ok := reopened.Get(records[0].ObjectName); ok {
+		t.Error("Expected the deleted object dropped from the index")
+	}
+}
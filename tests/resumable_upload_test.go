@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestResumableUploadHandler_ResumesAndCompletesSessions(t *testing.T) {
+	storage, _ := services.NewMemoryStorageService(0)
+	mock := NewMockStorageService()
+	// Memory storage streams sessions as they arrive; the mock has them buffered
+	for _, backend := range []services.StorageService{storage, mock} {
+		depot := newTestDepot(backend)
+		uploads := handlers.NewResumableUploadHandler(services.NewResumableUploads(depot.payloadService, time.Hour), services.NewDefaultFilenameExtractor(), services.NewDefaultResponseFormatter())
+		uploads.SetMaxBodySize(64)
+
+		call := func(method, target string, offset int, body string) *httptest.ResponseRecorder {
+			t.Helper()
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(method, target, strings.NewReader(body))
+			if offset >= 0 {
+				req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+			}
+			if target == "/uploads" {
+				uploads.CreateHandler(w, req)
+			} else {
+				uploads.SessionHandler(w, req)
+			}
+			return w
+		}
+		create := func(length string) string {
+			t.Helper()
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/uploads?request_id=backup-1", nil)
+			req.Header.Set("Content-Type", "text/plain")
+			req.Header.Set("Content-Disposition", `attachment; filename="backup.txt"`)
+			if length != "" {
+				req.Header.Set("Upload-Length", length)
+			}
+			uploads.CreateHandler(w, req)
+			var upload services.ResumableUpload
+			json.Unmarshal(w.Body.Bytes(), &upload)
+			if w.Code != http.StatusCreated || w.Header().Get("Location") != "/uploads/"+upload.ID {
+				t.Fatalf("Expected a session created, got %d: %s", w.Code, w.Body.String())
+			}
+			return "/uploads/" + upload.ID
+		}
+
+		session := create("10")
+		if w := call("PATCH", session, 0, "hello"); w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != "5" {
+			t.Fatalf("Expected the first chunk received, got %d: %s", w.Code, w.Body.String())
+		}
+		if w := call("PATCH", session, 3, "lo wo"); w.Code != http.StatusConflict || w.Header().Get("Upload-Offset") != "5" {
+			t.Errorf("Expected a chunk at the wrong offset refused with the current one, got %d %v", w.Code, w.Header())
+		}
+		if w := call("HEAD", session, -1, ""); w.Header().Get("Upload-Offset") != "5" || w.Header().Get("Upload-Length") != "10" {
+			t.Errorf("Expected the offset to resume from, got %v", w.Header())
+		}
+		if w := call("POST", session+"/complete", -1, ""); w.Code != http.StatusConflict {
+			t.Errorf("Expected an incomplete session refused, got %d", w.Code)
+		}
+		call("PUT", session, 5, "world")
+		w := call("POST", session+"/complete", -1, "")
+		var stored struct {
+			RequestID string                  `json:"request_id"`
+			Size      int                     `json:"size"`
+			Objects   []services.StoredObject `json:"objects"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &stored)
+		if w.Code != http.StatusOK || stored.RequestID != "backup-1" || stored.Size != 10 || len(stored.Objects) != 1 {
+			t.Fatalf("Expected the payload stored on completion, got %d: %s", w.Code, w.Body.String())
+		}
+		if data, err := backend.GetPayload(stored.Objects[0].ObjectName); err != nil || string(data) != "helloworld" {
+			t.Errorf("Expected the chunks stored in order, got %q, %v", data, err)
+		}
+		if w := call("GET", session, -1, ""); w.Code != http.StatusNotFound {
+			t.Errorf("Expected the session closed once completed, got %d", w.Code)
+		}
+
+		session = create("")
+		call("PATCH", session, 0, "partial")
+		if w := call("DELETE", session, -1, ""); w.Code != http.StatusNoContent {
+			t.Errorf("Expected the session aborted, got %d", w.Code)
+		}
+		if w := call("PATCH", session, 7, "more"); w.Code != http.StatusNotFound {
+			t.Errorf("Expected an aborted session gone, got %d", w.Code)
+		}
+
+		session = create("4")
+		if w := call("PATCH", session, 0, "too long"); w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected a chunk past the declared length refused, got %d", w.Code)
+		}
+		session = create("")
+		if w := call("PATCH", session, 0, strings.Repeat("x", 65)); w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected a session past the body size limit refused, got %d", w.Code)
+		}
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/uploads", nil)
+		req.Header.Set("Upload-Length", "65")
+		if uploads.CreateHandler(w, req); w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected a declared length past the limit refused, got %d", w.Code)
+		}
+
+		if objects, _ := backend.ListPayloads(); len(objects) != 1 {
+			t.Errorf("Expected only the completed upload stored, got %v", objects)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// retainingStorage records retention dates the way an object-locked bucket would
+type retainingStorage struct {
+	*MockStorageService
+	retainMu sync.Mutex
+	until    map[string]time.Time
+}
+
+func newRetainingStorage() *retainingStorage {
+	return &retainingStorage{MockStorageService: NewMockStorageService(), until: make(map[string]time.Time)}
+}
+
+func (r *retainingStorage) SetRetention(objectName string, until time.Time) error {
+	r.retainMu.Lock()
+	defer r.retainMu.Unlock()
+	r.until[objectName] = until
+	return nil
+}
+
+func (r *retainingStorage) Retention(objectName string) (time.Time, error) {
+	r.retainMu.Lock()
+	defer r.retainMu.Unlock()
+	return r.until[objectName], nil
+}
+
+// retention calls /admin/retention with the given method and query
+func retention(handler *handlers.RetentionHandler, method, query string) (int, []services.RetentionStatus) {
+	w := httptest.NewRecorder()
+	handler.RetentionHandler(w, httptest.NewRequest(method, "/admin/retention?"+query, nil))
+	var response struct {
+		Objects []services.RetentionStatus `json:"objects"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response.Objects
+}
+
+func TestRetention_ExtendsButNeverShortens(t *testing.T) {
+	storage := newRetainingStorage()
+	depot := newTestDepot(storage)
+	objectRetention := services.NewObjectRetention(storage, storage)
+	depot.payloadService.SetDeletionGuard(services.DeletionGuards{objectRetention})
+	handler := handlers.NewRetentionHandler(objectRetention)
+
+	seedIndexedObject(storage.MockStorageService, depot.metadataIndex, "incident-9_capture.pcap", 10, time.Hour)
+	record, _ := depot.metadataIndex.Get("incident-9_capture.pcap")
+
+	if _, objects := retention(handler, "GET", "request_id=incident-9"); len(objects) != 1 || objects[0].RetainUntil != nil {
+		t.Fatalf("Expected no retention before extending, got %+v", objects)
+	}
+
+	code, objects := retention(handler, "POST", "request_id=incident-9&extend=720h")
+	if code != http.StatusOK || len(objects) != 1 || objects[0].RetainUntil == nil {
+		t.Fatalf("Expected retention to be extended, got %d %+v", code, objects)
+	}
+	extended := *objects[0].RetainUntil
+	if time.Until(extended) < 719*time.Hour {
+		t.Errorf("Expected retention about 30 days out, got %s", extended)
+	}
+
+	if err := depot.payloadService.RemoveObject(record); !errors.Is(err, services.ErrRetained) {
+		t.Fatalf("Expected removal of a retained object to fail, got %v", err)
+	}
+
+	// A shorter retention is refused and leaves the current one in place
+	shorter := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	if code, objects := retention(handler, "POST", "request_id=incident-9&until="+shorter); code != http.StatusConflict || !objects[0].RetainUntil.Equal(extended) {
+		t.Errorf("Expected a shorter retention to be refused, got %d %+v", code, objects)
+	}
+	if until, _ := storage.Retention(record.ObjectName); !until.Equal(extended) {
+		t.Errorf("Expected the retention to stay at %s, got %s", extended, until)
+	}
+
+	longer := time.Now().Add(2000 * time.Hour).UTC().Format(time.RFC3339)
+	if code, _ := retention(handler, "POST", "request_id=incident-9&until="+longer); code != http.StatusOK {
+		t.Errorf("Expected a longer retention to be accepted, got %d", code)
+	}
+}
+
+func TestRetention_ExpiredRetentionAllowsRemoval(t *testing.T) {
+	storage := newRetainingStorage()
+	depot := newTestDepot(storage)
+	depot.payloadService.SetDeletionGuard(services.DeletionGuards{services.NewObjectRetention(storage, storage)})
+
+	seedIndexedObject(storage.MockStorageService, depot.metadataIndex, "old_capture.txt", 10, time.Hour)
+	storage.SetRetention("old_capture.txt", time.Now().Add(-time.Minute))
+	record, _ := depot.metadataIndex.Get("old_capture.txt")
+	if err := depot.payloadService.RemoveObject(record); err != nil {
+		t.Errorf("Expected an object past its retention to be removable, got %v", err)
+	}
+}
+
+func TestRetention_RejectsInvalidRequests(t *testing.T) {
+	storage := newRetainingStorage()
+	storage.MockStorageService.SavePayload("x_payload.txt", []byte("x"), "text/plain", nil)
+	handler := handlers.NewRetentionHandler(services.NewObjectRetention(storage, storage))
+
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	for _, query := range []string{
+		"request_id=x",
+		"request_id=x&until=tomorrow",
+		"request_id=x&until=" + past,
+		"request_id=x&extend=-1h",
+		"request_id=x&extend=1h&until=" + past,
+		"extend=1h",
+	} {
+		if code, _ := retention(handler, "POST", query); code != http.StatusBadRequest {
+			t.Errorf("%s: expected BadRequest, got %d", query, code)
+		}
+	}
+	if code, _ := retention(handler, "POST", "request_id=missing&extend=1h"); code != http.StatusNotFound {
+		t.Errorf("Expected an unknown request to return NotFound, got %d", code)
+	}
+	if code, _ := retention(handlers.NewRetentionHandler(nil), "GET", "request_id=x"); code != http.StatusNotImplemented {
+		t.Errorf("Expected NotImplemented without an object-locked bucket, got %d", code)
+	}
+}
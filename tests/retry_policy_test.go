@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestRetryPolicy_DelayCurves(t *testing.T) {
+	base := services.RetryPolicy{InitialBackoff: services.Duration(time.Second), MaxBackoff: services.Duration(5 * time.Second)}
+
+	cases := map[string][]time.Duration{
+		services.BackoffExponential: {time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second},
+		services.BackoffLinear:      {time.Second, 2 * time.Second, 3 * time.Second, 4 * time.Second},
+		services.BackoffConstant:    {time.Second, time.Second, time.Second, time.Second},
+	}
+	for backoff, expected := range cases {
+		policy := base
+		policy.Backoff = backoff
+		for i, want := range expected {
+			if got := policy.Delay(i + 1); got != want {
+				t.Errorf("%s attempt %d: expected %v, got %v", backoff, i+1, want, got)
+			}
+		}
+	}
+}
+
+func TestRetryPolicy_WithDefaults(t *testing.T) {
+	var policy services.RetryPolicy
+	if err := json.Unmarshal([]byte(`{"max_attempts": 2, "timeout": "250ms", "initial_backoff": 0.5}`), &policy); err != nil {
+		t.Fatalf("Failed to parse policy: %v", err)
+	}
+	policy, err := policy.WithDefaults()
+	if err != nil {
+		t.Fatalf("WithDefaults failed: %v", err)
+	}
+	if policy.MaxAttempts != 2 || time.Duration(policy.Timeout) != 250*time.Millisecond || time.Duration(policy.InitialBackoff) != 500*time.Millisecond {
+		t.Errorf("Expected configured values to be kept, got %+v", policy)
+	}
+	if policy.Backoff != services.BackoffExponential || policy.MaxBackoff != services.DefaultRetryPolicy.MaxBackoff {
+		t.Errorf("Expected unset values to use defaults, got %+v", policy)
+	}
+
+	if _, err := (services.RetryPolicy{Backoff: "fibonacci"}).WithDefaults(); err == nil {
+		t.Error("Expected an error for an unsupported backoff")
+	}
+}
+
+// fastPolicy retries quickly enough for tests
+func fastPolicy(attempts int) services.RetryPolicy {
+	policy, _ := services.RetryPolicy{
+		MaxAttempts:    attempts,
+		Backoff:        services.BackoffConstant,
+		InitialBackoff: services.Duration(time.Millisecond),
+		Timeout:        services.Duration(100 * time.Millisecond),
+	}.WithDefaults()
+	return policy
+}
+
+func TestRetryExecutor_RetriesUntilSuccess(t *testing.T) {
+	executor := services.NewRetryExecutor(fastPolicy(3))
+
+	calls := 0
+	var failures []int
+	err := executor.Do(func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return errors.New("flaky")
+		}
+		return nil
+	}, func(n int, err error) { failures = append(failures, n) })
+
+	if err != nil || calls != 3 || len(failures) != 2 {
+		t.Errorf("Expected success on the third attempt, got err=%v calls=%d failures=%v", err, calls, failures)
+	}
+
+	calls = 0
+	err = executor.Do(func(ctx context.Context) error {
+		calls++
+		return errors.New("down")
+	}, nil)
+	if err == nil || calls != 3 {
+		t.Errorf("Expected 3 failed attempts, got err=%v calls=%d", err, calls)
+	}
+}
+
+func TestRetryExecutor_TimeoutAndConcurrency(t *testing.T) {
+	policy := fastPolicy(1)
+	policy.Timeout = services.Duration(20 * time.Millisecond)
+	policy.Concurrency = 2
+	executor := services.NewRetryExecutor(policy)
+
+	err := executor.Attempt(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the attempt to time out, got %v", err)
+	}
+
+	var inFlight, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			executor.Attempt(func(ctx context.Context) error {
+				current := atomic.AddInt32(&inFlight, 1)
+				for {
+					old := atomic.LoadInt32(&peak)
+					if current <= old || atomic.CompareAndSwapInt32(&peak, old, current) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				atomic.AddInt32(&inFlight, -1)
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	if peak > 2 {
+		t.Errorf("Expected at most 2 concurrent attempts, got %d", peak)
+	}
+}
+
+func TestPayloadForwarder_UsesTargetRetryPolicy(t *testing.T) {
+	var hits int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	path := filepath.Join(t.TempDir(), "targets.json")
+	os.WriteFile(path, []byte(`[{"name": "flaky", "url": "`+receiver.URL+`", "forward": true,
+		"retry": {"max_attempts": 3, "backoff": "constant", "initial_backoff": "5ms"}}]`), 0o644)
+	targets, err := services.LoadForwardTargets(path)
+	if err != nil {
+		t.Fatalf("LoadForwardTargets failed: %v", err)
+	}
+
+	mockService := NewMockStorageService()
+	index := services.NewMemoryMetadataIndex()
+	seedJSONPayload(mockService, index, "001_payload.json", `{}`)
+	record, _ := index.Get("001_payload.json")
+	services.NewPayloadForwarder(mockService, index, targets, services.NewDeliveryLog(10)).PayloadStored(record)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&hits) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := atomic.LoadInt32(&hits); got != 3 {
+		t.Errorf("Expected 3 attempts under the target policy, got %d", got)
+	}
+}
@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestRoutingRules_FirstMatchWinsUnlessContinued(t *testing.T) {
+	rules := services.NewRoutingRules([]services.RoutingRule{
+		{Name: "large", Match: services.RouteMatch{MinSize: 100}, Tags: []string{"large"}, Continue: true},
+		{Name: "images", Match: services.RouteMatch{ContentType: "image/*"}, Tags: []string{"images"}, Prefix: "img"},
+		{Name: "catch-all", Tags: []string{"other"}, Prefix: "misc"},
+	})
+
+	decision := rules.Route(services.RouteInput{ContentType: "image/png; q=1", Size: 500})
+	if !slices.Equal(decision.Rules, []string{"large", "images"}) || !slices.Equal(decision.Tags, []string{"large", "images"}) || decision.Prefix != "img" {
+		t.Errorf("Expected large to continue into images, got %+v", decision)
+	}
+	decision = rules.Route(services.RouteInput{ContentType: "text/plain", Size: -1})
+	if !slices.Equal(decision.Rules, []string{"catch-all"}) || decision.Prefix != "misc" {
+		t.Errorf("Expected a streamed upload to skip the size rule, got %+v", decision)
+	}
+}
+
+func TestRoutingRules_AppliedToUploads(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	router := &recordingRouter{}
+	depot.payloadService.SetRouter(router)
+	depot.payloadService.SetRoutingRules(services.NewRoutingRules([]services.RoutingRule{{
+		Name: "acme-invoices",
+		Match: services.RouteMatch{
+			ContentType: "application/pdf",
+			Source:      "/depot",
+			Headers:     map[string]string{"x-tenant": "acme*"},
+		},
+		Tags:   []string{"invoices"},
+		Prefix: "inv",
+		TTL:    services.Duration(24 * time.Hour),
+		Notify: []string{"audit"},
+	}}))
+
+	headers := http.Header{}
+	headers.Set("X-Tenant", "acme-eu")
+	result, err := depot.payloadService.StorePayload([]byte("%PDF-1.7"), "application/pdf", "march.pdf", services.StoreOptions{
+		Tags:    []string{"billing"},
+		Source:  "/depot",
+		Headers: headers,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(result.RequestID, "inv-") {
+		t.Fatalf("Expected a request ID starting with the rule prefix, got %s", result.RequestID)
+	}
+	objectName := result.Objects[0].ObjectName
+	waitForObject(t, mockService, objectName)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(router.Routes()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if routes := router.Routes(); !slices.Equal(routes, []string{objectName + "->audit"}) {
+		t.Errorf("Expected the object sent to audit, got %v", routes)
+	}
+	record, ok := depot.metadataIndex.Get(objectName)
+	if !ok || !slices.Equal(record.Tags, []string{"billing", "invoices"}) {
+		t.Fatalf("Expected the rule's tag added to the upload's, got %v", record.Tags)
+	}
+	if record.ExpiresAt == nil || time.Until(*record.ExpiresAt) < 23*time.Hour {
+		t.Errorf("Expected the object to expire in a day, got %v", record.ExpiresAt)
+	}
+	if _, err := time.Parse(time.RFC3339, mockService.metadata[objectName][services.MetadataExpiresAt]); err != nil {
+		t.Errorf("Expected Expires-At metadata, got %v", mockService.metadata[objectName])
+	}
+
+	// Uploads from elsewhere or without the header are left alone
+	other, _ := depot.payloadService.StorePayload([]byte("%PDF-1.7"), "application/pdf", "march.pdf", services.StoreOptions{Source: "watch", Headers: headers})
+	if strings.HasPrefix(other.RequestID, "inv-") {
+		t.Errorf("Expected the rule to match only /depot uploads, got %s", other.RequestID)
+	}
+}
+
+func TestRetentionSweeper_RemovesExpiredObjects(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	depot.payloadService.SetRoutingRules(services.NewRoutingRules([]services.RoutingRule{{
+		Name:  "scratch",
+		Match: services.RouteMatch{Tags: []string{"scratch"}},
+		TTL:   services.Duration(time.Nanosecond),
+	}}))
+
+	expiring, _ := depot.payloadService.StorePayload([]byte("a"), "text/plain", "a.txt", services.StoreOptions{Tags: []string{"scratch"}})
+	kept, _ := depot.payloadService.StorePayload([]byte("b"), "text/plain", "b.txt", services.StoreOptions{})
+	waitForObject(t, mockService, expiring.Objects[0].ObjectName)
+	waitForObject(t, mockService, kept.Objects[0].ObjectName)
+	waitForFilename(t, depot.metadataIndex, "a.txt")
+	waitForFilename(t, depot.metadataIndex, "b.txt")
+
+	// Without a maximum age only expired objects are removed
+	if _, err := services.NewRetentionSweeper(depot.metadataIndex, depot.payloadService, 0).Sweep(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := depot.metadataIndex.Get(expiring.Objects[0].ObjectName); ok {
+		t.Error("Expected the expired object to be removed")
+	}
+	if _, ok := depot.metadataIndex.Get(kept.Objects[0].ObjectName); !ok {
+		t.Error("Expected the object without a TTL to be kept")
+	}
+}
+
+func TestLoadRoutingRules_RejectsInvalidRules(t *testing.T) {
+	for name, rules := range map[string]string{
+		"unnamed":     `[{"prefix": "x"}]`,
+		"bad prefix":  `[{"name": "r", "prefix": "a_b"}]`,
+		"bad pattern": `[{"name": "r", "match": {"content_type": "image/["}}]`,
+		"bad tag":     `[{"name": "r", "tags": ["a,b"]}]`,
+	} {
+		path := filepath.Join(t.TempDir(), "rules.json")
+		os.WriteFile(path, []byte(rules), 0o644)
+		if _, err := services.LoadRoutingRules(path); err == nil {
+			t.Errorf("%s: expected the rules to be rejected", name)
+		}
+	}
+}
+
+func TestRoutingRules_SamplesChattySources(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	rules := services.NewRoutingRules([]services.RoutingRule{
+		{Name: "noise", Match: services.RouteMatch{Source: "/webhooks/*"}, Drop: true},
+		{Name: "sensors", Match: services.RouteMatch{Source: "mqtt"}, Sample: &services.SamplePolicy{Interval: services.Duration(time.Hour), Per: "tags"}},
+	})
+	depot.payloadService.SetRoutingRules(rules)
+
+	// One message per topic is kept within the interval
+	for _, topic := range []string{"line-1", "line-1", "line-2", "line-1"} {
+		depot.payloadService.StorePayload([]byte("21.5"), "text/plain", "", services.StoreOptions{Tags: []string{topic}, Source: "mqtt"})
+	}
+	_, err := depot.payloadService.StorePayload([]byte("{}"), "application/json", "", services.StoreOptions{Source: "/webhooks/github"})
+	if !errors.Is(err, services.ErrPayloadDropped) {
+		t.Errorf("Expected the drop rule to discard the upload, got %v", err)
+	}
+	if dropped := rules.Dropped(); dropped["sensors"] != 2 || dropped["noise"] != 1 {
+		t.Errorf("Expected 2 sampled out and 1 dropped, got %v", dropped)
+	}
+
+	// Dropped uploads are accepted so their sender does not retry
+	depot.payloadService.SetRoutingRules(services.NewRoutingRules([]services.RoutingRule{{Name: "all", Drop: true}}))
+	w := httptest.NewRecorder()
+	depot.httpHandler.DepotHandler(w, httptest.NewRequest("POST", "/depot", strings.NewReader("x")))
+	if w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), `"dropped"`) {
+		t.Errorf("Expected 202 dropped, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestPayloadService_BoundsAsyncSaves(t *testing.T) {
+	storage := &gatedStorage{MockStorageService: NewMockStorageService(), gate: make(chan struct{})}
+	depot := newTestDepot(storage)
+	// One upload being saved and one queued fill the pool
+	depot.payloadService.SetSaveWorkers(1, 1, 0)
+
+	for i := range 2 {
+		if _, err := depot.payloadService.StorePayload([]byte("queued"), "text/plain", "", services.StoreOptions{}); err != nil {
+			t.Fatalf("Expected upload %d accepted, got %v", i, err)
+		}
+	}
+	if _, err := depot.payloadService.StorePayload([]byte("overflow"), "text/plain", "", services.StoreOptions{}); !errors.Is(err, services.ErrSaveQueueFull) {
+		t.Errorf("Expected an upload past the queue refused, got %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	depot.httpHandler.DepotHandler(w, httptest.NewRequest("POST", "/depot", strings.NewReader("overflow")))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 503 with Retry-After for a full queue, got %d %v", w.Code, w.Header())
+	}
+
+	// Waiting uploads take the room freed by a save
+	depot.payloadService.SetSaveWorkers(1, 0, time.Second)
+	if _, err := depot.payloadService.StorePayload([]byte("first"), "text/plain", "", services.StoreOptions{}); err != nil {
+		t.Fatalf("StorePayload failed: %v", err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(storage.gate)
+	}()
+	if _, err := depot.payloadService.StorePayload([]byte("waited"), "text/plain", "", services.StoreOptions{}); err != nil {
+		t.Errorf("Expected an upload to wait for room in the queue, got %v", err)
+	}
+
+	depot.payloadService.Drain(context.Background())
+	if objects, _ := storage.ListPayloads(); len(objects) != 4 {
+		t.Errorf("Expected every accepted upload saved, got %v", objects)
+	}
+}
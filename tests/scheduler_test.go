@@ -0,0 +1,280 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestCronSchedule_Next(t *testing.T) {
+	from := time.Date(2026, time.March, 6, 10, 17, 30, 0, time.UTC) // a Friday
+	tests := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2026, time.March, 6, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, time.March, 6, 10, 30, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2026, time.March, 7, 3, 0, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2026, time.March, 9, 9, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, time.March, 8, 0, 0, 0, 0, time.UTC)},
+		{"0 12 1,15 * *", time.Date(2026, time.March, 15, 12, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2026, time.March, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, time.March, 6, 11, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", from.Add(90 * time.Second)},
+	}
+	for _, tt := range tests {
+		schedule, err := services.ParseCronSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.spec, err)
+			continue
+		}
+		if next := schedule.Next(from); !next.Equal(tt.expected) {
+			t.Errorf("%s: expected %s, got %s", tt.spec, tt.expected, next)
+		}
+	}
+}
+
+func TestCronSchedule_RejectsInvalidSpecs(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "@every 1ms", "@fortnightly"} {
+		if _, err := services.ParseCronSchedule(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestScheduler_SkipsOverlappingRuns(t *testing.T) {
+	scheduler := services.NewScheduler()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	err := scheduler.Add("slow", "@hourly", true, func() (string, error) {
+		close(started)
+		<-release
+		return "done", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- scheduler.RunJob("slow") }()
+	<-started
+	if err := scheduler.RunJob("slow"); !errors.Is(err, services.ErrJobRunning) {
+		t.Errorf("Expected an overlapping run to be skipped, got %v", err)
+	}
+	if status := scheduler.Status()[0]; !status.Running || status.Skipped != 1 {
+		t.Errorf("Expected a running job with one skipped run, got %+v", status)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	status := scheduler.Status()[0]
+	if status.Running || status.Runs != 1 || status.LastResult != "done" || status.LastStarted == nil {
+		t.Errorf("Expected the finished run to be recorded, got %+v", status)
+	}
+}
+
+func TestScheduler_RecordsFailuresAndRejectsBadJobs(t *testing.T) {
+	scheduler := services.NewScheduler()
+	scheduler.Add("flaky", "0 3 * * *", false, func() (string, error) {
+		return "", errors.New("disk full")
+	})
+	if err := scheduler.RunJob("flaky"); err == nil {
+		t.Fatal("Expected the job error to be returned")
+	}
+	if status := scheduler.Status()[0]; status.Failures != 1 || status.LastError != "disk full" || status.Enabled {
+		t.Errorf("Expected a disabled job with one failure, got %+v", status)
+	}
+
+	if err := scheduler.RunJob("missing"); !errors.Is(err, services.ErrUnknownJob) {
+		t.Errorf("Expected ErrUnknownJob, got %v", err)
+	}
+	if err := scheduler.Add("flaky", "@daily", true, nil); err == nil {
+		t.Error("Expected a duplicate job name to be rejected")
+	}
+	if err := scheduler.Add("broken", "every day", true, nil); err == nil {
+		t.Error("Expected an invalid schedule to be rejected")
+	}
+}
+
+func TestRetentionSweeper_KeepsProtectedAndRecentPayloads(t *testing.T) {
+	storage := newRetainingStorage()
+	depot := newTestDepot(storage)
+	depot.payloadService.SetDeletionGuard(services.DeletionGuards{services.NewObjectRetention(storage, storage)})
+
+	seedIndexedObject(storage.MockStorageService, depot.metadataIndex, "expired", 10, 48*time.Hour)
+	seedIndexedObject(storage.MockStorageService, depot.metadataIndex, "retained", 10, 48*time.Hour)
+	seedIndexedObject(storage.MockStorageService, depot.metadataIndex, "recent", 10, time.Hour)
+	storage.SetRetention("retained", time.Now().Add(time.Hour))
+
+	summary, err := services.NewRetentionSweeper(depot.metadataIndex, depot.payloadService, 24*time.Hour).Sweep()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(summary, "removed 1") || !strings.Contains(summary, "kept 1 protected") {
+		t.Errorf("Unexpected summary %q", summary)
+	}
+	for name, kept := range map[string]bool{"expired": false, "retained": true, "recent": true} {
+		if _, exists := storage.payloads[name]; exists != kept {
+			t.Errorf("%s: expected kept=%v", name, kept)
+		}
+	}
+}
+
+func TestRetentionSweeper_HonoursRetentionClasses(t *testing.T) {
+	mock := NewMockStorageService()
+	depot := newTestDepot(mock)
+	seedIndexedObject(mock, depot.metadataIndex, "debug-old", 10, 8*24*time.Hour, "debug")
+	seedIndexedObject(mock, depot.metadataIndex, "audit-old", 10, 200*24*time.Hour, "audit")
+	seedIndexedObject(mock, depot.metadataIndex, "both", 10, 200*24*time.Hour, "debug", "audit")
+	seedIndexedObject(mock, depot.metadataIndex, "untagged-old", 10, 31*24*time.Hour)
+	seedIndexedObject(mock, depot.metadataIndex, "untagged-new", 10, 24*time.Hour)
+	seedIndexedObject(mock, depot.metadataIndex, "legal", 10, 5000*24*time.Hour, "legal")
+
+	sweeper := services.NewRetentionSweeper(depot.metadataIndex, depot.payloadService, 0)
+	sweeper.SetClasses(map[string]time.Duration{
+		"debug":   7 * 24 * time.Hour,
+		"audit":   365 * 24 * time.Hour,
+		"legal":   0,
+		"default": 30 * 24 * time.Hour,
+	})
+	if class, age := sweeper.Class([]string{"debug", "audit"}); class != "audit" || age != 365*24*time.Hour {
+		t.Errorf("Expected the longest class to win, got %s %s", class, age)
+	}
+
+	summary, err := sweeper.Sweep()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(summary, "by class: debug=1,default=1") {
+		t.Errorf("Expected removals counted per class, got %q", summary)
+	}
+	for name, kept := range map[string]bool{
+		"debug-old": false, "audit-old": true, "both": true,
+		"untagged-old": false, "untagged-new": true, "legal": true,
+	} {
+		if _, exists := mock.payloads[name]; exists != kept {
+			t.Errorf("%s: expected kept=%v", name, kept)
+		}
+	}
+}
+
+func TestRetentionSweeper_LeavesAgeExpiryToLifecycleRules(t *testing.T) {
+	mock := NewMockStorageService()
+	depot := newTestDepot(mock)
+	sweeper := services.NewRetentionSweeper(depot.metadataIndex, depot.payloadService, 36*time.Hour)
+	sweeper.SetClasses(map[string]time.Duration{"debug": 7 * 24 * time.Hour, "legal": 0})
+
+	rules := sweeper.ExpiryRules()
+	if len(rules) != 2 || rules[0].Days() != 2 || rules[1].Class != "debug" || rules[1].Days() != 7 {
+		t.Errorf("Expected a rule for the maximum age and one per expiring class, got %+v", rules)
+	}
+	if class := sweeper.LifecycleClass([]string{"debug"}); class != "debug" {
+		t.Errorf("Expected debug payloads tagged debug, got %q", class)
+	}
+	if class := sweeper.LifecycleClass([]string{"legal"}); class != "" {
+		t.Errorf("Expected payloads kept forever left untagged, got %q", class)
+	}
+	if class := sweeper.LifecycleClass(nil); class == "" {
+		t.Error("Expected untagged payloads tagged for the maximum age")
+	}
+
+	// The bucket has a day past the rounded-up rule before the sweeper steps in
+	sweeper.SetServerSideExpiry(true)
+	seedIndexedObject(mock, depot.metadataIndex, "due", 10, 50*time.Hour)
+	seedIndexedObject(mock, depot.metadataIndex, "overdue", 10, 73*time.Hour)
+	if _, err := sweeper.Sweep(); err != nil {
+		t.Fatal(err)
+	}
+	for name, kept := range map[string]bool{"due": true, "overdue": false} {
+		if _, exists := mock.payloads[name]; exists != kept {
+			t.Errorf("%s: expected kept=%v", name, kept)
+		}
+	}
+}
+
+func TestScrubber_ReportsCorruptAndMissingObjects(t *testing.T) {
+	mock := NewMockStorageService()
+	depot := newTestDepot(mock)
+	for _, name := range []string{"good", "corrupt", "missing"} {
+		data := []byte("payload " + name)
+		sum := sha256.Sum256(data)
+		mock.payloads[name] = data
+		depot.metadataIndex.PayloadStored(services.ObjectRecord{ObjectName: name, SHA256: hex.EncodeToString(sum[:])})
+	}
+	mock.payloads["corrupt"] = []byte("bit rot")
+	delete(mock.payloads, "missing")
+
+	summary, err := services.NewScrubber(mock, depot.metadataIndex).Scrub()
+	if err == nil || !strings.Contains(err.Error(), "corrupt") || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("Expected corrupt and missing objects to be reported, got %v", err)
+	}
+	if summary != "verified 3 object(s), 2 bad" {
+		t.Errorf("Unexpected summary %q", summary)
+	}
+}
+
+func TestIndexBackup_PrunesOldSnapshots(t *testing.T) {
+	mock := NewMockStorageService()
+	depot := newTestDepot(mock)
+	seedIndexedObject(mock, depot.metadataIndex, "req_payload.json", 10, time.Hour)
+
+	dir := t.TempDir()
+	backup := services.NewIndexBackup(depot.metadataIndex, dir, 2)
+	for i := 0; i < 3; i++ {
+		if _, err := backup.Backup(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 snapshots to be kept, got %d", len(entries))
+	}
+	data, _ := os.ReadFile(dir + "/" + entries[1].Name())
+	var records []services.ObjectRecord
+	if err := json.Unmarshal(data, &records); err != nil || len(records) != 1 || records[0].ObjectName != "req_payload.json" {
+		t.Errorf("Expected the snapshot to hold the index, got %v %v", records, err)
+	}
+}
+
+func TestStatsHandler_ReportsRollupAndJobs(t *testing.T) {
+	mock := NewMockStorageService()
+	depot := newTestDepot(mock)
+	seedIndexedObject(mock, depot.metadataIndex, "a_payload.json", 10, time.Hour)
+	seedIndexedObject(mock, depot.metadataIndex, "b_payload.json", 30, 2*time.Hour)
+
+	rollup := services.NewStatsRollup(depot.metadataIndex)
+	scheduler := services.NewScheduler()
+	scheduler.Add("stats", "*/5 * * * *", true, rollup.Rollup)
+	scheduler.RunJob("stats")
+
+	w := httptest.NewRecorder()
+	handlers.NewStatsHandler(rollup, scheduler).StatsHandler(w, httptest.NewRequest("GET", "/stats", nil))
+	var response struct {
+		Storage services.StorageStats `json:"storage"`
+		Jobs    []services.JobStatus  `json:"jobs"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Storage.Objects != 2 || response.Storage.Bytes != 40 || response.Storage.Requests != 2 {
+		t.Errorf("Unexpected storage stats %+v", response.Storage)
+	}
+	if len(response.Jobs) != 1 || response.Jobs[0].Runs != 1 || response.Jobs[0].LastResult == "" {
+		t.Errorf("Expected the stats job's last run, got %+v", response.Jobs)
+	}
+}
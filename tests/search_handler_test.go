@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindHandler_MatchesStoredChecksum(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+
+	payload := `{"event": "ping"}`
+	var requestIDs []string
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/depot", strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		depot.httpHandler.DepotHandler(w, req)
+
+		var response map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse JSON response: %v", err)
+		}
+		requestIDs = append(requestIDs, response["request_id"].(string))
+	}
+
+	// Wait for async storage
+	time.Sleep(100 * time.Millisecond)
+
+	sum := sha256.Sum256([]byte(payload))
+	req := httptest.NewRequest("GET", "/find?sha256="+hex.EncodeToString(sum[:]), nil)
+	w := httptest.NewRecorder()
+	depot.searchHandler.FindHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d", w.Code)
+	}
+
+	var response struct {
+		Found      bool     `json:"found"`
+		Count      int      `json:"count"`
+		RequestIDs []string `json:"request_ids"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+
+	if !response.Found || response.Count != 2 {
+		t.Fatalf("Expected 2 matches, got found=%v count=%d", response.Found, response.Count)
+	}
+	for _, id := range requestIDs {
+		found := false
+		for _, got := range response.RequestIDs {
+			if got == id {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected request_id %s in matches %v", id, response.RequestIDs)
+		}
+	}
+
+	// The checksum is also recorded as object metadata
+	for name, metadata := range mockService.metadata {
+		if metadata["Sha256"] != hex.EncodeToString(sum[:]) {
+			t.Errorf("Expected sha256 metadata on %s, got %v", name, metadata)
+		}
+	}
+}
+
+func TestFindHandler_NoMatch(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+
+	sum := sha256.Sum256([]byte("never stored"))
+	req := httptest.NewRequest("GET", "/find?sha256="+hex.EncodeToString(sum[:]), nil)
+	w := httptest.NewRecorder()
+	depot.searchHandler.FindHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d", w.Code)
+	}
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	if response["found"] != false || response["count"] != float64(0) {
+		t.Errorf("Expected no matches, got %v", response)
+	}
+}
+
+func TestFindHandler_InvalidChecksum(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+
+	for _, query := range []string{"", "?sha256=abc", "?sha256=" + strings.Repeat("z", 64)} {
+		req := httptest.NewRequest("GET", "/find"+query, nil)
+		w := httptest.NewRecorder()
+		depot.searchHandler.FindHandler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Query %q: expected status BadRequest, got %d", query, w.Code)
+		}
+	}
+}
@@ -614,7 +614,7 @@ func testListEndpointVerifyFiles(t *testing.T, baseURL string, minioClient *mini
 
 	found := false
 	for _, obj := range objects {
-		if obj.(string) == expectedFilename {
+		if obj.(map[string]any)["object_name"] == expectedFilename {
 			found = true
 			break
 		}
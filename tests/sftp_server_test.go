@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/frontends"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// seedRequestObject stores an object of a request in the mock and the index
+func seedRequestObject(mock *MockStorageService, index services.MetadataIndex, requestID, filename, data string, storedAt time.Time) {
+	objectName := requestID + "_" + filename
+	mock.payloads[objectName] = []byte(data)
+	index.PayloadStored(services.ObjectRecord{
+		RequestID:  requestID,
+		ObjectName: objectName,
+		Size:       len(data),
+		StoredAt:   storedAt,
+	})
+}
+
+// startSFTP serves fsys on a loopback port and returns a logged-in client
+func startSFTP(t *testing.T, fsys *services.DepotFS) *sftp.Client {
+	t.Helper()
+	hostKey, err := frontends.LoadHostKey("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := frontends.NewSFTPServer(fsys, hostKey, map[string]string{"batch": "s3cret"}, nil)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	if _, err := ssh.Dial("tcp", listener.Addr().String(), &ssh.ClientConfig{
+		User:            "batch",
+		Auth:            []ssh.AuthMethod{ssh.Password("wrong")},
+		HostKeyCallback: ssh.FixedHostKey(hostKey.PublicKey()),
+	}); err == nil {
+		t.Fatal("Expected a wrong password to be refused")
+	}
+
+	conn, err := ssh.Dial("tcp", listener.Addr().String(), &ssh.ClientConfig{
+		User:            "batch",
+		Auth:            []ssh.AuthMethod{ssh.Password("s3cret")},
+		HostKeyCallback: ssh.FixedHostKey(hostKey.PublicKey()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close(); conn.Close() })
+	return client
+}
+
+func dirNames(t *testing.T, client *sftp.Client, dir string) []string {
+	t.Helper()
+	entries, err := client.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Expected to list %s, got %v", dir, err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestSFTPServer_ReadOnlyBrowsing(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	day1 := time.Date(2026, 3, 1, 23, 30, 0, 0, time.UTC)
+	day2 := day1.Add(2 * time.Hour)
+	seedRequestObject(mockService, depot.metadataIndex, "req-a", "payload.json", `{"a":1}`, day1)
+	// A request stays in the directory of its first object
+	seedRequestObject(mockService, depot.metadataIndex, "req-a", "extra.txt", "later", day2)
+	seedRequestObject(mockService, depot.metadataIndex, "req-b", "report.csv", "x,y", day2)
+
+	client := startSFTP(t, services.NewDepotFS(depot.metadataIndex, mockService))
+
+	if names := dirNames(t, client, "/"); !slices.Equal(names, []string{"2026-03-01", "2026-03-02"}) {
+		t.Errorf("Expected date directories, got %v", names)
+	}
+	if names := dirNames(t, client, "/2026-03-01/req-a"); !slices.Equal(names, []string{"extra.txt", "payload.json"}) {
+		t.Errorf("Expected the request's files, got %v", names)
+	}
+
+	info, err := client.Stat("/2026-03-02/req-b/report.csv")
+	if err != nil || info.Size() != 3 || info.IsDir() {
+		t.Fatalf("Expected to stat the file, got %v (%v)", info, err)
+	}
+	file, err := client.Open("/2026-03-01/req-a/payload.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(file)
+	file.Close()
+	if string(data) != `{"a":1}` {
+		t.Errorf("Expected the payload, got %q", data)
+	}
+
+	if _, err := client.Stat("/2026-03-01/req-b"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a missing request to not exist, got %v", err)
+	}
+	if _, err := client.Create("/2026-03-01/req-a/new.txt"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Expected uploads to be refused, got %v", err)
+	}
+	if err := client.Remove("/2026-03-01/req-a/payload.json"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Expected removal to be refused, got %v", err)
+	}
+}
+
+func TestSFTPServer_Writable(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	seedRequestObject(mockService, depot.metadataIndex, "req-old", "old.txt", "old", time.Now())
+
+	fsys := services.NewDepotFS(depot.metadataIndex, mockService)
+	fsys.SetWriter(depot.payloadService, depot.payloadService)
+	client := startSFTP(t, fsys)
+
+	today := time.Now().UTC().Format("2006-01-02")
+	if err := client.MkdirAll(filepath.Join("/", today, "batch-7")); err != nil {
+		t.Fatalf("Expected mkdir to be accepted, got %v", err)
+	}
+	file, err := client.Create("/" + today + "/batch-7/orders.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("id,total\n1,9.99\n"))
+	if err := file.Close(); err != nil {
+		t.Fatalf("Expected the upload to be stored, got %v", err)
+	}
+	if data := waitForObject(t, mockService, "batch-7_orders.csv"); string(data) != "id,total\n1,9.99\n" {
+		t.Errorf("Expected the uploaded payload, got %q", data)
+	}
+
+	if _, err := client.Create("/not-a-date/batch-7/orders.csv"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Expected an upload outside a date directory to be refused, got %v", err)
+	}
+
+	if err := client.Remove("/" + today + "/req-old/old.txt"); err != nil {
+		t.Fatalf("Expected removal to succeed, got %v", err)
+	}
+	if _, exists := mockService.payloads["req-old_old.txt"]; exists {
+		t.Error("Expected the object to be deleted")
+	}
+}
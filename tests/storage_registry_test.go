@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/config"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestStorageRegistry_PicksBackendByName(t *testing.T) {
+	mock := NewMockStorageService()
+	services.RegisterStorageBackend("test-registry", func(cfg *config.Config) (services.StorageService, error) {
+		return mock, nil
+	})
+
+	backend, err := services.NewStorageBackend(&config.Config{StorageBackend: "test-registry"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if backend != services.StorageService(mock) {
+		t.Error("Expected the registered backend to be created")
+	}
+
+	found := false
+	for _, name := range services.StorageBackends() {
+		found = found || name == "test-registry"
+	}
+	if !found {
+		t.Errorf("Expected test-registry in %v", services.StorageBackends())
+	}
+
+	_, err = services.NewStorageBackend(&config.Config{StorageBackend: "floppy"})
+	if err == nil || !strings.Contains(err.Error(), "minio") {
+		t.Errorf("Expected an unknown backend error listing minio, got %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a name twice to panic")
+		}
+	}()
+	services.RegisterStorageBackend("test-registry", func(cfg *config.Config) (services.StorageService, error) {
+		return mock, nil
+	})
+}
+
+func TestStorageRegistry_S3NeedsBucket(t *testing.T) {
+	_, err := services.NewStorageBackend(&config.Config{StorageBackend: "s3", S3Endpoint: "s3.amazonaws.com"})
+	if err == nil || !strings.Contains(err.Error(), "S3_BUCKET") {
+		t.Errorf("Expected the s3 backend to require S3_BUCKET, got %v", err)
+	}
+}
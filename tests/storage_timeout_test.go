@@ -0,0 +1,220 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/config"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+	"github.com/minio/minio-go/v7"
+)
+
+// hungS3 answers bucket lookups but never answers object requests until it is closed
+func hungS3() (*httptest.Server, chan struct{}) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("location") {
+			fmt.Fprint(w, `<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`)
+			return
+		}
+		if strings.Count(strings.Trim(r.URL.Path, "/"), "/") == 0 && r.Method == http.MethodHead {
+			return
+		}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	return server, release
+}
+
+func TestMinioService_StorageTimeoutEndsHungCalls(t *testing.T) {
+	defer func(retries int) { minio.MaxRetry = retries }(minio.MaxRetry)
+	minio.MaxRetry = 1
+
+	server, release := hungS3()
+	defer server.Close()
+	defer close(release)
+	storage, err := services.NewMinioService(&config.Config{
+		MinioEndpoint:         strings.TrimPrefix(server.URL, "http://"),
+		MinioBucket:           "depot-payloads",
+		MinioRetryMaxAttempts: 1,
+		StorageTimeout:        100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewMinioService failed: %v", err)
+	}
+
+	started := time.Now()
+	if err := storage.SavePayload("req-1_payload.json", []byte("{}"), "application/json", nil); err == nil {
+		t.Fatal("Expected a save to a hung endpoint to fail")
+	}
+	if _, err := storage.GetPayload("req-1_payload.json"); err == nil {
+		t.Fatal("Expected a read from a hung endpoint to fail")
+	}
+	if _, err := storage.ListPayloads(); err == nil {
+		t.Fatal("Expected a listing of a hung endpoint to fail")
+	}
+	if elapsed := time.Since(started); elapsed > 3*time.Second {
+		t.Errorf("Expected the calls to give up after the storage timeout, took %s", elapsed)
+	}
+}
+
+func TestMinioService_SaveEndsWithItsContext(t *testing.T) {
+	defer func(retries int) { minio.MaxRetry = retries }(minio.MaxRetry)
+	minio.MaxRetry = 1
+
+	server, release := hungS3()
+	defer server.Close()
+	defer close(release)
+	storage, err := services.NewMinioService(&config.Config{
+		MinioEndpoint:            strings.TrimPrefix(server.URL, "http://"),
+		MinioBucket:              "depot-payloads",
+		MinioRetryMaxAttempts:    5,
+		MinioRetryInitialBackoff: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewMinioService failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	err = storage.SavePayloadContext(ctx, "req-1_payload.json", []byte("{}"), "application/json", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the save to end with its context, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("Expected no retries once the context ended, took %s", elapsed)
+	}
+}
+
+func TestMinioService_ReadsListsAndDeletesEndWithTheirContext(t *testing.T) {
+	defer func(retries int) { minio.MaxRetry = retries }(minio.MaxRetry)
+	minio.MaxRetry = 1
+
+	server, release := hungS3()
+	defer server.Close()
+	defer close(release)
+	storage, err := services.NewMinioService(&config.Config{
+		MinioEndpoint:            strings.TrimPrefix(server.URL, "http://"),
+		MinioBucket:              "depot-payloads",
+		MinioRetryMaxAttempts:    5,
+		MinioRetryInitialBackoff: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewMinioService failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	if _, err := storage.GetPayloadContext(ctx, "req-1_payload.json"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the read to end with its context, got %v", err)
+	}
+	if _, err := storage.ListPayloadsContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the listing to end with its context, got %v", err)
+	}
+	if err := storage.DeletePayloadContext(ctx, "req-1_payload.json"); err == nil {
+		t.Error("Expected the delete to end with its context")
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("Expected no retries once the context ended, took %s", elapsed)
+	}
+}
+
+func TestHTTPHandler_ReadsAndDeletesEndWithTheRequest(t *testing.T) {
+	storage := &contextStorage{MockStorageService: NewMockStorageService()}
+	depot := newTestDepot(storage)
+	result, err := depot.payloadService.StorePayload([]byte(`{"a":1}`), "application/json", "", services.StoreOptions{Sync: true})
+	if err != nil {
+		t.Fatalf("StorePayload failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	depot.httpHandler.GetHandler(w, httptest.NewRequest("GET", "/get?request_id="+result.RequestID, nil).WithContext(ctx))
+	if w.Code == http.StatusOK {
+		t.Errorf("Expected a read for a cancelled request to fail, got %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	depot.httpHandler.DeleteHandler(w, httptest.NewRequest("DELETE", "/delete?request_id="+result.RequestID, nil).WithContext(ctx))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected a delete for a cancelled request to fail with 500, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := depot.payloadService.ListAllPayloadsContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a listing for a cancelled request to fail, got %v", err)
+	}
+
+	// The payload is untouched and still readable by a live request
+	w = httptest.NewRecorder()
+	depot.httpHandler.GetHandler(w, httptest.NewRequest("GET", "/get?request_id="+result.RequestID, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the payload to survive the cancelled delete, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestStorePayload_SyncSaveEndsWithTheRequest(t *testing.T) {
+	storage := &contextStorage{MockStorageService: NewMockStorageService()}
+	depot := newTestDepot(storage)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := depot.payloadService.StorePayload([]byte(`{"a":1}`), "application/json", "", services.StoreOptions{Sync: true, Context: ctx})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the synchronous save to end with its request, got %v", err)
+	}
+
+	// Asynchronous saves outlive the request they came in on
+	result, err := depot.payloadService.StorePayload([]byte(`{"a":2}`), "application/json", "", services.StoreOptions{Context: ctx})
+	if err != nil {
+		t.Fatalf("StorePayload failed: %v", err)
+	}
+	if err := depot.payloadService.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain failed: %v", err)
+	}
+	if _, err := storage.GetPayload(result.Objects[0].ObjectName); err != nil {
+		t.Errorf("Expected the asynchronous save to complete after its request ended, got %v", err)
+	}
+}
+
+// contextStorage is mock storage whose saves, reads, listings and deletes fail once
+// their context has ended
+type contextStorage struct {
+	*MockStorageService
+}
+
+func (c *contextStorage) SavePayloadContext(ctx context.Context, objectName string, data []byte, contentType string, metadata map[string]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.SavePayload(objectName, data, contentType, metadata)
+}
+
+func (c *contextStorage) GetPayloadContext(ctx context.Context, objectName string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.GetPayload(objectName)
+}
+
+func (c *contextStorage) ListPayloadsContext(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.ListPayloads()
+}
+
+func (c *contextStorage) DeletePayloadContext(ctx context.Context, objectName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.DeletePayload(objectName)
+}
@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestStoreStatusTracker_ReportsOverallState(t *testing.T) {
+	tracker := services.NewStoreStatusTracker(time.Hour)
+	tracker.Pending(&services.StoreResult{RequestID: "req", Objects: []services.StoredObject{
+		{ObjectName: "req_a.txt"}, {ObjectName: "req_b.txt"},
+	}})
+
+	if status, _ := tracker.Status("req"); status.State != services.StoreStatePending || len(status.Objects) != 2 {
+		t.Errorf("Expected both objects pending, got %+v", status)
+	}
+	tracker.Saved("req", "req_a.txt", nil)
+	tracker.Saved("req", "req_b.txt", errors.New("disk full"))
+
+	status, _ := tracker.Status("req")
+	if status.State != services.StoreStatePartial || status.Objects[1].Error != "disk full" {
+		t.Errorf("Expected a partial upload reporting the error, got %+v", status)
+	}
+	if _, ok := tracker.Status("other"); ok {
+		t.Error("Expected an unknown request to be missing")
+	}
+}
+
+func TestStatusHandler_FollowsBackgroundSave(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	tracker := services.NewStoreStatusTracker(time.Hour)
+	depot.payloadService.SetStoreStatusTracker(tracker)
+	handler := handlers.NewStoreStatusHandler(tracker)
+
+	status := func(requestID string) (int, services.StoreStatus) {
+		w := httptest.NewRecorder()
+		handler.StatusHandler(w, httptest.NewRequest("GET", "/status?request_id="+requestID, nil))
+		var response services.StoreStatus
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	result, err := depot.payloadService.StorePayload([]byte("hello"), "text/plain", "hello.txt", services.StoreOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForObject(t, mockService, result.Objects[0].ObjectName)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		code, response := status(result.RequestID)
+		if code == http.StatusOK && response.State == services.StoreStateStored {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the upload to be reported stored, got %d %+v", code, response)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mockService.saveError = errors.New("bucket unreachable")
+	result, _ = depot.payloadService.StorePayload([]byte("x"), "text/plain", "x.txt", services.StoreOptions{Sync: true})
+	if _, response := status(result.RequestID); response.State != services.StoreStateFailed {
+		t.Errorf("Expected a failed upload, got %+v", response)
+	}
+
+	if code, _ := status("unknown"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown request, got %d", code)
+	}
+}
@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// streamingStorage stores bodies the way a streaming backend would; like MinIO, it
+// stops reading a body of known size once it has size bytes
+type streamingStorage struct {
+	*MockStorageService
+	streamed atomic.Int32
+}
+
+func (s *streamingStorage) SavePayloadStream(objectName string, body io.Reader, size int64, contentType string, metadata map[string]string, progress services.UploadProgressFunc) (int64, error) {
+	var data []byte
+	var err error
+	if size >= 0 {
+		data = make([]byte, size)
+		_, err = io.ReadFull(body, data)
+	} else {
+		data, err = io.ReadAll(body)
+	}
+	if err != nil {
+		return 0, err
+	}
+	s.streamed.Add(1)
+	if progress != nil {
+		progress(int64(len(data)), 1)
+	}
+	return int64(len(data)), s.MockStorageService.SavePayload(objectName, data, contentType, metadata)
+}
+
+// postChunked sends body without a Content-Length, optionally with a checksum trailer
+func postChunked(t *testing.T, url, contentType, body, checksum string) (*http.Response, map[string]any) {
+	t.Helper()
+	req, _ := http.NewRequest("POST", url, io.NopCloser(strings.NewReader(body)))
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", contentType)
+	if checksum != "" {
+		req.Trailer = http.Header{"X-Depot-Checksum-Sha256": []string{checksum}}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var response map[string]any
+	json.NewDecoder(resp.Body).Decode(&response)
+	return resp, response
+}
+
+func TestDepotHandler_StreamsUnknownLengthUploads(t *testing.T) {
+	storage := &streamingStorage{MockStorageService: NewMockStorageService()}
+	depot := newTestDepot(storage)
+	server := httptest.NewServer(http.HandlerFunc(depot.httpHandler.DepotHandler))
+	defer server.Close()
+
+	body := strings.Repeat("log line\n", 1000)
+	sum := sha256.Sum256([]byte(body))
+	resp, response := postChunked(t, server.URL+"?request_id=stream-1", "text/plain", body, hex.EncodeToString(sum[:]))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d", resp.StatusCode)
+	}
+	if storage.streamed.Load() != 1 {
+		t.Fatalf("Expected the upload to be streamed, got %d streamed uploads", storage.streamed.Load())
+	}
+	if data, _ := storage.GetPayload("stream-1_payload.txt"); string(data) != body {
+		t.Errorf("Expected the streamed body to be stored, got %d bytes", len(data))
+	}
+	if size, _ := response["size"].(float64); int(size) != len(body) {
+		t.Errorf("Expected the response to report %d bytes, got %v", len(body), response["size"])
+	}
+	record, ok := depot.metadataIndex.Get("stream-1_payload.txt")
+	if !ok || record.SHA256 != hex.EncodeToString(sum[:]) || record.Size != len(body) {
+		t.Errorf("Expected the streamed object to be indexed with its checksum, got %+v", record)
+	}
+
+	// A mismatched trailer fails the upload
+	resp, _ = postChunked(t, server.URL+"?request_id=stream-2", "text/plain", body, strings.Repeat("0", 64))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected a mismatched trailer to be rejected, got %d", resp.StatusCode)
+	}
+	if _, err := storage.GetPayload("stream-2_payload.txt"); err == nil {
+		t.Error("Expected nothing to be stored after a checksum mismatch")
+	}
+}
+
+func TestDepotHandler_BuffersUploadsThatCannotStream(t *testing.T) {
+	storage := &streamingStorage{MockStorageService: NewMockStorageService()}
+	depot := newTestDepot(storage)
+	server := httptest.NewServer(http.HandlerFunc(depot.httpHandler.DepotHandler))
+	defer server.Close()
+
+	multipart := "--b\r\nContent-Disposition: form-data; name=\"f\"; filename=\"a.txt\"\r\n\r\nA\r\n--b--\r\n"
+	resp, _ := postChunked(t, server.URL, "multipart/form-data; boundary=b", multipart, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d", resp.StatusCode)
+	}
+	if storage.streamed.Load() != 0 {
+		t.Error("Expected a multipart upload to be buffered instead of streamed")
+	}
+
+	// Storage without streaming support buffers every upload
+	plain := newTestDepot(NewMockStorageService())
+	plainServer := httptest.NewServer(http.HandlerFunc(plain.httpHandler.DepotHandler))
+	defer plainServer.Close()
+	if resp, _ := postChunked(t, plainServer.URL, "text/plain", "hello", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a buffered upload to succeed, got %d", resp.StatusCode)
+	}
+}
+
+func TestDepotHandler_StreamsLargeUploadsOfKnownLength(t *testing.T) {
+	storage := &streamingStorage{MockStorageService: NewMockStorageService()}
+	depot := newTestDepot(storage)
+	depot.httpHandler.SetStreamThreshold(1000)
+	server := httptest.NewServer(http.HandlerFunc(depot.httpHandler.DepotHandler))
+	defer server.Close()
+
+	post := func(requestID, body, checksum string) int {
+		req, _ := http.NewRequest("POST", server.URL+"?request_id="+requestID, strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/plain")
+		req.Header.Set("X-Depot-Checksum-Sha256", checksum)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	small := "small body"
+	sum := sha256.Sum256([]byte(small))
+	if code := post("small-1", small, hex.EncodeToString(sum[:])); code != http.StatusOK || storage.streamed.Load() != 0 {
+		t.Errorf("Expected a small body to be buffered, got %d with %d streamed", code, storage.streamed.Load())
+	}
+
+	large := strings.Repeat("x", 5000)
+	sum = sha256.Sum256([]byte(large))
+	if code := post("large-1", large, hex.EncodeToString(sum[:])); code != http.StatusOK || storage.streamed.Load() != 1 {
+		t.Fatalf("Expected a large body to be streamed, got %d with %d streamed", code, storage.streamed.Load())
+	}
+	if data, _ := storage.GetPayload("large-1_payload.txt"); string(data) != large {
+		t.Errorf("Expected the streamed body to be stored, got %d bytes", len(data))
+	}
+
+	// The checksum is checked even though storage stops reading at the declared size
+	if code := post("large-2", large, strings.Repeat("0", 64)); code != http.StatusBadRequest {
+		t.Errorf("Expected a mismatched checksum to be rejected, got %d", code)
+	}
+	if _, err := storage.GetPayload("large-2_payload.txt"); err == nil {
+		t.Error("Expected nothing to be stored after a checksum mismatch")
+	}
+}
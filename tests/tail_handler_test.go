@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+type tailTestMessage struct {
+	Type    string                   `json:"type"`
+	Object  services.ObjectRecord    `json:"object"`
+	Preview *services.PayloadPreview `json:"preview"`
+}
+
+func TestTailHandler_StreamsMatchingUploadsWithPreview(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+	server := httptest.NewServer(http.HandlerFunc(depot.feedHandler.TailHandler))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/tail?tag=webhook&preview=5"
+	ws, err := websocket.Dial(wsURL, "", server.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer ws.Close()
+
+	// Give the server time to subscribe
+	time.Sleep(50 * time.Millisecond)
+
+	// An untagged upload is filtered out, the tagged one is streamed
+	depot.httpHandler.DepotHandler(httptest.NewRecorder(), httptest.NewRequest("POST", "/depot", strings.NewReader("ignored")))
+	req := httptest.NewRequest("POST", "/depot", strings.NewReader("hello, world"))
+	req.Header.Set("X-Depot-Tags", "webhook")
+	depot.httpHandler.DepotHandler(httptest.NewRecorder(), req)
+
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var message tailTestMessage
+	if err := websocket.JSON.Receive(ws, &message); err != nil {
+		t.Fatalf("Failed to receive tail message: %v", err)
+	}
+
+	if message.Type != services.ChangeStored || message.Object.Tags[0] != "webhook" {
+		t.Errorf("Unexpected tail message %+v", message)
+	}
+	if message.Preview == nil || message.Preview.Text != "hello" || !message.Preview.Truncated {
+		t.Errorf("Expected truncated text preview, got %+v", message.Preview)
+	}
+}
+
+func TestWatchHandler_PreviewsBodiesByDefault(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+	server := httptest.NewServer(http.HandlerFunc(depot.feedHandler.WatchHandler))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	ws, err := websocket.Dial(wsURL, "", server.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer ws.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	body := `{"event":"ping"}`
+	req := httptest.NewRequest("POST", "/depot", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	depot.httpHandler.DepotHandler(httptest.NewRecorder(), req)
+
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var message tailTestMessage
+	if err := websocket.JSON.Receive(ws, &message); err != nil {
+		t.Fatalf("Failed to receive watch message: %v", err)
+	}
+	if message.Object.ContentType != "application/json" || message.Object.Size != len(body) {
+		t.Errorf("Unexpected object %+v", message.Object)
+	}
+	if message.Preview == nil || message.Preview.Text != body || message.Preview.Truncated {
+		t.Errorf("Expected the whole body previewed, got %+v", message.Preview)
+	}
+
+	// preview=0 turns the preview off
+	ws2, err := websocket.Dial(wsURL+"?preview=0", "", server.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer ws2.Close()
+	time.Sleep(50 * time.Millisecond)
+	depot.httpHandler.DepotHandler(httptest.NewRecorder(), httptest.NewRequest("POST", "/depot", strings.NewReader("quiet")))
+	ws2.SetReadDeadline(time.Now().Add(2 * time.Second))
+	message = tailTestMessage{}
+	if err := websocket.JSON.Receive(ws2, &message); err != nil {
+		t.Fatalf("Failed to receive watch message: %v", err)
+	}
+	if message.Preview != nil {
+		t.Errorf("Expected no preview with preview=0, got %+v", message.Preview)
+	}
+}
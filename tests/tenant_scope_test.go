@@ -0,0 +1,267 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestTenantScope_IsolatesTenants(t *testing.T) {
+	storage, _ := services.NewMemoryStorageService(0)
+	handler := createTestHandler(storage)
+	handler.SetSyncStore(true)
+	scope := handlers.NewTenantScope("X-Depot-Tenant", map[string]string{"acme-key": "acme", "globex-key": "globex"}, handlers.DefaultPublicRoutes)
+
+	call := func(route string, h http.HandlerFunc, method, target, apiKey, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if apiKey != "" {
+			req.Header.Set("X-Api-Key", apiKey)
+		}
+		scope.Wrap(route, h)(w, req)
+		return w
+	}
+	upload := func(apiKey, requestID string) string {
+		t.Helper()
+		target := "/depot"
+		if requestID != "" {
+			target += "?request_id=" + requestID
+		}
+		w := call("/depot", handler.DepotHandler, "POST", target, apiKey, `{"a":1}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected upload to succeed, got %d: %s", w.Code, w.Body.String())
+		}
+		var response map[string]any
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response["request_id"].(string)
+	}
+
+	acmeID := upload("acme-key", "")
+	if !strings.HasPrefix(acmeID, "acme.") {
+		t.Fatalf("Expected a tenant-prefixed request ID, got %q", acmeID)
+	}
+	if id := upload("acme-key", "order-42"); id != "acme.order-42" {
+		t.Errorf("Expected a client-chosen ID scoped to the tenant, got %q", id)
+	}
+	globexID := upload("globex-key", "order-42")
+
+	var listing map[string]any
+	w := call("/list", handler.ListHandler, "GET", "/list", "acme-key", "")
+	json.Unmarshal(w.Body.Bytes(), &listing)
+	if listing["count"] != float64(2) {
+		t.Errorf("Expected acme to list only its 2 objects, got %v", listing)
+	}
+	for _, obj := range listing["objects"].([]any) {
+		if name := obj.(map[string]any)["object_name"].(string); !strings.HasPrefix(name, "acme.") {
+			t.Errorf("Expected only acme objects, got %q", obj)
+		}
+	}
+
+	if w := call("/get", handler.GetHandler, "GET", "/get?request_id=order-42", "globex-key", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected globex to read its own order-42, got %d", w.Code)
+	}
+	if w := call("/get", handler.GetHandler, "GET", "/get?request_id="+acmeID, "globex-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected acme's payload hidden from globex, got %d", w.Code)
+	}
+	if w := call("/delete", handler.DeleteHandler, "DELETE", "/delete?request_id="+acmeID, "globex-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected globex unable to delete acme's payload, got %d", w.Code)
+	}
+	if w := call("/delete", handler.DeleteHandler, "DELETE", "/delete?request_id="+acmeID, "acme-key", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected acme to delete its generated request ID, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := storage.GetPayload(globexID + "_payload.json"); err != nil {
+		t.Errorf("Expected globex's payload kept, got %v", err)
+	}
+
+	if w := call("/list", handler.ListHandler, "GET", "/list", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a tenant, got %d", w.Code)
+	}
+	if w := call("/list", handler.ListHandler, "GET", "/list", "stolen-key", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an unknown API key, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/list", nil)
+	req.Header.Set("X-Depot-Tenant", "Not/Valid")
+	scope.Wrap("/list", handler.ListHandler)(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid tenant header, got %d", w.Code)
+	}
+}
+
+// bucketScoper hands out one memory storage per bucket, keeping the buckets it created
+type bucketScoper struct {
+	*services.MemoryStorageService
+	buckets map[string]*services.MemoryStorageService
+}
+
+func (s *bucketScoper) ForBucket(bucket string) (services.StorageService, error) {
+	if s.buckets[bucket] == nil {
+		s.buckets[bucket], _ = services.NewMemoryStorageService(0)
+	}
+	return s.buckets[bucket], nil
+}
+
+func TestTenantBucketStorage_RoutesTenantsToTheirBuckets(t *testing.T) {
+	memory, _ := services.NewMemoryStorageService(0)
+	shared := &bucketScoper{MemoryStorageService: memory, buckets: map[string]*services.MemoryStorageService{}}
+	storage, err := services.NewTenantBucketStorage(shared, map[string]string{"acme": "depot-acme"})
+	if err != nil {
+		t.Fatalf("Failed to create tenant bucket storage: %v", err)
+	}
+	if len(shared.buckets) != 0 {
+		t.Errorf("Expected tenant buckets to be created lazily, got %d", len(shared.buckets))
+	}
+
+	storage.SavePayload("acme.order-42_payload.json", []byte(`{"a":1}`), "application/json", nil)
+	storage.SavePayload("globex.order-42_payload.json", []byte(`{"b":2}`), "application/json", nil)
+
+	acme := shared.buckets["depot-acme"]
+	if acme == nil {
+		t.Fatal("Expected acme's bucket created on its first write")
+	}
+	if _, err := acme.GetPayload("order-42_payload.json"); err != nil {
+		t.Errorf("Expected acme's payload in its bucket without the prefix, got %v", err)
+	}
+	if _, err := shared.GetPayload("globex.order-42_payload.json"); err != nil {
+		t.Errorf("Expected an unmapped tenant kept in the shared bucket, got %v", err)
+	}
+	if data, err := storage.GetPayload("acme.order-42_payload.json"); err != nil || string(data) != `{"a":1}` {
+		t.Errorf("Expected acme's payload read back by its full name, got %q, %v", data, err)
+	}
+
+	objects, _ := storage.ListPayloads()
+	if len(objects) != 2 || objects[0] != "acme.order-42_payload.json" {
+		t.Errorf("Expected both objects listed by their full names, got %v", objects)
+	}
+	if objects, _ := storage.ListRequestPayloads("acme.order-42"); len(objects) != 1 || objects[0] != "acme.order-42_payload.json" {
+		t.Errorf("Expected acme's request listed from its bucket, got %v", objects)
+	}
+
+	if _, err := services.NewTenantBucketStorage(memory, map[string]string{"acme": "depot-acme"}); err == nil {
+		t.Error("Expected a backend that cannot serve other buckets to be rejected")
+	}
+	if _, err := services.NewTenantBucketStorage(shared, map[string]string{"acme": "Bad_Bucket"}); err == nil {
+		t.Error("Expected an invalid bucket name to be rejected")
+	}
+}
+
+func TestTenantScope_ScopesReadRoutes(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+	scope := handlers.NewTenantScope("", map[string]string{"acme-key": "acme", "globex-key": "globex"}, handlers.DefaultPublicRoutes)
+	body := `{"total":12}`
+	for _, tenant := range []string{"acme", "globex"} {
+		_, err := depot.payloadService.StorePayload([]byte(body), "application/json", "order.json", services.StoreOptions{RequestID: "order-42", Tenant: tenant, Sync: true})
+		if err != nil {
+			t.Fatalf("StorePayload failed: %v", err)
+		}
+	}
+	call := func(route string, h http.HandlerFunc, target, apiKey string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", target, nil)
+		req.Header.Set("X-Api-Key", apiKey)
+		scope.Wrap(route, h)(w, req)
+		return w
+	}
+	acmeObject := "acme.order-42_order.json"
+
+	if w := call("/preview", depot.previewHandler.PreviewHandler, "/preview?object="+acmeObject, "globex-key"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected acme's object hidden from globex's preview, got %d", w.Code)
+	}
+	if w := call("/preview", depot.previewHandler.PreviewHandler, "/preview?object=order-42_order.json", "acme-key"); w.Code != http.StatusOK {
+		t.Errorf("Expected acme to preview its own object, got %d", w.Code)
+	}
+	if w := call("/query", depot.queryHandler.QueryHandler, "/query?expr=.total&request_id=acme.order-42", "globex-key"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected acme's payload hidden from globex's query, got %d", w.Code)
+	}
+
+	sum := sha256.Sum256([]byte(body))
+	var found struct {
+		RequestIDs []string `json:"request_ids"`
+	}
+	w := call("/find", depot.searchHandler.FindHandler, "/find?sha256="+hex.EncodeToString(sum[:]), "globex-key")
+	json.Unmarshal(w.Body.Bytes(), &found)
+	if len(found.RequestIDs) != 1 || found.RequestIDs[0] != "globex.order-42" {
+		t.Errorf("Expected /find to return globex's request only, got %s", w.Body.String())
+	}
+
+	var changes struct {
+		Events []services.ChangeEvent `json:"events"`
+		Cursor int64                  `json:"cursor"`
+	}
+	w = call("/changes", depot.feedHandler.ChangesHandler, "/changes", "globex-key")
+	json.Unmarshal(w.Body.Bytes(), &changes)
+	if len(changes.Events) != 1 || changes.Events[0].Object.RequestID != "globex.order-42" || changes.Cursor != 2 {
+		t.Errorf("Expected /changes to return globex's event only, got %s", w.Body.String())
+	}
+
+	w = call("/export", depot.exportHandler.ExportHandler, "/export", "globex-key")
+	if rows := w.Header().Get("X-Depot-Export-Rows"); rows != "1" {
+		t.Errorf("Expected /export to include globex's payload only, got %s row(s)", rows)
+	}
+
+	var waited struct {
+		Event services.ChangeEvent `json:"event"`
+	}
+	w = call("/wait", depot.feedHandler.WaitHandler, "/wait?since=0&timeout=10ms", "globex-key")
+	json.Unmarshal(w.Body.Bytes(), &waited)
+	if waited.Event.Object.RequestID != "globex.order-42" {
+		t.Errorf("Expected /wait to skip acme's payload, got %s", w.Body.String())
+	}
+}
+
+func TestTenantScope_ScopesHoldsAndDeliveries(t *testing.T) {
+	storage := newHoldingStorage()
+	depot := newTestDepot(storage)
+	scope := handlers.NewTenantScope("", map[string]string{"acme-key": "acme", "globex-key": "globex"}, handlers.DefaultPublicRoutes)
+	call := func(route string, h http.HandlerFunc, method, target, apiKey string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("X-Api-Key", apiKey)
+		scope.Wrap(route, h)(w, req)
+		return w
+	}
+
+	storage.SavePayload("acme.order-42_payload.json", []byte(`{}`), "application/json", nil)
+	holds := handlers.NewLegalHoldHandler(services.NewLegalHolds(storage, storage))
+	if w := call("/legal-hold", holds.LegalHoldHandler, "PUT", "/legal-hold?request_id=acme.order-42", "globex-key"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected globex unable to hold acme's objects, got %d", w.Code)
+	}
+	if held, _ := storage.LegalHold("acme.order-42_payload.json"); held {
+		t.Error("Expected acme's object not to be held")
+	}
+	if w := call("/legal-hold", holds.LegalHoldHandler, "PUT", "/legal-hold?request_id=order-42", "acme-key"); w.Code != http.StatusOK {
+		t.Errorf("Expected acme to hold its own objects, got %d", w.Code)
+	}
+
+	notifier := services.NewHTTPCallbackNotifier("", fastPolicy(1), depot.deliveryLog)
+	notifier.Notify("http://127.0.0.1:1/acme", services.CompletionEvent{RequestID: "acme.order-42"})
+	failed := waitForDelivery(t, depot, services.DeliveryFailed)
+
+	var listing struct {
+		Count int `json:"count"`
+	}
+	w := call("/deliveries", depot.deliveriesHandler.DeliveriesHandler, "GET", "/deliveries", "globex-key")
+	json.Unmarshal(w.Body.Bytes(), &listing)
+	if listing.Count != 0 {
+		t.Errorf("Expected globex to see none of acme's deliveries, got %s", w.Body.String())
+	}
+	w = call("/deliveries", depot.deliveriesHandler.DeliveriesHandler, "GET", "/deliveries", "acme-key")
+	json.Unmarshal(w.Body.Bytes(), &listing)
+	if listing.Count != 1 {
+		t.Errorf("Expected acme to see its delivery, got %s", w.Body.String())
+	}
+	if w := call("/deliveries/redrive", depot.deliveriesHandler.RedriveHandler, "POST", "/deliveries/redrive?id="+failed.ID, "globex-key"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected globex unable to redrive acme's delivery, got %d", w.Code)
+	}
+	if w := call("/deliveries/redrive", depot.deliveriesHandler.RedriveHandler, "POST", "/deliveries/redrive?all=true", "globex-key"); !strings.Contains(w.Body.String(), `"queued":0`) {
+		t.Errorf("Expected globex to redrive none of acme's deliveries, got %s", w.Body.String())
+	}
+}
@@ -3,6 +3,8 @@ package tests
 import (
 	"fmt"
 	"sync"
+	"testing"
+	"time"
 
 	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
 	"github.com/ahmad-alkadri/simple-depot/internal/services"
@@ -12,6 +14,7 @@ import (
 type MockStorageService struct {
 	payloads     map[string][]byte
 	contentTypes map[string]string
+	metadata     map[string]map[string]string
 	saveError    error
 	listError    error
 	mu           sync.Mutex
@@ -21,17 +24,19 @@ func NewMockStorageService() *MockStorageService {
 	return &MockStorageService{
 		payloads:     make(map[string][]byte),
 		contentTypes: make(map[string]string),
+		metadata:     make(map[string]map[string]string),
 	}
 }
 
-func (m *MockStorageService) SavePayload(objectName string, data []byte, contentType string) error {
+func (m *MockStorageService) SavePayload(objectName string, data []byte, contentType string, metadata map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if m.saveError != nil {
 		return m.saveError
 	}
-	m.mu.Lock()
-	defer m.mu.Unlock()
 	m.payloads[objectName] = data
 	m.contentTypes[objectName] = contentType
+	m.metadata[objectName] = metadata
 	return nil
 }
 
@@ -44,12 +49,21 @@ func (m *MockStorageService) GetPayload(objectName string) ([]byte, error) {
 	return nil, fmt.Errorf("object not found: %s", objectName)
 }
 
+func (m *MockStorageService) GetPayloadMetadata(objectName string) (string, map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.payloads[objectName]; exists {
+		return m.contentTypes[objectName], m.metadata[objectName], nil
+	}
+	return "", nil, fmt.Errorf("object not found: %s", objectName)
+}
+
 func (m *MockStorageService) ListPayloads() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if m.listError != nil {
 		return nil, m.listError
 	}
-	m.mu.Lock()
-	defer m.mu.Unlock()
 	var objects []string
 	for key := range m.payloads {
 		objects = append(objects, key)
@@ -63,11 +77,34 @@ func (m *MockStorageService) DeletePayload(objectName string) error {
 	if _, exists := m.payloads[objectName]; exists {
 		delete(m.payloads, objectName)
 		delete(m.contentTypes, objectName)
+		delete(m.metadata, objectName)
 		return nil
 	}
 	return fmt.Errorf("object not found: %s", objectName)
 }
 
+// Payload returns a stored object's data, safe to call while services write to the mock
+func (m *MockStorageService) Payload(objectName string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, exists := m.payloads[objectName]
+	return data, exists
+}
+
+// Metadata returns a stored object's metadata, safe to call while services write to the mock
+func (m *MockStorageService) Metadata(objectName string) map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.metadata[objectName]
+}
+
+// PayloadCount returns how many objects are stored, safe to call while services write to the mock
+func (m *MockStorageService) PayloadCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.payloads)
+}
+
 func (m *MockStorageService) SetSaveError(err error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -80,8 +117,49 @@ func (m *MockStorageService) SetListError(err error) {
 	m.listError = err
 }
 
-// createTestHandler creates a handler with all dependencies for testing
-func createTestHandler(storage services.StorageService) *handlers.HTTPHandler {
+// storeWatcher signals every payload the service reports stored, so tests can wait for
+// asynchronous saves instead of sleeping
+type storeWatcher chan services.ObjectRecord
+
+func newStoreWatcher(service *services.DefaultPayloadService) storeWatcher {
+	watcher := make(storeWatcher, 64)
+	service.AddObserver(watcher)
+	return watcher
+}
+
+func (w storeWatcher) PayloadStored(record services.ObjectRecord) { w <- record }
+func (w storeWatcher) PayloadDeleted(services.ObjectRecord)       {}
+
+// wait blocks until count more payloads were stored
+func (w storeWatcher) wait(t *testing.T, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		select {
+		case <-w:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for %d stored payload(s), saw %d", count, i)
+		}
+	}
+}
+
+// testDepot bundles the services and handlers wired together for a test
+type testDepot struct {
+	payloadService *services.DefaultPayloadService
+	metadataIndex  *services.MemoryMetadataIndex
+	changeJournal  *services.ChangeJournal
+	httpHandler    *handlers.HTTPHandler
+	searchHandler  *handlers.SearchHandler
+	feedHandler    *handlers.FeedHandler
+	previewHandler *handlers.PreviewHandler
+	queryHandler   *handlers.QueryHandler
+	exportHandler  *handlers.ExportHandler
+
+	deliveryLog       *services.DeliveryLog
+	deliveriesHandler *handlers.DeliveriesHandler
+}
+
+// newTestDepot wires all dependencies around the given storage for testing
+func newTestDepot(storage services.StorageService) *testDepot {
 	idGenerator := services.NewDefaultIDGenerator()
 	contentTypeDetector := services.NewDefaultContentTypeDetector()
 	filenameExtractor := services.NewDefaultFilenameExtractor()
@@ -97,5 +175,38 @@ func createTestHandler(storage services.StorageService) *handlers.HTTPHandler {
 		zipService,
 	)
 
-	return handlers.NewHTTPHandler(payloadService, responseFormatter, filenameExtractor)
+	payloadService.SetArchiveExtractor(services.NewDefaultZipExtractor(contentTypeDetector, 10, 1<<20))
+	payloadService.SetDecompressor(services.NewGzipDecompressor(contentTypeDetector, 1<<20))
+
+	metadataIndex := services.NewMemoryMetadataIndex()
+	payloadService.AddObserver(metadataIndex)
+	payloadService.SetMetadataIndex(metadataIndex)
+
+	previewer := services.NewDefaultPreviewer()
+	queryEvaluator := services.NewGojqQueryEvaluator(time.Second, 100)
+
+	deliveryLog := services.NewDeliveryLog(100)
+
+	changeJournal, _ := services.NewChangeJournal("", 100)
+	payloadService.AddObserver(changeJournal)
+
+	return &testDepot{
+		payloadService: payloadService,
+		metadataIndex:  metadataIndex,
+		changeJournal:  changeJournal,
+		httpHandler:    handlers.NewHTTPHandler(payloadService, responseFormatter, filenameExtractor),
+		searchHandler:  handlers.NewSearchHandler(metadataIndex, responseFormatter),
+		feedHandler:    handlers.NewFeedHandler(changeJournal, storage, previewer, responseFormatter),
+		previewHandler: handlers.NewPreviewHandler(storage, previewer),
+		queryHandler:   handlers.NewQueryHandler(storage, queryEvaluator),
+		exportHandler:  handlers.NewExportHandler(services.NewDefaultExporter(metadataIndex, storage, queryEvaluator)),
+
+		deliveryLog:       deliveryLog,
+		deliveriesHandler: handlers.NewDeliveriesHandler(deliveryLog),
+	}
+}
+
+// createTestHandler creates a handler with all dependencies for testing
+func createTestHandler(storage services.StorageService) *handlers.HTTPHandler {
+	return newTestDepot(storage).httpHandler
 }
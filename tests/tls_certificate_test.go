@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestSelfSignedCertificate_ServesHTTP2(t *testing.T) {
+	cert, err := services.SelfSignedCertificate([]string{"depot.local", "127.0.0.1"}, time.Hour)
+	if err != nil {
+		t.Fatalf("SelfSignedCertificate failed: %v", err)
+	}
+	if err := cert.Leaf.VerifyHostname("depot.local"); err != nil {
+		t.Errorf("Expected the certificate to name depot.local: %v", err)
+	}
+	if err := cert.Leaf.VerifyHostname("other.local"); err == nil {
+		t.Error("Expected the certificate not to name other hosts")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Proto))
+		}),
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12},
+	}
+	go server.ServeTLS(listener, "", "")
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert.Leaf)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: roots},
+		ForceAttemptHTTP2: true,
+	}}
+	response, err := client.Get("https://" + listener.Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("Expected a client trusting the certificate to connect: %v", err)
+	}
+	defer response.Body.Close()
+	if response.ProtoMajor != 2 {
+		t.Errorf("Expected HTTP/2 to be negotiated, got %s", response.Proto)
+	}
+}
+
+func TestSelfSignedCertificate_DefaultsToLocalhost(t *testing.T) {
+	cert, err := services.SelfSignedCertificate(nil, time.Hour)
+	if err != nil {
+		t.Fatalf("SelfSignedCertificate failed: %v", err)
+	}
+	for _, host := range []string{"localhost", "127.0.0.1", "::1"} {
+		if err := cert.Leaf.VerifyHostname(host); err != nil {
+			t.Errorf("Expected the certificate to be valid for %s: %v", host, err)
+		}
+	}
+	if cert.Leaf.NotAfter.After(time.Now().Add(time.Hour)) {
+		t.Errorf("Expected the certificate to expire within an hour, expires %s", cert.Leaf.NotAfter)
+	}
+}
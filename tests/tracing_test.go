@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestDepotHandler_TracesUploadThroughStorage(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	depot := newTestDepot(NewMockStorageService())
+	depot.httpHandler.SetSyncStore(true)
+
+	ctx, request := otel.Tracer("test").Start(t.Context(), "POST /depot")
+	req := httptest.NewRequest("POST", "/depot", strings.NewReader(`{"a":1}`)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	depot.httpHandler.DepotHandler(w, req)
+	request.End()
+	if w.Code != 200 {
+		t.Fatalf("Expected the upload stored, got %d: %s", w.Code, w.Body.String())
+	}
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	for _, name := range []string{"payload.store", "payload.process", "payload.save", "storage.save"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("Expected a %s span, got %v", name, spans)
+			continue
+		}
+		if span.SpanContext().TraceID() != request.SpanContext().TraceID() {
+			t.Errorf("Expected %s in the request's trace", name)
+		}
+	}
+	if store := spans["payload.store"]; store != nil && store.Parent().SpanID() != request.SpanContext().SpanID() {
+		t.Errorf("Expected payload.store under the request span")
+	}
+	if save, store := spans["storage.save"], spans["payload.save"]; save != nil && store != nil && save.Parent().SpanID() != store.SpanContext().SpanID() {
+		t.Errorf("Expected storage.save under payload.save")
+	}
+}
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// getProgress polls the progress of an upload session
+func getProgress(handler *handlers.UploadHandler, session string) (int, services.UploadProgress) {
+	w := httptest.NewRecorder()
+	handler.ProgressHandler(w, httptest.NewRequest("GET", "/upload/"+session+"/progress", nil))
+	var progress services.UploadProgress
+	json.Unmarshal(w.Body.Bytes(), &progress)
+	return w.Code, progress
+}
+
+// waitForProgress polls until a session's progress satisfies done
+func waitForProgress(t *testing.T, handler *handlers.UploadHandler, session string, done func(services.UploadProgress) bool) services.UploadProgress {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if code, progress := getProgress(handler, session); code == http.StatusOK && done(progress) {
+			return progress
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	_, progress := getProgress(handler, session)
+	t.Fatalf("Timed out waiting for upload progress, last saw %+v", progress)
+	return progress
+}
+
+func TestUploadProgress_TracksStreamedUpload(t *testing.T) {
+	storage := &streamingStorage{MockStorageService: NewMockStorageService()}
+	depot := newTestDepot(storage)
+	tracker := services.NewUploadTracker(time.Minute, time.Minute)
+	depot.httpHandler.SetUploadTracker(tracker)
+	handler := handlers.NewUploadHandler(tracker)
+	server := httptest.NewServer(http.HandlerFunc(depot.httpHandler.DepotHandler))
+	defer server.Close()
+
+	reader, writer := io.Pipe()
+	req, _ := http.NewRequest("POST", server.URL+"?request_id=big-upload", reader)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	done := make(chan *http.Response)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("Request failed: %v", err)
+		}
+		done <- resp
+	}()
+
+	writer.Write(make([]byte, 1000))
+	progress := waitForProgress(t, handler, "big-upload", func(p services.UploadProgress) bool { return p.BytesReceived == 1000 })
+	if progress.State != services.UploadReceiving || progress.BytesExpected != -1 || progress.Stalled {
+		t.Errorf("Expected a running upload of unknown length, got %+v", progress)
+	}
+
+	writer.Write(make([]byte, 500))
+	writer.Close()
+	if resp := <-done; resp == nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the upload to succeed, got %v", resp)
+	}
+
+	progress = waitForProgress(t, handler, "big-upload", func(p services.UploadProgress) bool { return p.State != services.UploadReceiving })
+	if progress.State != services.UploadCompleted || progress.BytesReceived != 1500 || progress.BytesStored != 1500 || progress.PartsCompleted != 1 {
+		t.Errorf("Expected a completed upload with every byte stored, got %+v", progress)
+	}
+}
+
+func TestUploadProgress_ReportsFailuresAndStalls(t *testing.T) {
+	tracker := services.NewUploadTracker(10*time.Millisecond, time.Minute)
+	handler := handlers.NewUploadHandler(tracker)
+
+	session := tracker.Begin("slow", 100)
+	time.Sleep(20 * time.Millisecond)
+	if _, progress := getProgress(handler, "slow"); !progress.Stalled || progress.BytesExpected != 100 {
+		t.Errorf("Expected an idle upload to be flagged stalled, got %+v", progress)
+	}
+	session.Finish(io.ErrUnexpectedEOF)
+	if _, progress := getProgress(handler, "slow"); progress.State != services.UploadFailed || progress.Error == "" || progress.Stalled {
+		t.Errorf("Expected a failed upload, got %+v", progress)
+	}
+
+	if code, _ := getProgress(handler, "unknown"); code != http.StatusNotFound {
+		t.Errorf("Expected an unknown session to return NotFound, got %d", code)
+	}
+	w := httptest.NewRecorder()
+	handler.ProgressHandler(w, httptest.NewRequest("GET", "/upload/slow", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected a path without /progress to return NotFound, got %d", w.Code)
+	}
+}
+
+func TestUploadProgress_MarksRejectedUploadsFailed(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+	tracker := services.NewUploadTracker(time.Minute, time.Minute)
+	depot.httpHandler.SetUploadTracker(tracker)
+
+	postWithID(depot, "dup", `{}`, true)
+	if w := postWithID(depot, "dup", `{}`, true); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("Expected the second conditional upload to be refused, got %d", w.Code)
+	}
+	if progress, _ := tracker.Progress("dup"); progress.State != services.UploadFailed {
+		t.Errorf("Expected a refused upload to be reported as failed, got %+v", progress)
+	}
+}
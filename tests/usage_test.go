@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestUsageMeter_ChargesRequestsToTheirNamespace(t *testing.T) {
+	ledger, _ := services.NewUsageLedger("")
+	meter := handlers.NewUsageMeter("X-Team", ledger)
+	store := meter.Wrap("/depot", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"status":"success"}`))
+	})
+	get := meter.Wrap("/get", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0123456789"))
+	})
+	missing := meter.Wrap("/get", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Payload not found", http.StatusNotFound)
+	})
+
+	send := func(handler http.HandlerFunc, method, body, team string) {
+		r := httptest.NewRequest(method, "/", strings.NewReader(body))
+		if team != "" {
+			r.Header.Set("X-Team", team)
+		}
+		handler(httptest.NewRecorder(), r)
+	}
+	send(store, "POST", `{"amount":12}`, "payments")
+	send(get, "GET", "", "payments")
+	send(missing, "GET", "", "payments")
+	send(get, "GET", "", "")
+	send(get, "GET", "", "../etc")
+
+	usage := ledger.Usage(time.Now().UTC().Format(services.UsageMonthFormat))
+	if len(usage) != 2 {
+		t.Fatalf("Expected two namespaces, got %+v", usage)
+	}
+	if usage[0].Namespace != "default" || usage[0].Requests != 2 || usage[0].BytesDownloaded != 20 {
+		t.Errorf("Expected unnamed and invalid namespaces charged to default, got %+v", usage[0])
+	}
+	if usage[1].Namespace != "payments" || usage[1].Requests != 3 || usage[1].BytesStored != 13 || usage[1].BytesDownloaded != 10 {
+		t.Errorf("Expected failed requests counted without their bytes, got %+v", usage[1])
+	}
+}
+
+func TestUsageHandler_ExportsMonthsAndPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	ledger, err := services.NewUsageLedger(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ledger.RecordUsage("search", time.Date(2026, 9, 30, 23, 0, 0, 0, time.UTC), 100, 0)
+	ledger.RecordUsage("search", time.Date(2026, 10, 1, 1, 0, 0, 0, time.UTC), 0, 40)
+	ledger.RecordUsage("billing", time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC), 7, 0)
+	if _, err := ledger.Save(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	restored, err := services.NewUsageLedger(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	handler := handlers.NewUsageHandler(restored)
+	w := httptest.NewRecorder()
+	handler.UsageHandler(w, httptest.NewRequest("GET", "/usage?month=2026-10&format=csv", nil))
+	expected := "namespace,month,requests,bytes_stored,bytes_downloaded\n" +
+		"billing,2026-10,1,7,0\n" +
+		"search,2026-10,1,0,40\n"
+	if w.Code != http.StatusOK || w.Body.String() != expected {
+		t.Errorf("Expected October usage as CSV, got %d %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.UsageHandler(w, httptest.NewRequest("GET", "/usage?month=2026-09", nil))
+	var report struct {
+		Month      string                 `json:"month"`
+		Namespaces []services.UsageRecord `json:"namespaces"`
+	}
+	json.NewDecoder(w.Body).Decode(&report)
+	if report.Month != "2026-09" || len(report.Namespaces) != 1 || report.Namespaces[0].BytesStored != 100 {
+		t.Errorf("Expected September usage as JSON, got %+v", report)
+	}
+
+	w = httptest.NewRecorder()
+	handler.UsageHandler(w, httptest.NewRequest("GET", "/usage?month=October", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid month rejected, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	handlers.NewUsageHandler(nil).UsageHandler(w, httptest.NewRequest("GET", "/usage", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected 501 without usage accounting, got %d", w.Code)
+	}
+}
@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/frontends"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func davRequest(t *testing.T, server *httptest.Server, method, path, body string, headers map[string]string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("support", "s3cret")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	return resp, string(data)
+}
+
+func TestWebDAV_ReadOnlyBrowsing(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	seedRequestObject(mockService, depot.metadataIndex, "req-a", "payload.json", `{"a":1}`, day)
+
+	server := httptest.NewServer(frontends.NewWebDAVHandler(services.NewDepotFS(depot.metadataIndex, mockService), map[string]string{"support": "s3cret"}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Errorf("Expected a basic auth challenge, got %d", resp.StatusCode)
+	}
+
+	resp, body := davRequest(t, server, "PROPFIND", "/2026-03-01/", "", map[string]string{"Depth": "infinity"})
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("Expected 207, got %d: %s", resp.StatusCode, body)
+	}
+	for _, want := range []string{"/2026-03-01/req-a/payload.json", "<D:getcontentlength>7</D:getcontentlength>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the listing to contain %s, got %s", want, body)
+		}
+	}
+
+	resp, body = davRequest(t, server, "GET", "/2026-03-01/req-a/payload.json", "", nil)
+	if resp.StatusCode != http.StatusOK || body != `{"a":1}` {
+		t.Errorf("Expected the payload, got %d %q", resp.StatusCode, body)
+	}
+	resp, _ = davRequest(t, server, "GET", "/2026-03-01/req-b/missing.json", "", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing file, got %d", resp.StatusCode)
+	}
+	for _, method := range []string{"PUT", "DELETE", "MKCOL"} {
+		resp, _ := davRequest(t, server, method, "/2026-03-01/req-a/new.json", "{}", nil)
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected %s to be refused, got %d", method, resp.StatusCode)
+		}
+	}
+}
+
+func TestWebDAV_Writable(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	seedRequestObject(mockService, depot.metadataIndex, "req-old", "old.txt", "old", time.Now())
+
+	fsys := services.NewDepotFS(depot.metadataIndex, mockService)
+	fsys.SetWriter(depot.payloadService, depot.payloadService)
+	server := httptest.NewServer(frontends.NewWebDAVHandler(fsys, map[string]string{"support": "s3cret"}))
+	defer server.Close()
+
+	today := time.Now().UTC().Format("2006-01-02")
+	if resp, body := davRequest(t, server, "PUT", "/"+today+"/case-42/notes.txt", "customer notes", nil); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", resp.StatusCode, body)
+	}
+	if data := waitForObject(t, mockService, "case-42_notes.txt"); string(data) != "customer notes" {
+		t.Errorf("Expected the uploaded payload, got %q", data)
+	}
+	if resp, _ := davRequest(t, server, "DELETE", "/"+today+"/req-old/old.txt", "", nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", resp.StatusCode)
+	}
+	if _, exists := mockService.payloads["req-old_old.txt"]; exists {
+		t.Error("Expected the object to be deleted")
+	}
+}
@@ -0,0 +1,183 @@
+package tests
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func githubSignature(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func postGitHubWebhook(handler *handlers.WebhookHandler, contentType, body, signature string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/webhooks/github", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-GitHub-Event", "pull_request")
+	req.Header.Set("X-GitHub-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+	req.Header.Set("X-Hub-Signature-256", signature)
+	w := httptest.NewRecorder()
+	handler.GitHubHandler(w, req)
+	return w
+}
+
+func TestWebhookHandler_GitHub(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	handler := handlers.NewWebhookHandler(depot.payloadService, services.NewDefaultResponseFormatter())
+	handler.SetGitHubSecret("hook-secret")
+
+	body := `{"action":"opened","repository":{"full_name":"acme/widgets"}}`
+	if w := postGitHubWebhook(handler, "application/json", body, githubSignature("other-secret", body)); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected a wrong signature to be rejected, got %d", w.Code)
+	}
+	if w := postGitHubWebhook(handler, "application/json", body, githubSignature("hook-secret", body)); w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+
+	objectName := "github/acme/widgets/pull_request/72d3162e-cc78-11e3-81ab-4c9367dc0958_pull_request.json"
+	if data := waitForObject(t, mockService, objectName); string(data) != body {
+		t.Errorf("Expected the payload stored under the repository and event, got %q", data)
+	}
+	record, _ := depot.metadataIndex.Get(objectName)
+	if want := []string{"github", "github/acme/widgets", "github/acme/widgets/pull_request"}; !slices.Equal(record.Tags, want) {
+		t.Errorf("Expected tags %v, got %v", want, record.Tags)
+	}
+	metadata := mockService.Metadata(objectName)
+	if metadata[handlers.MetadataGitHubEvent] != "pull_request" || metadata[handlers.MetadataGitHubRepository] != "acme/widgets" || metadata[handlers.MetadataGitHubAction] != "opened" {
+		t.Errorf("Expected the GitHub fields as metadata, got %v", metadata)
+	}
+	deleted, err := depot.payloadService.DeleteRequest(context.Background(), "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+	if err != nil || !slices.Equal(deleted, []string{objectName}) {
+		t.Errorf("Expected the delivery ID to find %s, got %v (%v)", objectName, deleted, err)
+	}
+}
+
+func TestWebhookHandler_GitHubFormEncoded(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	handler := handlers.NewWebhookHandler(depot.payloadService, services.NewDefaultResponseFormatter())
+	handler.SetGitHubSecret("hook-secret")
+
+	payload := `{"repository":{"full_name":"acme/widgets"}}`
+	body := url.Values{"payload": {payload}}.Encode()
+	if w := postGitHubWebhook(handler, "application/x-www-form-urlencoded", body, githubSignature("hook-secret", body)); w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+	if data := waitForObject(t, mockService, "github/acme/widgets/pull_request/72d3162e-cc78-11e3-81ab-4c9367dc0958_pull_request.json"); string(data) != payload {
+		t.Errorf("Expected the decoded JSON payload, got %q", data)
+	}
+}
+
+func TestWebhookHandler_GitHubRefusesLargeBodies(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	handler := handlers.NewWebhookHandler(depot.payloadService, services.NewDefaultResponseFormatter())
+	handler.SetGitHubSecret("hook-secret")
+	handler.SetMaxBodySize(16)
+
+	body := `{"repository":{"full_name":"acme/widgets"}}`
+	if w := postGitHubWebhook(handler, "application/json", body, githubSignature("hook-secret", body)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status 413, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// A chunked body declares no length, so it is cut off while it is read
+	req := httptest.NewRequest("POST", "/webhooks/github", strings.NewReader(body))
+	req.ContentLength = -1
+	req.Header.Set("X-GitHub-Event", "push")
+	req.Header.Set("X-Hub-Signature-256", githubSignature("hook-secret", body))
+	w := httptest.NewRecorder()
+	handler.GitHubHandler(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status 413 for a chunked body, got %d: %s", w.Code, w.Body.String())
+	}
+	if mockService.PayloadCount() != 0 {
+		t.Error("Expected nothing stored from bodies over the limit")
+	}
+}
+
+func stripeSignature(secret, body string, at time.Time) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + body))
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil)) + ",v0=ignored"
+}
+
+func postStripeWebhook(handler *handlers.WebhookHandler, body, signature string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/webhooks/stripe", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Stripe-Signature", signature)
+	w := httptest.NewRecorder()
+	handler.StripeHandler(w, req)
+	return w
+}
+
+func TestWebhookHandler_Stripe(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	handler := handlers.NewWebhookHandler(depot.payloadService, services.NewDefaultResponseFormatter())
+	handler.SetStripeSecret("whsec_test", 5*time.Minute)
+
+	body := `{"id":"evt_1NG8Du2eZvKYlo2C","type":"invoice.paid","livemode":false}`
+	for name, signature := range map[string]string{
+		"wrong secret": stripeSignature("whsec_other", body, time.Now()),
+		"stale":        stripeSignature("whsec_test", body, time.Now().Add(-10*time.Minute)),
+		"malformed":    "v1=abc",
+	} {
+		if w := postStripeWebhook(handler, body, signature); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected a %s signature to be rejected, got %d", name, w.Code)
+		}
+	}
+
+	if w := postStripeWebhook(handler, body, stripeSignature("whsec_test", body, time.Now())); w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+	objectName := "evt-1NG8Du2eZvKYlo2C_invoice.paid.json"
+	waitForObject(t, mockService, objectName)
+	metadata := mockService.metadata[objectName]
+	if metadata[handlers.MetadataStripeEventID] != "evt_1NG8Du2eZvKYlo2C" || metadata[handlers.MetadataStripeEventType] != "invoice.paid" {
+		t.Errorf("Expected the event ID and type as metadata, got %v", metadata)
+	}
+	if record, _ := depot.metadataIndex.Get(objectName); !slices.Equal(record.Tags, []string{"stripe", "stripe/invoice.paid"}) {
+		t.Errorf("Expected the event type as a tag, got %v", record.Tags)
+	}
+
+	// A retried event is flagged as a duplicate and not stored again
+	w := postStripeWebhook(handler, body, stripeSignature("whsec_test", body, time.Now()))
+	var response map[string]any
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if w.Code != http.StatusOK || response["duplicate"] != true || response["request_id"] != "evt-1NG8Du2eZvKYlo2C" {
+		t.Errorf("Expected a duplicate response, got %d %v", w.Code, response)
+	}
+}
+
+func TestWebhookHandler_StripeRefusesLargeBodies(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	handler := handlers.NewWebhookHandler(depot.payloadService, services.NewDefaultResponseFormatter())
+	handler.SetStripeSecret("whsec_test", 5*time.Minute)
+	handler.SetMaxBodySize(16)
+
+	body := `{"id":"evt_1NG8Du2eZvKYlo2C","type":"invoice.paid"}`
+	if w := postStripeWebhook(handler, body, stripeSignature("whsec_test", body, time.Now())); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status 413, got %d: %s", w.Code, w.Body.String())
+	}
+	if mockService.PayloadCount() != 0 {
+		t.Error("Expected nothing stored from a body over the limit")
+	}
+}
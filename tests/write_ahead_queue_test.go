@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/handlers"
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+func TestWriteAheadQueue_QueuesFailedSavesUntilStorageRecovers(t *testing.T) {
+	mock := NewMockStorageService()
+	dir := t.TempDir()
+	policy := services.RetryPolicy{InitialBackoff: services.Duration(time.Millisecond), MaxBackoff: services.Duration(time.Millisecond)}
+	policy, _ = policy.WithDefaults()
+	queue, err := services.NewWriteAheadQueue(mock, dir, policy)
+	if err != nil {
+		t.Fatalf("NewWriteAheadQueue failed: %v", err)
+	}
+
+	mock.SetSaveError(errors.New("bucket unreachable"))
+	if err := queue.SavePayload("req-1_payload.json", []byte(`{"a":1}`), "application/json", map[string]string{"Request-Id": "req-1"}); err != nil {
+		t.Fatalf("Expected a failed save queued, got %v", err)
+	}
+	if data, err := queue.GetPayload("req-1_payload.json"); err != nil || string(data) != `{"a":1}` {
+		t.Errorf("Expected the queued payload readable, got %q, %v", data, err)
+	}
+	if objects, _ := queue.ListRequestPayloads("req-1"); len(objects) != 1 {
+		t.Errorf("Expected the queued payload listed, got %v", objects)
+	}
+	if status := queue.Status(); status.Depth != 1 || status.Bytes != 7 || status.LastError == "" {
+		t.Errorf("Expected one queued payload with its error, got %+v", status)
+	}
+
+	w := httptest.NewRecorder()
+	handlers.NewQueueHandler(queue).StatusHandler(w, httptest.NewRequest("GET", "/queue/status", nil))
+	var status services.WriteAheadQueueStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil || status.Depth != 1 {
+		t.Errorf("Expected /queue/status to report the backlog, got %s", w.Body.String())
+	}
+
+	// A restart finds the payload still queued
+	time.Sleep(2 * time.Millisecond)
+	queue.FlushOnce()
+	reopened, err := services.NewWriteAheadQueue(mock, dir, policy)
+	if err != nil || reopened.Status().Depth != 1 {
+		t.Fatalf("Expected the queue kept on disk, got %+v, %v", reopened.Status(), err)
+	}
+
+	mock.SetSaveError(nil)
+	if saved := reopened.FlushOnce(); saved != 1 {
+		t.Fatalf("Expected the queued payload saved once storage recovers, got %d", saved)
+	}
+	if data, _ := mock.GetPayload("req-1_payload.json"); string(data) != `{"a":1}` {
+		t.Errorf("Expected the payload in storage, got %q", data)
+	}
+	if status := reopened.Status(); status.Depth != 0 || status.Flushed != 1 {
+		t.Errorf("Expected the queue empty, got %+v", status)
+	}
+}
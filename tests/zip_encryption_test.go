@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// decryptZipAES reads one WinZip AE-2 entry with password, checking the password
+// verifier and authentication code
+func decryptZipAES(t *testing.T, file *zip.File, password string) (string, bool) {
+	t.Helper()
+	if file.Method != 99 || file.Flags&0x1 == 0 {
+		t.Fatalf("Expected %s to be AES encrypted, got method %d flags %#x", file.Name, file.Method, file.Flags)
+	}
+	extra := file.Extra
+	if len(extra) < 11 || binary.LittleEndian.Uint16(extra) != 0x9901 || string(extra[6:8]) != "AE" || extra[8] != 3 {
+		t.Fatalf("Expected an AES-256 extra field on %s, got % x", file.Name, extra)
+	}
+	method := binary.LittleEndian.Uint16(extra[9:])
+
+	raw, err := file.OpenRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, _ := io.ReadAll(raw)
+	salt, verifier, ciphertext, authCode := sealed[:16], sealed[16:18], sealed[18:len(sealed)-10], sealed[len(sealed)-10:]
+
+	keys, err := pbkdf2.Key(sha1.New, password, salt, 1000, 66)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(keys[64:], verifier) {
+		return "", false
+	}
+	mac := hmac.New(sha1.New, keys[32:64])
+	mac.Write(ciphertext)
+	if !hmac.Equal(mac.Sum(nil)[:10], authCode) {
+		t.Fatalf("Expected %s to pass its authentication code", file.Name)
+	}
+
+	block, _ := aes.NewCipher(keys[:32])
+	plain := make([]byte, len(ciphertext))
+	var counter, keystream [aes.BlockSize]byte
+	for i := range ciphertext {
+		if i%aes.BlockSize == 0 {
+			binary.LittleEndian.PutUint64(counter[:], uint64(i/aes.BlockSize+1))
+			block.Encrypt(keystream[:], counter[:])
+		}
+		plain[i] = ciphertext[i] ^ keystream[i%aes.BlockSize]
+	}
+	if method == zip.Deflate {
+		plain, err = io.ReadAll(flate.NewReader(bytes.NewReader(plain)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return string(plain), true
+}
+
+func getEncrypted(depot *testDepot, query, password string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/get?"+query, nil)
+	if password != "" {
+		req.Header.Set("X-Depot-Zip-Password", password)
+	}
+	w := httptest.NewRecorder()
+	depot.httpHandler.GetHandler(w, req)
+	return w
+}
+
+func openZip(t *testing.T, data []byte) *zip.Reader {
+	t.Helper()
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reader
+}
+
+func TestGetHandler_EncryptedZip(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	contents := map[string]string{
+		"bundle_report.json": strings.Repeat(`{"secret": "value"}`, 20),
+		"bundle_notes.txt":   "short",
+	}
+	for name, data := range contents {
+		mockService.payloads[name] = []byte(data)
+	}
+
+	w := getEncrypted(depot, "request_id=bundle&raw=true", "partner-passphrase")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("X-Depot-Zip-Password") != "" {
+		t.Error("Expected a supplied password not to be echoed back")
+	}
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Error("Expected encrypted downloads not to be cached")
+	}
+
+	reader := openZip(t, w.Body.Bytes())
+	if len(reader.File) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(reader.File))
+	}
+	for _, file := range reader.File {
+		plain, ok := decryptZipAES(t, file, "partner-passphrase")
+		if !ok || plain != contents["bundle_"+file.Name] {
+			t.Errorf("Expected %s to decrypt to its payload, got %q", file.Name, plain)
+		}
+		if _, ok := decryptZipAES(t, file, "wrong-passphrase"); ok {
+			t.Errorf("Expected the wrong password to fail verification for %s", file.Name)
+		}
+	}
+}
+
+func TestGetHandler_EncryptedZipGeneratedPassword(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	mockService.payloads["single_data.txt"] = []byte("sensitive")
+
+	// A single payload is still zipped when encryption is requested
+	w := getEncrypted(depot, "request_id=single&raw=true&encrypt=true", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	password := w.Header().Get("X-Depot-Zip-Password")
+	if len(password) < 20 {
+		t.Fatalf("Expected a generated password, got %q", password)
+	}
+	reader := openZip(t, w.Body.Bytes())
+	if plain, ok := decryptZipAES(t, reader.File[0], password); !ok || plain != "sensitive" {
+		t.Errorf("Expected the generated password to decrypt the payload, got %q", plain)
+	}
+
+	// Another request gets a different password
+	if other := getEncrypted(depot, "request_id=single&raw=true&encrypt=true", "").Header().Get("X-Depot-Zip-Password"); other == password {
+		t.Error("Expected a fresh password per request")
+	}
+}
+
+func TestGetHandler_EncryptedZipRejectsBadRequests(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	mockService.payloads["req_data.txt"] = []byte("data")
+
+	tests := []struct {
+		name     string
+		query    string
+		password string
+		want     int
+	}{
+		{"short password", "request_id=req&raw=true", "short", http.StatusBadRequest},
+		{"json mode", "request_id=req&encrypt=true", "", http.StatusBadRequest},
+		{"unknown request", "request_id=missing&raw=true", "partner-passphrase", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := getEncrypted(depot, tt.query, tt.password); w.Code != tt.want {
+				t.Errorf("Expected %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
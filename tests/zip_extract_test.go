@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// buildZip creates an in-memory zip archive from name/content pairs
+func buildZip(t *testing.T, entries map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range entries {
+		f, err := writer.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to create zip entry: %v", err)
+		}
+		f.Write([]byte(content))
+	}
+	writer.Close()
+	return buf.Bytes()
+}
+
+// postZip uploads an archive with extraction requested
+func postZip(depot *testDepot, data []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/depot", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/zip")
+	req.Header.Set("X-Depot-Extract", "true")
+	w := httptest.NewRecorder()
+	depot.httpHandler.DepotHandler(w, req)
+	return w
+}
+
+func TestDepotHandler_ExtractsZip(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	stored := newStoreWatcher(depot.payloadService)
+
+	w := postZip(depot, buildZip(t, map[string]string{
+		"readme.txt":     "hello",
+		"data/item.json": `{"id": 1}`,
+	}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		RequestID string `json:"request_id"`
+		Objects   []struct {
+			ObjectName       string `json:"object_name"`
+			OriginalFilename string `json:"original_filename"`
+		} `json:"objects"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	if len(response.Objects) != 2 {
+		t.Fatalf("Expected 2 extracted objects, got %d", len(response.Objects))
+	}
+
+	stored.wait(t, 2)
+
+	expected := map[string]string{
+		response.RequestID + "_readme.txt":     "hello",
+		response.RequestID + "_data_item.json": `{"id": 1}`,
+	}
+	for name, content := range expected {
+		if data, _ := mockService.Payload(name); string(data) != content {
+			t.Errorf("Expected %s to contain %q, got %q", name, content, data)
+		}
+	}
+}
+
+func TestDepotHandler_ZipWithoutExtractStoredAsIs(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+	stored := newStoreWatcher(depot.payloadService)
+
+	req := httptest.NewRequest("POST", "/depot", bytes.NewReader(buildZip(t, map[string]string{"a.txt": "a"})))
+	req.Header.Set("Content-Type", "application/zip")
+	w := httptest.NewRecorder()
+	depot.httpHandler.DepotHandler(w, req)
+
+	stored.wait(t, 1)
+
+	if count := mockService.PayloadCount(); count != 1 {
+		t.Errorf("Expected the archive to be stored as a single object, got %d objects", count)
+	}
+}
+
+func TestDepotHandler_ExtractRejectsZipSlip(t *testing.T) {
+	mockService := NewMockStorageService()
+	depot := newTestDepot(mockService)
+
+	for _, name := range []string{"../evil.txt", "/etc/passwd", "a/../../evil.txt"} {
+		w := postZip(depot, buildZip(t, map[string]string{name: "x"}))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status BadRequest, got %d", name, w.Code)
+		}
+	}
+
+	// Rejected archives are refused before any save is queued
+	if count := mockService.PayloadCount(); count != 0 {
+		t.Errorf("Expected nothing to be stored, got %d objects", count)
+	}
+}
+
+func TestDepotHandler_ExtractEnforcesLimits(t *testing.T) {
+	depot := newTestDepot(NewMockStorageService())
+
+	// The test depot allows at most 10 entries and 1 MiB uncompressed
+	entries := map[string]string{}
+	for i := 0; i < 11; i++ {
+		entries[strings.Repeat("f", i+1)+".txt"] = "x"
+	}
+	if w := postZip(depot, buildZip(t, entries)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Too many entries: expected status 413, got %d", w.Code)
+	}
+
+	bomb := buildZip(t, map[string]string{"big.txt": strings.Repeat("0", 2<<20)})
+	if w := postZip(depot, bomb); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Too many bytes: expected status 413, got %d", w.Code)
+	}
+
+	if w := postZip(depot, []byte("PK\x03\x04 not really a zip")); w.Code != http.StatusBadRequest {
+		t.Errorf("Corrupt archive: expected status 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,239 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ahmad-alkadri/simple-depot/internal/services"
+)
+
+// zip record signatures checked by the tests
+const (
+	zipLocalHeaderSignature = 0x04034b50
+	zip64EndSignature       = 0x06064b50
+	zip64ExtraID            = 0x0001
+)
+
+func zipFile(name, data string) services.FileInfo {
+	return services.FileInfo{
+		ObjectName:       "req_" + name,
+		OriginalFilename: name,
+		Size:             len(data),
+		PayloadBase64:    base64.StdEncoding.EncodeToString([]byte(data)),
+	}
+}
+
+func TestCreateZip_WritesSizesInLocalHeaders(t *testing.T) {
+	zipService := services.NewDefaultZipService()
+	archive, err := zipService.CreateZip([]services.FileInfo{
+		zipFile("a.json", strings.Repeat(`{"compressible": true}`, 100)),
+		zipFile("résumé.txt", "x"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first local header carries the CRC and sizes, with no data descriptor
+	if binary.LittleEndian.Uint32(archive[0:]) != zipLocalHeaderSignature {
+		t.Fatal("Expected the archive to start with a local file header")
+	}
+	if flags := binary.LittleEndian.Uint16(archive[6:]); flags&0x8 != 0 {
+		t.Errorf("Expected no data descriptor flag, got flags %#x", flags)
+	}
+	if crc := binary.LittleEndian.Uint32(archive[14:]); crc == 0 {
+		t.Error("Expected the CRC-32 in the local header")
+	}
+	if size := binary.LittleEndian.Uint32(archive[22:]); size != 2200 {
+		t.Errorf("Expected the uncompressed size in the local header, got %d", size)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reader.File) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(reader.File))
+	}
+	if reader.File[0].Method != zip.Deflate || reader.File[1].Method != zip.Store {
+		t.Errorf("Expected compressible data deflated and the rest stored, got methods %d and %d", reader.File[0].Method, reader.File[1].Method)
+	}
+	if reader.File[1].Name != "résumé.txt" || reader.File[1].Flags&0x800 == 0 {
+		t.Errorf("Expected a UTF-8 name, got %q (flags %#x)", reader.File[1].Name, reader.File[1].Flags)
+	}
+	for _, file := range reader.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(io.Discard, f); err != nil {
+			t.Errorf("Expected %s to pass its checksum, got %v", file.Name, err)
+		}
+		f.Close()
+	}
+}
+
+func TestCreateZip_Zip64ForManyEntries(t *testing.T) {
+	const count = 70000
+	files := make([]services.FileInfo, count)
+	for i := range files {
+		files[i] = zipFile(fmt.Sprintf("%05d.txt", i), "x")
+	}
+	archive, err := services.NewDefaultZipService().CreateZip(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(archive[len(archive)-200:], binary.LittleEndian.AppendUint32(nil, zip64EndSignature)) {
+		t.Error("Expected a Zip64 end of central directory record")
+	}
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reader.File) != count {
+		t.Errorf("Expected %d entries, got %d", count, len(reader.File))
+	}
+}
+
+// headTailWriter keeps only the start and end of what is written to it
+type headTailWriter struct {
+	head  []byte
+	tail  []byte
+	total int64
+}
+
+func (w *headTailWriter) Write(p []byte) (int, error) {
+	if room := 128 - len(w.head); room > 0 {
+		w.head = append(w.head, p[:min(room, len(p))]...)
+	}
+	w.tail = append(w.tail, p...)
+	if len(w.tail) > 256 {
+		w.tail = append([]byte{}, w.tail[len(w.tail)-256:]...)
+	}
+	w.total += int64(len(p))
+	return len(p), nil
+}
+
+// zeroReader yields n zero bytes
+type zeroReader struct{ n int64 }
+
+func (r *zeroReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, io.EOF
+	}
+	n := int(min(int64(len(p)), r.n))
+	clear(p[:n])
+	r.n -= int64(n)
+	return n, nil
+}
+
+func TestWriteZip_Zip64LocalHeaderForLargeEntries(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Streams 4 GiB")
+	}
+	const size = 1<<32 + 16
+	var crc uint32
+	chunk := make([]byte, 1<<20)
+	for remaining := int64(size); remaining > 0; remaining -= int64(len(chunk)) {
+		crc = crc32.Update(crc, crc32.IEEETable, chunk[:min(int64(len(chunk)), remaining)])
+	}
+
+	out := &headTailWriter{}
+	err := services.NewDefaultZipService().WriteZip(out, []services.ZipEntry{
+		{Name: "big.bin", Size: size, CRC32: crc, Data: &zeroReader{n: size}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head := out.head
+	if binary.LittleEndian.Uint32(head[0:]) != zipLocalHeaderSignature {
+		t.Fatal("Expected the archive to start with a local file header")
+	}
+	if version := binary.LittleEndian.Uint16(head[4:]); version < 45 {
+		t.Errorf("Expected reader version 4.5 for Zip64, got %d", version)
+	}
+	if compressed, uncompressed := binary.LittleEndian.Uint32(head[18:]), binary.LittleEndian.Uint32(head[22:]); compressed != 0xffffffff || uncompressed != 0xffffffff {
+		t.Errorf("Expected Zip64 placeholders in the local header, got %#x/%#x", compressed, uncompressed)
+	}
+	nameLen := int(binary.LittleEndian.Uint16(head[26:]))
+	extra := head[30+nameLen:]
+	if binary.LittleEndian.Uint16(extra) != zip64ExtraID || binary.LittleEndian.Uint64(extra[4:]) != size {
+		t.Errorf("Expected a local Zip64 extra field with the real size, got % x", extra[:20])
+	}
+	if !bytes.Contains(out.tail, binary.LittleEndian.AppendUint32(nil, zip64EndSignature)) {
+		t.Error("Expected a Zip64 end of central directory record")
+	}
+}
+
+func TestWriteZip_RejectsShortEntries(t *testing.T) {
+	err := services.NewDefaultZipService().WriteZip(io.Discard, []services.ZipEntry{
+		{Name: "short.txt", Size: 10, CRC32: crc32.ChecksumIEEE([]byte("abc")), Data: strings.NewReader("abc")},
+	})
+	if err == nil {
+		t.Error("Expected an entry shorter than its declared size to fail")
+	}
+}
+
+func zipEntryNames(t *testing.T, archive []byte) []string {
+	t.Helper()
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	return names
+}
+
+func TestCreateZip_DeduplicatesEntryNames(t *testing.T) {
+	files := []services.FileInfo{
+		{ObjectName: "a_payload.json", OriginalFilename: "payload.json", PayloadBase64: base64.StdEncoding.EncodeToString([]byte("1"))},
+		{ObjectName: "b_payload.json", OriginalFilename: "payload.json", PayloadBase64: base64.StdEncoding.EncodeToString([]byte("2"))},
+		{ObjectName: "c_payload.json", OriginalFilename: "PAYLOAD.json", PayloadBase64: base64.StdEncoding.EncodeToString([]byte("3"))},
+		{ObjectName: "b_payload.json", OriginalFilename: "payload.json", PayloadBase64: base64.StdEncoding.EncodeToString([]byte("4"))},
+	}
+	zipService := services.NewDefaultZipService()
+	archive, err := zipService.CreateZip(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"payload.json", "b_payload.json", "c_payload.json", "payload (2).json"}
+	if names := zipEntryNames(t, archive); !slices.Equal(names, want) {
+		t.Errorf("Expected entries %v, got %v", want, names)
+	}
+
+	encrypted, err := zipService.CreateEncryptedZip(files, "partner-passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := zipEntryNames(t, encrypted); !slices.Equal(names, want) {
+		t.Errorf("Expected encrypted entries %v, got %v", want, names)
+	}
+}
+
+func TestWriteZip_DeduplicatesEntryNames(t *testing.T) {
+	entry := func(name string) services.ZipEntry {
+		return services.ZipEntry{Name: name, Size: 1, CRC32: crc32.ChecksumIEEE([]byte("x")), Data: strings.NewReader("x")}
+	}
+	var buf bytes.Buffer
+	err := services.NewDefaultZipService().WriteZip(&buf, []services.ZipEntry{
+		entry("logs/app.log"), entry("logs/app.log"), entry("logs/App.log"), entry("logs/app (2).log"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"logs/app.log", "logs/app (2).log", "logs/App (3).log", "logs/app (2) (2).log"}
+	if names := zipEntryNames(t, buf.Bytes()); !slices.Equal(names, want) {
+		t.Errorf("Expected entries %v, got %v", want, names)
+	}
+}